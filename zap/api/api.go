@@ -0,0 +1,212 @@
+// Package api describes the HTTP API of zap serve: the bodies of its
+// requests and answers, the operations that take them, the OpenAPI
+// document generated from both, and a client for other Go services.
+package api
+
+import (
+	"time"
+
+	"zap/config"
+)
+
+// Lists are the lists tasks can be added to
+type Lists struct {
+	Inbox string   `json:"inbox" doc:"The list tasks are added to unless they name one"`
+	Lists []string `json:"lists" doc:"The inbox and the target lists"`
+}
+
+// NewTask is a task to capture, typically the page being read
+type NewTask struct {
+	Title string `json:"title,omitempty" doc:"The task; defaults to the url"`
+	URL   string `json:"url,omitempty" doc:"A link kept in the task's notes"`
+	Notes string `json:"notes,omitempty" doc:"Kept in the task's notes after the link"`
+	List  string `json:"list,omitempty" doc:"The list to add the task to; defaults to the inbox"`
+	Due   string `json:"due,omitempty" doc:"A YYYY-MM-DD due date"`
+}
+
+// Task is a task that was added
+type Task struct {
+	ID    string `json:"id" doc:"The task's ID; empty in a dry run"`
+	List  string `json:"list" doc:"The list the task was added to"`
+	Title string `json:"title"`
+}
+
+// RunStarted answers a request that queued a run
+type RunStarted struct {
+	Status string `json:"status" doc:"Always queued; the run starts once the user's earlier runs finished"`
+	ID     string `json:"id" doc:"The run's ID, which is also its job's"`
+	Events string `json:"events" doc:"The path streaming the run's progress"`
+	Job    string `json:"job" doc:"The path of the run's job"`
+}
+
+// Jobs are the runs queued for a user, newest first
+type Jobs struct {
+	Jobs []Job `json:"jobs"`
+}
+
+// Job is a run queued for a user and how it went
+type Job struct {
+	ID       string     `json:"id"`
+	Trigger  string     `json:"trigger" doc:"What queued the run"`
+	Lists    []string   `json:"lists,omitempty" doc:"The lists the run is limited to"`
+	State    string     `json:"state" doc:"queued, running, succeeded or failed"`
+	Attempts int        `json:"attempts" doc:"The times the run was started; failed runs are tried again"`
+	Enqueued time.Time  `json:"enqueued"`
+	Started  *time.Time `json:"started,omitempty"`
+	Finished *time.Time `json:"finished,omitempty"`
+	RetryAt  *time.Time `json:"retryAt,omitempty" doc:"When a failed attempt is tried again"`
+	Error    string     `json:"error,omitempty" doc:"Why the last attempt failed"`
+	Report   *RunReport `json:"report,omitempty" doc:"What the last attempt did"`
+}
+
+// Progress is a step of a run starting or ending, or a message it printed
+type Progress struct {
+	Phase   string `json:"phase,omitempty" doc:"fetch, analyze, reorder or subtasks"`
+	Item    string `json:"item,omitempty" doc:"What the step works on, usually a list"`
+	Done    int    `json:"done" doc:"The steps of the phase done so far"`
+	Total   int    `json:"total" doc:"The steps of the phase expected"`
+	Ended   bool   `json:"ended" doc:"Whether the step ended, rather than started"`
+	Message string `json:"message,omitempty" doc:"A message the run printed; phase and item are empty then"`
+}
+
+// RunReport is what a run did
+type RunReport struct {
+	ID       string          `json:"id"`
+	Trigger  string          `json:"trigger" doc:"What started the run"`
+	Started  time.Time       `json:"started"`
+	Finished time.Time       `json:"finished" doc:"Zero until the run's job finished"`
+	DryRun   bool            `json:"dryRun"`
+	Lists    []ListReport    `json:"lists"`
+	Subtasks []SubtaskReport `json:"subtasks,omitempty"`
+	Skipped  []string        `json:"skipped,omitempty" doc:"Lists skipped for being over budget"`
+	Errors   []string        `json:"errors,omitempty"`
+	Warnings []Warning       `json:"warnings,omitempty" doc:"Lists left out because the user can't read them"`
+}
+
+// ListReport is what a run did to one list
+type ListReport struct {
+	Title    string `json:"title"`
+	Tasks    int    `json:"tasks" doc:"The tasks ranked"`
+	RankedBy string `json:"rankedBy,omitempty"`
+	Moves    int    `json:"moves"`
+}
+
+// SubtaskReport is the subtasks a run created in one list
+type SubtaskReport struct {
+	List    string `json:"list"`
+	Created int    `json:"created"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Warning is a list a run left out, and how to fix it
+type Warning struct {
+	List    string `json:"list"`
+	Problem string `json:"problem"`
+	Fix     string `json:"fix" doc:"What to change, e.g. in the Admin console, so the list can be read"`
+}
+
+// Error answers a request that failed
+type Error struct {
+	Error string `json:"error"`
+}
+
+// Operation is one endpoint of the API
+type Operation struct {
+	ID      string
+	Method  string
+	Path    string
+	Summary string
+	// Scope is the token scope the operation needs
+	Scope string
+	// Request and Response are the bodies, nil when there is none
+	Request  any
+	Response any
+	// Events are the Server-Sent Events an operation streams instead of a
+	// response body
+	Events []Event
+	// Status answers success
+	Status int
+	// Errors are the statuses failures answer with, besides 401 and 403
+	Errors []int
+}
+
+// Event is a kind of Server-Sent Event, with the body of its JSON data
+type Event struct {
+	Name string
+	Data any
+}
+
+// Operations are the endpoints of the API under /api
+var Operations = []Operation{
+	{
+		ID:       "listLists",
+		Method:   "GET",
+		Path:     "/api/lists",
+		Summary:  "List the lists tasks can be added to",
+		Scope:    config.ScopeRead,
+		Response: Lists{},
+		Status:   200,
+		Errors:   []int{502},
+	},
+	{
+		ID:       "addTask",
+		Method:   "POST",
+		Path:     "/api/tasks",
+		Summary:  "Add a task to the top of a list",
+		Scope:    config.ScopeRun,
+		Request:  NewTask{},
+		Response: Task{},
+		Status:   201,
+		Errors:   []int{400, 404, 502},
+	},
+	{
+		ID:       "prioritize",
+		Method:   "POST",
+		Path:     "/api/prioritize",
+		Summary:  "Start a run and answer without waiting for it",
+		Scope:    config.ScopeRun,
+		Response: RunStarted{},
+		Status:   202,
+		Errors:   []int{500, 502},
+	},
+	{
+		ID:       "listJobs",
+		Method:   "GET",
+		Path:     "/api/jobs",
+		Summary:  "List the runs queued for the user, with the history of finished ones",
+		Scope:    config.ScopeRead,
+		Response: Jobs{},
+		Status:   200,
+		Errors:   []int{500, 502},
+	},
+	{
+		ID:       "getJob",
+		Method:   "GET",
+		Path:     "/api/jobs/{id}",
+		Summary:  "Show how a queued run went",
+		Scope:    config.ScopeRead,
+		Response: Job{},
+		Status:   200,
+		Errors:   []int{404, 500, 502},
+	},
+	{
+		ID:       "retryJob",
+		Method:   "POST",
+		Path:     "/api/jobs/{id}/retry",
+		Summary:  "Queue a run that failed for good again",
+		Scope:    config.ScopeRun,
+		Response: Job{},
+		Status:   202,
+		Errors:   []int{404, 409, 500, 502},
+	},
+	{
+		ID:      "runEvents",
+		Method:  "GET",
+		Path:    "/api/runs/{id}/events",
+		Summary: "Stream a run's progress, from its start, then its report once it finished for good",
+		Scope:   config.ScopeRead,
+		Events:  []Event{{"progress", Progress{}}, {"report", RunReport{}}},
+		Status:  200,
+		Errors:  []int{404, 502},
+	},
+}
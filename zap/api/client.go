@@ -0,0 +1,206 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// StatusError is a request the server refused or failed
+type StatusError struct {
+	Status  int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("zap serve answered %d %s: %s", e.Status, http.StatusText(e.Status), e.Message)
+}
+
+// Client calls the API of a zap serve
+type Client struct {
+	base  *url.URL
+	token string
+	// User, when set, is the user requests act for, which only admin
+	// tokens may choose
+	User string
+	// HTTP sends the requests
+	HTTP *http.Client
+}
+
+// NewClient creates a client for the server at serverURL, e.g.
+// http://localhost:8080, calling it with token
+func NewClient(serverURL, token string) (*Client, error) {
+	base, err := url.Parse(strings.TrimSuffix(serverURL, "/") + "/")
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("invalid zap serve url %q", serverURL)
+	}
+	return &Client{base: base, token: token, HTTP: &http.Client{Timeout: 30 * time.Second}}, nil
+}
+
+// Lists returns the lists tasks can be added to
+func (c *Client) Lists(ctx context.Context) (*Lists, error) {
+	var lists Lists
+	if err := c.do(ctx, http.MethodGet, "api/lists", nil, &lists); err != nil {
+		return nil, err
+	}
+	return &lists, nil
+}
+
+// AddTask adds a task to the top of its list, or of the inbox
+func (c *Client) AddTask(ctx context.Context, task NewTask) (*Task, error) {
+	var added Task
+	if err := c.do(ctx, http.MethodPost, "api/tasks", task, &added); err != nil {
+		return nil, err
+	}
+	return &added, nil
+}
+
+// Prioritize queues a run without waiting for it to finish, returning its
+// ID to follow it with
+func (c *Client) Prioritize(ctx context.Context) (*RunStarted, error) {
+	var started RunStarted
+	if err := c.do(ctx, http.MethodPost, "api/prioritize", nil, &started); err != nil {
+		return nil, err
+	}
+	return &started, nil
+}
+
+// Jobs returns the runs queued for the user, newest first
+func (c *Client) Jobs(ctx context.Context) ([]Job, error) {
+	var jobs Jobs
+	if err := c.do(ctx, http.MethodGet, "api/jobs", nil, &jobs); err != nil {
+		return nil, err
+	}
+	return jobs.Jobs, nil
+}
+
+// Job returns how a queued run went
+func (c *Client) Job(ctx context.Context, id string) (*Job, error) {
+	var job Job
+	if err := c.do(ctx, http.MethodGet, "api/jobs/"+url.PathEscape(id), nil, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// RetryJob queues a run that failed for good again
+func (c *Client) RetryJob(ctx context.Context, id string) (*Job, error) {
+	var job Job
+	if err := c.do(ctx, http.MethodPost, "api/jobs/"+url.PathEscape(id)+"/retry", nil, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Follow calls fn with the progress of a run, from its start, until it
+// finishes, and returns its report
+func (c *Client) Follow(ctx context.Context, id string, fn func(Progress)) (*RunReport, error) {
+	// The stream lasts as long as the run, however long the client's
+	// requests may take
+	streaming := *c.HTTP
+	streaming.Timeout = 0
+	resp, err := c.send(ctx, &streaming, http.MethodGet, "api/runs/"+url.PathEscape(id)+"/events", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var event string
+	var data []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line != "" {
+			field, value, _ := strings.Cut(line, ":")
+			value = strings.TrimPrefix(value, " ")
+			switch field {
+			case "event":
+				event = value
+			case "data":
+				data = append(data, value)
+			}
+			continue
+		}
+		payload := []byte(strings.Join(data, "\n"))
+		switch event {
+		case "progress":
+			var progress Progress
+			if err := json.Unmarshal(payload, &progress); err != nil {
+				return nil, err
+			}
+			fn(progress)
+		case "report":
+			var report RunReport
+			if err := json.Unmarshal(payload, &report); err != nil {
+				return nil, err
+			}
+			return &report, nil
+		}
+		event, data = "", nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.ErrUnexpectedEOF
+}
+
+// do sends a request with a JSON body, if any, and decodes the answer
+// into out
+func (c *Client) do(ctx context.Context, method, path string, in, out any) error {
+	resp, err := c.send(ctx, c.HTTP, method, path, in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// send sends a request with a JSON body, if any, with client, returning
+// the answer when it succeeded
+func (c *Client) send(ctx context.Context, client *http.Client, method, path string, in any) (*http.Response, error) {
+	target, err := c.base.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	if c.User != "" {
+		target.RawQuery = url.Values{"user": {c.User}}.Encode()
+	}
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		var failure Error
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(data, &failure) != nil || failure.Error == "" {
+			failure.Error = strings.TrimSpace(string(data))
+		}
+		return nil, &StatusError{Status: resp.StatusCode, Message: failure.Error}
+	}
+	return resp, nil
+}
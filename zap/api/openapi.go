@@ -0,0 +1,169 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// object is a JSON object of the OpenAPI document
+type object = map[string]any
+
+// pathParameter matches the parameters in an operation's path, e.g. {id}
+var pathParameter = regexp.MustCompile(`\{(\w+)\}`)
+
+// OpenAPI returns the OpenAPI 3 document describing Operations, with the
+// schemas of their bodies generated from the Go types
+func OpenAPI() ([]byte, error) {
+	schemas := object{"Error": schema(reflect.TypeOf(Error{}))}
+	paths := object{}
+	for _, op := range Operations {
+		operation := object{
+			"operationId": op.ID,
+			"summary":     op.Summary,
+			"description": "Needs a token with the " + op.Scope + " scope.",
+		}
+		parameters := []any{object{
+			"name":        "user",
+			"in":          "query",
+			"description": "The user to act for; only admin tokens may name one other than their own",
+			"schema":      object{"type": "string", "format": "email"},
+		}}
+		for _, match := range pathParameter.FindAllStringSubmatch(op.Path, -1) {
+			parameters = append(parameters, object{
+				"name":     match[1],
+				"in":       "path",
+				"required": true,
+				"schema":   object{"type": "string"},
+			})
+		}
+		operation["parameters"] = parameters
+		responses := object{}
+		if op.Response != nil {
+			responses[strconv.Itoa(op.Status)] = body(schemas, op.Response, http.StatusText(op.Status))
+		}
+		if op.Events != nil {
+			responses[strconv.Itoa(op.Status)] = events(schemas, op.Events)
+		}
+		for _, status := range append([]int{http.StatusUnauthorized, http.StatusForbidden}, op.Errors...) {
+			responses[strconv.Itoa(status)] = body(schemas, Error{}, http.StatusText(status))
+		}
+		operation["responses"] = responses
+		if op.Request != nil {
+			request := body(schemas, op.Request, "")
+			delete(request, "description")
+			request["required"] = true
+			operation["requestBody"] = request
+		}
+
+		item, _ := paths[op.Path].(object)
+		if item == nil {
+			item = object{}
+			paths[op.Path] = item
+		}
+		item[strings.ToLower(op.Method)] = operation
+	}
+
+	document := object{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":       "zap serve",
+			"version":     "1",
+			"description": "Captures tasks and starts runs of zap, which prioritizes task lists.",
+		},
+		"paths": paths,
+		"components": object{
+			"schemas": schemas,
+			"securitySchemes": object{
+				"token": object{"type": "http", "scheme": "bearer", "description": "An API token"},
+			},
+		},
+		"security": []any{object{"token": []any{}}},
+	}
+	return json.MarshalIndent(document, "", "  ")
+}
+
+// events describes a stream of Server-Sent Events, adding the schemas of
+// their data to schemas
+func events(schemas object, kinds []Event) object {
+	var described []string
+	for _, kind := range kinds {
+		t := reflect.TypeOf(kind.Data)
+		schemas[t.Name()] = schema(t)
+		described = append(described, fmt.Sprintf("%s (%s)", kind.Name, t.Name()))
+	}
+	return object{
+		"description": "Server-Sent Events with JSON data, in turn: " + strings.Join(described, ", ") + ".",
+		"content": object{
+			"text/event-stream": object{"schema": object{"type": "string"}},
+		},
+	}
+}
+
+// body describes a JSON body of v's type, adding its schema to schemas
+func body(schemas object, v any, description string) object {
+	t := reflect.TypeOf(v)
+	schemas[t.Name()] = schema(t)
+	return object{
+		"description": description,
+		"content": object{
+			"application/json": object{
+				"schema": object{"$ref": "#/components/schemas/" + t.Name()},
+			},
+		},
+	}
+}
+
+// schema describes a type as JSON schema, its struct fields by their JSON
+// names and doc tags
+func schema(t reflect.Type) object {
+	if t == reflect.TypeOf(time.Time{}) {
+		return object{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return object{"type": "string"}
+	case reflect.Bool:
+		return object{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return object{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return object{"type": "number"}
+	case reflect.Slice:
+		return object{"type": "array", "items": schema(t.Elem())}
+	case reflect.Pointer:
+		return schema(t.Elem())
+	case reflect.Struct:
+		properties := object{}
+		var required []string
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if !field.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			property := schema(field.Type)
+			if doc := field.Tag.Get("doc"); doc != "" {
+				property["description"] = doc
+			}
+			properties[name] = property
+			if !strings.Contains(options, "omitempty") {
+				required = append(required, name)
+			}
+		}
+		s := object{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			s["required"] = required
+		}
+		return s
+	}
+	return object{}
+}
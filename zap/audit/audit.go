@@ -0,0 +1,185 @@
+package audit
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"zap/llm"
+)
+
+const (
+	// DefaultMaxSize is the size in bytes at which the log is rotated
+	DefaultMaxSize = 10 << 20
+	// DefaultMaxFiles is how many rotated files are kept
+	DefaultMaxFiles = 5
+)
+
+// idFieldPattern matches JSON fields that carry task IDs in zap's prompts
+// and in model answers
+var idFieldPattern = regexp.MustCompile(`("(?:id|taskId|parentTaskId)"\s*:\s*")([^"]+)(")`)
+
+// Entry is one prompt and the raw answer to it. Turn counts the earlier
+// turns of the conversation the prompt continues, which are logged in
+// earlier entries.
+type Entry struct {
+	Time         time.Time `json:"time"`
+	Provider     string    `json:"provider"`
+	JSON         bool      `json:"json"`
+	System       string    `json:"system,omitempty"`
+	Prompt       string    `json:"prompt"`
+	Turn         int       `json:"turn,omitempty"`
+	Response     string    `json:"response,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	InputTokens  int       `json:"inputTokens,omitempty"`
+	OutputTokens int       `json:"outputTokens,omitempty"`
+	DurationMS   int64     `json:"durationMs"`
+}
+
+// Log appends entries to a JSONL file, rotating it to path.1, path.2, ...
+// once it grows past maxSize. Entries are never rewritten.
+type Log struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+	// key pseudonymizes task IDs with HMAC-SHA256; nil keeps them as is
+	key []byte
+
+	mu sync.Mutex
+}
+
+// NewLog creates an audit log. maxSize and maxFiles <= 0 use the defaults.
+// A non-nil key replaces task IDs with stable pseudonyms, so entries can be
+// correlated with each other but not with the user's tasks.
+func NewLog(path string, maxSize int64, maxFiles int, key []byte) *Log {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	if maxFiles <= 0 {
+		maxFiles = DefaultMaxFiles
+	}
+	return &Log{path: path, maxSize: maxSize, maxFiles: maxFiles, key: key}
+}
+
+// Write appends an entry, pseudonymizing task IDs first
+func (l *Log) Write(entry Entry) error {
+	entry.System = l.pseudonymize(entry.System)
+	entry.Prompt = l.pseudonymize(entry.Prompt)
+	entry.Response = l.pseudonymize(entry.Response)
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("unable to encode audit entry: %v", err)
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.rotate(int64(len(line))); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("unable to open audit log: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(line); err != nil {
+		return fmt.Errorf("unable to write audit log: %v", err)
+	}
+	return nil
+}
+
+// rotate shifts the log files when the next write would exceed maxSize
+func (l *Log) rotate(next int64) error {
+	info, err := os.Stat(l.path)
+	if os.IsNotExist(err) || (err == nil && info.Size()+next <= l.maxSize) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to stat audit log: %v", err)
+	}
+
+	os.Remove(fmt.Sprintf("%s.%d", l.path, l.maxFiles))
+	for i := l.maxFiles - 1; i >= 1; i-- {
+		from := fmt.Sprintf("%s.%d", l.path, i)
+		if _, err := os.Stat(from); err == nil {
+			if err := os.Rename(from, fmt.Sprintf("%s.%d", l.path, i+1)); err != nil {
+				return fmt.Errorf("unable to rotate audit log: %v", err)
+			}
+		}
+	}
+	if err := os.Rename(l.path, l.path+".1"); err != nil {
+		return fmt.Errorf("unable to rotate audit log: %v", err)
+	}
+	return nil
+}
+
+// pseudonymize replaces task IDs in JSON fields with HMAC-based pseudonyms
+func (l *Log) pseudonymize(text string) string {
+	if l.key == nil || text == "" {
+		return text
+	}
+	return idFieldPattern.ReplaceAllStringFunc(text, func(match string) string {
+		parts := idFieldPattern.FindStringSubmatch(match)
+		return parts[1] + l.Pseudonym(parts[2]) + parts[3]
+	})
+}
+
+// Pseudonym returns the stable pseudonym for a task ID
+func (l *Log) Pseudonym(id string) string {
+	if l.key == nil {
+		return id
+	}
+	mac := hmac.New(sha256.New, l.key)
+	mac.Write([]byte(id))
+	return "task-" + hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// Provider records every request made through an llm.Provider
+type Provider struct {
+	llm.Provider
+	log *Log
+}
+
+// Wrap returns a provider that writes each prompt and answer to log.
+// Failing to write the audit log fails the request, so no answer is used
+// without a record.
+func Wrap(provider llm.Provider, log *Log) *Provider {
+	return &Provider{Provider: provider, log: log}
+}
+
+// Generate forwards the request and logs it with the raw response
+func (p *Provider) Generate(ctx context.Context, req llm.Request) (llm.Response, error) {
+	start := time.Now()
+	resp, err := p.Provider.Generate(ctx, req)
+
+	entry := Entry{
+		Time:         start.UTC(),
+		Provider:     resp.Provider,
+		JSON:         req.JSON,
+		System:       req.System,
+		Prompt:       req.Prompt,
+		Turn:         len(req.History),
+		Response:     resp.Text,
+		InputTokens:  resp.Usage.InputTokens,
+		OutputTokens: resp.Usage.OutputTokens,
+		DurationMS:   time.Since(start).Milliseconds(),
+	}
+	if entry.Provider == "" {
+		entry.Provider = p.Provider.Name()
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if logErr := p.log.Write(entry); logErr != nil {
+		return resp, fmt.Errorf("audit log: %v", logErr)
+	}
+	return resp, err
+}
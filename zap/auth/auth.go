@@ -2,22 +2,53 @@ package auth
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 
-	"golang.org/x/oauth2/google"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
+	"google.golang.org/api/pubsub/v1"
+	"google.golang.org/api/sheets/v4"
 	"google.golang.org/api/tasks/v1"
 )
 
+const (
+	// ScopeTasks grants read and write access to Google Tasks
+	ScopeTasks = tasks.TasksScope
+	// ScopeTasksReadonly grants read-only access to Google Tasks
+	ScopeTasksReadonly = tasks.TasksReadonlyScope
+	// ScopeSheets grants read and write access to Google Sheets, for
+	// exporting run reports
+	ScopeSheets = sheets.SpreadsheetsScope
+	// ScopeCalendarReadonly grants read-only access to Google Calendar, for
+	// planning around the day's events
+	ScopeCalendarReadonly = calendar.CalendarReadonlyScope
+	// ScopeGmailReadonly grants read-only access to Gmail, for turning
+	// starred or labelled mail into tasks
+	ScopeGmailReadonly = gmail.GmailReadonlyScope
+	// ScopePubSub grants access to Pub/Sub, for runs triggered by messages
+	ScopePubSub = pubsub.PubsubScope
+)
+
+// ErrInsufficientScope is returned when the granted OAuth scopes don't cover an operation
+var ErrInsufficientScope = errors.New("insufficient OAuth scope")
+
 // Config holds the service account configuration
 type Config struct {
 	credentialsPath string
 	credentials     []byte
+	scopes          []string
 }
 
-// NewConfig creates a new configuration from service account credentials file
-func NewConfig(credentialsPath string) (*Config, error) {
+// NewConfig creates a new configuration from service account credentials file.
+// When no scopes are given the read/write Tasks scope is requested.
+func NewConfig(credentialsPath string, scopes ...string) (*Config, error) {
 	if _, err := os.Stat(credentialsPath); err != nil {
 		return nil, fmt.Errorf("unable to read credentials file: %v", err)
 	}
@@ -25,30 +56,157 @@ func NewConfig(credentialsPath string) (*Config, error) {
 	if err != nil {
 		return nil, fmt.Errorf("unable to read credentials file: %v", err)
 	}
-	return &Config{credentialsPath: credentialsPath, credentials: credentials}, nil
+	if len(scopes) == 0 {
+		scopes = []string{ScopeTasks}
+	}
+	return &Config{credentialsPath: credentialsPath, credentials: credentials, scopes: scopes}, nil
+}
+
+// Scopes returns the OAuth scopes requested by this configuration
+func (c *Config) Scopes() []string {
+	return c.scopes
+}
+
+// ClientID returns the service account's OAuth client ID, which is what
+// domain-wide delegation is granted to
+func (c *Config) ClientID() string {
+	var key struct {
+		ClientID string `json:"client_id"`
+	}
+	json.Unmarshal(c.credentials, &key)
+	return key.ClientID
+}
+
+// ReadOnly reports whether the configuration lacks the read/write Tasks scope
+func (c *Config) ReadOnly() bool {
+	for _, scope := range c.scopes {
+		if scope == ScopeTasks {
+			return false
+		}
+	}
+	return true
 }
 
 // CreateClient creates a new Tasks API client using service account credentials
 func (c *Config) CreateClient(ctx context.Context) (*tasks.Service, error) {
-	client, err := tasks.NewService(ctx, option.WithCredentialsFile(c.credentialsPath))
+	client, err := tasks.NewService(ctx, option.WithCredentialsFile(c.credentialsPath), option.WithScopes(c.scopes...))
 	if err != nil {
 		return nil, fmt.Errorf("unable to create tasks client: %v", err)
 	}
 	return client, nil
 }
 
+// CreateClientAsUser creates a Tasks API client that impersonates userEmail.
+// It reuses the token of a Preflight that covered the configured scopes,
+// which callers run first to check everything the run needs in one token
+// request; without one, delegation is checked here, so missing scopes
+// still fail before any work is done, naming the ones to grant.
 func (c *Config) CreateClientAsUser(ctx context.Context, userEmail string) (*tasks.Service, error) {
-	config, err := google.JWTConfigFromJSON(c.credentials,
-		"https://www.googleapis.com/auth/tasks",
-	)
+	source, err := c.tokenSource(ctx, userEmail, c.scopes...)
 	if err != nil {
-		return nil, fmt.Errorf("creating JWT config: %v", err)
+		return nil, err
 	}
+	return tasks.NewService(ctx, option.WithHTTPClient(oauth2.NewClient(ctx, source)))
+}
 
-	// Set the subject (user to impersonate)
-	config.Subject = userEmail
+// CreateSheetsClientAsUser creates a Sheets API client that impersonates
+// userEmail. The Sheets scope must be delegated to the service account
+// along with the Tasks scopes.
+func (c *Config) CreateSheetsClientAsUser(ctx context.Context, userEmail string) (*sheets.Service, error) {
+	source, err := c.tokenSource(ctx, userEmail, ScopeSheets)
+	if err != nil {
+		return nil, err
+	}
+	return sheets.NewService(ctx, option.WithHTTPClient(oauth2.NewClient(ctx, source)))
+}
 
-	client := config.Client(ctx)
+// CreateCalendarClientAsUser creates a read-only Calendar API client that
+// impersonates userEmail. The Calendar scope must be delegated to the
+// service account along with the Tasks scopes.
+func (c *Config) CreateCalendarClientAsUser(ctx context.Context, userEmail string) (*calendar.Service, error) {
+	source, err := c.tokenSource(ctx, userEmail, ScopeCalendarReadonly)
+	if err != nil {
+		return nil, err
+	}
+	return calendar.NewService(ctx, option.WithHTTPClient(oauth2.NewClient(ctx, source)))
+}
 
-	return tasks.NewService(ctx, option.WithHTTPClient(client))
+// CreateGmailClientAsUser creates a read-only Gmail API client that
+// impersonates userEmail. The Gmail scope must be delegated to the service
+// account along with the Tasks scopes.
+func (c *Config) CreateGmailClientAsUser(ctx context.Context, userEmail string) (*gmail.Service, error) {
+	source, err := c.tokenSource(ctx, userEmail, ScopeGmailReadonly)
+	if err != nil {
+		return nil, err
+	}
+	return gmail.NewService(ctx, option.WithHTTPClient(oauth2.NewClient(ctx, source)))
+}
+
+// CreatePubSubClient creates a Pub/Sub API client acting as the service
+// account itself, which needs the Pub/Sub Subscriber role on the
+// subscription. Without a credentials file, application default
+// credentials are used, e.g. a workload's own service account. When
+// PUBSUB_EMULATOR_HOST is set, the emulator there is used without signing in.
+func CreatePubSubClient(ctx context.Context, credentialsPath string) (*pubsub.Service, error) {
+	opts := []option.ClientOption{option.WithScopes(ScopePubSub)}
+	if host := os.Getenv("PUBSUB_EMULATOR_HOST"); host != "" {
+		opts = []option.ClientOption{option.WithEndpoint("http://" + host + "/"), option.WithoutAuthentication()}
+	} else if credentialsPath != "" {
+		opts = append(opts, option.WithCredentialsFile(credentialsPath))
+	}
+	client, err := pubsub.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create pubsub client: %v", err)
+	}
+	return client, nil
+}
+
+// tokenError translates token exchange failures into actionable messages
+func tokenError(clientID, userEmail string, scopes []string, err error) error {
+	code, description := tokenErrorDetails(err)
+	switch {
+	case code == "unauthorized_client":
+		return &DelegationError{ClientID: clientID, User: userEmail, Missing: scopes}
+	case code == "invalid_scope" || code == "access_denied":
+		return fmt.Errorf("%w: the service account may not impersonate %s with scopes %s (%s); check the client ID %s's scopes in the %s",
+			ErrInsufficientScope, userEmail, strings.Join(scopes, ","), code, clientID, delegationConsole)
+	case code == "invalid_grant" && strings.Contains(description, "email"):
+		return fmt.Errorf("unable to act for %s, which isn't an active user of the Workspace domain: %s", userEmail, description)
+	}
+	return fmt.Errorf("unable to obtain token for %s: %v", userEmail, err)
+}
+
+// IsAuthError reports whether err means zap couldn't authenticate or isn't
+// allowed to access the tasks: rejected credentials, a failed token refresh
+// or missing scopes. Other 403s, such as the Tasks API's rate limits, are
+// not auth errors.
+func IsAuthError(err error) bool {
+	if IsInsufficientScope(err) {
+		return true
+	}
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) {
+		return true
+	}
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == 401
+}
+
+// IsInsufficientScope reports whether err is an API error caused by a token
+// that lacks the scope required for the call
+func IsInsufficientScope(err error) bool {
+	if errors.Is(err, ErrInsufficientScope) {
+		return true
+	}
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != 403 {
+		return false
+	}
+	for _, item := range apiErr.Errors {
+		if item.Reason == "insufficientPermissions" {
+			return true
+		}
+	}
+	return strings.Contains(apiErr.Message, "insufficient authentication scopes") ||
+		strings.Contains(apiErr.Body, "ACCESS_TOKEN_SCOPE_INSUFFICIENT")
 }
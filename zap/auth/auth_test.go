@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+)
+
+func TestIsAuthError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"unauthenticated", &googleapi.Error{Code: 401}, true},
+		{"insufficient scope", &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "insufficientPermissions"}}}, true},
+		{"missing delegation", &DelegationError{ClientID: "1234", User: "a@example.com", Missing: []string{ScopeTasks}}, true},
+		{"failed token refresh", fmt.Errorf("refreshing: %w", &oauth2.RetrieveError{}), true},
+		{"rate limit", &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "rateLimitExceeded"}}}, false},
+		{"user rate limit", fmt.Errorf("listing tasks: %w", &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "userRateLimitExceeded"}}}), false},
+		{"not found", &googleapi.Error{Code: 404}, false},
+		{"other", errors.New("connection refused"), false},
+	}
+	for _, test := range tests {
+		if got := IsAuthError(test.err); got != test.want {
+			t.Errorf("IsAuthError(%s) = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// delegationConsole is where domain-wide delegation is granted
+const delegationConsole = "Admin console under Security > Access and data control > API controls > Domain-wide delegation"
+
+// DelegationError is returned when the service account may not impersonate
+// a user with some scopes because domain-wide delegation doesn't grant them
+type DelegationError struct {
+	ClientID string
+	User     string
+	// Missing are the scopes delegation lacks
+	Missing []string
+}
+
+func (e *DelegationError) Error() string {
+	return fmt.Sprintf("domain-wide delegation doesn't let client ID %s act for %s with %s; in the %s, add %s to the client's OAuth scopes (changes can take a few minutes to apply)",
+		e.ClientID, e.User, strings.Join(e.Missing, ","), delegationConsole, strings.Join(e.Missing, ","))
+}
+
+// Is makes errors.Is(err, ErrInsufficientScope) match, so the run exits as
+// an authentication failure
+func (e *DelegationError) Is(target error) bool {
+	return target == ErrInsufficientScope
+}
+
+// delegated holds the token sources of successful preflights by service
+// account, user and scopes, so the clients built after one reuse its token
+// rather than each asking for another
+var delegated = struct {
+	sync.Mutex
+	sources map[string]delegatedSource
+}{sources: make(map[string]delegatedSource)}
+
+// delegatedSource is a preflight's token source and the scopes it acts with
+type delegatedSource struct {
+	clientID string
+	user     string
+	scopes   []string
+	source   oauth2.TokenSource
+}
+
+// Preflight checks that the service account may impersonate userEmail with
+// scopes before any work is done. Google answers a token request that lacks
+// delegation for any of its scopes with an opaque "unauthorized_client", so
+// when it does each scope is asked for alone to name the missing ones in a
+// DelegationError. The token of a successful check is kept for the clients
+// created for userEmail afterwards.
+func (c *Config) Preflight(ctx context.Context, userEmail string, scopes ...string) error {
+	source, err := c.fetchToken(ctx, userEmail, scopes)
+	if err == nil {
+		clientID := c.ClientID()
+		delegated.Lock()
+		delegated.sources[clientID+"\x00"+userEmail+"\x00"+strings.Join(scopes, " ")] = delegatedSource{
+			clientID: clientID,
+			user:     userEmail,
+			scopes:   scopes,
+			source:   source,
+		}
+		delegated.Unlock()
+		return nil
+	}
+	if tokenErrorCode(err) != "unauthorized_client" {
+		return tokenError(c.ClientID(), userEmail, scopes, err)
+	}
+
+	var missing []string
+	for _, scope := range scopes {
+		_, err := c.fetchToken(ctx, userEmail, []string{scope})
+		switch {
+		case err == nil:
+		case tokenErrorCode(err) == "unauthorized_client":
+			missing = append(missing, scope)
+		default:
+			return tokenError(c.ClientID(), userEmail, []string{scope}, err)
+		}
+	}
+	// Each scope was granted alone; delegation must be missing all of them
+	// together, which Google doesn't say more about
+	if len(missing) == 0 {
+		missing = scopes
+	}
+	return &DelegationError{ClientID: c.ClientID(), User: userEmail, Missing: missing}
+}
+
+// fetchToken asks for a token acting for userEmail with scopes and returns
+// the source it came from, which hands it out until it expires. The source
+// outlives ctx, so a client built on it can refresh the token later.
+func (c *Config) fetchToken(ctx context.Context, userEmail string, scopes []string) (oauth2.TokenSource, error) {
+	config, err := google.JWTConfigFromJSON(c.credentials, scopes...)
+	if err != nil {
+		return nil, fmt.Errorf("creating JWT config: %v", err)
+	}
+	config.Subject = userEmail
+	source := config.TokenSource(context.WithoutCancel(ctx))
+	if _, err := source.Token(); err != nil {
+		return nil, err
+	}
+	return source, nil
+}
+
+// tokenSource returns a token source acting for userEmail with scopes: that
+// of an earlier Preflight covering them, or else of a new one
+func (c *Config) tokenSource(ctx context.Context, userEmail string, scopes ...string) (oauth2.TokenSource, error) {
+	if source := c.delegatedSource(userEmail, scopes); source != nil {
+		return source, nil
+	}
+	if err := c.Preflight(ctx, userEmail, scopes...); err != nil {
+		return nil, err
+	}
+	return c.delegatedSource(userEmail, scopes), nil
+}
+
+// delegatedSource returns the token source of a preflight for userEmail
+// that covers scopes, or nil if none does
+func (c *Config) delegatedSource(userEmail string, scopes []string) oauth2.TokenSource {
+	clientID := c.ClientID()
+	delegated.Lock()
+	defer delegated.Unlock()
+	for _, d := range delegated.sources {
+		if d.clientID != clientID || d.user != userEmail {
+			continue
+		}
+		covered := true
+		for _, scope := range scopes {
+			covered = covered && slices.Contains(d.scopes, scope)
+		}
+		if covered {
+			return d.source
+		}
+	}
+	return nil
+}
+
+// tokenErrorCode returns the OAuth error code of a failed token request,
+// e.g. "unauthorized_client", or "" for other failures
+func tokenErrorCode(err error) string {
+	code, _ := tokenErrorDetails(err)
+	return code
+}
+
+// tokenErrorDetails returns the OAuth error code and description of a
+// failed token request. Service account token requests leave them in the
+// body rather than in the error's fields.
+func tokenErrorDetails(err error) (string, string) {
+	var retrieveErr *oauth2.RetrieveError
+	if !errors.As(err, &retrieveErr) {
+		return "", ""
+	}
+	if retrieveErr.ErrorCode != "" {
+		return retrieveErr.ErrorCode, retrieveErr.ErrorDescription
+	}
+	var body struct {
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+	json.Unmarshal(retrieveErr.Body, &body)
+	return body.Error, body.Description
+}
@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+// tokenServer stands in for Google's token endpoint and APIs, counting the
+// tokens it hands out and recording the ones API calls are made with
+type tokenServer struct {
+	*httptest.Server
+	mu     sync.Mutex
+	issued int
+	used   []string
+}
+
+func newTokenServer(t *testing.T) *tokenServer {
+	s := &tokenServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/token" {
+			s.issued++
+			fmt.Fprintf(w, `{"access_token": "token-%d", "token_type": "Bearer", "expires_in": 3600}`, s.issued)
+			return
+		}
+		s.used = append(s.used, r.Header.Get("Authorization"))
+		fmt.Fprint(w, `{}`)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// context returns a context whose HTTP client sends every request to the
+// server, as the oauth2 package and the clients built on it pick it up
+func (s *tokenServer) context() context.Context {
+	target, _ := url.Parse(s.URL)
+	transport := roundTripper(func(r *http.Request) (*http.Response, error) {
+		r = r.Clone(r.Context())
+		r.URL.Scheme, r.URL.Host = target.Scheme, target.Host
+		return http.DefaultTransport.RoundTrip(r)
+	})
+	return context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{Transport: transport})
+}
+
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// serviceAccount writes a service account key file with a fresh key
+func serviceAccount(t *testing.T) string {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"client_email":   "zap@example.iam.gserviceaccount.com",
+		"client_id":      "1234",
+		"private_key_id": "key",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":      "https://oauth2.googleapis.com/token",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestClientsReuseThePreflightToken(t *testing.T) {
+	server := newTokenServer(t)
+	ctx := server.context()
+	config, err := NewConfig(serviceAccount(t), ScopeTasks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const user = "reuse@example.com"
+	if err := config.Preflight(ctx, user, ScopeTasks, ScopeCalendarReadonly); err != nil {
+		t.Fatal(err)
+	}
+	service, err := config.CreateClientAsUser(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.CreateCalendarClientAsUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Tasklists.List().Do(); err != nil {
+		t.Fatal(err)
+	}
+	if server.issued != 1 {
+		t.Errorf("issued %d tokens for a preflight and two clients it covers, want 1", server.issued)
+	}
+	if len(server.used) != 1 || server.used[0] != "Bearer token-1" {
+		t.Errorf("API called with %q, want the preflight's token", server.used)
+	}
+
+	// A client the preflight didn't cover checks delegation itself
+	if _, err := config.CreateGmailClientAsUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	if server.issued != 2 {
+		t.Errorf("issued %d tokens after a client the preflight didn't cover, want 2", server.issued)
+	}
+}
+
+func TestCreateClientAsUserChecksDelegationWithoutPreflight(t *testing.T) {
+	server := newTokenServer(t)
+	ctx := server.context()
+	config, err := NewConfig(serviceAccount(t), ScopeTasks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service, err := config.CreateClientAsUser(ctx, "unchecked@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Tasklists.List().Do(); err != nil {
+		t.Fatal(err)
+	}
+	if server.issued != 1 {
+		t.Errorf("issued %d tokens, want 1", server.issued)
+	}
+}
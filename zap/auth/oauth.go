@@ -0,0 +1,442 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/option"
+	"google.golang.org/api/sheets/v4"
+	"google.golang.org/api/tasks/v1"
+)
+
+// loginTimeout bounds how long the callback server waits for the browser
+const loginTimeout = 5 * time.Minute
+
+// OAuthConfig holds an installed-app OAuth client used to act as the signed-in user
+type OAuthConfig struct {
+	config *oauth2.Config
+}
+
+// NewOAuthConfig creates a configuration from an OAuth client secret file
+// downloaded from the Cloud Console. When no scopes are given the
+// read/write Tasks scope is requested.
+//
+// Some clients are issued without redirect URIs, which ConfigFromJSON
+// rejects, so a placeholder is added before parsing; both login flows
+// replace it with their loopback URL anyway.
+func NewOAuthConfig(clientSecretPath string, scopes ...string) (*OAuthConfig, error) {
+	data, err := os.ReadFile(clientSecretPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read client secret file: %v", err)
+	}
+	if len(scopes) == 0 {
+		scopes = []string{ScopeTasks}
+	}
+	data, err = withRedirectURI(data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse client secret file: %v", err)
+	}
+	config, err := google.ConfigFromJSON(data, scopes...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse client secret file: %v", err)
+	}
+	return &OAuthConfig{config: config}, nil
+}
+
+// withRedirectURI adds a loopback redirect URI to client secrets that lack one
+func withRedirectURI(data []byte) ([]byte, error) {
+	var file map[string]map[string]interface{}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	for _, client := range file {
+		if uris, ok := client["redirect_uris"].([]interface{}); !ok || len(uris) == 0 {
+			client["redirect_uris"] = []string{"http://localhost"}
+		}
+	}
+	return json.Marshal(file)
+}
+
+// Scopes returns the OAuth scopes requested by this configuration
+func (c *OAuthConfig) Scopes() []string {
+	return c.config.Scopes
+}
+
+// LoginWithBrowser runs the authorization code flow with PKCE. A callback
+// server listens on the loopback interface (port 0 picks a free port) and
+// the authorization URL is opened in the browser and printed to out.
+func (c *OAuthConfig) LoginWithBrowser(ctx context.Context, port int, out io.Writer) (*Token, error) {
+	return c.login(ctx, port, nil, out)
+}
+
+// LoginWithPaste runs the same flow for machines without a browser. The
+// authorization URL is printed to out to open on another device, whose
+// browser is then redirected to a loopback address it can't reach; the
+// user pastes the URL it tried to load, or just its code, into in. The
+// callback server still listens, so a port forwarded over SSH works too.
+func (c *OAuthConfig) LoginWithPaste(ctx context.Context, port int, in io.Reader, out io.Writer) (*Token, error) {
+	return c.login(ctx, port, in, out)
+}
+
+// login runs the authorization code flow, opening a browser unless the
+// code can be pasted into in
+func (c *OAuthConfig) login(ctx context.Context, port int, in io.Reader, out io.Writer) (*Token, error) {
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return nil, fmt.Errorf("unable to start callback server on port %d: %v", port, err)
+	}
+	defer listener.Close()
+
+	// Copy the config so concurrent logins don't share a redirect URL
+	config := *c.config
+	config.RedirectURL = fmt.Sprintf("http://127.0.0.1:%d/callback", listener.Addr().(*net.TCPAddr).Port)
+
+	state, err := randomState()
+	if err != nil {
+		return nil, err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	callback := newCallbackHandler(state)
+	mux := http.NewServeMux()
+	mux.Handle("/callback", callback)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go server.Serve(listener)
+	defer server.Close()
+
+	authURL := config.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.S256ChallengeOption(verifier))
+	if in != nil {
+		fmt.Fprintf(out, "On a machine with a browser, visit:\n\n  %s\n\n", authURL)
+		fmt.Fprintf(out, "After approving, the browser is sent to a %s page that won't load.\n", config.RedirectURL)
+		fmt.Fprint(out, "Copy that page's full URL from the address bar and paste it here: ")
+		go readPasted(in, state, callback.result)
+	} else {
+		fmt.Fprintf(out, "Opening your browser to authorize zap. If it doesn't open, visit:\n\n  %s\n\n", authURL)
+		if err := openBrowser(authURL); err != nil {
+			fmt.Fprintf(out, "Unable to open a browser automatically: %v\n", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, loginTimeout)
+	defer cancel()
+
+	var code string
+	select {
+	case result := <-callback.result:
+		if result.err != nil {
+			return nil, result.err
+		}
+		code = result.code
+	case <-ctx.Done():
+		return nil, fmt.Errorf("timed out waiting for authorization: %v", ctx.Err())
+	}
+
+	token, err := config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("unable to exchange authorization code: %v", err)
+	}
+	return newToken(token, c.config.Scopes), nil
+}
+
+// readPasted reads the redirected URL or code the user pastes and hands
+// over the code, unless the callback server got one first
+func readPasted(in io.Reader, state string, result chan callbackResult) {
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && line == "" {
+		err = fmt.Errorf("unable to read the pasted URL: %v", err)
+		select {
+		case result <- callbackResult{err: err}:
+		default:
+		}
+		return
+	}
+	code, err := pastedCode(line, state)
+	select {
+	case result <- callbackResult{code: code, err: err}:
+	default:
+	}
+}
+
+// pastedCode takes the code from a pasted redirect URL, checking its
+// state, or returns a pasted code as it is
+func pastedCode(pasted, state string) (string, error) {
+	pasted = strings.TrimSpace(pasted)
+	if pasted == "" {
+		return "", fmt.Errorf("nothing was pasted")
+	}
+	if !strings.Contains(pasted, "code=") && !strings.Contains(pasted, "error=") {
+		return pasted, nil
+	}
+	u, err := url.Parse(pasted)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse the pasted URL: %v", err)
+	}
+	query := u.Query()
+	switch {
+	case query.Get("error") != "":
+		return "", fmt.Errorf("authorization denied: %s", query.Get("error"))
+	case subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(state)) != 1:
+		return "", fmt.Errorf("the pasted URL is from a different login; run 'zap login' again")
+	case query.Get("code") == "":
+		return "", fmt.Errorf("the pasted URL did not include a code")
+	}
+	return query.Get("code"), nil
+}
+
+// CreateClient creates a Tasks API client acting as the user who granted token.
+// Refreshed access tokens are written back to tokenPath.
+func (c *OAuthConfig) CreateClient(ctx context.Context, token *Token, tokenPath string) (*tasks.Service, error) {
+	return tasks.NewService(ctx, option.WithHTTPClient(c.client(ctx, token, tokenPath)))
+}
+
+// CreateSheetsClient creates a Sheets API client acting as the user who
+// granted token, which must include ScopeSheets
+func (c *OAuthConfig) CreateSheetsClient(ctx context.Context, token *Token, tokenPath string) (*sheets.Service, error) {
+	if !token.HasScope(ScopeSheets) {
+		return nil, fmt.Errorf("%w: the cached login doesn't grant %s; run 'zap login' again", ErrInsufficientScope, ScopeSheets)
+	}
+	return sheets.NewService(ctx, option.WithHTTPClient(c.client(ctx, token, tokenPath)))
+}
+
+// CreateCalendarClient creates a read-only Calendar API client acting as
+// the user who granted token, which must include ScopeCalendarReadonly
+func (c *OAuthConfig) CreateCalendarClient(ctx context.Context, token *Token, tokenPath string) (*calendar.Service, error) {
+	if !token.HasScope(ScopeCalendarReadonly) {
+		return nil, fmt.Errorf("%w: the cached login doesn't grant %s; run 'zap login' again", ErrInsufficientScope, ScopeCalendarReadonly)
+	}
+	return calendar.NewService(ctx, option.WithHTTPClient(c.client(ctx, token, tokenPath)))
+}
+
+// CreateGmailClient creates a read-only Gmail API client acting as the
+// user who granted token, which must include ScopeGmailReadonly
+func (c *OAuthConfig) CreateGmailClient(ctx context.Context, token *Token, tokenPath string) (*gmail.Service, error) {
+	if !token.HasScope(ScopeGmailReadonly) {
+		return nil, fmt.Errorf("%w: the cached login doesn't grant %s; run 'zap login' again", ErrInsufficientScope, ScopeGmailReadonly)
+	}
+	return gmail.NewService(ctx, option.WithHTTPClient(c.client(ctx, token, tokenPath)))
+}
+
+// client sends requests as the user who granted token, through the HTTP
+// client ctx carries for oauth2 if any
+func (c *OAuthConfig) client(ctx context.Context, token *Token, tokenPath string) *http.Client {
+	return oauth2.NewClient(ctx, c.tokenSource(ctx, token, tokenPath))
+}
+
+// tokenSource refreshes token as needed, writing refreshed access tokens
+// back to tokenPath
+func (c *OAuthConfig) tokenSource(ctx context.Context, token *Token, tokenPath string) oauth2.TokenSource {
+	source := &savingTokenSource{
+		base:   c.config.TokenSource(ctx, token.Token),
+		path:   tokenPath,
+		scopes: token.Scopes,
+		last:   token.AccessToken,
+	}
+	return oauth2.ReuseTokenSource(token.Token, source)
+}
+
+// Token is a cached OAuth token together with the scopes that were granted
+type Token struct {
+	*oauth2.Token
+	Scopes []string `json:"scopes"`
+}
+
+// newToken records the granted scopes, preferring what the server reports
+func newToken(token *oauth2.Token, requested []string) *Token {
+	scopes := requested
+	if granted, ok := token.Extra("scope").(string); ok && granted != "" {
+		scopes = strings.Fields(granted)
+	}
+	return &Token{Token: token, Scopes: scopes}
+}
+
+// ReadOnly reports whether the token lacks the read/write Tasks scope
+func (t *Token) ReadOnly() bool {
+	return !t.HasScope(ScopeTasks)
+}
+
+// HasScope reports whether scope was granted
+func (t *Token) HasScope(scope string) bool {
+	for _, granted := range t.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadToken reads a token cached by SaveToken
+func LoadToken(path string) (*Token, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("no cached token at %s; run 'zap login' first", path)
+		}
+		return nil, fmt.Errorf("unable to read token: %v", err)
+	}
+	var token Token
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, fmt.Errorf("unable to parse token %s: %v", path, err)
+	}
+	if token.Token == nil {
+		return nil, fmt.Errorf("token %s is empty; run 'zap login' again", path)
+	}
+	return &token, nil
+}
+
+// SaveToken writes a token readable only by the current user
+func SaveToken(path string, token *Token) error {
+	data, err := json.MarshalIndent(token, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode token: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("unable to create token directory: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("unable to write token: %v", err)
+	}
+	return nil
+}
+
+// savingTokenSource persists refreshed tokens so the next run can reuse them
+type savingTokenSource struct {
+	base   oauth2.TokenSource
+	path   string
+	scopes []string
+	last   string
+}
+
+func (s *savingTokenSource) Token() (*oauth2.Token, error) {
+	token, err := s.base.Token()
+	if err != nil {
+		return nil, err
+	}
+	if token.AccessToken != s.last {
+		s.last = token.AccessToken
+		if err := SaveToken(s.path, &Token{Token: token, Scopes: s.scopes}); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+	return token, nil
+}
+
+// callbackResult is delivered once by the callback handler
+type callbackResult struct {
+	code string
+	err  error
+}
+
+// callbackHandler validates the redirect from Google and hands over the code
+type callbackHandler struct {
+	state  string
+	result chan callbackResult
+}
+
+func newCallbackHandler(state string) *callbackHandler {
+	return &callbackHandler{state: state, result: make(chan callbackResult, 1)}
+}
+
+func (h *callbackHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	// Ignore stray requests (favicon, wrong state) rather than failing the login
+	if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(h.state)) != 1 {
+		w.WriteHeader(http.StatusBadRequest)
+		renderCallbackPage(w, false, "The login request didn't match. Close this tab and run 'zap login' again.")
+		return
+	}
+
+	var result callbackResult
+	switch {
+	case query.Get("error") != "":
+		result.err = fmt.Errorf("authorization denied: %s", query.Get("error"))
+	case query.Get("code") == "":
+		result.err = fmt.Errorf("authorization response did not include a code")
+	default:
+		result.code = query.Get("code")
+	}
+
+	if result.err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		renderCallbackPage(w, false, result.err.Error())
+	} else {
+		renderCallbackPage(w, true, "Zap! is now authorized. You can close this tab and return to the terminal.")
+	}
+
+	select {
+	case h.result <- result:
+	default:
+	}
+}
+
+var callbackPage = template.Must(template.New("callback").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Zap! login</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; background: #111827; color: #f9fafb; display: flex; align-items: center; justify-content: center; height: 100vh; margin: 0; }
+.card { background: #1f2937; padding: 2.5rem 3rem; border-radius: 12px; text-align: center; max-width: 28rem; }
+h1 { margin-top: 0; }
+.ok { color: #facc15; }
+.fail { color: #f87171; }
+</style>
+</head>
+<body>
+<div class="card">
+{{if .OK}}<h1 class="ok">⚡ Logged in</h1>{{else}}<h1 class="fail">Login failed</h1>{{end}}
+<p>{{.Message}}</p>
+</div>
+</body>
+</html>
+`))
+
+func renderCallbackPage(w http.ResponseWriter, ok bool, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	callbackPage.Execute(w, struct {
+		OK      bool
+		Message string
+	}{ok, message})
+}
+
+// randomState returns an unguessable value for the OAuth state parameter
+func randomState() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("unable to generate state: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// openBrowser opens url with the platform's default handler
+func openBrowser(url string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", url).Start()
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", url).Start()
+	default:
+		return exec.Command("xdg-open", url).Start()
+	}
+}
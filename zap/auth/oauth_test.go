@@ -0,0 +1,30 @@
+package auth
+
+import "testing"
+
+func TestPastedCode(t *testing.T) {
+	tests := []struct {
+		name    string
+		pasted  string
+		want    string
+		wantErr bool
+	}{
+		{"redirected URL", "http://127.0.0.1:8085/callback?state=s1&code=4/abc&scope=x\n", "4/abc", false},
+		{"bare code", "  4/abc \n", "4/abc", false},
+		{"other login", "http://127.0.0.1:8085/callback?state=s2&code=4/abc", "", true},
+		{"denied", "http://127.0.0.1:8085/callback?state=s1&error=access_denied", "", true},
+		{"no code", "http://127.0.0.1:8085/callback?state=s1&code=", "", true},
+		{"empty", "\n", "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code, err := pastedCode(test.pasted, "s1")
+			if (err != nil) != test.wantErr {
+				t.Fatalf("pastedCode(%q) error = %v, want error %v", test.pasted, err, test.wantErr)
+			}
+			if code != test.want {
+				t.Errorf("pastedCode(%q) = %q, want %q", test.pasted, code, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,639 @@
+// Package asana serves Asana tasks to zap. Each section of the configured
+// projects is a task list titled "Project / Section", and the user's My
+// Tasks is one more; subtasks are Asana's own. Sections keep the order zap
+// gives them, and ranks are written to tasks that have a number custom
+// field named like the priority field. My Tasks can't be reordered through
+// the API, so it is ordered by that field.
+package asana
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"zap/backend"
+	"zap/todo"
+)
+
+// apiURL is Asana's REST API
+const apiURL = "https://app.asana.com/api/1.0"
+
+// myTasksTitle is the title of the My Tasks list
+const myTasksTitle = "My Tasks"
+
+// taskFields are the task fields zap reads
+const taskFields = "name,notes,due_on,due_at,completed,completed_at,modified_at,num_subtasks,parent.gid," +
+	"custom_fields.gid,custom_fields.name,custom_fields.resource_subtype,custom_fields.number_value"
+
+// Provider talks to Asana with a personal access token
+type Provider struct {
+	client        *http.Client
+	token         string
+	workspace     string
+	projects      []string
+	myTasks       bool
+	priorityField string
+
+	mu       sync.Mutex
+	resolved *resolved
+}
+
+// resolved holds the IDs behind the configured names, found once
+type resolved struct {
+	workspace string
+	projects  []ref
+	myTasks   string
+}
+
+// New creates a provider for the sections of projects, given by name or
+// ID, and My Tasks when myTasks is set. An empty workspace is the user's
+// only one.
+func New(token, workspace string, projects []string, myTasks bool, priorityField string) *Provider {
+	return &Provider{
+		client:        http.DefaultClient,
+		token:         token,
+		workspace:     workspace,
+		projects:      projects,
+		myTasks:       myTasks,
+		priorityField: priorityField,
+	}
+}
+
+// Name identifies the provider
+func (p *Provider) Name() string {
+	return "asana"
+}
+
+type ref struct {
+	GID  string `json:"gid"`
+	Name string `json:"name"`
+}
+
+type task struct {
+	GID          string        `json:"gid"`
+	Name         string        `json:"name"`
+	Notes        string        `json:"notes"`
+	DueOn        *string       `json:"due_on"`
+	DueAt        *string       `json:"due_at"`
+	Completed    bool          `json:"completed"`
+	CompletedAt  *string       `json:"completed_at"`
+	ModifiedAt   string        `json:"modified_at"`
+	NumSubtasks  int           `json:"num_subtasks"`
+	Parent       *ref          `json:"parent"`
+	CustomFields []customField `json:"custom_fields"`
+}
+
+type customField struct {
+	GID             string   `json:"gid"`
+	Name            string   `json:"name"`
+	ResourceSubtype string   `json:"resource_subtype"`
+	NumberValue     *float64 `json:"number_value"`
+}
+
+// call sends a request to the API, wrapping body in and unwrapping out from
+// the data envelope Asana uses
+func (p *Provider) call(ctx context.Context, method, path string, params url.Values, body, out interface{}) error {
+	target := apiURL + path
+	if len(params) > 0 {
+		target += "?" + params.Encode()
+	}
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+p.token)
+	var request interface{}
+	if body != nil {
+		request = map[string]interface{}{"data": body}
+	}
+	var envelope struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := backend.Call(ctx, p.client, method, target, header, request, &envelope); err != nil {
+		return err
+	}
+	if out == nil || len(envelope.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(envelope.Data, out)
+}
+
+// getAll reads every page of a collection into out
+func (p *Provider) getAll(ctx context.Context, path string, params url.Values, out interface{}) error {
+	params.Set("limit", "100")
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+p.token)
+	var items []json.RawMessage
+	for {
+		var page struct {
+			Data     []json.RawMessage `json:"data"`
+			NextPage *struct {
+				Offset string `json:"offset"`
+			} `json:"next_page"`
+		}
+		if err := backend.Call(ctx, p.client, http.MethodGet, apiURL+path+"?"+params.Encode(), header, nil, &page); err != nil {
+			return err
+		}
+		items = append(items, page.Data...)
+		if page.NextPage == nil || page.NextPage.Offset == "" {
+			break
+		}
+		params.Set("offset", page.NextPage.Offset)
+	}
+	encoded, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encoded, out)
+}
+
+// resolve finds the workspace, projects and My Tasks once
+func (p *Provider) resolve(ctx context.Context) (*resolved, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.resolved != nil {
+		return p.resolved, nil
+	}
+
+	var workspaces []ref
+	if err := p.getAll(ctx, "/workspaces", url.Values{}, &workspaces); err != nil {
+		return nil, err
+	}
+	r := &resolved{}
+	for _, workspace := range workspaces {
+		if workspace.GID == p.workspace || workspace.Name == p.workspace || (p.workspace == "" && len(workspaces) == 1) {
+			r.workspace = workspace.GID
+		}
+	}
+	if r.workspace == "" {
+		if p.workspace == "" {
+			return nil, fmt.Errorf("the account has %d workspaces; set asana.workspace", len(workspaces))
+		}
+		return nil, fmt.Errorf("workspace %s %w", p.workspace, backend.ErrNotFound)
+	}
+
+	if len(p.projects) > 0 {
+		var projects []ref
+		if err := p.getAll(ctx, "/projects", url.Values{"workspace": {r.workspace}, "archived": {"false"}}, &projects); err != nil {
+			return nil, err
+		}
+	configured:
+		for _, name := range p.projects {
+			for _, project := range projects {
+				if project.GID == name || project.Name == name {
+					r.projects = append(r.projects, project)
+					continue configured
+				}
+			}
+			return nil, fmt.Errorf("project %s %w", name, backend.ErrNotFound)
+		}
+	}
+
+	if p.myTasks {
+		var list ref
+		if err := p.call(ctx, http.MethodGet, "/users/me/user_task_list", url.Values{"workspace": {r.workspace}}, nil, &list); err != nil {
+			return nil, err
+		}
+		r.myTasks = list.GID
+	}
+	p.resolved = r
+	return r, nil
+}
+
+// List IDs name what the list is: "section.<project>.<section>" or
+// "mytasks.<user task list>"
+func sectionListID(project, section string) string {
+	return "section." + project + "." + section
+}
+
+func myTasksListID(list string) string {
+	return "mytasks." + list
+}
+
+// location is a list ID taken apart
+type location struct {
+	project string
+	section string
+	myTasks string
+}
+
+func parseListID(listID string) (location, error) {
+	parts := strings.Split(listID, ".")
+	switch {
+	case len(parts) == 3 && parts[0] == "section":
+		return location{project: parts[1], section: parts[2]}, nil
+	case len(parts) == 2 && parts[0] == "mytasks":
+		return location{myTasks: parts[1]}, nil
+	}
+	return location{}, fmt.Errorf("task list %s %w", listID, backend.ErrNotFound)
+}
+
+// Lists returns My Tasks, if configured, and each project's sections
+func (p *Provider) Lists(ctx context.Context) ([]*todo.TaskList, error) {
+	r, err := p.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var lists []*todo.TaskList
+	if r.myTasks != "" {
+		lists = append(lists, &todo.TaskList{ID: myTasksListID(r.myTasks), Title: myTasksTitle})
+	}
+	for _, project := range r.projects {
+		var sections []ref
+		if err := p.getAll(ctx, "/projects/"+project.GID+"/sections", url.Values{}, &sections); err != nil {
+			return nil, err
+		}
+		for _, section := range sections {
+			lists = append(lists, sectionList(project, section))
+		}
+	}
+	return lists, nil
+}
+
+func sectionList(project, section ref) *todo.TaskList {
+	return &todo.TaskList{
+		ID:    sectionListID(project.GID, section.GID),
+		Title: project.Name + " / " + section.Name,
+	}
+}
+
+// CreateList adds a section to the first project. A title of the form
+// "Project / Section" names the project to add it to instead.
+func (p *Provider) CreateList(ctx context.Context, title string) (*todo.TaskList, error) {
+	r, err := p.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.projects) == 0 {
+		return nil, fmt.Errorf("creating lists without projects is %w", backend.ErrUnsupported)
+	}
+	project, name := r.projects[0], title
+	if before, after, ok := strings.Cut(title, " / "); ok {
+		for _, candidate := range r.projects {
+			if candidate.Name == before {
+				project, name = candidate, after
+			}
+		}
+	}
+	var section ref
+	if err := p.call(ctx, http.MethodPost, "/projects/"+project.GID+"/sections", nil, map[string]interface{}{"name": name}, &section); err != nil {
+		return nil, err
+	}
+	return sectionList(project, section), nil
+}
+
+// topLevel returns a list's tasks in order, without their subtasks
+func (p *Provider) topLevel(ctx context.Context, loc location) ([]task, error) {
+	var listTasks []task
+	params := url.Values{"opt_fields": {taskFields}}
+	if loc.myTasks != "" {
+		if err := p.getAll(ctx, "/user_task_lists/"+loc.myTasks+"/tasks", params, &listTasks); err != nil {
+			return nil, err
+		}
+		sort.SliceStable(listTasks, func(i, j int) bool {
+			a, b := p.priority(listTasks[i]), p.priority(listTasks[j])
+			return a != nil && (b == nil || *a.NumberValue < *b.NumberValue)
+		})
+		return listTasks, nil
+	}
+	if err := p.getAll(ctx, "/sections/"+loc.section+"/tasks", params, &listTasks); err != nil {
+		return nil, err
+	}
+	return listTasks, nil
+}
+
+// priority returns the task's priority field when it has one with a value
+func (p *Provider) priority(t task) *customField {
+	field := p.priorityFieldOf(t)
+	if field == nil || field.NumberValue == nil {
+		return nil
+	}
+	return field
+}
+
+// priorityFieldOf returns the task's priority field, if it is a number field
+func (p *Provider) priorityFieldOf(t task) *customField {
+	for i, field := range t.CustomFields {
+		if strings.EqualFold(field.Name, p.priorityField) && field.ResourceSubtype == "number" {
+			return &t.CustomFields[i]
+		}
+	}
+	return nil
+}
+
+// subtasks returns a task's subtasks in order
+func (p *Provider) subtasks(ctx context.Context, parent string) ([]task, error) {
+	var subtasks []task
+	if err := p.getAll(ctx, "/tasks/"+parent+"/subtasks", url.Values{"opt_fields": {taskFields}}, &subtasks); err != nil {
+		return nil, err
+	}
+	return subtasks, nil
+}
+
+// Tasks returns the list's tasks, each followed by its subtasks
+func (p *Provider) Tasks(ctx context.Context, listID string) ([]*todo.Task, error) {
+	loc, err := parseListID(listID)
+	if err != nil {
+		return nil, err
+	}
+	top, err := p.topLevel(ctx, loc)
+	if err != nil {
+		return nil, err
+	}
+	var listTasks []*todo.Task
+	for i, t := range top {
+		t.Parent = nil
+		listTasks = append(listTasks, convert(t, i))
+		if t.NumSubtasks == 0 {
+			continue
+		}
+		subtasks, err := p.subtasks(ctx, t.GID)
+		if err != nil {
+			return nil, err
+		}
+		for j, subtask := range subtasks {
+			subtask.Parent = &ref{GID: t.GID}
+			listTasks = append(listTasks, convert(subtask, j))
+		}
+	}
+	return listTasks, nil
+}
+
+// convert turns an Asana task at index among its siblings into a task.
+// Due times are dropped, since the Tasks API only has due dates.
+func convert(t task, index int) *todo.Task {
+	converted := &todo.Task{
+		ID:       t.GID,
+		Title:    t.Name,
+		Notes:    t.Notes,
+		Status:   "needsAction",
+		Position: fmt.Sprintf("%020d", index),
+		Updated:  t.ModifiedAt,
+		Due:      dueDate(t),
+	}
+	if t.Parent != nil {
+		converted.Parent = t.Parent.GID
+	}
+	if t.Completed {
+		converted.Status = "completed"
+		if t.CompletedAt != nil {
+			converted.Completed = *t.CompletedAt
+		}
+	}
+	return converted
+}
+
+// dueDate returns a task's due date in the Tasks API's format
+func dueDate(t task) string {
+	switch {
+	case t.DueOn != nil:
+		return *t.DueOn + "T00:00:00.000Z"
+	case t.DueAt != nil:
+		if at, err := time.Parse(time.RFC3339, *t.DueAt); err == nil {
+			return at.Format("2006-01-02") + "T00:00:00.000Z"
+		}
+	}
+	return ""
+}
+
+// get reads one task
+func (p *Provider) get(ctx context.Context, taskID string) (task, error) {
+	var t task
+	err := p.call(ctx, http.MethodGet, "/tasks/"+taskID, url.Values{"opt_fields": {taskFields}}, nil, &t)
+	return t, err
+}
+
+// Insert creates a task, as a subtask when parent is set
+func (p *Provider) Insert(ctx context.Context, listID, parent, previous string, t *todo.Task) (*todo.Task, error) {
+	loc, err := parseListID(listID)
+	if err != nil {
+		return nil, err
+	}
+	data := map[string]interface{}{
+		"name":      t.Title,
+		"notes":     t.Notes,
+		"completed": t.Status == "completed",
+	}
+	if t.Due != "" {
+		data["due_on"] = date(t.Due)
+	}
+
+	var created task
+	if parent != "" {
+		if err := p.call(ctx, http.MethodPost, "/tasks/"+parent+"/subtasks", nil, data, &created); err != nil {
+			return nil, err
+		}
+		if err := p.setParent(ctx, created.GID, parent, previous); err != nil {
+			return nil, err
+		}
+	} else {
+		if loc.myTasks != "" {
+			r, err := p.resolve(ctx)
+			if err != nil {
+				return nil, err
+			}
+			data["assignee"] = "me"
+			data["workspace"] = r.workspace
+		} else {
+			data["memberships"] = []map[string]string{{"project": loc.project, "section": loc.section}}
+		}
+		if err := p.call(ctx, http.MethodPost, "/tasks", nil, data, &created); err != nil {
+			return nil, err
+		}
+		if loc.section != "" {
+			if err := p.place(ctx, loc, created.GID, previous); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return p.read(ctx, created.GID, parent)
+}
+
+// read returns a task as written
+func (p *Provider) read(ctx context.Context, taskID, parent string) (*todo.Task, error) {
+	t, err := p.get(ctx, taskID)
+	if err != nil {
+		return nil, err
+	}
+	t.Parent = nil
+	if parent != "" {
+		t.Parent = &ref{GID: parent}
+	}
+	return convert(t, 0), nil
+}
+
+// date returns the date part of a Tasks API due date
+func date(due string) string {
+	if len(due) >= len("2006-01-02") {
+		return due[:len("2006-01-02")]
+	}
+	return due
+}
+
+// setParent puts a task under parent after previous, or first without
+// previous
+func (p *Provider) setParent(ctx context.Context, taskID, parent, previous string) error {
+	data := map[string]interface{}{"parent": parent}
+	if previous != "" {
+		data["insert_after"] = previous
+	} else {
+		subtasks, err := p.subtasks(ctx, parent)
+		if err != nil {
+			return err
+		}
+		for _, subtask := range subtasks {
+			if subtask.GID != taskID {
+				data["insert_before"] = subtask.GID
+				break
+			}
+		}
+	}
+	return p.call(ctx, http.MethodPost, "/tasks/"+taskID+"/setParent", nil, data, nil)
+}
+
+// place puts a top-level task after previous in a section, or first
+// without previous
+func (p *Provider) place(ctx context.Context, loc location, taskID, previous string) error {
+	listTasks, err := p.topLevel(ctx, loc)
+	if err != nil {
+		return err
+	}
+	data := map[string]interface{}{"project": loc.project, "section": loc.section}
+	if previous != "" {
+		data["insert_after"] = previous
+	} else {
+		for _, t := range listTasks {
+			if t.GID != taskID {
+				data["insert_before"] = t.GID
+				break
+			}
+		}
+	}
+	return p.call(ctx, http.MethodPost, "/tasks/"+taskID+"/addProject", nil, data, nil)
+}
+
+// Capabilities reports that sections keep their order and My Tasks
+// doesn't, and that ranks can go to the priority field, when there is one,
+// in both
+func (p *Provider) Capabilities(listID string) backend.Capabilities {
+	caps := backend.Capabilities{Subtasks: true, PriorityField: p.priorityField != ""}
+	if loc, err := parseListID(listID); err == nil && loc.section != "" {
+		caps.Ordering = true
+	}
+	return caps
+}
+
+// Priorities returns the priority field of the list's tasks that have it
+func (p *Provider) Priorities(ctx context.Context, listID string) (map[string]string, error) {
+	loc, err := parseListID(listID)
+	if err != nil {
+		return nil, err
+	}
+	listTasks, err := p.topLevel(ctx, loc)
+	if err != nil {
+		return nil, err
+	}
+	priorities := make(map[string]string)
+	for _, t := range listTasks {
+		field := p.priorityFieldOf(t)
+		if field == nil {
+			continue
+		}
+		priorities[t.GID] = ""
+		if field.NumberValue != nil {
+			priorities[t.GID] = strconv.FormatFloat(*field.NumberValue, 'f', -1, 64)
+		}
+	}
+	return priorities, nil
+}
+
+// SetPriority writes a rank to the task's priority field
+func (p *Provider) SetPriority(ctx context.Context, listID, taskID, priority string) error {
+	rank, err := strconv.ParseFloat(priority, 64)
+	if err != nil {
+		return fmt.Errorf("priority %q is not a number", priority)
+	}
+	t, err := p.get(ctx, taskID)
+	if err != nil {
+		return err
+	}
+	field := p.priorityFieldOf(t)
+	if field == nil {
+		return fmt.Errorf("tasks without a %s number field are %w", p.priorityField, backend.ErrUnsupported)
+	}
+	data := map[string]interface{}{"custom_fields": map[string]float64{field.GID: rank}}
+	return p.call(ctx, http.MethodPut, "/tasks/"+taskID, nil, data, nil)
+}
+
+// Update writes a task's name, notes, completion and due date. A due date
+// is only written when its date changed, so due times are kept.
+func (p *Provider) Update(ctx context.Context, listID string, t *todo.Task) (*todo.Task, error) {
+	current, err := p.get(ctx, t.ID)
+	if err != nil {
+		return nil, err
+	}
+	data := map[string]interface{}{
+		"name":      t.Title,
+		"notes":     t.Notes,
+		"completed": t.Status == "completed",
+	}
+	switch {
+	case date(t.Due) == date(dueDate(current)):
+	case t.Due == "":
+		data["due_on"] = nil
+		data["due_at"] = nil
+	default:
+		data["due_on"] = date(t.Due)
+	}
+	var updated task
+	if err := p.call(ctx, http.MethodPut, "/tasks/"+t.ID, url.Values{"opt_fields": {taskFields}}, data, &updated); err != nil {
+		return nil, err
+	}
+	updated.Parent = nil
+	if t.Parent != "" {
+		updated.Parent = &ref{GID: t.Parent}
+	}
+	return convert(updated, 0), nil
+}
+
+// Move puts a task under parent after previous, or after previous in the
+// destination section; tasks moved into My Tasks are assigned to the user
+func (p *Provider) Move(ctx context.Context, listID, taskID, parent, previous, destination string) (*todo.Task, error) {
+	if parent != "" {
+		if err := p.setParent(ctx, taskID, parent, previous); err != nil {
+			return nil, err
+		}
+		return p.read(ctx, taskID, parent)
+	}
+
+	target := listID
+	if destination != "" {
+		target = destination
+	}
+	loc, err := parseListID(target)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case loc.section != "":
+		if err := p.place(ctx, loc, taskID, previous); err != nil {
+			return nil, err
+		}
+	case target == listID:
+		return nil, fmt.Errorf("ordering My Tasks is %w", backend.ErrUnsupported)
+	default:
+		if err := p.call(ctx, http.MethodPut, "/tasks/"+taskID, nil, map[string]interface{}{"assignee": "me"}, nil); err != nil {
+			return nil, err
+		}
+	}
+	return p.read(ctx, taskID, "")
+}
+
+// Delete deletes a task
+func (p *Provider) Delete(ctx context.Context, listID, taskID string) error {
+	return p.call(ctx, http.MethodDelete, "/tasks/"+taskID, nil, nil, nil)
+}
@@ -0,0 +1,175 @@
+// Package backend lets zap work with task services other than Google
+// Tasks. zap's tasks service speaks the Google Tasks API, so each provider
+// is wrapped in a handler that answers the API calls it makes by
+// translating them into the provider's own, in process; the rest of zap
+// can't tell the difference.
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+
+	"zap/todo"
+
+	"google.golang.org/api/option"
+	tasksapi "google.golang.org/api/tasks/v1"
+)
+
+// ErrNotFound is returned by providers for lists and tasks that don't exist
+var ErrNotFound = errors.New("not found")
+
+// ErrUnsupported is returned by providers for calls their service has no
+// equivalent of
+var ErrUnsupported = errors.New("not supported by this backend")
+
+// Provider is a task service zap can work with. Providers convert their
+// service's lists and tasks to zap's own: tasks carry their Parent and a
+// Position that orders them among their siblings, and IDs are safe to use
+// in a URL path.
+// Providers are called concurrently.
+type Provider interface {
+	// Name identifies the provider in messages, e.g. "trello"
+	Name() string
+	Lists(ctx context.Context) ([]*todo.TaskList, error)
+	CreateList(ctx context.Context, title string) (*todo.TaskList, error)
+	// Tasks returns every task of a list, completed ones included
+	Tasks(ctx context.Context, listID string) ([]*todo.Task, error)
+	// Insert creates task under parent after previous, either of which may
+	// be empty; without previous it goes first
+	Insert(ctx context.Context, listID, parent, previous string, task *todo.Task) (*todo.Task, error)
+	// Update writes task's title, notes, due date and status
+	Update(ctx context.Context, listID string, task *todo.Task) (*todo.Task, error)
+	// Move puts a task under parent after previous, into destination when
+	// it is set and differs from listID
+	Move(ctx context.Context, listID, taskID, parent, previous, destination string) (*todo.Task, error)
+	Delete(ctx context.Context, listID, taskID string) error
+}
+
+// Capabilities are what a backend's list can record of a ranking, which
+// decides how zap writes one: by moving tasks into order, or by writing
+// each task's rank to a priority field or as a priority label
+type Capabilities struct {
+	// Ordering lists keep tasks in the order they are moved into
+	Ordering bool
+	// Subtasks can be created and ordered under tasks
+	Subtasks bool
+	// PriorityField tasks have a field their rank can be written to
+	PriorityField bool
+	// Labels tasks can carry a priority label, P1 to P4
+	Labels bool
+}
+
+// GoogleTasks is what Google Tasks lists can do
+var GoogleTasks = Capabilities{Ordering: true, Subtasks: true}
+
+// Capable is implemented by providers whose lists can do other things than
+// Google Tasks lists
+type Capable interface {
+	Capabilities(listID string) Capabilities
+}
+
+// CapabilitiesOf returns what a provider's list can do. A nil provider is
+// Google Tasks itself.
+func CapabilitiesOf(provider Provider, listID string) Capabilities {
+	if capable, ok := provider.(Capable); ok {
+		return capable.Capabilities(listID)
+	}
+	return GoogleTasks
+}
+
+// Ranker is implemented by providers with lists that record ranks in a
+// priority field or label. Priorities are the rank, e.g. "3", for fields
+// and the label, e.g. "P2", for labels.
+type Ranker interface {
+	// Priorities returns the priority of each task of a list that can have
+	// one, empty when it has none yet
+	Priorities(ctx context.Context, listID string) (map[string]string, error)
+	// SetPriority writes a task's priority, replacing the one it had
+	SetPriority(ctx context.Context, listID, taskID, priority string) error
+}
+
+// Error is a failed request to a provider's API with the status it
+// answered, which is passed on to zap so that e.g. rejected credentials
+// are reported as such
+type Error struct {
+	Code    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d: %s", e.Code, e.Message)
+}
+
+// Service returns a Tasks API client that is served by provider
+func Service(ctx context.Context, provider Provider) (*tasksapi.Service, error) {
+	client := &http.Client{Transport: transport{handler: NewHandler(provider)}}
+	return tasksapi.NewService(ctx, option.WithHTTPClient(client))
+}
+
+// transport answers requests with a handler instead of sending them
+type transport struct {
+	handler http.Handler
+}
+
+func (t transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	recorder := httptest.NewRecorder()
+	t.handler.ServeHTTP(recorder, r)
+	response := recorder.Result()
+	response.Request = r
+	return response, nil
+}
+
+// Call sends a request to a provider's JSON API and decodes the answer
+// into out, which may be nil. Bodies are sent as JSON; answers outside 2xx
+// are returned as *Error.
+func Call(ctx context.Context, client *http.Client, method, url string, header http.Header, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message := string(bytes.TrimSpace(data))
+		if message == "" {
+			message = http.StatusText(resp.StatusCode)
+		}
+		return &Error{Code: resp.StatusCode, Message: message}
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("unable to decode answer to %s %s: %v", method, url, err)
+	}
+	return nil
+}
@@ -0,0 +1,626 @@
+// Package files serves local Markdown and todo.txt files to zap, so it can
+// run without any online service. Each .md or .txt file under the
+// configured path is a task list titled by its path without the extension.
+// Files are edited line by line: only the lines of the tasks zap changes
+// are rewritten, and everything else in them is kept as it is.
+package files
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"zap/backend"
+	"zap/todo"
+)
+
+// Provider works on the files under one path, or that one file
+type Provider struct {
+	path string
+
+	mu sync.Mutex
+	// ids keeps the IDs of tasks zap rewrote, so they don't change with
+	// their lines; other IDs are derived from the lines themselves
+	ids map[string]string
+}
+
+// New creates a provider for a file or directory
+func New(path string) *Provider {
+	return &Provider{path: path, ids: make(map[string]string)}
+}
+
+// Name identifies the provider
+func (p *Provider) Name() string {
+	return "files"
+}
+
+// entry is a task in a file and the lines it occupies
+type entry struct {
+	id  string
+	key string
+	// start is the task's line; its fields are written in the lines up to
+	// head, and the lines up to end move with it
+	start, head, end int
+	indent           string
+	parent           *entry
+	children         []*entry
+
+	title string
+	notes string
+	// due and completed are dates, 2006-01-02
+	due       string
+	completed string
+	done      bool
+
+	// Markdown: the list marker
+	bullet string
+	// todo.txt: priority, creation date, other key:value tags, the id: tag
+	// subtasks refer to and the id they refer to
+	priority  string
+	created   string
+	tags      []string
+	ref       string
+	parentRef string
+}
+
+// format reads and writes the tasks of one kind of file
+type format interface {
+	// parse returns the top-level tasks of a file, with their subtasks
+	parse(lines []string) []*entry
+	// render returns the lines e's fields are written in
+	render(e *entry) []string
+	// relocate returns e's lines, which move with it, fitted for its new
+	// parent
+	relocate(lines []string, e *entry, parent *entry) []string
+	// adopt readies parent to have subtasks among entries, reporting
+	// whether its lines need to be rewritten for it
+	adopt(parent *entry, entries []*entry) bool
+	// subtask returns a new entry for a subtask of parent
+	subtask(parent *entry) *entry
+	// top returns a new entry for a top-level task next to siblings
+	top(siblings []*entry) *entry
+}
+
+// formatOf returns the format of a file by its extension
+func formatOf(path string) format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".md", ".markdown":
+		return markdown{}
+	case ".txt":
+		return todoTxt{}
+	}
+	return nil
+}
+
+// doc is a file as read
+type doc struct {
+	path     string
+	listID   string
+	format   format
+	lines    []string
+	entries  []*entry
+	modified time.Time
+}
+
+// all returns the entries in list order, each followed by its subtasks
+func (d *doc) all() []*entry {
+	var all []*entry
+	for _, e := range d.entries {
+		all = append(all, e)
+		all = append(all, e.children...)
+	}
+	return all
+}
+
+func (d *doc) find(id string) *entry {
+	for _, e := range d.all() {
+		if e.id == id {
+			return e
+		}
+	}
+	return nil
+}
+
+// files returns the task files under the path, relative to it
+func (p *Provider) files() ([]string, error) {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{filepath.Base(p.path)}, nil
+	}
+	var names []string
+	err = filepath.WalkDir(p.path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && path != p.path && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() && formatOf(path) != nil {
+			rel, err := filepath.Rel(p.path, path)
+			if err != nil {
+				return err
+			}
+			names = append(names, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	return names, err
+}
+
+// root is the directory list files are relative to
+func (p *Provider) root() string {
+	if info, err := os.Stat(p.path); err == nil && !info.IsDir() {
+		return filepath.Dir(p.path)
+	}
+	return p.path
+}
+
+// List IDs are the file's path, encoded to be safe in a URL path
+func fileListID(name string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(name))
+}
+
+func taskList(name string) *todo.TaskList {
+	return &todo.TaskList{
+		ID:    fileListID(name),
+		Title: strings.TrimSuffix(name, filepath.Ext(name)),
+	}
+}
+
+// Lists returns a list per task file
+func (p *Provider) Lists(ctx context.Context) ([]*todo.TaskList, error) {
+	names, err := p.files()
+	if err != nil {
+		return nil, err
+	}
+	lists := make([]*todo.TaskList, len(names))
+	for i, name := range names {
+		lists[i] = taskList(name)
+	}
+	return lists, nil
+}
+
+// CreateList creates an empty Markdown file in the directory
+func (p *Provider) CreateList(ctx context.Context, title string) (*todo.TaskList, error) {
+	if info, err := os.Stat(p.path); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("creating lists next to a single file is %w", backend.ErrUnsupported)
+	}
+	name := filepath.ToSlash(filepath.Clean(title)) + ".md"
+	if strings.HasPrefix(name, "../") || filepath.IsAbs(title) {
+		return nil, fmt.Errorf("list title %s leaves the directory", title)
+	}
+	path := filepath.Join(p.path, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+	return taskList(name), nil
+}
+
+// read loads and parses a list's file
+func (p *Provider) read(listID string) (*doc, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(listID)
+	if err != nil {
+		return nil, fmt.Errorf("task list %s %w", listID, backend.ErrNotFound)
+	}
+	name := string(decoded)
+	f := formatOf(name)
+	path := filepath.Join(p.root(), filepath.FromSlash(name))
+	if f == nil || strings.HasPrefix(filepath.ToSlash(filepath.Clean(name)), "../") {
+		return nil, fmt.Errorf("task list %s %w", listID, backend.ErrNotFound)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("task list %s %w", name, backend.ErrNotFound)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	if text == "" {
+		lines = nil
+	}
+	d := &doc{path: path, listID: listID, format: f, lines: lines, modified: info.ModTime()}
+	d.entries = f.parse(lines)
+	p.identify(d)
+	return d, nil
+}
+
+// identify gives each entry an ID: the one zap kept for its line, or one
+// derived from the file and the line
+func (p *Provider) identify(d *doc) {
+	for _, e := range d.all() {
+		e.key = lineKey(d.listID, d.lines, e.start)
+		if id, ok := p.ids[e.key]; ok {
+			e.id = id
+			continue
+		}
+		hash := sha256.Sum256([]byte(e.key))
+		e.id = hex.EncodeToString(hash[:8])
+	}
+}
+
+// lineKey identifies a line of a list's file by its text, telling
+// identical lines apart by how many come before it
+func lineKey(listID string, lines []string, line int) string {
+	text := strings.TrimSpace(lines[line])
+	seen := 0
+	for _, other := range lines[:line] {
+		if strings.TrimSpace(other) == text {
+			seen++
+		}
+	}
+	return fmt.Sprintf("%s\x00%s\x00%d", listID, text, seen)
+}
+
+// write saves lines to the doc's file atomically, keeping the IDs of the
+// entries rewritten in it by the line they now start at
+func (p *Provider) write(d *doc, lines []string, keep map[int]string) (*doc, error) {
+	data := strings.Join(lines, "\n")
+	if len(lines) > 0 {
+		data += "\n"
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(d.path), filepath.Base(d.path)+".*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("unable to write %s: %v", d.path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(data); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("unable to write %s: %v", d.path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("unable to write %s: %v", d.path, err)
+	}
+	if info, err := os.Stat(d.path); err == nil {
+		os.Chmod(tmp.Name(), info.Mode())
+	}
+	if err := os.Rename(tmp.Name(), d.path); err != nil {
+		return nil, fmt.Errorf("unable to write %s: %v", d.path, err)
+	}
+
+	written := &doc{path: d.path, listID: d.listID, format: d.format, lines: lines, modified: time.Now()}
+	written.entries = d.format.parse(lines)
+	for line, id := range keep {
+		if line < len(lines) {
+			p.ids[lineKey(d.listID, lines, line)] = id
+		}
+	}
+	p.identify(written)
+	return written, nil
+}
+
+// Tasks returns the tasks of a list's file
+func (p *Provider) Tasks(ctx context.Context, listID string) ([]*todo.Task, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	d, err := p.read(listID)
+	if err != nil {
+		return nil, err
+	}
+	var listTasks []*todo.Task
+	for i, e := range d.entries {
+		listTasks = append(listTasks, d.task(e, i))
+		for j, child := range e.children {
+			listTasks = append(listTasks, d.task(child, j))
+		}
+	}
+	return listTasks, nil
+}
+
+// task converts an entry at index among its siblings. Files don't record
+// when tasks changed, so that is when the file did.
+func (d *doc) task(e *entry, index int) *todo.Task {
+	updated := d.modified.UTC().Format(time.RFC3339)
+	task := &todo.Task{
+		ID:       e.id,
+		Title:    e.title,
+		Notes:    e.notes,
+		Status:   "needsAction",
+		Position: fmt.Sprintf("%020d", index),
+		Updated:  updated,
+	}
+	if e.parent != nil {
+		task.Parent = e.parent.id
+	}
+	if e.due != "" {
+		task.Due = e.due + "T00:00:00.000Z"
+	}
+	if e.done {
+		task.Status = "completed"
+		completed := updated
+		if e.completed != "" {
+			completed = e.completed + "T00:00:00.000Z"
+		}
+		task.Completed = completed
+	}
+	return task
+}
+
+// fill sets an entry's fields from a task
+func fill(e *entry, task *todo.Task) {
+	e.title = strings.Join(strings.Fields(task.Title), " ")
+	e.notes = task.Notes
+	e.due = ""
+	if len(task.Due) >= len("2006-01-02") {
+		e.due = task.Due[:len("2006-01-02")]
+	}
+	done := task.Status == "completed"
+	if done && !e.done {
+		e.completed = time.Now().Format("2006-01-02")
+	}
+	if !done {
+		e.completed = ""
+	}
+	e.done = done
+}
+
+// lookup returns the entry with the ID, failing when it doesn't exist
+func (d *doc) lookup(id string) (*entry, error) {
+	if id == "" {
+		return nil, nil
+	}
+	e := d.find(id)
+	if e == nil {
+		return nil, fmt.Errorf("task %s %w", id, backend.ErrNotFound)
+	}
+	return e, nil
+}
+
+// Insert adds a task after previous under parent
+func (p *Provider) Insert(ctx context.Context, listID, parentID, previousID string, task *todo.Task) (*todo.Task, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	d, err := p.read(listID)
+	if err != nil {
+		return nil, err
+	}
+	parent, err := d.lookup(parentID)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := d.lookup(previousID)
+	if err != nil {
+		return nil, err
+	}
+	if parent != nil && parent.parent != nil {
+		return nil, fmt.Errorf("subtasks of subtasks are %w", backend.ErrUnsupported)
+	}
+
+	lines := d.lines
+	keep := make(map[int]string)
+	if parent != nil && d.format.adopt(parent, d.all()) {
+		lines = replace(lines, parent.start, parent.head, d.format.render(parent))
+		keep[parent.start] = parent.id
+	}
+	var e *entry
+	if parent != nil {
+		e = d.format.subtask(parent)
+	} else {
+		e = d.format.top(d.entries)
+	}
+	fill(e, task)
+	if parent != nil && d.format.adopt(parent, d.all()) {
+		lines = replace(lines, parent.start, parent.head, d.format.render(parent))
+	}
+	at := d.insertAt(parent, previous, nil)
+	lines = replace(lines, at, at, d.format.render(e))
+	if parent != nil && parent.start >= at {
+		keep = map[int]string{parent.start + 1: parent.id}
+	}
+	written, err := p.write(d, lines, keep)
+	if err != nil {
+		return nil, err
+	}
+	return written.taskAt(at)
+}
+
+// taskAt returns the task starting at a line of a written doc
+func (d *doc) taskAt(line int) (*todo.Task, error) {
+	for i, e := range d.entries {
+		if e.start == line {
+			return d.task(e, i), nil
+		}
+		for j, child := range e.children {
+			if child.start == line {
+				return d.task(child, j), nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("task at line %d of %s %w", line+1, d.path, backend.ErrNotFound)
+}
+
+// insertAt returns the line a task goes to after previous under parent,
+// leaving out moved, which is about to be taken out
+func (d *doc) insertAt(parent, previous, moved *entry) int {
+	if previous != nil {
+		return previous.end
+	}
+	siblings := d.entries
+	if parent != nil {
+		siblings = parent.children
+	}
+	for _, sibling := range siblings {
+		if sibling != moved {
+			return sibling.start
+		}
+	}
+	if parent != nil {
+		return parent.head
+	}
+	return len(d.lines)
+}
+
+// replace returns lines with those from start to end replaced
+func replace(lines []string, start, end int, with []string) []string {
+	replaced := make([]string, 0, len(lines)-(end-start)+len(with))
+	replaced = append(replaced, lines[:start]...)
+	replaced = append(replaced, with...)
+	return append(replaced, lines[end:]...)
+}
+
+// Update rewrites a task's own lines with its fields
+func (p *Provider) Update(ctx context.Context, listID string, task *todo.Task) (*todo.Task, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	d, err := p.read(listID)
+	if err != nil {
+		return nil, err
+	}
+	e, err := d.lookup(task.ID)
+	if err != nil {
+		return nil, err
+	}
+	fill(e, task)
+	lines := replace(d.lines, e.start, e.head, d.format.render(e))
+	written, err := p.write(d, lines, map[int]string{e.start: e.id})
+	if err != nil {
+		return nil, err
+	}
+	return written.taskAt(e.start)
+}
+
+// Move puts a task and the lines that go with it after previous under
+// parent. Lists are separate files, so tasks can't move between them.
+func (p *Provider) Move(ctx context.Context, listID, taskID, parentID, previousID, destination string) (*todo.Task, error) {
+	if destination != "" && destination != listID {
+		return nil, fmt.Errorf("moving tasks to another file is %w", backend.ErrUnsupported)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	d, err := p.read(listID)
+	if err != nil {
+		return nil, err
+	}
+	e, err := d.lookup(taskID)
+	if err != nil {
+		return nil, err
+	}
+	parent, err := d.lookup(parentID)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := d.lookup(previousID)
+	if err != nil {
+		return nil, err
+	}
+	if parent != nil && (parent.parent != nil || len(e.children) > 0) {
+		return nil, fmt.Errorf("subtasks of subtasks are %w", backend.ErrUnsupported)
+	}
+
+	lines := d.lines
+	adopted := parent != nil && d.format.adopt(parent, d.all())
+	if adopted {
+		lines = replace(lines, parent.start, parent.head, d.format.render(parent))
+	}
+	block := d.format.relocate(lines[e.start:e.end], e, parent)
+	at := d.insertAt(parent, previous, e)
+	parentLine := -1
+	if parent != nil {
+		parentLine = parent.start
+	}
+	if at >= e.start && at <= e.end {
+		// Already in place
+		at = e.start
+		lines = replace(lines, e.start, e.end, block)
+	} else {
+		var from, to int
+		lines, from, to = cut(lines, e.start, e.end)
+		at, parentLine = shift(at, from, to), shift(parentLine, from, to)
+		lines = replace(lines, at, at, block)
+		if parentLine >= at {
+			parentLine += len(block)
+		}
+	}
+	keep := map[int]string{at: e.id}
+	if adopted {
+		keep[parentLine] = parent.id
+	}
+	written, err := p.write(d, lines, keep)
+	if err != nil {
+		return nil, err
+	}
+	return written.taskAt(at)
+}
+
+// cut returns lines without those from start to end, and the range it took
+// out: with a blank line around them too when they were set apart by blank
+// lines on both sides, so no gap is left behind
+func cut(lines []string, start, end int) ([]string, int, int) {
+	blank := func(i int) bool { return strings.TrimSpace(lines[i]) == "" }
+	if start > 0 && blank(start-1) {
+		switch {
+		case end < len(lines) && blank(end):
+			end++
+		case end == len(lines):
+			start--
+		}
+	}
+	return replace(lines, start, end, nil), start, end
+}
+
+// shift returns where line i, or an insertion before it, is once the lines
+// from start to end are taken out
+func shift(i, start, end int) int {
+	switch {
+	case i < start:
+		return i
+	case i < end:
+		return start
+	}
+	return i - (end - start)
+}
+
+// Capabilities reports that tasks keep the order of their lines and have
+// subtasks
+func (p *Provider) Capabilities(listID string) backend.Capabilities {
+	return backend.Capabilities{Ordering: true, Subtasks: true}
+}
+
+// Delete removes a task with its subtasks
+func (p *Provider) Delete(ctx context.Context, listID, taskID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	d, err := p.read(listID)
+	if err != nil {
+		return err
+	}
+	e, err := d.lookup(taskID)
+	if err != nil {
+		return err
+	}
+	// Subtasks elsewhere in the file are taken out last line first
+	targets := []*entry{e}
+	for _, child := range e.children {
+		if child.start >= e.end {
+			targets = append(targets, child)
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].start > targets[j].start })
+	lines := d.lines
+	for _, target := range targets {
+		lines, _, _ = cut(lines, target.start, target.end)
+	}
+	_, err = p.write(d, lines, nil)
+	return err
+}
@@ -0,0 +1,229 @@
+package files
+
+import (
+	"regexp"
+	"strings"
+)
+
+// markdownTask matches a task-list item: its indent, marker, checkbox and
+// text
+var markdownTask = regexp.MustCompile(`^(\s*)([-*+])\s+\[([ xX])\]\s+(.*)$`)
+
+// dueTag matches a due date written in a task's text
+var dueTag = regexp.MustCompile(`(^|\s)due:(\d{4}-\d{2}-\d{2})(\s|$)`)
+
+// markdown reads the task-list items of a Markdown file. Items at the top
+// of a list are tasks, items nested under them subtasks, and the other
+// lines nested under a task before its first subtask are its notes. Items
+// nested deeper belong to the subtask they are under and move with it.
+// Items in fenced code blocks and HTML comments are text, not tasks.
+type markdown struct{}
+
+func (markdown) parse(lines []string) []*entry {
+	text := markdownText(lines)
+	var entries []*entry
+	for i := 0; i < len(lines); {
+		top := markdownEntry(lines, text, i, len(lines))
+		if top == nil {
+			i++
+			continue
+		}
+		for j := top.head; j < top.end; {
+			child := markdownEntry(lines, text, j, top.end)
+			if child == nil {
+				j++
+				continue
+			}
+			child.parent = top
+			top.children = append(top.children, child)
+			j = child.end
+		}
+		entries = append(entries, top)
+		i = top.end
+	}
+	return entries
+}
+
+// markdownText reports which lines are inside fenced code blocks or HTML
+// comments, where an item is only text. A fence's own lines count as inside
+// it; a comment's first line doesn't, as a task may end with one.
+func markdownText(lines []string) []bool {
+	text := make([]bool, len(lines))
+	fence := ""
+	comment := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence != "":
+			text[i] = true
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				fence = ""
+			}
+		case comment:
+			text[i] = true
+			comment = !strings.Contains(trimmed, "-->")
+		default:
+			if f := codeFence(trimmed); f != "" {
+				text[i] = true
+				fence = f
+				continue
+			}
+			if at := strings.LastIndex(trimmed, "<!--"); at >= 0 {
+				comment = !strings.Contains(trimmed[at:], "-->")
+			}
+		}
+	}
+	return text
+}
+
+// codeFence returns the fence a line opens a code block with: three or
+// more backticks or tildes, the backticks not followed by another
+func codeFence(line string) string {
+	for _, mark := range []string{"`", "~"} {
+		n := len(line) - len(strings.TrimLeft(line, mark))
+		if n < 3 {
+			continue
+		}
+		if mark == "`" && strings.Contains(line[n:], "`") {
+			return ""
+		}
+		return line[:n]
+	}
+	return ""
+}
+
+// markdownEntry parses the item at line start, if it is one, with the
+// lines nested under it up to limit
+func markdownEntry(lines []string, text []bool, start, limit int) *entry {
+	if text[start] {
+		return nil
+	}
+	m := markdownTask.FindStringSubmatch(lines[start])
+	if m == nil {
+		return nil
+	}
+	e := &entry{start: start, indent: m[1], bullet: m[2], done: m[3] != " "}
+	e.title, e.due = splitDue(m[4])
+
+	// The item's block goes on while lines are indented deeper, blank
+	// lines included unless they end it
+	e.end = start + 1
+	for j := start + 1; j < limit; j++ {
+		line := lines[j]
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if len(line)-len(strings.TrimLeft(line, " \t")) <= len(e.indent) {
+			break
+		}
+		e.end = j + 1
+	}
+
+	e.head = start + 1
+	var notes []string
+	for j := start + 1; j < e.end && (text[j] || !markdownTask.MatchString(lines[j])); j++ {
+		notes = append(notes, lines[j])
+		if strings.TrimSpace(lines[j]) != "" {
+			e.head = j + 1
+		}
+	}
+	e.notes = dedent(notes[:e.head-start-1])
+	return e
+}
+
+// splitDue takes a due: tag out of a task's text
+func splitDue(text string) (string, string) {
+	m := dueTag.FindStringSubmatch(text)
+	if m == nil {
+		return strings.TrimSpace(text), ""
+	}
+	return strings.Join(strings.Fields(dueTag.ReplaceAllString(text, " ")), " "), m[2]
+}
+
+// dedent joins note lines, taking away the indent they share
+func dedent(lines []string) string {
+	shared := -1
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+		if shared < 0 || indent < shared {
+			shared = indent
+		}
+	}
+	notes := make([]string, len(lines))
+	for i, line := range lines {
+		if len(line) >= shared && shared >= 0 {
+			notes[i] = line[shared:]
+		}
+	}
+	return strings.TrimSpace(strings.Join(notes, "\n"))
+}
+
+func (markdown) render(e *entry) []string {
+	mark := " "
+	if e.done {
+		mark = "x"
+	}
+	line := e.indent + e.bullet + " [" + mark + "] " + e.title
+	if e.due != "" {
+		line += " due:" + e.due
+	}
+	lines := []string{line}
+	if e.notes == "" {
+		return lines
+	}
+	continuation := e.indent + strings.Repeat(" ", len(e.bullet)+1)
+	for _, note := range strings.Split(e.notes, "\n") {
+		if strings.TrimSpace(note) == "" {
+			lines = append(lines, "")
+			continue
+		}
+		lines = append(lines, continuation+note)
+	}
+	return lines
+}
+
+// relocate indents e's block for its new parent
+func (markdown) relocate(lines []string, e *entry, parent *entry) []string {
+	if parent == e.parent {
+		return lines
+	}
+	indent := ""
+	if parent != nil {
+		indent = childIndent(parent)
+	}
+	moved := make([]string, len(lines))
+	for i, line := range lines {
+		if strings.HasPrefix(line, e.indent) && strings.TrimSpace(line) != "" {
+			line = indent + line[len(e.indent):]
+		}
+		moved[i] = line
+	}
+	return moved
+}
+
+// childIndent returns the indent of parent's subtasks: that of the first
+// one, or one level under parent
+func childIndent(parent *entry) string {
+	if len(parent.children) > 0 {
+		return parent.children[0].indent
+	}
+	return parent.indent + strings.Repeat(" ", len(parent.bullet)+1)
+}
+
+func (markdown) adopt(parent *entry, entries []*entry) bool {
+	return false
+}
+
+func (markdown) subtask(parent *entry) *entry {
+	return &entry{indent: childIndent(parent), bullet: parent.bullet}
+}
+
+func (markdown) top(siblings []*entry) *entry {
+	if len(siblings) > 0 {
+		return &entry{indent: siblings[0].indent, bullet: siblings[0].bullet}
+	}
+	return &entry{bullet: "-"}
+}
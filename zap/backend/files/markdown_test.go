@@ -0,0 +1,169 @@
+package files
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"zap/todo"
+)
+
+// plans mixes tasks with prose, code blocks and comments whose items
+// aren't tasks
+const plans = "# Plans\n" +
+	"\n" +
+	"Intro with a - [ ] that isn't at the start of a line.\n" +
+	"\n" +
+	"- [ ] Write report due:2026-10-20\n" +
+	"  Notes about the report.\n" +
+	"  - [ ] Collect numbers\n" +
+	"  - [ ] Draft\n" +
+	"\n" +
+	"```markdown\n" +
+	"- [ ] Example task in a code block\n" +
+	"```\n" +
+	"\n" +
+	"Middle prose.\n" +
+	"\n" +
+	"- [ ] Plan launch\n" +
+	"  ~~~\n" +
+	"  - [ ] Example subtask in an indented fence\n" +
+	"  ~~~\n" +
+	"\n" +
+	"````\n" +
+	"```\n" +
+	"- [ ] Still in the longer fence\n" +
+	"````\n" +
+	"\n" +
+	"<!-- hidden:\n" +
+	"- [ ] Commented out\n" +
+	"-->\n" +
+	"\n" +
+	"- [x] Done thing\n" +
+	"\n" +
+	"Closing prose.\n"
+
+// writePlans writes plans to a file and returns a provider for it with the
+// file's list ID
+func writePlans(t *testing.T) (*Provider, string, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "plans.md")
+	if err := os.WriteFile(path, []byte(plans), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return New(path), fileListID("plans.md"), path
+}
+
+// byTitle returns a list's tasks by title
+func byTitle(t *testing.T, p *Provider, listID string) map[string]*todo.Task {
+	t.Helper()
+	tasks, err := p.Tasks(context.Background(), listID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	titles := make(map[string]*todo.Task)
+	for _, task := range tasks {
+		titles[task.Title] = task
+	}
+	return titles
+}
+
+func TestMarkdownSkipsItemsInCodeAndComments(t *testing.T) {
+	p, listID, _ := writePlans(t)
+	tasks, err := p.Tasks(context.Background(), listID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Write report", "Collect numbers", "Draft", "Plan launch", "Done thing"}
+	var got []string
+	for _, task := range tasks {
+		got = append(got, task.Title)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("tasks are %q, want %q", got, want)
+	}
+	if notes := byTitle(t, p, listID)["Plan launch"].Notes; notes != "~~~\n- [ ] Example subtask in an indented fence\n~~~" {
+		t.Errorf("Plan launch has notes %q, want its code block", notes)
+	}
+}
+
+func TestMarkdownMoveAndUpdateKeepOtherLines(t *testing.T) {
+	ctx := context.Background()
+	p, listID, path := writePlans(t)
+	tasks := byTitle(t, p, listID)
+
+	// Plan launch goes first, taking its code block along
+	if _, err := p.Move(ctx, listID, tasks["Plan launch"].ID, "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	tasks = byTitle(t, p, listID)
+	if _, err := p.Move(ctx, listID, tasks["Collect numbers"].ID, tasks["Write report"].ID, tasks["Draft"].ID, ""); err != nil {
+		t.Fatal(err)
+	}
+	draft := byTitle(t, p, listID)["Draft"]
+	draft.Title = "Draft the summary"
+	if _, err := p.Update(ctx, listID, draft); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "# Plans\n" +
+		"\n" +
+		"Intro with a - [ ] that isn't at the start of a line.\n" +
+		"\n" +
+		"- [ ] Plan launch\n" +
+		"  ~~~\n" +
+		"  - [ ] Example subtask in an indented fence\n" +
+		"  ~~~\n" +
+		"- [ ] Write report due:2026-10-20\n" +
+		"  Notes about the report.\n" +
+		"  - [ ] Draft the summary\n" +
+		"  - [ ] Collect numbers\n" +
+		"\n" +
+		"```markdown\n" +
+		"- [ ] Example task in a code block\n" +
+		"```\n" +
+		"\n" +
+		"Middle prose.\n" +
+		"\n" +
+		"````\n" +
+		"```\n" +
+		"- [ ] Still in the longer fence\n" +
+		"````\n" +
+		"\n" +
+		"<!-- hidden:\n" +
+		"- [ ] Commented out\n" +
+		"-->\n" +
+		"\n" +
+		"- [x] Done thing\n" +
+		"\n" +
+		"Closing prose.\n"
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != want {
+		t.Errorf("file after moving and updating tasks:\n%s\nwant:\n%s", data, want)
+	}
+}
+
+func TestCodeFence(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"```", "```"},
+		{"```go", "```"},
+		{"~~~~ text", "~~~~"},
+		{"``", ""},
+		{"```inline``` code", ""},
+		{"~~~ with ` backtick", "~~~"},
+		{"- [ ] task", ""},
+	}
+	for _, test := range tests {
+		if got := codeFence(test.line); got != test.want {
+			t.Errorf("codeFence(%q) = %q, want %q", test.line, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package files
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// todoTag matches key:value tags, leaving out URLs
+var todoTag = regexp.MustCompile(`^([A-Za-z][\w-]*):([^\s:/]\S*)$`)
+
+// todoDate matches the dates at the start of a line
+var todoDate = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+
+// todoPriority matches a priority such as (A)
+var todoPriority = regexp.MustCompile(`^\([A-Z]\)$`)
+
+// todoTxt reads todo.txt files, one task per line. todo.txt has no
+// subtasks, so they are tied to their task with the common id: and p: tags,
+// and has no notes, so notes written to its tasks are dropped.
+type todoTxt struct{}
+
+func (todoTxt) parse(lines []string) []*entry {
+	var all []*entry
+	byRef := make(map[string]*entry)
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		e := todoEntry(line)
+		e.start, e.head, e.end = i, i+1, i+1
+		all = append(all, e)
+		if e.ref != "" {
+			byRef[e.ref] = e
+		}
+	}
+
+	var entries []*entry
+	for _, e := range all {
+		if parent := byRef[e.parentRef]; e.parentRef != "" && parent != nil && parent.parentRef == "" && parent != e {
+			e.parent = parent
+			parent.children = append(parent.children, e)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	// Subtasks right below their task move with it
+	for _, e := range entries {
+		for _, child := range e.children {
+			if child.start == e.end {
+				e.end++
+			}
+		}
+	}
+	return entries
+}
+
+// todoEntry parses one line
+func todoEntry(line string) *entry {
+	e := &entry{}
+	words := strings.Fields(line)
+	if len(words) > 0 && words[0] == "x" {
+		e.done = true
+		words = words[1:]
+		if len(words) > 0 && todoDate.MatchString(words[0]) {
+			e.completed = words[0]
+			words = words[1:]
+		}
+	} else if len(words) > 0 && todoPriority.MatchString(words[0]) {
+		e.priority = words[0]
+		words = words[1:]
+	}
+	if len(words) > 0 && todoDate.MatchString(words[0]) {
+		e.created = words[0]
+		words = words[1:]
+	}
+
+	var title []string
+	for _, word := range words {
+		m := todoTag.FindStringSubmatch(word)
+		switch {
+		case m == nil:
+			title = append(title, word)
+		case m[1] == "due" && todoDate.MatchString(m[2]):
+			e.due = m[2]
+		case m[1] == "id":
+			e.ref = m[2]
+		case m[1] == "p":
+			e.parentRef = m[2]
+		case m[1] == "pri" && e.done && len(m[2]) == 1:
+			// Completed tasks keep their priority as a tag
+			e.priority = "(" + m[2] + ")"
+		default:
+			e.tags = append(e.tags, word)
+		}
+	}
+	e.title = strings.Join(title, " ")
+	return e
+}
+
+func (todoTxt) render(e *entry) []string {
+	var words []string
+	if e.done {
+		words = append(words, "x")
+		if e.completed != "" {
+			words = append(words, e.completed)
+		}
+	} else if e.priority != "" {
+		words = append(words, e.priority)
+	}
+	if e.created != "" {
+		words = append(words, e.created)
+	}
+	if e.title != "" {
+		words = append(words, e.title)
+	}
+	if e.due != "" {
+		words = append(words, "due:"+e.due)
+	}
+	words = append(words, e.tags...)
+	if e.done && e.priority != "" {
+		words = append(words, "pri:"+strings.Trim(e.priority, "()"))
+	}
+	if e.ref != "" {
+		words = append(words, "id:"+e.ref)
+	}
+	if e.parentRef != "" {
+		words = append(words, "p:"+e.parentRef)
+	}
+	return []string{strings.Join(words, " ")}
+}
+
+// relocate points e's p: tag at its new parent
+func (t todoTxt) relocate(lines []string, e *entry, parent *entry) []string {
+	e.parentRef = ""
+	if parent != nil {
+		e.parentRef = parent.ref
+	}
+	return append(t.render(e), lines[e.head-e.start:]...)
+}
+
+// adopt gives parent an id: tag when it has none, one past the highest
+// number in use
+func (todoTxt) adopt(parent *entry, entries []*entry) bool {
+	if parent.ref != "" {
+		return false
+	}
+	highest := 0
+	for _, e := range entries {
+		if n, err := strconv.Atoi(e.ref); err == nil && n > highest {
+			highest = n
+		}
+	}
+	parent.ref = strconv.Itoa(highest + 1)
+	return true
+}
+
+func (todoTxt) subtask(parent *entry) *entry {
+	return &entry{parentRef: parent.ref, created: time.Now().Format("2006-01-02")}
+}
+
+func (todoTxt) top(siblings []*entry) *entry {
+	return &entry{created: time.Now().Format("2006-01-02")}
+}
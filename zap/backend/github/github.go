@@ -0,0 +1,489 @@
+// Package github serves a repository's open issues to zap as one task
+// list, optionally only those with an assignee or labels. Issues have no
+// order of their own, so ranks are written as P1 to P4 labels and the list
+// is ordered by them; the task-list checkboxes in an issue's body are its
+// subtasks, and the rest of the body its notes.
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"zap/backend"
+	"zap/todo"
+)
+
+// apiURL is GitHub's REST API
+const apiURL = "https://api.github.com"
+
+// listID is the ID of the one list
+const listID = "issues"
+
+// priorityLevels is the number of priority labels, P1 being the highest
+const priorityLevels = 4
+
+// priorityLabel matches the priority labels
+var priorityLabel = regexp.MustCompile(`^P([1-9])$`)
+
+// checkbox matches a task-list item in an issue body
+var checkbox = regexp.MustCompile(`^(\s*[-*]\s+)\[([ xX])\]\s?(.*)$`)
+
+// Provider talks to one repository with a token
+type Provider struct {
+	client   *http.Client
+	repo     string
+	assignee string
+	labels   []string
+	token    string
+}
+
+// New creates a provider for the issues of repo, given as owner/name, that
+// are assigned to assignee and carry labels, when they are set
+func New(repo, assignee string, labels []string, token string) *Provider {
+	return &Provider{client: http.DefaultClient, repo: repo, assignee: assignee, labels: labels, token: token}
+}
+
+// Name identifies the provider
+func (p *Provider) Name() string {
+	return "github"
+}
+
+type issue struct {
+	Number      int       `json:"number"`
+	Title       string    `json:"title"`
+	Body        string    `json:"body"`
+	State       string    `json:"state"`
+	UpdatedAt   string    `json:"updated_at"`
+	ClosedAt    *string   `json:"closed_at"`
+	Labels      []label   `json:"labels"`
+	PullRequest *struct{} `json:"pull_request"`
+}
+
+type label struct {
+	Name string `json:"name"`
+}
+
+// call sends a request to the API with the provider's token
+func (p *Provider) call(ctx context.Context, method, path string, params url.Values, body, out interface{}) error {
+	target := apiURL + path
+	if len(params) > 0 {
+		target += "?" + params.Encode()
+	}
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+p.token)
+	header.Set("X-GitHub-Api-Version", "2022-11-28")
+	return backend.Call(ctx, p.client, method, target, header, body, out)
+}
+
+// Lists returns the one list, titled after the repository
+func (p *Provider) Lists(ctx context.Context) ([]*todo.TaskList, error) {
+	return []*todo.TaskList{{ID: listID, Title: p.repo}}, nil
+}
+
+// CreateList fails, since a repository has one list of issues
+func (p *Provider) CreateList(ctx context.Context, title string) (*todo.TaskList, error) {
+	return nil, fmt.Errorf("creating lists is %w", backend.ErrUnsupported)
+}
+
+// issues returns the open issues in order of priority, leaving out pull
+// requests
+func (p *Provider) issues(ctx context.Context, list string) ([]issue, error) {
+	if list != listID {
+		return nil, fmt.Errorf("task list %s %w", list, backend.ErrNotFound)
+	}
+	params := url.Values{"state": {"open"}, "per_page": {"100"}}
+	if p.assignee != "" {
+		params.Set("assignee", p.assignee)
+	}
+	if len(p.labels) > 0 {
+		params.Set("labels", strings.Join(p.labels, ","))
+	}
+	var issues []issue
+	for page := 1; ; page++ {
+		params.Set("page", strconv.Itoa(page))
+		var batch []issue
+		if err := p.call(ctx, http.MethodGet, "/repos/"+p.repo+"/issues", params, nil, &batch); err != nil {
+			return nil, err
+		}
+		for _, i := range batch {
+			if i.PullRequest == nil {
+				issues = append(issues, i)
+			}
+		}
+		if len(batch) < 100 {
+			break
+		}
+	}
+	sort.SliceStable(issues, func(i, j int) bool { return priority(issues[i]) < priority(issues[j]) })
+	return issues, nil
+}
+
+// priority returns the level of an issue's priority label, or one past the
+// lowest without one
+func priority(i issue) int {
+	for _, l := range i.Labels {
+		if m := priorityLabel.FindStringSubmatch(l.Name); m != nil {
+			level, _ := strconv.Atoi(m[1])
+			return level
+		}
+	}
+	return priorityLevels + 1
+}
+
+// Tasks returns the open issues, each followed by its checkboxes
+func (p *Provider) Tasks(ctx context.Context, list string) ([]*todo.Task, error) {
+	issues, err := p.issues(ctx, list)
+	if err != nil {
+		return nil, err
+	}
+	var listTasks []*todo.Task
+	for n, i := range issues {
+		listTasks = append(listTasks, issueTask(i, n))
+		listTasks = append(listTasks, itemTasks(i)...)
+	}
+	return listTasks, nil
+}
+
+// issueTask converts an issue at index in the list
+func issueTask(i issue, index int) *todo.Task {
+	notes, _ := splitBody(i.Body)
+	task := &todo.Task{
+		ID:       strconv.Itoa(i.Number),
+		Title:    i.Title,
+		Notes:    notes,
+		Status:   "needsAction",
+		Position: fmt.Sprintf("%020d", index),
+		Updated:  i.UpdatedAt,
+	}
+	if i.State == "closed" {
+		task.Status = "completed"
+		if i.ClosedAt != nil {
+			task.Completed = *i.ClosedAt
+		}
+	}
+	return task
+}
+
+// item is a task-list checkbox of an issue body
+type item struct {
+	prefix  string
+	checked bool
+	text    string
+}
+
+// itemTasks converts an issue's checkboxes. Their IDs are the issue number
+// and their index, which is enough until the next read.
+func itemTasks(i issue) []*todo.Task {
+	_, items := splitBody(i.Body)
+	tasks := make([]*todo.Task, len(items))
+	for n, it := range items {
+		tasks[n] = &todo.Task{
+			ID:       itemID(i.Number, n),
+			Title:    it.text,
+			Parent:   strconv.Itoa(i.Number),
+			Status:   "needsAction",
+			Position: fmt.Sprintf("%020d", n),
+			Updated:  i.UpdatedAt,
+		}
+		if it.checked {
+			tasks[n].Status = "completed"
+			tasks[n].Completed = i.UpdatedAt
+		}
+	}
+	return tasks
+}
+
+func itemID(number, index int) string {
+	return fmt.Sprintf("%d-%d", number, index)
+}
+
+// splitItemID returns the issue number and index of a checkbox's task ID
+func splitItemID(taskID string) (number, index int, ok bool) {
+	before, after, found := strings.Cut(taskID, "-")
+	if !found {
+		return 0, 0, false
+	}
+	number, err := strconv.Atoi(before)
+	if err != nil {
+		return 0, 0, false
+	}
+	index, err = strconv.Atoi(after)
+	if err != nil {
+		return 0, 0, false
+	}
+	return number, index, true
+}
+
+// splitBody separates an issue body into its notes and checkboxes
+func splitBody(body string) (string, []item) {
+	var notes []string
+	var items []item
+	for _, line := range strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n") {
+		if m := checkbox.FindStringSubmatch(line); m != nil {
+			items = append(items, item{prefix: m[1], checked: m[2] != " ", text: m[3]})
+			continue
+		}
+		notes = append(notes, line)
+	}
+	return strings.TrimSpace(strings.Join(notes, "\n")), items
+}
+
+// joinBody puts notes and checkboxes back together, the checkboxes last
+func joinBody(notes string, items []item) string {
+	lines := []string{}
+	if notes != "" {
+		lines = append(lines, notes)
+		if len(items) > 0 {
+			lines = append(lines, "")
+		}
+	}
+	for _, it := range items {
+		mark := " "
+		if it.checked {
+			mark = "x"
+		}
+		prefix := it.prefix
+		if prefix == "" {
+			prefix = "- "
+		}
+		lines = append(lines, prefix+"["+mark+"] "+it.text)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// get reads one issue
+func (p *Provider) get(ctx context.Context, number int) (issue, error) {
+	var i issue
+	err := p.call(ctx, http.MethodGet, fmt.Sprintf("/repos/%s/issues/%d", p.repo, number), nil, nil, &i)
+	return i, err
+}
+
+// edit rewrites an issue's checkboxes with change and returns the written
+// issue
+func (p *Provider) edit(ctx context.Context, number int, change func([]item) ([]item, error)) (issue, error) {
+	current, err := p.get(ctx, number)
+	if err != nil {
+		return issue{}, err
+	}
+	notes, items := splitBody(current.Body)
+	items, err = change(items)
+	if err != nil {
+		return issue{}, err
+	}
+	var updated issue
+	err = p.call(ctx, http.MethodPatch, fmt.Sprintf("/repos/%s/issues/%d", p.repo, number), nil, map[string]interface{}{"body": joinBody(notes, items)}, &updated)
+	return updated, err
+}
+
+// insertAt returns items with it inserted at index
+func insertAt(items []item, index int, it item) []item {
+	items = append(items, item{})
+	copy(items[index+1:], items[index:])
+	items[index] = it
+	return items
+}
+
+// after returns the index after the checkbox with ID previous of issue
+// number, or 0 without previous
+func after(number int, previous string, items []item) int {
+	if previous == "" {
+		return 0
+	}
+	if n, index, ok := splitItemID(previous); ok && n == number && index < len(items) {
+		return index + 1
+	}
+	return len(items)
+}
+
+// Insert opens an issue, or adds a checkbox to an issue when parent is set
+func (p *Provider) Insert(ctx context.Context, list, parent, previous string, task *todo.Task) (*todo.Task, error) {
+	if parent != "" {
+		number, err := strconv.Atoi(parent)
+		if err != nil {
+			return nil, fmt.Errorf("task %s %w", parent, backend.ErrNotFound)
+		}
+		var index int
+		updated, err := p.edit(ctx, number, func(items []item) ([]item, error) {
+			index = after(number, previous, items)
+			return insertAt(items, index, item{checked: task.Status == "completed", text: task.Title}), nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return itemTasks(updated)[index], nil
+	}
+
+	if list != listID {
+		return nil, fmt.Errorf("task list %s %w", list, backend.ErrNotFound)
+	}
+	data := map[string]interface{}{"title": task.Title, "body": task.Notes}
+	if p.assignee != "" {
+		data["assignees"] = []string{p.assignee}
+	}
+	if len(p.labels) > 0 {
+		data["labels"] = p.labels
+	}
+	var created issue
+	if err := p.call(ctx, http.MethodPost, "/repos/"+p.repo+"/issues", nil, data, &created); err != nil {
+		return nil, err
+	}
+	return issueTask(created, 0), nil
+}
+
+// Update writes an issue's title, notes and state, keeping its checkboxes,
+// or a checkbox's text and state. Issues have no due dates.
+func (p *Provider) Update(ctx context.Context, list string, task *todo.Task) (*todo.Task, error) {
+	if number, index, ok := splitItemID(task.ID); ok {
+		updated, err := p.edit(ctx, number, func(items []item) ([]item, error) {
+			if index >= len(items) {
+				return nil, fmt.Errorf("task %s %w", task.ID, backend.ErrNotFound)
+			}
+			items[index].text = task.Title
+			items[index].checked = task.Status == "completed"
+			return items, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return itemTasks(updated)[index], nil
+	}
+
+	number, err := strconv.Atoi(task.ID)
+	if err != nil {
+		return nil, fmt.Errorf("task %s %w", task.ID, backend.ErrNotFound)
+	}
+	current, err := p.get(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	_, items := splitBody(current.Body)
+	data := map[string]interface{}{
+		"title": task.Title,
+		"body":  joinBody(task.Notes, items),
+		"state": "open",
+	}
+	if task.Status == "completed" {
+		data["state"] = "closed"
+		data["state_reason"] = "completed"
+	}
+	var updated issue
+	if err := p.call(ctx, http.MethodPatch, fmt.Sprintf("/repos/%s/issues/%d", p.repo, number), nil, data, &updated); err != nil {
+		return nil, err
+	}
+	return issueTask(updated, 0), nil
+}
+
+// Move reorders a checkbox within its issue. Issues themselves have no
+// order.
+func (p *Provider) Move(ctx context.Context, list, taskID, parent, previous, destination string) (*todo.Task, error) {
+	if destination != "" && destination != list {
+		return nil, fmt.Errorf("moving issues to another list is %w", backend.ErrUnsupported)
+	}
+	if number, index, ok := splitItemID(taskID); ok {
+		if parent != strconv.Itoa(number) {
+			return nil, fmt.Errorf("moving checkboxes to another issue is %w", backend.ErrUnsupported)
+		}
+		var target int
+		updated, err := p.edit(ctx, number, func(items []item) ([]item, error) {
+			if index >= len(items) {
+				return nil, fmt.Errorf("task %s %w", taskID, backend.ErrNotFound)
+			}
+			moved := items[index]
+			target = after(number, previous, items)
+			if target > index {
+				target--
+			}
+			items = append(items[:index], items[index+1:]...)
+			return insertAt(items, target, moved), nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return itemTasks(updated)[target], nil
+	}
+	if parent != "" {
+		return nil, fmt.Errorf("turning issues into checkboxes is %w", backend.ErrUnsupported)
+	}
+	return nil, fmt.Errorf("ordering issues is %w; their priority is kept in labels", backend.ErrUnsupported)
+}
+
+// Capabilities reports that issues have checkboxes and priority labels but
+// no order
+func (p *Provider) Capabilities(list string) backend.Capabilities {
+	return backend.Capabilities{Subtasks: true, Labels: true}
+}
+
+// Priorities returns the priority label of every open issue
+func (p *Provider) Priorities(ctx context.Context, list string) (map[string]string, error) {
+	issues, err := p.issues(ctx, list)
+	if err != nil {
+		return nil, err
+	}
+	priorities := make(map[string]string, len(issues))
+	for _, i := range issues {
+		priorities[strconv.Itoa(i.Number)] = ""
+		if level := priority(i); level <= priorityLevels {
+			priorities[strconv.Itoa(i.Number)] = fmt.Sprintf("P%d", level)
+		}
+	}
+	return priorities, nil
+}
+
+// SetPriority labels an issue with priority, taking its other priority
+// labels off
+func (p *Provider) SetPriority(ctx context.Context, list, taskID, priority string) error {
+	if !priorityLabel.MatchString(priority) {
+		return fmt.Errorf("priority %q is not a label like P1", priority)
+	}
+	number, err := strconv.Atoi(taskID)
+	if err != nil {
+		return fmt.Errorf("task %s %w", taskID, backend.ErrNotFound)
+	}
+	current, err := p.get(ctx, number)
+	if err != nil {
+		return err
+	}
+	labelled := false
+	for _, l := range current.Labels {
+		if l.Name == priority {
+			labelled = true
+			continue
+		}
+		if !priorityLabel.MatchString(l.Name) {
+			continue
+		}
+		if err := p.call(ctx, http.MethodDelete, fmt.Sprintf("/repos/%s/issues/%d/labels/%s", p.repo, number, url.PathEscape(l.Name)), nil, nil, nil); err != nil {
+			return err
+		}
+	}
+	if labelled {
+		return nil
+	}
+	return p.call(ctx, http.MethodPost, fmt.Sprintf("/repos/%s/issues/%d/labels", p.repo, number), nil, map[string][]string{"labels": {priority}}, nil)
+}
+
+// Delete closes an issue as not planned, since issues can't be deleted, or
+// removes a checkbox
+func (p *Provider) Delete(ctx context.Context, list, taskID string) error {
+	if number, index, ok := splitItemID(taskID); ok {
+		_, err := p.edit(ctx, number, func(items []item) ([]item, error) {
+			if index >= len(items) {
+				return nil, fmt.Errorf("task %s %w", taskID, backend.ErrNotFound)
+			}
+			return append(items[:index], items[index+1:]...), nil
+		})
+		return err
+	}
+	number, err := strconv.Atoi(taskID)
+	if err != nil {
+		return fmt.Errorf("task %s %w", taskID, backend.ErrNotFound)
+	}
+	data := map[string]string{"state": "closed", "state_reason": "not_planned"}
+	return p.call(ctx, http.MethodPatch, fmt.Sprintf("/repos/%s/issues/%d", p.repo, number), nil, data, nil)
+}
@@ -0,0 +1,291 @@
+package backend
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"zap/todo"
+	"zap/todo/googletasks"
+
+	tasksapi "google.golang.org/api/tasks/v1"
+)
+
+// Handler answers the Tasks API calls zap makes from a provider
+type Handler struct {
+	provider Provider
+	mux      *http.ServeMux
+}
+
+// NewHandler creates a handler serving provider
+func NewHandler(provider Provider) *Handler {
+	h := &Handler{provider: provider, mux: http.NewServeMux()}
+	h.mux.HandleFunc("GET /tasks/v1/users/@me/lists", h.listTaskLists)
+	h.mux.HandleFunc("POST /tasks/v1/users/@me/lists", h.insertTaskList)
+	h.mux.HandleFunc("GET /tasks/v1/users/@me/lists/{list}", h.getTaskList)
+	h.mux.HandleFunc("PATCH /tasks/v1/users/@me/lists/{list}", h.unsupported("renaming lists"))
+	h.mux.HandleFunc("DELETE /tasks/v1/users/@me/lists/{list}", h.unsupported("deleting lists"))
+	h.mux.HandleFunc("GET /tasks/v1/lists/{list}/tasks", h.listTasks)
+	h.mux.HandleFunc("POST /tasks/v1/lists/{list}/tasks", h.insertTask)
+	h.mux.HandleFunc("POST /tasks/v1/lists/{list}/clear", h.clear)
+	h.mux.HandleFunc("GET /tasks/v1/lists/{list}/tasks/{task}", h.getTask)
+	h.mux.HandleFunc("PATCH /tasks/v1/lists/{list}/tasks/{task}", h.patchTask)
+	h.mux.HandleFunc("PUT /tasks/v1/lists/{list}/tasks/{task}", h.patchTask)
+	h.mux.HandleFunc("DELETE /tasks/v1/lists/{list}/tasks/{task}", h.deleteTask)
+	h.mux.HandleFunc("POST /tasks/v1/lists/{list}/tasks/{task}/move", h.moveTask)
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) listTaskLists(w http.ResponseWriter, r *http.Request) {
+	lists, err := h.provider.Lists(r.Context())
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	items := make([]*tasksapi.TaskList, len(lists))
+	for i, list := range lists {
+		items[i] = googletasks.APITaskList(list)
+	}
+	writeJSON(w, &tasksapi.TaskLists{Kind: "tasks#taskLists", Items: items})
+}
+
+func (h *Handler) insertTaskList(w http.ResponseWriter, r *http.Request) {
+	var list tasksapi.TaskList
+	if !readJSON(w, r, &list) {
+		return
+	}
+	created, err := h.provider.CreateList(r.Context(), list.Title)
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	writeJSON(w, googletasks.APITaskList(created))
+}
+
+func (h *Handler) getTaskList(w http.ResponseWriter, r *http.Request) {
+	lists, err := h.provider.Lists(r.Context())
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	for _, list := range lists {
+		if list.ID == r.PathValue("list") {
+			writeJSON(w, googletasks.APITaskList(list))
+			return
+		}
+	}
+	h.fail(w, fmt.Errorf("task list %w", ErrNotFound))
+}
+
+// listTasks answers with every task in one page, filtered like the API
+// filters by completion
+func (h *Handler) listTasks(w http.ResponseWriter, r *http.Request) {
+	listTasks, err := h.provider.Tasks(r.Context(), r.PathValue("list"))
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	query := r.URL.Query()
+	completedMin, _ := time.Parse(time.RFC3339, query.Get("completedMin"))
+	items := make([]*tasksapi.Task, 0, len(listTasks))
+	for _, task := range listTasks {
+		completed := task.Status == "completed"
+		if completed && query.Get("showCompleted") == "false" {
+			continue
+		}
+		if !completedMin.IsZero() {
+			if !completed || task.Completed == "" {
+				continue
+			}
+			if at, err := time.Parse(time.RFC3339, task.Completed); err != nil || at.Before(completedMin) {
+				continue
+			}
+		}
+		items = append(items, stamp(task))
+	}
+	writeJSON(w, &tasksapi.Tasks{Kind: "tasks#tasks", Items: items})
+}
+
+func (h *Handler) insertTask(w http.ResponseWriter, r *http.Request) {
+	var task tasksapi.Task
+	if !readJSON(w, r, &task) {
+		return
+	}
+	if task.Status == "" {
+		task.Status = "needsAction"
+	}
+	query := r.URL.Query()
+	created, err := h.provider.Insert(r.Context(), r.PathValue("list"), query.Get("parent"), query.Get("previous"), googletasks.Task(&task))
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	writeJSON(w, stamp(created))
+}
+
+// clear deletes the completed tasks, since providers have no hidden tasks
+func (h *Handler) clear(w http.ResponseWriter, r *http.Request) {
+	listID := r.PathValue("list")
+	listTasks, err := h.provider.Tasks(r.Context(), listID)
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	for _, task := range listTasks {
+		if task.Status != "completed" || task.Parent != "" {
+			continue
+		}
+		if err := h.provider.Delete(r.Context(), listID, task.ID); err != nil {
+			h.fail(w, err)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) getTask(w http.ResponseWriter, r *http.Request) {
+	task, err := h.find(r, r.PathValue("list"), r.PathValue("task"))
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	writeJSON(w, stamp(task))
+}
+
+// patchTask merges the fields sent by the client into the current task,
+// unless If-Match names another ETag than the task's
+func (h *Handler) patchTask(w http.ResponseWriter, r *http.Request) {
+	var patch map[string]json.RawMessage
+	if !readJSON(w, r, &patch) {
+		return
+	}
+	listID := r.PathValue("list")
+	task, err := h.find(r, listID, r.PathValue("task"))
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	current := stamp(task)
+	if match := r.Header.Get("If-Match"); match != "" && match != current.Etag {
+		writeError(w, http.StatusPreconditionFailed, "task was modified")
+		return
+	}
+
+	var fields map[string]json.RawMessage
+	encoded, _ := json.Marshal(current)
+	json.Unmarshal(encoded, &fields)
+	for key, value := range patch {
+		switch key {
+		case "id", "parent", "position", "kind", "selfLink", "etag":
+			continue
+		}
+		fields[key] = value
+	}
+	merged, _ := json.Marshal(fields)
+	var updated tasksapi.Task
+	if err := json.Unmarshal(merged, &updated); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	written, err := h.provider.Update(r.Context(), listID, googletasks.Task(&updated))
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	writeJSON(w, stamp(written))
+}
+
+func (h *Handler) deleteTask(w http.ResponseWriter, r *http.Request) {
+	if err := h.provider.Delete(r.Context(), r.PathValue("list"), r.PathValue("task")); err != nil {
+		h.fail(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) moveTask(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	moved, err := h.provider.Move(r.Context(), r.PathValue("list"), r.PathValue("task"), query.Get("parent"), query.Get("previous"), query.Get("destinationTasklist"))
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	writeJSON(w, stamp(moved))
+}
+
+// unsupported answers calls the handler doesn't translate
+func (h *Handler) unsupported(what string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.fail(w, fmt.Errorf("%s is %w", what, ErrUnsupported))
+	}
+}
+
+// find returns one task of a list
+func (h *Handler) find(r *http.Request, listID, taskID string) (*todo.Task, error) {
+	listTasks, err := h.provider.Tasks(r.Context(), listID)
+	if err != nil {
+		return nil, err
+	}
+	for _, task := range listTasks {
+		if task.ID == taskID {
+			return task, nil
+		}
+	}
+	return nil, fmt.Errorf("task %w", ErrNotFound)
+}
+
+// fail answers with the status that matches err
+func (h *Handler) fail(w http.ResponseWriter, err error) {
+	var apiErr *Error
+	switch {
+	case errors.As(err, &apiErr):
+		writeError(w, apiErr.Code, fmt.Sprintf("%s: %s", h.provider.Name(), apiErr.Message))
+	case errors.Is(err, ErrNotFound):
+		writeError(w, http.StatusNotFound, fmt.Sprintf("%s: %v", h.provider.Name(), err))
+	case errors.Is(err, ErrUnsupported):
+		writeError(w, http.StatusNotImplemented, fmt.Sprintf("%s: %v", h.provider.Name(), err))
+	default:
+		writeError(w, http.StatusBadGateway, fmt.Sprintf("%s: %v", h.provider.Name(), err))
+	}
+}
+
+// stamp returns task as the API's with an ETag derived from the fields zap
+// writes, so that updates are only made to tasks as zap read them
+func stamp(task *todo.Task) *tasksapi.Task {
+	stamped := googletasks.APITask(task)
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\x00%s\x00%s\x00%s\x00%s", task.Title, task.Notes, task.Due, task.Status, task.Parent)
+	stamped.Etag = `"` + hex.EncodeToString(hash.Sum(nil)[:8]) + `"`
+	return stamped
+}
+
+// readJSON decodes a request body, answering 400 when it is invalid
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError answers in the API's error format so googleapi.Error is filled
+func writeError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{"code": code, "message": message},
+	})
+}
@@ -0,0 +1,431 @@
+// Package trello serves a Trello board to zap. The board's lists are task
+// lists and their cards are tasks, ordered by card position; the items of
+// a card's checklists are its subtasks, and subtasks zap creates go in a
+// checklist called Subtasks. A card is completed when its due date is
+// marked complete.
+package trello
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"zap/backend"
+	"zap/todo"
+)
+
+// apiURL is Trello's REST API
+const apiURL = "https://api.trello.com/1"
+
+// subtasksChecklist is the checklist subtasks are created in
+const subtasksChecklist = "Subtasks"
+
+// Provider talks to one board with an API key and token
+type Provider struct {
+	client *http.Client
+	board  string
+	key    string
+	token  string
+
+	mu      sync.Mutex
+	boardID string
+}
+
+// New creates a provider for the board with the given name or ID
+func New(board, key, token string) *Provider {
+	return &Provider{client: http.DefaultClient, board: board, key: key, token: token}
+}
+
+// Name identifies the provider
+func (p *Provider) Name() string {
+	return "trello"
+}
+
+type list struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type card struct {
+	ID               string      `json:"id"`
+	Name             string      `json:"name"`
+	Desc             string      `json:"desc"`
+	Due              *string     `json:"due"`
+	DueComplete      bool        `json:"dueComplete"`
+	Pos              float64     `json:"pos"`
+	IDList           string      `json:"idList"`
+	DateLastActivity string      `json:"dateLastActivity"`
+	Checklists       []checklist `json:"checklists"`
+}
+
+type checklist struct {
+	ID         string      `json:"id"`
+	Name       string      `json:"name"`
+	Pos        float64     `json:"pos"`
+	CheckItems []checkItem `json:"checkItems"`
+}
+
+type checkItem struct {
+	ID    string  `json:"id"`
+	Name  string  `json:"name"`
+	State string  `json:"state"`
+	Pos   float64 `json:"pos"`
+}
+
+// call sends a request to the API with the provider's credentials
+func (p *Provider) call(ctx context.Context, method, path string, params url.Values, out interface{}) error {
+	target := apiURL + path
+	if len(params) > 0 {
+		target += "?" + params.Encode()
+	}
+	header := http.Header{}
+	header.Set("Authorization", fmt.Sprintf(`OAuth oauth_consumer_key="%s", oauth_token="%s"`, p.key, p.token))
+	return backend.Call(ctx, p.client, method, target, header, nil, out)
+}
+
+// findBoard finds the board by ID or name once
+func (p *Provider) findBoard(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.boardID != "" {
+		return p.boardID, nil
+	}
+	var boards []list
+	if err := p.call(ctx, http.MethodGet, "/members/me/boards", url.Values{"fields": {"name"}, "filter": {"open"}}, &boards); err != nil {
+		return "", err
+	}
+	for _, board := range boards {
+		if board.ID == p.board || board.Name == p.board {
+			p.boardID = board.ID
+			return board.ID, nil
+		}
+	}
+	return "", fmt.Errorf("board %s %w", p.board, backend.ErrNotFound)
+}
+
+// Lists returns the board's open lists
+func (p *Provider) Lists(ctx context.Context) ([]*todo.TaskList, error) {
+	boardID, err := p.findBoard(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var lists []list
+	if err := p.call(ctx, http.MethodGet, "/boards/"+boardID+"/lists", url.Values{"fields": {"name"}, "filter": {"open"}}, &lists); err != nil {
+		return nil, err
+	}
+	taskLists := make([]*todo.TaskList, len(lists))
+	for i, l := range lists {
+		taskLists[i] = &todo.TaskList{ID: l.ID, Title: l.Name}
+	}
+	return taskLists, nil
+}
+
+// CreateList adds a list at the end of the board
+func (p *Provider) CreateList(ctx context.Context, title string) (*todo.TaskList, error) {
+	boardID, err := p.findBoard(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var created list
+	if err := p.call(ctx, http.MethodPost, "/lists", url.Values{"name": {title}, "idBoard": {boardID}, "pos": {"bottom"}}, &created); err != nil {
+		return nil, err
+	}
+	return &todo.TaskList{ID: created.ID, Title: created.Name}, nil
+}
+
+// cards returns a list's open cards with their checklists, in order
+func (p *Provider) cards(ctx context.Context, listID string) ([]card, error) {
+	var cards []card
+	params := url.Values{
+		"fields":           {"name,desc,due,dueComplete,pos,idList,dateLastActivity"},
+		"checklists":       {"all"},
+		"checklist_fields": {"name,pos"},
+	}
+	if err := p.call(ctx, http.MethodGet, "/lists/"+listID+"/cards", params, &cards); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(cards, func(i, j int) bool { return cards[i].Pos < cards[j].Pos })
+	for _, c := range cards {
+		sort.SliceStable(c.Checklists, func(i, j int) bool { return c.Checklists[i].Pos < c.Checklists[j].Pos })
+		for _, cl := range c.Checklists {
+			sort.SliceStable(cl.CheckItems, func(i, j int) bool { return cl.CheckItems[i].Pos < cl.CheckItems[j].Pos })
+		}
+	}
+	return cards, nil
+}
+
+// Tasks returns the list's cards, each followed by its checklist items
+func (p *Provider) Tasks(ctx context.Context, listID string) ([]*todo.Task, error) {
+	cards, err := p.cards(ctx, listID)
+	if err != nil {
+		return nil, err
+	}
+	var listTasks []*todo.Task
+	for i, c := range cards {
+		listTasks = append(listTasks, cardTask(c, i))
+		n := 0
+		for _, cl := range c.Checklists {
+			for _, item := range cl.CheckItems {
+				listTasks = append(listTasks, itemTask(c, cl, item, n))
+				n++
+			}
+		}
+	}
+	return listTasks, nil
+}
+
+// cardTask converts a card at index among its list's cards
+func cardTask(c card, index int) *todo.Task {
+	task := &todo.Task{
+		ID:       c.ID,
+		Title:    c.Name,
+		Notes:    c.Desc,
+		Status:   "needsAction",
+		Position: fmt.Sprintf("%020d", index),
+		Updated:  c.DateLastActivity,
+	}
+	if c.Due != nil {
+		task.Due = *c.Due
+	}
+	if c.DueComplete {
+		task.Status = "completed"
+		task.Completed = c.DateLastActivity
+	}
+	return task
+}
+
+// itemTask converts a checklist item at index among its card's items. Its
+// ID names the card and checklist too, which writes to it need.
+func itemTask(c card, cl checklist, item checkItem, index int) *todo.Task {
+	task := &todo.Task{
+		ID:       itemID(c.ID, cl.ID, item.ID),
+		Title:    item.Name,
+		Parent:   c.ID,
+		Status:   "needsAction",
+		Position: fmt.Sprintf("%020d", index),
+		Updated:  c.DateLastActivity,
+	}
+	if item.State == "complete" {
+		task.Status = "completed"
+		task.Completed = c.DateLastActivity
+	}
+	return task
+}
+
+// itemID and splitItemID join and split the IDs of a checklist item's
+// card, checklist and item
+func itemID(cardID, checklistID, id string) string {
+	return cardID + "." + checklistID + "." + id
+}
+
+func splitItemID(taskID string) (cardID, checklistID, id string, ok bool) {
+	parts := strings.Split(taskID, ".")
+	if len(parts) != 3 {
+		return "", "", "", false
+	}
+	return parts[0], parts[1], parts[2], true
+}
+
+// Insert creates a card, or a checklist item when parent is set
+func (p *Provider) Insert(ctx context.Context, listID, parent, previous string, task *todo.Task) (*todo.Task, error) {
+	if parent != "" {
+		return p.insertItem(ctx, listID, parent, previous, task)
+	}
+	cards, err := p.cards(ctx, listID)
+	if err != nil {
+		return nil, err
+	}
+	params := url.Values{
+		"idList": {listID},
+		"name":   {task.Title},
+		"desc":   {task.Notes},
+		"pos":    {position(cardPositions(cards, ""), previous)},
+	}
+	if task.Due != "" {
+		params.Set("due", task.Due)
+	}
+	if task.Status == "completed" {
+		params.Set("dueComplete", "true")
+	}
+	var created card
+	if err := p.call(ctx, http.MethodPost, "/cards", params, &created); err != nil {
+		return nil, err
+	}
+	return cardTask(created, 0), nil
+}
+
+// insertItem adds a checklist item to the card's Subtasks checklist,
+// creating the checklist first when the card has none
+func (p *Provider) insertItem(ctx context.Context, listID, cardID, previous string, task *todo.Task) (*todo.Task, error) {
+	var checklists []checklist
+	if err := p.call(ctx, http.MethodGet, "/cards/"+cardID+"/checklists", nil, &checklists); err != nil {
+		return nil, err
+	}
+	var target *checklist
+	for i := range checklists {
+		if checklists[i].Name == subtasksChecklist {
+			target = &checklists[i]
+			break
+		}
+	}
+	if target == nil {
+		var created checklist
+		if err := p.call(ctx, http.MethodPost, "/checklists", url.Values{"idCard": {cardID}, "name": {subtasksChecklist}}, &created); err != nil {
+			return nil, err
+		}
+		target = &created
+	}
+
+	var siblings []sibling
+	for _, item := range target.CheckItems {
+		siblings = append(siblings, sibling{id: itemID(cardID, target.ID, item.ID), pos: item.Pos})
+	}
+	sort.SliceStable(siblings, func(i, j int) bool { return siblings[i].pos < siblings[j].pos })
+	params := url.Values{"name": {task.Title}, "pos": {position(siblings, previous)}}
+	if task.Status == "completed" {
+		params.Set("checked", "true")
+	}
+	var created checkItem
+	if err := p.call(ctx, http.MethodPost, "/checklists/"+target.ID+"/checkItems", params, &created); err != nil {
+		return nil, err
+	}
+	return itemTask(card{ID: cardID}, *target, created, 0), nil
+}
+
+// Update writes a card's name, description, due date and completion, or a
+// checklist item's name and state; items have no notes or due dates
+func (p *Provider) Update(ctx context.Context, listID string, task *todo.Task) (*todo.Task, error) {
+	if cardID, checklistID, id, ok := splitItemID(task.ID); ok {
+		state := "incomplete"
+		if task.Status == "completed" {
+			state = "complete"
+		}
+		var updated checkItem
+		if err := p.call(ctx, http.MethodPut, "/cards/"+cardID+"/checkItem/"+id, url.Values{"name": {task.Title}, "state": {state}}, &updated); err != nil {
+			return nil, err
+		}
+		return itemTask(card{ID: cardID}, checklist{ID: checklistID}, updated, 0), nil
+	}
+	params := url.Values{
+		"name":        {task.Title},
+		"desc":        {task.Notes},
+		"due":         {task.Due},
+		"dueComplete": {fmt.Sprint(task.Status == "completed")},
+	}
+	if task.Due == "" {
+		params.Set("due", "null")
+	}
+	var updated card
+	if err := p.call(ctx, http.MethodPut, "/cards/"+task.ID, params, &updated); err != nil {
+		return nil, err
+	}
+	return cardTask(updated, 0), nil
+}
+
+// Move puts a card after previous, in the destination list when it is
+// set, or a checklist item after previous within its card. Cards can't
+// become checklist items or the other way round.
+func (p *Provider) Move(ctx context.Context, listID, taskID, parent, previous, destination string) (*todo.Task, error) {
+	if cardID, checklistID, id, ok := splitItemID(taskID); ok {
+		if parent != cardID {
+			return nil, fmt.Errorf("moving checklist items to another card is %w", backend.ErrUnsupported)
+		}
+		cards, err := p.cards(ctx, listID)
+		if err != nil {
+			return nil, err
+		}
+		var siblings []sibling
+		for _, c := range cards {
+			if c.ID != cardID {
+				continue
+			}
+			for _, cl := range c.Checklists {
+				for _, item := range cl.CheckItems {
+					if cl.ID == checklistID && item.ID != id {
+						siblings = append(siblings, sibling{id: itemID(c.ID, cl.ID, item.ID), pos: item.Pos})
+					}
+				}
+			}
+		}
+		var moved checkItem
+		if err := p.call(ctx, http.MethodPut, "/cards/"+cardID+"/checkItem/"+id, url.Values{"pos": {position(siblings, previous)}}, &moved); err != nil {
+			return nil, err
+		}
+		return itemTask(card{ID: cardID}, checklist{ID: checklistID}, moved, 0), nil
+	}
+	if parent != "" {
+		return nil, fmt.Errorf("turning cards into checklist items is %w", backend.ErrUnsupported)
+	}
+
+	target := listID
+	if destination != "" {
+		target = destination
+	}
+	cards, err := p.cards(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	params := url.Values{"pos": {position(cardPositions(cards, taskID), previous)}}
+	if target != listID {
+		params.Set("idList", target)
+	}
+	var moved card
+	if err := p.call(ctx, http.MethodPut, "/cards/"+taskID, params, &moved); err != nil {
+		return nil, err
+	}
+	return cardTask(moved, 0), nil
+}
+
+// Capabilities reports that cards keep their order and have checklist items
+func (p *Provider) Capabilities(listID string) backend.Capabilities {
+	return backend.Capabilities{Ordering: true, Subtasks: true}
+}
+
+// Delete deletes a card or a checklist item
+func (p *Provider) Delete(ctx context.Context, listID, taskID string) error {
+	if _, checklistID, id, ok := splitItemID(taskID); ok {
+		return p.call(ctx, http.MethodDelete, "/checklists/"+checklistID+"/checkItems/"+id, nil, nil)
+	}
+	return p.call(ctx, http.MethodDelete, "/cards/"+taskID, nil, nil)
+}
+
+// sibling is a card or checklist item with its position
+type sibling struct {
+	id  string
+	pos float64
+}
+
+// cardPositions returns the positions of cards, leaving out the one with
+// ID skip
+func cardPositions(cards []card, skip string) []sibling {
+	var siblings []sibling
+	for _, c := range cards {
+		if c.ID != skip {
+			siblings = append(siblings, sibling{id: c.ID, pos: c.Pos})
+		}
+	}
+	return siblings
+}
+
+// position returns the pos that puts a card or item after previous among
+// siblings, which are in order: between previous and the one after it, or
+// at the top without previous
+func position(siblings []sibling, previous string) string {
+	if previous == "" {
+		return "top"
+	}
+	for i, s := range siblings {
+		if s.id != previous {
+			continue
+		}
+		if i == len(siblings)-1 {
+			return "bottom"
+		}
+		return fmt.Sprint((s.pos + siblings[i+1].pos) / 2)
+	}
+	return "bottom"
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"zap/bot"
+	"zap/config"
+	"zap/tasks"
+	"zap/todo"
+)
+
+// botTasksShown caps the tasks /tasks shows per list
+const botTasksShown = 10
+
+// botCommands are the commands the bot answers
+var botCommands = []bot.Spec{
+	{Name: "add", Description: "Add a task to the inbox", Arg: "title", ArgDescription: "The task", ArgRequired: true},
+	{Name: "next", Description: "Pick the task to work on now"},
+	{Name: "tasks", Description: "Show the top tasks of each list", Arg: "list", ArgDescription: "Only this list"},
+	{Name: "prioritize", Description: "Rank the lists now"},
+	{Name: "help", Description: "Show the commands"},
+}
+
+// runBot answers the commands sent to the profile's Telegram or Discord
+// bot until interrupted
+func runBot(args []string) {
+	flags := flag.NewFlagSet("bot", flag.ExitOnError)
+	runOpts := registerRunFlags(flags)
+	addr := flags.String("addr", "localhost:8081", "Address to serve the Discord interactions endpoint on")
+	register := flags.Bool("register", false, "Register the slash commands of the Discord application and exit")
+	healthAddr := flags.String("health", "", "Serve /healthz and /readyz on this address, e.g. :8080 in a container")
+	flags.Parse(args)
+
+	// Nobody is there to confirm changes; deleting tasks still takes --force
+	*runOpts.yes = true
+	*runOpts.plain = true
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	app, err := runOpts.newApp(ctx, flags)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer app.Close()
+	settings := app.profile.Bot
+	if settings == nil {
+		log.Fatal("the profile has no bot section; add one with the kind of bot and who may use it")
+	}
+
+	b := &botHandler{app: app, allow: settings.Allow}
+	switch settings.Kind {
+	case config.BotTelegram:
+		if *register {
+			log.Fatal("Telegram bots take any command; --register is only for Discord")
+		}
+		if *healthAddr != "" {
+			go func() {
+				if err := b.status.serve(ctx, *healthAddr); err != nil {
+					log.Fatal(err)
+				}
+			}()
+		}
+		b.status.set(nil)
+		log.Println("Answering the Telegram bot's commands")
+		if err := bot.NewTelegram(settings.Token).Run(ctx, b.handle); err != nil {
+			log.Fatal(err)
+		}
+	case config.BotDiscord:
+		discord, err := bot.NewDiscord(ctx, settings.ApplicationID, settings.PublicKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *register {
+			if settings.Token == "" {
+				log.Fatal("registering commands needs the bot's token in bot.token")
+			}
+			if err := discord.Register(ctx, settings.Token, botCommands); err != nil {
+				log.Fatalf("Unable to register the commands: %v", err)
+			}
+			fmt.Printf("Registered %d commands\n", len(botCommands))
+			return
+		}
+		if err := b.serveDiscord(ctx, *addr, discord); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// botHandler answers bot commands with one app, one command at a time
+type botHandler struct {
+	mu     sync.Mutex
+	app    *app
+	allow  []string
+	status health
+}
+
+// serveDiscord serves the interactions endpoint, and health checks, until
+// ctx is done
+func (b *botHandler) serveDiscord(ctx context.Context, addr string, discord *bot.Discord) error {
+	b.status.set(nil)
+	mux := http.NewServeMux()
+	b.status.register(mux)
+	mux.Handle("POST /discord/interactions", discord.Handler(b.handle))
+
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Serving the Discord interactions endpoint at http://%s/discord/interactions", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// handle answers a command from an allowed chat or user
+func (b *botHandler) handle(ctx context.Context, cmd bot.Command) string {
+	if !slices.Contains(b.allow, cmd.Chat) && !slices.Contains(b.allow, cmd.User) {
+		log.Printf("Refused /%s from chat %s, user %s", cmd.Name, cmd.Chat, cmd.User)
+		return fmt.Sprintf("You may not use this bot. To allow it, add this chat (%s) or your user (%s) to the bot's allow list.", cmd.Chat, cmd.User)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	log.Printf("/%s from chat %s", cmd.Name, cmd.Chat)
+	var reply string
+	var err error
+	switch cmd.Name {
+	case "add":
+		reply, err = b.add(ctx, cmd.Args)
+	case "next":
+		if err = b.app.requireGemini(); err == nil {
+			reply, err = b.app.nextAction(ctx, b.app.profile.TargetLists)
+		}
+	case "tasks":
+		reply, err = b.tasks(cmd.Args)
+	case "prioritize":
+		reply, err = b.prioritize(ctx)
+	case "start", "help":
+		reply = botHelp()
+	default:
+		reply = fmt.Sprintf("Unknown command /%s\n\n%s", cmd.Name, botHelp())
+	}
+	if err != nil {
+		log.Printf("/%s failed: %v", cmd.Name, err)
+		return fmt.Sprintf("/%s failed: %v", cmd.Name, err)
+	}
+	return reply
+}
+
+// botHelp lists the commands
+func botHelp() string {
+	var help strings.Builder
+	for _, spec := range botCommands {
+		fmt.Fprintf(&help, "/%s", spec.Name)
+		switch {
+		case spec.Arg != "" && spec.ArgRequired:
+			fmt.Fprintf(&help, " %s", strings.ToUpper(spec.Arg))
+		case spec.Arg != "":
+			fmt.Fprintf(&help, " [%s]", strings.ToUpper(spec.Arg))
+		}
+		fmt.Fprintf(&help, " - %s\n", spec.Description)
+	}
+	return help.String()
+}
+
+// add adds a task to the top of the inbox
+func (b *botHandler) add(ctx context.Context, title string) (string, error) {
+	if title == "" {
+		return "What should the task be? Send /add followed by it, e.g. /add Call the bank", nil
+	}
+	inbox, err := b.app.service.GetTaskListByTitle(b.app.profile.Inbox)
+	if err != nil {
+		return "", err
+	}
+	if _, err := b.app.addTask(ctx, inbox, &todo.Task{Title: title, Status: "needsAction"}); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Added '%s' to %s", title, inbox.Title), nil
+}
+
+// tasks shows the first open top-level tasks of the target lists, or of one
+// list, with their due dates and latest zap priorities
+func (b *botHandler) tasks(listTitle string) (string, error) {
+	a := b.app
+	listTitles := a.profile.TargetLists
+	if listTitle != "" {
+		listTitles = []string{listTitle}
+	}
+	records, err := tasks.NewHistory(a.store, true).Records()
+	if err != nil {
+		return "", err
+	}
+	a.service.ResetCache()
+
+	var reply strings.Builder
+	for _, title := range listTitles {
+		taskList, err := a.service.GetTaskListByTitle(title)
+		if err != nil {
+			return "", err
+		}
+		listTasks, err := a.service.ListTasks(taskList.ID)
+		if err != nil {
+			return "", fmt.Errorf("error fetching tasks for list %s: %w", title, err)
+		}
+		var open []*todo.Task
+		for _, task := range tasks.NewTaskTree(listTasks).TopLevel() {
+			if task.Parent == "" && task.Status != "completed" && !a.filter.Excludes(task) {
+				open = append(open, task)
+			}
+		}
+		fmt.Fprintf(&reply, "%s (%d open)\n", taskList.Title, len(open))
+		for i, task := range open {
+			if i == botTasksShown {
+				fmt.Fprintf(&reply, "  and %d more\n", len(open)-botTasksShown)
+				break
+			}
+			fmt.Fprintf(&reply, "%d. %s", i+1, task.Title)
+			var details []string
+			if day, ok := a.clock.ParseDue(task.Due); ok {
+				details = append(details, "due "+day.Format("Mon 2006-01-02"))
+			}
+			if record, ok := records[task.ID]; ok {
+				details = append(details, fmt.Sprintf("priority %.0f", record.Priority))
+			}
+			if len(details) > 0 {
+				fmt.Fprintf(&reply, " (%s)", strings.Join(details, ", "))
+			}
+			reply.WriteString("\n")
+		}
+		reply.WriteString("\n")
+	}
+	return strings.TrimSpace(reply.String()), nil
+}
+
+// prioritize runs the profile and sums up what changed in each list
+func (b *botHandler) prioritize(ctx context.Context) (string, error) {
+	err := b.app.run(ctx)
+	b.status.set(err)
+	if err != nil {
+		return "", err
+	}
+	var reply strings.Builder
+	result := b.app.result
+	if result.DryRun {
+		reply.WriteString("Dry run: nothing was changed.\n")
+	}
+	for _, list := range result.Lists {
+		fmt.Fprintf(&reply, "%s: ranked %d tasks", list.Title, list.Tasks)
+		if list.RankedBy != "" {
+			fmt.Fprintf(&reply, " by %s", list.RankedBy)
+		}
+		fmt.Fprintf(&reply, ", %d moved\n", list.Moves)
+	}
+	if len(result.Lists) == 0 {
+		reply.WriteString("No lists were ranked.\n")
+	}
+	for _, failure := range result.Errors {
+		fmt.Fprintf(&reply, "Error: %s\n", failure)
+	}
+	return strings.TrimSpace(reply.String()), nil
+}
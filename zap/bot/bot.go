@@ -0,0 +1,59 @@
+// Package bot lets zap be used from chat apps: commands such as /add or
+// /next sent to a Telegram or Discord bot are answered with a reply.
+package bot
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// Command is a command sent to the bot, e.g. "/add Buy milk"
+type Command struct {
+	// Name is the command without its slash, e.g. "add"
+	Name string
+	// Args is the text after the command
+	Args string
+	// Chat is where the command was sent and User who sent it, as the
+	// chat app identifies them
+	Chat string
+	User string
+}
+
+// Handler answers a command with the text to reply with
+type Handler func(ctx context.Context, cmd Command) string
+
+// Parse reads a command from a message's text. Telegram appends the bot's
+// name to commands in groups, as in "/add@zap_bot Buy milk".
+func Parse(text string) (Command, bool) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "/") {
+		return Command{}, false
+	}
+	name, args, _ := strings.Cut(text[1:], " ")
+	name, _, _ = strings.Cut(name, "@")
+	if name == "" {
+		return Command{}, false
+	}
+	return Command{Name: strings.ToLower(name), Args: strings.TrimSpace(args)}, true
+}
+
+// truncate shortens a reply to the chat app's limit of max characters
+func truncate(text string, max int) string {
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	return string(runes[:max-1]) + "…"
+}
+
+// redactURL drops the address from an HTTP client error, for APIs that
+// take the bot's token in it
+func redactURL(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
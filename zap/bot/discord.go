@@ -0,0 +1,204 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// discordAPI is the Discord API's address
+	discordAPI = "https://discord.com/api/v10"
+	// discordMaxMessage is the longest message Discord sends
+	discordMaxMessage = 2000
+)
+
+// Interaction and response types of the Discord API
+const (
+	discordPing            = 1
+	discordCommand         = 2
+	discordPong            = 1
+	discordDeferredMessage = 5
+)
+
+// Spec describes a command for chat apps that list the commands a bot
+// takes, as Discord does for slash commands
+type Spec struct {
+	Name        string
+	Description string
+	// Arg names the command's text argument, if it takes one
+	Arg            string
+	ArgDescription string
+	ArgRequired    bool
+}
+
+// Discord is a Discord application whose slash commands are sent to an
+// interactions endpoint served by zap
+type Discord struct {
+	publicKey     ed25519.PublicKey
+	applicationID string
+	base          string
+	client        *http.Client
+	// ctx outlives interactions, whose replies are sent after answering
+	// them
+	ctx context.Context
+}
+
+// NewDiscord creates an application that verifies interactions with its
+// hex-encoded public key. Replies are sent until ctx is done.
+func NewDiscord(ctx context.Context, applicationID, publicKey string) (*Discord, error) {
+	key, err := hex.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("discord public key must be the %d-byte hex key of the application", ed25519.PublicKeySize)
+	}
+	return &Discord{
+		publicKey:     key,
+		applicationID: applicationID,
+		base:          discordAPI,
+		client:        &http.Client{Timeout: 30 * time.Second},
+		ctx:           ctx,
+	}, nil
+}
+
+// discordInteraction is the part of an interaction the bot reads
+type discordInteraction struct {
+	Type      int    `json:"type"`
+	Token     string `json:"token"`
+	ChannelID string `json:"channel_id"`
+	Member    *struct {
+		User discordUser `json:"user"`
+	} `json:"member"`
+	User *discordUser `json:"user"`
+	Data struct {
+		Name    string `json:"name"`
+		Options []struct {
+			Value interface{} `json:"value"`
+		} `json:"options"`
+	} `json:"data"`
+}
+
+type discordUser struct {
+	ID string `json:"id"`
+}
+
+// Handler returns the interactions endpoint. Commands are acknowledged at
+// once, as Discord requires an answer within three seconds, and the reply
+// follows when handle returns.
+func (d *Discord) Handler(handle Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, "unable to read the request", http.StatusBadRequest)
+			return
+		}
+		signature, err := hex.DecodeString(r.Header.Get("X-Signature-Ed25519"))
+		message := append([]byte(r.Header.Get("X-Signature-Timestamp")), body...)
+		if err != nil || len(signature) != ed25519.SignatureSize || !ed25519.Verify(d.publicKey, message, signature) {
+			http.Error(w, "invalid request signature", http.StatusUnauthorized)
+			return
+		}
+
+		var interaction discordInteraction
+		if err := json.Unmarshal(body, &interaction); err != nil {
+			http.Error(w, "invalid interaction", http.StatusBadRequest)
+			return
+		}
+		switch interaction.Type {
+		case discordPing:
+			writeDiscord(w, map[string]interface{}{"type": discordPong})
+			return
+		case discordCommand:
+		default:
+			http.Error(w, "unsupported interaction", http.StatusBadRequest)
+			return
+		}
+
+		cmd := Command{Name: interaction.Data.Name, Chat: interaction.ChannelID}
+		var args []string
+		for _, option := range interaction.Data.Options {
+			args = append(args, fmt.Sprint(option.Value))
+		}
+		cmd.Args = strings.Join(args, " ")
+		// Members send commands in servers, users in direct messages
+		if interaction.Member != nil {
+			cmd.User = interaction.Member.User.ID
+		} else if interaction.User != nil {
+			cmd.User = interaction.User.ID
+		}
+
+		writeDiscord(w, map[string]interface{}{"type": discordDeferredMessage})
+		go func() {
+			reply := truncate(handle(d.ctx, cmd), discordMaxMessage)
+			if err := d.reply(interaction.Token, reply); err != nil {
+				log.Printf("Unable to reply to /%s in Discord: %v", cmd.Name, err)
+			}
+		}()
+	})
+}
+
+// reply replaces the placeholder of an acknowledged interaction with the
+// reply
+func (d *Discord) reply(token, content string) error {
+	path := fmt.Sprintf("/webhooks/%s/%s/messages/@original", d.applicationID, token)
+	return d.call(d.ctx, http.MethodPatch, path, "", map[string]string{"content": content})
+}
+
+// Register sets the application's slash commands, which needs the bot's
+// token
+func (d *Discord) Register(ctx context.Context, token string, specs []Spec) error {
+	commands := make([]map[string]interface{}, len(specs))
+	for i, spec := range specs {
+		command := map[string]interface{}{"name": spec.Name, "description": spec.Description, "type": 1}
+		if spec.Arg != "" {
+			command["options"] = []map[string]interface{}{{
+				"name":        spec.Arg,
+				"description": spec.ArgDescription,
+				"type":        3, // a string
+				"required":    spec.ArgRequired,
+			}}
+		}
+		commands[i] = command
+	}
+	return d.call(ctx, http.MethodPut, fmt.Sprintf("/applications/%s/commands", d.applicationID), token, commands)
+}
+
+// call sends a request to the Discord API, as the bot when token is set
+func (d *Discord) call(ctx context.Context, method, path, token string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, d.base+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bot "+token)
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		// Interaction tokens are part of the address
+		return redactURL(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+// writeDiscord answers an interaction
+func writeDiscord(w http.ResponseWriter, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,131 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// telegramAPI is the Bot API's address
+	telegramAPI = "https://api.telegram.org"
+	// telegramMaxMessage is the longest message Telegram sends
+	telegramMaxMessage = 4096
+	// telegramPollTimeout is how long a poll waits for new messages
+	telegramPollTimeout = 50 * time.Second
+	// telegramRetry is how long to wait after a failed poll
+	telegramRetry = 10 * time.Second
+)
+
+// Telegram is a Telegram bot that polls for the messages sent to it
+type Telegram struct {
+	token  string
+	base   string
+	client *http.Client
+}
+
+// NewTelegram creates a bot with the token BotFather gave
+func NewTelegram(token string) *Telegram {
+	return &Telegram{token: token, base: telegramAPI, client: &http.Client{Timeout: telegramPollTimeout + 10*time.Second}}
+}
+
+// telegramUpdate is the part of an update the bot reads
+type telegramUpdate struct {
+	UpdateID int64 `json:"update_id"`
+	Message  *struct {
+		Text string `json:"text"`
+		Chat struct {
+			ID int64 `json:"id"`
+		} `json:"chat"`
+		From *struct {
+			ID int64 `json:"id"`
+		} `json:"from"`
+	} `json:"message"`
+}
+
+// Run answers the commands sent to the bot, one at a time, until ctx is
+// done
+func (t *Telegram) Run(ctx context.Context, handle Handler) error {
+	var offset int64
+	for {
+		var updates []telegramUpdate
+		err := t.call(ctx, "getUpdates", map[string]interface{}{
+			"offset":          offset,
+			"timeout":         int(telegramPollTimeout / time.Second),
+			"allowed_updates": []string{"message"},
+		}, &updates)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			log.Printf("Polling Telegram failed: %v", err)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(telegramRetry):
+			}
+			continue
+		}
+
+		for _, update := range updates {
+			// Updates are confirmed by asking for the ones after them
+			offset = update.UpdateID + 1
+			if update.Message == nil {
+				continue
+			}
+			cmd, ok := Parse(update.Message.Text)
+			if !ok {
+				continue
+			}
+			chat := strconv.FormatInt(update.Message.Chat.ID, 10)
+			cmd.Chat = chat
+			if update.Message.From != nil {
+				cmd.User = strconv.FormatInt(update.Message.From.ID, 10)
+			}
+			reply := truncate(handle(ctx, cmd), telegramMaxMessage)
+			if err := t.call(ctx, "sendMessage", map[string]interface{}{"chat_id": chat, "text": reply}, nil); err != nil {
+				log.Printf("Unable to reply in Telegram chat %s: %v", chat, err)
+			}
+		}
+	}
+}
+
+// call calls a Bot API method, decoding its result into result
+func (t *Telegram) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/bot%s/%s", t.base, t.token, method), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		// The error would show the token in the address
+		return fmt.Errorf("%s failed: %v", method, redactURL(err))
+	}
+	defer resp.Body.Close()
+
+	var reply struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return fmt.Errorf("%s failed: %s", method, resp.Status)
+	}
+	if !reply.OK {
+		return fmt.Errorf("%s failed: %s", method, reply.Description)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(reply.Result, result)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"zap/budget"
+	"zap/config"
+)
+
+// planBudget estimates what a run over targetLists needs and compares it
+// with what is left of today's budget. When the run doesn't fit it is
+// refused, or with on_exceed: trim, subtask creation and then whole lists
+// are dropped from the end until it does. It returns the lists to run.
+func (a *app) planBudget(targetLists []string) ([]string, error) {
+	if a.budget == nil || a.replaying {
+		return targetLists, nil
+	}
+	a.skipSubtasks = nil
+
+	remaining, err := a.budget.Remaining()
+	if err != nil {
+		return nil, err
+	}
+	estimates := make([]budget.ListEstimate, 0, len(targetLists))
+	var total budget.Usage
+	for _, listTitle := range targetLists {
+		taskList, err := a.service.GetTaskListByTitle(listTitle)
+		if err != nil {
+			return nil, fmt.Errorf("error finding task list %s: %w", listTitle, err)
+		}
+		listTasks, err := a.service.ListTasks(taskList.ID)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching tasks for list %s: %w", listTitle, err)
+		}
+
+		estimate := budget.EstimateList(listTitle, listTasks, a.breakdown(listTitle).Max)
+		// Dry runs write nothing, and only calls to the model cost tokens
+		if a.dryRun {
+			estimate.Rank.Writes, estimate.Subtasks.Writes = 0, 0
+		}
+		if a.gemini == nil || a.profile.Prioritizer == config.PrioritizerHeuristic {
+			estimate.Rank.Tokens = 0
+		} else {
+			estimate.Rank.Tokens *= a.gemini.EnsembleSize()
+		}
+		if a.gemini == nil {
+			estimate.Subtasks = budget.Usage{}
+		}
+		estimates = append(estimates, estimate)
+		total = total.Plus(estimate.Total())
+	}
+	if total.Within(remaining) {
+		return targetLists, nil
+	}
+
+	if a.profile.Budget.OnExceed != config.BudgetTrim {
+		return nil, &exitError{code: exitBudget, err: fmt.Errorf("run refused: it needs about %s, but today's budget only has %s left; raise the profile's budget or set on_exceed: trim",
+			describeUsage(total, remaining), describeUsage(remaining, remaining))}
+	}
+
+	// Subtasks go first since the lists are still ranked without them
+	for i := len(estimates) - 1; i >= 0 && !total.Within(remaining); i-- {
+		if estimates[i].Subtasks.IsZero() {
+			continue
+		}
+		total = total.Minus(estimates[i].Subtasks)
+		if a.skipSubtasks == nil {
+			a.skipSubtasks = make(map[string]bool)
+		}
+		a.skipSubtasks[estimates[i].List] = true
+		a.result.Skipped = append(a.result.Skipped, fmt.Sprintf("subtasks in %s (about %s)", estimates[i].List, describeUsage(estimates[i].Subtasks, remaining)))
+	}
+	kept := len(estimates)
+	for kept > 0 && !total.Within(remaining) {
+		kept--
+		total = total.Minus(estimates[kept].Rank)
+		if !a.skipSubtasks[estimates[kept].List] {
+			total = total.Minus(estimates[kept].Subtasks)
+		}
+		a.result.Skipped = append(a.result.Skipped, fmt.Sprintf("list %s (about %s)", estimates[kept].List, describeUsage(estimates[kept].Rank, remaining)))
+	}
+	if kept == 0 {
+		return nil, &exitError{code: exitBudget, err: fmt.Errorf("run refused: today's budget only has %s left, too little for any list", describeUsage(remaining, remaining))}
+	}
+
+	a.progress.Printf("Over today's budget; skipping:\n  %s\n", strings.Join(a.result.Skipped, "\n  "))
+	return targetLists[:kept], nil
+}
+
+// describeUsage names the writes and tokens in usage, leaving out the
+// kinds that limits don't cap
+func describeUsage(usage, limits budget.Usage) string {
+	var parts []string
+	if limits.Writes != budget.Unlimited {
+		parts = append(parts, fmt.Sprintf("%d task writes", usage.Writes))
+	}
+	if limits.Tokens != budget.Unlimited {
+		parts = append(parts, fmt.Sprintf("%d LLM tokens", usage.Tokens))
+	}
+	if len(parts) == 0 {
+		return "nothing"
+	}
+	return strings.Join(parts, " and ")
+}
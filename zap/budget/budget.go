@@ -0,0 +1,201 @@
+package budget
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+
+	"zap/config"
+	"zap/datetime"
+	"zap/llm"
+	"zap/store"
+	"zap/tasks"
+)
+
+// bucket is the store bucket holding each day's usage, keyed by date
+const bucket = "budget"
+
+// Unlimited is the remaining amount for a limit that isn't set
+const Unlimited = math.MaxInt
+
+// ErrExhausted is returned for writes and requests beyond today's budget
+var ErrExhausted = errors.New("daily budget exhausted")
+
+// Usage counts Tasks API writes and LLM tokens
+type Usage struct {
+	Writes int `json:"writes"`
+	Tokens int `json:"tokens"`
+}
+
+// Plus returns the sum of two usages
+func (u Usage) Plus(other Usage) Usage {
+	return Usage{Writes: u.Writes + other.Writes, Tokens: u.Tokens + other.Tokens}
+}
+
+// Minus returns u without other
+func (u Usage) Minus(other Usage) Usage {
+	return Usage{Writes: u.Writes - other.Writes, Tokens: u.Tokens - other.Tokens}
+}
+
+// Within reports whether u fits in remaining
+func (u Usage) Within(remaining Usage) bool {
+	return u.Writes <= remaining.Writes && u.Tokens <= remaining.Tokens
+}
+
+// IsZero reports whether u counts nothing
+func (u Usage) IsZero() bool {
+	return u == Usage{}
+}
+
+// Budget tracks what runs spend per day in the state file and enforces the
+// profile's daily limits. Days start at midnight in the user's time zone.
+type Budget struct {
+	store  *store.Store
+	clock  *datetime.Clock
+	limits config.Budget
+
+	mu sync.Mutex
+}
+
+// New creates a budget for limits, counting usage in st
+func New(st *store.Store, clock *datetime.Clock, limits config.Budget) *Budget {
+	return &Budget{store: st, clock: clock, limits: limits}
+}
+
+// today is the store key for the current day
+func (b *Budget) today() string {
+	return b.clock.Today().Format("2006-01-02")
+}
+
+// Spent returns what has been used today
+func (b *Budget) Spent() (Usage, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.spent()
+}
+
+func (b *Budget) spent() (Usage, error) {
+	var usage Usage
+	_, err := b.store.Get(bucket, b.today(), &usage)
+	return usage, err
+}
+
+// Remaining returns what is left of today's budget. Limits that aren't set
+// have Unlimited left.
+func (b *Budget) Remaining() (Usage, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.remaining()
+}
+
+func (b *Budget) remaining() (Usage, error) {
+	spent, err := b.spent()
+	if err != nil {
+		return Usage{}, err
+	}
+	left := func(limit, used int) int {
+		if limit <= 0 {
+			return Unlimited
+		}
+		return max(limit-used, 0)
+	}
+	return Usage{Writes: left(b.limits.TaskWrites, spent.Writes), Tokens: left(b.limits.LLMTokens, spent.Tokens)}, nil
+}
+
+// Spend adds usage to today's total. Earlier days are dropped, since only
+// today counts against the limits.
+func (b *Budget) Spend(usage Usage) error {
+	if usage.IsZero() {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	spent, err := b.spent()
+	if err != nil {
+		return err
+	}
+	today := b.today()
+	for _, day := range b.store.Keys(bucket) {
+		if day != today {
+			if err := b.store.Delete(bucket, day); err != nil {
+				return err
+			}
+		}
+	}
+	return b.store.Put(bucket, today, spent.Plus(usage))
+}
+
+// Writer counts the writes that go through it and fails the ones beyond
+// today's limit
+type Writer struct {
+	writer tasks.Writer
+	budget *Budget
+}
+
+// WrapWriter returns a writer that charges successful writes to budget
+func WrapWriter(writer tasks.Writer, budget *Budget) *Writer {
+	return &Writer{writer: writer, budget: budget}
+}
+
+// Apply forwards as many mutations as the budget allows and fails the rest
+// with ErrExhausted
+func (w *Writer) Apply(ctx context.Context, mutations []tasks.Mutation) []tasks.BatchResult {
+	remaining, err := w.budget.Remaining()
+	if err != nil {
+		return failAll(mutations, 0, err)
+	}
+	allowed := min(len(mutations), remaining.Writes)
+
+	results := append(w.writer.Apply(ctx, mutations[:allowed]), failAll(mutations, allowed, ErrExhausted)...)
+	written := 0
+	for _, result := range results[:allowed] {
+		if result.Err == nil {
+			written++
+		}
+	}
+	if err := w.budget.Spend(Usage{Writes: written}); err != nil {
+		return failAll(mutations, 0, fmt.Errorf("unable to record budget: %v", err))
+	}
+	return results
+}
+
+// failAll returns failed results for the mutations from index from on
+func failAll(mutations []tasks.Mutation, from int, err error) []tasks.BatchResult {
+	results := make([]tasks.BatchResult, 0, len(mutations)-from)
+	for i := from; i < len(mutations); i++ {
+		results = append(results, tasks.BatchResult{Index: i, Err: err})
+	}
+	return results
+}
+
+// Provider charges the tokens of every request to a budget and refuses
+// requests once today's tokens are used up
+type Provider struct {
+	llm.Provider
+	budget *Budget
+}
+
+// WrapProvider returns a provider that charges its requests to budget
+func WrapProvider(provider llm.Provider, budget *Budget) *Provider {
+	return &Provider{Provider: provider, budget: budget}
+}
+
+// Generate forwards the request unless the budget is exhausted
+func (p *Provider) Generate(ctx context.Context, req llm.Request) (llm.Response, error) {
+	remaining, err := p.budget.Remaining()
+	if err != nil {
+		return llm.Response{}, err
+	}
+	if remaining.Tokens == 0 {
+		return llm.Response{}, fmt.Errorf("%w: no LLM tokens left today", ErrExhausted)
+	}
+
+	resp, err := p.Provider.Generate(ctx, req)
+	if spendErr := p.budget.Spend(Usage{Tokens: resp.Usage.InputTokens + resp.Usage.OutputTokens}); spendErr != nil {
+		return resp, fmt.Errorf("unable to record budget: %v", spendErr)
+	}
+	return resp, err
+}
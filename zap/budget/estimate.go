@@ -0,0 +1,75 @@
+package budget
+
+import (
+	"zap/tasks"
+	"zap/todo"
+)
+
+// Rough sizes used to estimate a run before it starts
+const (
+	// charsPerToken converts task text to tokens
+	charsPerToken = 4
+	// promptTokens covers the instructions around the tasks in each prompt
+	promptTokens = 500
+	// taskTokens covers the fields sent with each task besides its text
+	taskTokens = 30
+	// rankAnswerTokens is the model's answer per ranked task
+	rankAnswerTokens = 50
+	// subtaskAnswerTokens is the model's answer per subtask created
+	subtaskAnswerTokens = 25
+)
+
+// ListEstimate is the expected cost of ranking one list and of creating
+// its subtasks. Estimates err on the high side: every task may move and
+// every task without subtasks may get the most the prompt allows.
+type ListEstimate struct {
+	List     string
+	Rank     Usage
+	Subtasks Usage
+}
+
+// Total returns the cost of both steps
+func (e ListEstimate) Total() Usage {
+	return e.Rank.Plus(e.Subtasks)
+}
+
+// EstimateList estimates the cost of a run over a list's tasks, where up
+// to maxSubtasks subtasks are created per task
+func EstimateList(title string, listTasks []*todo.Task, maxSubtasks int) ListEstimate {
+	tree := tasks.NewTaskTree(listTasks)
+	estimate := ListEstimate{List: title}
+
+	var ranked, brokenDown []*todo.Task
+	for _, node := range tree.Roots {
+		if node.Task.Parent != "" {
+			continue
+		}
+		ranked = append(ranked, node.Task)
+		if len(node.Children) == 0 {
+			brokenDown = append(brokenDown, node.Task)
+		}
+	}
+
+	if len(ranked) > 0 {
+		estimate.Rank = Usage{
+			Writes: len(ranked),
+			Tokens: promptTokens + promptSize(ranked) + rankAnswerTokens*len(ranked),
+		}
+	}
+	if len(brokenDown) > 0 {
+		estimate.Subtasks = Usage{
+			Writes: maxSubtasks * len(brokenDown),
+			Tokens: promptTokens + promptSize(brokenDown) + subtaskAnswerTokens*maxSubtasks*len(brokenDown),
+		}
+	}
+	return estimate
+}
+
+// promptSize estimates the tokens tasks take up in a prompt
+func promptSize(listTasks []*todo.Task) int {
+	size := 0
+	for _, task := range listTasks {
+		size += taskTokens + (len(task.Title)+len(task.Notes))/charsPerToken
+	}
+	return size
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"zap/caldav"
+	"zap/ics"
+	"zap/tasks"
+)
+
+// runCalDAV mirrors the lists to the profile's CalDAV server without
+// running prioritization
+func runCalDAV(args []string) {
+	flags := flag.NewFlagSet("caldav", flag.ExitOnError)
+	runOpts := registerRunFlags(flags)
+	var listTitles listFlag
+	flags.Var(&listTitles, "list", "Task list to mirror (repeatable; default: the profile's target lists)")
+	flags.Parse(args)
+
+	ctx := context.Background()
+	app, err := runOpts.newApp(ctx, flags)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer app.Close()
+	if app.profile.CalDAV == nil {
+		log.Fatal("the profile has no caldav section; add one with the server's username and password")
+	}
+	if len(listTitles) == 0 {
+		listTitles = app.profile.TargetLists
+	}
+
+	if err := app.mirror(ctx, listTitles); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// mirrorCalDAV mirrors the lists after a run that applied its changes.
+// Failures are recorded without failing the run.
+func (a *app) mirrorCalDAV(ctx context.Context, listTitles []string) {
+	if a.profile.CalDAV == nil || a.dryRun || a.replaying {
+		return
+	}
+	if err := a.mirror(ctx, listTitles); err != nil {
+		log.Printf("Error mirroring to CalDAV: %v", err)
+		a.result.fail(fmt.Errorf("caldav: %v", err))
+	}
+}
+
+// mirror makes the to-do lists on the CalDAV server the same as the lists,
+// creating the server's lists that don't exist yet. Tasks keep their zap
+// ranking as the to-dos' priority. Dry runs only count the changes.
+func (a *app) mirror(ctx context.Context, listTitles []string) error {
+	settings := a.profile.CalDAV
+	client, err := caldav.NewClient(settings.URL, settings.Username, settings.Password)
+	if err != nil {
+		return err
+	}
+	collections, err := client.Collections(ctx)
+	if err != nil {
+		return err
+	}
+	records, err := tasks.NewHistory(a.store, true).Records()
+	if err != nil {
+		return err
+	}
+	mirror := caldav.NewMirror(client, a.store, a.dryRun)
+
+	for _, listTitle := range listTitles {
+		name := settings.Lists[listTitle]
+		if name == "" {
+			name = listTitle
+		}
+		taskList, err := a.service.GetTaskListByTitle(listTitle)
+		if err != nil {
+			return err
+		}
+		listTasks, err := a.service.ListAllTasks(ctx, taskList.ID)
+		if err != nil {
+			return fmt.Errorf("error fetching tasks for list %s: %w", listTitle, err)
+		}
+
+		var collection *caldav.Collection
+		for i := range collections {
+			if collections[i].Name == name {
+				collection = &collections[i]
+				break
+			}
+		}
+		if collection == nil {
+			if a.dryRun {
+				a.progress.Printf("Would create list %s on the CalDAV server\n", name)
+				continue
+			}
+			created, err := client.CreateCollection(ctx, name)
+			if err != nil {
+				return fmt.Errorf("creating list %s: %v", name, err)
+			}
+			collections = append(collections, created)
+			collection = &created
+		}
+
+		var items []caldav.Item
+		for _, task := range a.filter.Keep(listTasks) {
+			if task.Deleted || task.Hidden {
+				continue
+			}
+			todo := ics.Todo{
+				Summary:     task.Title,
+				Description: a.namespace.User(task.Notes),
+				URL:         task.WebViewLink,
+			}
+			if day, ok := a.clock.ParseDue(task.Due); ok {
+				todo.Due = day
+			}
+			if record, ok := records[task.ID]; ok {
+				todo.Priority = reminderPriority(record.Priority)
+			}
+			if task.Status == "completed" {
+				todo.Completed, err = time.Parse(time.RFC3339, task.Completed)
+				if err != nil {
+					todo.Completed = a.clock.Now()
+				}
+			}
+			items = append(items, caldav.Item{TaskID: task.ID, ParentID: task.Parent, Todo: todo})
+		}
+
+		written, deleted, err := mirror.Sync(ctx, *collection, items)
+		if err != nil {
+			return fmt.Errorf("mirroring %s: %v", listTitle, err)
+		}
+		if written > 0 || deleted > 0 {
+			a.progress.Printf("Mirrored %s to %s: %d written, %d deleted\n", listTitle, name, written, deleted)
+		}
+	}
+	return nil
+}
+
+// reminderPriority turns a zap priority into an iCalendar one, which
+// Reminders shows as high (1), medium (5) or low (9)
+func reminderPriority(priority float64) int {
+	switch {
+	case priority >= 80:
+		return 1
+	case priority >= 50:
+		return 5
+	default:
+		return 9
+	}
+}
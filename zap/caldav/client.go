@@ -0,0 +1,251 @@
+// Package caldav mirrors task lists into the to-do lists of a CalDAV
+// server, such as Apple Reminders through iCloud.
+package caldav
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Collection is a list of to-dos on the server, a calendar collection
+type Collection struct {
+	URL  *url.URL
+	Name string
+}
+
+// Client talks to a CalDAV server with a username and password; iCloud
+// takes an app-specific password
+type Client struct {
+	base     *url.URL
+	username string
+	password string
+	http     *http.Client
+}
+
+// NewClient creates a client for the server at serverURL, which may be
+// the server itself or the calendar home holding the lists
+func NewClient(serverURL, username, password string) (*Client, error) {
+	base, err := url.Parse(serverURL)
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("invalid CalDAV url %q", serverURL)
+	}
+	return &Client{base: base, username: username, password: password, http: &http.Client{Timeout: 30 * time.Second}}, nil
+}
+
+// multistatus is the answer to PROPFIND, with the properties zap reads
+type multistatus struct {
+	Responses []struct {
+		Href      string `xml:"DAV: href"`
+		Propstats []struct {
+			Prop struct {
+				DisplayName  string `xml:"DAV: displayname"`
+				ResourceType struct {
+					Calendar *struct{} `xml:"urn:ietf:params:xml:ns:caldav calendar"`
+				} `xml:"DAV: resourcetype"`
+				Components struct {
+					Comps []struct {
+						Name string `xml:"name,attr"`
+					} `xml:"urn:ietf:params:xml:ns:caldav comp"`
+				} `xml:"urn:ietf:params:xml:ns:caldav supported-calendar-component-set"`
+				Principal struct {
+					Href string `xml:"DAV: href"`
+				} `xml:"DAV: current-user-principal"`
+				Home struct {
+					Href string `xml:"DAV: href"`
+				} `xml:"urn:ietf:params:xml:ns:caldav calendar-home-set"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+// Collections finds the to-do lists in the calendar home of the user, by
+// way of their principal unless the client's URL is the home already
+func (c *Client) Collections(ctx context.Context) ([]Collection, error) {
+	home, err := c.home(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ms, err := c.propfind(ctx, home, 1, `<d:displayname/><d:resourcetype/><c:supported-calendar-component-set/>`)
+	if err != nil {
+		return nil, err
+	}
+
+	var collections []Collection
+	for _, response := range ms.Responses {
+		for _, propstat := range response.Propstats {
+			prop := propstat.Prop
+			if prop.ResourceType.Calendar == nil {
+				continue
+			}
+			// Servers that don't say which components a calendar takes
+			// take them all
+			todos := len(prop.Components.Comps) == 0
+			for _, comp := range prop.Components.Comps {
+				todos = todos || strings.EqualFold(comp.Name, "VTODO")
+			}
+			if !todos {
+				continue
+			}
+			href, err := home.Parse(response.Href)
+			if err != nil {
+				continue
+			}
+			collections = append(collections, Collection{URL: href, Name: prop.DisplayName})
+		}
+	}
+	return collections, nil
+}
+
+// home returns the user's calendar home
+func (c *Client) home(ctx context.Context) (*url.URL, error) {
+	ms, err := c.propfind(ctx, c.base, 0, `<d:current-user-principal/><c:calendar-home-set/><d:resourcetype/>`)
+	if err != nil {
+		return nil, err
+	}
+	principal := c.base
+	for _, response := range ms.Responses {
+		for _, propstat := range response.Propstats {
+			if href := propstat.Prop.Home.Href; href != "" {
+				return c.base.Parse(href)
+			}
+			if href := propstat.Prop.Principal.Href; href != "" {
+				principal, err = c.base.Parse(href)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	if principal == c.base {
+		// Without a principal the URL is taken to be the home
+		return c.base, nil
+	}
+
+	ms, err = c.propfind(ctx, principal, 0, `<c:calendar-home-set/>`)
+	if err != nil {
+		return nil, err
+	}
+	for _, response := range ms.Responses {
+		for _, propstat := range response.Propstats {
+			if href := propstat.Prop.Home.Href; href != "" {
+				return principal.Parse(href)
+			}
+		}
+	}
+	return nil, fmt.Errorf("the CalDAV server didn't say where %s's calendars are", c.username)
+}
+
+// propfind asks for properties of target and, with depth 1, its members
+func (c *Client) propfind(ctx context.Context, target *url.URL, depth int, props string) (*multistatus, error) {
+	body := `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav"><d:prop>` + props + `</d:prop></d:propfind>`
+	resp, err := c.do(ctx, "PROPFIND", target, "application/xml; charset=utf-8", []byte(body), map[string]string{"Depth": fmt.Sprint(depth)})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, statusError("PROPFIND", target, resp)
+	}
+	var ms multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("unable to read the properties of %s: %v", target.Path, err)
+	}
+	return &ms, nil
+}
+
+// CreateCollection creates a to-do list named name in the calendar home
+func (c *Client) CreateCollection(ctx context.Context, name string) (Collection, error) {
+	home, err := c.home(ctx)
+	if err != nil {
+		return Collection{}, err
+	}
+	target, err := home.Parse(newUID() + "/")
+	if err != nil {
+		return Collection{}, err
+	}
+	var escaped bytes.Buffer
+	xml.EscapeText(&escaped, []byte(name))
+	body := `<?xml version="1.0" encoding="utf-8"?>
+<c:mkcalendar xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav"><d:set><d:prop><d:displayname>` + escaped.String() + `</d:displayname><c:supported-calendar-component-set><c:comp name="VTODO"/></c:supported-calendar-component-set></d:prop></d:set></c:mkcalendar>`
+	resp, err := c.do(ctx, "MKCALENDAR", target, "application/xml; charset=utf-8", []byte(body), nil)
+	if err != nil {
+		return Collection{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return Collection{}, statusError("MKCALENDAR", target, resp)
+	}
+	return Collection{URL: target, Name: name}, nil
+}
+
+// Put writes a to-do's calendar object to target
+func (c *Client) Put(ctx context.Context, target *url.URL, data []byte) error {
+	resp, err := c.do(ctx, http.MethodPut, target, "text/calendar; charset=utf-8", data, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return statusError("PUT", target, resp)
+	}
+	return nil
+}
+
+// Delete removes the object at target; one that is already gone is fine
+func (c *Client) Delete(ctx context.Context, target *url.URL) error {
+	resp, err := c.do(ctx, http.MethodDelete, target, "", nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+		return statusError("DELETE", target, resp)
+	}
+	return nil
+}
+
+// do sends an authenticated request
+func (c *Client) do(ctx context.Context, method string, target *url.URL, contentType string, body []byte, headers map[string]string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	req.SetBasicAuth(c.username, c.password)
+	return c.http.Do(req)
+}
+
+// statusError describes a request the server refused
+func statusError(method string, target *url.URL, resp *http.Response) error {
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+	err := fmt.Errorf("%s %s: %s", method, target.Path, resp.Status)
+	if resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("%w; check the username and (app-specific) password", err)
+	}
+	if text := strings.TrimSpace(string(detail)); text != "" && !strings.HasPrefix(text, "<") {
+		return fmt.Errorf("%w: %s", err, text)
+	}
+	return err
+}
+
+// newUID returns a random identifier for a new to-do or list
+func newUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,149 @@
+package caldav
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"zap/ics"
+	"zap/store"
+)
+
+// bucket is the store bucket mapping tasks to the to-dos mirroring them
+const bucket = "caldav"
+
+// Mirrored is the to-do a task is mirrored as. Its UID stays the same for
+// as long as the task is mirrored to the same list.
+type Mirrored struct {
+	UID  string `json:"uid"`
+	Href string `json:"href"`
+	// List is the address of the list the to-do is in
+	List string `json:"list"`
+	// Hash identifies what was written last, so unchanged tasks aren't
+	// written again
+	Hash string `json:"hash"`
+}
+
+// Item is a task to mirror as a to-do. The to-do's UID and parent are
+// filled in by the mirror.
+type Item struct {
+	TaskID   string
+	ParentID string
+	Todo     ics.Todo
+}
+
+// Mirror keeps to-do lists on a CalDAV server the same as task lists, one
+// way: changes made on the server are overwritten
+type Mirror struct {
+	client *Client
+	store  *store.Store
+	now    func() time.Time
+	// dryRun counts the changes without making them
+	dryRun bool
+}
+
+// NewMirror creates a mirror writing with client and remembering the to-dos
+// in st
+func NewMirror(client *Client, st *store.Store, dryRun bool) *Mirror {
+	return &Mirror{client: client, store: st, now: time.Now, dryRun: dryRun}
+}
+
+// Sync makes the to-dos of a list mirror items: to-dos are added for new
+// tasks and written again for changed ones, and those of tasks no longer
+// among items are deleted. Completed tasks that were never mirrored are
+// left out. It returns how many to-dos were written and deleted.
+func (m *Mirror) Sync(ctx context.Context, collection Collection, items []Item) (written, deleted int, err error) {
+	list := collection.URL.String()
+	known := make(map[string]Mirrored)
+	for _, taskID := range m.store.Keys(bucket) {
+		var mirrored Mirrored
+		if found, err := m.store.Get(bucket, taskID, &mirrored); err == nil && found {
+			known[taskID] = mirrored
+		}
+	}
+
+	// Every task gets its UID first, so subtasks can name their parents'
+	uids := make(map[string]string, len(items))
+	for _, item := range items {
+		if mirrored, ok := known[item.TaskID]; ok && mirrored.List == list {
+			uids[item.TaskID] = mirrored.UID
+		} else if item.Todo.Completed.IsZero() {
+			uids[item.TaskID] = newUID()
+		}
+	}
+
+	for _, item := range items {
+		uid, ok := uids[item.TaskID]
+		if !ok {
+			continue
+		}
+		todo := item.Todo
+		todo.UID = uid
+		todo.Parent = uids[item.ParentID]
+
+		// The stamp changes every time, so it is left out of the hash
+		var unstamped bytes.Buffer
+		if err := ics.WriteTodo(&unstamped, todo, time.Time{}); err != nil {
+			return written, deleted, err
+		}
+		sum := sha256.Sum256(unstamped.Bytes())
+		hash := hex.EncodeToString(sum[:])
+		previous, wasMirrored := known[item.TaskID]
+		if wasMirrored && previous.List == list && previous.Hash == hash {
+			continue
+		}
+
+		target, err := collection.URL.Parse(uid + ".ics")
+		if err != nil {
+			return written, deleted, err
+		}
+		written++
+		if m.dryRun {
+			continue
+		}
+		// A task moved from another mirrored list leaves it
+		if wasMirrored && previous.List != list {
+			if err := m.delete(ctx, previous); err != nil {
+				return written, deleted, err
+			}
+		}
+		var data bytes.Buffer
+		if err := ics.WriteTodo(&data, todo, m.now()); err != nil {
+			return written, deleted, err
+		}
+		if err := m.client.Put(ctx, target, data.Bytes()); err != nil {
+			return written, deleted, err
+		}
+		if err := m.store.Put(bucket, item.TaskID, Mirrored{UID: uid, Href: target.String(), List: list, Hash: hash}); err != nil {
+			return written, deleted, err
+		}
+	}
+
+	for taskID, mirrored := range known {
+		if _, ok := uids[taskID]; ok || mirrored.List != list {
+			continue
+		}
+		deleted++
+		if m.dryRun {
+			continue
+		}
+		if err := m.delete(ctx, mirrored); err != nil {
+			return written, deleted, err
+		}
+		if err := m.store.Delete(bucket, taskID); err != nil {
+			return written, deleted, err
+		}
+	}
+	return written, deleted, nil
+}
+
+// delete removes a to-do from the server
+func (m *Mirror) delete(ctx context.Context, mirrored Mirrored) error {
+	target, err := m.client.base.Parse(mirrored.Href)
+	if err != nil {
+		return err
+	}
+	return m.client.Delete(ctx, target)
+}
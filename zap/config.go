@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"zap/config"
+	"zap/llm"
+	"zap/paths"
+	"zap/recurrence"
+)
+
+// runConfig checks the config file or scaffolds a new one
+func runConfig(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: zap config validate | zap config init [--force]")
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "validate":
+		runConfigValidate(args[1:])
+	case "init":
+		runConfigInit(args[1:])
+	default:
+		log.Fatalf("unknown config command %q (want validate or init)", args[0])
+	}
+}
+
+// runConfigValidate loads the config file as a run would and reports
+// what is wrong with it
+func runConfigValidate(args []string) {
+	flags := flag.NewFlagSet("config validate", flag.ExitOnError)
+	configPath := flags.String("config", "", configFlagUsage)
+	flags.Parse(args)
+
+	dirs, err := paths.Default()
+	if err != nil {
+		log.Fatal(err)
+	}
+	path := *configPath
+	if path == "" {
+		path = os.Getenv(config.EnvConfig)
+	}
+	if path == "" {
+		path = paths.Prefer(paths.ConfigFileName, dirs.ConfigFile())
+	}
+	cfg, err := config.Load(path, dirs)
+	if _, ok := os.LookupEnv(config.EnvConfigYAML); ok && errors.Is(err, fs.ErrNotExist) && *configPath == "" && os.Getenv(config.EnvConfig) == "" {
+		path = "$" + config.EnvConfigYAML
+		cfg, err = config.FromEnv(dirs)
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		log.Fatalf("no config file at %s; create one with 'zap config init'", path)
+	}
+	if err == nil {
+		err = checkConfig(cfg)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%s is valid: profiles %s\n", path, strings.Join(cfg.ProfileNames(), ", "))
+}
+
+// runConfigInit writes a commented starter config where runs will find it
+func runConfigInit(args []string) {
+	flags := flag.NewFlagSet("config init", flag.ExitOnError)
+	configPath := flags.String("config", "", "Where to write the config (default: zap.yaml in the user config directory)")
+	force := flags.Bool("force", false, "Replace an existing config file")
+	flags.Parse(args)
+
+	path := *configPath
+	if path == "" {
+		dirs, err := paths.Default()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := dirs.Ensure(); err != nil {
+			log.Fatal(err)
+		}
+		path = dirs.ConfigFile()
+	} else if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		log.Fatal(err)
+	}
+	if err := config.WriteStarter(path, *force); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Wrote %s; edit it, then check it with 'zap config validate'\n", path)
+}
+
+// checkConfig checks what the config package can't itself: recurring
+// schedules and LLM providers, which other packages define
+func checkConfig(cfg *config.Config) error {
+	for _, name := range cfg.ProfileNames() {
+		profile := cfg.Profiles[name]
+		for _, task := range profile.Recurring {
+			if _, err := recurrence.ParseRule(task.Every); err != nil {
+				return fmt.Errorf("profile %s: recurring task %q: %v", name, task.Title, err)
+			}
+		}
+		if err := llm.Check(profile.LLM); err != nil {
+			return fmt.Errorf("profile %s: llm: %v", name, err)
+		}
+		if profile.Experiment != nil && profile.Experiment.LLM != nil {
+			if err := llm.Check(*profile.Experiment.LLM); err != nil {
+				return fmt.Errorf("profile %s: experiment %s: llm: %v", name, profile.Experiment.Name, err)
+			}
+		}
+		if profile.Ensemble != nil {
+			for i, cfg := range profile.Ensemble.LLMs {
+				if err := llm.Check(cfg); err != nil {
+					return fmt.Errorf("profile %s: ensemble llm %d: %v", name, i+1, err)
+				}
+			}
+		}
+	}
+	return nil
+}
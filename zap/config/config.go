@@ -0,0 +1,957 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"zap/paths"
+)
+
+const (
+	// BackendGoogleTasks is the user's Google Tasks
+	BackendGoogleTasks = "google-tasks"
+	// BackendTrello is a Trello board, whose lists and cards are task lists
+	// and tasks
+	BackendTrello = "trello"
+	// BackendAsana is the sections of Asana projects and the user's My Tasks
+	BackendAsana = "asana"
+	// BackendGitHub is the open issues of a GitHub repository
+	BackendGitHub = "github"
+	// BackendFiles is local Markdown and todo.txt files
+	BackendFiles = "files"
+)
+
+const (
+	// AuthServiceAccount impersonates the profile's user with a service account
+	AuthServiceAccount = "service-account"
+	// AuthOAuth acts as the user who signed in with 'zap login'
+	AuthOAuth = "oauth"
+)
+
+const (
+	// PrioritizerGemini ranks tasks with Gemini, falling back to the heuristic
+	PrioritizerGemini = "gemini"
+	// PrioritizerHeuristic ranks tasks by due date, markers and tags only
+	PrioritizerHeuristic = "heuristic"
+)
+
+const (
+	// ModeReorder moves tasks into their ranked order
+	ModeReorder = "reorder"
+	// ModeSuggest never moves tasks; ranks are surfaced as annotations
+	ModeSuggest = "suggest"
+)
+
+const (
+	// BudgetRefuse stops a run that would go over the daily budget
+	BudgetRefuse = "refuse"
+	// BudgetTrim drops subtask creation, then whole lists, until a run fits
+	BudgetTrim = "trim"
+)
+
+const (
+	// BotTelegram polls a Telegram bot for commands
+	BotTelegram = "telegram"
+	// BotDiscord answers a Discord application's slash commands
+	BotDiscord = "discord"
+)
+
+// DefaultProfileName is used when the config file doesn't exist
+const DefaultProfileName = "default"
+
+// Config is the top-level zap configuration file
+type Config struct {
+	DefaultProfile string              `yaml:"default_profile"`
+	Profiles       map[string]*Profile `yaml:"profiles"`
+	// Tenants are the Workspace domains zap serve serves, by name
+	Tenants map[string]*Tenant `yaml:"tenants"`
+	// Rules are the organization's rules for the model, e.g. "Customer
+	// escalations come before internal work". Every profile's prompts get
+	// them, ahead of the profile's own rules.
+	Rules []string `yaml:"rules"`
+}
+
+// Profile holds the credentials and targets for a single account
+type Profile struct {
+	Auth         string   `yaml:"auth"`
+	Credentials  string   `yaml:"credentials"`
+	ClientSecret string   `yaml:"client_secret"`
+	TokenFile    string   `yaml:"token_file"`
+	User         string   `yaml:"user"`
+	Backend      string   `yaml:"backend"`
+	TargetLists  []string `yaml:"target_lists"`
+	Scopes       []string `yaml:"scopes"`
+	StateFile    string   `yaml:"state_file"`
+	TemplateDir  string   `yaml:"template_dir"`
+	Timezone     string   `yaml:"timezone"`
+	Prioritizer  string   `yaml:"prioritizer"`
+	Pinned       []string `yaml:"pinned"`
+	Mode         string   `yaml:"mode"`
+	Annotate     string   `yaml:"annotate"`
+	SubtaskOrder string   `yaml:"subtask_order"`
+	NoteLog      []string `yaml:"note_log"`
+	Namespace    string   `yaml:"namespace"`
+	SnoozeList   string   `yaml:"snooze_list"`
+	Inbox        string   `yaml:"inbox"`
+	TitleCleanup bool     `yaml:"title_cleanup"`
+	Language     string   `yaml:"language"`
+	Rules        []string `yaml:"rules"`
+
+	Recurring  []RecurringTask `yaml:"recurring"`
+	Escalation *Escalation     `yaml:"escalation"`
+	WIP        *WIP            `yaml:"wip"`
+	Stability  *Stability      `yaml:"stability"`
+	Ensemble   *Ensemble       `yaml:"ensemble"`
+	Subtasks   Subtasks        `yaml:"subtasks"`
+	Filters    *Filters        `yaml:"filters"`
+	Experiment *Experiment     `yaml:"experiment"`
+	Notifier   Notifier        `yaml:"notifier"`
+	LLM        LLM             `yaml:"llm"`
+	Audit      *Audit          `yaml:"audit"`
+	Redact     *Redact         `yaml:"redact"`
+	Truncate   *Truncate       `yaml:"truncate"`
+	Budget     *Budget         `yaml:"budget"`
+	Sheets     *Sheets         `yaml:"sheets"`
+	Calendar   *Calendar       `yaml:"calendar"`
+	Gmail      *Gmail          `yaml:"gmail"`
+	Prep       *Prep           `yaml:"prep"`
+	Bot        *Bot            `yaml:"bot"`
+	CalDAV     *CalDAV         `yaml:"caldav"`
+	Team       []Teammate      `yaml:"team"`
+	Trello     *Trello         `yaml:"trello"`
+	Asana      *Asana          `yaml:"asana"`
+	GitHub     *GitHub         `yaml:"github"`
+	Files      *Files          `yaml:"files"`
+	HTTP       *HTTP           `yaml:"http"`
+}
+
+// HTTP configures the connections to Google APIs and hosted LLM providers,
+// for networks that go through a proxy or trust a certificate authority of
+// their own. Proxy is a URL such as http://proxy.corp:3128; without it the
+// HTTPS_PROXY variable applies. NoProxy lists hosts reached directly, along
+// with NO_PROXY's. CABundle is a PEM file of certificates trusted besides
+// the system's. Timeout bounds how long each request waits for an answer,
+// LLM requests included.
+type HTTP struct {
+	Proxy    string        `yaml:"proxy"`
+	NoProxy  []string      `yaml:"no_proxy"`
+	CABundle string        `yaml:"ca_bundle"`
+	Timeout  time.Duration `yaml:"timeout"`
+}
+
+// WIP caps how many open tasks each list in Limits may hold, by title.
+// Runs move the lowest-ranked tasks over a limit to Overflow (the first
+// default target list unless set); suggest-only runs flag them instead.
+type WIP struct {
+	Limits   map[string]int `yaml:"limits"`
+	Overflow string         `yaml:"overflow"`
+}
+
+// Stability leaves tasks where they are unless a run would move them by
+// more than MinMove places or into another priority band (P1 for scores of
+// 75 and up, down to P4 below 25), so rankings that shift a little between
+// runs don't reorder the list in the Tasks apps every time. A task's score
+// only changes once it differs from the last run's by more than Margin
+// points; until then the last one is kept.
+type Stability struct {
+	MinMove int     `yaml:"min_move"`
+	Margin  float64 `yaml:"margin"`
+}
+
+// Filters keep tasks away from zap entirely: tasks matching a Skip rule,
+// or no Include rule when there are any, are never sent to the model or
+// changed
+type Filters struct {
+	Skip    []FilterRule `yaml:"skip"`
+	Include []FilterRule `yaml:"include"`
+}
+
+// FilterRule matches tasks whose title matches the Title glob and the
+// Pattern regular expression, that carry Tag, and that are due within
+// DueWithin days or more than DueAfter days out; fields left unset match
+// any task
+type FilterRule struct {
+	Title     string `yaml:"title"`
+	Pattern   string `yaml:"pattern"`
+	Tag       string `yaml:"tag"`
+	DueWithin *int   `yaml:"due_within"`
+	DueAfter  *int   `yaml:"due_after"`
+}
+
+// Experiment ranks every list a second time in shadow, with the ranking
+// prompt in the Prompt file, the model in LLM or the Prioritizer instead
+// of the profile's, and logs how the two rankings differ. The variant's
+// rankings are only applied once it is promoted: after ShadowDays days in
+// shadow, unless it failed to rank most lists. Zero keeps it in shadow.
+type Experiment struct {
+	Name        string `yaml:"name"`
+	Prompt      string `yaml:"prompt"`
+	LLM         *LLM   `yaml:"llm"`
+	Prioritizer string `yaml:"prioritizer"`
+	ShadowDays  int    `yaml:"shadow_days"`
+}
+
+// Subtasks shapes how tasks without subtasks are broken down. Lists
+// overrides the profile's breakdown by list title; fields an override
+// leaves unset come from the profile's. Tasks completed in the last
+// CompletedDays days are shown to the model so it doesn't suggest steps
+// already done; zero sends none.
+type Subtasks struct {
+	Breakdown     `yaml:",inline"`
+	Lists         map[string]Breakdown `yaml:"lists"`
+	CompletedDays int                  `yaml:"completed_days"`
+}
+
+// Breakdown asks for between Min and Max subtasks per task, sized as
+// Granularity: GranularityMilestones, GranularityChecklist or, when empty,
+// whatever fits the task
+type Breakdown struct {
+	Min         int    `yaml:"min"`
+	Max         int    `yaml:"max"`
+	Granularity string `yaml:"granularity"`
+}
+
+const (
+	// GranularityMilestones breaks tasks into stages of hours or days
+	GranularityMilestones = "milestones"
+	// GranularityChecklist breaks tasks into single items to tick off
+	GranularityChecklist = "checklist"
+)
+
+// MaxSubtasks is the most subtasks a breakdown may ask for per task
+const MaxSubtasks = 20
+
+// For returns the breakdown for a list, matching titles case-insensitively
+func (s Subtasks) For(list string) Breakdown {
+	for title, breakdown := range s.Lists {
+		if strings.EqualFold(title, list) {
+			return breakdown
+		}
+	}
+	return s.Breakdown
+}
+
+// Teammate is someone 'zap delegate' may hand tasks to. Delegated tasks
+// are created in List of the teammate's Google Tasks (the first default
+// target list unless set) by impersonating Email.
+type Teammate struct {
+	Name   string   `yaml:"name"`
+	Email  string   `yaml:"email"`
+	Skills []string `yaml:"skills"`
+	List   string   `yaml:"list"`
+}
+
+// Sheets appends each run's report to a sheet of a Google Sheets
+// spreadsheet, as the profile's user. Sheet defaults to DefaultSheet.
+type Sheets struct {
+	SpreadsheetID string `yaml:"spreadsheet_id"`
+	Sheet         string `yaml:"sheet"`
+}
+
+// Calendar is the Google Calendar 'zap next' reads the rest of the day's
+// events from, as the profile's user. ID defaults to DefaultCalendar.
+type Calendar struct {
+	ID string `yaml:"id"`
+}
+
+// Gmail is the mail that becomes tasks in List: the messages matching
+// Query, a Gmail search such as "is:starred" or "label:follow-up". Query
+// defaults to DefaultGmailQuery and List to the profile's inbox.
+type Gmail struct {
+	Query string `yaml:"query"`
+	List  string `yaml:"list"`
+	// Max caps how many messages each run looks at, newest first
+	Max int `yaml:"max"`
+}
+
+// Trello is the board the trello backend works on, by name or ID. Key and
+// Token default to the TRELLO_API_KEY and TRELLO_TOKEN environment
+// variables.
+type Trello struct {
+	Board string `yaml:"board"`
+	Key   string `yaml:"key"`
+	Token string `yaml:"token"`
+}
+
+// Asana is what the asana backend works on: the sections of Projects, by
+// name or ID, and the user's My Tasks when MyTasks is set. Workspace may
+// be left out when the account has one. Ranks are written to the number
+// custom field named PriorityField, DefaultPriorityField unless set, on
+// tasks that have it. Token defaults to the ASANA_TOKEN environment
+// variable.
+type Asana struct {
+	Workspace     string   `yaml:"workspace"`
+	Projects      []string `yaml:"projects"`
+	MyTasks       bool     `yaml:"my_tasks"`
+	PriorityField string   `yaml:"priority_field"`
+	Token         string   `yaml:"token"`
+}
+
+// GitHub is the repository, as owner/name, whose open issues the github
+// backend works on, only those assigned to Assignee and carrying every one
+// of Labels when they are set. Token defaults to the GITHUB_TOKEN
+// environment variable.
+type GitHub struct {
+	Repo     string   `yaml:"repo"`
+	Assignee string   `yaml:"assignee"`
+	Labels   []string `yaml:"labels"`
+	Token    string   `yaml:"token"`
+}
+
+// Files is the Markdown or todo.txt file, or the directory of them, the
+// files backend works on
+type Files struct {
+	Path string `yaml:"path"`
+}
+
+// Prep has the model write preparation tasks, such as "Prepare the agenda
+// for X", for the upcoming meetings whose titles contain one of Keywords.
+// They are added to List, the profile's inbox unless set, due DaysBefore
+// days before each meeting. Calendar defaults to the profile's calendar.
+type Prep struct {
+	Keywords []string `yaml:"keywords"`
+	List     string   `yaml:"list"`
+	Calendar string   `yaml:"calendar"`
+	// Days is how far ahead meetings are looked for
+	Days       int `yaml:"days"`
+	DaysBefore int `yaml:"days_before"`
+}
+
+// Bot answers commands such as /add and /next sent from a chat app, for
+// the Telegram chats or Discord users in Allow. Kind is BotTelegram or
+// BotDiscord. Telegram bots need the Token BotFather gave; Discord
+// applications need their ApplicationID and PublicKey, and the bot's Token
+// to register their commands.
+type Bot struct {
+	Kind          string   `yaml:"kind"`
+	Token         string   `yaml:"token"`
+	ApplicationID string   `yaml:"application_id"`
+	PublicKey     string   `yaml:"public_key"`
+	Allow         []string `yaml:"allow"`
+}
+
+// CalDAV mirrors the target lists one way into the to-do lists of a CalDAV
+// server, such as Apple Reminders through iCloud. URL is the server or the
+// calendar home, DefaultCalDAVURL unless set. Lists names the server's
+// list for a zap list, by title; unnamed lists keep their titles.
+type CalDAV struct {
+	URL      string            `yaml:"url"`
+	Username string            `yaml:"username"`
+	Password string            `yaml:"password"`
+	Lists    map[string]string `yaml:"lists"`
+}
+
+// DefaultPriorityField is the Asana custom field ranks are written to
+const DefaultPriorityField = "Priority"
+
+// DefaultGmailQuery turns starred mail into tasks
+const DefaultGmailQuery = "is:starred"
+
+// DefaultGmailMax is how many messages a run looks at by default
+const DefaultGmailMax = 50
+
+// DefaultPrepDays is how many days ahead meetings are prepared for
+const DefaultPrepDays = 7
+
+// DefaultPrepDaysBefore makes preparation tasks due the day before
+const DefaultPrepDaysBefore = 1
+
+// DefaultCalDAVURL is iCloud, whose to-do lists are Apple Reminders
+const DefaultCalDAVURL = "https://caldav.icloud.com/"
+
+// DefaultCalendar is the user's primary calendar
+const DefaultCalendar = "primary"
+
+// DefaultSheet is the sheet run reports are appended to
+const DefaultSheet = "zap"
+
+// Budget caps what runs may spend per day, counted in the profile's state
+// file. A zero limit is unlimited. OnExceed is what happens when a run is
+// estimated to go over: BudgetRefuse (the default) or BudgetTrim.
+type Budget struct {
+	TaskWrites int    `yaml:"task_writes"`
+	LLMTokens  int    `yaml:"llm_tokens"`
+	OnExceed   string `yaml:"on_exceed"`
+}
+
+// Redact strips personal data from task titles and notes before they are
+// sent to the LLM. Rules picks built-in rules (email, phone, url; all of
+// them when empty); matches of Patterns are replaced with "[redacted]".
+type Redact struct {
+	Rules    []string `yaml:"rules"`
+	Patterns []string `yaml:"patterns"`
+}
+
+// Truncate caps how much of each task is sent to the model, in
+// characters. Titles over Title and notes over Notes are cut, and ranking
+// prompts over Prompt have their notes cut shorter until they fit. With
+// Summarize, cut notes are followed by a summary the model writes once per
+// version of the notes and that is kept in the state file. Zero limits
+// keep the defaults.
+type Truncate struct {
+	Title     int  `yaml:"title"`
+	Notes     int  `yaml:"notes"`
+	Prompt    int  `yaml:"prompt"`
+	Summarize bool `yaml:"summarize"`
+}
+
+// Audit enables the LLM audit log: every prompt and raw response is
+// appended to Path as JSONL
+type Audit struct {
+	Path         string `yaml:"path"`
+	MaxSizeMB    int    `yaml:"max_size_mb"`
+	MaxFiles     int    `yaml:"max_files"`
+	Pseudonymize bool   `yaml:"pseudonymize"`
+}
+
+// LLM selects the model that ranks tasks and suggests subtasks. Empty
+// fields use the provider's defaults; the API key is read from the
+// environment variable named by APIKeyEnv.
+type LLM struct {
+	Provider  string `yaml:"provider"`
+	Model     string `yaml:"model"`
+	APIKeyEnv string `yaml:"api_key_env"`
+	MaxTokens int    `yaml:"max_tokens"`
+	BaseURL   string `yaml:"base_url"`
+	// ContextWindow is the most input tokens the model takes, for models
+	// whose window zap doesn't know or that are served with a smaller one
+	ContextWindow int `yaml:"context_window"`
+
+	// Vertex AI settings; Credentials defaults to application default credentials
+	Project     string `yaml:"project"`
+	Location    string `yaml:"location"`
+	Credentials string `yaml:"credentials"`
+
+	// Timeout bounds each request; Fallbacks are tried in order when this
+	// provider fails. A fallback with provider "heuristic" stops the chain.
+	Timeout   time.Duration `yaml:"timeout"`
+	Fallbacks []LLM         `yaml:"fallbacks"`
+}
+
+// Ensemble ranks every list several times and orders it by the consensus
+// of the rankings, trading tokens for rankings that change less from run to
+// run. The profile's model ranks it Samples times (once when unset), and
+// each model in LLMs once more.
+type Ensemble struct {
+	Samples int   `yaml:"samples"`
+	LLMs    []LLM `yaml:"llms"`
+}
+
+// Escalation moves tasks overdue by more than OverdueDays to the top of their
+// list and prefixes their titles with Marker
+type Escalation struct {
+	OverdueDays int    `yaml:"overdue_days"`
+	Marker      string `yaml:"marker"`
+	Notify      bool   `yaml:"notify"`
+}
+
+// Notifier configures where zap sends notifications. Without a webhook they
+// are printed.
+type Notifier struct {
+	Webhook string `yaml:"webhook"`
+}
+
+// RecurringTask is a task zap re-creates on a schedule. Every uses the same
+// syntax as "[every ...]" title markers, e.g. "monday" or "2 weeks".
+type RecurringTask struct {
+	Title string `yaml:"title"`
+	List  string `yaml:"list"`
+	Every string `yaml:"every"`
+	Notes string `yaml:"notes"`
+}
+
+// Default returns the configuration used when no config file exists. Its
+// files live in the platform directories, except for files that already
+// exist in the working directory.
+func Default(dirs paths.Dirs) *Config {
+	profile := defaultProfile()
+	profile.Credentials = paths.Prefer(profile.Credentials, filepath.Join(dirs.Config, profile.Credentials))
+	profile.ClientSecret = paths.Prefer(profile.ClientSecret, filepath.Join(dirs.Config, profile.ClientSecret))
+	profile.TemplateDir = paths.Prefer(profile.TemplateDir, filepath.Join(dirs.Config, profile.TemplateDir))
+	profile.TokenFile = paths.Prefer(profile.TokenFile, filepath.Join(dirs.Cache, profile.TokenFile))
+	profile.StateFile = paths.Prefer(profile.StateFile, filepath.Join(dirs.State, profile.StateFile))
+	return &Config{
+		DefaultProfile: DefaultProfileName,
+		Profiles: map[string]*Profile{
+			DefaultProfileName: profile,
+		},
+	}
+}
+
+func defaultProfile() *Profile {
+	return &Profile{
+		Auth:         AuthServiceAccount,
+		Credentials:  "credentials.json",
+		ClientSecret: "client_secret.json",
+		TokenFile:    "token.json",
+		StateFile:    "zap-state.json",
+		TemplateDir:  "templates",
+		Prioritizer:  PrioritizerGemini,
+		Mode:         ModeReorder,
+		Annotate:     "report",
+		SubtaskOrder: "off",
+		Subtasks:     Subtasks{Breakdown: Breakdown{Min: 1, Max: 3}},
+		SnoozeList:   "Snoozed",
+		Inbox:        "Inbox",
+		Backend:      BackendGoogleTasks,
+		TargetLists:  []string{"Backlog", "In Progress"},
+	}
+}
+
+// Load reads a config file. Keys it doesn't know are errors, values may
+// refer to environment variables as ${NAME} or ${NAME:-default}, and ZAP_
+// variables override the settings they are named after.
+// Relative paths are resolved against the directory containing the file. Tokens, state files and audit logs that
+// aren't configured go to the cache and state directories in dirs, unless
+// they already exist next to the config file.
+func Load(path string, dirs paths.Dirs) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve config directory: %v", err)
+	}
+	return load(data, path, dir, dirs)
+}
+
+// load is Load for a config read from source, whose relative paths are
+// resolved against dir
+func load(data []byte, source, dir string, dirs paths.Dirs) (*Config, error) {
+	cfg, err := parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse config %s: %v", source, err)
+	}
+	if len(cfg.Profiles) == 0 {
+		return nil, fmt.Errorf("config %s defines no profiles", source)
+	}
+	if _, ok := cfg.Profiles[cfg.DefaultProfile]; cfg.DefaultProfile != "" && !ok {
+		return nil, fmt.Errorf("config %s: default_profile %q is not one of its profiles", source, cfg.DefaultProfile)
+	}
+
+	defaults := defaultProfile()
+	for name, profile := range cfg.Profiles {
+		if profile == nil {
+			profile = &Profile{}
+			cfg.Profiles[name] = profile
+		}
+		if profile.Auth == "" {
+			profile.Auth = defaults.Auth
+		}
+		if profile.Auth != AuthServiceAccount && profile.Auth != AuthOAuth {
+			return nil, fmt.Errorf("profile %s: unsupported auth %q (want %s or %s)", name, profile.Auth, AuthServiceAccount, AuthOAuth)
+		}
+		if profile.Credentials == "" {
+			profile.Credentials = defaults.Credentials
+		}
+		if profile.ClientSecret == "" {
+			profile.ClientSecret = defaults.ClientSecret
+		}
+		if profile.TokenFile == "" {
+			profile.TokenFile = defaultFile(dir, dirs.Cache, fmt.Sprintf("token-%s.json", name))
+		}
+		if profile.StateFile == "" {
+			profile.StateFile = defaultFile(dir, dirs.State, fmt.Sprintf("zap-state-%s.json", name))
+		}
+		if profile.TemplateDir == "" {
+			profile.TemplateDir = defaults.TemplateDir
+		}
+		if profile.Prioritizer == "" {
+			profile.Prioritizer = defaults.Prioritizer
+		}
+		if profile.Prioritizer != PrioritizerGemini && profile.Prioritizer != PrioritizerHeuristic {
+			return nil, fmt.Errorf("profile %s: unsupported prioritizer %q (want %s or %s)", name, profile.Prioritizer, PrioritizerGemini, PrioritizerHeuristic)
+		}
+		if profile.Mode == "" {
+			profile.Mode = defaults.Mode
+		}
+		if profile.Mode != ModeReorder && profile.Mode != ModeSuggest {
+			return nil, fmt.Errorf("profile %s: unsupported mode %q (want %s or %s)", name, profile.Mode, ModeReorder, ModeSuggest)
+		}
+		if profile.Annotate == "" {
+			profile.Annotate = defaults.Annotate
+		}
+		if profile.SubtaskOrder == "" {
+			profile.SubtaskOrder = defaults.SubtaskOrder
+		}
+		if profile.SnoozeList == "" {
+			profile.SnoozeList = defaults.SnoozeList
+		}
+		if profile.Inbox == "" {
+			profile.Inbox = defaults.Inbox
+		}
+		if profile.Timezone != "" {
+			if _, err := time.LoadLocation(profile.Timezone); err != nil {
+				return nil, fmt.Errorf("profile %s: invalid timezone %q: %v", name, profile.Timezone, err)
+			}
+		}
+		if profile.Escalation != nil && profile.Escalation.OverdueDays < 0 {
+			return nil, fmt.Errorf("profile %s: escalation overdue_days must not be negative", name)
+		}
+		if profile.WIP != nil {
+			if profile.WIP.Overflow == "" {
+				profile.WIP.Overflow = defaults.TargetLists[0]
+			}
+			for list, limit := range profile.WIP.Limits {
+				if limit < 1 {
+					return nil, fmt.Errorf("profile %s: wip limit of %s must be at least 1", name, list)
+				}
+				if strings.EqualFold(list, profile.WIP.Overflow) {
+					return nil, fmt.Errorf("profile %s: wip overflow list %s can't have a limit itself", name, list)
+				}
+			}
+		}
+		if profile.Stability != nil && profile.Stability.MinMove < 0 {
+			return nil, fmt.Errorf("profile %s: stability min_move must not be negative", name)
+		}
+		if profile.Stability != nil && (profile.Stability.Margin < 0 || profile.Stability.Margin > 100) {
+			return nil, fmt.Errorf("profile %s: stability margin must be between 0 and 100", name)
+		}
+		profile.Rules = append(slices.Clone(cfg.Rules), profile.Rules...)
+		for _, rule := range profile.Rules {
+			if strings.TrimSpace(rule) == "" {
+				return nil, fmt.Errorf("profile %s: rules must not be empty", name)
+			}
+		}
+		if profile.Truncate != nil && (profile.Truncate.Title < 0 || profile.Truncate.Notes < 0 || profile.Truncate.Prompt < 0) {
+			return nil, fmt.Errorf("profile %s: truncate limits must not be negative", name)
+		}
+		if profile.Filters != nil {
+			for _, rule := range slices.Concat(profile.Filters.Skip, profile.Filters.Include) {
+				if rule.Title == "" && rule.Pattern == "" && rule.Tag == "" && rule.DueWithin == nil && rule.DueAfter == nil {
+					return nil, fmt.Errorf("profile %s: every filter rule needs a title, pattern, tag, due_within or due_after", name)
+				}
+				if (rule.DueWithin != nil && *rule.DueWithin < 0) || (rule.DueAfter != nil && *rule.DueAfter < 0) {
+					return nil, fmt.Errorf("profile %s: filter due windows must not be negative", name)
+				}
+			}
+		}
+		if err := resolveSubtasks(&profile.Subtasks, defaults.Subtasks.Breakdown); err != nil {
+			return nil, fmt.Errorf("profile %s: %v", name, err)
+		}
+		teammates := make(map[string]bool, len(profile.Team))
+		for i := range profile.Team {
+			teammate := &profile.Team[i]
+			if teammate.Name == "" || teammate.Email == "" {
+				return nil, fmt.Errorf("profile %s: every teammate needs a name and an email", name)
+			}
+			if teammates[teammate.Name] {
+				return nil, fmt.Errorf("profile %s: teammate %q is listed twice", name, teammate.Name)
+			}
+			teammates[teammate.Name] = true
+			if teammate.List == "" {
+				teammate.List = defaults.TargetLists[0]
+			}
+		}
+		if profile.Sheets != nil {
+			if profile.Sheets.SpreadsheetID == "" {
+				return nil, fmt.Errorf("profile %s: sheets needs a spreadsheet_id", name)
+			}
+			if profile.Sheets.Sheet == "" {
+				profile.Sheets.Sheet = DefaultSheet
+			}
+		}
+		if profile.Calendar != nil && profile.Calendar.ID == "" {
+			profile.Calendar.ID = DefaultCalendar
+		}
+		if profile.Gmail != nil {
+			if profile.Gmail.Query == "" {
+				profile.Gmail.Query = DefaultGmailQuery
+			}
+			if profile.Gmail.List == "" {
+				profile.Gmail.List = profile.Inbox
+			}
+			if profile.Gmail.Max < 0 {
+				return nil, fmt.Errorf("profile %s: gmail max must not be negative", name)
+			}
+			if profile.Gmail.Max == 0 {
+				profile.Gmail.Max = DefaultGmailMax
+			}
+		}
+		if profile.Prep != nil {
+			if len(profile.Prep.Keywords) == 0 {
+				return nil, fmt.Errorf("profile %s: prep needs keywords to pick the meetings to prepare for", name)
+			}
+			if profile.Prep.Days < 0 || profile.Prep.DaysBefore < 0 {
+				return nil, fmt.Errorf("profile %s: prep days and days_before must not be negative", name)
+			}
+			if profile.Prep.List == "" {
+				profile.Prep.List = profile.Inbox
+			}
+			if profile.Prep.Calendar == "" {
+				profile.Prep.Calendar = DefaultCalendar
+				if profile.Calendar != nil {
+					profile.Prep.Calendar = profile.Calendar.ID
+				}
+			}
+			if profile.Prep.Days == 0 {
+				profile.Prep.Days = DefaultPrepDays
+			}
+			if profile.Prep.DaysBefore == 0 {
+				profile.Prep.DaysBefore = DefaultPrepDaysBefore
+			}
+		}
+		if profile.Bot != nil {
+			switch profile.Bot.Kind {
+			case BotTelegram:
+				if profile.Bot.Token == "" {
+					return nil, fmt.Errorf("profile %s: the %s bot needs a token", name, BotTelegram)
+				}
+			case BotDiscord:
+				if profile.Bot.ApplicationID == "" || profile.Bot.PublicKey == "" {
+					return nil, fmt.Errorf("profile %s: the %s bot needs application_id and public_key", name, BotDiscord)
+				}
+			default:
+				return nil, fmt.Errorf("profile %s: unsupported bot kind %q (want %s or %s)", name, profile.Bot.Kind, BotTelegram, BotDiscord)
+			}
+			if len(profile.Bot.Allow) == 0 {
+				return nil, fmt.Errorf("profile %s: bot needs allow, the chats or users who may use it", name)
+			}
+		}
+		if profile.CalDAV != nil {
+			if profile.CalDAV.Username == "" || profile.CalDAV.Password == "" {
+				return nil, fmt.Errorf("profile %s: caldav needs username and password", name)
+			}
+			if profile.CalDAV.URL == "" {
+				profile.CalDAV.URL = DefaultCalDAVURL
+			}
+		}
+		if profile.Budget != nil {
+			if profile.Budget.TaskWrites < 0 || profile.Budget.LLMTokens < 0 {
+				return nil, fmt.Errorf("profile %s: budget limits must not be negative", name)
+			}
+			if profile.Budget.OnExceed == "" {
+				profile.Budget.OnExceed = BudgetRefuse
+			}
+			if profile.Budget.OnExceed != BudgetRefuse && profile.Budget.OnExceed != BudgetTrim {
+				return nil, fmt.Errorf("profile %s: unsupported budget on_exceed %q (want %s or %s)", name, profile.Budget.OnExceed, BudgetRefuse, BudgetTrim)
+			}
+		}
+		if profile.Experiment != nil {
+			if profile.Experiment.Name == "" {
+				return nil, fmt.Errorf("profile %s: experiment needs a name", name)
+			}
+			experiment := profile.Experiment
+			if experiment.Prompt == "" && experiment.LLM == nil && experiment.Prioritizer == "" {
+				return nil, fmt.Errorf("profile %s: experiment %s needs a prompt, llm or prioritizer to try", name, experiment.Name)
+			}
+			switch experiment.Prioritizer {
+			case "", PrioritizerGemini:
+			case PrioritizerHeuristic:
+				if experiment.Prompt != "" || experiment.LLM != nil {
+					return nil, fmt.Errorf("profile %s: experiment %s can't try a prompt or llm with the %s prioritizer", name, experiment.Name, PrioritizerHeuristic)
+				}
+			default:
+				return nil, fmt.Errorf("profile %s: experiment %s has unsupported prioritizer %q (want %s or %s)", name, experiment.Name, experiment.Prioritizer, PrioritizerGemini, PrioritizerHeuristic)
+			}
+			if experiment.ShadowDays < 0 {
+				return nil, fmt.Errorf("profile %s: experiment shadow_days must not be negative", name)
+			}
+			if profile.Experiment.Prompt != "" {
+				profile.Experiment.Prompt = resolvePath(dir, profile.Experiment.Prompt)
+			}
+			if profile.Experiment.LLM != nil {
+				resolveLLMPaths(dir, profile.Experiment.LLM)
+			}
+		}
+		for i, task := range profile.Recurring {
+			if task.Title == "" || task.List == "" || task.Every == "" {
+				return nil, fmt.Errorf("profile %s: recurring task %d needs title, list and every", name, i+1)
+			}
+		}
+		profile.Credentials = resolvePath(dir, profile.Credentials)
+		profile.StateFile = resolvePath(dir, profile.StateFile)
+		profile.ClientSecret = resolvePath(dir, profile.ClientSecret)
+		profile.TokenFile = resolvePath(dir, profile.TokenFile)
+		profile.TemplateDir = resolvePath(dir, profile.TemplateDir)
+		resolveLLMPaths(dir, &profile.LLM)
+		if profile.Ensemble != nil {
+			if profile.Ensemble.Samples < 0 {
+				return nil, fmt.Errorf("profile %s: ensemble samples must not be negative", name)
+			}
+			if profile.Ensemble.Samples == 0 {
+				profile.Ensemble.Samples = 1
+			}
+			if profile.Ensemble.Samples+len(profile.Ensemble.LLMs) < 2 {
+				return nil, fmt.Errorf("profile %s: an ensemble needs at least 2 rankings: raise samples or add llms", name)
+			}
+			for i := range profile.Ensemble.LLMs {
+				resolveLLMPaths(dir, &profile.Ensemble.LLMs[i])
+			}
+		}
+		if profile.Audit != nil {
+			if profile.Audit.Path == "" {
+				profile.Audit.Path = defaultFile(dir, dirs.State, fmt.Sprintf("zap-audit-%s.jsonl", name))
+			}
+			profile.Audit.Path = resolvePath(dir, profile.Audit.Path)
+		}
+		if profile.HTTP != nil {
+			if profile.HTTP.Proxy != "" {
+				proxy, err := url.Parse(profile.HTTP.Proxy)
+				if err != nil || proxy.Host == "" {
+					return nil, fmt.Errorf("profile %s: http proxy %q is not a URL like http://proxy.example.com:3128", name, profile.HTTP.Proxy)
+				}
+				switch proxy.Scheme {
+				case "http", "https", "socks5":
+				default:
+					return nil, fmt.Errorf("profile %s: unsupported http proxy scheme %q (want http, https or socks5)", name, proxy.Scheme)
+				}
+			}
+			if profile.HTTP.Timeout < 0 {
+				return nil, fmt.Errorf("profile %s: http timeout must not be negative", name)
+			}
+			if profile.HTTP.CABundle != "" {
+				profile.HTTP.CABundle = resolvePath(dir, profile.HTTP.CABundle)
+			}
+		}
+		if profile.Backend == "" {
+			profile.Backend = defaults.Backend
+		}
+		switch profile.Backend {
+		case BackendGoogleTasks:
+		case BackendTrello:
+			if profile.Trello == nil || profile.Trello.Board == "" {
+				return nil, fmt.Errorf("profile %s: the %s backend needs trello.board", name, BackendTrello)
+			}
+		case BackendAsana:
+			if profile.Asana == nil || (len(profile.Asana.Projects) == 0 && !profile.Asana.MyTasks) {
+				return nil, fmt.Errorf("profile %s: the %s backend needs asana.projects or asana.my_tasks", name, BackendAsana)
+			}
+			if profile.Asana.PriorityField == "" {
+				profile.Asana.PriorityField = DefaultPriorityField
+			}
+		case BackendGitHub:
+			if profile.GitHub == nil || !strings.Contains(profile.GitHub.Repo, "/") {
+				return nil, fmt.Errorf("profile %s: the %s backend needs github.repo as owner/name", name, BackendGitHub)
+			}
+		case BackendFiles:
+			if profile.Files == nil || profile.Files.Path == "" {
+				return nil, fmt.Errorf("profile %s: the %s backend needs files.path", name, BackendFiles)
+			}
+			profile.Files.Path = resolvePath(dir, profile.Files.Path)
+		default:
+			return nil, fmt.Errorf("profile %s: unsupported backend %q (want %s, %s, %s, %s or %s)", name, profile.Backend, BackendGoogleTasks, BackendTrello, BackendAsana, BackendGitHub, BackendFiles)
+		}
+		if len(profile.TargetLists) == 0 {
+			profile.TargetLists = defaults.TargetLists
+		}
+	}
+	if err := resolveTenants(&cfg, dir, dirs); err != nil {
+		return nil, fmt.Errorf("config %s: %v", source, err)
+	}
+
+	return &cfg, nil
+}
+
+// resolveSubtasks fills the unset fields of a profile's breakdown from
+// defaults and of its list overrides from the profile's, then checks them
+func resolveSubtasks(subtasks *Subtasks, defaults Breakdown) error {
+	if subtasks.CompletedDays < 0 {
+		return fmt.Errorf("subtasks: completed_days must not be negative")
+	}
+	if err := resolveBreakdown(&subtasks.Breakdown, defaults); err != nil {
+		return fmt.Errorf("subtasks: %v", err)
+	}
+	for list, breakdown := range subtasks.Lists {
+		if err := resolveBreakdown(&breakdown, subtasks.Breakdown); err != nil {
+			return fmt.Errorf("subtasks of %s: %v", list, err)
+		}
+		subtasks.Lists[list] = breakdown
+	}
+	return nil
+}
+
+// resolveBreakdown fills the unset fields of breakdown from base. A Min
+// above base's Max raises Max to match, so "min: 5" alone is valid.
+func resolveBreakdown(breakdown *Breakdown, base Breakdown) error {
+	if breakdown.Min == 0 {
+		breakdown.Min = min(base.Min, max(breakdown.Max, 1))
+	}
+	if breakdown.Max == 0 {
+		breakdown.Max = max(base.Max, breakdown.Min)
+	}
+	if breakdown.Granularity == "" {
+		breakdown.Granularity = base.Granularity
+	}
+	if breakdown.Min < 1 {
+		return fmt.Errorf("min must be at least 1")
+	}
+	if breakdown.Max < breakdown.Min {
+		return fmt.Errorf("max %d is below min %d", breakdown.Max, breakdown.Min)
+	}
+	if breakdown.Max > MaxSubtasks {
+		return fmt.Errorf("max must be at most %d", MaxSubtasks)
+	}
+	switch breakdown.Granularity {
+	case "", GranularityMilestones, GranularityChecklist:
+	default:
+		return fmt.Errorf("unsupported granularity %q (want %s or %s)", breakdown.Granularity, GranularityMilestones, GranularityChecklist)
+	}
+	return nil
+}
+
+// Profile returns the named profile, falling back to the default profile
+// (or the only profile) when name is empty
+func (c *Config) Profile(name string) (*Profile, error) {
+	if name == "" {
+		name = os.Getenv(EnvProfile)
+	}
+	if name == "" {
+		name = c.DefaultProfile
+	}
+	if name == "" && len(c.Profiles) == 1 {
+		for only := range c.Profiles {
+			name = only
+		}
+	}
+	if name == "" {
+		return nil, fmt.Errorf("no profile selected; use --profile with one of: %s", strings.Join(c.ProfileNames(), ", "))
+	}
+
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile %q not found; available profiles: %s", name, strings.Join(c.ProfileNames(), ", "))
+	}
+	return profile, nil
+}
+
+// ProfileNames returns the configured profile names in sorted order
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resolveLLMPaths resolves credential paths in an LLM config and its fallbacks
+func resolveLLMPaths(dir string, cfg *LLM) {
+	if cfg.Credentials != "" {
+		cfg.Credentials = resolvePath(dir, cfg.Credentials)
+	}
+	for i := range cfg.Fallbacks {
+		resolveLLMPaths(dir, &cfg.Fallbacks[i])
+	}
+}
+
+// defaultFile places a file zap creates itself in platformDir, or next to
+// the config in configDir where earlier versions put it, if it exists there
+func defaultFile(configDir, platformDir, name string) string {
+	return paths.Prefer(filepath.Join(configDir, name), filepath.Join(platformDir, name))
+}
+
+// resolvePath makes path relative to dir unless it is already absolute
+func resolvePath(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// secretKeys are the keys whose values Diff doesn't show
+var secretKeys = map[string]bool{"key": true, "token": true}
+
+// Diff describes what changed from one profile to another, one line per
+// setting, e.g. `target_lists: ["Inbox"] -> ["Inbox","Backlog"]`. Secrets
+// are only said to have changed.
+func Diff(before, after *Profile) []string {
+	previous, current := flatten(before), flatten(after)
+	keys := make(map[string]bool, len(previous)+len(current))
+	for key := range previous {
+		keys[key] = true
+	}
+	for key := range current {
+		keys[key] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	var lines []string
+	for _, key := range sorted {
+		was, wasSet := previous[key]
+		is, isSet := current[key]
+		switch {
+		case was == is:
+		case secretKeys[key[strings.LastIndex(key, ".")+1:]]:
+			lines = append(lines, key+": changed")
+		case !wasSet:
+			lines = append(lines, fmt.Sprintf("%s: set to %s", key, is))
+		case !isSet:
+			lines = append(lines, fmt.Sprintf("%s: unset (was %s)", key, was))
+		default:
+			lines = append(lines, fmt.Sprintf("%s: %s -> %s", key, was, is))
+		}
+	}
+	return lines
+}
+
+// flatten returns a profile's settings by their dotted YAML path, lists
+// and values as JSON
+func flatten(profile *Profile) map[string]string {
+	settings := make(map[string]string)
+	if profile == nil {
+		return settings
+	}
+	data, err := yaml.Marshal(profile)
+	if err != nil {
+		return settings
+	}
+	var tree map[string]interface{}
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return settings
+	}
+	var walk func(prefix string, value interface{})
+	walk = func(prefix string, value interface{}) {
+		if fields, ok := value.(map[string]interface{}); ok && len(fields) > 0 {
+			for key, field := range fields {
+				if prefix != "" {
+					key = prefix + "." + key
+				}
+				walk(key, field)
+			}
+			return
+		}
+		encoded, _ := json.Marshal(value)
+		settings[prefix] = string(encoded)
+	}
+	walk("", tree)
+	return settings
+}
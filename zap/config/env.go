@@ -0,0 +1,231 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"zap/paths"
+)
+
+// Environment variables that configure zap as a whole. Other variables
+// starting with EnvPrefix override the setting they are named after in
+// every profile, e.g. ZAP_TARGET_LISTS or ZAP_LLM_MODEL.
+const (
+	EnvPrefix = "ZAP_"
+	// EnvConfig is the config file used without --config
+	EnvConfig = "ZAP_CONFIG"
+	// EnvConfigYAML holds a whole config file, used when no file is found
+	EnvConfigYAML = "ZAP_CONFIG_YAML"
+	// EnvProfile is the profile used without --profile
+	EnvProfile = "ZAP_PROFILE"
+)
+
+// fileSuffix marks a variable naming the file that holds another's value,
+// as container platforms mount secrets, e.g. GEMINI_API_KEY_FILE
+const fileSuffix = "_FILE"
+
+// Getenv returns the environment variable name or, when only NAME_FILE is
+// set, the contents of the file it names without surrounding whitespace
+func Getenv(name string) string {
+	value, _ := lookupEnv(name)
+	return value
+}
+
+// lookupEnv is Getenv that also reports whether the variable is set
+func lookupEnv(name string) (string, bool) {
+	if value, ok := os.LookupEnv(name); ok {
+		return value, true
+	}
+	path, ok := os.LookupEnv(name + fileSuffix)
+	if !ok {
+		return "", false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(string(data)), true
+}
+
+// FromEnv returns the configuration used when there is no config file:
+// the one in ZAP_CONFIG_YAML, with relative paths resolved against the
+// working directory, or else Default. Either way ZAP_ variables override
+// the profiles' settings.
+func FromEnv(dirs paths.Dirs) (*Config, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	if data, ok := os.LookupEnv(EnvConfigYAML); ok {
+		return load([]byte(data), "$"+EnvConfigYAML, dir, dirs)
+	}
+
+	cfg := Default(dirs)
+	if overrides, err := envOverrides(); err != nil || len(overrides) == 0 {
+		return cfg, err
+	}
+	// Loading the defaults checks the overridden settings as a file's are
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return load(data, "defaults with "+EnvPrefix+" variables", dir, dirs)
+}
+
+// override sets the value of a profile setting
+type override struct {
+	name  string
+	path  []string
+	value *yaml.Node
+}
+
+// reserved are the ZAP_ variables that aren't profile settings
+var reserved = map[string]bool{
+	EnvConfig:     true,
+	EnvConfigYAML: true,
+	EnvProfile:    true,
+}
+
+// envOverrides returns the profile settings ZAP_ variables override, in
+// order of their names. Variables that name no setting are ignored, since
+// they may be meant for ${NAME} references.
+func envOverrides() ([]override, error) {
+	var overrides []override
+	profile := reflect.TypeOf(Profile{})
+	for _, entry := range os.Environ() {
+		name, value, _ := strings.Cut(entry, "=")
+		rest, ok := strings.CutPrefix(name, EnvPrefix)
+		if !ok || reserved[name] || strings.HasSuffix(name, fileSuffix) {
+			continue
+		}
+		path, field, ok := settingPath(profile, rest)
+		if !ok {
+			continue
+		}
+		node, err := envNode(value, field)
+		if err == nil {
+			// Decoding the whole config would only report line 0
+			err = node.Decode(reflect.New(field).Interface())
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid %s %q", name, strings.Join(path, "."), value)
+		}
+		overrides = append(overrides, override{name: name, path: path, value: node})
+	}
+	sort.Slice(overrides, func(i, j int) bool { return overrides[i].name < overrides[j].name })
+	return overrides, nil
+}
+
+// settingPath finds the setting of t that name, e.g. LLM_API_KEY_ENV,
+// refers to, returning its YAML keys and type
+func settingPath(t reflect.Type, name string) ([]string, reflect.Type, bool) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, nil, false
+	}
+	for key, field := range yamlFields(t) {
+		upper := strings.ToUpper(key)
+		if name == upper {
+			return []string{key}, field, true
+		}
+		if rest, ok := strings.CutPrefix(name, upper+"_"); ok {
+			if path, leaf, ok := settingPath(field, rest); ok {
+				return append([]string{key}, path...), leaf, true
+			}
+		}
+	}
+	return nil, nil, false
+}
+
+// envNode turns a variable's value into the YAML for a setting of type t.
+// Lists of strings may be given comma-separated; lists of structs, maps
+// and structs must be YAML, e.g. a flow mapping.
+func envNode(value string, t reflect.Type) (*yaml.Node, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.String && !strings.HasPrefix(strings.TrimSpace(value), "[") {
+		list := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list.Content = append(list.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: item})
+			}
+		}
+		return list, nil
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Struct:
+		var doc yaml.Node
+		if err := yaml.Unmarshal([]byte(value), &doc); err != nil {
+			return nil, err
+		}
+		if len(doc.Content) == 0 {
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null"}, nil
+		}
+		return doc.Content[0], nil
+	case reflect.String:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}, nil
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Value: value}, nil
+}
+
+// setPath sets the value at path under a mapping node, adding the
+// mappings on the way that don't exist yet
+func setPath(node *yaml.Node, path []string, value *yaml.Node) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			node.Content[i+1] = value
+			return
+		}
+		child := node.Content[i+1]
+		if child.Kind != yaml.MappingNode {
+			child = &yaml.Node{Kind: yaml.MappingNode}
+			node.Content[i+1] = child
+		}
+		setPath(child, path[1:], value)
+		return
+	}
+	key := &yaml.Node{Kind: yaml.ScalarNode, Value: path[0]}
+	if len(path) == 1 {
+		node.Content = append(node.Content, key, value)
+		return
+	}
+	child := &yaml.Node{Kind: yaml.MappingNode}
+	node.Content = append(node.Content, key, child)
+	setPath(child, path[1:], value)
+}
+
+// applyOverrides sets the ZAP_ overrides in every profile of a config
+// file's root mapping
+func applyOverrides(root *yaml.Node) error {
+	overrides, err := envOverrides()
+	if err != nil || len(overrides) == 0 {
+		return err
+	}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != "profiles" || root.Content[i+1].Kind != yaml.MappingNode {
+			continue
+		}
+		profiles := root.Content[i+1]
+		for j := 1; j < len(profiles.Content); j += 2 {
+			if profiles.Content[j].Kind != yaml.MappingNode {
+				// An empty profile
+				profiles.Content[j] = &yaml.Node{Kind: yaml.MappingNode}
+			}
+			for _, o := range overrides {
+				setPath(profiles.Content[j], o.path, o.value)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envReference matches ${NAME} and ${NAME:-default} in values, and the
+// escaped $${ that stands for a literal ${
+var envReference = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// parse decodes a config file strictly: environment variables in values
+// are filled in first, then ZAP_ variables override settings, and keys no field is named after are errors, each
+// with its line and the key that was probably meant
+func parse(data []byte) (Config, error) {
+	var cfg Config
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return cfg, err
+	}
+	if len(root.Content) == 0 {
+		return cfg, nil
+	}
+	if err := interpolate(root.Content[0]); err != nil {
+		return cfg, err
+	}
+	if err := applyOverrides(root.Content[0]); err != nil {
+		return cfg, err
+	}
+	if err := errors.Join(checkKeys(root.Content[0], reflect.TypeOf(cfg))...); err != nil {
+		return cfg, err
+	}
+	err := root.Decode(&cfg)
+	return cfg, err
+}
+
+// interpolate fills in the environment variables referenced by the values
+// under node. A variable that isn't set is an error unless the reference
+// gives a default.
+func interpolate(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		// Keys are left as they are
+		for i := 1; i < len(node.Content); i += 2 {
+			if err := interpolate(node.Content[i]); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			if err := interpolate(item); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		if !strings.Contains(node.Value, "${") {
+			return nil
+		}
+		var missing string
+		node.Value = envReference.ReplaceAllStringFunc(node.Value, func(ref string) string {
+			if ref == "$${" {
+				return "${"
+			}
+			m := envReference.FindStringSubmatch(ref)
+			value, ok := lookupEnv(m[1])
+			switch {
+			case ok && value != "":
+			case m[2] != "":
+				value = m[3]
+			case !ok && missing == "":
+				missing = m[1]
+			}
+			return value
+		})
+		if missing != "" {
+			return fmt.Errorf("line %d: environment variable %s is not set (write ${%s:-default} to fall back to a default)", node.Line, missing, missing)
+		}
+		// Unquoted values are typed by what they hold now, so e.g.
+		// "max_size_mb: ${AUDIT_MB}" is a number
+		if node.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+			node.Tag = ""
+		}
+	}
+	return nil
+}
+
+// checkKeys returns an error for every key under node that t has no field
+// for
+func checkKeys(node *yaml.Node, t reflect.Type) []error {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	var errs []error
+	switch {
+	case t.Kind() == reflect.Struct && node.Kind == yaml.MappingNode:
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			field, ok := fields[key.Value]
+			if !ok {
+				errs = append(errs, unknownKey(key, fields))
+				continue
+			}
+			errs = append(errs, checkKeys(value, field)...)
+		}
+	case t.Kind() == reflect.Map && node.Kind == yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			errs = append(errs, checkKeys(node.Content[i], t.Elem())...)
+		}
+	case t.Kind() == reflect.Slice && node.Kind == yaml.SequenceNode:
+		for _, item := range node.Content {
+			errs = append(errs, checkKeys(item, t.Elem())...)
+		}
+	}
+	return errs
+}
+
+// yamlFields returns the types of a struct's fields by their YAML key,
+// those of inlined structs included
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, options, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		switch {
+		case name == "-" || !field.IsExported():
+		case options == "inline":
+			for key, inner := range yamlFields(field.Type) {
+				fields[key] = inner
+			}
+		case name == "":
+			fields[strings.ToLower(field.Name)] = field.Type
+		default:
+			fields[name] = field.Type
+		}
+	}
+	return fields
+}
+
+// unknownKey describes a key no field is named after, suggesting the
+// closest one when it looks like a typo
+func unknownKey(key *yaml.Node, fields map[string]reflect.Type) error {
+	var names []string
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	best, bestDistance := "", 3
+	for _, name := range names {
+		if d := editDistance(strings.ToLower(key.Value), name); d < bestDistance {
+			best, bestDistance = name, d
+		}
+	}
+	if best != "" {
+		return fmt.Errorf("line %d: unknown key %q (did you mean %q?)", key.Line, key.Value, best)
+	}
+	return fmt.Errorf("line %d: unknown key %q (want one of %s)", key.Line, key.Value, strings.Join(names, ", "))
+}
+
+// editDistance counts the single-character edits that turn a into b
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+// EnvReferences returns the environment variables the values of the config
+// file at path refer to, e.g. so that a service can be given them
+func EnvReferences(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("unable to parse config %s: %v", path, err)
+	}
+	seen := make(map[string]bool)
+	var names []string
+	var walk func(node *yaml.Node, isKey bool)
+	walk = func(node *yaml.Node, isKey bool) {
+		if node.Kind == yaml.ScalarNode && !isKey {
+			for _, m := range envReference.FindAllStringSubmatch(node.Value, -1) {
+				if m[1] != "" && !seen[m[1]] {
+					seen[m[1]] = true
+					names = append(names, m[1])
+				}
+			}
+		}
+		for i, child := range node.Content {
+			walk(child, node.Kind == yaml.MappingNode && i%2 == 0)
+		}
+	}
+	walk(&root, false)
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,33 @@
+package config
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+)
+
+// starter is the commented config 'zap config init' writes
+//
+//go:embed starter.yaml
+var starter []byte
+
+// WriteStarter writes a commented starter config to path. An existing file
+// is only replaced when overwrite is set.
+func WriteStarter(path string, overwrite bool) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if overwrite {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0o600)
+	if os.IsExist(err) {
+		return fmt.Errorf("%s already exists; pass --force to replace it", path)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(starter); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
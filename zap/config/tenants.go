@@ -0,0 +1,114 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"zap/paths"
+)
+
+// API token scopes, each allowing what the ones before it do
+const (
+	// ScopeRead lists tasks and shows the dashboard
+	ScopeRead = "read"
+	// ScopeRun adds tasks and starts runs
+	ScopeRun = "run"
+	// ScopeAdmin acts for any user of the tenant's domain
+	ScopeAdmin = "admin"
+)
+
+// scopes orders the scopes from least to most allowed
+var scopes = []string{ScopeRead, ScopeRun, ScopeAdmin}
+
+// Tenant is a Google Workspace domain one zap serve serves, next to other
+// teams' domains. Its service account acts for the domain's users with the
+// settings of Profile, or the default profile, and requests act for User
+// unless an admin token names another. StateDir keeps the tenant's state
+// and audit log apart from other tenants', one state file per user.
+type Tenant struct {
+	Domain      string     `yaml:"domain"`
+	Credentials string     `yaml:"credentials"`
+	Profile     string     `yaml:"profile"`
+	User        string     `yaml:"user"`
+	StateDir    string     `yaml:"state_dir"`
+	Tokens      []APIToken `yaml:"tokens"`
+}
+
+// APIToken is a secret that lets a tool call zap serve within its scope.
+// Tokens below ScopeAdmin act for their User, or the tenant's.
+type APIToken struct {
+	// Name says who has the token, for logs
+	Name  string `yaml:"name"`
+	Token string `yaml:"token"`
+	Scope string `yaml:"scope"`
+	User  string `yaml:"user"`
+}
+
+// Allows reports whether the token's scope includes scope
+func (t APIToken) Allows(scope string) bool {
+	return slices.Index(scopes, t.Scope) >= slices.Index(scopes, scope)
+}
+
+// inDomain reports whether user is an address of the tenant's domain
+func (t *Tenant) inDomain(user string) bool {
+	_, domain, ok := strings.Cut(user, "@")
+	return ok && strings.EqualFold(domain, t.Domain)
+}
+
+// resolveTenants fills in the tenants' defaults and checks them. Their
+// profiles must be Google Tasks profiles, and no two tenants share a token.
+func resolveTenants(cfg *Config, dir string, dirs paths.Dirs) error {
+	seen := make(map[string]string)
+	for name, tenant := range cfg.Tenants {
+		if tenant == nil || tenant.Domain == "" || tenant.Credentials == "" {
+			return fmt.Errorf("tenant %s needs domain and credentials, the service account that acts for its users", name)
+		}
+		if strings.ContainsAny(name, `/\`) {
+			return fmt.Errorf("tenant %s: names can't contain slashes", name)
+		}
+		profile, err := cfg.Profile(tenant.Profile)
+		if err != nil {
+			return fmt.Errorf("tenant %s: %v", name, err)
+		}
+		if profile.Backend != BackendGoogleTasks {
+			return fmt.Errorf("tenant %s: profile %s must use the %s backend", name, tenant.Profile, BackendGoogleTasks)
+		}
+		if tenant.User != "" && !tenant.inDomain(tenant.User) {
+			return fmt.Errorf("tenant %s: user %s is not in %s", name, tenant.User, tenant.Domain)
+		}
+		tenant.Credentials = resolvePath(dir, tenant.Credentials)
+		if tenant.StateDir == "" {
+			tenant.StateDir = defaultFile(dir, dirs.State, filepath.Join("tenants", name))
+		}
+		tenant.StateDir = resolvePath(dir, tenant.StateDir)
+
+		if len(tenant.Tokens) == 0 {
+			return fmt.Errorf("tenant %s needs tokens for its tools to call zap serve with", name)
+		}
+		for i := range tenant.Tokens {
+			token := &tenant.Tokens[i]
+			if token.Name == "" {
+				token.Name = fmt.Sprintf("%s token %d", name, i+1)
+			}
+			if token.Token == "" {
+				return fmt.Errorf("tenant %s: %s has no token", name, token.Name)
+			}
+			if other, ok := seen[token.Token]; ok {
+				return fmt.Errorf("tenant %s: %s is also a token of tenant %s", name, token.Name, other)
+			}
+			seen[token.Token] = name
+			if token.Scope == "" {
+				token.Scope = ScopeRead
+			}
+			if !slices.Contains(scopes, token.Scope) {
+				return fmt.Errorf("tenant %s: %s has unsupported scope %q (want %s)", name, token.Name, token.Scope, strings.Join(scopes, ", "))
+			}
+			if token.User != "" && !tenant.inDomain(token.User) {
+				return fmt.Errorf("tenant %s: %s's user %s is not in %s", name, token.Name, token.User, tenant.Domain)
+			}
+		}
+	}
+	return nil
+}
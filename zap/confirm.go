@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"zap/tasks"
+)
+
+// maxConfirmShown is how many changes a confirmation lists before eliding
+// the rest
+const maxConfirmShown = 10
+
+// confirmer asks before each batch of changes is applied. Deletes need the
+// word delete typed out unless force is set; any other change needs a yes
+// unless yes is set.
+type confirmer struct {
+	in    *bufio.Reader
+	out   io.Writer
+	yes   bool
+	force bool
+
+	mu sync.Mutex
+}
+
+// confirm summarizes mutations on out and reads the answer from in. No
+// answer, e.g. when stdin is closed, is a no.
+func (c *confirmer) confirm(mutations []tasks.Mutation) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts := make(map[tasks.MutationKind]int)
+	for _, m := range mutations {
+		counts[m.Kind]++
+	}
+	deletes := counts[tasks.MutationDelete] > 0
+	if deletes && c.force || !deletes && c.yes {
+		return true
+	}
+
+	var kinds []string
+	for _, kind := range []tasks.MutationKind{tasks.MutationMove, tasks.MutationPriority, tasks.MutationInsert, tasks.MutationUpdate, tasks.MutationDelete} {
+		if counts[kind] > 0 {
+			kinds = append(kinds, fmt.Sprintf("%d %s", counts[kind], kind))
+		}
+	}
+	fmt.Fprintf(c.out, "\nAbout to make %d changes (%s):\n", len(mutations), strings.Join(kinds, ", "))
+	for _, m := range mutations[:min(len(mutations), maxConfirmShown)] {
+		fmt.Fprintf(c.out, "  %s\n", m.Summary)
+	}
+	if len(mutations) > maxConfirmShown {
+		fmt.Fprintf(c.out, "  ... and %d more\n", len(mutations)-maxConfirmShown)
+	}
+
+	if deletes {
+		fmt.Fprint(c.out, "This deletes tasks. Type delete to go ahead (--force skips this): ")
+		answer, _ := c.in.ReadString('\n')
+		return strings.TrimSpace(answer) == "delete"
+	}
+	fmt.Fprint(c.out, "Apply them? [y]es, [N]o, or [a]ll to stop asking (--yes skips this): ")
+	answer, _ := c.in.ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "a", "all":
+		c.yes = true
+		return true
+	case "y", "yes":
+		return true
+	}
+	return false
+}
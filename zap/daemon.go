@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"zap/config"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDelay lets an editor finish saving before the config is read
+const reloadDelay = 500 * time.Millisecond
+
+// runDaemon repeats the normal run on an interval until interrupted. Each
+// run also materializes recurring tasks whose previous instance was completed.
+// Changes to the config file, and to the experiment's prompt, take effect
+// from the next run without a restart. 'zap daemon install' sets it up as a
+// systemd or launchd service instead.
+func runDaemon(args []string) {
+	if len(args) > 0 {
+		switch args[0] {
+		case "install", "uninstall", "status":
+			runDaemonService(args[0], args[1:])
+			return
+		}
+	}
+
+	flags := flag.NewFlagSet("daemon", flag.ExitOnError)
+	runOpts := registerRunFlags(flags)
+	interval := flags.Duration("interval", 30*time.Minute, "Time between runs")
+	healthAddr := flags.String("health", "", "Serve /healthz and /readyz on this address, e.g. :8080 in a container")
+	flags.Parse(args)
+
+	// Nobody is there to confirm changes; deleting tasks still takes --force
+	*runOpts.yes = true
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	_, configPath, _ := loadConfig(flags, *runOpts.configPath)
+	app, err := runOpts.newApp(ctx, flags)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() { app.Close() }()
+
+	// Without a config file the defaults are in use, and there is nothing
+	// to watch
+	var changes <-chan []string
+	stopWatching := func() {}
+	watch := func() {
+		if _, err := os.Stat(configPath); err != nil {
+			return
+		}
+		var watchCtx context.Context
+		watchCtx, stopWatching = context.WithCancel(ctx)
+		var err error
+		changes, err = watchFiles(watchCtx, configPath, experimentPrompt(app.profile))
+		if err != nil {
+			log.Printf("Not watching %s for changes: %v", configPath, err)
+		}
+	}
+	watch()
+
+	var status health
+	if *healthAddr != "" {
+		go func() {
+			if err := status.serve(ctx, *healthAddr); err != nil {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	log.Printf("Daemon started; running every %s", *interval)
+	if app.experiment != nil && app.profile.Experiment.ShadowDays > 0 {
+		log.Printf("Experiment %s ranks in shadow for %d days before it is promoted", app.experiment.Name(), app.profile.Experiment.ShadowDays)
+	}
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		err := app.run(ctx)
+		if err != nil {
+			log.Printf("Run failed: %v", err)
+		}
+		status.set(err)
+
+	wait:
+		select {
+		case <-ctx.Done():
+			app.reportCheckpoints()
+			log.Println("Daemon stopped")
+			return
+		case changed := <-changes:
+			if reloaded := reloadApp(ctx, flags, runOpts, configPath, app, changed); reloaded != nil {
+				prompt := experimentPrompt(app.profile)
+				app.Close()
+				app = reloaded
+				if experimentPrompt(app.profile) != prompt {
+					stopWatching()
+					watch()
+				}
+			}
+			goto wait
+		case <-ticker.C:
+		}
+	}
+}
+
+// reloadApp reads the config again after the changed files were saved and
+// sets up the next runs with it. It returns nil, leaving the daemon on the
+// config it has, when nothing changed, the config is invalid or the
+// profile's clients can't be created.
+func reloadApp(ctx context.Context, flags *flag.FlagSet, runOpts *runFlags, configPath string, current *app, changed []string) *app {
+	cfg, _, _, err := findConfig(flags, *runOpts.configPath)
+	var profile *config.Profile
+	if err == nil {
+		profile, err = cfg.Profile(*runOpts.profileName)
+	}
+	if err != nil {
+		log.Printf("Ignoring the changes to %s, which is invalid: %v", configPath, err)
+		return nil
+	}
+
+	changes := config.Diff(current.profile, profile)
+	promptChanged := false
+	if prompt := experimentPrompt(profile); prompt != "" {
+		prompt, _ = filepath.Abs(prompt)
+		promptChanged = slices.Contains(changed, prompt)
+	}
+	if len(changes) == 0 && !promptChanged {
+		return nil
+	}
+	reloaded, err := runOpts.profileApp(ctx, profile)
+	if err != nil {
+		log.Printf("Ignoring the changes to %s: %v", configPath, err)
+		return nil
+	}
+	if len(changes) == 0 {
+		log.Printf("Reloaded the prompt of experiment %s", profile.Experiment.Name)
+	} else {
+		log.Printf("Reloaded %s:\n  %s", configPath, strings.Join(changes, "\n  "))
+	}
+	return reloaded
+}
+
+// experimentPrompt returns the prompt file a profile's experiment ranks
+// with, if any
+func experimentPrompt(profile *config.Profile) string {
+	if profile.Experiment == nil {
+		return ""
+	}
+	return profile.Experiment.Prompt
+}
+
+// watchFiles reports which of the named files changed, by absolute path,
+// once a burst of writes has settled. Their directories are watched, since
+// editors often save by replacing a file. Empty names are skipped.
+func watchFiles(ctx context.Context, names ...string) (<-chan []string, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	watched, dirs := make(map[string]bool), make(map[string]bool)
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		name, err := filepath.Abs(name)
+		if err != nil {
+			watcher.Close()
+			return nil, err
+		}
+		if dir := filepath.Dir(name); !dirs[dir] {
+			if err := watcher.Add(dir); err != nil {
+				watcher.Close()
+				return nil, err
+			}
+			dirs[dir] = true
+		}
+		watched[name] = true
+	}
+
+	changes := make(chan []string)
+	go func() {
+		defer watcher.Close()
+		var settle <-chan time.Time
+		var changed []string
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-watcher.Events:
+				name := filepath.Clean(event.Name)
+				if !watched[name] || event.Has(fsnotify.Chmod) {
+					continue
+				}
+				if !slices.Contains(changed, name) {
+					changed = append(changed, name)
+				}
+				settle = time.After(reloadDelay)
+			case err := <-watcher.Errors:
+				log.Printf("Error watching the config: %v", err)
+			case <-settle:
+				select {
+				case changes <- changed:
+					settle, changed = nil, nil
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return changes, nil
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"zap/config"
+	"zap/jobs"
+	"zap/tasks"
+	"zap/todo"
+	"zap/web"
+)
+
+const (
+	// tokenCookie holds the API token of a browser signed in to the
+	// dashboard
+	tokenCookie = "zap_token"
+	// dashboardTasksShown caps the tasks the dashboard shows per list
+	dashboardTasksShown = 25
+)
+
+// registerDashboard adds the dashboard's pages and buttons to mux
+func (s *server) registerDashboard(mux *http.ServeMux) {
+	mux.HandleFunc("GET /{$}", s.dashboard)
+	mux.HandleFunc("POST /signin", s.signIn)
+	mux.HandleFunc("POST /signout", s.signOut)
+	mux.Handle("GET /runs/{id}/events", s.page(config.ScopeRead, s.runEvents))
+	mux.Handle("POST /prioritize", s.page(config.ScopeRun, s.prioritizeList))
+	mux.Handle("POST /subtasks", s.page(config.ScopeRun, s.breakDown))
+	mux.Handle("POST /jobs/{id}/retry", s.page(config.ScopeRun, s.retryFromDashboard))
+}
+
+// cookieToken returns the token the browser signed in with, if any
+func cookieToken(r *http.Request) string {
+	cookie, err := r.Cookie(tokenCookie)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// sameOrigin reports whether a form was posted from the dashboard itself.
+// Browsers send the origin with every post; requests without one don't come
+// from a page.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	return origin == "" || origin == "http://"+r.Host || origin == "https://"+r.Host
+}
+
+// page wraps the handler of a dashboard button: only browsers signed in
+// with a token that allows scope may use them, from the dashboard's own
+// pages
+func (s *server) page(scope string, handler sessionHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !sameOrigin(r) {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+		sess, _, code, err := s.session(cookieToken(r), r.URL.Query().Get("user"), scope)
+		if code == http.StatusUnauthorized {
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), code)
+			return
+		}
+		handler(w, r, sess)
+	})
+}
+
+// signIn keeps the API token in a cookie when it is the right one
+func (s *server) signIn(w http.ResponseWriter, r *http.Request) {
+	if !sameOrigin(r) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+	token := r.PostFormValue("token")
+	if _, _, ok := authorize(s.tenants, token); token == "" || !ok {
+		log.Printf("Failed dashboard sign-in from %s", r.RemoteAddr)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusUnauthorized)
+		web.WriteSignIn(w, true)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     tokenCookie,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		// Other sites' pages can't post the dashboard's forms with it
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// signOut forgets the browser's token
+func (s *server) signOut(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{Name: tokenCookie, Path: "/", MaxAge: -1})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// dashboard shows the target lists with their rankings and the recent
+// runs, or the sign-in page
+func (s *server) dashboard(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	sess, token, code, err := s.session(cookieToken(r), r.URL.Query().Get("user"), config.ScopeRead)
+	if code == http.StatusUnauthorized {
+		web.WriteSignIn(w, false)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	a := sess.app
+	d := web.Dashboard{
+		Tenant:   sess.tenant,
+		User:     sess.user,
+		DryRun:   a.dryRun,
+		CanRun:   token.Allows(config.ScopeRun),
+		CanActAs: token.Allows(config.ScopeAdmin) && sess.tenant != "",
+		Subtasks: a.gemini != nil,
+	}
+	runs, err := sess.jobs.List()
+	if err != nil {
+		log.Printf("Error reading the jobs of %s for the dashboard: %v", sess, err)
+	}
+	d.Runs = sess.runReports(runs[:min(len(runs), maxRunReports)])
+	// Follow the run in progress, or else the next one queued
+	for _, job := range runs {
+		if !job.Done() && (!d.Running || job.State == jobs.Running) {
+			d.Running = true
+			d.Events = "/runs/" + job.ID + "/events?user=" + url.QueryEscape(sess.user)
+		}
+	}
+	// A run holds the app until it finishes; the page doesn't wait for it
+	if sess.mu.TryLock() {
+		lists, err := dashboardLists(a)
+		sess.mu.Unlock()
+		d.Lists = lists
+		if err != nil {
+			log.Printf("Error fetching the lists for the dashboard: %v", err)
+			d.Error = fmt.Sprintf("Unable to fetch the lists: %v", err)
+		}
+	} else {
+		d.Busy = true
+	}
+
+	// Render fully first, so a failure doesn't leave half a page
+	var page bytes.Buffer
+	if err := web.WriteDashboard(&page, d); err != nil {
+		log.Printf("Error rendering the dashboard: %v", err)
+		http.Error(w, "unable to render the dashboard", http.StatusInternalServerError)
+		return
+	}
+	page.WriteTo(w)
+}
+
+// dashboardLists returns the open top-level tasks of the target lists in
+// order, with their latest rankings
+func dashboardLists(a *app) ([]web.List, error) {
+	history := tasks.NewHistory(a.store, true)
+	records, err := history.Records()
+	if err != nil {
+		return nil, err
+	}
+	a.service.ResetCache()
+
+	var lists []web.List
+	for _, title := range a.profile.TargetLists {
+		taskList, err := a.service.GetTaskListByTitle(title)
+		if err != nil {
+			return lists, err
+		}
+		listTasks, err := a.service.ListTasks(taskList.ID)
+		if err != nil {
+			return lists, fmt.Errorf("error fetching tasks for list %s: %w", title, err)
+		}
+		list := web.List{Title: taskList.Title}
+		if runs, err := history.Runs(taskList.ID); err == nil && len(runs) > 0 {
+			latest := runs[len(runs)-1]
+			list.Ranked, list.RankedBy = latest.Time, latest.Source
+		}
+
+		tree := tasks.NewTaskTree(listTasks)
+		var open []*todo.Task
+		for _, task := range tree.TopLevel() {
+			if task.Parent == "" && task.Status != "completed" && !a.filter.Excludes(task) {
+				open = append(open, task)
+			}
+		}
+		list.Open = len(open)
+		for i, task := range open {
+			if i == dashboardTasksShown {
+				list.More = len(open) - dashboardTasksShown
+				break
+			}
+			row := web.Task{Title: task.Title, Subtasks: len(tree.Children(task.ID))}
+			if day, ok := a.clock.ParseDue(task.Due); ok {
+				row.Due = day.Format("Mon 2006-01-02")
+			}
+			if record, ok := records[task.ID]; ok {
+				row.Ranked = true
+				row.Priority = record.Priority
+				row.Explanation = record.Explanation
+			}
+			list.Tasks = append(list.Tasks, row)
+		}
+		lists = append(lists, list)
+	}
+	return lists, nil
+}
+
+// runReports sums up the runs of jobs, with the progress of those still
+// going
+func (sess *session) runReports(queued []jobs.Job) []web.Run {
+	runs := make([]web.Run, 0, len(queued))
+	for _, job := range queued {
+		r := jobReport(job)
+		if report := sess.report(job.ID); report != nil && !job.Done() {
+			r = sess.apiReport(report)
+		}
+		run := web.Run{
+			ID:       job.ID,
+			Trigger:  job.Trigger,
+			Started:  job.Started,
+			State:    job.State,
+			Finished: job.Done(),
+			Retry:    job.State == jobs.Failed,
+		}
+		if run.Started.IsZero() {
+			run.Started = job.Enqueued
+		}
+		if run.Finished {
+			run.Took = job.Finished.Sub(job.Started)
+		}
+		if job.State == jobs.Queued && !job.RetryAt.IsZero() {
+			run.State = fmt.Sprintf("retrying at %s", job.RetryAt.Local().Format("15:04"))
+		}
+		for _, list := range r.Lists {
+			line := fmt.Sprintf("%s: ranked %d tasks", list.Title, list.Tasks)
+			if list.RankedBy != "" {
+				line += " by " + list.RankedBy
+			}
+			run.Lines = append(run.Lines, fmt.Sprintf("%s, %d moved", line, list.Moves))
+		}
+		for _, subtasks := range r.Subtasks {
+			run.Lines = append(run.Lines, fmt.Sprintf("%s: created %d subtasks", subtasks.List, subtasks.Created))
+		}
+		for _, skipped := range r.Skipped {
+			run.Lines = append(run.Lines, "Skipped over budget: "+skipped)
+		}
+		run.Errors = r.Errors
+		for _, warning := range r.Warnings {
+			run.Warnings = append(run.Warnings, fmt.Sprintf("Left out %s: %s; fix: %s", warning.List, warning.Problem, warning.Fix))
+		}
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+// dashboardList returns the target list a button was pressed for; empty
+// means every list
+func dashboardList(r *http.Request, sess *session) (string, bool) {
+	list := r.PostFormValue("list")
+	return list, list == "" || slices.Contains(sess.app.profile.TargetLists, list)
+}
+
+// prioritizeList queues a run of one target list, or of them all
+func (s *server) prioritizeList(w http.ResponseWriter, r *http.Request, sess *session) {
+	list, ok := dashboardList(r, sess)
+	if !ok {
+		http.Error(w, fmt.Sprintf("%s is not a target list", list), http.StatusBadRequest)
+		return
+	}
+	if list == "" {
+		s.startFromDashboard(w, r, sess, "Dashboard: prioritize all lists", jobPrioritize, nil)
+		return
+	}
+	s.startFromDashboard(w, r, sess, "Dashboard: prioritize "+list, jobPrioritize, []string{list})
+}
+
+// breakDown queues creating subtasks in one target list
+func (s *server) breakDown(w http.ResponseWriter, r *http.Request, sess *session) {
+	list, ok := dashboardList(r, sess)
+	if !ok || list == "" {
+		http.Error(w, "a target list is required", http.StatusBadRequest)
+		return
+	}
+	s.startFromDashboard(w, r, sess, "Dashboard: create subtasks in "+list, jobSubtasks, []string{list})
+}
+
+// startFromDashboard queues a run and goes back to the dashboard, which
+// shows its progress
+func (s *server) startFromDashboard(w http.ResponseWriter, r *http.Request, sess *session, trigger, kind string, lists []string) {
+	if _, err := sess.start(trigger, kind, lists); err != nil {
+		log.Printf("Unable to queue a run for %s: %v", sess, err)
+		http.Error(w, "unable to queue the run", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/?user="+url.QueryEscape(sess.user), http.StatusSeeOther)
+}
+
+// retryFromDashboard queues a run that failed for good again
+func (s *server) retryFromDashboard(w http.ResponseWriter, r *http.Request, sess *session) {
+	job, err := sess.jobs.Retry(r.PathValue("id"))
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, jobs.ErrNotFailed):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("Unable to retry a job of %s: %v", sess, err)
+		http.Error(w, "unable to retry the run", http.StatusInternalServerError)
+		return
+	}
+	sess.track(job)
+	http.Redirect(w, r, "/?user="+url.QueryEscape(sess.user), http.StatusSeeOther)
+}
@@ -0,0 +1,124 @@
+package datetime
+
+import (
+	"fmt"
+	"time"
+)
+
+// The Tasks API stores due dates as midnight UTC ("2025-03-01T00:00:00.000Z")
+// and drops the time of day. Clock interprets those dates as calendar days in
+// the user's time zone so "due today" means the user's today.
+
+// DueLayout is the format the Tasks API uses for due dates
+const DueLayout = "2006-01-02T00:00:00.000Z"
+
+// Urgency buckets how soon a task is due
+type Urgency string
+
+const (
+	UrgencyOverdue  Urgency = "overdue"
+	UrgencyToday    Urgency = "today"
+	UrgencyTomorrow Urgency = "tomorrow"
+	UrgencyThisWeek Urgency = "this-week"
+	UrgencyLater    Urgency = "later"
+	UrgencyNone     Urgency = "none"
+)
+
+// Clock answers date questions in a fixed time zone
+type Clock struct {
+	loc *time.Location
+	now func() time.Time
+}
+
+// NewClock creates a clock for an IANA time zone name such as
+// "Europe/Berlin". An empty name uses the system's local zone.
+func NewClock(timezone string) (*Clock, error) {
+	loc := time.Local
+	if timezone != "" {
+		var err error
+		loc, err = time.LoadLocation(timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time zone %q: %v", timezone, err)
+		}
+	}
+	return &Clock{loc: loc, now: time.Now}, nil
+}
+
+// NewFixedClock creates a clock that always reads now, so prompts and
+// rankings that mention today's date are reproducible
+func NewFixedClock(timezone string, now time.Time) (*Clock, error) {
+	c, err := NewClock(timezone)
+	if err != nil {
+		return nil, err
+	}
+	c.now = func() time.Time { return now }
+	return c, nil
+}
+
+// Location returns the clock's time zone
+func (c *Clock) Location() *time.Location {
+	return c.loc
+}
+
+// Now returns the current time in the clock's time zone
+func (c *Clock) Now() time.Time {
+	return c.now().In(c.loc)
+}
+
+// Today returns midnight of the current day in the clock's time zone
+func (c *Clock) Today() time.Time {
+	now := c.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, c.loc)
+}
+
+// ParseDue returns the calendar day of an API due date as midnight in the
+// clock's time zone. It reports false for empty or invalid values.
+func (c *Clock) ParseDue(due string) (time.Time, bool) {
+	if due == "" {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339, due)
+	if err != nil {
+		return time.Time{}, false
+	}
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, c.loc), true
+}
+
+// FormatDue turns a calendar day into an API due date
+func FormatDue(day time.Time) string {
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC).Format(DueLayout)
+}
+
+// DaysUntil returns the number of days from today to the due date, negative
+// when overdue. It reports false when the task has no due date.
+func (c *Clock) DaysUntil(due string) (int, bool) {
+	day, ok := c.ParseDue(due)
+	if !ok {
+		return 0, false
+	}
+	today := c.Today()
+	// Compare calendar dates in UTC so DST changes don't skew the count
+	from := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+	to := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	return int(to.Sub(from).Hours() / 24), true
+}
+
+// Urgency buckets a due date relative to today
+func (c *Clock) Urgency(due string) Urgency {
+	days, ok := c.DaysUntil(due)
+	switch {
+	case !ok:
+		return UrgencyNone
+	case days < 0:
+		return UrgencyOverdue
+	case days == 0:
+		return UrgencyToday
+	case days == 1:
+		return UrgencyTomorrow
+	case days <= 7:
+		return UrgencyThisWeek
+	default:
+		return UrgencyLater
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"zap/budget"
+	"zap/config"
+	"zap/gemini"
+	"zap/tasks"
+	"zap/todo"
+)
+
+// runDelegate asks the model which tasks teammates could take over and
+// moves the ones the user confirms to the teammate's Google Tasks
+func runDelegate(args []string) {
+	flags := flag.NewFlagSet("delegate", flag.ExitOnError)
+	runOpts := registerRunFlags(flags)
+	var listTitles listFlag
+	flags.Var(&listTitles, "list", "Task list to look for delegable tasks in (repeatable; default: the profile's target lists)")
+	flags.Parse(args)
+
+	ctx := context.Background()
+	app, err := runOpts.newApp(ctx, flags)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer app.Close()
+	if len(listTitles) == 0 {
+		listTitles = app.profile.TargetLists
+	}
+
+	if err := app.delegate(ctx, listTitles, app.in); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// teammateTasks is a teammate's list that delegated tasks are created in
+type teammateTasks struct {
+	list         *todo.TaskList
+	orchestrator *tasks.Orchestrator
+}
+
+// delegate goes through the lists' open top-level tasks, asks which could
+// be delegated and, after confirmation, hands each one over with its open
+// subtasks. Dry runs print the handovers without asking.
+func (a *app) delegate(ctx context.Context, listTitles []string, in *bufio.Reader) error {
+	if len(a.profile.Team) == 0 {
+		return fmt.Errorf("the profile has no team to delegate to; list teammates under team")
+	}
+	if a.profile.Auth != config.AuthServiceAccount {
+		return fmt.Errorf("delegating needs service-account auth, to create tasks as each teammate")
+	}
+	if err := a.requireGemini(); err != nil {
+		return err
+	}
+
+	team := make([]gemini.Teammate, len(a.profile.Team))
+	for i, teammate := range a.profile.Team {
+		team[i] = gemini.Teammate{Name: teammate.Name, Skills: teammate.Skills}
+	}
+	teammates := make(map[string]*teammateTasks)
+
+	delegated := 0
+	for _, listTitle := range listTitles {
+		n, err := a.delegateList(ctx, listTitle, team, teammates, in)
+		delegated += n
+		if err != nil {
+			return err
+		}
+	}
+	if !a.dryRun {
+		fmt.Printf("Delegated %d tasks\n", delegated)
+	}
+	return nil
+}
+
+// delegateList offers the delegable tasks of one list, returning how many
+// were handed over
+func (a *app) delegateList(ctx context.Context, listTitle string, team []gemini.Teammate, teammates map[string]*teammateTasks, in *bufio.Reader) (int, error) {
+	taskList, err := a.service.GetTaskListByTitle(listTitle)
+	if err != nil {
+		return 0, fmt.Errorf("error finding task list %s: %w", listTitle, err)
+	}
+	listLock, err := a.lockList(ctx, taskList)
+	if err != nil {
+		return 0, err
+	}
+	defer listLock.Release()
+
+	listTasks, err := a.service.ListTasks(taskList.ID)
+	if err != nil {
+		return 0, fmt.Errorf("error fetching tasks for list %s: %w", listTitle, err)
+	}
+	tree := tasks.NewTaskTree(listTasks)
+	var open []*todo.Task
+	for _, task := range tree.TopLevel() {
+		if task.Parent == "" && task.Status != "completed" {
+			open = append(open, task)
+		}
+	}
+	if len(open) == 0 {
+		fmt.Printf("No open tasks in list: %s\n", listTitle)
+		return 0, nil
+	}
+
+	suggestions, err := a.gemini.SuggestDelegations(ctx, open, team)
+	if err != nil {
+		return 0, &exitError{code: exitLLM, err: fmt.Errorf("error suggesting delegations for list %s: %v", listTitle, err)}
+	}
+	if len(suggestions) == 0 {
+		fmt.Printf("Nothing in list %s looks delegable\n", listTitle)
+		return 0, nil
+	}
+
+	byID := make(map[string]*todo.Task, len(open))
+	for _, task := range open {
+		byID[task.ID] = task
+	}
+	delegated := 0
+	for _, suggestion := range suggestions {
+		task := byID[suggestion.TaskID]
+		teammate := a.teammate(suggestion.Delegate)
+		fmt.Printf("'%s' in %s could go to %s: %s\n", task.Title, listTitle, teammate.Name, suggestion.Reason)
+		if !a.dryRun && !confirm(in, fmt.Sprintf("Move it to %s's list %s?", teammate.Name, teammate.List)) {
+			continue
+		}
+
+		target, ok := teammates[teammate.Name]
+		if !ok {
+			target, err = a.teammateTasks(ctx, teammate)
+			if err != nil {
+				return delegated, fmt.Errorf("unable to open %s's tasks: %w", teammate.Name, err)
+			}
+			teammates[teammate.Name] = target
+		}
+		if err := a.handOver(ctx, taskList, task, tree.Children(task.ID), teammate, target); err != nil {
+			return delegated, err
+		}
+		delegated++
+	}
+	return delegated, nil
+}
+
+// teammate returns the profile's teammate with the given name
+func (a *app) teammate(name string) config.Teammate {
+	for _, teammate := range a.profile.Team {
+		if teammate.Name == name {
+			return teammate
+		}
+	}
+	return config.Teammate{Name: name}
+}
+
+// teammateTasks impersonates a teammate to find the list delegated tasks go
+// to. Writes count against the profile's budget.
+func (a *app) teammateTasks(ctx context.Context, teammate config.Teammate) (*teammateTasks, error) {
+	client, err := createTasksClient(ctx, a.profile, a.profile.Scopes, teammate.Email, a.dryRun)
+	if err != nil {
+		return nil, err
+	}
+	service, err := tasks.NewService(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	taskList, err := service.GetTaskListByTitle(teammate.List)
+	if err != nil {
+		return nil, err
+	}
+
+	// Handovers are confirmed one by one, so the copies aren't asked about
+	// again; deleting the originals is
+	var writer tasks.Writer = service
+	if a.budget != nil {
+		writer = budget.WrapWriter(service, a.budget)
+	}
+	if a.dryRun {
+		writer = tasks.NewDryRunWriter(a.progress.Out())
+	}
+	return &teammateTasks{list: taskList, orchestrator: tasks.NewOrchestrator(writer)}, nil
+}
+
+// handOver recreates a task and its open subtasks in the teammate's list,
+// noting who delegated it, and deletes the originals once the copies exist
+func (a *app) handOver(ctx context.Context, taskList *todo.TaskList, task *todo.Task, subtasks []*todo.Task, teammate config.Teammate, target *teammateTasks) error {
+	delegatedBy := "Delegated"
+	if a.userEmail != "" {
+		delegatedBy += " by " + a.userEmail
+	}
+	copied := &todo.Task{
+		Title:  task.Title,
+		Notes:  strings.TrimSpace(a.namespace.User(task.Notes) + "\n\n" + delegatedBy + " via zap"),
+		Due:    task.Due,
+		Status: "needsAction",
+	}
+	results, err := target.orchestrator.Apply(ctx, []tasks.Mutation{{
+		Kind:       tasks.MutationInsert,
+		TaskListID: target.list.ID,
+		Task:       copied,
+		Summary:    fmt.Sprintf("create '%s' in %s's list %s", task.Title, teammate.Name, teammate.List),
+	}})
+	if err != nil {
+		return err
+	}
+	parent := results[0].Task
+
+	var inserts, deletes []tasks.Mutation
+	for _, subtask := range subtasks {
+		deletes = append(deletes, tasks.Mutation{
+			Kind:       tasks.MutationDelete,
+			TaskListID: taskList.ID,
+			Task:       subtask,
+			Summary:    fmt.Sprintf("delete subtask '%s' from %s", subtask.Title, taskList.Title),
+		})
+		if subtask.Status == "completed" {
+			continue
+		}
+		inserts = append(inserts, tasks.Mutation{
+			Kind:       tasks.MutationInsert,
+			TaskListID: target.list.ID,
+			Task:       &todo.Task{Title: subtask.Title, Notes: subtask.Notes, Due: subtask.Due, Status: "needsAction"},
+			Parent:     parent.ID,
+			Summary:    fmt.Sprintf("create subtask '%s' under '%s' in %s's list %s", subtask.Title, task.Title, teammate.Name, teammate.List),
+		})
+	}
+	if len(inserts) > 0 {
+		if _, err := target.orchestrator.Apply(ctx, inserts); err != nil {
+			return fmt.Errorf("'%s' was copied to %s but not all of its subtasks; the original was kept: %v", task.Title, teammate.Name, err)
+		}
+	}
+
+	deletes = append(deletes, tasks.Mutation{
+		Kind:       tasks.MutationDelete,
+		TaskListID: taskList.ID,
+		Task:       task,
+		Summary:    fmt.Sprintf("delete '%s' from %s", task.Title, taskList.Title),
+	})
+	if _, err := a.orchestrator.Apply(ctx, deletes); err != nil {
+		return fmt.Errorf("'%s' was copied to %s but couldn't be removed from %s: %v", task.Title, teammate.Name, taskList.Title, err)
+	}
+	return nil
+}
+
+// confirm asks a yes/no question and reads the answer from in. Anything
+// but y or yes is a no.
+func confirm(in *bufio.Reader, question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := in.ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
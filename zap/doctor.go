@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"zap/auth"
+	"zap/config"
+	"zap/llm"
+	"zap/store"
+	"zap/tasks"
+
+	"google.golang.org/api/googleapi"
+	tasksapi "google.golang.org/api/tasks/v1"
+)
+
+// doctorModelTimeout bounds the request that checks the model is reachable
+const doctorModelTimeout = 30 * time.Second
+
+// doctorBucket holds the key written to check that the state file is writable
+const doctorBucket = "doctor"
+
+// runDoctor checks the selected profile end to end and prints a fix for
+// every problem it finds
+func runDoctor(args []string) {
+	flags := flag.NewFlagSet("doctor", flag.ExitOnError)
+	configPath := flags.String("config", "", configFlagUsage)
+	profileName := flags.String("profile", "", "Config profile to check")
+	userEmail := flags.String("u", "", "User email to impersonate (overrides the profile's user)")
+	flags.Parse(args)
+
+	d := &doctor{out: os.Stdout, profileName: *profileName}
+	d.run(context.Background(), flags, *configPath, *userEmail)
+
+	if d.failed > 0 {
+		fmt.Fprintf(d.out, "\n%d of %d checks failed.\n", d.failed, d.checks)
+		os.Exit(exitFailure)
+	}
+	fmt.Fprintf(d.out, "\nAll %d checks passed.\n", d.checks)
+}
+
+// doctor runs checks in order and prints each outcome as it goes
+type doctor struct {
+	out io.Writer
+	// profileName is the --profile flag, for the commands in fixes
+	profileName string
+	checks      int
+	failed      int
+}
+
+// pass reports a successful check
+func (d *doctor) pass(name, detail string) {
+	d.checks++
+	fmt.Fprintf(d.out, "ok    %s: %s\n", name, detail)
+}
+
+// warn reports a problem zap can work around, with how to fix it
+func (d *doctor) warn(name string, err error, fix string) {
+	d.checks++
+	fmt.Fprintf(d.out, "warn  %s: %v\n", name, err)
+	fmt.Fprintf(d.out, "      fix: %s\n", fix)
+}
+
+// fail reports a problem that stops zap from working, with how to fix it
+func (d *doctor) fail(name string, err error, fix string) {
+	d.checks++
+	d.failed++
+	fmt.Fprintf(d.out, "FAIL  %s: %v\n", name, err)
+	fmt.Fprintf(d.out, "      fix: %s\n", fix)
+}
+
+// skip reports a check that can't run because an earlier one failed
+func (d *doctor) skip(name, reason string) {
+	fmt.Fprintf(d.out, "skip  %s: %s\n", name, reason)
+}
+
+// run performs every check. Checks that depend on a failed one are skipped.
+func (d *doctor) run(ctx context.Context, flags *flag.FlagSet, configPath, userEmail string) {
+	cfg, path, _, err := findConfig(flags, configPath)
+	if err != nil {
+		d.fail("config", err, fmt.Sprintf("fix the YAML in %s, or pass --config with the right file", path))
+		return
+	}
+	profile, err := cfg.Profile(d.profileName)
+	if err != nil {
+		d.fail("config", err, fmt.Sprintf("pass --profile with one of the profiles in %s", path))
+		return
+	}
+	if _, statErr := os.Stat(path); statErr != nil {
+		d.pass("config", "no config file; using the defaults")
+	} else {
+		d.pass("config", path)
+	}
+
+	ctx, err = httpContext(ctx, profile)
+	if err != nil {
+		d.fail("network", err, "fix the http section of the profile")
+		return
+	}
+	if profile.HTTP != nil && profile.HTTP.Proxy != "" {
+		// The URL was checked when the config was loaded
+		proxy, _ := url.Parse(profile.HTTP.Proxy)
+		d.pass("network", "through proxy "+proxy.Redacted())
+	}
+
+	if userEmail == "" {
+		userEmail = profile.User
+	}
+	service := d.checkAuth(ctx, profile, userEmail)
+	if service == nil {
+		d.skip("tasks api", "authentication failed")
+		d.skip("target lists", "authentication failed")
+	} else {
+		d.checkLists(profile, service)
+	}
+
+	d.checkLLM(ctx, profile)
+	d.checkState(profile)
+}
+
+// checkAuth checks the credentials, the granted scopes and that zap can
+// act as the user. It returns nil when no client could be created.
+func (d *doctor) checkAuth(ctx context.Context, profile *config.Profile, userEmail string) *tasksapi.Service {
+	if profile.Auth == config.AuthOAuth {
+		return d.checkOAuth(ctx, profile)
+	}
+
+	authConfig, err := auth.NewConfig(profile.Credentials, profile.Scopes...)
+	if err != nil {
+		d.fail("credentials", err, fmt.Sprintf("download a service account key from the Google Cloud console and save it as %s, or set credentials in the profile", profile.Credentials))
+		d.skip("scopes", "no credentials")
+		d.skip("impersonation", "no credentials")
+		return nil
+	}
+	d.pass("credentials", profile.Credentials)
+	d.checkScopes(authConfig.ReadOnly(), authConfig.Scopes(),
+		fmt.Sprintf("add %s to the profile's scopes, or run zap with --read-only", auth.ScopeTasks))
+
+	if userEmail == "" {
+		d.fail("impersonation", errors.New("no user to impersonate"), "set user in the profile or pass -u")
+		return nil
+	}
+	scopes := delegatedScopes(authConfig, profile)
+	if err := authConfig.Preflight(ctx, userEmail, scopes...); err != nil {
+		var delegation *auth.DelegationError
+		if errors.As(err, &delegation) {
+			scopes = delegation.Missing
+		}
+		d.fail("impersonation", err, fmt.Sprintf("in the Admin console under Security > API controls > Domain-wide delegation, authorize client ID %s for %s",
+			authConfig.ClientID(), strings.Join(scopes, ",")))
+		return nil
+	}
+	service, err := authConfig.CreateClientAsUser(ctx, userEmail)
+	if err != nil {
+		d.fail("impersonation", err, "run zap doctor again; the check passed a moment ago")
+		return nil
+	}
+	d.pass("impersonation", "acting as "+userEmail)
+	return service
+}
+
+// checkOAuth checks the OAuth client and the cached login
+func (d *doctor) checkOAuth(ctx context.Context, profile *config.Profile) *tasksapi.Service {
+	login := "run 'zap login"
+	if d.profileName != "" {
+		login += " --profile " + d.profileName
+	}
+	login += "'"
+
+	oauthConfig, err := auth.NewOAuthConfig(profile.ClientSecret, profile.Scopes...)
+	if err != nil {
+		d.fail("credentials", err, fmt.Sprintf("download an OAuth client (Desktop app) from the Google Cloud console and save it as %s, or set client_secret in the profile", profile.ClientSecret))
+		d.skip("scopes", "no OAuth client")
+		d.skip("sign-in", "no OAuth client")
+		return nil
+	}
+	token, err := auth.LoadToken(profile.TokenFile)
+	if err != nil {
+		d.fail("credentials", err, login)
+		d.skip("scopes", "not signed in")
+		d.skip("sign-in", "not signed in")
+		return nil
+	}
+	d.pass("credentials", fmt.Sprintf("%s, token %s", profile.ClientSecret, profile.TokenFile))
+	d.checkScopes(token.ReadOnly(), token.Scopes, login+" without --read-only, or run zap with --read-only")
+
+	service, err := oauthConfig.CreateClient(ctx, token, profile.TokenFile)
+	if err != nil {
+		d.fail("sign-in", err, login)
+		return nil
+	}
+	d.pass("sign-in", "using the cached login")
+	return service
+}
+
+// checkScopes warns when the scopes only allow reading
+func (d *doctor) checkScopes(readOnly bool, scopes []string, fix string) {
+	if readOnly {
+		d.warn("scopes", fmt.Errorf("%v only allows read-only runs", scopes), fix)
+		return
+	}
+	d.pass("scopes", strings.Join(scopes, ", "))
+}
+
+// checkLists calls the Tasks API and looks up every target list
+func (d *doctor) checkLists(profile *config.Profile, taskService *tasksapi.Service) {
+	service, err := tasks.NewService(context.Background(), taskService, tasks.WithReadOnly())
+	if err != nil {
+		d.fail("tasks api", err, "check your network connection")
+		d.skip("target lists", "the Tasks API is unreachable")
+		return
+	}
+	taskLists, err := service.ListTaskLists()
+	if err != nil {
+		d.fail("tasks api", err, tasksAPIFix(err))
+		d.skip("target lists", "the Tasks API is unreachable")
+		return
+	}
+	d.pass("tasks api", fmt.Sprintf("%d task lists", len(taskLists)))
+
+	for _, title := range profile.TargetLists {
+		if _, err := service.GetTaskListByTitle(title); err != nil {
+			d.fail("target list", err, "create the list in Google Tasks, or fix target_lists in the profile")
+			continue
+		}
+		d.pass("target list", title)
+	}
+}
+
+// tasksAPIFix suggests a fix for a failed Tasks API call
+func tasksAPIFix(err error) string {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		for _, item := range apiErr.Errors {
+			if item.Reason == "accessNotConfigured" {
+				return "enable the Google Tasks API for the credentials' project in the Google Cloud console"
+			}
+		}
+	}
+	if auth.IsAuthError(err) {
+		return "check that the account has Google Tasks enabled and that the login or delegation grants the Tasks scopes"
+	}
+	return "check your network connection"
+}
+
+// checkLLM checks that the model's API key is set and that the model answers
+func (d *doctor) checkLLM(ctx context.Context, profile *config.Profile) {
+	keyEnv := llm.APIKeyEnv(profile.LLM)
+	provider, err := llm.New(ctx, profile.LLM)
+	if errors.Is(err, llm.ErrNoAPIKey) {
+		d.warn("llm key", err, fmt.Sprintf("export %s='your-api-key'; without it tasks are ranked heuristically and no subtasks are created", keyEnv))
+		d.skip("model", "no API key")
+		return
+	}
+	if err != nil {
+		d.fail("llm key", err, "fix the profile's llm section")
+		d.skip("model", "no provider")
+		return
+	}
+	defer provider.Close()
+	if keyEnv != "" {
+		d.pass("llm key", keyEnv+" is set")
+	} else {
+		d.pass("llm key", "not needed for "+provider.Name())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, doctorModelTimeout)
+	defer cancel()
+	if _, err := provider.Generate(ctx, llm.Request{Prompt: "Reply with the single word OK."}); err != nil {
+		fix := "check that llm.model names a model you can use and that the provider is reachable"
+		if keyEnv != "" {
+			fix = fmt.Sprintf("check that %s holds a valid key, that llm.model names a model you can use and that the provider is reachable", keyEnv)
+		}
+		d.fail("model", err, fix)
+		return
+	}
+	d.pass("model", provider.Name()+" answered")
+}
+
+// checkState checks that the state file and audit log can be written
+func (d *doctor) checkState(profile *config.Profile) {
+	fix := fmt.Sprintf("make sure %s exists and is writable, or set state_file in the profile", filepath.Dir(profile.StateFile))
+	st, err := store.Open(profile.StateFile)
+	if err == nil {
+		err = st.Put(doctorBucket, "checked", time.Now().UTC())
+	}
+	if err == nil {
+		err = st.Delete(doctorBucket, "checked")
+	}
+	if err != nil {
+		d.fail("state file", err, fix)
+	} else {
+		d.pass("state file", profile.StateFile)
+	}
+
+	if profile.Audit == nil {
+		return
+	}
+	_, statErr := os.Stat(profile.Audit.Path)
+	f, err := os.OpenFile(profile.Audit.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		d.fail("audit log", err, fmt.Sprintf("make sure %s exists and is writable, or set audit.path in the profile", filepath.Dir(profile.Audit.Path)))
+		return
+	}
+	f.Close()
+	if os.IsNotExist(statErr) {
+		// Don't leave an empty log behind
+		os.Remove(profile.Audit.Path)
+	}
+	d.pass("audit log", profile.Audit.Path)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"zap/notify"
+	"zap/tasks"
+	"zap/todo"
+)
+
+// escalationBucket records which escalated tasks the user was notified about
+const escalationBucket = "escalation"
+
+// escalationNotice is stored per task so each escalation is announced once
+type escalationNotice struct {
+	Due string `json:"due"`
+}
+
+// escalationPolicy builds the prioritizer's policy from the profile
+func (a *app) escalationPolicy() *tasks.EscalationPolicy {
+	policy := &tasks.EscalationPolicy{
+		OverdueDays: a.profile.Escalation.OverdueDays,
+		Marker:      a.profile.Escalation.Marker,
+	}
+	if a.profile.Escalation.Notify {
+		policy.OnEscalate = a.notifyEscalation
+	}
+	return policy
+}
+
+// notifyEscalation sends one notification per escalated task, and again if
+// its due date changes while it stays overdue
+func (a *app) notifyEscalation(ctx context.Context, listTitle string, task *todo.Task, daysOverdue int) {
+	var notice escalationNotice
+	found, err := a.store.Get(escalationBucket, task.ID, &notice)
+	if err != nil {
+		log.Printf("Error reading escalation state: %v", err)
+		return
+	}
+	if found && notice.Due == task.Due {
+		return
+	}
+
+	msg := notify.Message{
+		Title: fmt.Sprintf("Overdue: %s", task.Title),
+		Body:  fmt.Sprintf("'%s' in %s is %d days overdue and was moved to the top.", task.Title, listTitle, daysOverdue),
+	}
+	if a.dryRun {
+		a.progress.Printf("  would notify: %s\n", msg.Title)
+		return
+	}
+	if err := a.notifier.Notify(ctx, msg); err != nil {
+		log.Printf("Error sending notification: %v", err)
+		return
+	}
+	if err := a.store.Put(escalationBucket, task.ID, escalationNotice{Due: task.Due}); err != nil {
+		log.Printf("Error saving escalation state: %v", err)
+	}
+}
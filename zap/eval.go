@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"zap/experiment"
+	"zap/tasks"
+)
+
+// runEval scores the orders earlier runs ranked the profile's target lists
+// in against the order their tasks were completed in, per provider and
+// ranking prompt and per week
+func runEval(args []string) {
+	flags := flag.NewFlagSet("eval", flag.ExitOnError)
+	runOpts := registerRunFlags(flags)
+	var listTitles listFlag
+	flags.Var(&listTitles, "list", "Task list to evaluate (repeatable; default: the profile's target lists)")
+	days := flags.Int("days", 7, "Count tasks completed within this many days after a run")
+	weeks := flags.Int("weeks", 8, "Number of weeks of scores to show")
+	output := flags.String("output", outputText, "Output format: text or json")
+	flags.Parse(args)
+	if *output != outputText && *output != outputJSON {
+		log.Fatalf("unknown output format %q (want %s or %s)", *output, outputText, outputJSON)
+	}
+	if *days < 1 {
+		log.Fatal("--days must be at least 1")
+	}
+	if *weeks < 1 {
+		log.Fatal("--weeks must be at least 1")
+	}
+	*runOpts.readOnly = true
+	if *output == outputJSON {
+		runOpts.out = os.Stderr
+	}
+
+	ctx := context.Background()
+	app, err := runOpts.newApp(ctx, flags)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer app.Close()
+
+	if len(listTitles) == 0 {
+		listTitles = app.profile.TargetLists
+	}
+	var listIDs []string
+	completed := make(map[string]time.Time)
+	for _, listTitle := range listTitles {
+		taskList, err := app.service.GetTaskListByTitle(listTitle)
+		if err != nil {
+			log.Fatal(err)
+		}
+		listIDs = append(listIDs, taskList.ID)
+		listTasks, err := app.service.ListAllTasks(ctx, taskList.ID)
+		if err != nil {
+			log.Fatalf("Error fetching tasks for list %s: %v", listTitle, err)
+		}
+		for _, task := range listTasks {
+			if task.Status != "completed" || task.Completed == "" || task.Deleted {
+				continue
+			}
+			if at, err := time.Parse(time.RFC3339, task.Completed); err == nil {
+				completed[task.ID] = at
+			}
+		}
+	}
+	runs, err := tasks.NewHistory(app.store, true).Runs(listIDs...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Variants ranked in shadow by experiments are scored like applied rankings
+	trials, err := experiment.Trials(app.store, "")
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, trial := range trials {
+		if trial.Error == "" && slices.Contains(listIDs, trial.ListID) {
+			runs = append(runs, trial.VariantRun())
+		}
+	}
+
+	eval := tasks.Evaluate(runs, completed, app.clock, *days, *weeks)
+	if *output == outputJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(eval); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	printEval(eval)
+}
+
+// printEval prints the scores as tables
+func printEval(eval tasks.Evaluation) {
+	if eval.Runs == 0 {
+		fmt.Printf("No runs to score yet: none ranked a task that was completed within %d days after it.\n", eval.Days)
+		return
+	}
+	fmt.Printf("Scored %d runs against the tasks completed within %d days after each.\n\n", eval.Runs, eval.Days)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CONFIGURATION\tRUNS\tTAU\tFIRST DONE IN TOP 3")
+	for _, config := range eval.Configs {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", config.Config, config.Runs, formatTau(config.Tau), formatRate(config.HitRate))
+	}
+	w.Flush()
+
+	fmt.Println()
+	fmt.Fprintln(w, "WEEK\tSTARTING\tRUNS\tTAU\tFIRST DONE IN TOP 3")
+	for _, week := range eval.Weeks {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", week.Week, week.Start, week.Runs, formatTau(week.Tau), formatRate(week.HitRate))
+	}
+	w.Flush()
+
+	fmt.Println()
+	if eval.Best == "" {
+		fmt.Println("No configuration has enough scored runs to compare yet.")
+		return
+	}
+	fmt.Printf("Best configuration: %s\n", eval.Best)
+}
+
+// formatTau formats a correlation, or "-" for weeks without runs
+func formatTau(tau *float64) string {
+	if tau == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%+.2f", *tau)
+}
+
+// formatRate formats a share as a percentage, or "-" for weeks without runs
+func formatRate(rate *float64) string {
+	if rate == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f%%", *rate*100)
+}
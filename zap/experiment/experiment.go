@@ -0,0 +1,246 @@
+// Package experiment ranks lists with a variant prompt or model next to
+// the ranking that is applied, in shadow: both rankings of the same tasks
+// are logged with how they differ, and only the applied one ever changes
+// the lists.
+package experiment
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"zap/datetime"
+	"zap/gemini"
+	"zap/store"
+	"zap/tasks"
+	"zap/todo"
+)
+
+// bucket holds the trials, keyed by experiment, list ID and time
+const bucket = "experiments"
+
+// maxTrials is how many of the latest trials are kept per experiment
+const maxTrials = 200
+
+// topTasks is how many of the first tasks of both rankings are compared
+const topTasks = 3
+
+// Arm is one ranking of a trial and what made it. Prompt identifies the
+// ranking prompt; it is empty for the heuristic.
+type Arm struct {
+	Source     string                `json:"source"`
+	Prompt     string                `json:"prompt,omitempty"`
+	Priorities []gemini.TaskPriority `json:"priorities,omitempty"`
+}
+
+// Move is a task the two rankings put in different places, by rank
+type Move struct {
+	TaskID  string `json:"taskId"`
+	Title   string `json:"title"`
+	Control int    `json:"control"`
+	Variant int    `json:"variant"`
+}
+
+// Trial is one list ranked by both the applied configuration, the
+// control, and the experiment's variant. Tau is the Kendall rank
+// correlation of the two, from -1 (reversed) to 1 (the same); TopOverlap
+// counts the tasks both put in their first three. A variant that failed to
+// rank has Error set and nothing to compare.
+type Trial struct {
+	Experiment string    `json:"experiment"`
+	Time       time.Time `json:"time"`
+	ListID     string    `json:"listId"`
+	List       string    `json:"list"`
+	Control    Arm       `json:"control"`
+	Variant    Arm       `json:"variant"`
+	Error      string    `json:"error,omitempty"`
+	Tau        float64   `json:"tau"`
+	TopOverlap int       `json:"topOverlap"`
+	Moves      []Move    `json:"moves,omitempty"`
+}
+
+// Runner ranks lists with an experiment's variant and keeps the trials
+type Runner struct {
+	name    string
+	variant *gemini.GeminiClient
+	store   *store.Store
+	clock   *datetime.Clock
+	// readOnly runners rank with the variant but keep no trials
+	readOnly bool
+}
+
+// New creates a runner for the experiment called name that ranks with
+// variant, or with the heuristic when it is nil. A read-only runner
+// doesn't change the store.
+func New(name string, variant *gemini.GeminiClient, st *store.Store, clock *datetime.Clock, readOnly bool) *Runner {
+	return &Runner{name: name, variant: variant, store: st, clock: clock, readOnly: readOnly}
+}
+
+// Name returns the experiment's name
+func (r *Runner) Name() string {
+	return r.name
+}
+
+// Variant returns the client the variant ranks with; nil for the heuristic
+func (r *Runner) Variant() *gemini.GeminiClient {
+	return r.variant
+}
+
+// Run ranks tasks with the variant from the same signals the control was
+// ranked from, compares the rankings and keeps the trial. The variant's
+// ranking is never applied.
+func (r *Runner) Run(ctx context.Context, listID, listTitle string, listTasks []*todo.Task, signals gemini.RankSignals, control Arm) (Trial, error) {
+	trial := Trial{Experiment: r.name, Time: r.clock.Now(), ListID: listID, List: listTitle, Control: control}
+	if r.variant == nil {
+		trial.Variant = Arm{Source: tasks.HeuristicSource, Priorities: tasks.HeuristicPriorities(listTasks, signals)}
+		compare(&trial, listTasks)
+		return trial, r.record(trial)
+	}
+	priorities, err := r.variant.AnalyzeAndPrioritizeTasks(ctx, listTasks, signals)
+	if err != nil {
+		trial.Error = err.Error()
+	} else {
+		trial.Variant = Arm{Source: r.variant.LastProvider(), Prompt: r.variant.RankPromptID(), Priorities: priorities}
+		compare(&trial, listTasks)
+	}
+	return trial, r.record(trial)
+}
+
+// compare fills in how the variant's ranking differs from the control's
+func compare(trial *Trial, listTasks []*todo.Task) {
+	titles := make(map[string]string, len(listTasks))
+	for _, task := range listTasks {
+		titles[task.ID] = task.Title
+	}
+	variantRank := make(map[string]int, len(trial.Variant.Priorities))
+	for i, priority := range trial.Variant.Priorities {
+		variantRank[priority.TaskID] = i + 1
+	}
+
+	var controlRanks, variantRanks []int
+	for i, priority := range trial.Control.Priorities {
+		rank, ok := variantRank[priority.TaskID]
+		if !ok {
+			continue
+		}
+		controlRanks = append(controlRanks, i+1)
+		variantRanks = append(variantRanks, rank)
+		if rank != i+1 {
+			trial.Moves = append(trial.Moves, Move{TaskID: priority.TaskID, Title: titles[priority.TaskID], Control: i + 1, Variant: rank})
+		}
+		if i < topTasks && rank <= topTasks {
+			trial.TopOverlap++
+		}
+	}
+	trial.Tau = 1
+	if tau, ok := tasks.KendallTau(controlRanks, variantRanks); ok {
+		trial.Tau = math.Round(tau*100) / 100
+	}
+}
+
+// record keeps a trial, dropping the experiment's oldest beyond maxTrials
+func (r *Runner) record(trial Trial) error {
+	if r.readOnly {
+		return nil
+	}
+	if err := r.store.Put(bucket, trialKey(trial), trial); err != nil {
+		return err
+	}
+	trials, err := Trials(r.store, r.name)
+	if err != nil {
+		return err
+	}
+	for _, old := range trials[:max(len(trials)-maxTrials, 0)] {
+		if err := r.store.Delete(bucket, trialKey(old)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// VariantRun returns the variant's ranking as a run, so it can be
+// evaluated like the rankings that were applied
+func (t Trial) VariantRun() tasks.RunSnapshot {
+	run := tasks.RunSnapshot{ListID: t.ListID, Time: t.Time, Source: t.Variant.Source, Prompt: t.Variant.Prompt}
+	for _, priority := range t.Variant.Priorities {
+		run.Order = append(run.Order, priority.TaskID)
+	}
+	return run
+}
+
+// trialKey is where a trial is kept in bucket
+func trialKey(trial Trial) string {
+	return trial.Experiment + "/" + trial.ListID + "@" + trial.Time.UTC().Format(time.RFC3339Nano)
+}
+
+// Trials returns the kept trials of the named experiment, or of every
+// experiment when name is empty, oldest first
+func Trials(st *store.Store, name string) ([]Trial, error) {
+	var trials []Trial
+	for _, key := range st.Keys(bucket) {
+		var trial Trial
+		if _, err := st.Get(bucket, key, &trial); err != nil {
+			return nil, err
+		}
+		if name == "" || trial.Experiment == name {
+			trials = append(trials, trial)
+		}
+	}
+	sort.SliceStable(trials, func(i, j int) bool {
+		return trials[i].Time.Before(trials[j].Time)
+	})
+	return trials, nil
+}
+
+// Summary is how far an experiment's variant diverged from the control on
+// one list. Tau, TopOverlap and Moved are means over the trials the
+// variant ranked.
+type Summary struct {
+	Experiment string  `json:"experiment"`
+	List       string  `json:"list"`
+	Trials     int     `json:"trials"`
+	Failed     int     `json:"failed"`
+	Identical  int     `json:"identical"`
+	Tau        float64 `json:"tau"`
+	TopOverlap float64 `json:"topOverlap"`
+	Moved      float64 `json:"moved"`
+}
+
+// Summarize sums up trials per experiment and list, in the order each
+// first appears
+func Summarize(trials []Trial) []Summary {
+	var summaries []Summary
+	index := make(map[[2]string]int)
+	for _, trial := range trials {
+		key := [2]string{trial.Experiment, trial.List}
+		i, ok := index[key]
+		if !ok {
+			i = len(summaries)
+			index[key] = i
+			summaries = append(summaries, Summary{Experiment: trial.Experiment, List: trial.List})
+		}
+		summary := &summaries[i]
+		summary.Trials++
+		if trial.Error != "" {
+			summary.Failed++
+			continue
+		}
+		if len(trial.Moves) == 0 {
+			summary.Identical++
+		}
+		summary.Tau += trial.Tau
+		summary.TopOverlap += float64(trial.TopOverlap)
+		summary.Moved += float64(len(trial.Moves))
+	}
+	for i := range summaries {
+		ranked := float64(summaries[i].Trials - summaries[i].Failed)
+		if ranked == 0 {
+			continue
+		}
+		summaries[i].Tau = math.Round(summaries[i].Tau/ranked*100) / 100
+		summaries[i].TopOverlap = math.Round(summaries[i].TopOverlap/ranked*10) / 10
+		summaries[i].Moved = math.Round(summaries[i].Moved/ranked*10) / 10
+	}
+	return summaries
+}
@@ -0,0 +1,69 @@
+package experiment
+
+import (
+	"time"
+
+	"zap/store"
+)
+
+// Rollout is how far an experiment got towards being applied: it has run
+// in shadow since Started, and its variant ranks the lists since Promoted
+type Rollout struct {
+	Started  time.Time `json:"started"`
+	Promoted time.Time `json:"promoted,omitempty"`
+}
+
+// rolloutBucket holds each experiment's rollout, keyed by its name
+const rolloutBucket = "experiment-rollouts"
+
+// LoadRollout returns the named experiment's rollout, if it started
+func LoadRollout(st *store.Store, name string) (Rollout, bool, error) {
+	var rollout Rollout
+	found, err := st.Get(rolloutBucket, name, &rollout)
+	return rollout, found, err
+}
+
+// Rollout returns the experiment's rollout, starting it now if it hasn't
+// started yet, and whether it was promoted just now. It is promoted once it has been in shadow for shadowDays
+// days, unless the variant failed to rank at least half of the lists it
+// was given; zero days never promotes it. Read-only runners work out the
+// rollout as usual, but don't keep it.
+func (r *Runner) Rollout(shadowDays int) (Rollout, bool, error) {
+	rollout, found, err := LoadRollout(r.store, r.name)
+	if err != nil {
+		return Rollout{}, false, err
+	}
+	now := r.clock.Now()
+	if !found {
+		rollout.Started = now
+		if err := r.saveRollout(rollout); err != nil {
+			return rollout, false, err
+		}
+	}
+	if !rollout.Promoted.IsZero() || shadowDays == 0 || now.Sub(rollout.Started) < time.Duration(shadowDays)*24*time.Hour {
+		return rollout, false, nil
+	}
+
+	trials, err := Trials(r.store, r.name)
+	if err != nil {
+		return rollout, false, err
+	}
+	var failed int
+	for _, trial := range trials {
+		if trial.Error != "" {
+			failed++
+		}
+	}
+	if len(trials) == 0 || failed*2 >= len(trials) {
+		return rollout, false, nil
+	}
+	rollout.Promoted = now
+	return rollout, true, r.saveRollout(rollout)
+}
+
+func (r *Runner) saveRollout(rollout Rollout) error {
+	if r.readOnly {
+		return nil
+	}
+	return r.store.Put(rolloutBucket, r.name, rollout)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"zap/experiment"
+	"zap/gemini"
+	"zap/todo"
+)
+
+// shadow ranks a list with the experiment's variant next to the ranking
+// that is applied, and reports how far they diverge
+func (a *app) shadow(ctx context.Context, listID, listTitle string, listTasks []*todo.Task, signals gemini.RankSignals, priorities []gemini.TaskPriority, source, prompt string) {
+	control := experiment.Arm{Source: source, Prompt: prompt, Priorities: priorities}
+	trial, err := a.experiment.Run(ctx, listID, listTitle, listTasks, signals, control)
+	if err != nil {
+		log.Printf("Error recording experiment %s for list %s: %v", a.experiment.Name(), listTitle, err)
+	}
+	if trial.Error != "" {
+		log.Printf("Experiment %s failed to rank list %s: %s", a.experiment.Name(), listTitle, trial.Error)
+		return
+	}
+	a.progress.Printf("Experiment %s on list %s: %d tasks ranked differently, %d of the top 3 shared (tau %.2f)\n", a.experiment.Name(), listTitle, len(trial.Moves), trial.TopOverlap, trial.Tau)
+}
+
+// rollout moves the experiment towards being applied and reports whether
+// its variant ranks the lists instead of the profile's configuration
+func (a *app) rollout() bool {
+	rollout, promotedNow, err := a.experiment.Rollout(a.profile.Experiment.ShadowDays)
+	if err != nil {
+		log.Printf("Error updating the rollout of experiment %s: %v", a.experiment.Name(), err)
+	}
+	if promotedNow {
+		days := int(rollout.Promoted.Sub(rollout.Started).Hours() / 24)
+		a.progress.Printf("Promoted experiment %s after %d days in shadow; its rankings are applied from now on\n", a.experiment.Name(), days)
+	}
+	return !rollout.Promoted.IsZero()
+}
+
+// runExperiments reports how far the rankings of experiments' variants
+// diverged from the rankings that were applied
+func runExperiments(args []string) {
+	flags := flag.NewFlagSet("experiments", flag.ExitOnError)
+	runOpts := registerRunFlags(flags)
+	name := flags.String("name", "", "Only report on this experiment (default: every experiment)")
+	trials := flags.Int("trials", 0, "Also show the differences of this many of the latest trials")
+	output := flags.String("output", outputText, "Output format: text or json")
+	flags.Parse(args)
+	if *output != outputText && *output != outputJSON {
+		log.Fatalf("unknown output format %q (want %s or %s)", *output, outputText, outputJSON)
+	}
+	*runOpts.readOnly = true
+	if *output == outputJSON {
+		runOpts.out = os.Stderr
+	}
+
+	ctx := context.Background()
+	app, err := runOpts.newApp(ctx, flags)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer app.Close()
+
+	kept, err := experiment.Trials(app.store, *name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	latest := kept[max(len(kept)-*trials, 0):]
+	summaries := experiment.Summarize(kept)
+	rollouts := make(map[string]experiment.Rollout)
+	for _, summary := range summaries {
+		rollout, found, err := experiment.LoadRollout(app.store, summary.Experiment)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if found {
+			rollouts[summary.Experiment] = rollout
+		}
+	}
+	if *output == outputJSON {
+		report := struct {
+			Summaries []experiment.Summary          `json:"summaries"`
+			Rollouts  map[string]experiment.Rollout `json:"rollouts"`
+			Trials    []experiment.Trial            `json:"trials,omitempty"`
+		}{summaries, rollouts, latest}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(kept) == 0 {
+		fmt.Println("No experiment trials yet. Configure an experiment in the profile and run zap.")
+		return
+	}
+	printExperiments(summaries, rollouts, latest)
+}
+
+// printExperiments prints the summaries as a table, followed by the
+// differences of each trial
+func printExperiments(summaries []experiment.Summary, rollouts map[string]experiment.Rollout, trials []experiment.Trial) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "EXPERIMENT\tLIST\tSTATUS\tTRIALS\tFAILED\tIDENTICAL\tTAU\tTOP 3 SHARED\tTASKS MOVED")
+	for _, s := range summaries {
+		status := "shadow"
+		if rollout, ok := rollouts[s.Experiment]; ok {
+			status = "shadow since " + rollout.Started.Local().Format("2006-01-02")
+			if !rollout.Promoted.IsZero() {
+				status = "promoted " + rollout.Promoted.Local().Format("2006-01-02")
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\t%+.2f\t%.1f\t%.1f\n", s.Experiment, s.List, status, s.Trials, s.Failed, s.Identical, s.Tau, s.TopOverlap, s.Moved)
+	}
+	w.Flush()
+
+	for _, trial := range trials {
+		fmt.Printf("\n%s, %s on %s: %s", trial.Experiment, trial.List, trial.Time.Local().Format("2006-01-02 15:04"), arm(trial.Control))
+		if trial.Error != "" {
+			fmt.Printf(" vs. failed variant: %s\n", trial.Error)
+			continue
+		}
+		fmt.Printf(" vs. %s\n", arm(trial.Variant))
+		if len(trial.Moves) == 0 {
+			fmt.Println("  Same order")
+			continue
+		}
+		for _, move := range trial.Moves {
+			fmt.Fprintf(w, "  %d -> %d\t%s\n", move.Control, move.Variant, move.Title)
+		}
+		w.Flush()
+	}
+}
+
+// arm names the provider and prompt of a ranking
+func arm(a experiment.Arm) string {
+	if a.Prompt == "" {
+		return a.Source
+	}
+	return a.Source + "/" + a.Prompt
+}
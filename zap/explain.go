@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"zap/gemini"
+	"zap/tasks"
+	"zap/todo"
+)
+
+// explainNeighbors is how many siblings above and below are shown to Gemini
+const explainNeighbors = 2
+
+// runExplain asks Gemini why a task is ranked where it is
+func runExplain(args []string) {
+	flags := flag.NewFlagSet("explain", flag.ExitOnError)
+	runOpts := registerRunFlags(flags)
+	listTitle := flags.String("list", "", "Task list containing the task (default: the profile's target lists)")
+
+	positional := parseInterspersed(flags, args)
+	if len(positional) != 1 {
+		log.Fatal("usage: zap explain <task title or ID> [--list list]")
+	}
+
+	ctx := context.Background()
+	app, err := runOpts.newApp(ctx, flags)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer app.Close()
+	if err := app.requireGemini(); err != nil {
+		log.Fatal(err)
+	}
+
+	listTitles := app.profile.TargetLists
+	if *listTitle != "" {
+		listTitles = []string{*listTitle}
+	}
+
+	explanation, err := app.explain(ctx, positional[0], listTitles)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(explanation)
+}
+
+// explain finds the task in the first list containing it and asks Gemini to
+// justify its place among its siblings
+func (a *app) explain(ctx context.Context, query string, listTitles []string) (string, error) {
+	for _, listTitle := range listTitles {
+		taskList, err := a.service.GetTaskListByTitle(listTitle)
+		if err != nil {
+			return "", err
+		}
+		task, err := a.service.FindTask(taskList.ID, query)
+		if err != nil {
+			continue
+		}
+
+		listTasks, err := a.service.ListTasks(taskList.ID)
+		if err != nil {
+			return "", err
+		}
+		tree := tasks.NewTaskTree(listTasks)
+		siblings := tree.TopLevel()
+		if task.Parent != "" {
+			siblings = tree.Children(task.Parent)
+		}
+
+		index := 0
+		for i, sibling := range siblings {
+			if sibling.ID == task.ID {
+				index = i
+			}
+		}
+
+		history := tasks.NewHistory(a.store, true)
+		record, _, err := history.Get(task.ID)
+		if err != nil {
+			return "", err
+		}
+		bottomRuns, err := history.BottomRuns(siblingIDs(siblings))
+		if err != nil {
+			return "", err
+		}
+
+		explanation, err := a.gemini.ExplainRank(ctx, gemini.RankExplanation{
+			Task:            task,
+			Rank:            index + 1,
+			Of:              len(siblings),
+			Above:           siblings[max(0, index-explainNeighbors):index],
+			Below:           siblings[index+1 : min(len(siblings), index+1+explainNeighbors)],
+			LastExplanation: record.Explanation,
+			Signals:         gemini.RankSignals{Clock: a.clock, BottomRuns: bottomRuns},
+		})
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("'%s' is #%d of %d in %s\n\n%s", task.Title, index+1, len(siblings), taskList.Title, explanation), nil
+	}
+	return "", fmt.Errorf("task '%s' not found in %s", query, strings.Join(listTitles, ", "))
+}
+
+// siblingIDs returns the IDs of tasks in order
+func siblingIDs(siblings []*todo.Task) []string {
+	ids := make([]string, len(siblings))
+	for i, sibling := range siblings {
+		ids[i] = sibling.ID
+	}
+	return ids
+}
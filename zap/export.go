@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"zap/auth"
+	"zap/config"
+	"zap/sheets"
+	"zap/tasks"
+
+	sheetsapi "google.golang.org/api/sheets/v4"
+)
+
+// exportReport appends a run's report to the profile's spreadsheet. Only
+// runs that apply their changes are exported, and failures are recorded
+// without failing the run.
+func (a *app) exportReport(ctx context.Context, lists []tasks.ListResult) {
+	if a.profile.Sheets == nil || a.dryRun || a.replaying {
+		return
+	}
+	if a.sheets == nil {
+		service, err := createSheetsClient(ctx, a.profile, a.userEmail)
+		if err != nil {
+			log.Printf("Error connecting to Google Sheets: %v", err)
+			a.result.fail(fmt.Errorf("sheets export: %v", err))
+			return
+		}
+		a.sheets = sheets.New(service, a.profile.Sheets.SpreadsheetID, a.profile.Sheets.Sheet, a.userEmail)
+	}
+	if err := a.sheets.Append(ctx, a.clock.Now(), lists); err != nil {
+		log.Printf("Error exporting report to Google Sheets: %v", err)
+		a.result.fail(fmt.Errorf("sheets export: %v", err))
+		return
+	}
+	a.progress.Printf("Exported the report to sheet %s\n", a.profile.Sheets.Sheet)
+}
+
+// createSheetsClient authenticates to the Sheets API the same way the
+// Tasks client does: as the signed-in user or by impersonating userEmail
+func createSheetsClient(ctx context.Context, profile *config.Profile, userEmail string) (*sheetsapi.Service, error) {
+	ctx, err := httpContext(ctx, profile)
+	if err != nil {
+		return nil, err
+	}
+	if profile.Auth == config.AuthOAuth {
+		oauthConfig, err := auth.NewOAuthConfig(profile.ClientSecret, profile.Scopes...)
+		if err != nil {
+			return nil, err
+		}
+		token, err := auth.LoadToken(profile.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		return oauthConfig.CreateSheetsClient(ctx, token, profile.TokenFile)
+	}
+
+	authConfig, err := auth.NewConfig(profile.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	return authConfig.CreateSheetsClientAsUser(ctx, userEmail)
+}
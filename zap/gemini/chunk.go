@@ -0,0 +1,109 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+
+	"zap/llm"
+	"zap/todo"
+)
+
+// LastChunks is how many prompts the most recent ranking was split into to
+// fit the model's context window; one when it fit in a single prompt
+func (g *GeminiClient) LastChunks() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.lastChunks
+}
+
+// countTokens counts the tokens of a ranking prompt with the provider's
+// token-count endpoint and logs them. A provider that can't count, or a
+// count that fails, yields a zero count, and the prompt is sent as it is.
+func (g *GeminiClient) countTokens(ctx context.Context, prompt Prompt, tasks int) llm.TokenCount {
+	count, err := g.provider.CountTokens(ctx, llm.Request{System: prompt.System, Prompt: prompt.User, JSON: true})
+	if errors.Is(err, llm.ErrNoTokenCount) {
+		return llm.TokenCount{}
+	}
+	if err != nil {
+		log.Printf("Unable to count the tokens of the ranking prompt, sending it anyway: %v", err)
+		return llm.TokenCount{}
+	}
+	if count.Window > 0 {
+		log.Printf("Ranking prompt of %d tasks is %d tokens, of the %d %s takes", tasks, count.Tokens, count.Window, g.provider.Name())
+	} else {
+		log.Printf("Ranking prompt of %d tasks is %d tokens", tasks, count.Tokens)
+	}
+	return count
+}
+
+// rankChunks ranks tasks whose prompt is over the model's context window
+// in two halves, split again while they are still over, and merges the
+// rankings by priority. Tasks are dealt into the halves in turn, so each
+// half is a sample of the whole list and the priorities given in one are
+// comparable with the other's.
+func (g *GeminiClient) rankChunks(ctx context.Context, tasks []*todo.Task, signals RankSignals, count llm.TokenCount) (*RankSession, []TaskPriority, error) {
+	if len(tasks) < 2 {
+		return nil, nil, fmt.Errorf("ranking prompt of a single task is %d tokens, over the context window of %d", count.Tokens, count.Window)
+	}
+	log.Printf("Ranking prompt of %d tasks is over the context window of %d tokens; ranking them in two halves", len(tasks), count.Window)
+	var halves [2][]*todo.Task
+	for i, task := range tasks {
+		halves[i%2] = append(halves[i%2], task)
+	}
+
+	session := &RankSession{g: g, tasks: tasks, clock: signals.Clock}
+	var parts [][]TaskPriority
+	var corrections, truncated []string
+	chunks := 0
+	for _, half := range halves {
+		chunk, priorities, err := g.rankOnce(ctx, half, signals)
+		if err != nil {
+			return nil, nil, err
+		}
+		session.chunks = append(session.chunks, chunk)
+		parts = append(parts, priorities)
+		corrections = append(corrections, g.LastCorrections()...)
+		truncated = append(truncated, g.LastTruncated()...)
+		chunks += g.LastChunks()
+	}
+
+	g.mu.Lock()
+	g.lastCorrections = corrections
+	g.lastTruncated = truncated
+	g.lastChunks = chunks
+	g.mu.Unlock()
+	return session, mergeChunks(parts), nil
+}
+
+// refineChunks refines the ranking of every chunk with the same feedback
+// and merges them again
+func (s *RankSession) refineChunks(ctx context.Context, feedback string) ([]TaskPriority, error) {
+	parts := make([][]TaskPriority, len(s.chunks))
+	for i, chunk := range s.chunks {
+		priorities, err := chunk.Refine(ctx, feedback)
+		if err != nil {
+			return nil, err
+		}
+		parts[i] = priorities
+	}
+	return mergeChunks(parts), nil
+}
+
+// mergeChunks orders the rankings of chunks of a list as one, by priority,
+// and gives the tasks new positions in that order
+func mergeChunks(parts [][]TaskPriority) []TaskPriority {
+	var merged []TaskPriority
+	for _, part := range parts {
+		merged = append(merged, part...)
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Priority > merged[j].Priority
+	})
+	for i := range merged {
+		merged[i].NewPosition = fmt.Sprintf("%05d", i+1)
+	}
+	return merged
+}
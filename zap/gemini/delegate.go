@@ -0,0 +1,85 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"zap/todo"
+)
+
+// Teammate is someone tasks can be delegated to
+type Teammate struct {
+	Name   string   `json:"name"`
+	Skills []string `json:"skills,omitempty"`
+}
+
+// Delegation suggests handing a task to a teammate
+type Delegation struct {
+	TaskID   string `json:"taskId"`
+	Delegate string `json:"delegate"`
+	Reason   string `json:"reason"`
+}
+
+// SuggestDelegations asks which tasks someone else on the team could do
+// and who. Tasks that should stay with their owner are left out, as are
+// answers naming unknown tasks or teammates.
+func (g *GeminiClient) SuggestDelegations(ctx context.Context, tasks []*todo.Task, team []Teammate) ([]Delegation, error) {
+	ids := newAliases(tasks)
+	taskData := make([]map[string]interface{}, len(tasks))
+	for i, task := range g.promptTasks(tasks) {
+		taskData[i] = map[string]interface{}{
+			"id":    ids.alias(task.ID),
+			"title": task.Title,
+			"notes": task.Notes,
+		}
+	}
+	taskJSON, err := json.Marshal(taskData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal task data: %v", err)
+	}
+	teamJSON, err := json.Marshal(team)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal team: %v", err)
+	}
+
+	prompt := g.buildPrompt(`You are a team lead's assistant. Decide which of the tasks you are given could be delegated to one of the teammates you are given.
+
+Rules:
+1. Only suggest tasks that someone else can clearly do without the owner, such as well-defined work matching a teammate's skills
+2. Keep tasks that need the owner's judgment, authority or personal involvement (1:1s, reviews of others, decisions, personal errands)
+3. Pick the teammate whose skills fit the task best; use the exact name from the team
+4. Leave out tasks that shouldn't be delegated; an empty array is a fine answer
+5. Return ONLY a valid JSON array with no additional text
+
+Response format (strict JSON array):
+[
+  {"taskId": "task-id-1", "delegate": "Teammate name", "reason": "Routine frontend fix; matches their React experience"}
+]
+
+Respond with ONLY the JSON array, no other text.`, withLanguage, fmt.Sprintf("Team:\n%s\n\nTasks:\n%s", teamJSON, taskJSON))
+
+	var suggestions []Delegation
+	if err := g.generateJSON(ctx, prompt, &suggestions); err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool, len(tasks))
+	for _, task := range tasks {
+		known[task.ID] = true
+	}
+	names := make(map[string]bool, len(team))
+	for _, teammate := range team {
+		names[teammate.Name] = true
+	}
+	var delegations []Delegation
+	for _, suggestion := range suggestions {
+		suggestion.TaskID = ids.id(suggestion.TaskID)
+		if !known[suggestion.TaskID] || !names[suggestion.Delegate] {
+			continue
+		}
+		known[suggestion.TaskID] = false
+		delegations = append(delegations, suggestion)
+	}
+	return delegations, nil
+}
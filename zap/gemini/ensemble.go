@@ -0,0 +1,163 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"zap/llm"
+	"zap/todo"
+)
+
+// SetEnsemble has every list ranked samples times by the client's model
+// and once more by each of others, and ordered by the consensus of those
+// rankings. Single rankings shift from run to run; their consensus shifts
+// much less, for as many times the tokens.
+func (g *GeminiClient) SetEnsemble(samples int, others []llm.Provider) {
+	g.ensemble = nil
+	for i := 0; i < samples; i++ {
+		g.ensemble = append(g.ensemble, g.provider)
+	}
+	g.ensemble = append(g.ensemble, others...)
+	if len(g.ensemble) < 2 {
+		g.ensemble = nil
+	}
+}
+
+// EnsembleSize is how many rankings make up each ranking of a list, one
+// without an ensemble
+func (g *GeminiClient) EnsembleSize() int {
+	return max(len(g.ensemble), 1)
+}
+
+// sample is one ranking of an ensemble
+type sample struct {
+	session     *RankSession
+	priorities  []TaskPriority
+	provider    string
+	corrections []string
+	truncated   []string
+	chunks      int
+}
+
+// rankEnsemble ranks tasks with every member of the ensemble at once and
+// returns their consensus, with the conversation of the first ranking that
+// succeeded. Rankings that fail are left out; it fails only when all do.
+func (g *GeminiClient) rankEnsemble(ctx context.Context, tasks []*todo.Task, signals RankSignals) (*RankSession, []TaskPriority, error) {
+	samples := make([]*sample, len(g.ensemble))
+	errs := make([]error, len(g.ensemble))
+	var wg sync.WaitGroup
+	for i, provider := range g.ensemble {
+		member := g.Variant(provider)
+		// Seeded samples of one model would all be the same
+		if member.seed != 0 {
+			member.seed += int64(i)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			session, priorities, err := member.rankOnce(ctx, tasks, signals)
+			if err != nil {
+				errs[i] = fmt.Errorf("sample %d (%s): %w", i+1, provider.Name(), err)
+				return
+			}
+			session.g = g
+			samples[i] = &sample{session: session, priorities: priorities, provider: member.LastProvider(), corrections: member.LastCorrections(), truncated: member.LastTruncated(), chunks: member.LastChunks()}
+		}()
+	}
+	wg.Wait()
+
+	var succeeded []*sample
+	var providers, corrections []string
+	for i, s := range samples {
+		if s == nil {
+			log.Printf("Leaving ranking %s out of the consensus: %v", g.ensemble[i].Name(), errs[i])
+			continue
+		}
+		succeeded = append(succeeded, s)
+		if !slices.Contains(providers, s.provider) {
+			providers = append(providers, s.provider)
+		}
+		for _, correction := range s.corrections {
+			if !slices.Contains(corrections, correction) {
+				corrections = append(corrections, correction)
+			}
+		}
+	}
+	if len(succeeded) == 0 {
+		return nil, nil, errors.Join(errs...)
+	}
+
+	g.mu.Lock()
+	g.lastProvider = fmt.Sprintf("ensemble of %d: %s", len(succeeded), strings.Join(providers, ", "))
+	g.lastCorrections = corrections
+	g.lastTruncated = succeeded[0].truncated
+	g.lastChunks = succeeded[0].chunks
+	g.mu.Unlock()
+	rankings := make([][]TaskPriority, len(succeeded))
+	for i, s := range succeeded {
+		rankings[i] = s.priorities
+	}
+	return succeeded[0].session, consensus(rankings), nil
+}
+
+// consensus merges rankings of the same tasks by Borda count: in each
+// ranking a task scores a point for every task ranked below it, and the
+// tasks are ordered by their totals. Their priorities are the rankings'
+// mean priorities, handed out highest first in that order, so the order
+// holds when the tasks are sorted by priority later. Explanations are the
+// first ranking's.
+func consensus(rankings [][]TaskPriority) []TaskPriority {
+	type tally struct {
+		priority TaskPriority
+		points   int
+		sum      float64
+	}
+	tallies := make(map[string]*tally)
+	var ids []string
+	for _, ranking := range rankings {
+		ordered := append([]TaskPriority(nil), ranking...)
+		sort.SliceStable(ordered, func(i, j int) bool {
+			if ordered[i].Priority != ordered[j].Priority {
+				return ordered[i].Priority > ordered[j].Priority
+			}
+			return ordered[i].NewPosition < ordered[j].NewPosition
+		})
+		for rank, priority := range ordered {
+			t, ok := tallies[priority.TaskID]
+			if !ok {
+				t = &tally{priority: priority}
+				tallies[priority.TaskID] = t
+				ids = append(ids, priority.TaskID)
+			}
+			t.points += len(ordered) - 1 - rank
+			t.sum += priority.Priority
+		}
+	}
+
+	sort.SliceStable(ids, func(i, j int) bool {
+		a, b := tallies[ids[i]], tallies[ids[j]]
+		if a.points != b.points {
+			return a.points > b.points
+		}
+		return a.sum > b.sum
+	})
+	means := make([]float64, len(ids))
+	for i, id := range ids {
+		means[i] = tallies[id].sum / float64(len(rankings))
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(means)))
+
+	merged := make([]TaskPriority, len(ids))
+	for i, id := range ids {
+		merged[i] = tallies[id].priority
+		merged[i].Priority = means[i]
+		merged[i].NewPosition = fmt.Sprintf("%05d", i+1)
+	}
+	return merged
+}
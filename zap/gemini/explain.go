@@ -0,0 +1,71 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"zap/todo"
+)
+
+// RankExplanation is what ExplainRank needs to know about a task's placement
+type RankExplanation struct {
+	Task *todo.Task
+	// Rank is the task's 1-based position among its Of siblings
+	Rank int
+	Of   int
+	// Above and Below are the nearest siblings, closest last and first
+	Above []*todo.Task
+	Below []*todo.Task
+	// LastExplanation is the reason recorded when zap last ranked the task
+	LastExplanation string
+	Signals         RankSignals
+}
+
+// ExplainRank asks Gemini to justify why a task sits where it does relative
+// to its neighbors, in a few sentences of plain text
+func (g *GeminiClient) ExplainRank(ctx context.Context, r RankExplanation) (string, error) {
+	describe := func(task *todo.Task) map[string]interface{} {
+		sent := g.promptTask(task)
+		data := map[string]interface{}{
+			"title":   sent.Title,
+			"notes":   sent.Notes,
+			"urgency": r.Signals.Clock.Urgency(task.Due),
+		}
+		if days, ok := r.Signals.Clock.DaysUntil(task.Due); ok {
+			data["daysUntilDue"] = days
+		}
+		if runs := r.Signals.BottomRuns[task.ID]; runs > 0 {
+			data["runsInBottomQuartile"] = runs
+		}
+		return data
+	}
+	describeAll := func(tasks []*todo.Task) []map[string]interface{} {
+		out := make([]map[string]interface{}, len(tasks))
+		for i, task := range tasks {
+			out[i] = describe(task)
+		}
+		return out
+	}
+
+	contextJSON, err := json.MarshalIndent(map[string]interface{}{
+		"task":            describe(r.Task),
+		"position":        fmt.Sprintf("%d of %d", r.Rank, r.Of),
+		"tasksAbove":      describeAll(r.Above),
+		"tasksBelow":      describeAll(r.Below),
+		"lastExplanation": r.LastExplanation,
+	}, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal task data: %v", err)
+	}
+
+	prompt := g.buildPrompt(`You are a task prioritization assistant. Explain why the task you are given is ranked where it is relative to the tasks directly above and below it.
+
+Rules:
+1. Compare the task with its neighbors on urgency, due dates, priority markers, tags and notes
+2. Mention the earlier explanation if it is still relevant
+3. If the placement looks wrong, say so and suggest where it should go
+4. Answer in at most 5 short sentences of plain text, no markdown`, withLanguage, fmt.Sprintf("Today is %s.\n\n%s", r.Signals.Clock.Today().Format("Monday 2006-01-02"), contextJSON))
+
+	return g.generateText(ctx, prompt)
+}
@@ -2,15 +2,30 @@ package gemini
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"sort"
 	"strings"
-
-	"github.com/google/generative-ai-go/genai"
-	"google.golang.org/api/option"
-	tasksapi "google.golang.org/api/tasks/v1"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"zap/datetime"
+	"zap/llm"
+	"zap/notes"
+	"zap/redact"
+	"zap/tags"
+	"zap/todo"
 )
 
+// ErrNoSubtasksNeeded is returned by SuggestSubtasks when every top-level
+// task already has subtasks
+var ErrNoSubtasksNeeded = errors.New("no tasks found that need subtasks")
+
 type TaskPriority struct {
 	TaskID      string  `json:"taskId"`
 	Priority    float64 `json:"priority"`
@@ -24,66 +39,252 @@ type SubtaskSuggestion struct {
 	Rationale    string   `json:"rationale"`
 }
 
+const (
+	// GranularityMilestones asks for stages of work that take hours or days
+	GranularityMilestones = "milestones"
+	// GranularityChecklist asks for single items that take minutes
+	GranularityChecklist = "checklist"
+)
+
+// Breakdown is how SuggestSubtasks breaks tasks down: between Min and Max
+// subtasks per task, sized as Granularity, or as fits when it's empty
+type Breakdown struct {
+	Min         int
+	Max         int
+	Granularity string
+}
+
+// DefaultBreakdown asks for 1-3 subtasks of any size
+var DefaultBreakdown = Breakdown{Min: 1, Max: 3}
+
+// rule is the prompt's instruction for the breakdown
+func (b Breakdown) rule() string {
+	rule := fmt.Sprintf("Break down each task into %d-%d actionable subtasks", b.Min, b.Max)
+	if b.Min == b.Max {
+		rule = fmt.Sprintf("Break down each task into exactly %d actionable subtasks", b.Min)
+	}
+	switch b.Granularity {
+	case GranularityMilestones:
+		rule += "; each subtask is a milestone, a meaningful stage of the work that takes hours or days, not a single small action"
+	case GranularityChecklist:
+		rule += "; each subtask is a checklist item, one concrete action or thing to get that takes minutes to tick off"
+	}
+	return rule
+}
+
+// GeminiClient builds zap's prompts and parses the answers. Gemini was the
+// first model zap supported; any llm.Provider can answer the prompts. It
+// never writes to tasks itself; tasks.Orchestrator applies its suggestions.
 type GeminiClient struct {
-	client *genai.Client
-	model  *genai.GenerativeModel
-	tasks  *tasksapi.Service
+	provider llm.Provider
+	// redactor strips personal data from task text before it is sent
+	redactor *redact.Redactor
+	// seed is passed with every request; zero leaves sampling unseeded
+	seed int64
+	// language is the name of the language answers are written in; empty
+	// leaves it to the model
+	language string
+	// preferences summarizes how the user wants tasks ranked
+	preferences string
+	// rankTemplate replaces the built-in ranking prompt when set
+	rankTemplate string
+	// namespace is the block of zap's own notes, which isn't sent
+	namespace notes.Namespace
+	// ensemble holds the providers that each rank every list, the client's
+	// own once per sample; empty ranks once
+	ensemble []llm.Provider
+	// limits cap what is sent of each task and of ranking prompts
+	limits Limits
+	// summaries are the summaries of notes over the limit; nil only cuts them
+	summaries *noteSummaries
+	// rules are the organization's rules, stacked on every prompt
+	rules []string
+	// promptWriter receives every prompt as it is sent; nil for none
+	promptWriter io.Writer
+
+	mu              sync.Mutex
+	lastProvider    string
+	lastCorrections []string
+	lastTruncated   []string
+	lastChunks      int
 }
 
-func NewGeminiClient(apiKey string, tasksService *tasksapi.Service, modelName string) (*GeminiClient, error) {
-	ctx := context.Background()
-	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
+// NewGeminiClient creates a client backed by Gemini's public API
+func NewGeminiClient(apiKey string, modelName string) (*GeminiClient, error) {
+	provider, err := llm.NewGemini(context.Background(), apiKey, modelName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create Gemini client: %v", err)
+		return nil, err
 	}
+	return NewClient(provider), nil
+}
+
+// NewClient creates a client that sends prompts to provider
+func NewClient(provider llm.Provider) *GeminiClient {
+	return &GeminiClient{provider: provider, limits: DefaultLimits}
+}
+
+// Provider returns the model behind the client
+func (g *GeminiClient) Provider() llm.Provider {
+	return g.provider
+}
 
-	model := client.GenerativeModel(modelName)
+// SetRedactor makes the client redact task titles and notes in every
+// prompt. Answers refer to tasks by ID, so they still map to the originals.
+func (g *GeminiClient) SetRedactor(r *redact.Redactor) {
+	g.redactor = r
+}
+
+// SetSeed makes requests ask for seeded sampling, so repeated runs on the
+// same tasks get the same answers where the provider supports it
+func (g *GeminiClient) SetSeed(seed int64) {
+	g.seed = seed
+}
+
+// SetLanguage asks for titles, explanations and other text shown to the
+// user in the named language, e.g. "German"
+func (g *GeminiClient) SetLanguage(name string) {
+	g.language = name
+}
+
+// SetNamespace sets the namespace of zap's block in notes, which is left
+// out of prompts
+func (g *GeminiClient) SetNamespace(ns notes.Namespace) {
+	g.namespace = ns
+}
+
+// SetRankTemplate replaces the prompt that ranks lists. The template is
+// sent as the system instruction and must contain {tasks}, which refers to
+// the tasks sent as JSON in the user's turn, and may contain {today}; the
+// answer must have the built-in prompt's format.
+func (g *GeminiClient) SetRankTemplate(template string) error {
+	if !strings.Contains(template, tasksPlaceholder) {
+		return fmt.Errorf("ranking prompt has no %s placeholder", tasksPlaceholder)
+	}
+	g.rankTemplate = template
+	return nil
+}
 
-	// Set response constraints
-	model.SetTemperature(0.1) // Lower temperature for more consistent output
-	model.SafetySettings = []*genai.SafetySetting{
-		{
-			Category:  genai.HarmCategoryDangerousContent,
-			Threshold: genai.HarmBlockNone,
-		},
+// template returns the prompt that ranks lists
+func (g *GeminiClient) template() string {
+	if g.rankTemplate != "" {
+		return g.rankTemplate
 	}
+	return rankTemplate
+}
 
+// Variant returns a client with the same settings that sends prompts to
+// provider, or to the same provider when it is nil
+func (g *GeminiClient) Variant(provider llm.Provider) *GeminiClient {
+	if provider == nil {
+		provider = g.provider
+	}
 	return &GeminiClient{
-		client: client,
-		model:  model,
-		tasks:  tasksService,
-	}, nil
+		provider:     provider,
+		redactor:     g.redactor,
+		seed:         g.seed,
+		language:     g.language,
+		preferences:  g.preferences,
+		rankTemplate: g.rankTemplate,
+		namespace:    g.namespace,
+		limits:       g.limits,
+		summaries:    g.summaries,
+		rules:        g.rules,
+		promptWriter: g.promptWriter,
+	}
 }
 
-func (g *GeminiClient) AnalyzeAndPrioritizeTasks(ctx context.Context, tasks []*tasksapi.Task) ([]TaskPriority, error) {
-	// Convert tasks to a format suitable for Gemini analysis
-	taskData := make([]map[string]interface{}, len(tasks))
-	for i, task := range tasks {
-		taskData[i] = map[string]interface{}{
-			"id":       task.Id,
-			"title":    task.Title,
-			"due":      task.Due,
-			"notes":    task.Notes,
-			"position": task.Position,
+// languageRule is appended to prompts whose answers are shown to the user
+func (g *GeminiClient) languageRule() string {
+	if g.language == "" {
+		return ""
+	}
+	return fmt.Sprintf("\n\nWrite all text meant for the user, such as titles, explanations, reasons and steps, in %s. Keep IDs, list names, markers in square brackets, hashtags and JSON keys exactly as they are.", g.language)
+}
+
+// LastProvider names the provider that answered the most recent request,
+// which differs from Provider().Name() when a fallback chain is configured
+func (g *GeminiClient) LastProvider() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.lastProvider
+}
+
+// generate sends a request and remembers which provider answered it
+func (g *GeminiClient) generate(ctx context.Context, req llm.Request) (llm.Response, error) {
+	g.showPrompt(req)
+	resp, err := g.provider.Generate(ctx, req)
+	if err == nil {
+		g.mu.Lock()
+		g.lastProvider = resp.Provider
+		if g.lastProvider == "" {
+			g.lastProvider = g.provider.Name()
 		}
+		g.mu.Unlock()
 	}
+	return resp, err
+}
 
-	// Create the prompt for Gemini
-	taskJSON, err := json.Marshal(taskData)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal task data: %v", err)
+// RankSignals is what zap knows about tasks beyond their fields
+type RankSignals struct {
+	// Clock interprets due dates in the user's time zone
+	Clock *datetime.Clock
+	// BottomRuns counts, per task ID, the consecutive runs the task ranked
+	// in the bottom quartile of its list
+	BottomRuns map[string]int
+	// Effort holds, per task ID, the estimated and tracked effort
+	Effort map[string]Effort
+}
+
+// Effort is how long a task should take and how long it was worked on.
+// Estimate is already corrected for how tasks usually overrun their
+// estimates; zero fields are unknown.
+type Effort struct {
+	Estimate time.Duration
+	Spent    time.Duration
+}
+
+// describe adds the effort to a task's prompt data
+func (e Effort) describe(data map[string]interface{}) {
+	if e.Estimate > 0 {
+		data["estimatedMinutes"] = int(e.Estimate.Minutes())
+	}
+	if e.Spent > 0 {
+		data["spentMinutes"] = int(e.Spent.Minutes())
 	}
+}
+
+// AnalyzeAndPrioritizeTasks ranks tasks. Due dates are sent as calendar
+// days in the user's time zone together with the derived urgency and how
+// long each task has been stuck near the bottom.
+func (g *GeminiClient) AnalyzeAndPrioritizeTasks(ctx context.Context, tasks []*todo.Task, signals RankSignals) ([]TaskPriority, error) {
+	_, priorities, err := g.StartRanking(ctx, tasks, signals)
+	return priorities, err
+}
+
+// Placeholders of the ranking prompt
+const (
+	todayPlaceholder = "{today}"
+	tasksPlaceholder = "{tasks}"
+)
+
+// tasksReference takes the place of the tasks in the ranking prompt's
+// system instruction; the tasks themselves are the user's turn
+const tasksReference = "(sent as the user's message)"
 
-	prompt := fmt.Sprintf(`You are a task prioritization assistant. Your job is to analyze the following tasks and return a JSON array of prioritized tasks.
+// rankTemplate is the prompt that ranks a list, with placeholders for
+// today's date and the tasks
+const rankTemplate = `You are a task prioritization assistant. Your job is to analyze the following tasks and return a JSON array of prioritized tasks.
 
 Rules:
-1. Analyze due dates - tasks with closer due dates get higher priority
+1. Analyze due dates - tasks with closer due dates get higher priority. Today is {today}; daysUntilDue is negative for overdue tasks
 2. Look for priority markers in titles like [HIGH], [URGENT], [P1]
-3. Consider task complexity and dependencies from notes
-4. Return ONLY a valid JSON array with no additional text or markdown formatting
+3. Consider task complexity and dependencies from notes. estimatedMinutes is the expected effort, corrected for how long the user's tasks usually take; spentMinutes is time already worked on the task
+4. Tasks tagged "waiting" are blocked on someone else - rank them below every task that can be worked on now
+5. runsInBottomQuartile counts consecutive runs a task has been ranked near the bottom. Raise such tasks gradually, especially small ones, so they are not buried forever
+6. Return ONLY a valid JSON array with no additional text or markdown formatting
 
 Input tasks:
-%s
+{tasks}
 
 Response format (strict JSON array):
 [
@@ -98,52 +299,97 @@ Response format (strict JSON array):
 
 The priority should be a number between 0-100, with higher numbers indicating higher priority.
 The newPosition should be a string of 5 digits, ordered from highest to lowest priority (00001 being highest).
-Respond with ONLY the JSON array, no other text.`, string(taskJSON))
+Respond with ONLY the JSON array, no other text.`
 
-	// Send request to Gemini
-	resp, err := g.model.GenerateContent(ctx, genai.Text(prompt))
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate content: %v", err)
-	}
-
-	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
-		return nil, fmt.Errorf("no response from Gemini")
-	}
-
-	// Parse the response
-	responseText := resp.Candidates[0].Content.Parts[0].(genai.Text)
-
-	// Clean up the response text
-	cleanJSON := strings.TrimSpace(string(responseText))
-	cleanJSON = strings.TrimPrefix(cleanJSON, "```json")
-	cleanJSON = strings.TrimPrefix(cleanJSON, "```")
-	cleanJSON = strings.TrimSuffix(cleanJSON, "```")
-	cleanJSON = strings.TrimSpace(cleanJSON)
+// RankPromptID identifies the ranking prompt, so evaluations can tell apart
+// rankings made before and after it changed
+func (g *GeminiClient) RankPromptID() string {
+	sum := sha256.Sum256([]byte(g.template()))
+	return hex.EncodeToString(sum[:4])
+}
 
-	var priorities []TaskPriority
-	if err := json.Unmarshal([]byte(cleanJSON), &priorities); err != nil {
-		return nil, fmt.Errorf("failed to parse Gemini response: %v\nResponse was: %s", err, cleanJSON)
+// rankPrompt builds the prompt that ranks tasks. A prompt over the limit
+// is built again with the notes cut shorter, and without notes as a last
+// resort, until it fits. It returns the titles of the tasks that were cut.
+func (g *GeminiClient) rankPrompt(tasks []*todo.Task, signals RankSignals, ids aliases) (Prompt, []string, error) {
+	notesLimit := g.limits.Notes
+	if notesLimit <= 0 {
+		for _, task := range tasks {
+			notesLimit = max(notesLimit, utf8.RuneCountInString(task.Notes))
+		}
 	}
-
-	// Validate the response
-	if len(priorities) != len(tasks) {
-		return nil, fmt.Errorf("received incorrect number of priorities: got %d, want %d", len(priorities), len(tasks))
+	for {
+		prompt, truncated, err := g.buildRankPrompt(tasks, signals, ids, notesLimit)
+		if err != nil || g.limits.Prompt <= 0 {
+			return prompt, truncated, err
+		}
+		size := utf8.RuneCountInString(prompt.System) + utf8.RuneCountInString(prompt.User)
+		switch {
+		case size <= g.limits.Prompt:
+			return prompt, truncated, nil
+		case notesLimit < 0:
+			return Prompt{}, nil, fmt.Errorf("ranking prompt of %d tasks is %d characters even without notes, over the limit of %d", len(tasks), size, g.limits.Prompt)
+		case notesLimit/2 < minNotesLimit:
+			notesLimit = -1
+		default:
+			notesLimit /= 2
+		}
 	}
+}
 
-	// Ensure all tasks have valid priorities and positions
-	for i := range priorities {
-		if priorities[i].Priority < 0 || priorities[i].Priority > 100 {
-			priorities[i].Priority = 50 // Default to middle priority if invalid
+// buildRankPrompt builds the prompt that ranks tasks with their notes cut
+// to notesLimit, and names the tasks that were cut
+func (g *GeminiClient) buildRankPrompt(tasks []*todo.Task, signals RankSignals, ids aliases, notesLimit int) (Prompt, []string, error) {
+	clock := signals.Clock
+	var truncated []string
+	// Convert tasks to a format suitable for Gemini analysis
+	taskData := make([]map[string]interface{}, len(tasks))
+	for i, task := range tasks {
+		sent, cut := g.cutTask(task, notesLimit)
+		if cut {
+			truncated = append(truncated, task.Title)
+		}
+		data := map[string]interface{}{
+			"id":       ids.alias(task.ID),
+			"title":    sent.Title,
+			"notes":    sent.Notes,
+			"position": task.Position,
+			"tags":     tags.Of(task),
+			"urgency":  clock.Urgency(task.Due),
 		}
-		if len(priorities[i].NewPosition) != 5 {
-			priorities[i].NewPosition = fmt.Sprintf("%05d", i+1) // Generate position if invalid
+		if day, ok := clock.ParseDue(task.Due); ok {
+			days, _ := clock.DaysUntil(task.Due)
+			data["due"] = day.Format("2006-01-02")
+			data["daysUntilDue"] = days
 		}
+		if runs := signals.BottomRuns[task.ID]; runs > 0 {
+			data["runsInBottomQuartile"] = runs
+		}
+		signals.Effort[task.ID].describe(data)
+		taskData[i] = data
+	}
+
+	// Create the prompt for Gemini
+	taskJSON, err := json.Marshal(taskData)
+	if err != nil {
+		return Prompt{}, nil, fmt.Errorf("failed to marshal task data: %v", err)
 	}
 
-	return priorities, nil
+	base := strings.NewReplacer(
+		todayPlaceholder, clock.Today().Format("Monday 2006-01-02"),
+		tasksPlaceholder, tasksReference,
+	).Replace(g.template())
+	return g.buildPrompt(base, withPreferences|withLanguage, string(taskJSON)), truncated, nil
 }
 
-func (g *GeminiClient) SuggestSubtasks(ctx context.Context, tasks []*tasksapi.Task) ([]SubtaskSuggestion, error) {
+// maxCompletedContext is the most recently completed tasks SuggestSubtasks
+// sends along
+const maxCompletedContext = 50
+
+// SuggestSubtasks asks for subtasks for the top-level tasks without any.
+// Recently completed tasks, which may be empty, are sent along so the
+// model doesn't suggest steps already done in sibling tasks.
+func (g *GeminiClient) SuggestSubtasks(ctx context.Context, tasks, completed []*todo.Task, breakdown Breakdown) ([]SubtaskSuggestion, error) {
 	// Create a map to track which tasks have subtasks
 	tasksWithSubtasks := make(map[string]bool)
 	for _, task := range tasks {
@@ -153,23 +399,24 @@ func (g *GeminiClient) SuggestSubtasks(ctx context.Context, tasks []*tasksapi.Ta
 	}
 
 	// Filter out tasks that already have parents or already have subtasks
-	var tasksNeedingSubtasks []*tasksapi.Task
+	var tasksNeedingSubtasks []*todo.Task
 	for _, task := range tasks {
-		if task.Parent == "" && !tasksWithSubtasks[task.Id] {
+		if task.Parent == "" && !tasksWithSubtasks[task.ID] {
 			tasksNeedingSubtasks = append(tasksNeedingSubtasks, task)
 		}
 	}
 
 	// If no tasks need subtasks, return early
 	if len(tasksNeedingSubtasks) == 0 {
-		return nil, fmt.Errorf("no tasks found that need subtasks")
+		return nil, ErrNoSubtasksNeeded
 	}
 
 	// Convert tasks to a format suitable for Gemini analysis
+	ids := newAliases(tasksNeedingSubtasks)
 	taskData := make([]map[string]interface{}, len(tasksNeedingSubtasks))
-	for i, task := range tasksNeedingSubtasks {
+	for i, task := range g.promptTasks(tasksNeedingSubtasks) {
 		taskData[i] = map[string]interface{}{
-			"id":    task.Id,
+			"id":    ids.alias(task.ID),
 			"title": task.Title,
 			"notes": task.Notes,
 		}
@@ -181,17 +428,20 @@ func (g *GeminiClient) SuggestSubtasks(ctx context.Context, tasks []*tasksapi.Ta
 		return nil, fmt.Errorf("failed to marshal task data: %v", err)
 	}
 
-	prompt := fmt.Sprintf(`You are a task breakdown assistant. Analyze the following tasks and suggest logical subtasks that would help complete each task effectively. These are all top-level tasks that need to be broken down.
+	completedSection, err := g.completedContext(tasks, completed)
+	if err != nil {
+		return nil, err
+	}
+
+	prompt := g.buildPrompt(fmt.Sprintf(`You are a task breakdown assistant. Analyze the tasks you are given and suggest logical subtasks that would help complete each task effectively. These are all top-level tasks that need to be broken down.
 
 Rules:
-1. Break down each task into 1-3 actionable subtasks
+1. %s
 2. Ensure subtasks are specific and measurable
 3. Consider any details or requirements mentioned in the task notes
 4. Focus on practical implementation steps
-5. Return ONLY a valid JSON array with no additional text
-
-Input tasks:
-%s
+5. Don't suggest steps already done in the recently completed tasks, if any are listed; build on them instead
+6. Return ONLY a valid JSON array with no additional text
 
 Response format (strict JSON array):
 [
@@ -206,92 +456,111 @@ Response format (strict JSON array):
   }
 ]
 
-Respond with ONLY the JSON array, no other text.`, string(taskJSON))
-
-	// Send request to Gemini
-	resp, err := g.model.GenerateContent(ctx, genai.Text(prompt))
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate content: %v", err)
-	}
-
-	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
-		return nil, fmt.Errorf("no response from Gemini")
-	}
-
-	// Parse the response
-	responseText := resp.Candidates[0].Content.Parts[0].(genai.Text)
-
-	// Clean up the response text
-	cleanJSON := strings.TrimSpace(string(responseText))
-	cleanJSON = strings.TrimPrefix(cleanJSON, "```json")
-	cleanJSON = strings.TrimPrefix(cleanJSON, "```")
-	cleanJSON = strings.TrimSuffix(cleanJSON, "```")
-	cleanJSON = strings.TrimSpace(cleanJSON)
+Respond with ONLY the JSON array, no other text.`, breakdown.rule()), withLanguage, fmt.Sprintf("Input tasks:\n%s\n%s", taskJSON, completedSection))
 
+	// Send request to Gemini and parse the response
 	var suggestions []SubtaskSuggestion
-	if err := json.Unmarshal([]byte(cleanJSON), &suggestions); err != nil {
-		return nil, fmt.Errorf("failed to parse Gemini response: %v\nResponse was: %s", err, cleanJSON)
+	if err := g.generateJSON(ctx, prompt, &suggestions); err != nil {
+		return nil, err
 	}
 
 	// Validate the response
 	if len(suggestions) != len(tasksNeedingSubtasks) {
 		return nil, fmt.Errorf("received incorrect number of suggestions: got %d, want %d", len(suggestions), len(tasksNeedingSubtasks))
 	}
+	// Extra subtasks past the maximum are dropped rather than retried
+	for i := range suggestions {
+		suggestions[i].ParentTaskID = ids.id(suggestions[i].ParentTaskID)
+		if len(suggestions[i].Subtasks) > breakdown.Max {
+			suggestions[i].Subtasks = suggestions[i].Subtasks[:breakdown.Max]
+		}
+	}
 
 	return suggestions, nil
 }
 
-func (g *GeminiClient) CreateSubtasks(ctx context.Context, taskListId string, suggestions []SubtaskSuggestion) error {
-	for _, suggestion := range suggestions {
-		// Get the parent task to ensure it exists and get its properties
-		parentTask, err := g.tasks.Tasks.Get(taskListId, suggestion.ParentTaskID).Context(ctx).Do()
-		if err != nil {
-			return fmt.Errorf("failed to get parent task %s: %v", suggestion.ParentTaskID, err)
-		}
+// completedContext lists the most recently completed tasks for the subtask
+// prompt, with the titles of the tasks they were subtasks of. It is empty
+// when nothing was completed.
+func (g *GeminiClient) completedContext(tasks, completed []*todo.Task) (string, error) {
+	if len(completed) == 0 {
+		return "", nil
+	}
+	titles := make(map[string]string, len(tasks)+len(completed))
+	for _, task := range g.promptTasks(tasks) {
+		titles[task.ID] = task.Title
+	}
+	recent := g.promptTasks(completed)
+	for _, task := range recent {
+		titles[task.ID] = task.Title
+	}
+	sort.SliceStable(recent, func(i, j int) bool {
+		return recent[i].Completed > recent[j].Completed
+	})
+	if len(recent) > maxCompletedContext {
+		recent = recent[:maxCompletedContext]
+	}
 
-		// Create each subtask
-		for _, subtaskTitle := range suggestion.Subtasks {
-			subtask := &tasksapi.Task{
-				Title:  subtaskTitle,
-				Parent: suggestion.ParentTaskID, // Explicitly set the parent ID
-				Notes:  fmt.Sprintf("Auto-generated subtask\nRationale: %s", suggestion.Rationale),
-			}
-
-			// If parent has a due date, inherit it for the subtask
-			if parentTask.Due != "" {
-				subtask.Due = parentTask.Due
-			}
-
-			// Insert the task with the parent relationship
-			insertCall := g.tasks.Tasks.Insert(taskListId, subtask)
-			insertCall.Parent(suggestion.ParentTaskID) // Set parent using the API call method
-			_, err := insertCall.Context(ctx).Do()
-			if err != nil {
-				return fmt.Errorf("failed to create subtask '%s' for parent task %s: %v", subtaskTitle, suggestion.ParentTaskID, err)
-			}
+	data := make([]map[string]interface{}, len(recent))
+	for i, task := range recent {
+		entry := map[string]interface{}{"title": task.Title}
+		if parent, ok := titles[task.Parent]; ok {
+			entry["subtaskOf"] = parent
 		}
+		data[i] = entry
 	}
+	completedJSON, err := json.Marshal(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal completed tasks: %v", err)
+	}
+	return fmt.Sprintf("\nRecently completed tasks:\n%s\n", completedJSON), nil
+}
 
-	return nil
+// generateJSON sends a prompt and decodes the JSON response into v,
+// tolerating markdown code fences around it and, failing that, the
+// mistakes repairJSON fixes
+func (g *GeminiClient) generateJSON(ctx context.Context, prompt Prompt, v interface{}) error {
+	_, err := g.continueJSON(ctx, nil, prompt, v)
+	return err
 }
 
-// AnalyzeAndCreateSubtasks combines subtask suggestion and creation into a single operation
-func (g *GeminiClient) AnalyzeAndCreateSubtasks(ctx context.Context, taskListId string, tasks []*tasksapi.Task) error {
-	suggestions, err := g.SuggestSubtasks(ctx, tasks)
+// continueJSON is generateJSON for the next prompt of a conversation with
+// the given earlier turns, which hold the prompts' user turns. It also
+// returns the raw answer, to be kept as the turn's answer.
+func (g *GeminiClient) continueJSON(ctx context.Context, history []llm.Turn, prompt Prompt, v interface{}) (string, error) {
+	resp, err := g.generate(ctx, llm.Request{System: prompt.System, Prompt: prompt.User, History: history, JSON: true, Seed: g.seed})
 	if err != nil {
-		return fmt.Errorf("failed to suggest subtasks: %v", err)
+		return "", err
 	}
 
-	err = g.CreateSubtasks(ctx, taskListId, suggestions)
-	if err != nil {
-		return fmt.Errorf("failed to create subtasks: %v", err)
+	// Clean up the response text
+	cleanJSON := strings.TrimSpace(resp.Text)
+	cleanJSON = strings.TrimPrefix(cleanJSON, "```json")
+	cleanJSON = strings.TrimPrefix(cleanJSON, "```")
+	cleanJSON = strings.TrimSuffix(cleanJSON, "```")
+	cleanJSON = strings.TrimSpace(cleanJSON)
+
+	if err := json.Unmarshal([]byte(cleanJSON), v); err != nil {
+		// Retry leniently before giving up; local models are sloppier
+		if repairErr := json.Unmarshal([]byte(repairJSON(resp.Text)), v); repairErr == nil {
+			return resp.Text, nil
+		}
+		return "", fmt.Errorf("failed to parse %s response: %v\nResponse was: %s", g.LastProvider(), err, cleanJSON)
 	}
+	return resp.Text, nil
+}
 
-	return nil
+// generateText sends a prompt and returns the plain text answer
+func (g *GeminiClient) generateText(ctx context.Context, prompt Prompt) (string, error) {
+	resp, err := g.generate(ctx, llm.Request{System: prompt.System, Prompt: prompt.User, Seed: g.seed})
+	if err != nil {
+		return "", err
+	}
+	return resp.Text, nil
 }
 
 func (g *GeminiClient) Close() {
-	if g.client != nil {
-		g.client.Close()
+	if g.provider != nil {
+		g.provider.Close()
 	}
 }
@@ -0,0 +1,149 @@
+package gemini
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"zap/datetime"
+	"zap/todo"
+	"zap/zaptest"
+)
+
+// fixtures is where the recorded answers to the prompts below are kept
+const fixtures = "testdata/fixtures"
+
+// goldenClock pins today's date, which the prompts contain, so they match
+// their fixtures
+func goldenClock(t *testing.T) *datetime.Clock {
+	t.Helper()
+	clock, err := datetime.NewFixedClock("Europe/Berlin", time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clock
+}
+
+// goldenTasks is a small list with a due date, notes and a waiting task
+func goldenTasks() []*todo.Task {
+	return []*todo.Task{
+		{ID: "a", Title: "Renew passport", Notes: "Appointment needs the old passport and a photo", Due: "2026-10-20T00:00:00.000Z", Position: "00000000000000000000"},
+		{ID: "b", Title: "[P1] Fix login bug", Notes: "Customers can't sign in with SSO", Position: "00000000000000000001"},
+		{ID: "c", Title: "Reply to landlord #waiting", Position: "00000000000000000002"},
+	}
+}
+
+// replay returns a client answering from the recorded fixtures
+func replay(t *testing.T) (*GeminiClient, *zaptest.Replay) {
+	t.Helper()
+	provider, err := zaptest.NewReplay(fixtures)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := NewClient(provider)
+	g.SetRules([]string{"Customer-facing bugs come before personal errands"})
+	return g, provider
+}
+
+func TestRankPromptGolden(t *testing.T) {
+	g, provider := replay(t)
+	g.SetLanguage("German")
+
+	priorities, err := g.AnalyzeAndPrioritizeTasks(context.Background(), goldenTasks(), RankSignals{
+		Clock:      goldenClock(t),
+		BottomRuns: map[string]int{"c": 2},
+		Effort:     map[string]Effort{"b": {Estimate: 90 * time.Minute}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	zaptest.Golden(t, "testdata/rank.golden", zaptest.Prompts(provider.Requests()))
+
+	var order []string
+	for _, priority := range priorities {
+		order = append(order, priority.TaskID)
+	}
+	if want := []string{"b", "a", "c"}; !slices.Equal(order, want) {
+		t.Errorf("ranked %v, want %v", order, want)
+	}
+}
+
+func TestSubtaskPromptGolden(t *testing.T) {
+	g, provider := replay(t)
+	completed := []*todo.Task{{ID: "d", Title: "Book passport photo", Status: "completed"}}
+
+	// The recorded answer is fenced and has a trailing comma, which the
+	// lenient parse repairs
+	suggestions, err := g.SuggestSubtasks(context.Background(), goldenTasks()[:2], completed, Breakdown{Min: 2, Max: 2, Granularity: GranularityChecklist})
+	if err != nil {
+		t.Fatal(err)
+	}
+	zaptest.Golden(t, "testdata/subtasks.golden", zaptest.Prompts(provider.Requests()))
+
+	if len(suggestions) != 2 || suggestions[0].ParentTaskID != "a" || suggestions[1].ParentTaskID != "b" {
+		t.Fatalf("got suggestions %+v, want one for each of a and b", suggestions)
+	}
+	if want := []string{"Reproduce the SSO failure", "Patch the callback handler"}; !slices.Equal(suggestions[1].Subtasks, want) {
+		t.Errorf("subtasks of b = %q, want %q", suggestions[1].Subtasks, want)
+	}
+}
+
+func TestRepairJSONGolden(t *testing.T) {
+	inputs, err := filepath.Glob("testdata/repair/*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no inputs in testdata/repair")
+	}
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".txt")
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			zaptest.Golden(t, strings.TrimSuffix(input, ".txt")+".golden", []byte(repairJSON(string(data))))
+		})
+	}
+}
+
+func TestGenerateJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     []string
+		wantErr  bool
+	}{
+		{"plain", `["a", "b"]`, []string{"a", "b"}, false},
+		{"fenced", "```json\n[\"a\", \"b\"]\n```", []string{"a", "b"}, false},
+		{"prose and trailing comma", "Here you go:\n[\"a\", \"b\",]\nHope it helps.", []string{"a", "b"}, false},
+		{"not JSON", "I can't help with that.", nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := NewClient(zaptest.NewScripted(test.response))
+			var got []string
+			err := g.generateJSON(context.Background(), Prompt{System: "system", User: "user"}, &got)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("generateJSON() error = %v, want error %v", err, test.wantErr)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("generateJSON() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestReplayRejectsChangedPrompts(t *testing.T) {
+	g, _ := replay(t)
+	var got []string
+	err := g.generateJSON(context.Background(), Prompt{System: "unrecorded", User: "prompt"}, &got)
+	if err == nil || !strings.Contains(err.Error(), "no fixture") {
+		t.Errorf("generateJSON() with an unrecorded prompt = %v, want a missing fixture error", err)
+	}
+}
@@ -0,0 +1,127 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"zap/datetime"
+	"zap/tags"
+	"zap/todo"
+)
+
+// maxNextSteps caps the steps of a next-action plan
+const maxNextSteps = 3
+
+// Candidate is an open task that could be worked on next
+type Candidate struct {
+	Task *todo.Task
+	List string
+	// Subtasks are the task's open subtasks, in order
+	Subtasks []*todo.Task
+	Effort   Effort
+}
+
+// Event is a calendar event that takes up part of the day
+type Event struct {
+	Title string
+	Start time.Time
+	End   time.Time
+	// AllDay events don't block time but may matter for what fits today
+	AllDay bool
+}
+
+// NextAction is the task to work on now and how to go about it
+type NextAction struct {
+	TaskID string   `json:"taskId"`
+	Reason string   `json:"reason"`
+	Steps  []string `json:"steps"`
+}
+
+// PickNextAction asks which single task is most important to start right
+// now, given due dates, the rest of the day's events and the time of day,
+// and for a short plan built from the task's subtasks
+func (g *GeminiClient) PickNextAction(ctx context.Context, candidates []Candidate, events []Event, clock *datetime.Clock) (NextAction, error) {
+	tasks := make([]*todo.Task, len(candidates))
+	for i, candidate := range candidates {
+		tasks[i] = candidate.Task
+	}
+	ids := newAliases(tasks)
+	taskData := make([]map[string]interface{}, len(candidates))
+	for i, candidate := range candidates {
+		sent := g.promptTask(candidate.Task)
+		data := map[string]interface{}{
+			"id":      ids.alias(candidate.Task.ID),
+			"title":   sent.Title,
+			"notes":   sent.Notes,
+			"list":    candidate.List,
+			"tags":    tags.Of(candidate.Task),
+			"urgency": clock.Urgency(candidate.Task.Due),
+		}
+		if day, ok := clock.ParseDue(candidate.Task.Due); ok {
+			days, _ := clock.DaysUntil(candidate.Task.Due)
+			data["due"] = day.Format("2006-01-02")
+			data["daysUntilDue"] = days
+		}
+		if len(candidate.Subtasks) > 0 {
+			subtasks := make([]string, len(candidate.Subtasks))
+			for j, subtask := range g.promptTasks(candidate.Subtasks) {
+				subtasks[j] = subtask.Title
+			}
+			data["openSubtasks"] = subtasks
+		}
+		candidate.Effort.describe(data)
+		taskData[i] = data
+	}
+	taskJSON, err := json.Marshal(taskData)
+	if err != nil {
+		return NextAction{}, fmt.Errorf("failed to marshal task data: %v", err)
+	}
+	eventData := make([]map[string]interface{}, len(events))
+	for i, event := range events {
+		data := map[string]interface{}{"title": g.redactor.String(event.Title)}
+		if event.AllDay {
+			data["allDay"] = true
+		} else {
+			data["start"] = event.Start.In(clock.Location()).Format("15:04")
+			data["end"] = event.End.In(clock.Location()).Format("15:04")
+		}
+		eventData[i] = data
+	}
+	eventJSON, err := json.Marshal(eventData)
+	if err != nil {
+		return NextAction{}, fmt.Errorf("failed to marshal events: %v", err)
+	}
+
+	prompt := g.buildPrompt(`You are a focus assistant. Pick the single most important task to start right now and plan how to begin it.
+
+Rules:
+1. Weigh due dates and urgency first; daysUntilDue is negative for overdue tasks
+2. Fit the task to the time left before the next event and to the time of day: deep work early, small tasks in short gaps or late in the day. estimatedMinutes is the expected effort and spentMinutes the time already worked on a task
+3. Tasks tagged "waiting" are blocked on someone else - don't pick them
+4. Give 2 or 3 concrete steps. When the task has openSubtasks, base the steps on the first ones, in order
+5. Return ONLY a valid JSON object with no additional text
+
+Response format (strict JSON object):
+{"taskId": "task-id-1", "reason": "Due tomorrow and you have a free hour before your 11:00 meeting", "steps": ["Outline the sections", "Draft the introduction"]}
+
+Respond with ONLY the JSON object, no other text.`, withPreferences|withLanguage, fmt.Sprintf("It is now %s.\n\nToday's remaining events:\n%s\n\nTasks:\n%s", clock.Now().Format("Monday 2006-01-02 15:04"), eventJSON, taskJSON))
+
+	var next NextAction
+	if err := g.generateJSON(ctx, prompt, &next); err != nil {
+		return NextAction{}, err
+	}
+	next.TaskID = ids.id(next.TaskID)
+	found := false
+	for _, candidate := range candidates {
+		found = found || candidate.Task.ID == next.TaskID
+	}
+	if !found {
+		return NextAction{}, fmt.Errorf("%s picked unknown task %q", g.LastProvider(), next.TaskID)
+	}
+	if len(next.Steps) > maxNextSteps {
+		next.Steps = next.Steps[:maxNextSteps]
+	}
+	return next, nil
+}
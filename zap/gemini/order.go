@@ -0,0 +1,62 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"zap/todo"
+)
+
+// OrderSubtasks ranks the subtasks of one parent. The prompt is much
+// smaller than AnalyzeAndPrioritizeTasks': only the parent and its
+// subtasks are sent, and the answer needs no positions.
+func (g *GeminiClient) OrderSubtasks(ctx context.Context, parent *todo.Task, subtasks []*todo.Task, signals RankSignals) ([]TaskPriority, error) {
+	clock := signals.Clock
+	sentParent := g.promptTask(parent)
+	ids := newAliases(subtasks)
+	subtaskData := make([]map[string]interface{}, len(subtasks))
+	for i, task := range g.promptTasks(subtasks) {
+		data := map[string]interface{}{
+			"id":    ids.alias(task.ID),
+			"title": task.Title,
+			"notes": task.Notes,
+		}
+		if day, ok := clock.ParseDue(task.Due); ok {
+			data["due"] = day.Format("2006-01-02")
+		}
+		subtaskData[i] = data
+	}
+	requestJSON, err := json.Marshal(map[string]interface{}{
+		"parent":   map[string]interface{}{"title": sentParent.Title, "notes": sentParent.Notes},
+		"subtasks": subtaskData,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal subtasks: %v", err)
+	}
+
+	prompt := g.buildPrompt(`You are a task prioritization assistant. Order the subtasks of the task you are given.
+
+Rules:
+1. Steps that others depend on come first; keep the existing order of steps that are meant to be done in sequence
+2. Subtasks with closer due dates get higher priority
+3. Look for priority markers in titles like [HIGH], [URGENT], [P1]
+4. Return ONLY a valid JSON array with one entry per subtask, no additional text
+
+Response format (strict JSON array):
+[
+  {"taskId": "subtask-id-1", "priority": 80, "explanation": "Needed before the other steps"}
+]
+
+The priority should be a number between 0-100, with higher numbers indicating higher priority.
+Respond with ONLY the JSON array, no other text.`, withPreferences|withLanguage, fmt.Sprintf("Today is %s.\n\nTask and subtasks, in their current order:\n%s", clock.Today().Format("Monday 2006-01-02"), requestJSON))
+
+	var priorities []TaskPriority
+	if err := g.generateJSON(ctx, prompt, &priorities); err != nil {
+		return nil, err
+	}
+	for i := range priorities {
+		priorities[i].TaskID = ids.id(priorities[i].TaskID)
+	}
+	return g.checkPriorities(priorities, subtasks, clock)
+}
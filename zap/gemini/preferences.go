@@ -0,0 +1,81 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Review is how the user reviewed a proposed ranking: "accepted",
+// "rejected" or "revised" with feedback. Top is the start of a rejected
+// ranking.
+type Review struct {
+	List     string   `json:"list"`
+	Verdict  string   `json:"verdict"`
+	Feedback string   `json:"feedback,omitempty"`
+	Top      []string `json:"top,omitempty"`
+}
+
+// maxPreferences is the most preferences a summary may state
+const maxPreferences = 6
+
+// SetPreferences steers rankings by the user's preferences, as written by
+// SummarizePreferences; empty sends none
+func (g *GeminiClient) SetPreferences(summary string) {
+	g.preferences = summary
+}
+
+// preferencesRule is appended to prompts that rank tasks
+func (g *GeminiClient) preferencesRule() string {
+	if g.preferences == "" {
+		return ""
+	}
+	return "\n\nThe user's preferences, learned from how they reviewed earlier rankings; follow them unless a rule above says otherwise:\n" + g.preferences
+}
+
+// SummarizePreferences updates the summary of how the user wants tasks
+// ranked with their reviews since it was written. previous may be empty.
+func (g *GeminiClient) SummarizePreferences(ctx context.Context, reviews []Review, previous string) (string, error) {
+	redacted := make([]Review, len(reviews))
+	for i, review := range reviews {
+		redacted[i] = review
+		redacted[i].Feedback = g.redactor.String(review.Feedback)
+		redacted[i].Top = make([]string, len(review.Top))
+		for j, title := range review.Top {
+			redacted[i].Top[j] = g.promptText(title)
+		}
+	}
+	reviewJSON, err := json.Marshal(redacted)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal reviews: %v", err)
+	}
+	if previous == "" {
+		previous = "(none yet)"
+	}
+
+	prompt := g.buildPrompt(fmt.Sprintf(`You keep a short summary of how a user wants their to-do lists prioritized. The user reviewed rankings proposed by an assistant: they accepted some, rejected some, and gave feedback on others. Update the summary with the reviews you are given.
+
+Rules:
+1. Write at most %d preferences, one per line, each starting with "- "
+2. State only what the reviews support; a correction the user made more than once is a firm preference
+3. Keep earlier preferences unless newer feedback contradicts them; drop them when it does
+4. Leave out anything about a single task that won't come up again
+5. Return ONLY the lines, no other text`, maxPreferences), 0, fmt.Sprintf("Current summary:\n%s\n\nReviews, oldest first:\n%s", previous, reviewJSON))
+
+	text, err := g.generateText(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "- ") && len(lines) < maxPreferences {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return "", fmt.Errorf("no preferences in the answer: %s", text)
+	}
+	return strings.Join(lines, "\n"), nil
+}
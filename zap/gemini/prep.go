@@ -0,0 +1,101 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"zap/datetime"
+)
+
+// maxPrepTasks caps the preparation tasks for one meeting
+const maxPrepTasks = 3
+
+// maxMeetingDescription caps how much of a meeting's description is sent
+const maxMeetingDescription = 500
+
+// Meeting is an upcoming calendar event to prepare for
+type Meeting struct {
+	ID          string
+	Title       string
+	Description string
+	Start       time.Time
+	AllDay      bool
+	Attendees   int
+}
+
+// PrepTask is a task that prepares for a meeting
+type PrepTask struct {
+	EventID string `json:"eventId"`
+	Title   string `json:"title"`
+	Notes   string `json:"notes"`
+}
+
+// PrepareForMeetings asks for the tasks to do ahead of each meeting, such
+// as preparing its agenda or reading up on its topic. Tasks for unknown
+// meetings or without titles are left out, as are those beyond
+// maxPrepTasks for a meeting.
+func (g *GeminiClient) PrepareForMeetings(ctx context.Context, meetings []Meeting, clock *datetime.Clock) ([]PrepTask, error) {
+	meetingData := make([]map[string]interface{}, len(meetings))
+	for i, meeting := range meetings {
+		description := []rune(g.redactor.String(meeting.Description))
+		if len(description) > maxMeetingDescription {
+			description = append(description[:maxMeetingDescription], '…')
+		}
+		data := map[string]interface{}{
+			"id":        meeting.ID,
+			"title":     g.redactor.String(meeting.Title),
+			"attendees": meeting.Attendees,
+		}
+		if len(description) > 0 {
+			data["description"] = string(description)
+		}
+		if meeting.AllDay {
+			data["start"] = meeting.Start.Format("Monday 2006-01-02")
+		} else {
+			data["start"] = meeting.Start.In(clock.Location()).Format("Monday 2006-01-02 15:04")
+		}
+		meetingData[i] = data
+	}
+	meetingJSON, err := json.Marshal(meetingData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal meetings: %v", err)
+	}
+
+	prompt := g.buildPrompt(fmt.Sprintf(`You are an executive assistant. For each upcoming meeting, write the tasks to do beforehand so the meeting goes well.
+
+Rules:
+1. Give 1 to %d tasks per meeting, each a concrete action starting with a verb and naming the meeting, under 60 characters, e.g. "Prepare agenda for Q3 planning"
+2. Base the tasks on the meeting's title and description: an agenda for meetings you run, reading or questions for reviews and interviews, numbers for reports
+3. Add short notes with what to cover when the description gives something to go on; otherwise leave notes empty
+4. Use the exact meeting id as eventId
+5. Return ONLY a valid JSON array and no additional text
+
+Response format (strict JSON array):
+[
+  {"eventId": "event-id-1", "title": "Prepare agenda for Q3 planning", "notes": "Cover the hiring plan and the budget review"}
+]
+
+Respond with ONLY the JSON array, no other text.`, maxPrepTasks), withLanguage, fmt.Sprintf("Today is %s.\n\nMeetings:\n%s", clock.Today().Format("Monday 2006-01-02"), meetingJSON))
+
+	var answers []PrepTask
+	if err := g.generateJSON(ctx, prompt, &answers); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int, len(meetings))
+	for _, meeting := range meetings {
+		counts[meeting.ID] = 0
+	}
+	var prep []PrepTask
+	for _, answer := range answers {
+		count, known := counts[answer.EventID]
+		if !known || answer.Title == "" || count >= maxPrepTasks {
+			continue
+		}
+		counts[answer.EventID]++
+		prep = append(prep, answer)
+	}
+	return prep, nil
+}
@@ -0,0 +1,81 @@
+package gemini
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"zap/llm"
+)
+
+// Prompt is a request to the model in two parts. System holds what to do
+// and how to answer, which stays the same from run to run and is sent as
+// the system instruction; User holds only the data it applies to, sent as
+// the user's turn.
+type Prompt struct {
+	System string
+	User   string
+}
+
+// String writes out both parts, the way --show-prompt prints them
+func (p Prompt) String() string {
+	return fmt.Sprintf("--- system ---\n%s\n--- user ---\n%s\n", p.System, p.User)
+}
+
+// Layers stacked on a prompt's base rules, in the order they are stacked.
+// The organization's rules are stacked on every prompt.
+const (
+	// withPreferences adds the preferences learned from the user's reviews,
+	// for prompts that weigh tasks against each other
+	withPreferences = 1 << iota
+	// withLanguage asks for the text meant for the user in their language
+	withLanguage
+)
+
+// buildPrompt layers a prompt's instructions: the base rules of what it
+// asks, then the organization's rules from the config, which win over the
+// base rules, then, as layers says, the user's preferences, which give way
+// to both, and the language to answer in. data is the user's turn.
+func (g *GeminiClient) buildPrompt(base string, layers int, data string) Prompt {
+	system := base + g.rulesLayer()
+	if layers&withPreferences != 0 {
+		system += g.preferencesRule()
+	}
+	if layers&withLanguage != 0 {
+		system += g.languageRule()
+	}
+	return Prompt{System: system, User: data}
+}
+
+// SetRules adds the organization's rules to every prompt, after the base
+// rules, e.g. "Customer escalations come before internal work"
+func (g *GeminiClient) SetRules(rules []string) {
+	g.rules = rules
+}
+
+// rulesLayer lists the organization's rules
+func (g *GeminiClient) rulesLayer() string {
+	if len(g.rules) == 0 {
+		return ""
+	}
+	return "\n\nYour organization's rules, which come before the rules above where they disagree:\n- " + strings.Join(g.rules, "\n- ")
+}
+
+// SetPromptWriter has every prompt written to w as it is sent, for
+// debugging prompts; nil writes none
+func (g *GeminiClient) SetPromptWriter(w io.Writer) {
+	g.promptWriter = w
+}
+
+// showPrompt writes a request to the prompt writer
+func (g *GeminiClient) showPrompt(req llm.Request) {
+	if g.promptWriter == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(req.History) > 0 {
+		fmt.Fprintf(g.promptWriter, "(continuing a conversation of %d earlier turns)\n", len(req.History))
+	}
+	fmt.Fprintf(g.promptWriter, "%s\n", Prompt{System: req.System, User: req.Prompt})
+}
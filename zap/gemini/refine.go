@@ -0,0 +1,102 @@
+package gemini
+
+import (
+	"context"
+	"fmt"
+
+	"zap/datetime"
+	"zap/llm"
+	"zap/todo"
+)
+
+// RankSession is the conversation that ranked a list. Refine continues it
+// with the user's feedback, so the model revises its ranking instead of
+// starting over.
+type RankSession struct {
+	g     *GeminiClient
+	tasks []*todo.Task
+	ids   aliases
+	clock *datetime.Clock
+	// system is the ranking's system instruction, which holds for the
+	// whole conversation
+	system  string
+	history []llm.Turn
+	// chunks are the conversations that ranked parts of a list too long
+	// for one prompt; the session has no conversation of its own then
+	chunks []*RankSession
+}
+
+// StartRanking ranks tasks like AnalyzeAndPrioritizeTasks and returns the
+// conversation for refining the ranking. With an ensemble, the ranking is
+// the consensus and the conversation that of one of its rankings.
+func (g *GeminiClient) StartRanking(ctx context.Context, tasks []*todo.Task, signals RankSignals) (*RankSession, []TaskPriority, error) {
+	g.summarizeNotes(ctx, tasks)
+	if len(g.ensemble) > 0 {
+		return g.rankEnsemble(ctx, tasks, signals)
+	}
+	return g.rankOnce(ctx, tasks, signals)
+}
+
+// rankOnce asks the model for one ranking of tasks
+func (g *GeminiClient) rankOnce(ctx context.Context, tasks []*todo.Task, signals RankSignals) (*RankSession, []TaskPriority, error) {
+	ids := newAliases(tasks)
+	prompt, truncated, err := g.rankPrompt(tasks, signals, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	if count := g.countTokens(ctx, prompt, len(tasks)); count.Window > 0 && count.Tokens > count.Window {
+		return g.rankChunks(ctx, tasks, signals, count)
+	}
+	g.mu.Lock()
+	g.lastTruncated = truncated
+	g.lastChunks = 1
+	g.mu.Unlock()
+	var priorities []TaskPriority
+	answer, err := g.continueJSON(ctx, nil, prompt, &priorities)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range priorities {
+		priorities[i].TaskID = ids.id(priorities[i].TaskID)
+	}
+	priorities, err = g.checkPriorities(priorities, tasks, signals.Clock)
+	if err != nil {
+		return nil, nil, err
+	}
+	session := &RankSession{g: g, tasks: tasks, ids: ids, clock: signals.Clock, system: prompt.System, history: []llm.Turn{{Prompt: prompt.User, Answer: answer}}}
+	return session, priorities, nil
+}
+
+// Refine asks for a revised ranking of every task that takes the user's
+// feedback on the latest one into account. A failed turn is left out of
+// the conversation, so it can be retried.
+func (s *RankSession) Refine(ctx context.Context, feedback string) ([]TaskPriority, error) {
+	if len(s.chunks) > 0 {
+		return s.refineChunks(ctx, feedback)
+	}
+	prompt := Prompt{System: s.system, User: fmt.Sprintf(`The user rejected your ranking with this feedback:
+
+%q
+
+Rules:
+1. Revise the priorities of all tasks so the ranking follows the feedback; keep the rest of your reasoning where the feedback doesn't contradict it
+2. Mention the feedback in the explanations of tasks whose priority it changed
+3. Return ONLY a valid JSON array with one entry for every task, in the same format as before
+
+Respond with ONLY the JSON array, no other text.`, feedback)}
+
+	var priorities []TaskPriority
+	answer, err := s.g.continueJSON(ctx, s.history, prompt, &priorities)
+	if err != nil {
+		return nil, err
+	}
+	for i := range priorities {
+		priorities[i].TaskID = s.ids.id(priorities[i].TaskID)
+	}
+	priorities, err = s.g.checkPriorities(priorities, s.tasks, s.clock)
+	if err != nil {
+		return nil, err
+	}
+	s.history = append(s.history, llm.Turn{Prompt: prompt.User, Answer: answer})
+	return priorities, nil
+}
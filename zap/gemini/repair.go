@@ -0,0 +1,51 @@
+package gemini
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Local and smaller models often wrap JSON in prose or code fences, leave
+// trailing commas or use typographic quotes. repairJSON fixes the common
+// cases so their answers can still be parsed.
+
+// fencePattern captures the body of the first markdown code fence
+var fencePattern = regexp.MustCompile("(?s)```(?:json|JSON)?\\s*(.*?)```")
+
+// trailingCommaPattern matches a comma directly before a closing bracket
+var trailingCommaPattern = regexp.MustCompile(`,(\s*[\]}])`)
+
+// lineCommentPattern matches // comments at the end of a line
+var lineCommentPattern = regexp.MustCompile(`(?m)^(\s*[^"\n]*?(?:"[^"\n]*"[^"\n]*?)*)\s//[^\n]*$`)
+
+// repairJSON extracts the outermost JSON value from text and fixes common
+// syntax mistakes. It returns text unchanged when no JSON value is found.
+func repairJSON(text string) string {
+	if match := fencePattern.FindStringSubmatch(text); match != nil {
+		text = match[1]
+	}
+
+	text = strings.NewReplacer(
+		"“", `"`, "”", `"`,
+		"‘", "'", "’", "'",
+	).Replace(text)
+
+	start := strings.IndexAny(text, "[{")
+	if start < 0 {
+		return text
+	}
+	closer := byte(']')
+	if text[start] == '{' {
+		closer = '}'
+	}
+	end := strings.LastIndexByte(text, closer)
+	if end < start {
+		// Truncated output: close what we can
+		text = text[start:] + string(closer)
+	} else {
+		text = text[start : end+1]
+	}
+
+	text = lineCommentPattern.ReplaceAllString(text, "$1")
+	return trailingCommaPattern.ReplaceAllString(text, "$1")
+}
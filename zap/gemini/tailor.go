@@ -0,0 +1,65 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"zap/todo"
+)
+
+// TemplateTask is a task from a template, as sent to and returned by TailorTemplate
+type TemplateTask struct {
+	Title    string         `json:"title"`
+	Notes    string         `json:"notes,omitempty"`
+	Subtasks []TemplateTask `json:"subtasks,omitempty"`
+}
+
+// TailorTemplate adapts a generic template to a specific parent task,
+// rewording, dropping or adding steps so they fit what the parent describes
+func (g *GeminiClient) TailorTemplate(ctx context.Context, parent *todo.Task, template []TemplateTask) ([]TemplateTask, error) {
+	templateJSON, err := json.Marshal(template)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal template: %v", err)
+	}
+	sent := g.promptTask(parent)
+	parentJSON, err := json.Marshal(map[string]interface{}{
+		"title": sent.Title,
+		"notes": sent.Notes,
+		"due":   parent.Due,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal parent task: %v", err)
+	}
+
+	prompt := g.buildPrompt(`You are a project planning assistant. Adapt the task template you are given to the specific task it will be applied to.
+
+Rules:
+1. Keep the overall structure and intent of the template
+2. Reword steps so they refer to the specifics of the task (names, versions, systems mentioned)
+3. Remove steps that clearly don't apply and add at most 3 steps that are clearly missing
+4. Keep titles short and actionable
+5. Return ONLY a valid JSON array with the same shape as the template, no additional text
+
+Response format (strict JSON array):
+[
+  {
+    "title": "Step title",
+    "notes": "Optional notes",
+    "subtasks": [
+      {"title": "Sub-step title"}
+    ]
+  }
+]
+
+Respond with ONLY the JSON array, no other text.`, withLanguage, fmt.Sprintf("Task the template is applied to:\n%s\n\nTemplate:\n%s", parentJSON, templateJSON))
+
+	var tailored []TemplateTask
+	if err := g.generateJSON(ctx, prompt, &tailored); err != nil {
+		return nil, err
+	}
+	if len(tailored) == 0 {
+		return nil, fmt.Errorf("%s returned an empty template", g.provider.Name())
+	}
+	return tailored, nil
+}
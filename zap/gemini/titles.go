@@ -0,0 +1,79 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"zap/todo"
+)
+
+// TitleEdit is a task's title rewritten in the house style
+type TitleEdit struct {
+	TaskID string `json:"taskId"`
+	Title  string `json:"title"`
+}
+
+// NormalizeTitles asks for the tasks' titles in one consistent style:
+// imperative verb first, under 60 characters, markers in front and
+// hashtags at the end. Only titles that change are returned; answers for
+// unknown tasks are left out. Titles the redactor would change aren't
+// sent, since their rewrite would write the redactions back, nor are
+// titles with instructions to the model in them.
+func (g *GeminiClient) NormalizeTitles(ctx context.Context, tasks []*todo.Task) ([]TitleEdit, error) {
+	ids := newAliases(tasks)
+	titles := make(map[string]string, len(tasks))
+	var taskData []map[string]interface{}
+	for _, task := range tasks {
+		if g.promptText(task.Title) != task.Title {
+			continue
+		}
+		titles[task.ID] = task.Title
+		taskData = append(taskData, map[string]interface{}{
+			"id":    ids.alias(task.ID),
+			"title": task.Title,
+		})
+	}
+	if len(taskData) == 0 {
+		return nil, nil
+	}
+	taskJSON, err := json.Marshal(taskData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal task data: %v", err)
+	}
+
+	prompt := g.buildPrompt(`You are an editor for a to-do list. Rewrite the task titles you are given in one consistent style.
+
+Rules:
+1. Start with an imperative verb ("Write", "Call", "Fix"), dropping filler like "need to" or "TODO:"
+2. Keep each title under 60 characters without losing what the task is about
+3. Keep every marker in square brackets, such as [HIGH], [pinned] or [zap:#2], exactly as written and put them at the start
+4. Keep every hashtag, such as #errand, exactly as written and put them at the end
+5. Fix spelling and capitalization; don't add information that isn't there
+6. Leave titles that already follow these rules unchanged
+7. Return ONLY a valid JSON array with one entry per task and no additional text
+
+Response format (strict JSON array):
+[
+  {"taskId": "task-id-1", "title": "[HIGH] Email Sam the Q3 budget draft #work"}
+]
+
+Respond with ONLY the JSON array, no other text.`, 0, "Tasks:\n"+string(taskJSON))
+
+	var answers []TitleEdit
+	if err := g.generateJSON(ctx, prompt, &answers); err != nil {
+		return nil, err
+	}
+
+	var edits []TitleEdit
+	for _, answer := range answers {
+		answer.TaskID = ids.id(answer.TaskID)
+		current, ok := titles[answer.TaskID]
+		if !ok || answer.Title == "" || answer.Title == current {
+			continue
+		}
+		delete(titles, answer.TaskID)
+		edits = append(edits, answer)
+	}
+	return edits, nil
+}
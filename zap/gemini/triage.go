@@ -0,0 +1,95 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"zap/datetime"
+	"zap/todo"
+)
+
+// Triage is where an inbox task should go and how it should read
+type Triage struct {
+	TaskID string `json:"taskId"`
+	// Title is the task rewritten as a concrete action
+	Title string `json:"title"`
+	List  string `json:"list"`
+	// Due is a YYYY-MM-DD date, or empty when the task has no deadline
+	Due    string `json:"due"`
+	Reason string `json:"reason"`
+}
+
+// TriageTasks asks how to turn quickly captured tasks into actionable ones:
+// a clear title, one of the lists and a due date when one is implied.
+// Answers naming unknown tasks or lists, or with invalid dates, are left
+// out.
+func (g *GeminiClient) TriageTasks(ctx context.Context, tasks []*todo.Task, lists []string, clock *datetime.Clock) ([]Triage, error) {
+	ids := newAliases(tasks)
+	taskData := make([]map[string]interface{}, len(tasks))
+	for i, task := range g.promptTasks(tasks) {
+		data := map[string]interface{}{
+			"id":    ids.alias(task.ID),
+			"title": task.Title,
+			"notes": task.Notes,
+		}
+		if day, ok := clock.ParseDue(task.Due); ok {
+			data["due"] = day.Format("2006-01-02")
+		}
+		taskData[i] = data
+	}
+	taskJSON, err := json.Marshal(taskData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal task data: %v", err)
+	}
+	listJSON, err := json.Marshal(lists)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal lists: %v", err)
+	}
+
+	prompt := g.buildPrompt(`You are a personal productivity assistant. The tasks you are given were captured in a hurry into an inbox. Turn each one into an actionable task.
+
+Rules:
+1. Rewrite vague titles as a concrete next action starting with a verb, under 60 characters; keep titles that are already actionable, and keep hashtags and priority markers like [HIGH]
+2. Pick the list that fits each task best; use the exact name from the lists
+3. Set due to a YYYY-MM-DD date only when the task or its notes imply a deadline ("by Friday", "before the trip"); otherwise leave it empty. Keep an existing due date
+4. Give a short reason for the list and date
+5. Return ONLY a valid JSON array with one entry per task and no additional text
+
+Response format (strict JSON array):
+[
+  {"taskId": "task-id-1", "title": "Email Sam the Q3 budget draft", "list": "Backlog", "due": "2026-03-06", "reason": "Needed before Friday's review"}
+]
+
+Respond with ONLY the JSON array, no other text.`, withLanguage, fmt.Sprintf("Today is %s.\n\nLists:\n%s\n\nTasks:\n%s", clock.Today().Format("Monday 2006-01-02"), listJSON, taskJSON))
+
+	var answers []Triage
+	if err := g.generateJSON(ctx, prompt, &answers); err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool, len(tasks))
+	for _, task := range tasks {
+		known[task.ID] = true
+	}
+	listNames := make(map[string]bool, len(lists))
+	for _, list := range lists {
+		listNames[list] = true
+	}
+	var triaged []Triage
+	for _, answer := range answers {
+		answer.TaskID = ids.id(answer.TaskID)
+		if !known[answer.TaskID] || !listNames[answer.List] || answer.Title == "" {
+			continue
+		}
+		if answer.Due != "" {
+			if _, err := time.Parse("2006-01-02", answer.Due); err != nil {
+				continue
+			}
+		}
+		known[answer.TaskID] = false
+		triaged = append(triaged, answer)
+	}
+	return triaged, nil
+}
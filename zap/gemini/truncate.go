@@ -0,0 +1,165 @@
+package gemini
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"zap/store"
+	"zap/todo"
+)
+
+// summariesBucket holds the model's summaries of long notes, keyed by a
+// digest of the notes as they are sent
+const summariesBucket = "note_summaries"
+
+// maxSummary is the longest summary of notes asked for, in characters
+const maxSummary = 300
+
+// minNotesLimit is the shortest notes are cut to when a ranking prompt is
+// too long; below it they are left out
+const minNotesLimit = 100
+
+// Limits caps what is sent of each task and of a whole ranking prompt, in
+// characters. Zero leaves a limit off.
+type Limits struct {
+	Title  int
+	Notes  int
+	Prompt int
+}
+
+// DefaultLimits keep tasks with pasted documents or email threads in their
+// notes from blowing out the prompt
+var DefaultLimits = Limits{Title: 300, Notes: 2000, Prompt: 120000}
+
+// SetLimits caps what is sent of each task and of each ranking prompt
+func (g *GeminiClient) SetLimits(limits Limits) {
+	g.limits = limits
+}
+
+// SetSummaries has notes cut to the limit followed by a summary of them,
+// written by the model once per version of the notes and kept in st. A
+// read-only client writes summaries but doesn't keep them.
+func (g *GeminiClient) SetSummaries(st *store.Store, readOnly bool) {
+	g.summaries = &noteSummaries{store: st, readOnly: readOnly, cache: make(map[string]string)}
+}
+
+// LastTruncated names the tasks whose title or notes were cut in the most
+// recent ranking prompt
+func (g *GeminiClient) LastTruncated() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.lastTruncated
+}
+
+// noteSummaries are the summaries of long notes, shared by a client's
+// variants
+type noteSummaries struct {
+	store    *store.Store
+	readOnly bool
+
+	mu    sync.Mutex
+	cache map[string]string
+}
+
+// notesDigest keys the summary of notes
+func notesDigest(notes string) string {
+	sum := sha256.Sum256([]byte(notes))
+	return hex.EncodeToString(sum[:8])
+}
+
+// get returns the summary of notes, if one was written
+func (s *noteSummaries) get(notes string) (string, bool) {
+	if s == nil {
+		return "", false
+	}
+	key := notesDigest(notes)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if summary, ok := s.cache[key]; ok {
+		return summary, true
+	}
+	var summary string
+	found, err := s.store.Get(summariesBucket, key, &summary)
+	if err != nil {
+		log.Printf("Error reading the summary of notes: %v", err)
+	}
+	if found {
+		s.cache[key] = summary
+	}
+	return summary, found
+}
+
+// put keeps the summary of notes
+func (s *noteSummaries) put(notes, summary string) {
+	key := notesDigest(notes)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cache[key] = summary
+	if s.readOnly {
+		return
+	}
+	if err := s.store.Put(summariesBucket, key, summary); err != nil {
+		log.Printf("Error keeping the summary of notes: %v", err)
+	}
+}
+
+// summarizeNotes has the model summarize the notes of tasks that are over
+// the limit and weren't summarized before. Notes it fails on are only cut.
+func (g *GeminiClient) summarizeNotes(ctx context.Context, tasks []*todo.Task) {
+	if g.summaries == nil || g.limits.Notes <= 0 {
+		return
+	}
+	for _, task := range tasks {
+		notes := g.promptText(g.namespace.User(task.Notes))
+		if utf8.RuneCountInString(notes) <= g.limits.Notes {
+			continue
+		}
+		if _, ok := g.summaries.get(notes); ok {
+			continue
+		}
+		prompt := g.buildPrompt(fmt.Sprintf(`Summarize the notes of the task you are given for someone deciding how urgent and important the task is.
+
+Rules:
+1. Keep deadlines, dates, names, amounts and anything that blocks the task or depends on it
+2. Leave out greetings, signatures, quoted replies and boilerplate
+3. Answer in plain text of at most %d characters, no markdown`, maxSummary), 0, fmt.Sprintf("Task: %s\n\nNotes:\n%s", g.promptText(task.Title), notes))
+		summary, err := g.generateText(ctx, prompt)
+		if err != nil {
+			log.Printf("Error summarizing the notes of '%s', cutting them instead: %v", task.Title, err)
+			continue
+		}
+		summary, _ = truncate(defang(strings.Join(strings.Fields(summary), " ")), maxSummary)
+		g.summaries.put(notes, summary)
+	}
+}
+
+// truncate cuts text to limit characters, marking the cut with an
+// ellipsis. It reports whether text was cut; a limit of zero doesn't cut.
+func truncate(text string, limit int) (string, bool) {
+	if limit <= 0 || utf8.RuneCountInString(text) <= limit {
+		return text, false
+	}
+	return string([]rune(text)[:limit]) + "…", true
+}
+
+// cutNotes cuts notes to limit characters, followed by their summary when
+// one was written. A negative limit leaves the notes out.
+func (g *GeminiClient) cutNotes(notes string, limit int) (string, bool) {
+	if limit < 0 {
+		return "", notes != ""
+	}
+	cut, ok := truncate(notes, limit)
+	if !ok {
+		return notes, false
+	}
+	if summary, found := g.summaries.get(notes); found {
+		cut += " [summary of the notes: " + summary + "]"
+	}
+	return cut, true
+}
@@ -0,0 +1,200 @@
+package gemini
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"zap/datetime"
+	"zap/todo"
+)
+
+// maxNamedMissing is how many left out tasks an error names
+const maxNamedMissing = 3
+
+// dueClaim is a kind of statement about a task's due date that explanations
+// make, and the due dates it is true of
+type dueClaim struct {
+	pattern *regexp.Regexp
+	// holds reports whether the claim, with the pattern's submatches, is
+	// true of a task due in days, on due; hasDue is false without a due date
+	holds func(groups []string, days int, due time.Time, hasDue bool) bool
+}
+
+// dueClaims are the statements about due dates that are checked. Claims
+// that aren't worded like these, or are in another language, pass.
+var dueClaims = []dueClaim{
+	{regexp.MustCompile(`(?i)\b(not |no longer )?overdue\b`), func(groups []string, days int, _ time.Time, hasDue bool) bool {
+		if groups[1] != "" {
+			return !hasDue || days >= 0
+		}
+		return hasDue && days < 0
+	}},
+	{regexp.MustCompile(`(?i)\bdue today\b`), func(_ []string, days int, _ time.Time, hasDue bool) bool {
+		return hasDue && days == 0
+	}},
+	{regexp.MustCompile(`(?i)\bdue tomorrow\b`), func(_ []string, days int, _ time.Time, hasDue bool) bool {
+		return hasDue && days == 1
+	}},
+	{regexp.MustCompile(`(?i)\bdue yesterday\b`), func(_ []string, days int, _ time.Time, hasDue bool) bool {
+		return hasDue && days == -1
+	}},
+	// A day either way, as models count days loosely
+	{regexp.MustCompile(`(?i)\bdue in (\d+) days?\b`), func(groups []string, days int, _ time.Time, hasDue bool) bool {
+		n, _ := strconv.Atoi(groups[1])
+		return hasDue && days >= n-1 && days <= n+1
+	}},
+	{regexp.MustCompile(`(?i)\bdue (?:on |by )?(\d{4}-\d{2}-\d{2})\b`), func(groups []string, _ int, due time.Time, hasDue bool) bool {
+		return hasDue && due.Format("2006-01-02") == groups[1]
+	}},
+	{regexp.MustCompile(`(?i)\b(?:no|without a|without any) (?:due date|deadline)\b`), func(_ []string, _ int, _ time.Time, hasDue bool) bool {
+		return !hasDue
+	}},
+}
+
+// checkPriorities validates a ranking of tasks against the tasks it ranks.
+// Entries that name a task by its title, or with its ID changed in case or
+// spacing, are given the ID; entries for tasks that weren't asked about
+// are dropped, as are second entries for a task. The ranking fails when it
+// leaves any task out. Explanations that say something about a due date
+// that isn't so have that part replaced with what is. Out-of-range
+// priorities and malformed positions are repaired. Every repair is
+// recorded for LastCorrections.
+func (g *GeminiClient) checkPriorities(priorities []TaskPriority, tasks []*todo.Task, clock *datetime.Clock) ([]TaskPriority, error) {
+	byID := make(map[string]*todo.Task, len(tasks))
+	byLooseID := make(map[string]*todo.Task, len(tasks))
+	byTitle := make(map[string]*todo.Task, len(tasks))
+	ambiguous := make(map[string]bool)
+	for _, task := range tasks {
+		byID[task.ID] = task
+		byLooseID[loose(task.ID)] = task
+		// The model saw titles as promptText left them
+		for _, title := range []string{loose(task.Title), loose(g.promptText(task.Title))} {
+			if other, ok := byTitle[title]; ok && other != task {
+				ambiguous[title] = true
+			}
+			byTitle[title] = task
+		}
+	}
+
+	var corrections []string
+	checked := make([]TaskPriority, 0, len(tasks))
+	ranked := make(map[string]bool, len(tasks))
+	for _, priority := range priorities {
+		task, ok := byID[priority.TaskID]
+		if !ok {
+			task, ok = byLooseID[loose(priority.TaskID)]
+			if !ok && !ambiguous[loose(priority.TaskID)] {
+				task, ok = byTitle[loose(priority.TaskID)]
+			}
+			if !ok {
+				corrections = append(corrections, fmt.Sprintf("dropped the ranking of unknown task %q", priority.TaskID))
+				continue
+			}
+			corrections = append(corrections, fmt.Sprintf("'%s' was named %q instead of by its ID", task.Title, priority.TaskID))
+			priority.TaskID = task.ID
+		}
+		if ranked[task.ID] {
+			corrections = append(corrections, fmt.Sprintf("'%s' was ranked more than once; kept the first", task.Title))
+			continue
+		}
+		ranked[task.ID] = true
+		if clock != nil {
+			var fixed []string
+			priority.Explanation, fixed = checkDueClaims(priority.Explanation, task, clock)
+			corrections = append(corrections, fixed...)
+		}
+		checked = append(checked, priority)
+	}
+
+	if len(checked) != len(tasks) {
+		var missing []string
+		for _, task := range tasks {
+			if !ranked[task.ID] {
+				missing = append(missing, fmt.Sprintf("'%s'", task.Title))
+			}
+		}
+		if len(missing) > maxNamedMissing {
+			missing = append(missing[:maxNamedMissing], "...")
+		}
+		return nil, fmt.Errorf("received incorrect number of priorities: got %d for %d tasks, missing %s", len(checked), len(tasks), strings.Join(missing, ", "))
+	}
+
+	// Ensure all tasks have valid priorities and positions
+	for i := range checked {
+		if checked[i].Priority < 0 || checked[i].Priority > 100 {
+			checked[i].Priority = 50 // Default to middle priority if invalid
+		}
+		if len(checked[i].NewPosition) != 5 {
+			checked[i].NewPosition = fmt.Sprintf("%05d", i+1) // Generate position if invalid
+		}
+	}
+
+	g.mu.Lock()
+	g.lastCorrections = corrections
+	g.mu.Unlock()
+	return checked, nil
+}
+
+// LastCorrections describes what was repaired in the most recent ranking
+// that passed its checks, such as unknown tasks dropped and explanations
+// corrected; empty when it needed no repair
+func (g *GeminiClient) LastCorrections() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.lastCorrections
+}
+
+// checkDueClaims replaces what explanation says about task's due date with
+// the truth where the two disagree, and describes each replacement
+func checkDueClaims(explanation string, task *todo.Task, clock *datetime.Clock) (string, []string) {
+	due, hasDue := clock.ParseDue(task.Due)
+	days, _ := clock.DaysUntil(task.Due)
+	var corrections []string
+	for _, claim := range dueClaims {
+		explanation = claim.pattern.ReplaceAllStringFunc(explanation, func(match string) string {
+			if claim.holds(claim.pattern.FindStringSubmatch(match), days, due, hasDue) {
+				return match
+			}
+			fact := dueFact(days, due, hasDue)
+			corrections = append(corrections, fmt.Sprintf("the explanation for '%s' said %q, but it is %s", task.Title, match, fact))
+			return matchCase(match, fact)
+		})
+	}
+	return explanation, corrections
+}
+
+// dueFact words a task's due date the way explanations do
+func dueFact(days int, due time.Time, hasDue bool) string {
+	switch {
+	case !hasDue:
+		return "without a due date"
+	case days < 0:
+		return fmt.Sprintf("overdue since %s", due.Format("2006-01-02"))
+	case days == 0:
+		return "due today"
+	case days == 1:
+		return "due tomorrow"
+	}
+	return fmt.Sprintf("due %s", due.Format("2006-01-02"))
+}
+
+// matchCase capitalizes replacement when the text it replaces was
+// capitalized, as at the start of a sentence
+func matchCase(original, replacement string) string {
+	first, _ := utf8.DecodeRuneInString(original)
+	if !unicode.IsUpper(first) {
+		return replacement
+	}
+	r, size := utf8.DecodeRuneInString(replacement)
+	return string(unicode.ToUpper(r)) + replacement[size:]
+}
+
+// loose normalizes an ID or title for matching what a model wrote
+func loose(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
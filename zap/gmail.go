@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	gmailapi "google.golang.org/api/gmail/v1"
+
+	"zap/auth"
+	"zap/config"
+	"zap/ingest"
+)
+
+// runGmail turns the profile's starred or labelled mail into tasks without
+// running prioritization
+func runGmail(args []string) {
+	flags := flag.NewFlagSet("gmail", flag.ExitOnError)
+	runOpts := registerRunFlags(flags)
+	flags.Parse(args)
+
+	ctx := context.Background()
+	app, err := runOpts.newApp(ctx, flags)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer app.Close()
+	if app.profile.Gmail == nil {
+		log.Fatal("the profile has no gmail section; add one with the query of the mail to turn into tasks")
+	}
+
+	created, err := app.ingestMail(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Created %d tasks from email in list %s\n", created, app.profile.Gmail.List)
+}
+
+// ingestMail creates tasks for the mail matching the profile's gmail query
+// that hasn't been turned into tasks yet
+func (a *app) ingestMail(ctx context.Context) (int, error) {
+	settings := a.profile.Gmail
+	taskList, err := a.service.GetTaskListByTitle(settings.List)
+	if err != nil {
+		return 0, fmt.Errorf("gmail: %v", err)
+	}
+	client, err := createGmailClient(ctx, a.profile, a.userEmail)
+	if err != nil {
+		return 0, fmt.Errorf("gmail: %v", err)
+	}
+	mail := ingest.NewMail(client, a.orchestrator, a.store, a.userEmail)
+	return mail.Ingest(ctx, taskList.ID, settings.Query, settings.Max)
+}
+
+// createGmailClient authenticates to the Gmail API the same way the Tasks
+// client does: as the signed-in user or by impersonating userEmail
+func createGmailClient(ctx context.Context, profile *config.Profile, userEmail string) (*gmailapi.Service, error) {
+	ctx, err := httpContext(ctx, profile)
+	if err != nil {
+		return nil, err
+	}
+	if profile.Auth == config.AuthOAuth {
+		oauthConfig, err := auth.NewOAuthConfig(profile.ClientSecret, profile.Scopes...)
+		if err != nil {
+			return nil, err
+		}
+		token, err := auth.LoadToken(profile.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		return oauthConfig.CreateGmailClient(ctx, token, profile.TokenFile)
+	}
+
+	authConfig, err := auth.NewConfig(profile.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	return authConfig.CreateGmailClientAsUser(ctx, userEmail)
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"zap/api"
+	"zap/config"
+	"zap/jobs"
+	"zap/progress"
+	"zap/rpc"
+	"zap/tasks"
+	"zap/todo"
+)
+
+// grpcCodes are the gRPC codes for the statuses the HTTP API answers with
+// when a call can't act in a session
+var grpcCodes = map[int]codes.Code{
+	http.StatusUnauthorized: codes.Unauthenticated,
+	http.StatusForbidden:    codes.PermissionDenied,
+	http.StatusBadGateway:   codes.Unavailable,
+}
+
+// grpcServer answers calls of the gRPC API, acting in the same sessions as
+// the HTTP API, so runs started over either show up in both
+type grpcServer struct {
+	s *server
+}
+
+// serveGRPC serves the gRPC API on addr until ctx is done
+func (s *server) serveGRPC(ctx context.Context, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	server := grpc.NewServer()
+	rpc.RegisterZapServer(server, &grpcServer{s: s})
+	go func() {
+		<-ctx.Done()
+		server.GracefulStop()
+	}()
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			log.Printf("Error serving the gRPC API: %v", err)
+		}
+	}()
+	log.Printf("Serving the gRPC API at %s", addr)
+	return nil
+}
+
+// session finds the session a call acts in, with the token its metadata
+// passes, if the token allows scope
+func (g *grpcServer) session(ctx context.Context, user, scope string) (*session, error) {
+	var secret string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, value := range md.Get("authorization") {
+			secret, _ = strings.CutPrefix(value, "Bearer ")
+		}
+	}
+	sess, _, code, err := g.s.session(secret, user, scope)
+	if err != nil {
+		return nil, status.Error(grpcCodes[code], err.Error())
+	}
+	return sess, nil
+}
+
+// requestedLists returns the target lists a call asks for, all of them
+// when it names none
+func requestedLists(sess *session, lists []string) ([]string, error) {
+	targets := sess.app.profile.TargetLists
+	if len(lists) == 0 {
+		return targets, nil
+	}
+	for _, list := range lists {
+		if !slices.Contains(targets, list) {
+			return nil, status.Errorf(codes.InvalidArgument, "%s is not a target list", list)
+		}
+	}
+	return lists, nil
+}
+
+// ListTasks answers with the open tasks of target lists in order, with
+// their latest rankings
+func (g *grpcServer) ListTasks(ctx context.Context, req *rpc.ListTasksRequest) (*rpc.ListTasksResponse, error) {
+	sess, err := g.session(ctx, req.User, config.ScopeRead)
+	if err != nil {
+		return nil, err
+	}
+	titles, err := requestedLists(sess, req.Lists)
+	if err != nil {
+		return nil, err
+	}
+	// A run holds the app until it finishes; the call doesn't wait for it
+	if !sess.mu.TryLock() {
+		return nil, status.Error(codes.Unavailable, "a run is in progress; ask again when it finishes")
+	}
+	defer sess.mu.Unlock()
+
+	a := sess.app
+	history := tasks.NewHistory(a.store, true)
+	records, err := history.Records()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	a.service.ResetCache()
+
+	resp := &rpc.ListTasksResponse{}
+	for _, title := range titles {
+		taskList, err := a.service.GetTaskListByTitle(title)
+		if err != nil {
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+		listTasks, err := a.service.ListTasks(taskList.ID)
+		if err != nil {
+			log.Printf("Error fetching tasks of %s for %s: %v", title, sess, err)
+			return nil, status.Errorf(codes.Unavailable, "unable to fetch the tasks of %s", title)
+		}
+		list := &rpc.TaskList{Id: taskList.ID, Title: taskList.Title}
+		if runs, err := history.Runs(taskList.ID); err == nil && len(runs) > 0 {
+			latest := runs[len(runs)-1]
+			list.Ranked, list.RankedBy = timestamppb.New(latest.Time), latest.Source
+		}
+		tasks.NewTaskTree(listTasks).Walk(func(node *tasks.TaskNode) bool {
+			task := node.Task
+			if task.Status == "completed" || a.filter.Excludes(task) {
+				return false
+			}
+			list.Tasks = append(list.Tasks, rpcTask(a, task, records))
+			return true
+		})
+		resp.Lists = append(resp.Lists, list)
+	}
+	return resp, nil
+}
+
+// rpcTask describes a task with its ranking, if it has one
+func rpcTask(a *app, task *todo.Task, records map[string]tasks.RankRecord) *rpc.Task {
+	t := &rpc.Task{Id: task.ID, Title: task.Title, Notes: task.Notes, Parent: task.Parent}
+	if day, ok := a.clock.ParseDue(task.Due); ok {
+		t.Due = day.Format("2006-01-02")
+	}
+	if record, ok := records[task.ID]; ok {
+		t.Ranked = true
+		t.Priority = record.Priority
+		t.Explanation = record.Explanation
+	}
+	return t
+}
+
+// Prioritize queues a run of target lists, or of them all, and streams its
+// progress
+func (g *grpcServer) Prioritize(req *rpc.PrioritizeRequest, stream grpc.ServerStreamingServer[rpc.RunUpdate]) error {
+	sess, err := g.session(stream.Context(), req.User, config.ScopeRun)
+	if err != nil {
+		return err
+	}
+	lists, err := requestedLists(sess, req.Lists)
+	if err != nil {
+		return err
+	}
+	if len(req.Lists) == 0 {
+		return g.follow(stream, sess, "gRPC: prioritize", jobPrioritize, nil)
+	}
+	return g.follow(stream, sess, "gRPC: prioritize "+strings.Join(lists, ", "), jobPrioritize, lists)
+}
+
+// SuggestSubtasks queues creating subtasks in a target list and streams the
+// run's progress
+func (g *grpcServer) SuggestSubtasks(req *rpc.SuggestSubtasksRequest, stream grpc.ServerStreamingServer[rpc.RunUpdate]) error {
+	sess, err := g.session(stream.Context(), req.User, config.ScopeRun)
+	if err != nil {
+		return err
+	}
+	if req.List == "" || !slices.Contains(sess.app.profile.TargetLists, req.List) {
+		return status.Error(codes.InvalidArgument, "a target list is required")
+	}
+	if err := sess.app.requireGemini(); err != nil {
+		return status.Errorf(codes.FailedPrecondition, "subtasks need Gemini: %v", err)
+	}
+	return g.follow(stream, sess, "gRPC: create subtasks in "+req.List, jobSubtasks, []string{req.List})
+}
+
+// follow queues a run for the call and streams its progress, then its
+// report once its job finished
+func (g *grpcServer) follow(stream grpc.ServerStreamingServer[rpc.RunUpdate], sess *session, trigger, kind string, lists []string) error {
+	report, err := sess.start(trigger, kind, lists)
+	if err != nil {
+		log.Printf("Unable to queue a run for %s: %v", sess, err)
+		return status.Error(codes.Internal, "unable to queue the run")
+	}
+	err = sess.follow(stream.Context(), report, func(e progress.Event) error {
+		return stream.Send(&rpc.RunUpdate{Update: &rpc.RunUpdate_Progress{Progress: &rpc.Progress{
+			RunId:   report.ID,
+			Phase:   e.Phase,
+			Item:    e.Item,
+			Done:    int32(e.Done),
+			Total:   int32(e.Total),
+			Ended:   e.Ended,
+			Message: e.Message,
+		}}})
+	})
+	if err != nil {
+		// The run carries on without the caller
+		return status.FromContextError(err).Err()
+	}
+	return stream.Send(&rpc.RunUpdate{Update: &rpc.RunUpdate_Report{Report: rpcReport(sess.apiReport(report))}})
+}
+
+// GetRunReport answers with the report of a run queued through the server,
+// or of the latest one, from the runs of this server or else the job
+// history
+func (g *grpcServer) GetRunReport(ctx context.Context, req *rpc.GetRunReportRequest) (*rpc.RunReport, error) {
+	sess, err := g.session(ctx, req.User, config.ScopeRead)
+	if err != nil {
+		return nil, err
+	}
+	if report := sess.report(req.RunId); report != nil {
+		return rpcReport(sess.apiReport(report)), nil
+	}
+	var job jobs.Job
+	if req.RunId != "" {
+		job, err = sess.jobs.Get(req.RunId)
+	} else if history, listErr := sess.jobs.List(); listErr != nil {
+		err = listErr
+	} else if len(history) > 0 {
+		job = history[0]
+	} else {
+		return nil, status.Error(codes.NotFound, "no runs were queued through the server yet")
+	}
+	if errors.Is(err, jobs.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "no run %s", req.RunId)
+	}
+	if err != nil {
+		log.Printf("Error reading the jobs of %s: %v", sess, err)
+		return nil, status.Error(codes.Internal, "unable to read the jobs")
+	}
+	return rpcReport(jobReport(job)), nil
+}
+
+// rpcReport describes what a run did, or has done so far
+func rpcReport(r api.RunReport) *rpc.RunReport {
+	m := &rpc.RunReport{
+		RunId:   r.ID,
+		Trigger: r.Trigger,
+		Started: timestamppb.New(r.Started),
+		DryRun:  r.DryRun,
+		Skipped: r.Skipped,
+		Errors:  r.Errors,
+	}
+	if !r.Finished.IsZero() {
+		m.Finished = timestamppb.New(r.Finished)
+	}
+	for _, list := range r.Lists {
+		m.Lists = append(m.Lists, &rpc.ListReport{Title: list.Title, Tasks: int32(list.Tasks), RankedBy: list.RankedBy, Moves: int32(list.Moves)})
+	}
+	for _, subtasks := range r.Subtasks {
+		m.Subtasks = append(m.Subtasks, &rpc.SubtaskReport{List: subtasks.List, Created: int32(subtasks.Created), Error: subtasks.Error})
+	}
+	for _, warning := range r.Warnings {
+		m.Warnings = append(m.Warnings, &rpc.Warning{List: warning.List, Problem: warning.Problem, Fix: warning.Fix})
+	}
+	return m
+}
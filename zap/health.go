@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// health reports on a long-running zap for container platforms: /healthz
+// answers while the process serves, and /readyz once it has done its work
+// and as long as the last attempt succeeded. /metrics shows how fast
+// requests to the APIs may go.
+type health struct {
+	mu    sync.Mutex
+	ready bool
+	err   error
+}
+
+// set records the outcome of the latest run or fetch
+func (h *health) set(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.ready = true
+	h.err = err
+}
+
+// register adds the health endpoints to mux
+func (h *health) register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /metrics", serveMetrics)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		h.mu.Lock()
+		ready, err := h.ready, h.err
+		h.mu.Unlock()
+		switch {
+		case !ready:
+			http.Error(w, "starting", http.StatusServiceUnavailable)
+		case err != nil:
+			// The error itself is logged; it may say more than callers
+			// should see
+			http.Error(w, "the last attempt failed", http.StatusServiceUnavailable)
+		default:
+			fmt.Fprintln(w, "ok")
+		}
+	})
+}
+
+// serve serves only the health endpoints on addr until ctx is done
+func (h *health) serve(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	h.register(mux)
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Serving health checks at http://%s/healthz and /readyz, and metrics at /metrics", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
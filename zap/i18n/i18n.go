@@ -0,0 +1,159 @@
+package i18n
+
+import (
+	"fmt"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+	"golang.org/x/text/message"
+	"golang.org/x/text/message/catalog"
+)
+
+// Messages are looked up by their English format string, so output
+// without a translation is printed in English as before. Add a language
+// by adding its translations to translations.
+
+// translations holds the translated run messages by language and English
+// format string
+var translations = map[language.Tag]map[string]string{
+	language.German: {
+		"Running in read-only mode: no changes will be made.\n":                                      "Schreibgeschützter Modus: Es werden keine Änderungen vorgenommen.\n",
+		"Dry run: planned changes will be printed, not applied.\n":                                   "Probelauf: Geplante Änderungen werden ausgegeben, nicht ausgeführt.\n",
+		"Analyzing and prioritizing tasks in lists: %v\n":                                            "Aufgaben in den Listen werden analysiert und priorisiert: %v\n",
+		"Successfully prioritized %d tasks in list: %s (ranked by %s)\n":                             "%d Aufgaben in Liste %s priorisiert (bewertet von %s)\n",
+		"Suggested priorities for %d tasks in list: %s (order unchanged, ranked by %s)\n":            "Vorgeschlagene Prioritäten für %d Aufgaben in Liste %s (Reihenfolge unverändert, bewertet von %s)\n",
+		"No top-level tasks found in list: %s\n":                                                     "Keine Aufgaben der obersten Ebene in Liste %s\n",
+		"Kept the current order of list %s\n":                                                        "Die bisherige Reihenfolge von Liste %s wurde beibehalten\n",
+		"List %s can't record a ranking, so it is only reported\n":                                   "Liste %s kann keine Rangfolge speichern, sie wird daher nur angezeigt\n",
+		"Dropped %d changes of the run started %s\n":                                                 "%d Änderungen des um %s gestarteten Laufs verworfen\n",
+		"Resuming the run started %s: %d changes applied, %d to go\n":                                "Setze den um %s gestarteten Lauf fort: %d Änderungen angewendet, %d ausstehend\n",
+		"%d changes of an interrupted run were not applied; run zap resume to apply them\n":          "%d Änderungen eines unterbrochenen Laufs wurden nicht angewendet; zap resume wendet sie an\n",
+		"Kept changes made elsewhere to %d tasks instead of zap's:\n  %s\n":                          "Bei %d Aufgaben wurden Änderungen von anderswo statt der von zap beibehalten:\n  %s\n",
+		"Promoted experiment %s after %d days in shadow; its rankings are applied from now on\n":     "Experiment %s nach %d Tagen im Schattenbetrieb übernommen; seine Reihenfolgen werden ab jetzt angewendet\n",
+		"Experiment %s on list %s: %d tasks ranked differently, %d of the top 3 shared (tau %.2f)\n": "Experiment %s bei Liste %s: %d Aufgaben anders eingestuft, %d der ersten 3 gleich (Tau %.2f)\n",
+		"All %d tasks in list %s are excluded by filters\n":                                          "Alle %d Aufgaben in Liste %s sind durch Filter ausgeschlossen\n",
+		"Created %d recurring task instances\n":                                                      "%d wiederkehrende Aufgaben angelegt\n",
+		"Created %d tasks from email\n":                                                              "%d Aufgaben aus E-Mails angelegt\n",
+		"Created %d tasks to prepare for meetings\n":                                                 "%d Aufgaben zur Vorbereitung auf Termine angelegt\n",
+		"Mirrored %s to %s: %d written, %d deleted\n":                                                "%s nach %s gespiegelt: %d geschrieben, %d gelöscht\n",
+		"Would create list %s on the CalDAV server\n":                                                "Würde Liste %s auf dem CalDAV-Server anlegen\n",
+		"Woke %d snoozed tasks\n":                                                                    "%d zurückgestellte Aufgaben reaktiviert\n",
+		"Cleaned up %d task titles\n":                                                                "%d Aufgabentitel bereinigt\n",
+		"Created %d subtasks in list: %s\n":                                                          "%d Unteraufgaben in Liste %s angelegt\n",
+		"All tasks in list '%s' already have subtasks\n":                                             "Alle Aufgaben in Liste '%s' haben bereits Unteraufgaben\n",
+		"No tasks found in list: %s\n":                                                               "Keine Aufgaben in Liste %s\n",
+		"Moved %d tasks over the WIP limit of %d from %s to %s\n":                                    "%d Aufgaben über dem WIP-Limit von %d von %s nach %s verschoben\n",
+		"%d tasks in list %s are over its WIP limit of %d\n":                                         "%d Aufgaben in Liste %s liegen über dem WIP-Limit von %d\n",
+		"%s is not set; skipping subtask creation.\n":                                                "%s ist nicht gesetzt; Unteraufgaben werden nicht angelegt.\n",
+		"Exported the report to sheet %s\n":                                                          "Bericht in Tabellenblatt %s exportiert\n",
+		"Waiting for list %s, which another zap process is changing (%s)\n":                          "Warte auf Liste %s, die ein anderer zap-Prozess gerade ändert (%s)\n",
+		"Idempotency check passed: a second run changes nothing.\n":                                  "Idempotenzprüfung bestanden: Ein zweiter Lauf ändert nichts.\n",
+	},
+	language.Spanish: {
+		"Running in read-only mode: no changes will be made.\n":                                      "Modo de solo lectura: no se hará ningún cambio.\n",
+		"Dry run: planned changes will be printed, not applied.\n":                                   "Simulación: los cambios previstos se mostrarán, no se aplicarán.\n",
+		"Analyzing and prioritizing tasks in lists: %v\n":                                            "Analizando y priorizando las tareas de las listas: %v\n",
+		"Successfully prioritized %d tasks in list: %s (ranked by %s)\n":                             "%d tareas priorizadas en la lista %s (clasificadas por %s)\n",
+		"Suggested priorities for %d tasks in list: %s (order unchanged, ranked by %s)\n":            "Prioridades sugeridas para %d tareas de la lista %s (orden sin cambios, clasificadas por %s)\n",
+		"No top-level tasks found in list: %s\n":                                                     "No hay tareas de nivel superior en la lista %s\n",
+		"Kept the current order of list %s\n":                                                        "Se mantuvo el orden actual de la lista %s\n",
+		"List %s can't record a ranking, so it is only reported\n":                                   "La lista %s no puede guardar una clasificación, así que solo se muestra\n",
+		"Dropped %d changes of the run started %s\n":                                                 "Se descartaron %d cambios de la ejecución iniciada el %s\n",
+		"Resuming the run started %s: %d changes applied, %d to go\n":                                "Reanudando la ejecución iniciada el %s: %d cambios aplicados, %d pendientes\n",
+		"%d changes of an interrupted run were not applied; run zap resume to apply them\n":          "No se aplicaron %d cambios de una ejecución interrumpida; ejecuta zap resume para aplicarlos\n",
+		"Kept changes made elsewhere to %d tasks instead of zap's:\n  %s\n":                          "Se mantuvieron los cambios hechos en otro lugar en %d tareas en lugar de los de zap:\n  %s\n",
+		"Promoted experiment %s after %d days in shadow; its rankings are applied from now on\n":     "Experimento %s promovido tras %d días en la sombra; sus clasificaciones se aplican a partir de ahora\n",
+		"Experiment %s on list %s: %d tasks ranked differently, %d of the top 3 shared (tau %.2f)\n": "Experimento %s en la lista %s: %d tareas clasificadas de otra forma, %d de las 3 primeras en común (tau %.2f)\n",
+		"All %d tasks in list %s are excluded by filters\n":                                          "Las %d tareas de la lista %s están excluidas por los filtros\n",
+		"Created %d recurring task instances\n":                                                      "Se crearon %d tareas recurrentes\n",
+		"Created %d tasks from email\n":                                                              "Se crearon %d tareas a partir de correos\n",
+		"Created %d tasks to prepare for meetings\n":                                                 "Se crearon %d tareas para preparar reuniones\n",
+		"Mirrored %s to %s: %d written, %d deleted\n":                                                "%s reflejada en %s: %d escritas, %d eliminadas\n",
+		"Would create list %s on the CalDAV server\n":                                                "Se crearía la lista %s en el servidor CalDAV\n",
+		"Woke %d snoozed tasks\n":                                                                    "Se reactivaron %d tareas pospuestas\n",
+		"Cleaned up %d task titles\n":                                                                "Se limpiaron %d títulos de tareas\n",
+		"Created %d subtasks in list: %s\n":                                                          "Se crearon %d subtareas en la lista %s\n",
+		"All tasks in list '%s' already have subtasks\n":                                             "Todas las tareas de la lista '%s' ya tienen subtareas\n",
+		"No tasks found in list: %s\n":                                                               "No hay tareas en la lista %s\n",
+		"Moved %d tasks over the WIP limit of %d from %s to %s\n":                                    "Se movieron %d tareas por encima del límite WIP de %d de %s a %s\n",
+		"%d tasks in list %s are over its WIP limit of %d\n":                                         "%d tareas de la lista %s superan su límite WIP de %d\n",
+		"%s is not set; skipping subtask creation.\n":                                                "%s no está definida; no se crearán subtareas.\n",
+		"Exported the report to sheet %s\n":                                                          "Informe exportado a la hoja %s\n",
+		"Waiting for list %s, which another zap process is changing (%s)\n":                          "Esperando la lista %s, que otro proceso de zap está modificando (%s)\n",
+		"Idempotency check passed: a second run changes nothing.\n":                                  "Comprobación de idempotencia superada: una segunda ejecución no cambia nada.\n",
+	},
+	language.French: {
+		"Running in read-only mode: no changes will be made.\n":                                      "Mode lecture seule : aucune modification ne sera effectuée.\n",
+		"Dry run: planned changes will be printed, not applied.\n":                                   "Simulation : les modifications prévues seront affichées, pas appliquées.\n",
+		"Analyzing and prioritizing tasks in lists: %v\n":                                            "Analyse et priorisation des tâches des listes : %v\n",
+		"Successfully prioritized %d tasks in list: %s (ranked by %s)\n":                             "%d tâches priorisées dans la liste %s (classées par %s)\n",
+		"Suggested priorities for %d tasks in list: %s (order unchanged, ranked by %s)\n":            "Priorités suggérées pour %d tâches de la liste %s (ordre inchangé, classées par %s)\n",
+		"No top-level tasks found in list: %s\n":                                                     "Aucune tâche de premier niveau dans la liste %s\n",
+		"Kept the current order of list %s\n":                                                        "L'ordre actuel de la liste %s a été conservé\n",
+		"List %s can't record a ranking, so it is only reported\n":                                   "La liste %s ne peut pas enregistrer de classement, il est donc seulement affiché\n",
+		"Dropped %d changes of the run started %s\n":                                                 "%d modifications de l'exécution démarrée le %s abandonnées\n",
+		"Resuming the run started %s: %d changes applied, %d to go\n":                                "Reprise de l'exécution démarrée le %s : %d modifications appliquées, %d restantes\n",
+		"%d changes of an interrupted run were not applied; run zap resume to apply them\n":          "%d modifications d'une exécution interrompue n'ont pas été appliquées ; lancez zap resume pour les appliquer\n",
+		"Kept changes made elsewhere to %d tasks instead of zap's:\n  %s\n":                          "Modifications faites ailleurs conservées pour %d tâches à la place de celles de zap:\n  %s\n",
+		"Promoted experiment %s after %d days in shadow; its rankings are applied from now on\n":     "Expérience %s promue après %d jours en mode fantôme ; ses classements sont appliqués désormais\n",
+		"Experiment %s on list %s: %d tasks ranked differently, %d of the top 3 shared (tau %.2f)\n": "Expérience %s sur la liste %s : %d tâches classées autrement, %d des 3 premières en commun (tau %.2f)\n",
+		"All %d tasks in list %s are excluded by filters\n":                                          "Les %d tâches de la liste %s sont exclues par les filtres\n",
+		"Created %d recurring task instances\n":                                                      "%d tâches récurrentes créées\n",
+		"Created %d tasks from email\n":                                                              "%d tâches créées à partir d'e-mails\n",
+		"Created %d tasks to prepare for meetings\n":                                                 "%d tâches de préparation de réunions créées\n",
+		"Mirrored %s to %s: %d written, %d deleted\n":                                                "%s reproduite dans %s : %d écrites, %d supprimées\n",
+		"Would create list %s on the CalDAV server\n":                                                "Créerait la liste %s sur le serveur CalDAV\n",
+		"Woke %d snoozed tasks\n":                                                                    "%d tâches mises en veille réactivées\n",
+		"Cleaned up %d task titles\n":                                                                "%d titres de tâches nettoyés\n",
+		"Created %d subtasks in list: %s\n":                                                          "%d sous-tâches créées dans la liste %s\n",
+		"All tasks in list '%s' already have subtasks\n":                                             "Toutes les tâches de la liste '%s' ont déjà des sous-tâches\n",
+		"No tasks found in list: %s\n":                                                               "Aucune tâche dans la liste %s\n",
+		"Moved %d tasks over the WIP limit of %d from %s to %s\n":                                    "%d tâches au-delà de la limite WIP de %d déplacées de %s vers %s\n",
+		"%d tasks in list %s are over its WIP limit of %d\n":                                         "%d tâches de la liste %s dépassent sa limite WIP de %d\n",
+		"%s is not set; skipping subtask creation.\n":                                                "%s n'est pas définie ; les sous-tâches ne seront pas créées.\n",
+		"Exported the report to sheet %s\n":                                                          "Rapport exporté dans la feuille %s\n",
+		"Waiting for list %s, which another zap process is changing (%s)\n":                          "En attente de la liste %s, qu'un autre processus zap est en train de modifier (%s)\n",
+		"Idempotency check passed: a second run changes nothing.\n":                                  "Vérification d'idempotence réussie : une seconde exécution ne change rien.\n",
+	},
+}
+
+// messages is the catalog built from translations
+var messages = newCatalog()
+
+func newCatalog() catalog.Catalog {
+	builder := catalog.NewBuilder(catalog.Fallback(language.English))
+	for tag, translated := range translations {
+		for key, translation := range translated {
+			if err := builder.SetString(tag, key, translation); err != nil {
+				panic(fmt.Sprintf("i18n: %s translation of %q: %v", tag, key, err))
+			}
+		}
+	}
+	return builder
+}
+
+// Parse reads a language setting such as "de" or "pt-BR"
+func Parse(name string) (language.Tag, error) {
+	tag, err := language.Parse(name)
+	if err != nil {
+		return language.Und, fmt.Errorf("invalid language %q (want a code such as de or pt-BR): %v", name, err)
+	}
+	return tag, nil
+}
+
+// Name returns the English name of a language, e.g. "German", for prompts
+func Name(tag language.Tag) string {
+	if name := display.English.Tags().Name(tag); name != "" {
+		return name
+	}
+	return tag.String()
+}
+
+// Printer formats messages in a language, falling back to English for
+// messages and languages without a translation
+func Printer(tag language.Tag) *message.Printer {
+	// The matcher falls back to its first language when nothing matches
+	supported := append([]language.Tag{language.English}, messages.Languages()...)
+	_, index, _ := language.NewMatcher(supported).Match(tag)
+	return message.NewPrinter(supported[index], message.Catalog(messages))
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"zap/ics"
+	"zap/store"
+	"zap/tasks"
+)
+
+// feedCacheFor is how long a served feed is reused before the tasks are
+// fetched again, so calendar clients polling often don't use up API quota
+const feedCacheFor = time.Minute
+
+// runICS publishes the open tasks that have due dates as an iCalendar
+// feed, written to a file or served over HTTP
+func runICS(args []string) {
+	flags := flag.NewFlagSet("ics", flag.ExitOnError)
+	runOpts := registerRunFlags(flags)
+	var listTitles listFlag
+	flags.Var(&listTitles, "list", "Task list to include (repeatable; default: the profile's target lists)")
+	outPath := flags.String("out", "-", "File to write the feed to (-: stdout)")
+	serve := flags.String("serve", "", "Serve the feed at /tasks.ics on this address instead, e.g. localhost:8080")
+	token := flags.String("token", "", "Secret that requests to the served feed must pass as ?token=")
+	flags.Parse(args)
+	// Keep stdout for the feed
+	runOpts.out = os.Stderr
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	app, err := runOpts.newApp(ctx, flags)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer app.Close()
+	if len(listTitles) == 0 {
+		listTitles = app.profile.TargetLists
+	}
+
+	if *serve != "" {
+		if err := app.serveICS(ctx, *serve, *token, listTitles); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	feed, err := app.icsFeed(ctx, listTitles)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *outPath == "-" {
+		os.Stdout.Write(feed)
+		return
+	}
+	if err := os.WriteFile(*outPath, feed, 0600); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s\n", *outPath)
+}
+
+// icsFeed renders the open tasks with due dates in the given lists. Each
+// event's description starts with the task's latest zap ranking.
+func (a *app) icsFeed(ctx context.Context, listTitles []string) ([]byte, error) {
+	a.service.ResetCache()
+	// Reopen the state file so rankings from other zap processes show up
+	st, err := store.Open(a.profile.StateFile)
+	if err != nil {
+		return nil, err
+	}
+	records, err := tasks.NewHistory(st, true).Records()
+	if err != nil {
+		return nil, err
+	}
+
+	var events []ics.Event
+	for _, listTitle := range listTitles {
+		taskList, err := a.service.GetTaskListByTitle(listTitle)
+		if err != nil {
+			return nil, err
+		}
+		listTasks, err := a.service.ListAllTasks(ctx, taskList.ID)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching tasks for list %s: %w", listTitle, err)
+		}
+		for _, task := range listTasks {
+			day, ok := a.clock.ParseDue(task.Due)
+			if !ok || task.Deleted || task.Status == "completed" {
+				continue
+			}
+			record, ranked := records[task.ID]
+			description := fmt.Sprintf("Not ranked by zap yet (%s)", taskList.Title)
+			if ranked {
+				description = fmt.Sprintf("zap priority %.0f, #%d of %d in %s", record.Priority, record.Rank, record.Of, taskList.Title)
+				if record.Explanation != "" {
+					description += ": " + record.Explanation
+				}
+			}
+			if userNotes := a.namespace.User(task.Notes); userNotes != "" {
+				description += "\n\n" + userNotes
+			}
+			events = append(events, ics.Event{
+				UID:         task.ID + "@zap",
+				Summary:     task.Title,
+				Description: description,
+				Date:        day,
+				URL:         task.WebViewLink,
+			})
+		}
+	}
+
+	var feed bytes.Buffer
+	if err := ics.Write(&feed, "zap: "+strings.Join(listTitles, ", "), events, a.clock.Now()); err != nil {
+		return nil, err
+	}
+	return feed.Bytes(), nil
+}
+
+// serveICS serves the feed at /tasks.ics, and health checks, until ctx is
+// done. With a token, requests for the feed without it are refused.
+func (a *app) serveICS(ctx context.Context, addr, token string, listTitles []string) error {
+	var mu sync.Mutex
+	var cached []byte
+	var cachedAt time.Time
+
+	// The clients are set up, so the feed can be served; readiness then
+	// follows whether fetching the tasks works
+	var status health
+	status.set(nil)
+	mux := http.NewServeMux()
+	status.register(mux)
+	mux.HandleFunc("GET /tasks.ics", func(w http.ResponseWriter, r *http.Request) {
+		if token != "" && subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("token")), []byte(token)) != 1 {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		mu.Lock()
+		if cached == nil || time.Since(cachedAt) > feedCacheFor {
+			feed, err := a.icsFeed(r.Context(), listTitles)
+			status.set(err)
+			if err != nil {
+				mu.Unlock()
+				log.Printf("Error building calendar feed: %v", err)
+				http.Error(w, "unable to fetch tasks", http.StatusBadGateway)
+				return
+			}
+			cached, cachedAt = feed, time.Now()
+		}
+		feed := cached
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", ics.ContentType)
+		w.Write(feed)
+	})
+
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Serving the calendar feed at http://%s/tasks.ics", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
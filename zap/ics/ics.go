@@ -0,0 +1,138 @@
+package ics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ContentType is the MIME type of an iCalendar feed
+const ContentType = "text/calendar; charset=utf-8"
+
+// maxLineOctets is the longest content line RFC 5545 allows before folding
+const maxLineOctets = 75
+
+// Event is an all-day calendar entry
+type Event struct {
+	UID         string
+	Summary     string
+	Description string
+	Date        time.Time
+	URL         string
+}
+
+// Write writes events as an iCalendar feed named name. stamp is the time
+// the feed was generated.
+func Write(w io.Writer, name string, events []Event, stamp time.Time) error {
+	b := bufio.NewWriter(w)
+	line := func(name, value string) {
+		writeLine(b, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//zap//tasks//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	line("X-WR-CALNAME", escape(name))
+	for _, event := range events {
+		line("BEGIN", "VEVENT")
+		line("UID", escape(event.UID))
+		line("DTSTAMP", stamp.UTC().Format("20060102T150405Z"))
+		line("DTSTART;VALUE=DATE", event.Date.Format("20060102"))
+		line("DTEND;VALUE=DATE", event.Date.AddDate(0, 0, 1).Format("20060102"))
+		line("SUMMARY", escape(event.Summary))
+		if event.Description != "" {
+			line("DESCRIPTION", escape(event.Description))
+		}
+		if event.URL != "" {
+			line("URL", event.URL)
+		}
+		line("TRANSP", "TRANSPARENT")
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+	return b.Flush()
+}
+
+// escape escapes a TEXT value
+func escape(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(text)
+}
+
+// writeLine writes a content line, folding it into continuation lines of
+// at most maxLineOctets without splitting UTF-8 characters
+func writeLine(w *bufio.Writer, line string) {
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		fmt.Fprintf(w, "%s\r\n ", line[:cut])
+		line = line[cut:]
+		// Continuation lines start with a space, which counts toward the limit
+		limit = maxLineOctets - 1
+	}
+	fmt.Fprintf(w, "%s\r\n", line)
+}
+
+// Todo is a task as an iCalendar to-do
+type Todo struct {
+	UID         string
+	Summary     string
+	Description string
+	// Due is the day the task is due; zero when it has no due date
+	Due time.Time
+	// Priority runs from 1 (highest) to 9 (lowest); 0 leaves it undefined
+	Priority int
+	// Completed is when the task was completed; zero while it is open
+	Completed time.Time
+	// Parent is the UID of the to-do this one is part of
+	Parent string
+	URL    string
+}
+
+// WriteTodo writes a calendar holding one to-do, the way CalDAV servers
+// store them. stamp is the time the to-do was written.
+func WriteTodo(w io.Writer, todo Todo, stamp time.Time) error {
+	b := bufio.NewWriter(w)
+	line := func(name, value string) {
+		writeLine(b, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//zap//tasks//EN")
+	line("BEGIN", "VTODO")
+	line("UID", escape(todo.UID))
+	line("DTSTAMP", stamp.UTC().Format("20060102T150405Z"))
+	line("SUMMARY", escape(todo.Summary))
+	if todo.Description != "" {
+		line("DESCRIPTION", escape(todo.Description))
+	}
+	if !todo.Due.IsZero() {
+		line("DUE;VALUE=DATE", todo.Due.Format("20060102"))
+	}
+	if todo.Priority > 0 {
+		line("PRIORITY", fmt.Sprint(todo.Priority))
+	}
+	if todo.Completed.IsZero() {
+		line("STATUS", "NEEDS-ACTION")
+	} else {
+		line("STATUS", "COMPLETED")
+		line("COMPLETED", todo.Completed.UTC().Format("20060102T150405Z"))
+	}
+	if todo.Parent != "" {
+		line("RELATED-TO;RELTYPE=PARENT", escape(todo.Parent))
+	}
+	if todo.URL != "" {
+		line("URL", todo.URL)
+	}
+	line("END", "VTODO")
+	line("END", "VCALENDAR")
+	return b.Flush()
+}
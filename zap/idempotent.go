@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"zap/tasks"
+	"zap/todo"
+)
+
+// assertIdempotent repeats the run against a writer that only collects
+// mutations, reusing the model's answers from the first run, and fails if
+// the repeat would change anything
+func (a *app) assertIdempotent(ctx context.Context) error {
+	plan := tasks.NewPlanWriter()
+	a.orchestrator = tasks.NewOrchestrator(plan)
+	a.dryRun = true
+	a.replaying = true
+
+	a.progress.Printf("\nChecking idempotency: repeating the run without applying changes...\n")
+	if err := a.run(ctx); err != nil {
+		return fmt.Errorf("idempotency check: %v", err)
+	}
+
+	planned := plan.Planned()
+	if len(planned) == 0 {
+		a.progress.Printf("Idempotency check passed: a second run changes nothing.\n")
+		return nil
+	}
+	summaries := make([]string, len(planned))
+	for i, m := range planned {
+		summaries[i] = m.Summary
+	}
+	return fmt.Errorf("idempotency check failed: a second run would make %d changes:\n  %s", len(planned), strings.Join(summaries, "\n  "))
+}
+
+// recordAsked remembers the top-level tasks without subtasks, which are
+// the ones SuggestSubtasks asks the model about
+func (a *app) recordAsked(tree *tasks.TaskTree) {
+	if a.subtasksAsked == nil {
+		a.subtasksAsked = make(map[string]bool)
+	}
+	for _, root := range tree.Roots {
+		if root.Task.Parent == "" && len(root.Children) == 0 {
+			a.subtasksAsked[root.Task.ID] = true
+		}
+	}
+}
+
+// withoutAsked drops the tasks in asked
+func withoutAsked(listTasks []*todo.Task, asked map[string]bool) []*todo.Task {
+	var kept []*todo.Task
+	for _, task := range listTasks {
+		if !asked[task.ID] {
+			kept = append(kept, task)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,125 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+	"time"
+
+	"google.golang.org/api/gmail/v1"
+
+	"zap/store"
+	"zap/tasks"
+	"zap/todo"
+)
+
+// bucket is the store bucket holding the messages already turned into tasks
+const bucket = "gmail"
+
+// noSubject titles tasks for messages without a subject
+const noSubject = "(no subject)"
+
+// Ingested records the task created for a message
+type Ingested struct {
+	TaskID  string    `json:"taskId"`
+	ListID  string    `json:"listId"`
+	Created time.Time `json:"created"`
+}
+
+// Mail turns the messages matching a Gmail search into tasks, each message
+// once: its subject becomes the title, and a link to it and its snippet
+// the notes
+type Mail struct {
+	gmail        *gmail.Service
+	orchestrator *tasks.Orchestrator
+	store        *store.Store
+	// user picks the account links open in, when signed in to several
+	user string
+	now  func() time.Time
+}
+
+// NewMail creates an ingester reading mail with client as user
+func NewMail(client *gmail.Service, orchestrator *tasks.Orchestrator, st *store.Store, user string) *Mail {
+	return &Mail{gmail: client, orchestrator: orchestrator, store: st, user: user, now: time.Now}
+}
+
+// Ingest creates a task in the list for every message matching query,
+// newest first and up to max, that hasn't been turned into one before. It
+// returns the number of tasks created. Dry runs print the inserts and
+// record nothing.
+func (m *Mail) Ingest(ctx context.Context, taskListID, query string, max int) (int, error) {
+	list, err := m.gmail.Users.Messages.List("me").Q(query).MaxResults(int64(max)).Context(ctx).Do()
+	if err != nil {
+		return 0, fmt.Errorf("searching mail for %q: %v", query, err)
+	}
+
+	created := 0
+	for _, ref := range list.Messages {
+		var done Ingested
+		if found, err := m.store.Get(bucket, ref.Id, &done); err != nil || found {
+			continue
+		}
+		message, err := m.gmail.Users.Messages.Get("me", ref.Id).Format("metadata").MetadataHeaders("Subject", "From").Context(ctx).Do()
+		if err != nil {
+			return created, fmt.Errorf("reading message %s: %v", ref.Id, err)
+		}
+
+		task := m.task(message)
+		results, err := m.orchestrator.Apply(ctx, []tasks.Mutation{{
+			Kind:       tasks.MutationInsert,
+			TaskListID: taskListID,
+			Task:       task,
+			Summary:    fmt.Sprintf("create task '%s' from email", task.Title),
+		}})
+		if err != nil {
+			return created, err
+		}
+		if len(results) == 0 || results[0].Task == nil || results[0].Task.ID == "" {
+			continue
+		}
+		created++
+		if err := m.store.Put(bucket, ref.Id, Ingested{TaskID: results[0].Task.ID, ListID: taskListID, Created: m.now()}); err != nil {
+			return created, err
+		}
+	}
+	return created, nil
+}
+
+// task builds the task for a message
+func (m *Mail) task(message *gmail.Message) *todo.Task {
+	var subject, from string
+	if message.Payload != nil {
+		for _, header := range message.Payload.Headers {
+			switch strings.ToLower(header.Name) {
+			case "subject":
+				subject = strings.TrimSpace(header.Value)
+			case "from":
+				from = strings.TrimSpace(header.Value)
+			}
+		}
+	}
+	if subject == "" {
+		subject = noSubject
+	}
+
+	notes := []string{m.link(message)}
+	if from != "" {
+		notes = append(notes, "From: "+from)
+	}
+	// Snippets come HTML-escaped
+	if snippet := html.UnescapeString(message.Snippet); snippet != "" {
+		notes = append(notes, "", snippet)
+	}
+	return &todo.Task{Title: subject, Notes: strings.Join(notes, "\n"), Status: "needsAction"}
+}
+
+// link returns the address that opens a message's conversation in Gmail
+func (m *Mail) link(message *gmail.Message) string {
+	account := "0"
+	if m.user != "" {
+		account = url.PathEscape(m.user)
+	}
+	return fmt.Sprintf("https://mail.google.com/mail/u/%s/#all/%s", account, message.ThreadId)
+}
@@ -0,0 +1,185 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+
+	"zap/config"
+	"zap/datetime"
+	"zap/gemini"
+	"zap/store"
+	"zap/tasks"
+	"zap/todo"
+)
+
+// prepBucket is the store bucket holding the meetings already prepared for
+const prepBucket = "prep"
+
+// Prepared records the tasks created to prepare for a meeting
+type Prepared struct {
+	TaskIDs []string  `json:"taskIds"`
+	ListID  string    `json:"listId"`
+	Created time.Time `json:"created"`
+}
+
+// Prep has the model write preparation tasks for the upcoming meetings
+// whose titles contain one of the settings' keywords, once per meeting
+type Prep struct {
+	calendar     *calendar.Service
+	gemini       *gemini.GeminiClient
+	orchestrator *tasks.Orchestrator
+	store        *store.Store
+	clock        *datetime.Clock
+	settings     config.Prep
+}
+
+// NewPrep creates a preparer reading meetings with client
+func NewPrep(client *calendar.Service, geminiClient *gemini.GeminiClient, orchestrator *tasks.Orchestrator, st *store.Store, clock *datetime.Clock, settings config.Prep) *Prep {
+	return &Prep{calendar: client, gemini: geminiClient, orchestrator: orchestrator, store: st, clock: clock, settings: settings}
+}
+
+// Prepare creates the preparation tasks in the list for the matching
+// meetings of the coming days that weren't prepared for before, and
+// returns how many it created. Meetings the model wrote no tasks for are
+// asked about again next time. Dry runs print the inserts and record
+// nothing.
+func (p *Prep) Prepare(ctx context.Context, taskListID string) (int, error) {
+	meetings, err := p.upcoming(ctx)
+	if err != nil || len(meetings) == 0 {
+		return 0, err
+	}
+	answers, err := p.gemini.PrepareForMeetings(ctx, meetings, p.clock)
+	if err != nil {
+		return 0, err
+	}
+	byMeeting := make(map[string][]gemini.PrepTask)
+	for _, answer := range answers {
+		byMeeting[answer.EventID] = append(byMeeting[answer.EventID], answer)
+	}
+
+	created := 0
+	for _, meeting := range meetings {
+		var mutations []tasks.Mutation
+		for _, answer := range byMeeting[meeting.ID] {
+			task := p.task(meeting, answer)
+			mutations = append(mutations, tasks.Mutation{
+				Kind:       tasks.MutationInsert,
+				TaskListID: taskListID,
+				Task:       task,
+				Summary:    fmt.Sprintf("create task '%s' to prepare for '%s'", task.Title, meeting.Title),
+			})
+		}
+		if len(mutations) == 0 {
+			continue
+		}
+		results, err := p.orchestrator.Apply(ctx, mutations)
+		if err != nil {
+			return created, err
+		}
+		prepared := Prepared{ListID: taskListID, Created: p.clock.Now()}
+		for _, result := range results {
+			if result.Task != nil && result.Task.ID != "" {
+				prepared.TaskIDs = append(prepared.TaskIDs, result.Task.ID)
+			}
+		}
+		if len(prepared.TaskIDs) == 0 {
+			continue
+		}
+		created += len(prepared.TaskIDs)
+		if err := p.store.Put(prepBucket, p.key(meeting.ID), prepared); err != nil {
+			return created, err
+		}
+	}
+	return created, nil
+}
+
+// upcoming lists the meetings of the coming days that match a keyword and
+// weren't prepared for yet. Cancelled and declined meetings are left out.
+func (p *Prep) upcoming(ctx context.Context) ([]gemini.Meeting, error) {
+	now := p.clock.Now()
+	end := p.clock.Today().AddDate(0, 0, p.settings.Days+1)
+	list, err := p.calendar.Events.List(p.settings.Calendar).Context(ctx).
+		TimeMin(now.Format(time.RFC3339)).
+		TimeMax(end.Format(time.RFC3339)).
+		SingleEvents(true).
+		OrderBy("startTime").
+		Do()
+	if err != nil {
+		return nil, fmt.Errorf("reading calendar %s: %v", p.settings.Calendar, err)
+	}
+
+	var meetings []gemini.Meeting
+	for _, item := range list.Items {
+		if item.Status == "cancelled" || item.Start == nil || declined(item) || !p.matches(item.Summary) {
+			continue
+		}
+		var prepared Prepared
+		if found, err := p.store.Get(prepBucket, p.key(item.Id), &prepared); err != nil || found {
+			continue
+		}
+		meeting := gemini.Meeting{ID: item.Id, Title: item.Summary, Description: item.Description, Attendees: len(item.Attendees)}
+		if item.Start.Date != "" {
+			meeting.Start, err = time.ParseInLocation("2006-01-02", item.Start.Date, p.clock.Location())
+			meeting.AllDay = true
+		} else {
+			meeting.Start, err = time.Parse(time.RFC3339, item.Start.DateTime)
+		}
+		if err != nil {
+			continue
+		}
+		meetings = append(meetings, meeting)
+	}
+	return meetings, nil
+}
+
+// matches reports whether a meeting title contains one of the keywords,
+// ignoring case
+func (p *Prep) matches(title string) bool {
+	title = strings.ToLower(title)
+	for _, keyword := range p.settings.Keywords {
+		if keyword != "" && strings.Contains(title, strings.ToLower(keyword)) {
+			return true
+		}
+	}
+	return false
+}
+
+// task builds a preparation task, due the settings' days before the
+// meeting but not before today
+func (p *Prep) task(meeting gemini.Meeting, answer gemini.PrepTask) *todo.Task {
+	start := meeting.Start.In(p.clock.Location())
+	day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, p.clock.Location()).AddDate(0, 0, -p.settings.DaysBefore)
+	if today := p.clock.Today(); day.Before(today) {
+		day = today
+	}
+
+	when := start.Format("Mon 2006-01-02 15:04")
+	if meeting.AllDay {
+		when = start.Format("Mon 2006-01-02")
+	}
+	notes := []string{fmt.Sprintf("For %s on %s", meeting.Title, when)}
+	if answer.Notes != "" {
+		notes = append(notes, "", answer.Notes)
+	}
+	return &todo.Task{Title: answer.Title, Notes: strings.Join(notes, "\n"), Due: datetime.FormatDue(day), Status: "needsAction"}
+}
+
+// key identifies a meeting in the store; event IDs are only unique within
+// a calendar
+func (p *Prep) key(eventID string) string {
+	return p.settings.Calendar + "/" + eventID
+}
+
+// declined reports whether the user declined an event
+func declined(event *calendar.Event) bool {
+	for _, attendee := range event.Attendees {
+		if attendee.Self && attendee.ResponseStatus == "declined" {
+			return true
+		}
+	}
+	return false
+}
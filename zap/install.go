@@ -0,0 +1,233 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"zap/config"
+	"zap/llm"
+	"zap/service"
+)
+
+// serviceFlags are the flags that pick which installed service a daemon
+// subcommand is about
+type serviceFlags struct {
+	configPath  *string
+	profileName *string
+	system      *bool
+}
+
+func registerServiceFlags(flags *flag.FlagSet) *serviceFlags {
+	return &serviceFlags{
+		configPath:  flags.String("config", "", configFlagUsage),
+		profileName: flags.String("profile", "", "Config profile the service runs (each profile is its own service)"),
+		system:      flags.Bool("system", false, "Install for the whole machine, running as the current user, instead of per user (needs root)"),
+	}
+}
+
+// spec returns the service for the flags' profile, without what only
+// installing needs
+func (f *serviceFlags) spec() service.Spec {
+	name := "zap"
+	if *f.profileName != "" {
+		name += "-" + *f.profileName
+	}
+	return service.Spec{Name: name, System: *f.system}
+}
+
+// runDaemonService installs, removes or reports on the daemon as a
+// systemd or launchd service
+func runDaemonService(command string, args []string) {
+	manager, err := service.ForOS()
+	if err != nil {
+		log.Fatal(err)
+	}
+	switch command {
+	case "install":
+		runDaemonInstall(manager, args)
+	case "uninstall":
+		flags := flag.NewFlagSet("daemon uninstall", flag.ExitOnError)
+		opts := registerServiceFlags(flags)
+		flags.Parse(args)
+		path, err := service.Uninstall(manager, opts.spec())
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Stopped %s and removed %s\n", opts.spec().Name, path)
+	case "status":
+		flags := flag.NewFlagSet("daemon status", flag.ExitOnError)
+		opts := registerServiceFlags(flags)
+		flags.Parse(args)
+		spec := opts.spec()
+		path, err := manager.Path(spec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if _, err := os.Stat(path); err != nil {
+			fmt.Printf("%s isn't installed (no %s); install it with 'zap daemon install'\n", spec.Name, path)
+			os.Exit(1)
+		}
+		fmt.Printf("%s is installed at %s\n\n", spec.Name, path)
+		status, err := manager.Status(spec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Print(status)
+	}
+}
+
+// runDaemonInstall writes and starts a service running 'zap daemon' with
+// the given config, profile and interval. Flags after -- are passed on to
+// the daemon.
+func runDaemonInstall(manager service.Manager, args []string) {
+	flags := flag.NewFlagSet("daemon install", flag.ExitOnError)
+	opts := registerServiceFlags(flags)
+	interval := flags.Duration("interval", 30*time.Minute, "Time between runs")
+	var env listFlag
+	flags.Var(&env, "env", "Environment variable to give the service, as NAME (its current value) or NAME=value; repeatable")
+	dryRun := flags.Bool("dry-run", false, "Print the service definition instead of installing it")
+	flags.Parse(args)
+
+	cfg, configPath, dirs := loadConfig(flags, *opts.configPath)
+	profile, err := cfg.Profile(*opts.profileName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	program, err := os.Executable()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if resolved, err := filepath.EvalSymlinks(program); err == nil {
+		program = resolved
+	}
+	if strings.Contains(program, "go-build") {
+		log.Fatal("zap is running from a temporary 'go run' build; install it with 'go install' or 'go build' and run the installed binary")
+	}
+
+	spec := opts.spec()
+	spec.Program = program
+	spec.Description = "Zap! task prioritization"
+	if *opts.profileName != "" {
+		spec.Description += " (profile " + *opts.profileName + ")"
+	}
+	spec.Args = []string{"daemon", "--interval", interval.String()}
+	spec.Dir = dirs.Config
+	if _, err := os.Stat(configPath); err == nil {
+		if configPath, err = filepath.Abs(configPath); err != nil {
+			log.Fatal(err)
+		}
+		spec.Args = append(spec.Args, "--config", configPath)
+		spec.Dir = filepath.Dir(configPath)
+	}
+	if *opts.profileName != "" {
+		spec.Args = append(spec.Args, "--profile", *opts.profileName)
+	}
+	spec.Args = append(spec.Args, flags.Args()...)
+	spec.LogFile = filepath.Join(dirs.State, spec.Name+".log")
+	if spec.System {
+		current, err := user.Current()
+		if err != nil {
+			log.Fatal(err)
+		}
+		spec.User = current.Username
+	}
+
+	spec.Env, err = serviceEnv(profile, configPath, env)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *dryRun {
+		path, err := manager.Path(spec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintf(os.Stderr, "Would write %s:\n\n", path)
+		os.Stdout.Write(manager.Render(spec))
+		return
+	}
+	path, err := service.Install(manager, spec)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Installed %s at %s and started it with %s\n", spec.Name, path, manager.Name())
+	fmt.Printf("Check on it with 'zap daemon status', remove it with 'zap daemon uninstall'\n")
+}
+
+// serviceEnv returns the environment a service running profile needs: the
+// variables its config file refers to, its model providers' API keys and
+// its backend's credentials, as far as they are set now, and those asked
+// for with --env. Credentials that aren't set are warned about; variables
+// the config refers to can only be unset when it gives a default.
+func serviceEnv(profile *config.Profile, configPath string, extra []string) (map[string]string, error) {
+	env := make(map[string]string)
+	for _, e := range extra {
+		name, value, ok := strings.Cut(e, "=")
+		if !ok {
+			if value, ok = os.LookupEnv(name); !ok {
+				return nil, fmt.Errorf("--env %s: %s isn't set", name, name)
+			}
+		}
+		env[name] = value
+	}
+
+	references, _ := config.EnvReferences(configPath)
+	for _, name := range references {
+		if value, ok := os.LookupEnv(name); ok {
+			if _, given := env[name]; !given {
+				env[name] = value
+			}
+		}
+	}
+
+	var credentials []string
+	llms := append([]config.LLM{profile.LLM}, profile.LLM.Fallbacks...)
+	if profile.Experiment != nil && profile.Experiment.LLM != nil {
+		llms = append(llms, *profile.Experiment.LLM)
+	}
+	for _, cfg := range llms {
+		if name := llm.APIKeyEnv(cfg); name != "" {
+			credentials = append(credentials, name)
+		}
+	}
+	// As newProvider reads them
+	switch profile.Backend {
+	case config.BackendTrello:
+		if profile.Trello.Key == "" {
+			credentials = append(credentials, "TRELLO_API_KEY")
+		}
+		if profile.Trello.Token == "" {
+			credentials = append(credentials, "TRELLO_TOKEN")
+		}
+	case config.BackendAsana:
+		if profile.Asana.Token == "" {
+			credentials = append(credentials, "ASANA_TOKEN")
+		}
+	case config.BackendGitHub:
+		if profile.GitHub.Token == "" {
+			credentials = append(credentials, "GITHUB_TOKEN")
+		}
+	}
+	warned := make(map[string]bool)
+	for _, name := range credentials {
+		if _, given := env[name]; given || warned[name] {
+			continue
+		}
+		if value, ok := os.LookupEnv(name); ok {
+			env[name] = value
+		} else if path, ok := os.LookupEnv(name + "_FILE"); ok {
+			env[name+"_FILE"] = path
+		} else {
+			warned[name] = true
+			log.Printf("%s isn't set, so the service runs without it; set it and install again, or pass --env %s=value", name, name)
+		}
+	}
+	return env, nil
+}
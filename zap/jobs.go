@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"zap/jobs"
+	"zap/store"
+)
+
+// Kinds of jobs zap serve and zap daemon queue
+const (
+	// jobPrioritize ranks and reorders the job's lists, or every target list
+	jobPrioritize = "prioritize"
+	// jobSubtasks creates subtasks in the job's one list
+	jobSubtasks = "subtasks"
+)
+
+// jobWork returns the run a job asks for
+func (a *app) jobWork(job jobs.Job) func(ctx context.Context) error {
+	switch {
+	case job.Kind == jobSubtasks && len(job.Lists) == 1:
+		return func(ctx context.Context) error {
+			return a.breakDownList(ctx, job.Lists[0])
+		}
+	case job.Kind == jobSubtasks:
+		return func(ctx context.Context) error {
+			return fmt.Errorf("a subtasks job needs one list, not %d", len(job.Lists))
+		}
+	case job.Kind != jobPrioritize:
+		return func(ctx context.Context) error {
+			return fmt.Errorf("unknown kind of job %q", job.Kind)
+		}
+	case len(job.Lists) == 0:
+		return a.run
+	default:
+		return func(ctx context.Context) error {
+			return a.runLists(ctx, job.Lists)
+		}
+	}
+}
+
+// runJobs handles zap jobs
+func runJobs(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: zap jobs list [--tenant NAME] [-u USER]")
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "list":
+		runJobsList(args[1:])
+	default:
+		log.Fatalf("unknown jobs command %q (want list)", args[0])
+	}
+}
+
+// runJobsList prints the runs zap serve or zap daemon queued for a user,
+// newest first, from their state file. Failed jobs are retried through the
+// API or the dashboard, since the server running them owns the queue.
+func runJobsList(args []string) {
+	flags := flag.NewFlagSet("jobs list", flag.ExitOnError)
+	configPath := flags.String("config", "", configFlagUsage)
+	profileName := flags.String("profile", "", "Config profile whose state file holds the jobs")
+	tenantName := flags.String("tenant", "", "Tenant of the config whose user's jobs to list, instead of the profile's")
+	userEmail := flags.String("u", "", "User whose jobs to list, with --tenant (default: the tenant's user)")
+	limit := flags.Int("limit", 20, "Number of jobs to list, newest first (0: all)")
+	output := flags.String("output", outputText, "Output format: text or json")
+	flags.Parse(args)
+	if *output != outputText && *output != outputJSON {
+		log.Fatalf("unknown output format %q (want %s or %s)", *output, outputText, outputJSON)
+	}
+
+	cfg, _, _ := loadConfig(flags, *configPath)
+	var stateFile string
+	if *tenantName != "" {
+		tenant, ok := cfg.Tenants[*tenantName]
+		if !ok {
+			log.Fatalf("no tenant %s in the config", *tenantName)
+		}
+		user := strings.ToLower(*userEmail)
+		if user == "" {
+			user = strings.ToLower(tenant.User)
+		}
+		if user == "" || strings.ContainsAny(user, `/\`) {
+			log.Fatal("name the tenant's user whose jobs to list with -u")
+		}
+		stateFile = filepath.Join(tenant.StateDir, user+".json")
+	} else {
+		if *userEmail != "" {
+			log.Fatal("-u only picks a tenant's user; without --tenant the jobs are the profile's")
+		}
+		profile, err := cfg.Profile(*profileName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		stateFile = profile.StateFile
+	}
+
+	st, err := store.Open(stateFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	list, err := jobs.List(st)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *limit > 0 && len(list) > *limit {
+		list = list[:*limit]
+	}
+
+	if *output == outputJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if list == nil {
+			list = []jobs.Job{}
+		}
+		if err := encoder.Encode(list); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(list) == 0 {
+		fmt.Println("No jobs were queued yet.")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTATE\tATTEMPTS\tQUEUED\tTOOK\tTRIGGER\tERROR")
+	for _, job := range list {
+		took := "-"
+		if job.Done() {
+			took = job.Finished.Sub(job.Started).Round(time.Second).String()
+		}
+		state := job.State
+		if job.State == jobs.Queued && !job.RetryAt.IsZero() {
+			state += ", retry " + job.RetryAt.Local().Format("15:04:05")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\t%s\n", job.ID, state, job.Attempts, job.Enqueued.Local().Format("2006-01-02 15:04"), took, job.Trigger, job.Error)
+	}
+	w.Flush()
+}
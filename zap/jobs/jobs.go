@@ -0,0 +1,393 @@
+// Package jobs queues the runs zap serve and zap daemon are asked for. Each
+// user has a queue of their own, kept in their store, whose worker runs one
+// job at a time, so users' runs never overlap while different users' do.
+// Jobs that fail are tried again after a delay, and finished jobs stay in
+// the store as the history of what was run. Each job is a record of its
+// own in the store, written under the store's lock, so other processes
+// reading or changing the queue never undo each other's changes.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"zap/store"
+)
+
+// States of a job
+const (
+	Queued    = "queued"
+	Running   = "running"
+	Succeeded = "succeeded"
+	Failed    = "failed"
+)
+
+const (
+	// bucket holds the jobs, by ID
+	bucket = "jobs"
+	// kept caps the finished jobs kept in the history
+	kept = 100
+)
+
+var (
+	// ErrNotFound is returned for a job that isn't in the queue's history
+	ErrNotFound = errors.New("no such job")
+	// ErrNotFailed is returned when retrying a job that didn't fail for good
+	ErrNotFailed = errors.New("only failed jobs can be retried")
+)
+
+// Job is a run the queue was asked for
+type Job struct {
+	ID string `json:"id"`
+	// Trigger says what asked for the run, e.g. "API: prioritize"
+	Trigger string `json:"trigger"`
+	// Kind and Lists say what the run does, for the queue's Runner
+	Kind  string   `json:"kind"`
+	Lists []string `json:"lists,omitempty"`
+	State string   `json:"state"`
+	// Attempts counts the times the job was started
+	Attempts int       `json:"attempts"`
+	Enqueued time.Time `json:"enqueued"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	// RetryAt is when a failed attempt is tried again
+	RetryAt time.Time `json:"retryAt"`
+	// Error is why the last attempt failed
+	Error string `json:"error,omitempty"`
+	// Result is what the last attempt returned, as JSON
+	Result json.RawMessage `json:"result,omitempty"`
+}
+
+// Done reports whether the job succeeded or failed for good
+func (j Job) Done() bool {
+	return j.State == Succeeded || j.State == Failed
+}
+
+// Runner does a job's work, returning a result to keep with it
+type Runner func(ctx context.Context, job Job) (any, error)
+
+// Queue runs one user's jobs, one at a time, in the order they were
+// enqueued
+type Queue struct {
+	store *store.Store
+	run   Runner
+	now   func() time.Time
+
+	// MaxAttempts is how often a job is started before it fails for good
+	MaxAttempts int
+	// RetryDelay is the wait before a job's second attempt, doubling for
+	// each attempt after it
+	RetryDelay time.Duration
+	// Finished, when set, is called once a job succeeded or failed for good
+	Finished func(job Job)
+
+	// mu keeps enqueueing and retrying from racing
+	mu sync.Mutex
+	// wake tells the worker there may be a job to run
+	wake chan struct{}
+	// changed is closed, and replaced, whenever a job changes
+	changedMu sync.Mutex
+	changed   chan struct{}
+}
+
+// New creates a queue keeping its jobs in st, whose worker runs them with
+// run once started
+func New(st *store.Store, run Runner) *Queue {
+	return &Queue{
+		store:       st,
+		run:         run,
+		now:         time.Now,
+		MaxAttempts: 3,
+		RetryDelay:  time.Minute,
+		wake:        make(chan struct{}, 1),
+		changed:     make(chan struct{}),
+	}
+}
+
+// Start runs the queue's jobs in the background until ctx is done. Jobs
+// that were queued or running when the last process stopped are run again.
+func (q *Queue) Start(ctx context.Context) error {
+	jobs, err := q.List()
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		if job.State == Running {
+			job.State = Queued
+			if err := q.save(job); err != nil {
+				return err
+			}
+		}
+	}
+	go q.work(ctx)
+	return nil
+}
+
+// Enqueue adds a job to the end of the queue. A job of the same kind and
+// lists that is still waiting to start is returned instead of a new one.
+func (q *Queue) Enqueue(trigger, kind string, lists []string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs, err := q.List()
+	if err != nil {
+		return Job{}, err
+	}
+	for _, job := range jobs {
+		if job.State == Queued && job.Attempts == 0 && job.Kind == kind && slices.Equal(job.Lists, lists) {
+			return job, nil
+		}
+	}
+	job := Job{ID: newID(), Trigger: trigger, Kind: kind, Lists: lists, State: Queued, Enqueued: q.now()}
+	if err := q.save(job); err != nil {
+		return Job{}, err
+	}
+	return job, nil
+}
+
+// Retry queues a job that failed for good again, with all its attempts
+func (q *Queue) Retry(id string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var job Job
+	err := q.store.Update(bucket, id, &job, func(found bool) (bool, error) {
+		if !found {
+			return false, ErrNotFound
+		}
+		if job.State != Failed {
+			return false, fmt.Errorf("job %s is %s: %w", id, job.State, ErrNotFailed)
+		}
+		job.State = Queued
+		job.Attempts = 0
+		job.Finished = time.Time{}
+		return true, nil
+	})
+	if err != nil {
+		return Job{}, err
+	}
+	q.notify()
+	return job, nil
+}
+
+// Get returns a job of the queue's history
+func (q *Queue) Get(id string) (Job, error) {
+	var job Job
+	ok, err := q.store.Get(bucket, id, &job)
+	if err != nil {
+		return Job{}, err
+	}
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	return job, nil
+}
+
+// List returns the jobs of the queue's history, newest first
+func (q *Queue) List() ([]Job, error) {
+	return List(q.store)
+}
+
+// List returns the jobs kept in st, newest first, e.g. for a process other
+// than the one running them
+func List(st *store.Store) ([]Job, error) {
+	var jobs []Job
+	for _, id := range st.Keys(bucket) {
+		var job Job
+		if _, err := st.Get(bucket, id, &job); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Enqueued.After(jobs[j].Enqueued) })
+	return jobs, nil
+}
+
+// Pending reports whether a job is queued or running
+func (q *Queue) Pending() bool {
+	jobs, err := q.List()
+	if err != nil {
+		return false
+	}
+	for _, job := range jobs {
+		if !job.Done() {
+			return true
+		}
+	}
+	return false
+}
+
+// Wait returns the job once it succeeded or failed for good, or ctx's error
+// when it is done first
+func (q *Queue) Wait(ctx context.Context, id string) (Job, error) {
+	for {
+		q.changedMu.Lock()
+		changed := q.changed
+		q.changedMu.Unlock()
+		job, err := q.Get(id)
+		if err != nil || job.Done() {
+			return job, err
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return job, ctx.Err()
+		}
+	}
+}
+
+// work runs the jobs that are due until ctx is done
+func (q *Queue) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		job, wait, err := q.next()
+		if err != nil {
+			log.Printf("Unable to read the job queue: %v", err)
+			wait = q.RetryDelay
+		}
+		if err == nil && wait == 0 {
+			q.runJob(ctx, job)
+			continue
+		}
+
+		var due <-chan time.Time
+		var timer *time.Timer
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			due = timer.C
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-due:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// next returns the oldest job that is due, or else how long until the next
+// retry is; -1 means there is nothing to wait for
+func (q *Queue) next() (Job, time.Duration, error) {
+	jobs, err := q.List()
+	if err != nil {
+		return Job{}, 0, err
+	}
+	now := q.now()
+	wait := time.Duration(-1)
+	for i := len(jobs) - 1; i >= 0; i-- {
+		job := jobs[i]
+		if job.State != Queued {
+			continue
+		}
+		if !job.RetryAt.After(now) {
+			return job, 0, nil
+		}
+		if until := job.RetryAt.Sub(now); wait < 0 || until < wait {
+			wait = until
+		}
+	}
+	return Job{}, wait, nil
+}
+
+// runJob makes an attempt at a job and records how it went
+func (q *Queue) runJob(ctx context.Context, job Job) {
+	job.State = Running
+	job.Attempts++
+	job.RetryAt = time.Time{}
+	if job.Started.IsZero() {
+		job.Started = q.now()
+	}
+	if err := q.save(job); err != nil {
+		log.Printf("Unable to start job %s: %v", job.ID, err)
+		return
+	}
+
+	result, err := q.run(ctx, job)
+	if ctx.Err() != nil {
+		// Stopping isn't the job's fault; it runs again on the next start
+		job.State = Queued
+		job.Attempts--
+		q.save(job)
+		return
+	}
+	if result != nil {
+		job.Result, _ = json.Marshal(result)
+	}
+	switch {
+	case err == nil:
+		job.State = Succeeded
+		job.Error = ""
+		job.Finished = q.now()
+	case job.Attempts < q.MaxAttempts:
+		job.State = Queued
+		job.Error = err.Error()
+		job.RetryAt = q.now().Add(q.RetryDelay << (job.Attempts - 1))
+	default:
+		job.State = Failed
+		job.Error = err.Error()
+		job.Finished = q.now()
+	}
+	if err := q.save(job); err != nil {
+		log.Printf("Unable to record job %s: %v", job.ID, err)
+	}
+	if job.Done() {
+		q.prune()
+		if q.Finished != nil {
+			q.Finished(job)
+		}
+	}
+}
+
+// prune drops the oldest finished jobs beyond the ones kept
+func (q *Queue) prune() {
+	jobs, err := q.List()
+	if err != nil {
+		return
+	}
+	finished := 0
+	for _, job := range jobs {
+		if !job.Done() {
+			continue
+		}
+		if finished++; finished > kept {
+			q.store.Delete(bucket, job.ID)
+		}
+	}
+}
+
+// save stores a job and tells waiters it changed
+func (q *Queue) save(job Job) error {
+	if err := q.store.Put(bucket, job.ID, job); err != nil {
+		return err
+	}
+	q.notify()
+	return nil
+}
+
+// notify wakes the worker and waiters
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	q.changedMu.Lock()
+	close(q.changed)
+	q.changed = make(chan struct{})
+	q.changedMu.Unlock()
+}
+
+// newID returns a random ID for a job
+func newID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,83 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"zap/store"
+)
+
+// openQueue opens a queue on the state file at path, as another process
+// sharing it would
+func openQueue(t *testing.T, path string) *Queue {
+	t.Helper()
+	st, err := store.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(st, func(ctx context.Context, job Job) (any, error) { return nil, nil })
+}
+
+func TestQueuesSharingAStateFileKeepEachOthersJobs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	server := openQueue(t, path)
+	cli := openQueue(t, path)
+
+	first, err := server.Enqueue("API: prioritize", "prioritize", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := cli.Enqueue("daemon", "subtasks", []string{"Inbox"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The server writes again after the other process did
+	if _, err := server.Enqueue("API: subtasks", "subtasks", []string{"Backlog"}); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := List(openQueue(t, path).store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make(map[string]bool)
+	for _, job := range jobs {
+		ids[job.ID] = true
+	}
+	if len(jobs) != 3 || !ids[first.ID] || !ids[second.ID] {
+		t.Fatalf("got %d jobs %v, want all 3 including %s and %s", len(jobs), ids, first.ID, second.ID)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	q := openQueue(t, path)
+	job, err := q.Enqueue("API: prioritize", "prioritize", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Retry(job.ID); !errors.Is(err, ErrNotFailed) {
+		t.Fatalf("retrying a queued job: got %v, want ErrNotFailed", err)
+	}
+	if _, err := q.Retry("missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("retrying a missing job: got %v, want ErrNotFound", err)
+	}
+
+	job.State = Failed
+	job.Attempts = 3
+	if err := q.save(job); err != nil {
+		t.Fatal(err)
+	}
+	retried, err := openQueue(t, path).Retry(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retried.State != Queued || retried.Attempts != 0 {
+		t.Fatalf("retried job is %s after %d attempts, want queued after none", retried.State, retried.Attempts)
+	}
+	if got, err := q.Get(job.ID); err != nil || got.State != Queued {
+		t.Fatalf("the queue sees the job as %s (err %v), want queued", got.State, err)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"zap/tags"
+	"zap/tasks"
+	"zap/todo"
+)
+
+// runList prints open tasks, optionally filtered by list and tags
+func runList(args []string) {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	runOpts := registerRunFlags(flags)
+	listTitle := flags.String("list", "", "Only show this task list (default: every list)")
+	var tagFilter listFlag
+	flags.Var(&tagFilter, "tag", "Only show tasks with this tag (repeatable; all must match)")
+	flags.Parse(args)
+
+	ctx := context.Background()
+	app, err := runOpts.newApp(ctx, flags)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer app.Close()
+
+	var taskLists []*todo.TaskList
+	if *listTitle != "" {
+		taskList, err := app.service.GetTaskListByTitle(*listTitle)
+		if err != nil {
+			log.Fatal(err)
+		}
+		taskLists = []*todo.TaskList{taskList}
+	} else if taskLists, err = app.service.ListTaskLists(); err != nil {
+		log.Fatal(err)
+	}
+
+	for _, taskList := range taskLists {
+		listTasks, err := app.service.ListTasks(taskList.ID)
+		if err != nil {
+			log.Printf("Error fetching tasks for list %s: %v", taskList.Title, err)
+			continue
+		}
+
+		var lines []string
+		tasks.NewTaskTree(listTasks).Walk(func(node *tasks.TaskNode) bool {
+			if tags.HasAll(node.Task, tagFilter) {
+				lines = append(lines, formatTaskLine(node))
+			}
+			return true
+		})
+		if len(lines) == 0 {
+			continue
+		}
+		fmt.Printf("%s\n", taskList.Title)
+		for _, line := range lines {
+			fmt.Println(line)
+		}
+	}
+}
+
+// formatTaskLine renders a task indented by depth with its due date and tags
+func formatTaskLine(node *tasks.TaskNode) string {
+	var b strings.Builder
+	b.WriteString(strings.Repeat("  ", node.Depth()+1))
+	b.WriteString("- ")
+	b.WriteString(node.Task.Title)
+	if len(node.Task.Due) >= 10 {
+		fmt.Fprintf(&b, " (due %s)", node.Task.Due[:10])
+	}
+	if found := tags.Of(node.Task); len(found) > 0 {
+		fmt.Fprintf(&b, " [#%s]", strings.Join(found, " #"))
+	}
+	return b.String()
+}
+
+// runTag adds or removes tags on a task
+func runTag(args []string) {
+	flags := flag.NewFlagSet("tag", flag.ExitOnError)
+	runOpts := registerRunFlags(flags)
+	listTitle := flags.String("list", "", "Task list containing the task")
+
+	positional := parseInterspersed(flags, args)
+	if len(positional) < 3 || (positional[0] != "add" && positional[0] != "remove") {
+		log.Fatal("usage: zap tag add|remove <task title or ID> <tag>... --list <list>")
+	}
+	if *listTitle == "" {
+		log.Fatal("--list is required")
+	}
+
+	ctx := context.Background()
+	app, err := runOpts.newApp(ctx, flags)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer app.Close()
+
+	taskList, err := app.service.GetTaskListByTitle(*listTitle)
+	if err != nil {
+		log.Fatal(err)
+	}
+	task, err := app.service.FindTask(taskList.ID, positional[1])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	before := *task
+	updated := *task
+	changed := false
+	for _, tag := range positional[2:] {
+		if positional[0] == "add" {
+			changed = tags.Add(&updated, tag) || changed
+		} else {
+			changed = tags.Remove(&updated, tag) || changed
+		}
+	}
+	if !changed {
+		fmt.Printf("'%s' already has tags %v\n", task.Title, tags.Of(task))
+		return
+	}
+
+	_, err = app.orchestrator.Apply(ctx, []tasks.Mutation{{
+		Kind:       tasks.MutationUpdate,
+		TaskListID: taskList.ID,
+		Task:       &updated,
+		Before:     &before,
+		Summary:    fmt.Sprintf("tag '%s' with %v", updated.Title, tags.Of(&updated)),
+	}})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("'%s' now has tags %v\n", updated.Title, tags.Of(&updated))
+}
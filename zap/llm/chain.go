@@ -0,0 +1,82 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// chainLink is one provider in a Chain with its per-request timeout
+type chainLink struct {
+	provider Provider
+	timeout  time.Duration
+}
+
+// Chain tries providers in order until one answers. A provider that errors
+// or exceeds its timeout hands the request to the next one.
+type Chain struct {
+	links []chainLink
+}
+
+// Name lists the providers in order, e.g. "gemini/x -> claude/y"
+func (c *Chain) Name() string {
+	names := make([]string, len(c.links))
+	for i, link := range c.links {
+		names[i] = link.provider.Name()
+	}
+	return strings.Join(names, " -> ")
+}
+
+// CountTokens counts with the first provider, which every request goes to
+// first
+func (c *Chain) CountTokens(ctx context.Context, req Request) (TokenCount, error) {
+	return c.links[0].provider.CountTokens(ctx, req)
+}
+
+// Generate returns the first successful answer, with Provider set to the
+// provider that gave it. Usage includes failed attempts.
+func (c *Chain) Generate(ctx context.Context, req Request) (Response, error) {
+	var usage Usage
+	var errs []error
+	for i, link := range c.links {
+		attemptCtx := ctx
+		cancel := func() {}
+		if link.timeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, link.timeout)
+		}
+		resp, err := link.provider.Generate(attemptCtx, req)
+		cancel()
+
+		usage.Add(resp.Usage)
+		if err == nil {
+			resp.Usage = usage
+			if resp.Provider == "" {
+				resp.Provider = link.provider.Name()
+			}
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			return Response{Usage: usage}, ctx.Err()
+		}
+
+		errs = append(errs, fmt.Errorf("%s: %v", link.provider.Name(), err))
+		if i < len(c.links)-1 {
+			log.Printf("%s failed, falling back to %s: %v", link.provider.Name(), c.links[i+1].provider.Name(), err)
+		}
+	}
+	return Response{Usage: usage}, errors.Join(errs...)
+}
+
+// Close closes every provider in the chain
+func (c *Chain) Close() error {
+	var errs []error
+	for _, link := range c.links {
+		if err := link.provider.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,225 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// claudeURL is the Anthropic Messages API endpoint
+	claudeURL = "https://api.anthropic.com/v1/messages"
+	// claudeCountURL counts the tokens of a Messages API request
+	claudeCountURL = "https://api.anthropic.com/v1/messages/count_tokens"
+	// claudeAPIVersion is the API version zap was written against
+	claudeAPIVersion = "2023-06-01"
+	// defaultClaudeMaxTokens bounds the response; the API requires a limit
+	defaultClaudeMaxTokens = 4096
+)
+
+// claudeJSONSystem is sent as the system prompt for JSON requests. Claude
+// follows system instructions more strictly than instructions at the end
+// of a long user message.
+const claudeJSONSystem = "You are a precise assistant for a task manager. Respond with a single valid JSON value and nothing else: no prose, no explanations, no markdown code fences."
+
+// Claude calls Anthropic's Messages API
+type Claude struct {
+	apiKey    string
+	model     string
+	maxTokens int
+	url       string
+	countURL  string
+	client    *http.Client
+}
+
+// NewClaude creates a Claude provider. maxTokens <= 0 uses a default.
+func NewClaude(apiKey string, model string, maxTokens int) *Claude {
+	if maxTokens <= 0 {
+		maxTokens = defaultClaudeMaxTokens
+	}
+	return &Claude{
+		apiKey:    apiKey,
+		model:     model,
+		maxTokens: maxTokens,
+		url:       claudeURL,
+		countURL:  claudeCountURL,
+		client:    &http.Client{Timeout: 2 * time.Minute},
+	}
+}
+
+// Name returns "claude/<model>"
+func (c *Claude) Name() string {
+	return ProviderClaude + "/" + c.model
+}
+
+type claudeMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type claudeRequest struct {
+	Model       string          `json:"model"`
+	MaxTokens   int             `json:"max_tokens"`
+	System      string          `json:"system,omitempty"`
+	Messages    []claudeMessage `json:"messages"`
+	Temperature float64         `json:"temperature"`
+}
+
+type claudeResponse struct {
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	StopReason string `json:"stop_reason"`
+	Usage      struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Generate sends the earlier turns and the prompt as messages and the
+// request's instructions as the system prompt. JSON requests have it
+// demand bare JSON as well.
+func (c *Claude) Generate(ctx context.Context, req Request) (Response, error) {
+	body := claudeRequest{
+		Model:       c.model,
+		MaxTokens:   c.maxTokens,
+		Messages:    claudeMessages(req),
+		System:      claudeSystem(req),
+		Temperature: 0.1,
+	}
+	if req.Seed != 0 {
+		// The Messages API has no seed; greedy sampling is the closest
+		body.Temperature = 0
+	}
+
+	httpResp, data, err := c.post(ctx, c.url, body)
+	if err != nil {
+		return Response{}, err
+	}
+	var resp claudeResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return Response{}, fmt.Errorf("failed to parse Claude response (%s): %v", httpResp.Status, err)
+	}
+	if resp.Error != nil {
+		return Response{}, fmt.Errorf("Claude returned %s: %s: %s", httpResp.Status, resp.Error.Type, resp.Error.Message)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return Response{}, fmt.Errorf("Claude returned %s", httpResp.Status)
+	}
+
+	usage := Usage{InputTokens: resp.Usage.InputTokens, OutputTokens: resp.Usage.OutputTokens}
+	var text strings.Builder
+	for _, block := range resp.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	if text.Len() == 0 {
+		return Response{Usage: usage}, fmt.Errorf("no response from Claude")
+	}
+	if resp.StopReason == "max_tokens" {
+		return Response{Usage: usage}, fmt.Errorf("Claude response was cut off at %d tokens; raise llm.max_tokens", c.maxTokens)
+	}
+	return Response{Text: strings.TrimSpace(text.String()), Usage: usage}, nil
+}
+
+type claudeCountRequest struct {
+	Model    string          `json:"model"`
+	System   string          `json:"system,omitempty"`
+	Messages []claudeMessage `json:"messages"`
+}
+
+type claudeCountResponse struct {
+	InputTokens int `json:"input_tokens"`
+	Error       *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// CountTokens counts the tokens of the messages and system prompt Generate
+// would send. Every current Claude model takes 200k tokens, including the
+// response's max_tokens.
+func (c *Claude) CountTokens(ctx context.Context, req Request) (TokenCount, error) {
+	body := claudeCountRequest{Model: c.model, System: claudeSystem(req), Messages: claudeMessages(req)}
+	httpResp, data, err := c.post(ctx, c.countURL, body)
+	if err != nil {
+		return TokenCount{}, err
+	}
+	var resp claudeCountResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return TokenCount{}, fmt.Errorf("failed to parse Claude token count (%s): %v", httpResp.Status, err)
+	}
+	if resp.Error != nil {
+		return TokenCount{}, fmt.Errorf("Claude returned %s: %s: %s", httpResp.Status, resp.Error.Type, resp.Error.Message)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return TokenCount{}, fmt.Errorf("Claude returned %s", httpResp.Status)
+	}
+	count := TokenCount{Tokens: resp.InputTokens}
+	if window := knownContextWindow(c.model); window > 0 {
+		count.Window = window - c.maxTokens
+	}
+	return count, nil
+}
+
+// claudeMessages returns the earlier turns and the prompt as messages
+func claudeMessages(req Request) []claudeMessage {
+	var messages []claudeMessage
+	for _, turn := range req.History {
+		messages = append(messages, claudeMessage{Role: "user", Content: turn.Prompt}, claudeMessage{Role: "assistant", Content: turn.Answer})
+	}
+	return append(messages, claudeMessage{Role: "user", Content: req.Prompt})
+}
+
+// claudeSystem returns the request's system prompt, which demands bare
+// JSON for JSON requests
+func claudeSystem(req Request) string {
+	if req.JSON {
+		return joinSystem(req.System, claudeJSONSystem)
+	}
+	return req.System
+}
+
+// post sends body as JSON to url and returns the response with its body
+// read
+func (c *Claude) post(ctx context.Context, url string, body interface{}) (*http.Response, []byte, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode Claude request: %v", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create Claude request: %v", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-api-key", c.apiKey)
+	httpReq.Header.Set("anthropic-version", claudeAPIVersion)
+
+	httpResp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to call Claude: %v", err)
+	}
+	defer httpResp.Body.Close()
+
+	data, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read Claude response: %v", err)
+	}
+	return httpResp, data, nil
+}
+
+// Close is a no-op; the HTTP client needs no cleanup
+func (c *Claude) Close() error {
+	return nil
+}
@@ -0,0 +1,159 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/option"
+)
+
+// Gemini calls Google's Generative Language API with an API key
+type Gemini struct {
+	client    *genai.Client
+	model     *genai.GenerativeModel
+	modelName string
+
+	mu sync.Mutex
+	// window is the model's input token limit once it was looked up
+	window int
+}
+
+// NewGemini creates a Gemini provider for the given model
+func NewGemini(ctx context.Context, apiKey string, modelName string) (*Gemini, error) {
+	opts := []option.ClientOption{option.WithAPIKey(apiKey)}
+	if transport := contextTransport(ctx); transport != nil {
+		// A client of our own replaces the library's, which would have
+		// added the key
+		opts = []option.ClientOption{option.WithHTTPClient(&http.Client{Transport: &keyTransport{key: apiKey, base: transport}})}
+	}
+	client, err := genai.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Gemini client: %v", err)
+	}
+
+	model := client.GenerativeModel(modelName)
+
+	// Set response constraints
+	model.SetTemperature(0.1) // Lower temperature for more consistent output
+	model.SafetySettings = []*genai.SafetySetting{
+		{
+			Category:  genai.HarmCategoryDangerousContent,
+			Threshold: genai.HarmBlockNone,
+		},
+	}
+
+	return &Gemini{client: client, model: model, modelName: modelName}, nil
+}
+
+// keyTransport adds the API key to Gemini requests
+type keyTransport struct {
+	key  string
+	base http.RoundTripper
+}
+
+func (t *keyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("x-goog-api-key", t.key)
+	return t.base.RoundTrip(req)
+}
+
+// Name returns "gemini/<model>"
+func (g *Gemini) Name() string {
+	return ProviderGemini + "/" + g.modelName
+}
+
+// Generate sends the prompt with the request's instructions as the system
+// instruction, in a chat session holding the earlier turns if there are
+// any, and joins the text parts of the first candidate
+func (g *Gemini) Generate(ctx context.Context, req Request) (Response, error) {
+	model := g.modelFor(req)
+	var resp *genai.GenerateContentResponse
+	var err error
+	if len(req.History) == 0 {
+		resp, err = model.GenerateContent(ctx, genai.Text(req.Prompt))
+	} else {
+		chat := model.StartChat()
+		for _, turn := range req.History {
+			chat.History = append(chat.History,
+				&genai.Content{Role: "user", Parts: []genai.Part{genai.Text(turn.Prompt)}},
+				&genai.Content{Role: "model", Parts: []genai.Part{genai.Text(turn.Answer)}})
+		}
+		resp, err = chat.SendMessage(ctx, genai.Text(req.Prompt))
+	}
+	if err != nil {
+		return Response{}, fmt.Errorf("failed to generate content: %v", err)
+	}
+
+	var usage Usage
+	if resp.UsageMetadata != nil {
+		usage.InputTokens = int(resp.UsageMetadata.PromptTokenCount)
+		usage.OutputTokens = int(resp.UsageMetadata.CandidatesTokenCount)
+	}
+
+	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil || len(resp.Candidates[0].Content.Parts) == 0 {
+		return Response{Usage: usage}, fmt.Errorf("no response from Gemini")
+	}
+
+	var text strings.Builder
+	for _, part := range resp.Candidates[0].Content.Parts {
+		if t, ok := part.(genai.Text); ok {
+			text.WriteString(string(t))
+		}
+	}
+	return Response{Text: strings.TrimSpace(text.String()), Usage: usage}, nil
+}
+
+// modelFor returns the model with the request's instructions as its system
+// instruction. The model is shared between requests, so the instruction
+// goes on a copy of it.
+func (g *Gemini) modelFor(req Request) *genai.GenerativeModel {
+	model := *g.model
+	if req.System != "" {
+		model.SystemInstruction = genai.NewUserContent(genai.Text(req.System))
+	}
+	return &model
+}
+
+// CountTokens calls countTokens with the request's instructions, earlier
+// turns and prompt. The model's input token limit is looked up once.
+func (g *Gemini) CountTokens(ctx context.Context, req Request) (TokenCount, error) {
+	var parts []genai.Part
+	for _, turn := range req.History {
+		parts = append(parts, genai.Text(turn.Prompt), genai.Text(turn.Answer))
+	}
+	resp, err := g.modelFor(req).CountTokens(ctx, append(parts, genai.Text(req.Prompt))...)
+	if err != nil {
+		return TokenCount{}, fmt.Errorf("failed to count tokens: %v", err)
+	}
+	return TokenCount{Tokens: int(resp.TotalTokens), Window: g.contextWindow(ctx)}, nil
+}
+
+// contextWindow returns the model's input token limit, from the API or
+// else from the known windows
+func (g *Gemini) contextWindow(ctx context.Context) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.window > 0 {
+		return g.window
+	}
+	info, err := g.model.Info(ctx)
+	if err != nil {
+		log.Printf("Unable to look up the context window of %s: %v", g.modelName, err)
+		return knownContextWindow(g.modelName)
+	}
+	g.window = int(info.InputTokenLimit)
+	return g.window
+}
+
+// Close releases the client
+func (g *Gemini) Close() error {
+	if g.client != nil {
+		return g.client.Close()
+	}
+	return nil
+}
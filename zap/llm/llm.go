@@ -0,0 +1,319 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"golang.org/x/oauth2"
+
+	"zap/config"
+)
+
+// ErrNoAPIKey is returned by New when the provider's API key isn't set
+var ErrNoAPIKey = errors.New("LLM API key is not set")
+
+// ErrNoTokenCount is returned by CountTokens of providers that have no way
+// to count tokens before sending a request
+var ErrNoTokenCount = errors.New("provider can't count tokens")
+
+// Request is a prompt sent to a model, optionally as the next message of
+// a conversation
+type Request struct {
+	// System holds the instructions, sent as the system instruction; Prompt
+	// holds the data they apply to
+	System string
+	Prompt string
+	// History holds the earlier turns of the conversation, oldest first;
+	// providers without chat support fold them into the prompt
+	History []Turn
+	// JSON asks for a bare JSON response; providers adjust the request to
+	// make that more likely, but callers still parse defensively
+	JSON bool
+	// Seed, when non-zero, asks providers that support seeded sampling to
+	// sample deterministically; the others ignore it
+	Seed int64
+}
+
+// Turn is one exchange of a conversation: what was asked and the model's
+// answer
+type Turn struct {
+	Prompt string
+	Answer string
+}
+
+// Transcript returns the prompt with the earlier turns written out before
+// it, for providers that only take a single prompt
+func (r Request) Transcript() string {
+	if len(r.History) == 0 {
+		return r.Prompt
+	}
+	var b strings.Builder
+	b.WriteString("This continues an earlier conversation.\n")
+	for _, turn := range r.History {
+		fmt.Fprintf(&b, "\n--- You were asked ---\n%s\n\n--- You answered ---\n%s\n", turn.Prompt, turn.Answer)
+	}
+	fmt.Fprintf(&b, "\n--- Now ---\n%s", r.Prompt)
+	return b.String()
+}
+
+// joinSystem adds a provider's own instruction after the request's
+func joinSystem(system, own string) string {
+	if system == "" {
+		return own
+	}
+	return system + "\n\n" + own
+}
+
+// Usage counts the tokens a request consumed
+type Usage struct {
+	InputTokens  int
+	OutputTokens int
+}
+
+// Add accumulates another request's usage
+func (u *Usage) Add(other Usage) {
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+}
+
+// TokenCount is how many input tokens a request would use, as the provider
+// counts them without sending it
+type TokenCount struct {
+	Tokens int
+	// Window is the most input tokens the model takes; zero when unknown
+	Window int
+}
+
+// Response is a model's text answer
+type Response struct {
+	Text  string
+	Usage Usage
+	// Provider names the provider that answered when it differs from the
+	// one called, as with a Chain
+	Provider string
+}
+
+// Provider is a model zap can prompt. The gemini package builds the prompts
+// and parses the answers; providers only move text.
+type Provider interface {
+	// Name identifies the provider and model, e.g. "claude/claude-3-7-sonnet-latest"
+	Name() string
+	Generate(ctx context.Context, req Request) (Response, error)
+	// CountTokens counts the input tokens of req with the provider's
+	// token-count endpoint, or returns ErrNoTokenCount
+	CountTokens(ctx context.Context, req Request) (TokenCount, error)
+	Close() error
+}
+
+// Provider names accepted in config
+const (
+	ProviderGemini = "gemini"
+	ProviderClaude = "claude"
+	ProviderOllama = "ollama"
+	ProviderVertex = "vertex"
+	// ProviderHeuristic ends a fallback chain: callers rank without an LLM
+	ProviderHeuristic = "heuristic"
+)
+
+// defaults holds the model and API key variable used when config omits them
+var defaults = map[string]struct {
+	model     string
+	apiKeyEnv string
+}{
+	ProviderGemini: {model: "gemini-2.0-flash-thinking-exp-01-21", apiKeyEnv: "GEMINI_API_KEY"},
+	ProviderClaude: {model: "claude-3-7-sonnet-latest", apiKeyEnv: "ANTHROPIC_API_KEY"},
+	// Local models need no key
+	ProviderOllama: {model: "llama3.1"},
+	// Vertex AI authenticates with service-account or default credentials
+	ProviderVertex: {model: "gemini-2.0-flash-001"},
+}
+
+// APIKeyEnv returns the environment variable holding the API key for cfg
+func APIKeyEnv(cfg config.LLM) string {
+	if cfg.APIKeyEnv != "" {
+		return cfg.APIKeyEnv
+	}
+	return defaults[providerName(cfg)].apiKeyEnv
+}
+
+// Check reports a provider in cfg or its fallbacks that zap doesn't know
+func Check(cfg config.LLM) error {
+	for _, c := range append([]config.LLM{cfg}, cfg.Fallbacks...) {
+		name := providerName(c)
+		if _, ok := defaults[name]; !ok && name != ProviderHeuristic {
+			return fmt.Errorf("unknown LLM provider %q (want %s, %s, %s, %s or %s)", name, ProviderGemini, ProviderClaude, ProviderOllama, ProviderVertex, ProviderHeuristic)
+		}
+	}
+	return nil
+}
+
+// New creates the provider selected by cfg, wrapped in a Chain when cfg has
+// fallbacks or a timeout. Fallback providers whose API key isn't set are
+// skipped. It returns ErrNoAPIKey when no provider is usable, so callers
+// can run without an LLM.
+func New(ctx context.Context, cfg config.LLM) (Provider, error) {
+	configs := append([]config.LLM{cfg}, cfg.Fallbacks...)
+	var links []chainLink
+	for i, c := range configs {
+		if providerName(c) == ProviderHeuristic {
+			// The heuristic is what callers fall back to without an LLM
+			break
+		}
+		provider, err := newProvider(ctx, c)
+		if errors.Is(err, ErrNoAPIKey) && len(configs) > 1 {
+			log.Printf("Skipping LLM provider %d (%s): %v", i+1, providerName(c), err)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, chainLink{provider: provider, timeout: c.Timeout})
+	}
+
+	switch {
+	case len(links) == 0:
+		return nil, fmt.Errorf("%w: no usable provider configured", ErrNoAPIKey)
+	case len(links) == 1 && links[0].timeout == 0:
+		return links[0].provider, nil
+	default:
+		return &Chain{links: links}, nil
+	}
+}
+
+// newProvider creates a single provider, with the context window set in
+// cfg if there is one
+func newProvider(ctx context.Context, cfg config.LLM) (Provider, error) {
+	provider, err := newModel(ctx, cfg)
+	if err != nil || cfg.ContextWindow <= 0 {
+		return provider, err
+	}
+	return &windowOverride{Provider: provider, window: cfg.ContextWindow}, nil
+}
+
+// newModel creates the provider of a single model
+func newModel(ctx context.Context, cfg config.LLM) (Provider, error) {
+	name := providerName(cfg)
+	def, ok := defaults[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown LLM provider %q", name)
+	}
+	model := cfg.Model
+	if model == "" {
+		model = def.model
+	}
+
+	switch name {
+	case ProviderOllama:
+		return NewOllama(cfg.BaseURL, model), nil
+	case ProviderVertex:
+		return NewVertex(ctx, cfg.Project, cfg.Location, model, cfg.Credentials)
+	}
+
+	keyEnv := APIKeyEnv(cfg)
+	apiKey := config.Getenv(keyEnv)
+	if apiKey == "" {
+		return nil, fmt.Errorf("%w: set %s", ErrNoAPIKey, keyEnv)
+	}
+
+	switch name {
+	case ProviderClaude:
+		claude := NewClaude(apiKey, model, cfg.MaxTokens)
+		if transport := contextTransport(ctx); transport != nil {
+			claude.client.Transport = transport
+		}
+		return claude, nil
+	default:
+		return NewGemini(ctx, apiKey, model)
+	}
+}
+
+// contextTransport returns the transport of the HTTP client ctx carries for
+// oauth2, or nil. Vertex AI's requests go through it with its credentials,
+// and the other hosted providers' requests too, so that callers decide how
+// every request goes out.
+func contextTransport(ctx context.Context) http.RoundTripper {
+	client, ok := ctx.Value(oauth2.HTTPClient).(*http.Client)
+	if !ok {
+		return nil
+	}
+	return client.Transport
+}
+
+// contextWindows are the input context windows of model families, by
+// prefix of the model name, for APIs that don't report them
+var contextWindows = []struct {
+	prefix string
+	tokens int
+}{
+	{"gemini-1.5-pro", 2097152},
+	{"gemini-1.5-flash", 1048576},
+	{"gemini-2", 1048576},
+	{"claude-", 200000},
+}
+
+// knownContextWindow returns the context window of model, zero when it
+// isn't known
+func knownContextWindow(model string) int {
+	for _, window := range contextWindows {
+		if strings.HasPrefix(model, window.prefix) {
+			return window.tokens
+		}
+	}
+	return 0
+}
+
+// windowOverride replaces the context window a provider reports with the
+// one set in config
+type windowOverride struct {
+	Provider
+	window int
+}
+
+// CountTokens counts with the provider and reports the configured window
+func (w *windowOverride) CountTokens(ctx context.Context, req Request) (TokenCount, error) {
+	count, err := w.Provider.CountTokens(ctx, req)
+	count.Window = w.window
+	return count, err
+}
+
+func providerName(cfg config.LLM) string {
+	if cfg.Provider == "" {
+		return ProviderGemini
+	}
+	return cfg.Provider
+}
+
+// Meter wraps a provider and totals the tokens it uses
+type Meter struct {
+	Provider
+	mu    sync.Mutex
+	usage Usage
+	calls int
+}
+
+// NewMeter starts counting usage for provider
+func NewMeter(provider Provider) *Meter {
+	return &Meter{Provider: provider}
+}
+
+// Generate forwards the request and records its usage
+func (m *Meter) Generate(ctx context.Context, req Request) (Response, error) {
+	resp, err := m.Provider.Generate(ctx, req)
+	m.mu.Lock()
+	m.calls++
+	m.usage.Add(resp.Usage)
+	m.mu.Unlock()
+	return resp, err
+}
+
+// Usage returns the number of requests and the tokens used so far
+func (m *Meter) Usage() (int, Usage) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls, m.usage
+}
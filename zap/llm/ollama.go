@@ -0,0 +1,124 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// defaultOllamaURL is where a local Ollama server listens by default
+const defaultOllamaURL = "http://localhost:11434"
+
+// Ollama calls a local model through Ollama's HTTP API, so no task data
+// leaves the machine
+type Ollama struct {
+	baseURL string
+	model   string
+	client  *http.Client
+}
+
+// NewOllama creates an Ollama provider. An empty baseURL uses localhost.
+func NewOllama(baseURL string, model string) *Ollama {
+	if baseURL == "" {
+		baseURL = defaultOllamaURL
+	}
+	return &Ollama{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		model:   model,
+		// Local models can be slow, especially on the first request
+		client: &http.Client{Timeout: 10 * time.Minute},
+	}
+}
+
+// Name returns "ollama/<model>"
+func (o *Ollama) Name() string {
+	return ProviderOllama + "/" + o.model
+}
+
+type ollamaRequest struct {
+	Model   string                 `json:"model"`
+	Prompt  string                 `json:"prompt"`
+	System  string                 `json:"system,omitempty"`
+	Stream  bool                   `json:"stream"`
+	Options map[string]interface{} `json:"options,omitempty"`
+}
+
+type ollamaResponse struct {
+	Response        string `json:"response"`
+	PromptEvalCount int    `json:"prompt_eval_count"`
+	EvalCount       int    `json:"eval_count"`
+	Error           string `json:"error"`
+}
+
+// CountTokens returns ErrNoTokenCount; Ollama's API has no token count
+func (o *Ollama) CountTokens(ctx context.Context, req Request) (TokenCount, error) {
+	return TokenCount{}, ErrNoTokenCount
+}
+
+// Generate sends the prompt to /api/generate without streaming. Earlier
+// turns are folded into the prompt.
+func (o *Ollama) Generate(ctx context.Context, req Request) (Response, error) {
+	body := ollamaRequest{
+		Model:   o.model,
+		Prompt:  req.Transcript(),
+		System:  req.System,
+		Stream:  false,
+		Options: map[string]interface{}{"temperature": 0.1},
+	}
+	if req.Seed != 0 {
+		body.Options["seed"] = req.Seed
+		body.Options["temperature"] = 0
+	}
+	if req.JSON {
+		// Ollama's "format": "json" only allows objects, and zap's prompts
+		// ask for arrays, so rely on the prompt and the lenient parser
+		body.System = joinSystem(req.System, "Respond with valid JSON only. Do not add explanations or markdown.")
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return Response{}, fmt.Errorf("failed to encode Ollama request: %v", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, o.baseURL+"/api/generate", bytes.NewReader(payload))
+	if err != nil {
+		return Response{}, fmt.Errorf("failed to create Ollama request: %v", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	httpResp, err := o.client.Do(httpReq)
+	if err != nil {
+		return Response{}, fmt.Errorf("failed to call Ollama at %s: %v", o.baseURL, err)
+	}
+	defer httpResp.Body.Close()
+
+	data, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return Response{}, fmt.Errorf("failed to read Ollama response: %v", err)
+	}
+	var resp ollamaResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return Response{}, fmt.Errorf("failed to parse Ollama response (%s): %v", httpResp.Status, err)
+	}
+	if resp.Error != "" {
+		return Response{}, fmt.Errorf("Ollama returned %s: %s", httpResp.Status, resp.Error)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return Response{}, fmt.Errorf("Ollama returned %s", httpResp.Status)
+	}
+
+	usage := Usage{InputTokens: resp.PromptEvalCount, OutputTokens: resp.EvalCount}
+	if strings.TrimSpace(resp.Response) == "" {
+		return Response{Usage: usage}, fmt.Errorf("no response from Ollama")
+	}
+	return Response{Text: strings.TrimSpace(resp.Response), Usage: usage}, nil
+}
+
+// Close is a no-op; the HTTP client needs no cleanup
+func (o *Ollama) Close() error {
+	return nil
+}
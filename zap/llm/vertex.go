@@ -0,0 +1,228 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	// vertexScope is the OAuth scope Vertex AI requires
+	vertexScope = "https://www.googleapis.com/auth/cloud-platform"
+	// defaultVertexLocation is used when config doesn't set a region
+	defaultVertexLocation = "us-central1"
+)
+
+// Vertex calls Gemini through Vertex AI in a Google Cloud project, with
+// service-account or application-default credentials instead of an API key.
+// Requests stay in the configured region.
+type Vertex struct {
+	// endpoint is the model's URL, which the methods are appended to
+	endpoint string
+	model    string
+	client   *http.Client
+}
+
+// NewVertex creates a Vertex AI provider. credentialsPath is a service
+// account key file; when empty, application default credentials are used.
+func NewVertex(ctx context.Context, project, location, model, credentialsPath string) (*Vertex, error) {
+	if project == "" {
+		return nil, fmt.Errorf("vertex provider needs llm.project")
+	}
+	if location == "" {
+		location = defaultVertexLocation
+	}
+
+	var creds *google.Credentials
+	var err error
+	if credentialsPath != "" {
+		data, readErr := os.ReadFile(credentialsPath)
+		if readErr != nil {
+			return nil, fmt.Errorf("unable to read Vertex credentials: %v", readErr)
+		}
+		creds, err = google.CredentialsFromJSON(ctx, data, vertexScope)
+	} else {
+		creds, err = google.FindDefaultCredentials(ctx, vertexScope)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to load Vertex credentials: %v", err)
+	}
+
+	host := location + "-aiplatform.googleapis.com"
+	if location == "global" {
+		host = "aiplatform.googleapis.com"
+	}
+	return &Vertex{
+		endpoint: fmt.Sprintf("https://%s/v1/projects/%s/locations/%s/publishers/google/models/%s", host, project, location, model),
+		model:    model,
+		client:   oauth2.NewClient(ctx, creds.TokenSource),
+	}, nil
+}
+
+// Name returns "vertex/<model>"
+func (v *Vertex) Name() string {
+	return ProviderVertex + "/" + v.model
+}
+
+type vertexPart struct {
+	Text string `json:"text"`
+}
+
+type vertexContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []vertexPart `json:"parts"`
+}
+
+type vertexRequest struct {
+	SystemInstruction *vertexContent         `json:"systemInstruction,omitempty"`
+	Contents          []vertexContent        `json:"contents"`
+	GenerationConfig  map[string]interface{} `json:"generationConfig"`
+}
+
+type vertexResponse struct {
+	Candidates []struct {
+		Content vertexContent `json:"content"`
+	} `json:"candidates"`
+	UsageMetadata struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+	} `json:"usageMetadata"`
+	Error *struct {
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error"`
+}
+
+// Generate calls generateContent with the request's instructions as the
+// system instruction, the earlier turns and the prompt. JSON requests set the response MIME type so the model returns bare JSON.
+func (v *Vertex) Generate(ctx context.Context, req Request) (Response, error) {
+	body := vertexRequest{
+		SystemInstruction: vertexSystem(req),
+		Contents:          vertexContents(req),
+		GenerationConfig:  map[string]interface{}{"temperature": 0.1},
+	}
+	if req.Seed != 0 {
+		body.GenerationConfig["seed"] = req.Seed
+		body.GenerationConfig["temperature"] = 0
+	}
+	if req.JSON {
+		body.GenerationConfig["responseMimeType"] = "application/json"
+	}
+
+	httpResp, data, err := v.post(ctx, "generateContent", body)
+	if err != nil {
+		return Response{}, err
+	}
+	var resp vertexResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return Response{}, fmt.Errorf("failed to parse Vertex AI response (%s): %v", httpResp.Status, err)
+	}
+	if resp.Error != nil {
+		return Response{}, fmt.Errorf("Vertex AI returned %s: %s", resp.Error.Status, resp.Error.Message)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return Response{}, fmt.Errorf("Vertex AI returned %s", httpResp.Status)
+	}
+
+	usage := Usage{InputTokens: resp.UsageMetadata.PromptTokenCount, OutputTokens: resp.UsageMetadata.CandidatesTokenCount}
+	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
+		return Response{Usage: usage}, fmt.Errorf("no response from Vertex AI")
+	}
+	var text strings.Builder
+	for _, part := range resp.Candidates[0].Content.Parts {
+		text.WriteString(part.Text)
+	}
+	return Response{Text: strings.TrimSpace(text.String()), Usage: usage}, nil
+}
+
+type vertexCountRequest struct {
+	SystemInstruction *vertexContent  `json:"systemInstruction,omitempty"`
+	Contents          []vertexContent `json:"contents"`
+}
+
+type vertexCountResponse struct {
+	TotalTokens int `json:"totalTokens"`
+	Error       *struct {
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error"`
+}
+
+// CountTokens calls countTokens with what Generate would send. Vertex AI
+// doesn't report context windows, so the window is the model family's.
+func (v *Vertex) CountTokens(ctx context.Context, req Request) (TokenCount, error) {
+	httpResp, data, err := v.post(ctx, "countTokens", vertexCountRequest{SystemInstruction: vertexSystem(req), Contents: vertexContents(req)})
+	if err != nil {
+		return TokenCount{}, err
+	}
+	var resp vertexCountResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return TokenCount{}, fmt.Errorf("failed to parse Vertex AI token count (%s): %v", httpResp.Status, err)
+	}
+	if resp.Error != nil {
+		return TokenCount{}, fmt.Errorf("Vertex AI returned %s: %s", resp.Error.Status, resp.Error.Message)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return TokenCount{}, fmt.Errorf("Vertex AI returned %s", httpResp.Status)
+	}
+	return TokenCount{Tokens: resp.TotalTokens, Window: knownContextWindow(v.model)}, nil
+}
+
+// vertexContents returns the earlier turns and the prompt as contents
+func vertexContents(req Request) []vertexContent {
+	var contents []vertexContent
+	for _, turn := range req.History {
+		contents = append(contents,
+			vertexContent{Role: "user", Parts: []vertexPart{{Text: turn.Prompt}}},
+			vertexContent{Role: "model", Parts: []vertexPart{{Text: turn.Answer}}})
+	}
+	return append(contents, vertexContent{Role: "user", Parts: []vertexPart{{Text: req.Prompt}}})
+}
+
+// vertexSystem returns the request's instructions as the system
+// instruction, nil without any
+func vertexSystem(req Request) *vertexContent {
+	if req.System == "" {
+		return nil
+	}
+	return &vertexContent{Parts: []vertexPart{{Text: req.System}}}
+}
+
+// post sends body as JSON to the model's method and returns the response
+// with its body read
+func (v *Vertex) post(ctx context.Context, method string, body interface{}) (*http.Response, []byte, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode Vertex AI request: %v", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, v.endpoint+":"+method, bytes.NewReader(payload))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create Vertex AI request: %v", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	httpResp, err := v.client.Do(httpReq)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to call Vertex AI: %v", err)
+	}
+	defer httpResp.Body.Close()
+
+	data, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read Vertex AI response: %v", err)
+	}
+	return httpResp, data, nil
+}
+
+// Close is a no-op; the HTTP client needs no cleanup
+func (v *Vertex) Close() error {
+	return nil
+}
@@ -0,0 +1,240 @@
+package lock
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// StaleAfter is how long a lock may go without a heartbeat before other
+	// processes take it over
+	StaleAfter = 2 * time.Minute
+	// heartbeat is how often a held lock's file is touched
+	heartbeat = StaleAfter / 4
+	// pollInterval is how often a waiting process retries
+	pollInterval = 500 * time.Millisecond
+)
+
+// Holder describes the process holding a lock. It is the lock file's content.
+type Holder struct {
+	PID      int       `json:"pid"`
+	Host     string    `json:"host"`
+	Name     string    `json:"name"`
+	Acquired time.Time `json:"acquired"`
+}
+
+func (h Holder) String() string {
+	return fmt.Sprintf("pid %d on %s since %s", h.PID, h.Host, h.Acquired.Local().Format("15:04:05"))
+}
+
+// same reports whether two holders describe the same acquisition
+func (h Holder) same(other Holder) bool {
+	return h.PID == other.PID && h.Host == other.Host && h.Acquired.Equal(other.Acquired)
+}
+
+// HeldError is returned when a lock is still held when the wait ends
+type HeldError struct {
+	Name   string
+	Holder Holder
+}
+
+func (e *HeldError) Error() string {
+	return fmt.Sprintf("%s is locked by %s", e.Name, e.Holder)
+}
+
+// Lock is an exclusive lock on a name, shared between zap processes through
+// a file in a directory they all use. A held lock's file is touched
+// regularly; one that hasn't been touched for StaleAfter, or whose holder
+// is no longer running on this host, is stale and is taken over.
+type Lock struct {
+	path string
+	self Holder
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+// Path returns the lock file for name in dir
+func Path(dir, name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return filepath.Join(dir, hex.EncodeToString(sum[:])[:16]+".lock")
+}
+
+// Acquire takes the lock on name in dir, waiting until it is free or ctx is
+// done. onWait is called once with the holder if the lock is busy.
+func Acquire(ctx context.Context, dir, name string, onWait func(Holder)) (*Lock, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("unable to create lock directory: %v", err)
+	}
+	host, _ := os.Hostname()
+	self := Holder{PID: os.Getpid(), Host: host, Name: name}
+	path := Path(dir, name)
+
+	waiting := false
+	for {
+		self.Acquired = time.Now().UTC()
+		err := create(path, self)
+		if err == nil {
+			l := &Lock{path: path, self: self, stop: make(chan struct{})}
+			l.done.Add(1)
+			go l.beat()
+			return l, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		holder, stale, err := inspect(path, host)
+		if errors.Is(err, os.ErrNotExist) {
+			// Released between our attempt and the inspection
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if stale {
+			if err := removeStale(path, holder); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if !waiting && onWait != nil {
+			onWait(holder)
+		}
+		waiting = true
+		select {
+		case <-ctx.Done():
+			return nil, &HeldError{Name: name, Holder: holder}
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// create makes the lock file, failing with os.ErrExist if it exists
+func create(path string, self Holder) error {
+	data, err := json.Marshal(self)
+	if err != nil {
+		return fmt.Errorf("unable to encode lock: %v", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return err
+		}
+		return fmt.Errorf("unable to create lock %s: %v", path, err)
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return fmt.Errorf("unable to write lock %s: %v", path, err)
+	}
+	return nil
+}
+
+// inspect reads a lock file and reports whether it is stale
+func inspect(path, host string) (Holder, bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Holder{}, false, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Holder{}, false, err
+	}
+	var holder Holder
+	if err := json.Unmarshal(data, &holder); err != nil {
+		// A holder that died while writing the file leaves it empty or cut off
+		return holder, time.Since(info.ModTime()) > heartbeat, nil
+	}
+	if time.Since(info.ModTime()) > StaleAfter {
+		return holder, true, nil
+	}
+	return holder, holder.Host == host && !running(holder.PID), nil
+}
+
+// removeStale removes a stale lock file. Other waiters may find the same
+// file stale and one of them may already have replaced it with its own
+// lock, so the file is moved aside first and put back if it turns out not
+// to be the stale one.
+func removeStale(path string, stale Holder) error {
+	aside := fmt.Sprintf("%s.stale-%d", path, os.Getpid())
+	if err := os.Rename(path, aside); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("unable to remove stale lock %s: %v", path, err)
+	}
+	defer os.Remove(aside)
+
+	data, err := os.ReadFile(aside)
+	if err != nil {
+		return fmt.Errorf("unable to remove stale lock %s: %v", path, err)
+	}
+	var holder Holder
+	if json.Unmarshal(data, &holder) == nil && !holder.same(stale) {
+		// A fresh lock; restoring it fails only if yet another one was created
+		os.Link(aside, path)
+	}
+	return nil
+}
+
+// running reports whether a process exists. Where that can't be told,
+// such as on Windows, the process is assumed to be running and the lock
+// goes stale through its heartbeat instead.
+func running(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return !errors.Is(process.Signal(syscall.Signal(0)), os.ErrProcessDone)
+}
+
+// beat touches the lock file until the lock is released
+func (l *Lock) beat() {
+	defer l.done.Done()
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			now := time.Now()
+			os.Chtimes(l.path, now, now)
+		}
+	}
+}
+
+// Release gives up the lock. A lock that was taken over as stale, because
+// this process stalled, is left to its new holder.
+func (l *Lock) Release() error {
+	if l == nil {
+		return nil
+	}
+	close(l.stop)
+	l.done.Wait()
+	data, err := os.ReadFile(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	var holder Holder
+	if err == nil && json.Unmarshal(data, &holder) == nil && !holder.same(l.self) {
+		return nil
+	}
+	if err := os.Remove(l.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("unable to release lock %s: %v", l.path, err)
+	}
+	return nil
+}
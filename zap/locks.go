@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+
+	"zap/lock"
+	"zap/todo"
+)
+
+// lockList takes the lock on a list for the app's user, so other zap
+// processes writing to it wait instead of interleaving their moves. It
+// waits up to the lock timeout. Dry runs write nothing and take no lock.
+func (a *app) lockList(ctx context.Context, taskList *todo.TaskList) (*lock.Lock, error) {
+	if a.dryRun {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, a.lockTimeout)
+	defer cancel()
+	l, err := lock.Acquire(ctx, a.lockDir, a.lockOwner+"/"+taskList.ID, func(holder lock.Holder) {
+		a.progress.Printf("Waiting for list %s, which another zap process is changing (%s)\n", taskList.Title, holder)
+	})
+	var held *lock.HeldError
+	if errors.As(err, &held) {
+		return nil, fmt.Errorf("list %s is still locked by %s after %s", taskList.Title, held.Holder, a.lockTimeout)
+	}
+	return l, err
+}
+
+// lockLists locks every list in titles, in a fixed order so that two
+// processes never each hold a lock the other is waiting for. Lists that
+// stay locked are left out and recorded as failures. It returns the lists
+// that can be run and a function that releases their locks.
+func (a *app) lockLists(ctx context.Context, titles []string) ([]string, func(), error) {
+	if a.dryRun {
+		return titles, func() {}, nil
+	}
+
+	taskLists := make([]*todo.TaskList, len(titles))
+	for i, title := range titles {
+		taskList, err := a.service.GetTaskListByTitle(title)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error finding task list %s: %w", title, err)
+		}
+		taskLists[i] = taskList
+	}
+	order := make([]int, len(titles))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return taskLists[order[i]].ID < taskLists[order[j]].ID })
+
+	var locks []*lock.Lock
+	release := func() {
+		for _, l := range locks {
+			if err := l.Release(); err != nil {
+				log.Print(err)
+			}
+		}
+	}
+	locked := make([]bool, len(titles))
+	for _, i := range order {
+		l, err := a.lockList(ctx, taskLists[i])
+		if err != nil {
+			if ctx.Err() != nil {
+				release()
+				return nil, nil, ctx.Err()
+			}
+			log.Print(err)
+			a.result.fail(err)
+			continue
+		}
+		locks = append(locks, l)
+		locked[i] = true
+	}
+
+	var kept []string
+	for i, title := range titles {
+		if locked[i] {
+			kept = append(kept, title)
+		}
+	}
+	return kept, release, nil
+}
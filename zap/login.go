@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+
+	"zap/auth"
+	"zap/config"
+)
+
+// runLogin signs in with an installed-app OAuth client and caches the token
+// for profiles using 'auth: oauth'
+func runLogin(args []string) {
+	flags := flag.NewFlagSet("login", flag.ExitOnError)
+	configPath := flags.String("config", "", configFlagUsage)
+	profileName := flags.String("profile", "", "Config profile to log in for")
+	port := flags.Int("port", 0, "Local port for the OAuth callback (0 picks a free port)")
+	readOnly := flags.Bool("read-only", false, "Only request the read-only Tasks scope")
+	noBrowser := flags.Bool("no-browser", false, "Authorize in a browser on another device and paste the redirected URL back")
+	flags.Parse(args)
+
+	profile := loadProfile(flags, *configPath, *profileName)
+	if profile.Auth != config.AuthOAuth {
+		fmt.Fprintf(os.Stderr, "Note: this profile uses %s auth; set 'auth: oauth' to use the cached login.\n", profile.Auth)
+	}
+
+	scopes := profile.Scopes
+	if *readOnly {
+		scopes = []string{auth.ScopeTasksReadonly}
+	} else {
+		// Exporting reports needs Sheets access, planning around the day's
+		// events or preparing for meetings Calendar access, and turning
+		// mail into tasks Gmail access, as well
+		if profile.Sheets != nil {
+			scopes = withScope(scopes, auth.ScopeSheets)
+		}
+		if profile.Calendar != nil || profile.Prep != nil {
+			scopes = withScope(scopes, auth.ScopeCalendarReadonly)
+		}
+		if profile.Gmail != nil {
+			scopes = withScope(scopes, auth.ScopeGmailReadonly)
+		}
+	}
+	oauthConfig, err := auth.NewOAuthConfig(profile.ClientSecret, scopes...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var token *auth.Token
+	if *noBrowser {
+		token, err = oauthConfig.LoginWithPaste(context.Background(), *port, os.Stdin, os.Stdout)
+	} else {
+		token, err = oauthConfig.LoginWithBrowser(context.Background(), *port, os.Stdout)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := auth.SaveToken(profile.TokenFile, token); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("Logged in with scopes %s. Token saved to %s\n", strings.Join(token.Scopes, ", "), profile.TokenFile)
+}
+
+// withScope adds scope to the requested scopes, which default to the Tasks
+// scope
+func withScope(scopes []string, scope string) []string {
+	if slices.Contains(scopes, scope) {
+		return scopes
+	}
+	if len(scopes) == 0 {
+		scopes = []string{auth.ScopeTasks}
+	}
+	return append(append([]string(nil), scopes...), scope)
+}
@@ -1,144 +1,1165 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
+	"zap/audit"
 	"zap/auth"
+	"zap/backend"
+	"zap/backend/asana"
+	"zap/backend/files"
+	"zap/backend/github"
+	"zap/backend/trello"
+	"zap/budget"
+	"zap/config"
+	"zap/datetime"
+	"zap/experiment"
 	"zap/gemini"
+	"zap/i18n"
+	"zap/llm"
+	"zap/notes"
+	"zap/notify"
+	"zap/paths"
+	"zap/prefs"
+	"zap/progress"
+	"zap/recurrence"
+	"zap/redact"
+	"zap/sheets"
+	"zap/store"
 	"zap/tasks"
+	"zap/todo"
 
 	tasksapi "google.golang.org/api/tasks/v1"
 )
 
 // TaskData holds the task list and its tasks
 type TaskData struct {
-	TaskList *tasksapi.TaskList
-	Tasks    []*tasksapi.Task
+	TaskList *todo.TaskList
+	Tasks    []*todo.Task
+}
+
+// commands maps subcommand names to their entry points
+var commands = map[string]func(args []string){
+	"login":       runLogin,
+	"daemon":      runDaemon,
+	"template":    runTemplate,
+	"list":        runList,
+	"tag":         runTag,
+	"search":      runSearch,
+	"explain":     runExplain,
+	"paths":       runPaths,
+	"doctor":      runDoctor,
+	"stats":       runStats,
+	"eval":        runEval,
+	"experiments": runExperiments,
+	"resume":      runResume,
+	"queue":       runQueue,
+	"ics":         runICS,
+	"delegate":    runDelegate,
+	"team":        runTeam,
+	"snooze":      runSnooze,
+	"next":        runNext,
+	"start":       runStart,
+	"stop":        runStop,
+	"triage":      runTriage,
+	"preferences": runPreferences,
+	"config":      runConfig,
+	"subscribe":   runSubscribe,
+	"gmail":       runGmail,
+	"prep":        runPrep,
+	"serve":       runServe,
+	"bot":         runBot,
+	"caldav":      runCalDAV,
+	"jobs":        runJobs,
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			command(os.Args[2:])
+			return
+		}
+	}
+
 	// Parse command line flags
-	userEmail := flag.String("u", "", "User email to impersonate")
+	flags := registerRunFlags(flag.CommandLine)
+	assertIdempotent := flag.Bool("assert-idempotent", false, "After the run, repeat it without applying changes and fail if it would change anything")
+	output := flag.String("output", outputText, "Output format: text, or json to print a result object on stdout")
+	interactive := flag.Bool("interactive", false, "Review each ranking the model proposes: accept it, reject it, or type feedback to have it revised")
+	diff := flag.Bool("diff", false, "Show each list's current and proposed order side by side before reordering it (always on with --dry-run)")
 	flag.Parse()
+	if *output != outputText && *output != outputJSON {
+		log.Fatalf("unknown output format %q (want %s or %s)", *output, outputText, outputJSON)
+	}
+	if *interactive && *assertIdempotent {
+		log.Fatal("--interactive can't be combined with --assert-idempotent, since rejected lists would be ranked again")
+	}
+	// Progress bars would redraw over the questions
+	if *interactive {
+		*flags.plain = true
+	}
+	if *output == outputJSON {
+		flags.out = os.Stderr
+	}
 
-	if *userEmail == "" {
-		log.Fatal("User email is required. Use -u flag to specify the email address.")
+	// Ctrl-C and SIGTERM cancel the writes in flight; what is left is
+	// checkpointed for zap resume
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	app, err := flags.newApp(ctx, flag.CommandLine)
+	if err != nil {
+		exit(&runResult{}, err, *output)
 	}
 
-	ctx := context.Background()
+	if *interactive {
+		app.review = reviewer(app.in, app.progress.Out(), prefs.New(app.store, app.clock, app.dryRun))
+	}
+	app.diff = *diff
 
-	// Initialize service account configuration
-	authConfig, err := auth.NewConfig("credentials.json")
+	if *assertIdempotent && app.dryRun {
+		err = errors.New("--assert-idempotent needs a run that applies its changes; drop --dry-run and --read-only")
+	}
+	if err == nil {
+		err = app.run(ctx)
+	}
+	if err == nil && *assertIdempotent {
+		err = app.assertIdempotent(ctx)
+	}
+	app.reportCheckpoints()
+	app.Close()
+	exit(app.result, err, *output)
+}
+
+// runFlags are the flags shared by every command that performs a run
+type runFlags struct {
+	userEmail   *string
+	readOnly    *bool
+	dryRun      *bool
+	scopes      *string
+	configPath  *string
+	profileName *string
+	suggest     *bool
+	seed        *int64
+	plain       *bool
+	lockTimeout *time.Duration
+	yes         *bool
+	force       *bool
+	showPrompt  *bool
+
+	// out receives human-readable output; nil means stdout
+	out io.Writer
+	// cacheTasks keeps the user's Google Tasks lists and tasks in the state
+	// file between runs, for servers acting for many users
+	cacheTasks bool
+}
+
+// registerRunFlags adds the run flags to a flag set
+func registerRunFlags(flags *flag.FlagSet) *runFlags {
+	return &runFlags{
+		userEmail:   flags.String("u", "", "User email to impersonate (overrides the profile's user)"),
+		readOnly:    flags.Bool("read-only", false, "Request only the read-only Tasks scope and print planned changes instead of applying them"),
+		dryRun:      flags.Bool("dry-run", false, "Print planned changes instead of applying them"),
+		scopes:      flags.String("scopes", "", "Comma-separated OAuth scopes to request (overrides the profile's scopes)"),
+		configPath:  flags.String("config", "", configFlagUsage),
+		profileName: flags.String("profile", "", "Config profile to use"),
+		suggest:     flags.Bool("suggest", false, "Only suggest an order, as set by the profile's annotate option, without moving tasks"),
+		plain:       flags.Bool("plain", false, "Print one line per step instead of progress bars, e.g. for CI logs"),
+		lockTimeout: flags.Duration("lock-timeout", 5*time.Minute, "How long to wait for lists another zap process is changing"),
+		seed:        flags.Int64("seed", 0, "Seed for LLM sampling, for reproducible runs with providers that support it (0: unseeded)"),
+		yes:         flags.Bool("yes", false, "Apply changes without asking first"),
+		force:       flags.Bool("force", false, "Delete tasks without asking to type delete first"),
+		showPrompt:  flags.Bool("show-prompt", false, "Print every prompt sent to the model, its system instruction and its user turn, to stderr for debugging"),
+	}
+}
+
+// app holds the clients a run needs
+type app struct {
+	profile      *config.Profile
+	readOnly     bool
+	service      *tasks.Service
+	gemini       *gemini.GeminiClient
+	meter        *llm.Meter
+	orchestrator *tasks.Orchestrator
+	// outbox keeps the writes that fail without a connection for the next
+	// run; nil in dry runs
+	outbox    *tasks.Outbox
+	store     *store.Store
+	clock     *datetime.Clock
+	notifier  notify.Notifier
+	progress  *progress.Reporter
+	budget    *budget.Budget
+	dryRun    bool
+	userEmail string
+	// sheets exports run reports; it is created by the first export
+	sheets *sheets.Exporter
+	// lockDir holds the list locks shared with other zap processes, which
+	// are taken per lockOwner and list
+	lockDir     string
+	lockOwner   string
+	lockTimeout time.Duration
+	// suggestOnly is set when tasks must not be moved
+	suggestOnly  tasks.Annotation
+	subtaskOrder tasks.SubtaskOrder
+	// noteLog is the events logged in the notes of the tasks they happen to
+	noteLog []notes.Kind
+	// namespace names zap's block in notes and the markers it writes
+	namespace notes.Namespace
+	// filter keeps the tasks the profile's filters exclude away from the
+	// model and out of every change; nil excludes nothing
+	filter *tasks.Filter
+	// experiment, when set, ranks every list again with a variant prompt,
+	// model or prioritizer in shadow; promoted is set once the variant
+	// ranks the lists instead
+	experiment *experiment.Runner
+	promoted   bool
+
+	// ranked and subtasksAsked remember the model's answers from the last
+	// run; replaying reuses them instead of asking again
+	ranked        map[string][]gemini.TaskPriority
+	subtasksAsked map[string]bool
+	replaying     bool
+	// skipSubtasks holds the lists the budget left no room to break down
+	skipSubtasks map[string]bool
+	// review, when set, has the user review each ranking the model proposes
+	review tasks.ReviewFunc
+	// diff shows each list's current and proposed order before reordering
+	diff bool
+	// in reads the user's answers to questions
+	in *bufio.Reader
+
+	// result collects what the last run did, for --output json
+	result *runResult
+}
+
+// newApp authenticates and creates the clients for the selected profile
+func (f *runFlags) newApp(ctx context.Context, flags *flag.FlagSet) (*app, error) {
+	return f.profileApp(ctx, loadProfile(flags, *f.configPath, *f.profileName))
+}
+
+// profileApp sets up a run of profile as the flags ask
+func (f *runFlags) profileApp(ctx context.Context, profile *config.Profile) (*app, error) {
+	ctx, err := httpContext(ctx, profile)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+	userEmail := *f.userEmail
+	if userEmail == "" {
+		userEmail = profile.User
+	}
+	if userEmail == "" && profile.Auth == config.AuthServiceAccount && profile.Backend == config.BackendGoogleTasks {
+		return nil, fmt.Errorf("user email is required; use -u flag or set user in the profile")
 	}
 
-	// Create the tasks service using service account with user impersonation
-	taskService, err := authConfig.CreateClientAsUser(ctx, *userEmail)
+	// Read-only mode always narrows the request to the read-only scope
+	requestedScopes := profile.Scopes
+	if *f.scopes != "" {
+		requestedScopes = strings.Split(*f.scopes, ",")
+	}
+	if *f.readOnly {
+		requestedScopes = []string{auth.ScopeTasksReadonly}
+	}
+
+	// Other backends are served as the Tasks API; the service is told which
+	// one so rankings are written the way its lists record them
+	var serviceOpts []tasks.ServiceOption
+	taskBackend, err := newProvider(profile)
 	if err != nil {
-		log.Fatal(err)
+		return nil, &exitError{code: exitAuth, err: err}
+	}
+	var taskService *tasksapi.Service
+	if taskBackend != nil {
+		taskService, err = backend.Service(ctx, taskBackend)
+		serviceOpts = append(serviceOpts, tasks.WithBackend(taskBackend))
+	} else {
+		taskService, err = createTasksClient(ctx, profile, requestedScopes, userEmail, *f.readOnly)
+	}
+	if err != nil {
+		return nil, &exitError{code: exitAuth, err: err}
+	}
+
+	// Human-readable output goes to stdout unless a command prints results there
+	out := f.out
+	if out == nil {
+		out = os.Stdout
+	}
+	// Progress bars would redraw over the questions before each change
+	confirming := !*f.readOnly && !*f.dryRun && !*f.yes
+	reporter := progress.New(out, *f.plain || confirming)
+
+	// Messages and the model's answers are in the profile's language
+	var languageName string
+	if profile.Language != "" {
+		tag, err := i18n.Parse(profile.Language)
+		if err != nil {
+			return nil, fmt.Errorf("profile language: %v", err)
+		}
+		reporter.SetPrinter(i18n.Printer(tag))
+		languageName = i18n.Name(tag)
+	}
+
+	// Zap's block and markers in tasks are named so other tools' are left alone
+	namespace, err := notes.ParseNamespace(profile.Namespace)
+	if err != nil {
+		return nil, fmt.Errorf("profile namespace: %v", err)
 	}
 
 	// Initialize the Tasks service wrapper
-	service, err := tasks.NewService(ctx, taskService)
+	if *f.readOnly {
+		serviceOpts = append(serviceOpts, tasks.WithReadOnly())
+		reporter.Printf("Running in read-only mode: no changes will be made.\n")
+	}
+	st, err := store.Open(profile.StateFile)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+	if f.cacheTasks && taskBackend == nil {
+		serviceOpts = append(serviceOpts, tasks.WithCache(st))
+	}
+	service, err := tasks.NewService(ctx, taskService, serviceOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	clock, err := datetime.NewClock(profile.Timezone)
+	if err != nil {
+		return nil, err
 	}
 
-	// Initialize Gemini client
-	geminiKey := os.Getenv("GEMINI_API_KEY")
-	if geminiKey == "" {
-		log.Fatal("GEMINI_API_KEY environment variable is not set")
+	var spend *budget.Budget
+	if profile.Budget != nil {
+		spend = budget.New(st, clock, *profile.Budget)
+	}
+
+	// Initialize the LLM client. Commands that don't need it work without a key.
+	var geminiClient *gemini.GeminiClient
+	var meter *llm.Meter
+	var auditLog *audit.Log
+	provider, err := llm.New(ctx, profile.LLM)
+	switch {
+	case errors.Is(err, llm.ErrNoAPIKey):
+	case err != nil:
+		return nil, &exitError{code: exitLLM, err: err}
+	default:
+		if profile.Audit != nil {
+			auditLog, err = openAuditLog(profile.Audit, st)
+			if err != nil {
+				return nil, err
+			}
+			provider = audit.Wrap(provider, auditLog)
+		}
+		if spend != nil {
+			provider = budget.WrapProvider(provider, spend)
+		}
+		meter = llm.NewMeter(provider)
+		geminiClient = gemini.NewClient(meter)
+		geminiClient.SetSeed(*f.seed)
+		geminiClient.SetLanguage(languageName)
+		geminiClient.SetNamespace(namespace)
+		geminiClient.SetRules(profile.Rules)
+		if *f.showPrompt {
+			geminiClient.SetPromptWriter(os.Stderr)
+		}
+		if profile.Redact != nil {
+			redactor, err := redact.New(profile.Redact.Rules, profile.Redact.Patterns)
+			if err != nil {
+				return nil, fmt.Errorf("profile redact: %v", err)
+			}
+			geminiClient.SetRedactor(redactor)
+		}
+		if profile.Truncate != nil {
+			limits := gemini.DefaultLimits
+			if profile.Truncate.Title > 0 {
+				limits.Title = profile.Truncate.Title
+			}
+			if profile.Truncate.Notes > 0 {
+				limits.Notes = profile.Truncate.Notes
+			}
+			if profile.Truncate.Prompt > 0 {
+				limits.Prompt = profile.Truncate.Prompt
+			}
+			geminiClient.SetLimits(limits)
+			if profile.Truncate.Summarize {
+				geminiClient.SetSummaries(st, *f.readOnly || *f.dryRun)
+			}
+		}
+		if profile.Ensemble != nil {
+			var others []llm.Provider
+			for i, cfg := range profile.Ensemble.LLMs {
+				other, err := llm.New(ctx, cfg)
+				if err != nil {
+					return nil, &exitError{code: exitLLM, err: fmt.Errorf("ensemble llm %d: %v", i+1, err)}
+				}
+				if auditLog != nil {
+					other = audit.Wrap(other, auditLog)
+				}
+				if spend != nil {
+					other = budget.WrapProvider(other, spend)
+				}
+				others = append(others, other)
+			}
+			geminiClient.SetEnsemble(profile.Ensemble.Samples, others)
+		}
 	}
 
-	geminiClient, err := gemini.NewGeminiClient(geminiKey, taskService, "gemini-2.0-flash-thinking-exp-01-21")
+	// An experiment ranks with its variant next to the profile's ranking
+	var shadow *experiment.Runner
+	if profile.Experiment != nil && profile.Experiment.Prioritizer == config.PrioritizerHeuristic {
+		shadow = experiment.New(profile.Experiment.Name, nil, st, clock, *f.readOnly || *f.dryRun)
+	} else if profile.Experiment != nil && geminiClient != nil {
+		var variantProvider llm.Provider
+		if profile.Experiment.LLM != nil {
+			variantProvider, err = llm.New(ctx, *profile.Experiment.LLM)
+			if err != nil {
+				return nil, &exitError{code: exitLLM, err: fmt.Errorf("experiment %s: %v", profile.Experiment.Name, err)}
+			}
+			if auditLog != nil {
+				variantProvider = audit.Wrap(variantProvider, auditLog)
+			}
+			if spend != nil {
+				variantProvider = budget.WrapProvider(variantProvider, spend)
+			}
+		}
+		variant := geminiClient.Variant(variantProvider)
+		if profile.Experiment.Prompt != "" {
+			template, err := os.ReadFile(profile.Experiment.Prompt)
+			if err != nil {
+				return nil, fmt.Errorf("experiment %s: %v", profile.Experiment.Name, err)
+			}
+			if err := variant.SetRankTemplate(string(template)); err != nil {
+				return nil, fmt.Errorf("experiment %s: %v", profile.Experiment.Name, err)
+			}
+		}
+		shadow = experiment.New(profile.Experiment.Name, variant, st, clock, *f.readOnly || *f.dryRun)
+	}
+
+	// All writes go through the orchestrator; without write access they are
+	// only printed
+	var writer tasks.Writer = service
+	if spend != nil {
+		writer = budget.WrapWriter(service, spend)
+	}
+	// Writes that fail without a connection wait for the next run, and
+	// interrupted runs leave what they didn't get to for zap resume
+	outbox := tasks.NewOutbox(writer, service, st, clock)
+	writer = tasks.NewCheckpointer(outbox, st, clock)
+	in := bufio.NewReader(os.Stdin)
+	if confirming || !*f.force {
+		confirm := &confirmer{in: in, out: reporter.Out(), yes: *f.yes, force: *f.force}
+		writer = tasks.NewGate(writer, confirm.confirm)
+	}
+	if *f.readOnly || *f.dryRun {
+		outbox = nil
+		writer = tasks.NewDryRunWriter(reporter.Out())
+		if !*f.readOnly {
+			reporter.Printf("Dry run: planned changes will be printed, not applied.\n")
+		}
+	}
+
+	// OAuth profiles may have no user; the login identifies the account then
+	lockOwner := userEmail
+	if lockOwner == "" {
+		lockOwner = profile.TokenFile
+	}
+	switch profile.Backend {
+	case config.BackendTrello:
+		lockOwner = "trello:" + profile.Trello.Board
+	case config.BackendAsana:
+		lockOwner = "asana:" + profile.Asana.Workspace + ":" + strings.Join(profile.Asana.Projects, ",")
+	case config.BackendGitHub:
+		lockOwner = "github:" + profile.GitHub.Repo
+	case config.BackendFiles:
+		lockOwner = "files:" + profile.Files.Path
+	}
+
+	var suggestOnly tasks.Annotation
+	if *f.suggest || profile.Mode == config.ModeSuggest {
+		suggestOnly, err = tasks.ParseAnnotation(profile.Annotate)
+		if err != nil {
+			return nil, fmt.Errorf("profile annotate: %v", err)
+		}
+	}
+
+	subtaskOrder, err := tasks.ParseSubtaskOrder(profile.SubtaskOrder)
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("profile subtask_order: %v", err)
+	}
+
+	noteLog := make([]notes.Kind, len(profile.NoteLog))
+	for i, name := range profile.NoteLog {
+		if noteLog[i], err = notes.ParseKind(name); err != nil {
+			return nil, fmt.Errorf("profile note_log: %v", err)
+		}
+	}
+
+	var filter *tasks.Filter
+	if profile.Filters != nil {
+		filter, err = tasks.NewFilter(filterRules(profile.Filters.Skip), filterRules(profile.Filters.Include), clock)
+		if err != nil {
+			return nil, fmt.Errorf("profile filters: %v", err)
+		}
+	}
+
+	return &app{
+		profile:      profile,
+		readOnly:     *f.readOnly,
+		service:      service,
+		gemini:       geminiClient,
+		meter:        meter,
+		orchestrator: tasks.NewOrchestrator(writer),
+		outbox:       outbox,
+		store:        st,
+		clock:        clock,
+		notifier:     notify.New(profile.Notifier.Webhook, reporter.Out()),
+		progress:     reporter,
+		budget:       spend,
+		userEmail:    userEmail,
+		dryRun:       *f.readOnly || *f.dryRun,
+		lockDir:      filepath.Join(filepath.Dir(profile.StateFile), "locks"),
+		lockOwner:    lockOwner,
+		lockTimeout:  *f.lockTimeout,
+		suggestOnly:  suggestOnly,
+		subtaskOrder: subtaskOrder,
+		noteLog:      noteLog,
+		namespace:    namespace,
+		filter:       filter,
+		experiment:   shadow,
+		in:           in,
+	}, nil
+}
+
+// filterRules converts the config's filter rules
+func filterRules(rules []config.FilterRule) []tasks.Rule {
+	converted := make([]tasks.Rule, len(rules))
+	for i, rule := range rules {
+		converted[i] = tasks.Rule{Title: rule.Title, Pattern: rule.Pattern, Tag: rule.Tag, DueWithin: rule.DueWithin, DueAfter: rule.DueAfter}
+	}
+	return converted
+}
+
+// Close releases the app's clients
+func (a *app) Close() {
+	if a.gemini != nil {
+		a.gemini.Close()
+	}
+	// A variant without a model of its own shares the profile's
+	if a.experiment != nil && a.profile.Experiment.LLM != nil {
+		a.experiment.Variant().Close()
+	}
+}
+
+// reportConflicts surfaces the updates dropped because their tasks were
+// changed elsewhere, e.g. in the phone app, while zap ran
+func (a *app) reportConflicts() {
+	conflicts := a.orchestrator.Conflicts()
+	if len(conflicts) == 0 {
+		return
+	}
+	var messages []string
+	for _, conflict := range conflicts {
+		messages = append(messages, conflict.Error())
+	}
+	a.result.Conflicts = append(a.result.Conflicts, messages...)
+	a.progress.Printf("Kept changes made elsewhere to %d tasks instead of zap's:\n  %s\n", len(conflicts), strings.Join(messages, "\n  "))
+}
+
+// requireGemini fails when the LLM provider's API key wasn't set
+func (a *app) requireGemini() error {
+	if a.gemini == nil {
+		return fmt.Errorf("%s environment variable is not set", llm.APIKeyEnv(a.profile.LLM))
+	}
+	return nil
+}
+
+// printUsage reports the LLM requests and tokens used so far and records
+// them in the run result
+func (a *app) printUsage() {
+	if a.meter == nil {
+		return
+	}
+	if calls, usage := a.meter.Usage(); calls > 0 {
+		a.result.LLM = &usageResult{
+			Provider:     a.meter.Name(),
+			Requests:     calls,
+			InputTokens:  usage.InputTokens,
+			OutputTokens: usage.OutputTokens,
+		}
+		a.progress.Printf("%s: %d requests, %d input and %d output tokens\n", a.meter.Name(), calls, usage.InputTokens, usage.OutputTokens)
+	}
+}
+
+// run performs one full pass: recurring tasks, tasks from email and
+// meetings, prioritization and subtasks
+func (a *app) run(ctx context.Context) error {
+	return a.runLists(ctx, a.profile.TargetLists)
+}
+
+// runLists performs a full pass that ranks and breaks down only targetLists
+func (a *app) runLists(ctx context.Context, targetLists []string) error {
+	a.service.ResetCache()
+	if !a.replaying {
+		a.result = &runResult{DryRun: a.dryRun}
+	}
+	// Changes queued while offline go out first, so the run sees them
+	a.flushQueued(ctx)
+
+	// Lists the user can't read are reported and left out, so the others
+	// still run
+	targetLists, err := a.accessibleLists(targetLists)
+	if err != nil {
+		return err
+	}
+
+	// Wait for other zap processes changing the same lists
+	targetLists, unlock, err := a.lockLists(ctx, targetLists)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	defer a.reportConflicts()
+	defer a.reportQueued()
+
+	// Leave out work that doesn't fit in today's budget
+	targetLists, err = a.planBudget(targetLists)
+	if err != nil {
+		return err
+	}
+
+	// Materialize recurring tasks before prioritizing so new instances are ranked
+	recurring, err := recurrence.NewManager(a.service, a.orchestrator, a.store, a.profile.Recurring)
+	if err != nil {
+		return err
+	}
+	recurring.SetNamespace(a.namespace)
+	created, err := recurring.Materialize(ctx, targetLists)
+	if err != nil {
+		log.Printf("Error materializing recurring tasks: %v", err)
+		a.result.fail(fmt.Errorf("recurring tasks: %v", err))
+	} else if created > 0 {
+		a.result.RecurringCreated += created
+		a.progress.Printf("Created %d recurring task instances\n", created)
+	}
+
+	// Tasks whose snooze ended go back to their lists before ranking
+	woken, err := a.snoozer().Wake(ctx)
+	if err != nil {
+		log.Printf("Error waking snoozed tasks: %v", err)
+		a.result.fail(fmt.Errorf("snoozed tasks: %v", err))
+	}
+	if woken > 0 {
+		a.result.Woken += woken
+		a.progress.Printf("Woke %d snoozed tasks\n", woken)
+	}
+
+	// Starred or labelled mail becomes tasks before ranking, too
+	if a.profile.Gmail != nil {
+		fromEmail, err := a.ingestMail(ctx)
+		if err != nil {
+			log.Printf("Error turning email into tasks: %v", err)
+			a.result.fail(err)
+		}
+		if fromEmail > 0 {
+			a.result.FromEmail += fromEmail
+			a.progress.Printf("Created %d tasks from email\n", fromEmail)
+		}
 	}
-	defer geminiClient.Close()
 
-	// Create prioritizer
-	prioritizer := tasks.NewPrioritizer(service, geminiClient)
+	// Preparation tasks for upcoming meetings are ranked with the rest
+	if a.profile.Prep != nil && a.gemini != nil && !a.replaying {
+		prepared, err := a.prepareMeetings(ctx)
+		if err != nil {
+			log.Printf("Error preparing for meetings: %v", err)
+			a.result.fail(err)
+		}
+		if prepared > 0 {
+			a.result.PrepCreated += prepared
+			a.progress.Printf("Created %d tasks to prepare for meetings\n", prepared)
+		}
+	}
+
+	// Clean up titles before ranking, so the model ranks the clear ones
+	if a.profile.TitleCleanup && a.gemini != nil && !a.replaying {
+		cleaned, err := a.cleanTitles(ctx, targetLists)
+		switch {
+		case exitCode(err) == exitLLM:
+			log.Print(err)
+			a.result.failLLM(err)
+		case err != nil:
+			log.Print(err)
+			a.result.fail(err)
+		}
+		if cleaned > 0 {
+			a.result.TitlesCleaned += cleaned
+			a.progress.Printf("Cleaned up %d task titles\n", cleaned)
+		}
+	}
+
+	// Create prioritizer; without Gemini tasks are ranked heuristically
+	rankWith := a.gemini
+	if a.profile.Prioritizer == config.PrioritizerHeuristic {
+		rankWith = nil
+	}
+
+	// An experiment's variant ranks in shadow until it is promoted, and
+	// instead of the profile's ranking after
+	if a.experiment != nil && !a.replaying {
+		a.promoted = a.rollout()
+	}
+	shadow := a.experiment != nil && !a.promoted
+	if a.experiment != nil && a.promoted {
+		rankWith = a.experiment.Variant()
+	}
+
+	// Rankings follow what the user taught zap in earlier reviews
+	if a.gemini != nil && (rankWith != nil || shadow) && !a.replaying {
+		preferences, err := prefs.New(a.store, a.clock, a.dryRun).Summarize(ctx, a.gemini)
+		if err != nil {
+			log.Printf("Error updating learned preferences: %v", err)
+		}
+		a.gemini.SetPreferences(preferences)
+		if a.experiment != nil && a.experiment.Variant() != nil {
+			a.experiment.Variant().SetPreferences(preferences)
+		}
+	}
+	prioritizer := tasks.NewPrioritizer(a.service, rankWith, a.orchestrator, a.clock)
+	prioritizer.SetHistory(tasks.NewHistory(a.store, a.dryRun))
+	prioritizer.SetTimeLog(a.timeLog(a.dryRun))
+	prioritizer.SetPinned(a.profile.Pinned)
+	prioritizer.SetProgress(a.progress)
+	prioritizer.SetSubtaskOrder(a.subtaskOrder)
+	prioritizer.SetNoteLog(a.noteLog)
+	prioritizer.SetNamespace(a.namespace)
+	prioritizer.SetFilter(a.filter)
+	if a.review != nil {
+		prioritizer.SetReview(a.review)
+	}
+	// Dry runs show what the run would change; replays only check it
+	prioritizer.SetDiff((a.diff || a.dryRun) && !a.replaying)
+	if a.suggestOnly != "" {
+		prioritizer.SetSuggestOnly(a.suggestOnly)
+	}
+	if a.profile.Escalation != nil {
+		prioritizer.SetEscalation(a.escalationPolicy())
+	}
+	if a.profile.WIP != nil {
+		prioritizer.SetWIP(&tasks.WIPPolicy{Limits: a.profile.WIP.Limits, Overflow: a.profile.WIP.Overflow})
+	}
+	if a.profile.Stability != nil {
+		prioritizer.SetStability(&tasks.StabilityPolicy{MinMove: a.profile.Stability.MinMove, Margin: a.profile.Stability.Margin})
+	}
+	if a.replaying {
+		prioritizer.SetReplay(a.ranked)
+	}
+	if shadow {
+		prioritizer.SetShadow(a.shadow)
+	}
 
 	// Prioritize tasks in Backlog and In Progress lists
-	targetLists := []string{"Backlog", "In Progress"}
-	fmt.Printf("Analyzing and prioritizing tasks in lists: %v\n", targetLists)
+	defer a.progress.Summary()
+	a.progress.Printf("Analyzing and prioritizing tasks in lists: %v\n", targetLists)
 
 	if err := prioritizer.ReorderTasksByPriority(ctx, targetLists); err != nil {
-		log.Fatal(err)
+		return err
+	}
+	a.ranked = prioritizer.Ranked()
+	if !a.replaying {
+		a.result.Lists = prioritizer.Results()
+	}
+	a.exportReport(ctx, prioritizer.Results())
+	// Mirror the lists once their subtasks are created too
+	defer a.mirrorCalDAV(ctx, targetLists)
+	for _, list := range prioritizer.Results() {
+		if list.LLMError != "" {
+			a.result.failLLM(fmt.Errorf("ranking %s: %s", list.Title, list.LLMError))
+		}
 	}
 
-	fmt.Println("\nTask prioritization completed successfully!")
+	if a.gemini == nil {
+		a.progress.Printf("%s is not set; skipping subtask creation.\n", llm.APIKeyEnv(a.profile.LLM))
+		return nil
+	}
+	defer a.printUsage()
 
 	// Automatically create subtasks for tasks in target lists
-	fmt.Printf("\nAnalyzing and creating subtasks for tasks in lists: %v\n", targetLists)
+	a.progress.Expect(progress.Subtasks, len(targetLists)-len(a.skipSubtasks))
 	for _, listTitle := range targetLists {
-		taskList, err := service.GetTaskListByTitle(listTitle)
-		if err != nil {
-			log.Printf("Error finding task list %s: %v", listTitle, err)
+		if a.skipSubtasks[listTitle] {
 			continue
 		}
+		done := a.progress.Begin(progress.Subtasks, listTitle)
+		created, err := a.createSubtasks(ctx, listTitle)
+		done()
 
-		tasks, err := service.ListTasks(taskList.Id)
+		result := subtaskResult{List: listTitle, Created: created}
 		if err != nil {
-			log.Printf("Error fetching tasks for list %s: %v", listTitle, err)
-			continue
+			log.Print(err)
+			result.Error = err.Error()
+			if exitCode(err) == exitLLM {
+				a.result.failLLM(err)
+			} else {
+				a.result.fail(err)
+			}
+		}
+		if !a.replaying {
+			a.result.Subtasks = append(a.result.Subtasks, result)
 		}
+	}
+	return nil
+}
+
+// breakDownList creates subtasks in one list without ranking it, within
+// the budget like a run
+func (a *app) breakDownList(ctx context.Context, listTitle string) error {
+	a.service.ResetCache()
+	a.result = &runResult{DryRun: a.dryRun}
+	if err := a.requireGemini(); err != nil {
+		return err
+	}
+	a.flushQueued(ctx)
+
+	lists, err := a.accessibleLists([]string{listTitle})
+	if err != nil {
+		return err
+	}
+	lists, unlock, err := a.lockLists(ctx, lists)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	defer a.reportConflicts()
+	defer a.reportQueued()
+	if lists, err = a.planBudget(lists); err != nil {
+		return err
+	}
+	if len(lists) == 0 || a.skipSubtasks[listTitle] {
+		return nil
+	}
+	defer a.printUsage()
+
+	created, err := a.createSubtasks(ctx, listTitle)
+	result := subtaskResult{List: listTitle, Created: created}
+	if err != nil {
+		log.Print(err)
+		result.Error = err.Error()
+		if exitCode(err) == exitLLM {
+			a.result.failLLM(err)
+		} else {
+			a.result.fail(err)
+		}
+	}
+	a.result.Subtasks = append(a.result.Subtasks, result)
+	return nil
+}
 
-		// Skip if no tasks in the list
-		if len(tasks) == 0 {
-			fmt.Printf("No tasks found in list: %s\n", listTitle)
+// accessibleLists returns the lists of targetLists the user can read. The
+// others are recorded as warnings, with how to fix them, instead of failing
+// the run.
+func (a *app) accessibleLists(targetLists []string) ([]string, error) {
+	var accessible []string
+	for _, listTitle := range targetLists {
+		problem, err := a.service.CheckAccess(listTitle)
+		if err != nil {
+			return nil, fmt.Errorf("error reading task list %s: %w", listTitle, err)
+		}
+		if problem == nil {
+			accessible = append(accessible, listTitle)
 			continue
 		}
+		a.progress.Printf("Leaving out list %s, which can't be read: %s\n  fix: %s\n", listTitle, problem.Problem, problem.Fix)
+		if !a.replaying {
+			a.result.Warnings = append(a.result.Warnings, *problem)
+		}
+	}
+	return accessible, nil
+}
 
-		// Count top-level tasks and tasks with subtasks
-		topLevelCount := 0
-		hasSubtasksCount := 0
-		for _, task := range tasks {
-			if task.Parent == "" {
-				topLevelCount++
-				// Check if this task has any subtasks
-				for _, t := range tasks {
-					if t.Parent == task.Id {
-						hasSubtasksCount++
-						break
-					}
-				}
-			}
+// createSubtasks asks the model to break down the tasks in a list that
+// have no subtasks yet and creates its suggestions. It returns how many
+// subtasks were created; model failures carry exitLLM.
+func (a *app) createSubtasks(ctx context.Context, listTitle string) (int, error) {
+	taskList, err := a.service.GetTaskListByTitle(listTitle)
+	if err != nil {
+		return 0, fmt.Errorf("error finding task list %s: %w", listTitle, err)
+	}
+
+	listTasks, err := a.service.ListTasks(taskList.ID)
+	if err != nil {
+		return 0, fmt.Errorf("error fetching tasks for list %s: %w", listTitle, err)
+	}
+
+	// Excluded tasks are never broken down
+	listTasks = a.filter.Keep(listTasks)
+
+	// Skip if no tasks in the list
+	if len(listTasks) == 0 {
+		a.progress.Printf("No tasks found in list: %s\n", listTitle)
+		return 0, nil
+	}
+
+	// When replaying, tasks the model was already asked about keep the
+	// earlier answer instead of being asked again
+	if a.replaying {
+		listTasks = withoutAsked(listTasks, a.subtasksAsked)
+	} else {
+		a.recordAsked(tasks.NewTaskTree(listTasks))
+	}
+
+	// Ask Gemini for subtasks and apply them through the orchestrator
+	suggestions, err := a.gemini.SuggestSubtasks(ctx, listTasks, a.recentlyCompleted(ctx, taskList), a.breakdown(listTitle))
+	if errors.Is(err, gemini.ErrNoSubtasksNeeded) {
+		a.progress.Printf("All tasks in list '%s' already have subtasks\n", listTitle)
+		return 0, nil
+	}
+	if err != nil {
+		return 0, &exitError{code: exitLLM, err: fmt.Errorf("error suggesting subtasks for list %s: %v", listTitle, err)}
+	}
+	results, err := a.orchestrator.Apply(ctx, tasks.SubtaskMutations(taskList.ID, listTasks, suggestions))
+	created := 0
+	for _, result := range results {
+		if result.Err == nil {
+			created++
 		}
+	}
+	if err != nil {
+		return created, fmt.Errorf("error creating subtasks for list %s: %w", listTitle, err)
+	}
+	a.progress.Printf("Created %d subtasks in list: %s\n", created, listTitle)
+	return created, nil
+}
 
-		fmt.Printf("\nIn list '%s':\n", listTitle)
-		fmt.Printf("- Found %d top-level tasks\n", topLevelCount)
-		fmt.Printf("- %d tasks already have subtasks\n", hasSubtasksCount)
-		fmt.Printf("- Will generate subtasks for %d tasks\n", topLevelCount-hasSubtasksCount)
+// recentlyCompleted returns the tasks in a list completed within the
+// profile's subtasks completed_days, for context when breaking tasks down.
+// Failing to fetch them only costs the context.
+func (a *app) recentlyCompleted(ctx context.Context, taskList *todo.TaskList) []*todo.Task {
+	days := a.profile.Subtasks.CompletedDays
+	if days == 0 {
+		return nil
+	}
+	completed, err := a.service.ListCompletedSince(ctx, taskList.ID, a.clock.Now().AddDate(0, 0, -days))
+	if err != nil {
+		log.Printf("Error fetching completed tasks for list %s, breaking down without them: %v", taskList.Title, err)
+		return nil
+	}
+	return a.filter.Keep(completed)
+}
+
+// breakdown returns how the profile breaks down the tasks in a list
+func (a *app) breakdown(listTitle string) gemini.Breakdown {
+	b := a.profile.Subtasks.For(listTitle)
+	return gemini.Breakdown{Min: b.Min, Max: b.Max, Granularity: b.Granularity}
+}
+
+// auditBucket holds the audit log's pseudonymization key
+const auditBucket = "audit"
 
-		// Create subtasks using Gemini
-		err = geminiClient.AnalyzeAndCreateSubtasks(ctx, taskList.Id, tasks)
+// openAuditLog creates the audit log for a profile. The pseudonymization
+// key is generated once and kept in the state file so pseudonyms stay
+// stable across runs.
+func openAuditLog(cfg *config.Audit, st *store.Store) (*audit.Log, error) {
+	var key []byte
+	if cfg.Pseudonymize {
+		var encoded string
+		found, err := st.Get(auditBucket, "pseudonym-key", &encoded)
 		if err != nil {
-			if err.Error() == "no tasks found that need subtasks" {
-				fmt.Printf("All tasks in list '%s' already have subtasks. Skipping.\n", listTitle)
-				continue
+			return nil, err
+		}
+		if found {
+			key, err = hex.DecodeString(encoded)
+			if err != nil {
+				return nil, fmt.Errorf("invalid audit pseudonym key: %v", err)
+			}
+		} else {
+			key = make([]byte, 32)
+			if _, err := rand.Read(key); err != nil {
+				return nil, fmt.Errorf("unable to generate audit pseudonym key: %v", err)
+			}
+			if err := st.Put(auditBucket, "pseudonym-key", hex.EncodeToString(key)); err != nil {
+				return nil, err
 			}
-			log.Printf("Error creating subtasks for list %s: %v", listTitle, err)
-			continue
 		}
-		fmt.Printf("Successfully created subtasks for list: %s\n", listTitle)
 	}
+	return audit.NewLog(cfg.Path, int64(cfg.MaxSizeMB)<<20, cfg.MaxFiles, key), nil
+}
 
-	fmt.Println("\nSubtask creation completed successfully!")
+// newProvider creates the profile's backend, or returns nil for Google
+// Tasks. Credentials not in the profile come from the environment.
+func newProvider(profile *config.Profile) (backend.Provider, error) {
+	switch profile.Backend {
+	case config.BackendTrello:
+		key, token := profile.Trello.Key, profile.Trello.Token
+		if key == "" {
+			key = config.Getenv("TRELLO_API_KEY")
+		}
+		if token == "" {
+			token = config.Getenv("TRELLO_TOKEN")
+		}
+		if key == "" || token == "" {
+			return nil, fmt.Errorf("the trello backend needs trello.key and trello.token in the profile, or TRELLO_API_KEY and TRELLO_TOKEN")
+		}
+		return trello.New(profile.Trello.Board, key, token), nil
+	case config.BackendAsana:
+		token := profile.Asana.Token
+		if token == "" {
+			token = config.Getenv("ASANA_TOKEN")
+		}
+		if token == "" {
+			return nil, fmt.Errorf("the asana backend needs asana.token in the profile, or ASANA_TOKEN")
+		}
+		return asana.New(token, profile.Asana.Workspace, profile.Asana.Projects, profile.Asana.MyTasks, profile.Asana.PriorityField), nil
+	case config.BackendGitHub:
+		token := profile.GitHub.Token
+		if token == "" {
+			token = config.Getenv("GITHUB_TOKEN")
+		}
+		if token == "" {
+			return nil, fmt.Errorf("the github backend needs github.token in the profile, or GITHUB_TOKEN")
+		}
+		return github.New(profile.GitHub.Repo, profile.GitHub.Assignee, profile.GitHub.Labels, token), nil
+	case config.BackendFiles:
+		if _, err := os.Stat(profile.Files.Path); err != nil {
+			return nil, fmt.Errorf("files backend: %v", err)
+		}
+		return files.New(profile.Files.Path), nil
+	}
+	return nil, nil
+}
 
-	// Display updated task lists
-	taskLists, err := service.ListTaskLists()
+// createTasksClient authenticates according to the profile's auth mode and
+// refuses to continue when the granted scopes don't allow the requested work
+func createTasksClient(ctx context.Context, profile *config.Profile, scopes []string, userEmail string, readOnly bool) (*tasksapi.Service, error) {
+	ctx, err := httpContext(ctx, profile)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := newProvider(profile)
+	if err != nil {
+		return nil, err
+	}
+	if provider != nil {
+		return backend.Service(ctx, provider)
+	}
+	if profile.Auth == config.AuthOAuth {
+		oauthConfig, err := auth.NewOAuthConfig(profile.ClientSecret, scopes...)
+		if err != nil {
+			return nil, err
+		}
+		token, err := auth.LoadToken(profile.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		if token.ReadOnly() && !readOnly {
+			return nil, fmt.Errorf("%w: the cached login only grants %v; run 'zap login' again or pass --read-only",
+				auth.ErrInsufficientScope, token.Scopes)
+		}
+		return oauthConfig.CreateClient(ctx, token, profile.TokenFile)
+	}
+
+	// Initialize service account configuration
+	authConfig, err := auth.NewConfig(profile.Credentials, scopes...)
+	if err != nil {
+		return nil, err
+	}
+	if authConfig.ReadOnly() && !readOnly {
+		return nil, fmt.Errorf("scopes %v do not allow writes; add %s or pass --read-only", authConfig.Scopes(), auth.ScopeTasks)
+	}
+
+	// Delegation is checked for everything the run does before any of it,
+	// and the clients for the user reuse the token the check got
+	if err := authConfig.Preflight(ctx, userEmail, delegatedScopes(authConfig, profile)...); err != nil {
+		return nil, err
+	}
+	return authConfig.CreateClientAsUser(ctx, userEmail)
+}
+
+// delegatedScopes returns the Tasks scopes and those the profile's features
+// act for the user with
+func delegatedScopes(authConfig *auth.Config, profile *config.Profile) []string {
+	scopes := append([]string{}, authConfig.Scopes()...)
+	if profile.Sheets != nil {
+		scopes = append(scopes, auth.ScopeSheets)
+	}
+	if profile.Calendar != nil || profile.Prep != nil {
+		scopes = append(scopes, auth.ScopeCalendarReadonly)
+	}
+	if profile.Gmail != nil {
+		scopes = append(scopes, auth.ScopeGmailReadonly)
+	}
+	return scopes
+}
+
+// configFlagUsage describes the --config flag, which every command shares
+const configFlagUsage = "Path to the config file (default: ./zap.yaml if it exists, else zap.yaml in the user config directory)"
+
+// loadConfig finds and reads the config file, returning it with its path
+// and the platform directories
+func loadConfig(flags *flag.FlagSet, configPath string) (*config.Config, string, paths.Dirs) {
+	cfg, path, dirs, err := findConfig(flags, configPath)
 	if err != nil {
 		log.Fatal(err)
 	}
+	return cfg, path, dirs
+}
 
-	if len(taskLists) == 0 {
-		fmt.Println("No task lists found.")
-		return
+// findConfig is loadConfig without exiting on errors. Without --config or
+// ZAP_CONFIG, ./zap.yaml is used if it exists, then the user config
+// directory; if neither exists the config comes from the environment.
+func findConfig(flags *flag.FlagSet, configPath string) (*config.Config, string, paths.Dirs, error) {
+	dirs, err := paths.Default()
+	if err != nil {
+		return nil, "", dirs, err
+	}
+	if err := dirs.Ensure(); err != nil {
+		return nil, "", dirs, err
+	}
+
+	explicit := isFlagSet(flags, "config") || os.Getenv(config.EnvConfig) != ""
+	if configPath == "" {
+		configPath = os.Getenv(config.EnvConfig)
+	}
+	if configPath == "" {
+		configPath = paths.Prefer(paths.ConfigFileName, dirs.ConfigFile())
+	}
+	cfg, err := config.Load(configPath, dirs)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		cfg, err = config.FromEnv(dirs)
 	}
+	if err == nil {
+		err = checkConfig(cfg)
+	}
+	return cfg, configPath, dirs, err
+}
+
+// loadProfile reads the config file and selects a profile
+func loadProfile(flags *flag.FlagSet, configPath, profileName string) *config.Profile {
+	cfg, _, _ := loadConfig(flags, configPath)
+	profile, err := cfg.Profile(profileName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return profile
+}
+
+// isFlagSet reports whether a flag was passed explicitly on the command line
+func isFlagSet(flags *flag.FlagSet, name string) bool {
+	set := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
 }
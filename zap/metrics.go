@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"zap/config"
+	"zap/network"
+	"zap/throttle"
+)
+
+// apiLimiter paces every run's requests to the Tasks API and the LLM
+// provider, so that when any of them is rate limited all of them slow down
+var apiLimiter = throttle.New(throttle.DefaultRate)
+
+// httpContext returns ctx carrying the HTTP client that Google API and LLM
+// clients created with it send their requests through: over the network as
+// the profile's http settings say, paced by apiLimiter
+func httpContext(ctx context.Context, profile *config.Profile) (context.Context, error) {
+	base, err := network.Transport(profile.HTTP)
+	if err != nil {
+		return nil, fmt.Errorf("profile http: %v", err)
+	}
+	client := &http.Client{Transport: apiLimiter.Transport(base)}
+	return context.WithValue(ctx, oauth2.HTTPClient, client), nil
+}
+
+// serveMetrics answers with the state of apiLimiter in Prometheus' text
+// format
+func serveMetrics(w http.ResponseWriter, r *http.Request) {
+	stats := apiLimiter.Stats()
+	var paused float64
+	if !stats.Paused.IsZero() {
+		paused = time.Until(stats.Paused).Seconds()
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	metric := func(name, kind, help string, value float64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %g\n", name, help, name, kind, name, value)
+	}
+	metric("zap_api_rate", "gauge", "Requests per second currently allowed to the Tasks API and the LLM provider.", stats.Rate)
+	metric("zap_api_rate_full", "gauge", "Requests per second allowed when nothing is rate limited.", stats.FullRate)
+	metric("zap_api_paused_seconds", "gauge", "Seconds until requests start again after an API asked to wait.", paused)
+	metric("zap_api_requests_total", "counter", "Requests sent to the Tasks API and the LLM provider.", float64(stats.Requests))
+	metric("zap_api_rate_limited_total", "counter", "Requests refused for going too fast.", float64(stats.Limited))
+	metric("zap_api_wait_seconds_total", "counter", "Time requests waited for their turn.", stats.Waited.Seconds())
+}
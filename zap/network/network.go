@@ -0,0 +1,74 @@
+// Package network builds the HTTP transport zap reaches Google APIs and
+// hosted LLM providers with, from a profile's http settings
+package network
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+
+	"zap/config"
+)
+
+// Transport returns a transport going through the proxy and trusting the
+// certificates cfg names, that gives up on requests not answered within its
+// timeout. Without settings it is Go's default transport, which takes its
+// proxy from the environment.
+func Transport(cfg *config.HTTP) (http.RoundTripper, error) {
+	if cfg == nil || (cfg.Proxy == "" && len(cfg.NoProxy) == 0 && cfg.CABundle == "" && cfg.Timeout == 0) {
+		return http.DefaultTransport, nil
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	proxy := httpproxy.FromEnvironment()
+	if cfg.Proxy != "" {
+		proxy.HTTPProxy = cfg.Proxy
+		proxy.HTTPSProxy = cfg.Proxy
+	}
+	if len(cfg.NoProxy) > 0 {
+		hosts := cfg.NoProxy
+		if proxy.NoProxy != "" {
+			hosts = append([]string{proxy.NoProxy}, hosts...)
+		}
+		proxy.NoProxy = strings.Join(hosts, ",")
+	}
+	proxyFunc := proxy.ProxyFunc()
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}
+
+	if cfg.CABundle != "" {
+		pool, err := certPool(cfg.CABundle)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	// LLM providers answer once they have generated all of their answer, so
+	// this bounds their requests as a whole
+	transport.ResponseHeaderTimeout = cfg.Timeout
+	return transport, nil
+}
+
+// certPool returns the system's certificates with those of the PEM file at
+// path added
+func certPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read CA bundle: %v", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("CA bundle %s holds no PEM certificates", path)
+	}
+	return pool, nil
+}
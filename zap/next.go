@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"zap/auth"
+	"zap/config"
+	"zap/gemini"
+	"zap/tags"
+	"zap/tasks"
+	"zap/todo"
+
+	calendarapi "google.golang.org/api/calendar/v3"
+)
+
+// runNext asks the model for the one task to work on right now and prints
+// it with a short plan
+func runNext(args []string) {
+	flags := flag.NewFlagSet("next", flag.ExitOnError)
+	runOpts := registerRunFlags(flags)
+	var listTitles listFlag
+	flags.Var(&listTitles, "list", "Task list to pick from (repeatable; default: the profile's target lists)")
+	flags.Parse(args)
+	// Picking a task never changes anything
+	*runOpts.readOnly = true
+
+	ctx := context.Background()
+	app, err := runOpts.newApp(ctx, flags)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer app.Close()
+	if err := app.requireGemini(); err != nil {
+		log.Fatal(err)
+	}
+	if len(listTitles) == 0 {
+		listTitles = app.profile.TargetLists
+	}
+
+	if err := app.next(ctx, listTitles); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// next gathers the open top-level tasks of the lists and the rest of the
+// day's events, and prints the model's pick
+func (a *app) next(ctx context.Context, listTitles []string) error {
+	pick, err := a.nextAction(ctx, listTitles)
+	if err != nil {
+		return err
+	}
+	fmt.Print(pick)
+	return nil
+}
+
+// nextAction returns the model's pick among the open top-level tasks of the
+// lists, with why and how to begin, as lines of text
+func (a *app) nextAction(ctx context.Context, listTitles []string) (string, error) {
+	timeLog := a.timeLog(true)
+	var candidates []gemini.Candidate
+	for _, listTitle := range listTitles {
+		taskList, err := a.service.GetTaskListByTitle(listTitle)
+		if err != nil {
+			return "", fmt.Errorf("error finding task list %s: %w", listTitle, err)
+		}
+		listTasks, err := a.service.ListTasks(taskList.ID)
+		if err != nil {
+			return "", fmt.Errorf("error fetching tasks for list %s: %w", listTitle, err)
+		}
+		tree := tasks.NewTaskTree(listTasks)
+		for _, task := range tree.TopLevel() {
+			if task.Parent != "" || task.Status == "completed" || tags.Has(task, tags.Waiting) || a.filter.Excludes(task) {
+				continue
+			}
+			candidate := gemini.Candidate{Task: task, List: taskList.Title}
+			for _, subtask := range tree.Children(task.ID) {
+				if subtask.Status != "completed" {
+					candidate.Subtasks = append(candidate.Subtasks, subtask)
+				}
+			}
+			candidates = append(candidates, candidate)
+		}
+	}
+	efforts, err := timeLog.Efforts(taskPointers(candidates))
+	if err != nil {
+		log.Printf("Error reading tracked time: %v", err)
+	}
+	for i := range candidates {
+		candidates[i].Effort = efforts[candidates[i].Task.ID]
+	}
+	if len(candidates) == 0 {
+		return "Nothing to do: no open tasks\n", nil
+	}
+
+	// Without the calendar the pick only goes by due dates and time of day
+	var events []gemini.Event
+	if a.profile.Calendar != nil {
+		events, err = a.todaysEvents(ctx)
+		if err != nil {
+			log.Printf("Error reading today's events, picking without them: %v", err)
+		}
+	}
+
+	next, err := a.gemini.PickNextAction(ctx, candidates, events, a.clock)
+	if err != nil {
+		return "", &exitError{code: exitLLM, err: fmt.Errorf("error picking the next task: %v", err)}
+	}
+
+	var pick strings.Builder
+	for _, candidate := range candidates {
+		if candidate.Task.ID != next.TaskID {
+			continue
+		}
+		fmt.Fprintf(&pick, "Next: %s (%s", candidate.Task.Title, candidate.List)
+		if day, ok := a.clock.ParseDue(candidate.Task.Due); ok {
+			fmt.Fprintf(&pick, ", due %s", day.Format("Mon 2006-01-02"))
+		}
+		fmt.Fprintln(&pick, ")")
+	}
+	if next.Reason != "" {
+		fmt.Fprintf(&pick, "Why: %s\n", next.Reason)
+	}
+	for i, step := range next.Steps {
+		fmt.Fprintf(&pick, "  %d. %s\n", i+1, step)
+	}
+	return pick.String(), nil
+}
+
+// taskPointers returns the candidates' tasks
+func taskPointers(candidates []gemini.Candidate) []*todo.Task {
+	out := make([]*todo.Task, len(candidates))
+	for i, candidate := range candidates {
+		out[i] = candidate.Task
+	}
+	return out
+}
+
+// todaysEvents lists the events left between now and midnight in the
+// profile's calendar. Events marked free and ones the user declined don't
+// take up time and are left out.
+func (a *app) todaysEvents(ctx context.Context) ([]gemini.Event, error) {
+	service, err := createCalendarClient(ctx, a.profile, a.userEmail)
+	if err != nil {
+		return nil, err
+	}
+	now := a.clock.Now()
+	midnight := a.clock.Today().AddDate(0, 0, 1)
+	list, err := service.Events.List(a.profile.Calendar.ID).Context(ctx).
+		TimeMin(now.Format(time.RFC3339)).
+		TimeMax(midnight.Format(time.RFC3339)).
+		SingleEvents(true).
+		OrderBy("startTime").
+		Do()
+	if err != nil {
+		return nil, err
+	}
+
+	var events []gemini.Event
+	for _, item := range list.Items {
+		if item.Status == "cancelled" || item.Transparency == "transparent" || declined(item) {
+			continue
+		}
+		if item.Start == nil || item.End == nil {
+			continue
+		}
+		if item.Start.Date != "" {
+			events = append(events, gemini.Event{Title: item.Summary, AllDay: true})
+			continue
+		}
+		start, err := time.Parse(time.RFC3339, item.Start.DateTime)
+		if err != nil {
+			continue
+		}
+		end, err := time.Parse(time.RFC3339, item.End.DateTime)
+		if err != nil {
+			continue
+		}
+		events = append(events, gemini.Event{Title: item.Summary, Start: start, End: end})
+	}
+	return events, nil
+}
+
+// declined reports whether the user declined an event
+func declined(event *calendarapi.Event) bool {
+	for _, attendee := range event.Attendees {
+		if attendee.Self && attendee.ResponseStatus == "declined" {
+			return true
+		}
+	}
+	return false
+}
+
+// createCalendarClient authenticates to the Calendar API the same way the
+// Tasks client does: as the signed-in user or by impersonating userEmail
+func createCalendarClient(ctx context.Context, profile *config.Profile, userEmail string) (*calendarapi.Service, error) {
+	ctx, err := httpContext(ctx, profile)
+	if err != nil {
+		return nil, err
+	}
+	if profile.Auth == config.AuthOAuth {
+		oauthConfig, err := auth.NewOAuthConfig(profile.ClientSecret, profile.Scopes...)
+		if err != nil {
+			return nil, err
+		}
+		token, err := auth.LoadToken(profile.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		return oauthConfig.CreateCalendarClient(ctx, token, profile.TokenFile)
+	}
+
+	authConfig, err := auth.NewConfig(profile.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	return authConfig.CreateCalendarClientAsUser(ctx, userEmail)
+}
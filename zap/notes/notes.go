@@ -0,0 +1,208 @@
+package notes
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Kind is what a zap note records
+type Kind string
+
+const (
+	// Priority notes record a task moving to a new rank
+	Priority Kind = "priority"
+	// Escalation notes record an overdue task being escalated
+	Escalation Kind = "escalation"
+	// Snooze notes record a task being snoozed or woken
+	Snooze Kind = "snooze"
+	// Time notes record the time worked on a task, written by 'zap stop'
+	Time Kind = "time"
+)
+
+// ParseKind validates a note kind name
+func ParseKind(name string) (Kind, error) {
+	switch k := Kind(name); k {
+	case Priority, Escalation, Snooze:
+		return k, nil
+	}
+	return "", fmt.Errorf("unknown note kind %q (want %s, %s or %s)", name, Priority, Escalation, Snooze)
+}
+
+// MaxEntries bounds the entries kept in a task's notes; the oldest are
+// dropped first. Google Tasks limits notes to 8192 characters.
+const MaxEntries = 20
+
+const (
+	// fence opens, followed by the namespace, and closes the block zap owns
+	// in the notes
+	fence      = "```"
+	timeLayout = "2006-01-02 15:04"
+)
+
+// DefaultNamespace is the namespace zap writes under unless the profile
+// picks another
+const DefaultNamespace Namespace = "zap"
+
+// namespacePattern is what a namespace may look like, so it can't break
+// out of a fence or a marker
+var namespacePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Namespace names the block zap owns in notes and prefixes the markers it
+// writes, such as [zap:#2]. Other tools writing their own blocks and
+// markers under other names, e.g. ```teambot or [teambot:...], are left
+// alone as part of the user's text. The zero value is DefaultNamespace.
+type Namespace string
+
+// ParseNamespace validates a namespace name; empty is DefaultNamespace
+func ParseNamespace(name string) (Namespace, error) {
+	if name == "" {
+		return DefaultNamespace, nil
+	}
+	if !namespacePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid namespace %q (want lowercase letters, digits, - and _)", name)
+	}
+	return Namespace(name), nil
+}
+
+// String returns the namespace's name
+func (ns Namespace) String() string {
+	if ns == "" {
+		return string(DefaultNamespace)
+	}
+	return string(ns)
+}
+
+// Marker returns a marker in the namespace, e.g. [zap:#2] for "#2"
+func (ns Namespace) Marker(text string) string {
+	return "[" + ns.String() + ":" + text + "]"
+}
+
+// Entry is one timestamped note. Lines in the block that zap didn't write
+// are kept as entries with only Text set.
+type Entry struct {
+	Time time.Time
+	Kind Kind
+	Text string
+}
+
+func (e Entry) String() string {
+	if e.Kind == "" {
+		return e.Text
+	}
+	return fmt.Sprintf("%s %s: %s", e.Time.Format(timeLayout), e.Kind, e.Text)
+}
+
+// Notes is a task's notes split into the user's own text and the entries
+// in zap's block
+type Notes struct {
+	User    string
+	Entries []Entry
+
+	namespace Namespace
+}
+
+// Parse splits notes into the user's text and the entries of the block in
+// the namespace. Text before and after the block is the user's, including
+// fenced blocks of other namespaces; an unterminated block runs to the end.
+func (ns Namespace) Parse(text string) Notes {
+	lines := strings.Split(text, "\n")
+	start := -1
+	// Fences inside other blocks, e.g. another tool's, aren't zap's
+	inBlock := false
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == fence+ns.String() && !inBlock {
+			start = i
+			break
+		}
+		if strings.HasPrefix(line, fence) {
+			inBlock = !inBlock
+		}
+	}
+	if start < 0 {
+		return Notes{User: text, namespace: ns}
+	}
+	end := len(lines)
+	for i := start + 1; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == fence {
+			end = i
+			break
+		}
+	}
+
+	n := Notes{namespace: ns}
+	for _, line := range lines[start+1 : end] {
+		if strings.TrimSpace(line) != "" {
+			n.Entries = append(n.Entries, parseEntry(line))
+		}
+	}
+	before := strings.TrimRight(strings.Join(lines[:start], "\n"), "\n")
+	var after string
+	if end < len(lines) {
+		after = strings.TrimLeft(strings.Join(lines[end+1:], "\n"), "\n")
+	}
+	switch {
+	case before == "":
+		n.User = after
+	case after == "":
+		n.User = before
+	default:
+		n.User = before + "\n" + after
+	}
+	return n
+}
+
+// parseEntry reads a line written by Entry.String
+func parseEntry(line string) Entry {
+	if len(line) > len(timeLayout) {
+		at, err := time.Parse(timeLayout, line[:len(timeLayout)])
+		kind, text, ok := strings.Cut(line[len(timeLayout)+1:], ": ")
+		if err == nil && ok && kind != "" {
+			return Entry{Time: at, Kind: Kind(kind), Text: text}
+		}
+	}
+	return Entry{Text: line}
+}
+
+// String renders the notes with zap's block after the user's text
+func (n Notes) String() string {
+	if len(n.Entries) == 0 {
+		return n.User
+	}
+	var b strings.Builder
+	if n.User != "" {
+		b.WriteString(strings.TrimRight(n.User, "\n"))
+		b.WriteString("\n\n")
+	}
+	b.WriteString(fence + n.namespace.String() + "\n")
+	for _, entry := range n.Entries {
+		b.WriteString(entry.String() + "\n")
+	}
+	b.WriteString(fence)
+	return b.String()
+}
+
+// Add appends an entry, dropping the oldest beyond MaxEntries. Entries
+// are kept on one line each.
+func (n *Notes) Add(entry Entry) {
+	entry.Text = strings.Join(strings.Fields(entry.Text), " ")
+	n.Entries = append(n.Entries, entry)
+	if len(n.Entries) > MaxEntries {
+		n.Entries = n.Entries[len(n.Entries)-MaxEntries:]
+	}
+}
+
+// Append returns text with entry added to the namespace's block, leaving
+// the user's text as it was
+func (ns Namespace) Append(text string, entry Entry) string {
+	n := ns.Parse(text)
+	n.Add(entry)
+	return n.String()
+}
+
+// User returns text without the namespace's block
+func (ns Namespace) User(text string) string {
+	return ns.Parse(text).User
+}
@@ -0,0 +1,87 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Message is a notification about a task
+type Message struct {
+	Title string
+	Body  string
+}
+
+// Notifier delivers messages to the user
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+// New returns a webhook notifier when url is set, otherwise one that writes
+// to out
+func New(url string, out io.Writer) Notifier {
+	if url != "" {
+		return NewWebhook(url)
+	}
+	return NewWriter(out)
+}
+
+// Writer prints messages, e.g. to the daemon's log
+type Writer struct {
+	out io.Writer
+}
+
+// NewWriter creates a notifier that writes to out
+func NewWriter(out io.Writer) *Writer {
+	return &Writer{out: out}
+}
+
+// Notify prints the message
+func (w *Writer) Notify(ctx context.Context, msg Message) error {
+	_, err := fmt.Fprintf(w.out, "🔔 %s\n   %s\n", msg.Title, msg.Body)
+	return err
+}
+
+// Webhook posts messages as JSON with a "text" field, the payload Slack,
+// Google Chat and Discord-compatible incoming webhooks accept
+type Webhook struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhook creates a notifier that posts to url
+func NewWebhook(url string) *Webhook {
+	return &Webhook{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Notify posts the message to the webhook
+func (w *Webhook) Notify(ctx context.Context, msg Message) error {
+	payload, err := json.Marshal(map[string]string{
+		"text":    fmt.Sprintf("*%s*\n%s", msg.Title, msg.Body),
+		"content": fmt.Sprintf("**%s**\n%s", msg.Title, msg.Body),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to encode notification: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("unable to create notification request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to send notification: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("notification webhook returned %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
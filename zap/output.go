@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"zap/auth"
+	"zap/tasks"
+)
+
+// Exit codes, so wrapping scripts and cron jobs can tell failures apart
+const (
+	exitOK      = 0
+	exitFailure = 1
+	// exitPartial means the run finished but some lists or steps failed, or
+	// lists the user can't read were left out
+	exitPartial = 2
+	// exitAuth means zap couldn't sign in or wasn't allowed to access tasks
+	exitAuth = 3
+	// exitLLM means the model failed; rankings fell back to the heuristic
+	exitLLM = 4
+	// exitBudget means the run would have gone over the daily budget
+	exitBudget = 5
+)
+
+// Output formats for --output
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// exitError attaches an exit code to an error
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// exitCode picks the exit code for an error that stopped the run
+func exitCode(err error) int {
+	var e *exitError
+	if errors.As(err, &e) {
+		return e.code
+	}
+	if auth.IsAuthError(err) {
+		return exitAuth
+	}
+	return exitFailure
+}
+
+// runResult is the outcome of a run, printed on stdout by --output json
+type runResult struct {
+	DryRun           bool                  `json:"dryRun"`
+	Lists            []tasks.ListResult    `json:"lists"`
+	Subtasks         []subtaskResult       `json:"subtasks,omitempty"`
+	RecurringCreated int                   `json:"recurringCreated"`
+	Woken            int                   `json:"woken,omitempty"`
+	FromEmail        int                   `json:"fromEmail,omitempty"`
+	PrepCreated      int                   `json:"prepCreated,omitempty"`
+	TitlesCleaned    int                   `json:"titlesCleaned,omitempty"`
+	Skipped          []string              `json:"skipped,omitempty"`
+	Conflicts        []string              `json:"conflicts,omitempty"`
+	Queued           int                   `json:"queued,omitempty"`
+	Warnings         []tasks.AccessProblem `json:"warnings,omitempty"`
+	LLM              *usageResult          `json:"llm,omitempty"`
+	Errors           []string              `json:"errors,omitempty"`
+	ExitCode         int                   `json:"exitCode"`
+
+	llmFailed bool
+}
+
+// subtaskResult is the number of subtasks created in one list
+type subtaskResult struct {
+	List    string `json:"list"`
+	Created int    `json:"created"`
+	Error   string `json:"error,omitempty"`
+}
+
+// usageResult is the LLM usage of a run
+type usageResult struct {
+	Provider     string `json:"provider"`
+	Requests     int    `json:"requests"`
+	InputTokens  int    `json:"inputTokens"`
+	OutputTokens int    `json:"outputTokens"`
+}
+
+// fail records an error that didn't stop the run
+func (r *runResult) fail(err error) {
+	r.Errors = append(r.Errors, err.Error())
+}
+
+// failLLM records a model error that didn't stop the run
+func (r *runResult) failLLM(err error) {
+	r.fail(err)
+	r.llmFailed = true
+}
+
+// code returns the exit code for a run that finished
+func (r *runResult) code() int {
+	switch {
+	case r.llmFailed:
+		return exitLLM
+	case len(r.Errors) > 0 || len(r.Warnings) > 0 || r.Queued > 0:
+		return exitPartial
+	}
+	return exitOK
+}
+
+// exit reports the outcome of a run and exits with its code. err is the
+// error that stopped the run, if any.
+func exit(result *runResult, err error, format string) {
+	if result == nil {
+		result = &runResult{}
+	}
+	if result.Lists == nil {
+		result.Lists = []tasks.ListResult{}
+	}
+	result.ExitCode = result.code()
+	if err != nil {
+		result.fail(err)
+		result.ExitCode = exitCode(err)
+	}
+
+	if format == outputJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if encodeErr := encoder.Encode(result); encodeErr != nil {
+			log.Printf("Error encoding result: %v", encodeErr)
+		}
+	} else if err != nil {
+		log.Print(err)
+	} else if result.ExitCode != exitOK {
+		message := fmt.Sprintf("Finished with %d errors", len(result.Errors))
+		if len(result.Warnings) > 0 {
+			message += fmt.Sprintf(" and %d lists left out", len(result.Warnings))
+		}
+		fmt.Fprintln(os.Stderr, message)
+	}
+	os.Exit(result.ExitCode)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+)
+
+// runPaths prints where zap reads and writes its files
+func runPaths(args []string) {
+	flags := flag.NewFlagSet("paths", flag.ExitOnError)
+	configPath := flags.String("config", "", configFlagUsage)
+	profileName := flags.String("profile", "", "Config profile to show files for")
+	flags.Parse(args)
+
+	cfg, path, dirs := loadConfig(flags, *configPath)
+	profile, err := cfg.Profile(*profileName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "config file\t%s\n", describePath(path))
+	fmt.Fprintf(w, "config dir\t%s\n", dirs.Config)
+	fmt.Fprintf(w, "cache dir\t%s\n", dirs.Cache)
+	fmt.Fprintf(w, "state dir\t%s\n", dirs.State)
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "credentials\t%s\n", describePath(profile.Credentials))
+	fmt.Fprintf(w, "client secret\t%s\n", describePath(profile.ClientSecret))
+	fmt.Fprintf(w, "token\t%s\n", describePath(profile.TokenFile))
+	fmt.Fprintf(w, "state file\t%s\n", describePath(profile.StateFile))
+	fmt.Fprintf(w, "templates\t%s\n", describePath(profile.TemplateDir))
+	if profile.Audit != nil {
+		fmt.Fprintf(w, "audit log\t%s\n", describePath(profile.Audit.Path))
+	}
+	w.Flush()
+}
+
+// describePath notes when a path doesn't exist yet
+func describePath(path string) string {
+	if _, err := os.Stat(path); err != nil {
+		return path + " (missing)"
+	}
+	return path
+}
@@ -0,0 +1,116 @@
+package paths
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// appName is the directory zap uses inside each platform directory
+const appName = "zap"
+
+// ConfigFileName is the name of the config file
+const ConfigFileName = "zap.yaml"
+
+// Dirs are the directories zap keeps its files in
+type Dirs struct {
+	// Config holds zap.yaml, credentials and templates
+	Config string
+	// Cache holds OAuth tokens, which 'zap login' can recreate
+	Cache string
+	// State holds the state files with ranking history and audit logs
+	State string
+}
+
+// Environment variables that place each directory elsewhere, e.g. on the
+// volumes mounted into a container
+const (
+	EnvConfigDir = "ZAP_CONFIG_DIR"
+	EnvCacheDir  = "ZAP_CACHE_DIR"
+	EnvStateDir  = "ZAP_STATE_DIR"
+)
+
+// Default returns the platform's directories for zap, unless the
+// environment variables above set them:
+//
+//	Linux:   ~/.config/zap, ~/.cache/zap, ~/.local/state/zap (XDG variables are honored)
+//	macOS:   ~/Library/Application Support/zap, ~/Library/Caches/zap, ~/Library/Application Support/zap
+//	Windows: %AppData%\zap, %LocalAppData%\zap, %LocalAppData%\zap
+func Default() (Dirs, error) {
+	dirs := Dirs{
+		Config: os.Getenv(EnvConfigDir),
+		Cache:  os.Getenv(EnvCacheDir),
+		State:  os.Getenv(EnvStateDir),
+	}
+	if dirs.Config != "" && dirs.Cache != "" && dirs.State != "" {
+		return dirs, nil
+	}
+
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return Dirs{}, fmt.Errorf("unable to find the config directory (or set %s, %s and %s): %v", EnvConfigDir, EnvCacheDir, EnvStateDir, err)
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return Dirs{}, fmt.Errorf("unable to find the cache directory: %v", err)
+	}
+	stateDir, err := userStateDir(configDir, cacheDir)
+	if err != nil {
+		return Dirs{}, err
+	}
+	if dirs.Config == "" {
+		dirs.Config = filepath.Join(configDir, appName)
+	}
+	if dirs.Cache == "" {
+		dirs.Cache = filepath.Join(cacheDir, appName)
+	}
+	if dirs.State == "" {
+		dirs.State = filepath.Join(stateDir, appName)
+	}
+	return dirs, nil
+}
+
+// userStateDir returns the base directory for persistent state, which only
+// Unix-like systems other than macOS distinguish from config and cache
+func userStateDir(configDir, cacheDir string) (string, error) {
+	switch runtime.GOOS {
+	case "darwin", "ios":
+		return configDir, nil
+	case "windows", "plan9":
+		return cacheDir, nil
+	}
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" && filepath.IsAbs(dir) {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to find the state directory: %v", err)
+	}
+	return filepath.Join(home, ".local", "state"), nil
+}
+
+// ConfigFile returns the default config file path
+func (d Dirs) ConfigFile() string {
+	return filepath.Join(d.Config, ConfigFileName)
+}
+
+// Ensure creates the cache and state directories. They may hold tokens, so
+// only the user can read them.
+func (d Dirs) Ensure() error {
+	for _, dir := range []string{d.Cache, d.State} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("unable to create %s: %v", dir, err)
+		}
+	}
+	return nil
+}
+
+// Prefer returns legacy if a file exists there, otherwise path. Files that
+// older versions kept next to the config keep being used.
+func Prefer(legacy, path string) string {
+	if _, err := os.Stat(legacy); err == nil {
+		return legacy
+	}
+	return path
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"zap/prefs"
+)
+
+// runPreferences prints the preferences learned from interactive reviews,
+// or forgets them
+func runPreferences(args []string) {
+	flags := flag.NewFlagSet("preferences", flag.ExitOnError)
+	runOpts := registerRunFlags(flags)
+	reset := flags.Bool("reset", false, "Forget every review and the preferences learned from them")
+	flags.Parse(args)
+	if !*reset {
+		*runOpts.readOnly = true
+	}
+
+	ctx := context.Background()
+	app, err := runOpts.newApp(ctx, flags)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer app.Close()
+
+	learned := prefs.New(app.store, app.clock, app.dryRun)
+	if *reset {
+		if app.dryRun {
+			fmt.Println("Would forget every review and the preferences learned from them")
+			return
+		}
+		if err := learned.Reset(); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("Forgot every review and the preferences learned from them")
+		return
+	}
+
+	reviews, err := learned.Reviews()
+	if err != nil {
+		log.Fatal(err)
+	}
+	summary, found, err := learned.Summary()
+	if err != nil {
+		log.Fatal(err)
+	}
+	counts := make(map[string]int)
+	for _, review := range reviews {
+		counts[review.Verdict]++
+	}
+	fmt.Printf("%d reviews kept: %d accepted, %d revised, %d rejected\n", len(reviews), counts[prefs.Accepted], counts[prefs.Revised], counts[prefs.Rejected])
+	if !found {
+		fmt.Println("No preferences learned yet; they are summarized on the next run after you reject or revise a ranking with --interactive")
+		return
+	}
+	fmt.Printf("Learned preferences (updated %s):\n%s\n", summary.Updated.In(app.clock.Location()).Format("2006-01-02 15:04"), summary.Text)
+}
@@ -0,0 +1,159 @@
+// Package prefs learns how the user wants tasks ranked from how they
+// review proposed rankings in interactive runs. Reviews are kept in the
+// store and summarized by the model into preferences sent with later
+// ranking prompts.
+package prefs
+
+import (
+	"context"
+	"time"
+
+	"zap/datetime"
+	"zap/gemini"
+	"zap/store"
+)
+
+const (
+	// bucket holds the reviews under reviewsKey and their summary under
+	// summaryKey
+	bucket     = "preferences"
+	reviewsKey = "reviews"
+	summaryKey = "summary"
+)
+
+// maxReviews is how many of the latest reviews are kept
+const maxReviews = 100
+
+// Verdicts of a review
+const (
+	Accepted = "accepted"
+	Rejected = "rejected"
+	// Revised rankings got feedback and were ranked again
+	Revised = "revised"
+)
+
+// Review is what the user did with one proposed ranking
+type Review struct {
+	Time     time.Time `json:"time"`
+	List     string    `json:"list"`
+	Verdict  string    `json:"verdict"`
+	Feedback string    `json:"feedback,omitempty"`
+	// Top is the first few titles of a rejected ranking
+	Top []string `json:"top,omitempty"`
+}
+
+// reviews is the stored list of reviews. Total counts every review ever
+// recorded, including those dropped to keep maxReviews.
+type reviews struct {
+	Reviews []Review `json:"reviews"`
+	Total   int      `json:"total"`
+}
+
+// Summary is the preferences learned from the reviews recorded up to
+// Reviewed, counted like reviews.Total
+type Summary struct {
+	Text     string    `json:"text"`
+	Reviewed int       `json:"reviewed"`
+	Updated  time.Time `json:"updated"`
+}
+
+// Log records reviews and their summary in the store
+type Log struct {
+	store *store.Store
+	clock *datetime.Clock
+	// readOnly logs neither record reviews nor store summaries
+	readOnly bool
+}
+
+// New creates a log kept in st. A read-only log doesn't change the store.
+func New(st *store.Store, clock *datetime.Clock, readOnly bool) *Log {
+	return &Log{store: st, clock: clock, readOnly: readOnly}
+}
+
+// Record adds a review, dropping the oldest beyond maxReviews
+func (l *Log) Record(review Review) error {
+	if l.readOnly {
+		return nil
+	}
+	var stored reviews
+	if _, err := l.store.Get(bucket, reviewsKey, &stored); err != nil {
+		return err
+	}
+	review.Time = l.clock.Now()
+	stored.Reviews = append(stored.Reviews, review)
+	if len(stored.Reviews) > maxReviews {
+		stored.Reviews = stored.Reviews[len(stored.Reviews)-maxReviews:]
+	}
+	stored.Total++
+	return l.store.Put(bucket, reviewsKey, stored)
+}
+
+// Reviews returns the kept reviews, oldest first
+func (l *Log) Reviews() ([]Review, error) {
+	var stored reviews
+	_, err := l.store.Get(bucket, reviewsKey, &stored)
+	return stored.Reviews, err
+}
+
+// Summary returns the stored summary, if one was written
+func (l *Log) Summary() (Summary, bool, error) {
+	var summary Summary
+	found, err := l.store.Get(bucket, summaryKey, &summary)
+	return summary, found, err
+}
+
+// Summarize returns the preferences to rank with. When the user rejected
+// or revised rankings since the summary was written, the model updates it
+// first; if that fails, the stored summary is returned with the error.
+func (l *Log) Summarize(ctx context.Context, g *gemini.GeminiClient) (string, error) {
+	var stored reviews
+	if _, err := l.store.Get(bucket, reviewsKey, &stored); err != nil {
+		return "", err
+	}
+	summary, _, err := l.Summary()
+	if err != nil {
+		return "", err
+	}
+
+	unseen := stored.Total - summary.Reviewed
+	if unseen > len(stored.Reviews) {
+		unseen = len(stored.Reviews)
+	}
+	fresh := stored.Reviews[len(stored.Reviews)-unseen:]
+	if !corrected(fresh) {
+		return summary.Text, nil
+	}
+
+	news := make([]gemini.Review, len(fresh))
+	for i, review := range fresh {
+		news[i] = gemini.Review{List: review.List, Verdict: review.Verdict, Feedback: review.Feedback, Top: review.Top}
+	}
+	text, err := g.SummarizePreferences(ctx, news, summary.Text)
+	if err != nil {
+		return summary.Text, err
+	}
+	if l.readOnly {
+		return text, nil
+	}
+	updated := Summary{Text: text, Reviewed: stored.Total, Updated: l.clock.Now()}
+	return text, l.store.Put(bucket, summaryKey, updated)
+}
+
+// corrected reports whether any review rejected or revised a ranking;
+// acceptances alone teach nothing new
+func corrected(reviews []Review) bool {
+	for _, review := range reviews {
+		if review.Verdict != Accepted {
+			return true
+		}
+	}
+	return false
+}
+
+// Reset forgets every review and the summary
+func (l *Log) Reset() error {
+	if err := l.store.Delete(bucket, reviewsKey); err != nil {
+		return err
+	}
+	return l.store.Delete(bucket, summaryKey)
+}
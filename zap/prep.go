@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"zap/ingest"
+)
+
+// runPrep has the model write preparation tasks for the profile's upcoming
+// meetings without running prioritization
+func runPrep(args []string) {
+	flags := flag.NewFlagSet("prep", flag.ExitOnError)
+	runOpts := registerRunFlags(flags)
+	flags.Parse(args)
+
+	ctx := context.Background()
+	app, err := runOpts.newApp(ctx, flags)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer app.Close()
+	if app.profile.Prep == nil {
+		log.Fatal("the profile has no prep section; add one with the keywords of the meetings to prepare for")
+	}
+	if err := app.requireGemini(); err != nil {
+		log.Fatal(err)
+	}
+
+	created, err := app.prepareMeetings(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Created %d preparation tasks in list %s\n", created, app.profile.Prep.List)
+}
+
+// prepareMeetings creates the preparation tasks for the upcoming meetings
+// matching the profile's prep keywords that weren't prepared for yet
+func (a *app) prepareMeetings(ctx context.Context) (int, error) {
+	settings := a.profile.Prep
+	taskList, err := a.service.GetTaskListByTitle(settings.List)
+	if err != nil {
+		return 0, fmt.Errorf("prep: %v", err)
+	}
+	client, err := createCalendarClient(ctx, a.profile, a.userEmail)
+	if err != nil {
+		return 0, fmt.Errorf("prep: %v", err)
+	}
+	prep := ingest.NewPrep(client, a.gemini, a.orchestrator, a.store, a.clock, *settings)
+	created, err := prep.Prepare(ctx, taskList.ID)
+	if err != nil {
+		return created, fmt.Errorf("prep: %v", err)
+	}
+	return created, nil
+}
@@ -0,0 +1,316 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/text/message"
+)
+
+// Phases of a run, in the order they happen
+const (
+	Fetch    = "fetch"
+	Analyze  = "analyze"
+	Reorder  = "reorder"
+	Subtasks = "subtasks"
+)
+
+// barWidth is the number of cells in a progress bar
+const barWidth = 20
+
+// refreshInterval is how often a live bar updates its elapsed time while a
+// step is running, e.g. during a long model request
+const refreshInterval = 200 * time.Millisecond
+
+// phase totals the steps and time spent in one phase
+type phase struct {
+	name    string
+	total   int
+	done    int
+	elapsed time.Duration
+}
+
+// Reporter shows how far a run has got. On a terminal it redraws a progress
+// bar for the running phase in place; otherwise, or in plain mode, it prints
+// one line per finished step. A nil Reporter prints messages to stdout and
+// tracks nothing.
+type Reporter struct {
+	out  io.Writer
+	live bool
+	now  func() time.Time
+	// printer translates messages; nil prints them as written
+	printer *message.Printer
+
+	mu        sync.Mutex
+	phases    []*phase
+	byName    map[string]*phase
+	active    *phase
+	item      string
+	started   time.Time
+	barShown  bool
+	stopTimer chan struct{}
+
+	watchers    map[int]func(Event)
+	nextWatcher int
+}
+
+// Event is a step of a phase starting or ending, or a message printed
+// above the bar, as watchers see it
+type Event struct {
+	Phase string
+	Item  string
+	// Done and Total count the phase's steps, Done including the step when
+	// it ended
+	Done  int
+	Total int
+	Ended bool
+	// Message is a printed message; the other fields are empty then
+	Message string
+}
+
+// New creates a reporter writing to out. Bars are only drawn when out is a
+// terminal and plain is false.
+func New(out io.Writer, plain bool) *Reporter {
+	return &Reporter{
+		out:    out,
+		live:   !plain && isTerminal(out),
+		now:    time.Now,
+		byName: make(map[string]*phase),
+	}
+}
+
+// SetPrinter translates messages printed with Printf through printer
+func (r *Reporter) SetPrinter(printer *message.Printer) {
+	r.printer = printer
+}
+
+// Watch calls fn with every event until the returned function is called.
+// fn runs while the reporter is locked, so it must not use the reporter.
+func (r *Reporter) Watch(fn func(Event)) func() {
+	if r == nil {
+		return func() {}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.watchers == nil {
+		r.watchers = make(map[int]func(Event))
+	}
+	id := r.nextWatcher
+	r.nextWatcher++
+	r.watchers[id] = fn
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.watchers, id)
+	}
+}
+
+// emit passes an event to the watchers; callers hold mu
+func (r *Reporter) emit(e Event) {
+	for _, fn := range r.watchers {
+		fn(e)
+	}
+}
+
+// isTerminal reports whether w is a character device such as a terminal
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// phase returns the named phase, creating it on first use; callers hold mu
+func (r *Reporter) phase(name string) *phase {
+	p, ok := r.byName[name]
+	if !ok {
+		p = &phase{name: name}
+		r.byName[name] = p
+		r.phases = append(r.phases, p)
+	}
+	return p
+}
+
+// Expect adds n steps to a phase's total
+func (r *Reporter) Expect(name string, n int) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.phase(name).total += n
+}
+
+// Begin starts a step of a phase, such as analyzing one list, and returns
+// the function that ends it. Steps don't nest.
+func (r *Reporter) Begin(name, item string) func() {
+	if r == nil {
+		return func() {}
+	}
+	r.mu.Lock()
+	r.active = r.phase(name)
+	r.item = item
+	r.started = r.now()
+	r.emit(Event{Phase: name, Item: item, Done: r.active.done, Total: r.active.total})
+	r.draw()
+	if r.live {
+		r.stopTimer = make(chan struct{})
+		go r.refresh(r.stopTimer)
+	}
+	r.mu.Unlock()
+
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.stopTimer != nil {
+			close(r.stopTimer)
+			r.stopTimer = nil
+		}
+		p := r.active
+		if p == nil {
+			return
+		}
+		took := r.now().Sub(r.started)
+		p.done++
+		p.elapsed += took
+		r.active = nil
+		r.emit(Event{Phase: p.name, Item: r.item, Done: p.done, Total: p.total, Ended: true})
+		if r.live {
+			r.draw()
+		} else {
+			fmt.Fprintf(r.out, "[%s] %s %s\n", p.name, r.item, formatDuration(took))
+		}
+	}
+}
+
+// refresh redraws the bar until stop is closed
+func (r *Reporter) refresh(stop chan struct{}) {
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			r.mu.Lock()
+			select {
+			case <-stop:
+			default:
+				r.draw()
+			}
+			r.mu.Unlock()
+		}
+	}
+}
+
+// draw renders the bar for the latest phase; callers hold mu
+func (r *Reporter) draw() {
+	if !r.live {
+		return
+	}
+	p := r.active
+	elapsed := time.Duration(0)
+	if p != nil {
+		elapsed = p.elapsed + r.now().Sub(r.started)
+	} else if len(r.phases) > 0 {
+		p = r.phases[len(r.phases)-1]
+		elapsed = p.elapsed
+	} else {
+		return
+	}
+
+	filled := barWidth
+	if p.total > 0 {
+		filled = min(barWidth, barWidth*p.done/p.total)
+	}
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", barWidth-filled)
+	line := fmt.Sprintf("%-8s [%s] %d/%d %s", p.name, bar, p.done, p.total, formatDuration(elapsed))
+	if r.active != nil && r.item != "" {
+		line += " " + r.item
+	}
+	fmt.Fprintf(r.out, "\r\033[K%s", line)
+	r.barShown = true
+}
+
+// clear removes the bar so other output starts on a clean line; callers
+// hold mu
+func (r *Reporter) clear() {
+	if r.barShown {
+		fmt.Fprint(r.out, "\r\033[K")
+		r.barShown = false
+	}
+}
+
+// Write prints p above the bar
+func (r *Reporter) Write(p []byte) (int, error) {
+	if r == nil {
+		return os.Stdout.Write(p)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clear()
+	n, err := r.out.Write(p)
+	r.emit(Event{Message: string(p)})
+	r.draw()
+	return n, err
+}
+
+// Printf prints a message above the bar
+func (r *Reporter) Printf(format string, args ...interface{}) {
+	if r != nil && r.printer != nil {
+		r.printer.Fprintf(r.Out(), format, args...)
+		return
+	}
+	fmt.Fprintf(r.Out(), format, args...)
+}
+
+// Out returns a writer for output that must not collide with the bar
+func (r *Reporter) Out() io.Writer {
+	if r == nil {
+		return os.Stdout
+	}
+	return r
+}
+
+// Summary prints a table of the phases with their steps and time, removes
+// the bar and starts counting afresh
+func (r *Reporter) Summary() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clear()
+	if len(r.phases) == 0 {
+		return
+	}
+
+	var total time.Duration
+	fmt.Fprintln(r.out)
+	w := tabwriter.NewWriter(r.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Phase\tSteps\tTime")
+	for _, p := range r.phases {
+		fmt.Fprintf(w, "%s\t%d\t%s\n", p.name, p.done, formatDuration(p.elapsed))
+		total += p.elapsed
+	}
+	fmt.Fprintf(w, "total\t\t%s\n", formatDuration(total))
+	w.Flush()
+
+	r.phases = nil
+	r.byName = make(map[string]*phase)
+}
+
+// formatDuration rounds d for display, e.g. "1.2s" or "350ms"
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(100 * time.Millisecond).String()
+}
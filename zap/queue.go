@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"zap/store"
+	"zap/tasks"
+)
+
+// runQueue handles zap queue
+func runQueue(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: zap queue list|flush [flags]")
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "list":
+		runQueueList(args[1:])
+	case "flush":
+		runQueueFlush(args[1:])
+	default:
+		log.Fatalf("unknown queue command %q (want list or flush)", args[0])
+	}
+}
+
+// runQueueList prints the changes waiting for the connection, oldest first.
+// It reads only the state file, so it works offline.
+func runQueueList(args []string) {
+	flags := flag.NewFlagSet("queue list", flag.ExitOnError)
+	configPath := flags.String("config", "", configFlagUsage)
+	profileName := flags.String("profile", "", "Config profile whose state file holds the queue")
+	output := flags.String("output", outputText, "Output format: text or json")
+	flags.Parse(args)
+	if *output != outputText && *output != outputJSON {
+		log.Fatalf("unknown output format %q (want %s or %s)", *output, outputText, outputJSON)
+	}
+
+	cfg, _, _ := loadConfig(flags, *configPath)
+	profile, err := cfg.Profile(*profileName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	st, err := store.Open(profile.StateFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	queue, err := tasks.Queued(st)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *output == outputJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if queue == nil {
+			queue = []tasks.QueuedMutation{}
+		}
+		if err := encoder.Encode(queue); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(queue) == 0 {
+		fmt.Println("No changes are queued.")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "QUEUED\tKIND\tCHANGE\tERROR")
+	for _, queued := range queue {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", queued.Queued.Local().Format("2006-01-02 15:04"), queued.Mutation.Kind, queued.Mutation.Summary, queued.Error)
+	}
+	w.Flush()
+}
+
+// runQueueFlush applies the queued changes now instead of at the start of
+// the next run
+func runQueueFlush(args []string) {
+	flags := flag.NewFlagSet("queue flush", flag.ExitOnError)
+	runOpts := registerRunFlags(flags)
+	discard := flags.Bool("discard", false, "Drop the changes instead of applying them")
+	flags.Parse(args)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	app, err := runOpts.newApp(ctx, flags)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer app.Close()
+
+	queue, err := tasks.Queued(app.store)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(queue) == 0 {
+		fmt.Println("Nothing to flush: no changes are queued.")
+		return
+	}
+	if *discard {
+		if !app.dryRun {
+			if err := tasks.DropQueued(app.store); err != nil {
+				log.Fatal(err)
+			}
+		}
+		app.progress.Printf("Dropped %d queued changes\n", len(queue))
+		return
+	}
+	if app.dryRun {
+		for _, queued := range queue {
+			app.progress.Printf("Would apply: %s\n", queued.Mutation.Summary)
+		}
+		return
+	}
+
+	app.result = &runResult{}
+	app.flushQueued(ctx)
+	if code := app.result.code(); code != exitOK {
+		app.Close()
+		os.Exit(code)
+	}
+}
+
+// flushQueued applies the changes queued while offline, with the lists they
+// change locked. Changes whose tasks changed since are dropped and reported
+// like conflicts; what can't be applied is recorded on the run's result.
+func (a *app) flushQueued(ctx context.Context) {
+	if a.outbox == nil {
+		return
+	}
+	queue, err := tasks.Queued(a.store)
+	if err != nil {
+		a.result.fail(fmt.Errorf("queued changes: %v", err))
+		return
+	}
+	if len(queue) == 0 {
+		return
+	}
+	mutations := make([]tasks.Mutation, len(queue))
+	for i, queued := range queue {
+		mutations[i] = queued.Mutation
+	}
+	release, err := a.lockMutationLists(ctx, mutations)
+	if err != nil {
+		a.result.fail(fmt.Errorf("queued changes: %v", err))
+		return
+	}
+	defer release()
+
+	a.progress.Printf("Applying %d changes queued while offline\n", len(queue))
+	results, err := a.outbox.Flush(ctx)
+	if err != nil {
+		a.result.fail(fmt.Errorf("queued changes: %v", err))
+		return
+	}
+	var stale []string
+	var waiting int
+	for _, result := range results {
+		switch {
+		case result.Err == nil:
+		case errors.Is(result.Err, tasks.ErrStale):
+			stale = append(stale, result.Err.Error())
+		case errors.Is(result.Err, tasks.ErrQueued):
+			waiting++
+		default:
+			a.result.fail(fmt.Errorf("%s: %v", result.Queued.Mutation.Summary, result.Err))
+		}
+	}
+	if len(stale) > 0 {
+		a.result.Conflicts = append(a.result.Conflicts, stale...)
+		a.progress.Printf("Dropped %d queued changes instead of overwriting changes made since:\n  %s\n", len(stale), strings.Join(stale, "\n  "))
+	}
+	if waiting > 0 {
+		a.result.Queued += waiting
+		a.progress.Printf("%d queued changes are still waiting for the connection\n", waiting)
+	}
+}
+
+// reportQueued surfaces the writes queued because the connection dropped
+// while zap ran
+func (a *app) reportQueued() {
+	queued := a.orchestrator.Queued()
+	if queued == 0 {
+		return
+	}
+	a.result.Queued += queued
+	a.progress.Printf("%d changes couldn't be sent without a connection; the next run applies them, or run zap queue flush\n", queued)
+}
@@ -0,0 +1,250 @@
+package recurrence
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"zap/config"
+	"zap/notes"
+	"zap/store"
+	"zap/tasks"
+	"zap/todo"
+)
+
+// bucket is the store bucket holding recurrence state
+const bucket = "recurrence"
+
+// dueLayout is the date format the Tasks API uses for due dates
+const dueLayout = "2006-01-02T00:00:00.000Z"
+
+// Instance records the task created for a recurring template, or the next
+// instance created after a marker task was completed
+type Instance struct {
+	TaskID  string    `json:"taskId"`
+	ListID  string    `json:"listId"`
+	Due     string    `json:"due"`
+	Created time.Time `json:"created"`
+}
+
+// template is a configured recurring task with its parsed rule
+type template struct {
+	task config.RecurringTask
+	rule Rule
+}
+
+// Manager materializes the next instance of recurring tasks
+type Manager struct {
+	service      *tasks.Service
+	orchestrator *tasks.Orchestrator
+	store        *store.Store
+	templates    []template
+	now          func() time.Time
+	// namespace is the block of zap's own notes, which instances don't copy
+	namespace notes.Namespace
+}
+
+// NewManager validates the configured recurring tasks and creates a manager
+func NewManager(service *tasks.Service, orchestrator *tasks.Orchestrator, st *store.Store, recurring []config.RecurringTask) (*Manager, error) {
+	m := &Manager{
+		service:      service,
+		orchestrator: orchestrator,
+		store:        st,
+		now:          time.Now,
+	}
+	for _, task := range recurring {
+		rule, err := ParseRule(task.Every)
+		if err != nil {
+			return nil, fmt.Errorf("recurring task '%s': %v", task.Title, err)
+		}
+		m.templates = append(m.templates, template{task: task, rule: rule})
+	}
+	return m, nil
+}
+
+// SetNamespace sets the namespace of zap's block in notes
+func (m *Manager) SetNamespace(ns notes.Namespace) {
+	m.namespace = ns
+}
+
+// Materialize creates the next instance of every recurring task whose
+// current instance has been completed or deleted. Configured templates are
+// checked first, then completed tasks carrying "[every ...]" markers in the
+// given lists. It returns the number of instances created.
+func (m *Manager) Materialize(ctx context.Context, listTitles []string) (int, error) {
+	created := 0
+	for _, t := range m.templates {
+		ok, err := m.materializeTemplate(ctx, t)
+		if err != nil {
+			return created, err
+		}
+		if ok {
+			created++
+		}
+	}
+
+	for _, listTitle := range listTitles {
+		taskList, err := m.service.GetTaskListByTitle(listTitle)
+		if err != nil {
+			return created, fmt.Errorf("error finding task list %s: %v", listTitle, err)
+		}
+		n, err := m.materializeMarkers(ctx, taskList.ID)
+		created += n
+		if err != nil {
+			return created, err
+		}
+	}
+	return created, nil
+}
+
+// materializeTemplate creates the next instance of a configured template
+func (m *Manager) materializeTemplate(ctx context.Context, t template) (bool, error) {
+	key := "template:" + t.task.Title
+	today := m.today()
+
+	var previous Instance
+	found, err := m.store.Get(bucket, key, &previous)
+	if err != nil {
+		return false, err
+	}
+
+	due := t.rule.First(today)
+	if found {
+		task, err := m.service.GetTask(ctx, previous.ListID, previous.TaskID)
+		switch {
+		case tasks.IsNotFound(err):
+			// Deleted instances count as done
+		case err != nil:
+			return false, fmt.Errorf("recurring task '%s': %v", t.task.Title, err)
+		case task.Status != "completed" && !task.Deleted:
+			return false, nil
+		}
+		due = t.rule.NextFrom(parseDue(previous.Due, today), today)
+	}
+
+	taskList, err := m.service.GetTaskListByTitle(t.task.List)
+	if err != nil {
+		return false, fmt.Errorf("recurring task '%s': %v", t.task.Title, err)
+	}
+
+	instance := &todo.Task{Title: t.task.Title, Notes: t.task.Notes}
+	return m.create(ctx, key, taskList.ID, instance, due)
+}
+
+// materializeMarkers creates the next instance for completed marker tasks
+func (m *Manager) materializeMarkers(ctx context.Context, taskListID string) (int, error) {
+	listTasks, err := m.service.ListAllTasks(ctx, taskListID)
+	if err != nil {
+		return 0, err
+	}
+
+	// An open task with the same title means the next instance already exists
+	open := make(map[string]*todo.Task)
+	for _, task := range listTasks {
+		if task.Status != "completed" && !task.Deleted {
+			open[task.Title] = task
+		}
+	}
+
+	today := m.today()
+	created := 0
+	for _, task := range listTasks {
+		if task.Status != "completed" || task.Deleted {
+			continue
+		}
+		rule, ok, err := ParseMarker(task.Title)
+		if !ok {
+			continue
+		}
+		if err != nil {
+			log.Printf("Skipping '%s': %v", task.Title, err)
+			continue
+		}
+
+		key := "marker:" + task.ID
+		var done Instance
+		if found, err := m.store.Get(bucket, key, &done); err != nil || found {
+			continue
+		}
+
+		if existing, ok := open[task.Title]; ok {
+			if err := m.store.Put(bucket, key, Instance{TaskID: existing.ID, ListID: taskListID, Due: existing.Due, Created: m.now()}); err != nil {
+				return created, err
+			}
+			continue
+		}
+
+		// Recur from the due date, or from completion if there was none
+		previous := parseDue(task.Due, time.Time{})
+		if previous.IsZero() && task.Completed != "" {
+			previous = parseDue(task.Completed, today)
+		}
+		if previous.IsZero() {
+			previous = today
+		}
+
+		// The next instance starts without the completed one's zap notes
+		next := &todo.Task{Title: task.Title, Notes: m.namespace.User(task.Notes)}
+		ok, err = m.create(ctx, key, taskListID, next, rule.NextFrom(previous, today))
+		if err != nil {
+			return created, err
+		}
+		if ok {
+			created++
+			open[task.Title] = next
+		}
+	}
+	return created, nil
+}
+
+// create inserts an instance through the orchestrator and records it. Dry
+// runs print the insert and record nothing.
+func (m *Manager) create(ctx context.Context, key, taskListID string, task *todo.Task, due time.Time) (bool, error) {
+	task.Status = "needsAction"
+	task.Due = due.Format(dueLayout)
+
+	results, err := m.orchestrator.Apply(ctx, []tasks.Mutation{{
+		Kind:       tasks.MutationInsert,
+		TaskListID: taskListID,
+		Task:       task,
+		Summary:    fmt.Sprintf("create recurring task '%s' due %s", task.Title, due.Format("Mon Jan 2")),
+	}})
+	if err != nil {
+		return false, err
+	}
+	if len(results) == 0 || results[0].Task == nil || results[0].Task.ID == "" {
+		return false, nil
+	}
+
+	instance := Instance{
+		TaskID:  results[0].Task.ID,
+		ListID:  taskListID,
+		Due:     task.Due,
+		Created: m.now(),
+	}
+	if err := m.store.Put(bucket, key, instance); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// today returns the current local date as a UTC midnight, matching how the
+// Tasks API stores due dates
+func (m *Manager) today() time.Time {
+	now := m.now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// parseDue parses an RFC 3339 timestamp from the API, returning fallback
+// when it is empty or invalid
+func parseDue(value string, fallback time.Time) time.Time {
+	if value == "" {
+		return fallback
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return fallback
+	}
+	return t.UTC()
+}
@@ -0,0 +1,173 @@
+package recurrence
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// markerPattern finds "[every monday]" style markers in task titles
+var markerPattern = regexp.MustCompile(`(?i)\[every ([^\]]+)\]`)
+
+var weekdayNames = map[string]time.Weekday{
+	"sunday": time.Sunday, "sun": time.Sunday,
+	"monday": time.Monday, "mon": time.Monday,
+	"tuesday": time.Tuesday, "tue": time.Tuesday, "tues": time.Tuesday,
+	"wednesday": time.Wednesday, "wed": time.Wednesday,
+	"thursday": time.Thursday, "thu": time.Thursday, "thurs": time.Thursday,
+	"friday": time.Friday, "fri": time.Friday,
+	"saturday": time.Saturday, "sat": time.Saturday,
+}
+
+// unit is the step of an interval rule
+type unit int
+
+const (
+	unitDay unit = iota
+	unitWeek
+	unitMonth
+	unitYear
+)
+
+// Rule describes when a recurring task repeats. It is either an interval
+// ("every 2 weeks") or a set of weekdays ("every monday and thursday").
+type Rule struct {
+	text     string
+	interval int
+	unit     unit
+	weekdays map[time.Weekday]bool
+}
+
+// ParseRule parses the text after "every": "day", "weekday", "week",
+// "month", "year", "3 days", "2 weeks", "monday", "mon, thu".
+func ParseRule(text string) (Rule, error) {
+	normalized := strings.ToLower(strings.TrimSpace(text))
+	rule := Rule{text: normalized, interval: 1}
+
+	switch normalized {
+	case "day", "daily":
+		rule.unit = unitDay
+		return rule, nil
+	case "weekday", "weekdays":
+		rule.weekdays = map[time.Weekday]bool{
+			time.Monday: true, time.Tuesday: true, time.Wednesday: true, time.Thursday: true, time.Friday: true,
+		}
+		return rule, nil
+	case "week", "weekly":
+		rule.unit = unitWeek
+		return rule, nil
+	case "month", "monthly":
+		rule.unit = unitMonth
+		return rule, nil
+	case "year", "yearly":
+		rule.unit = unitYear
+		return rule, nil
+	}
+
+	// "N units"
+	if fields := strings.Fields(normalized); len(fields) == 2 {
+		if n, err := strconv.Atoi(fields[0]); err == nil {
+			if n < 1 {
+				return Rule{}, fmt.Errorf("invalid recurrence %q: interval must be at least 1", text)
+			}
+			rule.interval = n
+			switch strings.TrimSuffix(fields[1], "s") {
+			case "day":
+				rule.unit = unitDay
+			case "week":
+				rule.unit = unitWeek
+			case "month":
+				rule.unit = unitMonth
+			case "year":
+				rule.unit = unitYear
+			default:
+				return Rule{}, fmt.Errorf("invalid recurrence %q: unknown unit %q", text, fields[1])
+			}
+			return rule, nil
+		}
+	}
+
+	// Weekday list: "monday", "mon, thu", "tuesday and friday"
+	rule.weekdays = make(map[time.Weekday]bool)
+	for _, name := range strings.FieldsFunc(strings.ReplaceAll(normalized, " and ", ","), func(r rune) bool {
+		return r == ',' || r == ' ' || r == '/'
+	}) {
+		day, ok := weekdayNames[name]
+		if !ok {
+			return Rule{}, fmt.Errorf("invalid recurrence %q: unknown day %q", text, name)
+		}
+		rule.weekdays[day] = true
+	}
+	if len(rule.weekdays) == 0 {
+		return Rule{}, fmt.Errorf("invalid recurrence %q", text)
+	}
+	return rule, nil
+}
+
+// ParseMarker extracts the rule from a "[every ...]" marker in a title
+func ParseMarker(title string) (Rule, bool, error) {
+	match := markerPattern.FindStringSubmatch(title)
+	if match == nil {
+		return Rule{}, false, nil
+	}
+	rule, err := ParseRule(match[1])
+	return rule, true, err
+}
+
+// String returns the rule as written after "every"
+func (r Rule) String() string {
+	return r.text
+}
+
+// Next returns the first occurrence strictly after the given date. Only the
+// date part of after is used.
+func (r Rule) Next(after time.Time) time.Time {
+	day := truncateDay(after)
+	if r.weekdays != nil {
+		for i := 1; i <= 7; i++ {
+			candidate := day.AddDate(0, 0, i)
+			if r.weekdays[candidate.Weekday()] {
+				return candidate
+			}
+		}
+	}
+
+	switch r.unit {
+	case unitWeek:
+		return day.AddDate(0, 0, 7*r.interval)
+	case unitMonth:
+		return day.AddDate(0, r.interval, 0)
+	case unitYear:
+		return day.AddDate(r.interval, 0, 0)
+	default:
+		return day.AddDate(0, 0, r.interval)
+	}
+}
+
+// First returns the first occurrence on or after today. Interval rules
+// start today; weekday rules start on the next matching day.
+func (r Rule) First(today time.Time) time.Time {
+	day := truncateDay(today)
+	if r.weekdays != nil {
+		return r.Next(day.AddDate(0, 0, -1))
+	}
+	return day
+}
+
+// NextFrom returns the first occurrence after previous that isn't before
+// today, skipping occurrences missed while the task stayed open
+func (r Rule) NextFrom(previous, today time.Time) time.Time {
+	today = truncateDay(today)
+	next := r.Next(previous)
+	for next.Before(today) {
+		next = r.Next(next)
+	}
+	return next
+}
+
+// truncateDay drops the time of day, keeping the date in its location
+func truncateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,112 @@
+package redact
+
+import (
+	"fmt"
+	"regexp"
+
+	"zap/todo"
+)
+
+// Built-in rule names
+const (
+	Email = "email"
+	Phone = "phone"
+	URL   = "url"
+)
+
+// builtins are the rules available by name. URLs run before emails so that
+// credentials in URLs don't leave half an address behind.
+var builtins = []struct {
+	name        string
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{URL, regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>"')\]]+`), "[url]"},
+	{Email, regexp.MustCompile(`(?i)\b[A-Z0-9._%+-]+@[A-Z0-9.-]+\.[A-Z]{2,}\b`), "[email]"},
+	{Phone, regexp.MustCompile(`(?:\+\d{1,3}[\s.-]?)?(?:\(\d{2,4}\)[\s.-]?)?\d{2,4}[\s.-]\d{3,4}[\s.-]?\d{3,4}\b`), "[phone]"},
+}
+
+// rule replaces matches of pattern with replacement
+type rule struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// Redactor strips personal data from task text before it is sent to a model.
+// Only titles and notes are changed; task IDs are kept so answers map back
+// to the original tasks.
+type Redactor struct {
+	rules []rule
+}
+
+// New creates a redactor from built-in rule names (none means all of them)
+// and extra regular expressions, whose matches become "[redacted]"
+func New(builtinNames []string, patterns []string) (*Redactor, error) {
+	enabled := make(map[string]bool)
+	if len(builtinNames) == 0 {
+		for _, b := range builtins {
+			enabled[b.name] = true
+		}
+	}
+	for _, name := range builtinNames {
+		found := false
+		for _, b := range builtins {
+			if b.name == name {
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown redaction rule %q (want %s, %s or %s)", name, Email, Phone, URL)
+		}
+		enabled[name] = true
+	}
+
+	r := &Redactor{}
+	for _, b := range builtins {
+		if enabled[b.name] {
+			r.rules = append(r.rules, rule{pattern: b.pattern, replacement: b.replacement})
+		}
+	}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %v", p, err)
+		}
+		r.rules = append(r.rules, rule{pattern: re, replacement: "[redacted]"})
+	}
+	return r, nil
+}
+
+// String redacts text. A nil redactor returns text unchanged.
+func (r *Redactor) String(text string) string {
+	if r == nil {
+		return text
+	}
+	for _, rule := range r.rules {
+		text = rule.pattern.ReplaceAllString(text, rule.replacement)
+	}
+	return text
+}
+
+// Task returns a copy of task with its title and notes redacted
+func (r *Redactor) Task(task *todo.Task) *todo.Task {
+	if r == nil {
+		return task
+	}
+	redacted := *task
+	redacted.Title = r.String(task.Title)
+	redacted.Notes = r.String(task.Notes)
+	return &redacted
+}
+
+// Tasks redacts every task in a slice
+func (r *Redactor) Tasks(tasks []*todo.Task) []*todo.Task {
+	if r == nil {
+		return tasks
+	}
+	redacted := make([]*todo.Task, len(tasks))
+	for i, task := range tasks {
+		redacted[i] = r.Task(task)
+	}
+	return redacted
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"slices"
+	"sort"
+	"syscall"
+
+	"zap/lock"
+	"zap/tasks"
+	"zap/todo"
+)
+
+// runResume applies the changes interrupted runs didn't get to, from their
+// last completed write on
+func runResume(args []string) {
+	flags := flag.NewFlagSet("resume", flag.ExitOnError)
+	runOpts := registerRunFlags(flags)
+	discard := flags.Bool("discard", false, "Drop the changes instead of applying them, e.g. when the lists were sorted since")
+	flags.Parse(args)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	app, err := runOpts.newApp(ctx, flags)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer app.Close()
+
+	checkpoints, err := tasks.Checkpoints(app.store)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(checkpoints) == 0 {
+		fmt.Println("Nothing to resume: no run was interrupted.")
+		return
+	}
+	if *discard {
+		for _, checkpoint := range checkpoints {
+			if !app.dryRun {
+				if err := tasks.DropCheckpoint(app.store, checkpoint); err != nil {
+					log.Fatal(err)
+				}
+			}
+			app.progress.Printf("Dropped %d changes of the run started %s\n", len(checkpoint.Pending), checkpoint.Started.Local().Format("2006-01-02 15:04"))
+		}
+		return
+	}
+
+	var pending []tasks.Mutation
+	for _, checkpoint := range checkpoints {
+		pending = append(pending, checkpoint.Pending...)
+	}
+	release, err := app.lockMutationLists(ctx, pending)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer release()
+
+	var failed bool
+	for _, checkpoint := range checkpoints {
+		app.progress.Printf("Resuming the run started %s: %d changes applied, %d to go\n", checkpoint.Started.Local().Format("2006-01-02 15:04"), checkpoint.Applied, len(checkpoint.Pending))
+		// Applying checkpoints afresh, so being interrupted again leaves a
+		// new one with what is still left
+		if !app.dryRun {
+			if err := tasks.DropCheckpoint(app.store, checkpoint); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if _, err := app.orchestrator.Apply(ctx, checkpoint.Pending); err != nil {
+			log.Print(err)
+			failed = true
+		}
+	}
+	for _, conflict := range app.orchestrator.Conflicts() {
+		log.Print(conflict)
+	}
+	app.reportCheckpoints()
+	if failed {
+		release()
+		app.Close()
+		os.Exit(exitFailure)
+	}
+}
+
+// lockMutationLists locks every list the mutations change, in a fixed
+// order like lockLists, failing if any is busy
+func (a *app) lockMutationLists(ctx context.Context, mutations []tasks.Mutation) (func(), error) {
+	if a.dryRun {
+		return func() {}, nil
+	}
+	var listIDs []string
+	for _, m := range mutations {
+		listIDs = append(listIDs, m.TaskListID)
+		if m.Destination != "" {
+			listIDs = append(listIDs, m.Destination)
+		}
+	}
+	slices.Sort(listIDs)
+	listIDs = slices.Compact(listIDs)
+
+	taskLists, err := a.service.ListTaskLists()
+	if err != nil {
+		return nil, err
+	}
+	var lists []*todo.TaskList
+	for _, taskList := range taskLists {
+		if slices.Contains(listIDs, taskList.ID) {
+			lists = append(lists, taskList)
+		}
+	}
+	sort.Slice(lists, func(i, j int) bool { return lists[i].ID < lists[j].ID })
+
+	var locks []*lock.Lock
+	release := func() {
+		for _, l := range locks {
+			if err := l.Release(); err != nil {
+				log.Print(err)
+			}
+		}
+		locks = nil
+	}
+	for _, taskList := range lists {
+		l, err := a.lockList(ctx, taskList)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		locks = append(locks, l)
+	}
+	return release, nil
+}
+
+// reportCheckpoints points to zap resume while interrupted runs have left
+// changes unapplied
+func (a *app) reportCheckpoints() {
+	if a.dryRun {
+		return
+	}
+	checkpoints, err := tasks.Checkpoints(a.store)
+	if err != nil {
+		log.Printf("Error reading checkpoints: %v", err)
+		return
+	}
+	var pending int
+	for _, checkpoint := range checkpoints {
+		pending += len(checkpoint.Pending)
+	}
+	if pending > 0 {
+		a.progress.Printf("%d changes of an interrupted run were not applied; run zap resume to apply them\n", pending)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"text/tabwriter"
+
+	"zap/gemini"
+	"zap/prefs"
+	"zap/tasks"
+	"zap/todo"
+)
+
+// maxRejectedTop is how many titles of a rejected ranking are recorded
+const maxRejectedTop = 3
+
+// reviewer prints each proposed ranking to out and reads what to do with
+// it from in: yes applies it, no or an empty answer keeps the list as it
+// is, and anything else is feedback for the model to revise it with.
+// Every answer is recorded in reviews, to learn preferences from.
+func reviewer(in *bufio.Reader, out io.Writer, reviews *prefs.Log) tasks.ReviewFunc {
+	return func(listTitle string, listTasks []*todo.Task, priorities []gemini.TaskPriority) (bool, string) {
+		current := make(map[string]int, len(listTasks))
+		byID := make(map[string]*todo.Task, len(listTasks))
+		for i, task := range listTasks {
+			current[task.ID] = i + 1
+			byID[task.ID] = task
+		}
+
+		fmt.Fprintf(out, "\nProposed order for %s:\n", listTitle)
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		var top []string
+		for i, priority := range priorities {
+			task, ok := byID[priority.TaskID]
+			if !ok {
+				continue
+			}
+			fmt.Fprintf(w, "  %d.\t(now %d)\t%.0f\t%s\t%s\n", i+1, current[task.ID], priority.Priority, task.Title, priority.Explanation)
+			if len(top) < maxRejectedTop {
+				top = append(top, task.Title)
+			}
+		}
+		w.Flush()
+
+		fmt.Fprint(out, "Apply it? [y]es, [N]o to keep the current order, or type feedback to revise it: ")
+		answer, _ := in.ReadString('\n')
+		answer = strings.TrimSpace(answer)
+		review := prefs.Review{List: listTitle, Verdict: prefs.Revised, Feedback: answer}
+		accept := false
+		switch strings.ToLower(answer) {
+		case "y", "yes":
+			review = prefs.Review{List: listTitle, Verdict: prefs.Accepted}
+			accept = true
+		case "", "n", "no":
+			review = prefs.Review{List: listTitle, Verdict: prefs.Rejected, Top: top}
+		}
+		if err := reviews.Record(review); err != nil {
+			log.Printf("Error recording the review of list %s: %v", listTitle, err)
+		}
+		return accept, review.Feedback
+	}
+}
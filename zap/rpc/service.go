@@ -0,0 +1,152 @@
+// Package rpc is the gRPC API of zap serve: the messages generated from
+// zap.proto, the Zap service that takes them, and a client for it.
+package rpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// ServiceName is the full name of the Zap service
+const ServiceName = "zap.v1.Zap"
+
+// Full names of the service's methods
+const (
+	ListTasksMethod       = "/" + ServiceName + "/ListTasks"
+	PrioritizeMethod      = "/" + ServiceName + "/Prioritize"
+	SuggestSubtasksMethod = "/" + ServiceName + "/SuggestSubtasks"
+	GetRunReportMethod    = "/" + ServiceName + "/GetRunReport"
+)
+
+// ZapServer answers the calls of the Zap service
+type ZapServer interface {
+	ListTasks(context.Context, *ListTasksRequest) (*ListTasksResponse, error)
+	Prioritize(*PrioritizeRequest, grpc.ServerStreamingServer[RunUpdate]) error
+	SuggestSubtasks(*SuggestSubtasksRequest, grpc.ServerStreamingServer[RunUpdate]) error
+	GetRunReport(context.Context, *GetRunReportRequest) (*RunReport, error)
+}
+
+// RegisterZapServer serves the Zap service with srv
+func RegisterZapServer(s grpc.ServiceRegistrar, srv ZapServer) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+// serviceDesc describes the Zap service to gRPC
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*ZapServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "ListTasks", Handler: listTasksHandler},
+		{MethodName: "GetRunReport", Handler: getRunReportHandler},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "Prioritize", Handler: prioritizeHandler, ServerStreams: true},
+		{StreamName: "SuggestSubtasks", Handler: suggestSubtasksHandler, ServerStreams: true},
+	},
+	Metadata: "rpc/zap.proto",
+}
+
+func listTasksHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	return unary(srv, ctx, dec, interceptor, ListTasksMethod, ZapServer.ListTasks)
+}
+
+func getRunReportHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	return unary(srv, ctx, dec, interceptor, GetRunReportMethod, ZapServer.GetRunReport)
+}
+
+func prioritizeHandler(srv any, stream grpc.ServerStream) error {
+	return serverStream(srv, stream, ZapServer.Prioritize)
+}
+
+func suggestSubtasksHandler(srv any, stream grpc.ServerStream) error {
+	return serverStream(srv, stream, ZapServer.SuggestSubtasks)
+}
+
+// unary decodes the request of a unary call and answers it with call,
+// through the server's interceptor if it has one
+func unary[Req, Resp any](srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor, method string, call func(ZapServer, context.Context, *Req) (*Resp, error)) (any, error) {
+	in := new(Req)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return call(srv.(ZapServer), ctx, req.(*Req))
+	}
+	if interceptor == nil {
+		return handler(ctx, in)
+	}
+	return interceptor(ctx, in, &grpc.UnaryServerInfo{Server: srv, FullMethod: method}, handler)
+}
+
+// serverStream receives the request of a call that streams its answers and
+// answers it with call
+func serverStream[Req any](srv any, stream grpc.ServerStream, call func(ZapServer, *Req, grpc.ServerStreamingServer[RunUpdate]) error) error {
+	in := new(Req)
+	if err := stream.RecvMsg(in); err != nil {
+		return err
+	}
+	return call(srv.(ZapServer), in, &grpc.GenericServerStream[Req, RunUpdate]{ServerStream: stream})
+}
+
+// WithToken returns a context whose calls pass token to the server
+func WithToken(ctx context.Context, token string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+}
+
+// Client calls the Zap service. Pass the API token in each call's context
+// with WithToken.
+type Client struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewClient creates a client calling the service over cc
+func NewClient(cc grpc.ClientConnInterface) *Client {
+	return &Client{cc: cc}
+}
+
+// ListTasks returns the open tasks of the target lists
+func (c *Client) ListTasks(ctx context.Context, in *ListTasksRequest, opts ...grpc.CallOption) (*ListTasksResponse, error) {
+	out := new(ListTasksResponse)
+	if err := c.cc.Invoke(ctx, ListTasksMethod, in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Prioritize starts a run and returns the stream of its progress, which
+// ends with its report
+func (c *Client) Prioritize(ctx context.Context, in *PrioritizeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[RunUpdate], error) {
+	return c.stream(ctx, &serviceDesc.Streams[0], PrioritizeMethod, in, opts)
+}
+
+// SuggestSubtasks starts creating subtasks in a list and returns the
+// stream of the run's progress, which ends with its report
+func (c *Client) SuggestSubtasks(ctx context.Context, in *SuggestSubtasksRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[RunUpdate], error) {
+	return c.stream(ctx, &serviceDesc.Streams[1], SuggestSubtasksMethod, in, opts)
+}
+
+// GetRunReport returns the report of a run started through the server
+func (c *Client) GetRunReport(ctx context.Context, in *GetRunReportRequest, opts ...grpc.CallOption) (*RunReport, error) {
+	out := new(RunReport)
+	if err := c.cc.Invoke(ctx, GetRunReportMethod, in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// stream sends the request of a call that streams its answers
+func (c *Client) stream(ctx context.Context, desc *grpc.StreamDesc, method string, in any, opts []grpc.CallOption) (grpc.ServerStreamingClient[RunUpdate], error) {
+	stream, err := c.cc.NewStream(ctx, desc, method, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return &grpc.GenericClientStream[any, RunUpdate]{ClientStream: stream}, nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"zap/tags"
+	"zap/tasks"
+	"zap/todo"
+)
+
+// runSearch finds tasks whose title or notes match a query in every list
+func runSearch(args []string) {
+	flags := flag.NewFlagSet("search", flag.ExitOnError)
+	runOpts := registerRunFlags(flags)
+	useRegex := flags.Bool("regex", false, "Treat the query as a regular expression")
+	openOnly := flags.Bool("open", false, "Skip completed tasks")
+	listTitle := flags.String("list", "", "Only search this task list (default: every list)")
+	var tagFilter listFlag
+	flags.Var(&tagFilter, "tag", "Only match tasks with this tag (repeatable; all must match)")
+
+	positional := parseInterspersed(flags, args)
+	if len(positional) > 1 || (len(positional) == 0 && len(tagFilter) == 0) {
+		log.Fatal("usage: zap search <query> [--regex] [--tag tag] [--list list] [--open]")
+	}
+
+	var query string
+	if len(positional) == 1 {
+		query = positional[0]
+	}
+	match, err := newMatcher(query, *useRegex)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	app, err := runOpts.newApp(ctx, flags)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer app.Close()
+
+	var taskLists []*todo.TaskList
+	if *listTitle != "" {
+		taskList, err := app.service.GetTaskListByTitle(*listTitle)
+		if err != nil {
+			log.Fatal(err)
+		}
+		taskLists = []*todo.TaskList{taskList}
+	} else if taskLists, err = app.service.ListTaskLists(); err != nil {
+		log.Fatal(err)
+	}
+
+	found := 0
+	for _, taskList := range taskLists {
+		listTasks, err := app.service.ListAllTasks(ctx, taskList.ID)
+		if err != nil {
+			log.Printf("Error fetching tasks for list %s: %v", taskList.Title, err)
+			continue
+		}
+
+		tasks.NewTaskTree(listTasks).Walk(func(node *tasks.TaskNode) bool {
+			task := node.Task
+			if task.Deleted || (*openOnly && task.Status == "completed") {
+				return true
+			}
+			if !tags.HasAll(task, tagFilter) || !(match(task.Title) || match(task.Notes)) {
+				return true
+			}
+			found++
+			fmt.Println(formatSearchResult(taskList, node))
+			return true
+		})
+	}
+
+	if found == 0 {
+		fmt.Println("No matching tasks")
+	}
+}
+
+// newMatcher returns a case-insensitive substring or regex matcher. An empty
+// query matches everything.
+func newMatcher(query string, useRegex bool) (func(string) bool, error) {
+	if useRegex {
+		re, err := regexp.Compile("(?i)" + query)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex %q: %v", query, err)
+		}
+		return re.MatchString, nil
+	}
+	query = strings.ToLower(query)
+	return func(text string) bool {
+		return strings.Contains(strings.ToLower(text), query)
+	}, nil
+}
+
+// formatSearchResult renders a match as "List > Parent > Task" with status and due date
+func formatSearchResult(taskList *todo.TaskList, node *tasks.TaskNode) string {
+	status := "open"
+	if node.Task.Status == "completed" {
+		status = "done"
+	}
+	path := append([]string{taskList.Title}, node.Path()...)
+	line := fmt.Sprintf("[%s] %s", status, strings.Join(path, " > "))
+	if len(node.Task.Due) >= 10 {
+		line += fmt.Sprintf(" (due %s)", node.Task.Due[:10])
+	}
+	return line
+}
+
+// findTask looks a task up by ID or title in listTitle, or in the profile's
+// target lists when it is empty, returning the first match
+func (a *app) findTask(query, listTitle string) (*todo.TaskList, *todo.Task, error) {
+	listTitles := a.profile.TargetLists
+	if listTitle != "" {
+		listTitles = []string{listTitle}
+	}
+	var errs []error
+	for _, title := range listTitles {
+		taskList, err := a.service.GetTaskListByTitle(title)
+		if err != nil {
+			return nil, nil, err
+		}
+		task, err := a.service.FindTask(taskList.ID, query)
+		if err == nil {
+			return taskList, task, nil
+		}
+		errs = append(errs, fmt.Errorf("%v in list '%s'", err, taskList.Title))
+	}
+	return nil, nil, errors.Join(errs...)
+}
@@ -0,0 +1,712 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"zap/api"
+	"zap/config"
+	"zap/datetime"
+	"zap/jobs"
+	"zap/progress"
+	"zap/tasks"
+	"zap/todo"
+)
+
+const (
+	// envServeToken holds the API token when --token isn't given, so it
+	// stays out of process listings
+	envServeToken = "ZAP_SERVE_TOKEN"
+	// maxRequestBody caps the size of API request bodies
+	maxRequestBody = 64 << 10
+)
+
+// runServe serves zap's HTTP API, for browser extensions and other tools
+// that capture tasks or start runs, until interrupted. With tenants in the
+// config it serves each of them with their own tokens; otherwise it serves
+// the profile's user to holders of --token.
+func runServe(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	runOpts := registerRunFlags(flags)
+	addr := flags.String("addr", "localhost:8080", "Address to serve the API on")
+	grpcAddr := flags.String("grpc-addr", "", "Address to also serve the gRPC API on, e.g. localhost:9090")
+	token := flags.String("token", "", "Secret that API requests must pass as a bearer token, without tenants in the config (default: $"+envServeToken+")")
+	var origins listFlag
+	flags.Var(&origins, "allow-origin", "Origin whose pages may call the API, e.g. chrome-extension://ID (repeatable)")
+	printOpenAPI := flags.Bool("openapi", false, "Print the OpenAPI document describing the API and exit")
+	flags.Parse(args)
+	if *printOpenAPI {
+		document, err := api.OpenAPI()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(string(document))
+		return
+	}
+
+	// Nobody is there to confirm changes; deleting tasks still takes --force
+	*runOpts.yes = true
+	*runOpts.plain = true
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	s := &server{origins: origins, ctx: ctx}
+	cfg, _, _ := loadConfig(flags, *runOpts.configPath)
+	if len(cfg.Tenants) > 0 {
+		if *token != "" || isFlagSet(flags, "u") {
+			log.Fatal("with tenants in the config, tokens and users come from the tenants; --token and -u are only for a server without tenants")
+		}
+		tenants, err := configTenants(cfg, runOpts)
+		if err != nil {
+			log.Fatal(err)
+		}
+		s.tenants = tenants
+	} else {
+		if *token == "" {
+			*token = config.Getenv(envServeToken)
+		}
+		if *token == "" {
+			log.Fatalf("an API token is required; pass --token or set %s", envServeToken)
+		}
+		app, err := runOpts.newApp(ctx, flags)
+		if err != nil {
+			log.Fatal(err)
+		}
+		t, err := singleTenant(ctx, app, *token, &s.status)
+		if err != nil {
+			log.Fatal(err)
+		}
+		s.tenants = []*tenant{t}
+	}
+	defer s.close()
+
+	if *grpcAddr != "" {
+		if err := s.serveGRPC(ctx, *grpcAddr); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := s.serve(ctx, *addr); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// server answers API requests for its tenants' users, each with a session
+// of their own
+type server struct {
+	tenants []*tenant
+	origins []string
+	status  health
+
+	// ctx outlives requests, so runs they start carry on after answering
+	ctx context.Context
+}
+
+// maxRunReports is how many runs the dashboard shows
+const maxRunReports = 10
+
+// runReport is a run started through the server and what it did, with its
+// progress; its job keeps what it did once the server stops. The session's
+// reportsMu guards it while the run is in progress.
+type runReport struct {
+	ID       string
+	Trigger  string
+	Started  time.Time
+	Finished time.Time
+	Result   *runResult
+	Err      error
+	// Events are the run's progress so far
+	Events []progress.Event
+	// changed is closed, and replaced, when there are more events or the
+	// run's job finishes
+	changed chan struct{}
+}
+
+// sessionHandler answers a request in the session it acts in
+type sessionHandler func(w http.ResponseWriter, r *http.Request, sess *session)
+
+// serve serves the API and health checks on addr until ctx is done
+func (s *server) serve(ctx context.Context, addr string) error {
+	// The clients are set up, so requests can be answered; readiness then
+	// follows whether runs work
+	s.status.set(nil)
+	mux := http.NewServeMux()
+	s.status.register(mux)
+	mux.HandleFunc("OPTIONS /api/", s.preflight)
+	mux.HandleFunc("GET /api/openapi.json", s.openAPI)
+	// The routes follow the operations the OpenAPI document describes
+	handlers := map[string]sessionHandler{
+		"listLists":  s.lists,
+		"addTask":    s.quickAdd,
+		"prioritize": s.prioritize,
+		"runEvents":  s.runEvents,
+		"listJobs":   s.listJobs,
+		"getJob":     s.getJob,
+		"retryJob":   s.retryJob,
+	}
+	for _, op := range api.Operations {
+		mux.Handle(op.Method+" "+op.Path, s.api(op.Scope, handlers[op.ID]))
+	}
+	s.registerDashboard(mux)
+
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Serving the API at http://%s/api/ and the dashboard at http://%s/", addr, addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	// Let runs in progress finish writing
+	for _, t := range s.tenants {
+		t.each(func(sess *session) {
+			sess.running.Lock()
+		})
+	}
+	return nil
+}
+
+// close closes the apps of every session
+func (s *server) close() {
+	for _, t := range s.tenants {
+		t.each(func(sess *session) {
+			sess.app.Close()
+		})
+	}
+}
+
+// api wraps an API handler: requests from pages of origins that aren't
+// allowed are refused, and the rest need a token that allows scope
+func (s *server) api(scope string, handler sessionHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.allowOrigin(w, r) {
+			writeError(w, http.StatusForbidden, "origin not allowed")
+			return
+		}
+		bearer, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		sess, _, code, err := s.session(bearer, r.URL.Query().Get("user"), scope)
+		if err != nil {
+			if code == http.StatusUnauthorized {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="zap"`)
+			}
+			writeError(w, code, err.Error())
+			return
+		}
+		handler(w, r, sess)
+	})
+}
+
+// session finds the session a request with secret acts in, as the user it
+// names, usually with ?user=, or the token's, if the secret's scope allows
+// scope. It returns the status to answer with when there is none.
+func (s *server) session(secret, requested, scope string) (*session, config.APIToken, int, error) {
+	t, token, ok := authorize(s.tenants, secret)
+	if secret == "" || !ok {
+		return nil, token, http.StatusUnauthorized, errors.New("missing or wrong API token")
+	}
+	if !token.Allows(scope) {
+		return nil, token, http.StatusForbidden, fmt.Errorf("the token's %s scope doesn't allow this", token.Scope)
+	}
+	user, err := t.actAs(token, requested)
+	if err != nil {
+		return nil, token, http.StatusForbidden, err
+	}
+	sess, err := t.session(s.ctx, user)
+	if err != nil {
+		log.Printf("Unable to act for %s of tenant %s: %v", user, t.name, err)
+		return nil, token, http.StatusBadGateway, fmt.Errorf("unable to act for %s", user)
+	}
+	return sess, token, 0, nil
+}
+
+// allowOrigin adds the CORS headers for requests from allowed origins. It
+// reports false for requests from pages of other origins; requests that
+// don't come from a page, such as curl's, carry no origin and are allowed.
+func (s *server) allowOrigin(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	w.Header().Add("Vary", "Origin")
+	if origin == "" {
+		return true
+	}
+	if !slices.Contains(s.origins, origin) {
+		return false
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	return true
+}
+
+// openAPI answers with the OpenAPI document describing the API, which
+// needs no token
+func (s *server) openAPI(w http.ResponseWriter, r *http.Request) {
+	if !s.allowOrigin(w, r) {
+		writeError(w, http.StatusForbidden, "origin not allowed")
+		return
+	}
+	document, err := api.OpenAPI()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(document)
+}
+
+// preflight answers browsers asking whether a page may call the API
+func (s *server) preflight(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Origin") == "" || !s.allowOrigin(w, r) {
+		writeError(w, http.StatusForbidden, "origin not allowed")
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+	w.Header().Set("Access-Control-Max-Age", "600")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// lists answers with the lists tasks can be added to: the inbox and the
+// target lists
+func (s *server) lists(w http.ResponseWriter, r *http.Request, sess *session) {
+	profile := sess.app.profile
+	lists := []string{profile.Inbox}
+	for _, title := range profile.TargetLists {
+		if !slices.Contains(lists, title) {
+			lists = append(lists, title)
+		}
+	}
+	writeJSON(w, http.StatusOK, api.Lists{Inbox: profile.Inbox, Lists: lists})
+}
+
+// quickAdd adds a task to the top of a list, with its link and notes as the
+// task's notes
+func (s *server) quickAdd(w http.ResponseWriter, r *http.Request, sess *session) {
+	var req api.NewTask
+	if !readJSON(w, r, &req) {
+		return
+	}
+	req.Title = strings.TrimSpace(req.Title)
+	if req.Title == "" {
+		req.Title = req.URL
+	}
+	if req.Title == "" {
+		writeError(w, http.StatusBadRequest, "title or url is required")
+		return
+	}
+	task := &todo.Task{Title: req.Title, Status: "needsAction"}
+	var notes []string
+	if req.URL != "" {
+		notes = append(notes, req.URL)
+	}
+	if req.Notes != "" {
+		notes = append(notes, req.Notes)
+	}
+	task.Notes = strings.Join(notes, "\n\n")
+	if req.Due != "" {
+		day, err := time.Parse("2006-01-02", req.Due)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("due must be a YYYY-MM-DD date, not %q", req.Due))
+			return
+		}
+		task.Due = datetime.FormatDue(day)
+	}
+
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if req.List == "" {
+		req.List = sess.app.profile.Inbox
+	}
+	taskList, err := sess.app.service.GetTaskListByTitle(req.List)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	id, err := sess.app.addTask(r.Context(), taskList, task)
+	if err != nil {
+		log.Printf("Error adding '%s' to %s for %s: %v", task.Title, taskList.Title, sess, err)
+		writeError(w, http.StatusBadGateway, "unable to add the task")
+		return
+	}
+	log.Printf("Added '%s' to %s for %s", task.Title, taskList.Title, sess)
+	writeJSON(w, http.StatusCreated, api.Task{ID: id, List: taskList.Title, Title: task.Title})
+}
+
+// addTask adds a task to the top of a list, returning its ID. Dry runs only
+// print the task, so it has none.
+func (a *app) addTask(ctx context.Context, taskList *todo.TaskList, task *todo.Task) (string, error) {
+	results, err := a.orchestrator.Apply(ctx, []tasks.Mutation{{
+		Kind:       tasks.MutationInsert,
+		TaskListID: taskList.ID,
+		Task:       task,
+		Summary:    fmt.Sprintf("create task '%s'", task.Title),
+	}})
+	if err != nil || len(results) == 0 || results[0].Task == nil {
+		return "", err
+	}
+	return results[0].Task.ID, nil
+}
+
+// prioritize queues a run and answers without waiting for it. The user's
+// runs take turns, so it starts once their earlier runs finished.
+func (s *server) prioritize(w http.ResponseWriter, r *http.Request, sess *session) {
+	report, err := sess.start("API: prioritize", jobPrioritize, nil)
+	if err != nil {
+		log.Printf("Unable to queue a run for %s: %v", sess, err)
+		writeError(w, http.StatusInternalServerError, "unable to queue the run")
+		return
+	}
+	writeJSON(w, http.StatusAccepted, api.RunStarted{
+		Status: jobs.Queued,
+		ID:     report.ID,
+		Events: "/api/runs/" + report.ID + "/events",
+		Job:    "/api/jobs/" + report.ID,
+	})
+}
+
+// listJobs answers with the user's queued runs and the history of finished
+// ones
+func (s *server) listJobs(w http.ResponseWriter, r *http.Request, sess *session) {
+	queued, err := sess.jobs.List()
+	if err != nil {
+		log.Printf("Unable to list the jobs of %s: %v", sess, err)
+		writeError(w, http.StatusInternalServerError, "unable to list the jobs")
+		return
+	}
+	list := api.Jobs{Jobs: make([]api.Job, 0, len(queued))}
+	for _, job := range queued {
+		list.Jobs = append(list.Jobs, apiJob(job))
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// getJob answers with one of the user's jobs
+func (s *server) getJob(w http.ResponseWriter, r *http.Request, sess *session) {
+	job, err := sess.jobs.Get(r.PathValue("id"))
+	if err != nil {
+		writeJobError(w, sess, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, apiJob(job))
+}
+
+// retryJob queues a job that failed for good again
+func (s *server) retryJob(w http.ResponseWriter, r *http.Request, sess *session) {
+	job, err := sess.jobs.Retry(r.PathValue("id"))
+	if err != nil {
+		writeJobError(w, sess, err)
+		return
+	}
+	sess.track(job)
+	writeJSON(w, http.StatusAccepted, apiJob(job))
+}
+
+// writeJobError answers with the status of an error of the job queue
+func writeJobError(w http.ResponseWriter, sess *session, err error) {
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, jobs.ErrNotFailed):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		log.Printf("Error reading the jobs of %s: %v", sess, err)
+		writeError(w, http.StatusInternalServerError, "unable to read the jobs")
+	}
+}
+
+// apiJob describes a job and what its last attempt did
+func apiJob(job jobs.Job) api.Job {
+	j := api.Job{
+		ID:       job.ID,
+		Trigger:  job.Trigger,
+		Lists:    job.Lists,
+		State:    job.State,
+		Attempts: job.Attempts,
+		Enqueued: job.Enqueued,
+		Error:    job.Error,
+	}
+	j.Started, j.Finished, j.RetryAt = optionalTime(job.Started), optionalTime(job.Finished), optionalTime(job.RetryAt)
+	if len(job.Result) > 0 {
+		report := jobReport(job)
+		j.Report = &report
+	}
+	return j
+}
+
+// optionalTime returns t, or nil when it is unset
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// jobReport describes what a job's last attempt did, from the report it
+// kept
+func jobReport(job jobs.Job) api.RunReport {
+	var r api.RunReport
+	if len(job.Result) > 0 {
+		json.Unmarshal(job.Result, &r)
+	}
+	r.ID, r.Trigger, r.Started, r.Finished = job.ID, job.Trigger, job.Started, job.Finished
+	if r.Lists == nil {
+		r.Lists = []api.ListReport{}
+	}
+	if job.Error != "" && !slices.Contains(r.Errors, job.Error) {
+		r.Errors = append(r.Errors, job.Error)
+	}
+	return r
+}
+
+// runEvents streams the progress of a run as Server-Sent Events, from its
+// start, then its report once its job finished. The dashboard shows it too.
+// Runs of earlier servers only have their report.
+func (s *server) runEvents(w http.ResponseWriter, r *http.Request, sess *session) {
+	id := r.PathValue("id")
+	report := sess.report(id)
+	if report == nil && id != "" {
+		if job, err := sess.jobs.Get(id); err == nil {
+			if job.Done() {
+				w.Header().Set("Content-Type", "text/event-stream")
+				w.Header().Set("Cache-Control", "no-store")
+				writeEvent(w, "report", jobReport(job))
+				return
+			}
+			report = sess.track(job)
+		}
+	}
+	if report == nil || id == "" {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no run %s", id))
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	// Keep proxies such as nginx from holding events back
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	err := sess.follow(r.Context(), report, func(e progress.Event) error {
+		return writeEvent(w, "progress", api.Progress{
+			Phase:   e.Phase,
+			Item:    e.Item,
+			Done:    e.Done,
+			Total:   e.Total,
+			Ended:   e.Ended,
+			Message: e.Message,
+		})
+	})
+	if err == nil {
+		writeEvent(w, "report", sess.apiReport(report))
+	}
+}
+
+// writeEvent sends a Server-Sent Event with v as its JSON data
+func writeEvent(w http.ResponseWriter, name string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data); err != nil {
+		return err
+	}
+	return http.NewResponseController(w).Flush()
+}
+
+// apiReport describes what a run did, or has done so far
+func (sess *session) apiReport(report *runReport) api.RunReport {
+	sess.reportsMu.Lock()
+	defer sess.reportsMu.Unlock()
+	r := resultReport(report.Result, report.Err)
+	r.ID, r.Trigger, r.Started, r.Finished = report.ID, report.Trigger, report.Started, report.Finished
+	return r
+}
+
+// resultReport describes what a run did, from its result and error
+func resultReport(result *runResult, err error) api.RunReport {
+	r := api.RunReport{Lists: []api.ListReport{}}
+	if err != nil {
+		r.Errors = append(r.Errors, err.Error())
+	}
+	if result != nil {
+		r.DryRun = result.DryRun
+		for _, list := range result.Lists {
+			r.Lists = append(r.Lists, api.ListReport{Title: list.Title, Tasks: list.Tasks, RankedBy: list.RankedBy, Moves: list.Moves})
+		}
+		for _, subtasks := range result.Subtasks {
+			r.Subtasks = append(r.Subtasks, api.SubtaskReport{List: subtasks.List, Created: subtasks.Created, Error: subtasks.Error})
+		}
+		r.Skipped = result.Skipped
+		r.Errors = append(r.Errors, result.Errors...)
+		for _, warning := range result.Warnings {
+			r.Warnings = append(r.Warnings, api.Warning{List: warning.List, Problem: warning.Problem, Fix: warning.Fix})
+		}
+	}
+	return r
+}
+
+// start queues a run of kind in a session, of lists or of all its target
+// lists, and returns the report that follows its progress
+func (sess *session) start(trigger, kind string, lists []string) (*runReport, error) {
+	job, err := sess.jobs.Enqueue(trigger, kind, lists)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Queued through the server for %s: %s", sess, trigger)
+	return sess.track(job), nil
+}
+
+// track returns the report of a job's run, adding one for a job that has
+// none yet, e.g. one queued by an earlier server
+func (sess *session) track(job jobs.Job) *runReport {
+	sess.reportsMu.Lock()
+	defer sess.reportsMu.Unlock()
+	for _, report := range sess.reports {
+		if report.ID == job.ID {
+			if !job.Done() {
+				// A retried job runs again
+				report.Finished = time.Time{}
+			}
+			return report
+		}
+	}
+	report := &runReport{ID: job.ID, Trigger: job.Trigger, Started: job.Enqueued, Finished: job.Finished, changed: make(chan struct{})}
+	sess.reports = append([]*runReport{report}, sess.reports[:min(len(sess.reports), maxRunReports-1)]...)
+	return report
+}
+
+// runJob makes an attempt at a job of the session's queue, keeping its
+// progress in the job's report. A run that fails, or fails for some lists,
+// is tried again.
+func (sess *session) runJob(ctx context.Context, job jobs.Job) (any, error) {
+	sess.running.Lock()
+	defer sess.running.Unlock()
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	report := sess.track(job)
+	sess.reportsMu.Lock()
+	report.Started = job.Started
+	sess.reportsMu.Unlock()
+	log.Printf("Started through the server for %s: %s (attempt %d)", sess, job.Trigger, job.Attempts)
+	stopWatching := sess.app.progress.Watch(func(e progress.Event) {
+		sess.record(report, e)
+	})
+	runErr := sess.app.jobWork(job)(ctx)
+	stopWatching()
+	result := sess.app.result
+
+	sess.reportsMu.Lock()
+	report.Result = result
+	report.Err = runErr
+	sess.reportsMu.Unlock()
+
+	err := runErr
+	if err == nil && result != nil && len(result.Errors) > 0 {
+		err = errors.New(strings.Join(result.Errors, "; "))
+	}
+	if sess.status != nil {
+		sess.status.set(err)
+	}
+	if err != nil {
+		log.Printf("Run for %s failed: %v", sess, err)
+		sess.record(report, progress.Event{Message: fmt.Sprintf("Attempt %d failed: %v", job.Attempts, err)})
+	} else {
+		log.Printf("Run for %s finished", sess)
+	}
+	return sess.apiReport(report), err
+}
+
+// record adds an event to a run's report
+func (sess *session) record(report *runReport, e progress.Event) {
+	sess.reportsMu.Lock()
+	defer sess.reportsMu.Unlock()
+	report.Events = append(report.Events, e)
+	close(report.changed)
+	report.changed = make(chan struct{})
+}
+
+// finish ends the report of a job that succeeded or failed for good, so
+// those following it get its report
+func (sess *session) finish(job jobs.Job) {
+	report := sess.track(job)
+	sess.reportsMu.Lock()
+	defer sess.reportsMu.Unlock()
+	report.Finished = job.Finished
+	close(report.changed)
+	report.changed = make(chan struct{})
+}
+
+// report returns the report of the run with id, or of the latest run when
+// id is empty
+func (sess *session) report(id string) *runReport {
+	sess.reportsMu.Lock()
+	defer sess.reportsMu.Unlock()
+	for _, report := range sess.reports {
+		if id == "" || report.ID == id {
+			return report
+		}
+	}
+	return nil
+}
+
+// follow calls fn with each event of a run, from its first, until the run
+// finishes, ctx is done or fn fails
+func (sess *session) follow(ctx context.Context, report *runReport, fn func(progress.Event) error) error {
+	for next := 0; ; {
+		sess.reportsMu.Lock()
+		events := report.Events[next:]
+		finished := !report.Finished.IsZero()
+		changed := report.changed
+		sess.reportsMu.Unlock()
+
+		for _, e := range events {
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+		next += len(events)
+		if finished {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// readJSON decodes a request's JSON body into v, answering with an error
+// and reporting false when it can't
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return false
+	}
+	return true
+}
+
+// writeJSON answers with v as JSON
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError answers with an error message as JSON
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, api.Error{Error: message})
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// labelPrefix namespaces zap's launchd labels
+const labelPrefix = "com.github.masonbrott."
+
+// Launchd manages services as launchd agents, or daemons for the system
+type Launchd struct{}
+
+func (Launchd) Name() string { return "launchd" }
+
+// label returns the service's launchd label, e.g. com.github.masonbrott.zap
+func label(spec Spec) string {
+	return labelPrefix + spec.Name
+}
+
+// Path returns the property list in the user's LaunchAgents or the
+// system's LaunchDaemons
+func (Launchd) Path(spec Spec) (string, error) {
+	if spec.System {
+		return filepath.Join("/Library/LaunchDaemons", label(spec)+".plist"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "Library", "LaunchAgents", label(spec)+".plist"), nil
+}
+
+// Render returns the property list. launchd starts the service at load and
+// restarts it when it exits with an error.
+func (Launchd) Render(spec Spec) []byte {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	b.WriteString(`<plist version="1.0">` + "\n<dict>\n")
+	plistString(&b, "Label", label(spec))
+	fmt.Fprintf(&b, "\t<key>ProgramArguments</key>\n\t<array>\n")
+	for _, arg := range append([]string{spec.Program}, spec.Args...) {
+		fmt.Fprintf(&b, "\t\t<string>%s</string>\n", escape(arg))
+	}
+	fmt.Fprintf(&b, "\t</array>\n")
+	if spec.Dir != "" {
+		plistString(&b, "WorkingDirectory", spec.Dir)
+	}
+	if spec.System && spec.User != "" {
+		plistString(&b, "UserName", spec.User)
+	}
+	if len(spec.Env) > 0 {
+		fmt.Fprintf(&b, "\t<key>EnvironmentVariables</key>\n\t<dict>\n")
+		for _, name := range spec.envNames() {
+			fmt.Fprintf(&b, "\t\t<key>%s</key>\n\t\t<string>%s</string>\n", escape(name), escape(spec.Env[name]))
+		}
+		fmt.Fprintf(&b, "\t</dict>\n")
+	}
+	fmt.Fprintf(&b, "\t<key>RunAtLoad</key>\n\t<true/>\n")
+	fmt.Fprintf(&b, "\t<key>KeepAlive</key>\n\t<dict>\n\t\t<key>SuccessfulExit</key>\n\t\t<false/>\n\t</dict>\n")
+	if spec.LogFile != "" {
+		plistString(&b, "StandardOutPath", spec.LogFile)
+		plistString(&b, "StandardErrorPath", spec.LogFile)
+	}
+	b.WriteString("</dict>\n</plist>\n")
+	return b.Bytes()
+}
+
+// plistString writes a string entry of the top-level dictionary
+func plistString(b *bytes.Buffer, key, value string) {
+	fmt.Fprintf(b, "\t<key>%s</key>\n\t<string>%s</string>\n", key, escape(value))
+}
+
+// escape escapes s for XML character data
+func escape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func (l Launchd) Start(spec Spec) error {
+	path, err := l.Path(spec)
+	if err != nil {
+		return err
+	}
+	return run("launchctl", "load", "-w", path)
+}
+
+func (l Launchd) Stop(spec Spec) error {
+	path, err := l.Path(spec)
+	if err != nil {
+		return err
+	}
+	return run("launchctl", "unload", "-w", path)
+}
+
+// Status returns launchctl's description of the loaded service
+func (Launchd) Status(spec Spec) (string, error) {
+	out, err := exec.Command("launchctl", "list", label(spec)).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%s isn't loaded", label(spec))
+	}
+	return string(out), nil
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+)
+
+// ErrUnsupported is returned on platforms without a supported service manager
+var ErrUnsupported = errors.New("services are only supported with systemd (Linux) and launchd (macOS)")
+
+// Spec describes the daemon service to install
+type Spec struct {
+	// Name is the unit name or launchd label suffix, e.g. zap or zap-work
+	Name string
+	// Description is shown by the service manager
+	Description string
+	// Program and Args are the command the service runs
+	Program string
+	Args    []string
+	// Dir is the working directory
+	Dir string
+	// Env holds the environment variables the service runs with
+	Env map[string]string
+	// LogFile receives the output where the service manager doesn't keep
+	// it itself (launchd)
+	LogFile string
+	// System installs the service for the whole machine, run as User,
+	// instead of for the current user
+	System bool
+	User   string
+}
+
+// envNames returns the names in the spec's environment in a stable order
+func (s Spec) envNames() []string {
+	names := make([]string, 0, len(s.Env))
+	for name := range s.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Manager installs services with a platform's service manager
+type Manager interface {
+	// Name is the service manager's name
+	Name() string
+	// Path returns where the service's definition is written
+	Path(spec Spec) (string, error)
+	// Render returns the service's definition
+	Render(spec Spec) []byte
+	// Start loads the written definition and starts the service, also at
+	// every boot or login
+	Start(spec Spec) error
+	// Stop stops the service and keeps it from starting again
+	Stop(spec Spec) error
+	// Status returns the service manager's report on the service
+	Status(spec Spec) (string, error)
+}
+
+// ForOS returns the service manager of the platform zap runs on
+func ForOS() (Manager, error) {
+	switch runtime.GOOS {
+	case "linux":
+		return Systemd{}, nil
+	case "darwin":
+		return Launchd{}, nil
+	}
+	return nil, ErrUnsupported
+}
+
+// Install writes the service's definition and starts the service
+func Install(m Manager, spec Spec) (string, error) {
+	path, err := m.Path(spec)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	// The environment may hold API keys
+	if err := os.WriteFile(path, m.Render(spec), 0o600); err != nil {
+		return "", fmt.Errorf("unable to write %s: %v", path, err)
+	}
+	if err := m.Start(spec); err != nil {
+		return path, fmt.Errorf("wrote %s but couldn't start it: %v", path, err)
+	}
+	return path, nil
+}
+
+// Uninstall stops the service and removes its definition
+func Uninstall(m Manager, spec Spec) (string, error) {
+	path, err := m.Path(spec)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return path, fmt.Errorf("%s isn't installed: %v", spec.Name, err)
+	}
+	if err := m.Stop(spec); err != nil {
+		return path, err
+	}
+	if err := os.Remove(path); err != nil {
+		return path, err
+	}
+	return path, nil
+}
+
+// run runs a service manager command, returning its output in errors
+func run(name string, args ...string) error {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %v: %v: %s", name, args, err, out)
+	}
+	return nil
+}
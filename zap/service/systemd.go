@@ -0,0 +1,113 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Systemd manages services as systemd units
+type Systemd struct{}
+
+func (Systemd) Name() string { return "systemd" }
+
+// Path returns the unit file in the user's or the system's unit directory
+func (Systemd) Path(spec Spec) (string, error) {
+	if spec.System {
+		return filepath.Join("/etc/systemd/system", spec.Name+".service"), nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "systemd", "user", spec.Name+".service"), nil
+}
+
+// Render returns the unit file. The service is restarted when it fails,
+// e.g. because the network wasn't up yet.
+func (Systemd) Render(spec Spec) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "[Unit]\n")
+	fmt.Fprintf(&b, "Description=%s\n", spec.Description)
+	fmt.Fprintf(&b, "Wants=network-online.target\n")
+	fmt.Fprintf(&b, "After=network-online.target\n\n")
+
+	fmt.Fprintf(&b, "[Service]\n")
+	fmt.Fprintf(&b, "Type=simple\n")
+	command := []string{systemdQuote(spec.Program)}
+	for _, arg := range spec.Args {
+		command = append(command, systemdQuote(arg))
+	}
+	fmt.Fprintf(&b, "ExecStart=%s\n", strings.Join(command, " "))
+	if spec.Dir != "" {
+		fmt.Fprintf(&b, "WorkingDirectory=%s\n", systemdQuote(spec.Dir))
+	}
+	if spec.System && spec.User != "" {
+		fmt.Fprintf(&b, "User=%s\n", spec.User)
+	}
+	for _, name := range spec.envNames() {
+		fmt.Fprintf(&b, "Environment=%s\n", systemdQuote(name+"="+spec.Env[name]))
+	}
+	fmt.Fprintf(&b, "Restart=on-failure\n")
+	fmt.Fprintf(&b, "RestartSec=30s\n\n")
+
+	fmt.Fprintf(&b, "[Install]\n")
+	if spec.System {
+		fmt.Fprintf(&b, "WantedBy=multi-user.target\n")
+	} else {
+		fmt.Fprintf(&b, "WantedBy=default.target\n")
+	}
+	return b.Bytes()
+}
+
+// systemctl runs systemctl for the spec's service manager instance
+func systemctl(spec Spec, args ...string) error {
+	if !spec.System {
+		args = append([]string{"--user"}, args...)
+	}
+	return run("systemctl", args...)
+}
+
+func (Systemd) Start(spec Spec) error {
+	if err := systemctl(spec, "daemon-reload"); err != nil {
+		return err
+	}
+	return systemctl(spec, "enable", "--now", spec.Name+".service")
+}
+
+func (Systemd) Stop(spec Spec) error {
+	if err := systemctl(spec, "disable", "--now", spec.Name+".service"); err != nil {
+		return err
+	}
+	return systemctl(spec, "daemon-reload")
+}
+
+// Status returns systemctl's status report. systemctl exits with an error
+// for stopped services, so only a missing report is an error.
+func (Systemd) Status(spec Spec) (string, error) {
+	args := []string{"status", "--no-pager", spec.Name + ".service"}
+	if !spec.System {
+		args = append([]string{"--user"}, args...)
+	}
+	out, err := exec.Command("systemctl", args...).CombinedOutput()
+	if len(out) == 0 && err != nil {
+		return "", fmt.Errorf("systemctl status: %v", err)
+	}
+	return string(out), nil
+}
+
+// systemdQuote quotes a word of a unit file setting when it needs it, and
+// escapes the specifiers and variables systemd would otherwise expand
+func systemdQuote(s string) string {
+	s = strings.ReplaceAll(s, "%", "%%")
+	s = strings.ReplaceAll(s, "$", "$$")
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\;") {
+		return s
+	}
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
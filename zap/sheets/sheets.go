@@ -0,0 +1,102 @@
+package sheets
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"zap/tasks"
+
+	sheetsapi "google.golang.org/api/sheets/v4"
+)
+
+// header is the first row of a report sheet
+var header = []interface{}{"Time", "User", "List", "Task", "Old position", "New position", "Priority", "Explanation", "Ranked by"}
+
+// Exporter appends run reports to one sheet of a spreadsheet, one row per
+// ranked task
+type Exporter struct {
+	service       *sheetsapi.Service
+	spreadsheetID string
+	sheet         string
+	user          string
+	// ready is set once the sheet is known to exist
+	ready bool
+}
+
+// New creates an exporter that appends to sheet in the spreadsheet and
+// records user on every row
+func New(service *sheetsapi.Service, spreadsheetID, sheet, user string) *Exporter {
+	return &Exporter{service: service, spreadsheetID: spreadsheetID, sheet: sheet, user: user}
+}
+
+// Append adds a row for every task ranked in lists. The sheet is created
+// when it doesn't exist, and the header row is written when it is empty.
+// Values are written as is, so titles starting with "=" aren't formulas.
+func (e *Exporter) Append(ctx context.Context, at time.Time, lists []tasks.ListResult) error {
+	var values [][]interface{}
+	for _, list := range lists {
+		for _, row := range list.Report {
+			values = append(values, []interface{}{
+				at.Format("2006-01-02 15:04:05"), e.user, list.Title, row.Title,
+				row.OldPosition, row.NewPosition, row.Priority, row.Explanation, list.RankedBy,
+			})
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	if err := e.ensureSheet(ctx); err != nil {
+		return err
+	}
+	existing, err := e.service.Spreadsheets.Values.Get(e.spreadsheetID, e.cells("A1")).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("unable to read sheet %s: %w", e.sheet, err)
+	}
+	if len(existing.Values) == 0 {
+		values = append([][]interface{}{header}, values...)
+	}
+
+	_, err = e.service.Spreadsheets.Values.Append(e.spreadsheetID, e.cells("A1"), &sheetsapi.ValueRange{Values: values}).
+		ValueInputOption("RAW").
+		InsertDataOption("INSERT_ROWS").
+		Context(ctx).
+		Do()
+	if err != nil {
+		return fmt.Errorf("unable to append to sheet %s: %w", e.sheet, err)
+	}
+	return nil
+}
+
+// ensureSheet adds the sheet to the spreadsheet unless it is there already
+func (e *Exporter) ensureSheet(ctx context.Context) error {
+	if e.ready {
+		return nil
+	}
+	spreadsheet, err := e.service.Spreadsheets.Get(e.spreadsheetID).Fields("sheets.properties.title").Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("unable to open spreadsheet %s: %w", e.spreadsheetID, err)
+	}
+	for _, sheet := range spreadsheet.Sheets {
+		if sheet.Properties != nil && sheet.Properties.Title == e.sheet {
+			e.ready = true
+			return nil
+		}
+	}
+
+	add := &sheetsapi.BatchUpdateSpreadsheetRequest{Requests: []*sheetsapi.Request{{
+		AddSheet: &sheetsapi.AddSheetRequest{Properties: &sheetsapi.SheetProperties{Title: e.sheet}},
+	}}}
+	if _, err := e.service.Spreadsheets.BatchUpdate(e.spreadsheetID, add).Context(ctx).Do(); err != nil {
+		return fmt.Errorf("unable to add sheet %s: %w", e.sheet, err)
+	}
+	e.ready = true
+	return nil
+}
+
+// cells returns an A1 range within the sheet, quoting the sheet's name
+func (e *Exporter) cells(ref string) string {
+	return "'" + strings.ReplaceAll(e.sheet, "'", "''") + "'!" + ref
+}
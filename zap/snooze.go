@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"text/tabwriter"
+
+	"zap/notes"
+	"zap/snooze"
+)
+
+// runSnooze hides a task until a day, or lists the snoozed tasks when no
+// task is given
+func runSnooze(args []string) {
+	flags := flag.NewFlagSet("snooze", flag.ExitOnError)
+	runOpts := registerRunFlags(flags)
+	until := flags.String("until", "", "Day the task comes back, as YYYY-MM-DD")
+	listTitle := flags.String("list", "", "Task list the task is in (default: search the profile's target lists)")
+
+	positional := parseInterspersed(flags, args)
+	if len(positional) > 1 {
+		log.Fatal("usage: zap snooze <task> --until YYYY-MM-DD [--list <list>], or zap snooze to list snoozed tasks")
+	}
+	if len(positional) == 1 && *until == "" {
+		log.Fatal("--until is required")
+	}
+
+	ctx := context.Background()
+	app, err := runOpts.newApp(ctx, flags)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer app.Close()
+
+	if len(positional) == 0 {
+		if err := app.printSnoozed(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if err := app.snooze(ctx, positional[0], *listTitle, *until); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// snoozer returns the manager for the profile's snoozed tasks
+func (a *app) snoozer() *snooze.Manager {
+	manager := snooze.NewManager(a.service, a.orchestrator, a.store, a.clock, a.profile.SnoozeList, a.dryRun)
+	manager.SetNotes(slices.Contains(a.noteLog, notes.Snooze))
+	manager.SetNamespace(a.namespace)
+	return manager
+}
+
+// snooze finds a task by ID or title and snoozes it until the given day
+func (a *app) snooze(ctx context.Context, query, listTitle, until string) error {
+	manager := a.snoozer()
+	day, err := manager.ParseDay(until)
+	if err != nil {
+		return err
+	}
+
+	taskList, task, err := a.findTask(query, listTitle)
+	if err != nil {
+		return err
+	}
+
+	listLock, err := a.lockList(ctx, taskList)
+	if err != nil {
+		return err
+	}
+	defer listLock.Release()
+
+	if err := manager.Snooze(ctx, taskList, task, day); err != nil {
+		return err
+	}
+	if !a.dryRun {
+		fmt.Printf("Snoozed '%s' until %s\n", task.Title, day.Format("Monday 2006-01-02"))
+	}
+	return nil
+}
+
+// printSnoozed lists the snoozed tasks, soonest to wake first
+func (a *app) printSnoozed() error {
+	entries, err := a.snoozer().List()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Println("No snoozed tasks")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "UNTIL\tLIST\tTASK")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", entry.Until, entry.ListTitle, entry.Title)
+	}
+	return w.Flush()
+}
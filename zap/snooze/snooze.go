@@ -0,0 +1,236 @@
+package snooze
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"zap/datetime"
+	"zap/notes"
+	"zap/store"
+	"zap/tasks"
+	"zap/todo"
+)
+
+// bucket is the store bucket holding snoozed tasks, keyed by task ID
+const bucket = "snoozed"
+
+// dayLayout is how wake days are written and parsed
+const dayLayout = "2006-01-02"
+
+// Entry records a snoozed task and the list it goes back to
+type Entry struct {
+	TaskID    string    `json:"taskId"`
+	Title     string    `json:"title"`
+	ListID    string    `json:"listId"`
+	ListTitle string    `json:"listTitle"`
+	Until     string    `json:"until"`
+	Snoozed   time.Time `json:"snoozed"`
+}
+
+// Manager moves tasks into the snoozed list and back once their day comes
+type Manager struct {
+	service      *tasks.Service
+	orchestrator *tasks.Orchestrator
+	store        *store.Store
+	clock        *datetime.Clock
+	listTitle    string
+	// readOnly managers plan their writes but record nothing, for dry runs
+	readOnly  bool
+	notes     bool
+	namespace notes.Namespace
+}
+
+// NewManager creates a manager that keeps snoozed tasks in the list titled
+// listTitle. A read-only manager doesn't change the store or create the list.
+func NewManager(service *tasks.Service, orchestrator *tasks.Orchestrator, st *store.Store, clock *datetime.Clock, listTitle string, readOnly bool) *Manager {
+	return &Manager{
+		service:      service,
+		orchestrator: orchestrator,
+		store:        st,
+		clock:        clock,
+		listTitle:    listTitle,
+		readOnly:     readOnly,
+	}
+}
+
+// SetNotes makes the manager log snoozing and waking in the tasks' notes
+func (m *Manager) SetNotes(enabled bool) {
+	m.notes = enabled
+}
+
+// SetNamespace sets the namespace of zap's block in notes, which the log
+// is kept in
+func (m *Manager) SetNamespace(ns notes.Namespace) {
+	m.namespace = ns
+}
+
+// ParseDay reads a wake day as midnight in the clock's time zone
+func (m *Manager) ParseDay(value string) (time.Time, error) {
+	day, err := time.ParseInLocation(dayLayout, value, m.clock.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q (want YYYY-MM-DD)", value)
+	}
+	return day, nil
+}
+
+// Snooze moves a task from its list to the snoozed list until the given
+// day. The snoozed list is created when it doesn't exist.
+func (m *Manager) Snooze(ctx context.Context, taskList *todo.TaskList, task *todo.Task, until time.Time) error {
+	if !until.After(m.clock.Today()) {
+		return fmt.Errorf("snooze until %s: the day must be after today", until.Format(dayLayout))
+	}
+	if task.Parent != "" {
+		return fmt.Errorf("'%s' is a subtask; snooze its parent instead", task.Title)
+	}
+	snoozed, err := m.snoozedList(ctx, true)
+	if err != nil {
+		return err
+	}
+	if snoozed.ID == taskList.ID {
+		return fmt.Errorf("'%s' is already in %s", task.Title, snoozed.Title)
+	}
+
+	var mutations []tasks.Mutation
+	if m.notes {
+		updated := *task
+		updated.Notes = m.namespace.Append(task.Notes, notes.Entry{Time: m.clock.Now(), Kind: notes.Snooze, Text: fmt.Sprintf("snoozed until %s, from %s", until.Format(dayLayout), taskList.Title)})
+		mutations = append(mutations, tasks.Mutation{
+			Kind:       tasks.MutationUpdate,
+			TaskListID: taskList.ID,
+			Task:       &updated,
+			Before:     task,
+			Summary:    fmt.Sprintf("note snooze in '%s'", task.Title),
+		})
+	}
+	mutations = append(mutations, tasks.Mutation{
+		Kind:        tasks.MutationMove,
+		TaskListID:  taskList.ID,
+		Task:        task,
+		Destination: snoozed.ID,
+		Summary:     fmt.Sprintf("move '%s' to %s until %s", task.Title, snoozed.Title, until.Format(dayLayout)),
+	})
+	if _, err := m.orchestrator.Apply(ctx, mutations); err != nil {
+		return err
+	}
+	if m.readOnly {
+		return nil
+	}
+	return m.store.Put(bucket, task.ID, Entry{
+		TaskID:    task.ID,
+		Title:     task.Title,
+		ListID:    taskList.ID,
+		ListTitle: taskList.Title,
+		Until:     until.Format(dayLayout),
+		Snoozed:   m.clock.Now(),
+	})
+}
+
+// Wake moves every task whose day has come back to the top of the list it
+// was snoozed from, so the next ranking places it. Tasks that were deleted,
+// completed or moved out of the snoozed list meanwhile are forgotten. It
+// returns how many tasks woke; tasks that couldn't be moved are reported
+// and stay snoozed.
+func (m *Manager) Wake(ctx context.Context) (int, error) {
+	entries, err := m.List()
+	if err != nil || len(entries) == 0 {
+		return 0, err
+	}
+	today := m.clock.Today().Format(dayLayout)
+	if entries[0].Until > today {
+		return 0, nil
+	}
+	snoozed, err := m.snoozedList(ctx, false)
+	if err != nil {
+		return 0, err
+	}
+
+	woken := 0
+	var errs []error
+	for _, entry := range entries {
+		if entry.Until > today {
+			break
+		}
+		task, err := m.service.GetTask(ctx, snoozed.ID, entry.TaskID)
+		switch {
+		case tasks.IsNotFound(err):
+			errs = append(errs, m.forget(entry))
+			continue
+		case err != nil:
+			errs = append(errs, fmt.Errorf("waking '%s': %v", entry.Title, err))
+			continue
+		case task.Deleted || task.Status == "completed":
+			errs = append(errs, m.forget(entry))
+			continue
+		}
+
+		var mutations []tasks.Mutation
+		if m.notes {
+			updated := *task
+			updated.Notes = m.namespace.Append(task.Notes, notes.Entry{Time: m.clock.Now(), Kind: notes.Snooze, Text: fmt.Sprintf("woke up, back in %s", entry.ListTitle)})
+			mutations = append(mutations, tasks.Mutation{
+				Kind:       tasks.MutationUpdate,
+				TaskListID: snoozed.ID,
+				Task:       &updated,
+				Before:     task,
+				Summary:    fmt.Sprintf("note wake-up in '%s'", task.Title),
+			})
+		}
+		mutations = append(mutations, tasks.Mutation{
+			Kind:        tasks.MutationMove,
+			TaskListID:  snoozed.ID,
+			Task:        task,
+			Destination: entry.ListID,
+			Summary:     fmt.Sprintf("move '%s' back to %s", task.Title, entry.ListTitle),
+		})
+		if _, err := m.orchestrator.Apply(ctx, mutations); err != nil {
+			errs = append(errs, fmt.Errorf("waking '%s': %v", entry.Title, err))
+			continue
+		}
+		woken++
+		errs = append(errs, m.forget(entry))
+	}
+	return woken, errors.Join(errs...)
+}
+
+// List returns the snoozed tasks, soonest to wake first
+func (m *Manager) List() ([]Entry, error) {
+	var entries []Entry
+	for _, key := range m.store.Keys(bucket) {
+		var entry Entry
+		if _, err := m.store.Get(bucket, key, &entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Until != entries[j].Until {
+			return entries[i].Until < entries[j].Until
+		}
+		return entries[i].Title < entries[j].Title
+	})
+	return entries, nil
+}
+
+// forget drops a snoozed task from the store
+func (m *Manager) forget(entry Entry) error {
+	if m.readOnly {
+		return nil
+	}
+	return m.store.Delete(bucket, entry.TaskID)
+}
+
+// snoozedList finds the snoozed list, creating it when create is set.
+// Read-only managers only pretend to create it.
+func (m *Manager) snoozedList(ctx context.Context, create bool) (*todo.TaskList, error) {
+	taskList, err := m.service.GetTaskListByTitle(m.listTitle)
+	if !errors.Is(err, tasks.ErrListNotFound) || !create {
+		return taskList, err
+	}
+	if m.readOnly {
+		return &todo.TaskList{Title: m.listTitle}, nil
+	}
+	return m.service.CreateTaskList(ctx, m.listTitle)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"zap/tasks"
+)
+
+// runStats reports throughput, time to completion and churn for the
+// profile's target lists from the tasks and the ranking history
+func runStats(args []string) {
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	runOpts := registerRunFlags(flags)
+	var listTitles listFlag
+	flags.Var(&listTitles, "list", "Task list to report on (repeatable; default: the profile's target lists)")
+	weeks := flags.Int("weeks", 8, "Number of weeks of throughput to show")
+	minReprioritized := flags.Int("min-reprioritized", 3, "List tasks whose rank changed in more than this many runs")
+	output := flags.String("output", outputText, "Output format: text or json")
+	flags.Parse(args)
+	if *output != outputText && *output != outputJSON {
+		log.Fatalf("unknown output format %q (want %s or %s)", *output, outputText, outputJSON)
+	}
+	if *weeks < 1 {
+		log.Fatal("--weeks must be at least 1")
+	}
+	if *output == outputJSON {
+		runOpts.out = os.Stderr
+	}
+
+	ctx := context.Background()
+	app, err := runOpts.newApp(ctx, flags)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer app.Close()
+
+	if len(listTitles) == 0 {
+		listTitles = app.profile.TargetLists
+	}
+	var lists []tasks.ListTasks
+	for _, listTitle := range listTitles {
+		taskList, err := app.service.GetTaskListByTitle(listTitle)
+		if err != nil {
+			log.Fatal(err)
+		}
+		listTasks, err := app.service.ListAllTasks(ctx, taskList.ID)
+		if err != nil {
+			log.Fatalf("Error fetching tasks for list %s: %v", listTitle, err)
+		}
+		lists = append(lists, tasks.ListTasks{Title: taskList.Title, Tasks: listTasks})
+	}
+	records, err := tasks.NewHistory(app.store, true).Records()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	stats := tasks.ComputeStats(lists, records, app.clock, *weeks, *minReprioritized)
+	if *output == outputJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(stats); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	printStats(stats)
+}
+
+// printStats prints the stats as tables
+func printStats(stats tasks.Stats) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "WEEK\tSTARTING\tCOMPLETED")
+	for _, week := range stats.Weeks {
+		fmt.Fprintf(w, "%s\t%s\t%d\n", week.Week, week.Start, week.Completed)
+	}
+	w.Flush()
+
+	fmt.Println()
+	fmt.Fprintln(w, "LIST\tOPEN\tCOMPLETED\tMEDIAN DAYS TO COMPLETE")
+	for _, list := range stats.Lists {
+		median := "-"
+		if list.MedianDays != nil {
+			median = fmt.Sprintf("%.1f (of %d)", *list.MedianDays, list.Measured)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", list.List, list.Open, list.Completed, median)
+	}
+	w.Flush()
+
+	fmt.Println()
+	if len(stats.Reprioritized) == 0 {
+		fmt.Printf("No tasks were reprioritized more than %d times.\n", stats.MinReprioritized)
+		return
+	}
+	fmt.Printf("Reprioritized more than %d times:\n", stats.MinReprioritized)
+	fmt.Fprintln(w, "TIMES\tLIST\tTASK")
+	for _, task := range stats.Reprioritized {
+		fmt.Fprintf(w, "%d\t%s\t%s\n", task.Times, task.List, task.Title)
+	}
+	w.Flush()
+}
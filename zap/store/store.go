@@ -0,0 +1,253 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"zap/lock"
+)
+
+// lockTimeout is how long a change waits for another process to finish
+// writing the file
+const lockTimeout = 30 * time.Second
+
+// Store is a small key/value store persisted as a single JSON file. Values
+// are grouped into buckets (one per feature) and written through on every
+// change, so state survives between runs.
+//
+// Several zap processes may share the file, e.g. the daemon and a run
+// from the command line. Each change takes a lock on the file, reads it
+// again and changes only its own key, so no process's writes replace
+// another's. Reads pick up the file again when another process changed it.
+type Store struct {
+	path string
+	mu   sync.Mutex
+	data map[string]map[string]json.RawMessage
+	// loaded is the file as it was when last read or written; nil when it
+	// didn't exist
+	loaded os.FileInfo
+}
+
+// Open loads the store at path, starting empty if the file doesn't exist
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, data: make(map[string]map[string]json.RawMessage)}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load reads the file, replacing what was read before
+func (s *Store) load() error {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		s.data = make(map[string]map[string]json.RawMessage)
+		s.loaded = nil
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read store: %v", err)
+	}
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return fmt.Errorf("unable to read store: %v", err)
+	}
+	parsed := make(map[string]map[string]json.RawMessage)
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &parsed); err != nil {
+			return fmt.Errorf("unable to parse store %s: %v", s.path, err)
+		}
+	}
+	s.data = parsed
+	s.loaded = info
+	return nil
+}
+
+// refresh reads the file again if another process wrote it since it was
+// last read. Every save replaces the file, so a changed file is a
+// different file.
+func (s *Store) refresh() error {
+	info, err := os.Stat(s.path)
+	if errors.Is(err, os.ErrNotExist) && s.loaded == nil {
+		return nil
+	}
+	if err == nil && s.loaded != nil && os.SameFile(info, s.loaded) && info.ModTime().Equal(s.loaded.ModTime()) && info.Size() == s.loaded.Size() {
+		return nil
+	}
+	return s.load()
+}
+
+// change applies a change to one key under the file's lock, to the file
+// as it is now, and saves it
+func (s *Store) change(apply func() (bool, error)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), lockTimeout)
+	defer cancel()
+	// The lock sits with the list locks next to the file
+	l, err := lock.Acquire(ctx, filepath.Join(filepath.Dir(s.path), "locks"), "store:"+filepath.Base(s.path), nil)
+	var held *lock.HeldError
+	if errors.As(err, &held) {
+		return fmt.Errorf("store %s is still locked by %s after %s", s.path, held.Holder, lockTimeout)
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := l.Release(); err != nil {
+			log.Print(err)
+		}
+	}()
+
+	if err := s.refresh(); err != nil {
+		return err
+	}
+	if ok, err := apply(); !ok || err != nil {
+		return err
+	}
+	return s.save()
+}
+
+// Path returns the file backing the store
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Get decodes the value stored under bucket/key into v. It reports whether
+// the key exists.
+func (s *Store) Get(bucket, key string, v interface{}) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.refresh(); err != nil {
+		return false, err
+	}
+	raw, ok := s.data[bucket][key]
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return true, fmt.Errorf("unable to decode %s/%s: %v", bucket, key, err)
+	}
+	return true, nil
+}
+
+// Put stores v under bucket/key and saves the store
+func (s *Store) Put(bucket, key string, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("unable to encode %s/%s: %v", bucket, key, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.change(func() (bool, error) {
+		if s.data[bucket] == nil {
+			s.data[bucket] = make(map[string]json.RawMessage)
+		}
+		s.data[bucket][key] = raw
+		return true, nil
+	})
+}
+
+// Update changes the value under bucket/key with no other process writing
+// the store in between. The value as it is in the file is decoded into v,
+// which is left as it is when there is none; update changes v and reports
+// whether to store it.
+func (s *Store) Update(bucket, key string, v interface{}, update func(found bool) (bool, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.change(func() (bool, error) {
+		raw, found := s.data[bucket][key]
+		if found {
+			if err := json.Unmarshal(raw, v); err != nil {
+				return false, fmt.Errorf("unable to decode %s/%s: %v", bucket, key, err)
+			}
+		}
+		if ok, err := update(found); !ok || err != nil {
+			return false, err
+		}
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return false, fmt.Errorf("unable to encode %s/%s: %v", bucket, key, err)
+		}
+		if s.data[bucket] == nil {
+			s.data[bucket] = make(map[string]json.RawMessage)
+		}
+		s.data[bucket][key] = raw
+		return true, nil
+	})
+}
+
+// Delete removes bucket/key and saves the store
+func (s *Store) Delete(bucket, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.change(func() (bool, error) {
+		if _, ok := s.data[bucket][key]; !ok {
+			return false, nil
+		}
+		delete(s.data[bucket], key)
+		return true, nil
+	})
+}
+
+// Keys returns the keys in a bucket in sorted order
+func (s *Store) Keys(bucket string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.refresh(); err != nil {
+		log.Printf("Error reading store: %v", err)
+	}
+	keys := make([]string, 0, len(s.data[bucket]))
+	for key := range s.data[bucket] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// save writes the store atomically by renaming a temporary file into place
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode store: %v", err)
+	}
+
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("unable to create store directory: %v", err)
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("unable to write store: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to write store: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to write store: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("unable to write store: %v", err)
+	}
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return fmt.Errorf("unable to write store: %v", err)
+	}
+	s.loaded = info
+	return nil
+}
@@ -0,0 +1,131 @@
+package store
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestStoresSharingAFileKeepEachOthersWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	first, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := first.Put("history", "a", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Put("recurring", "b", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Delete("missing", "c"); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []struct{ bucket, key string }{{"history", "a"}, {"recurring", "b"}} {
+		var v int
+		if found, err := reopened.Get(key.bucket, key.key, &v); err != nil || !found {
+			t.Errorf("%s/%s: found %v, err %v", key.bucket, key.key, found, err)
+		}
+	}
+}
+
+func TestStoreReadsOtherProcessesWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	reader, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writer.Put("jobs", "1", "queued"); err != nil {
+		t.Fatal(err)
+	}
+	var state string
+	if found, err := reader.Get("jobs", "1", &state); err != nil || !found || state != "queued" {
+		t.Fatalf("got %q, found %v, err %v; want the other store's write", state, found, err)
+	}
+	if err := writer.Delete("jobs", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if keys := reader.Keys("jobs"); len(keys) != 0 {
+		t.Fatalf("keys %v after the other store deleted them", keys)
+	}
+}
+
+func TestConcurrentPutsAreAllKept(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	stores := make([]*Store, 4)
+	for i := range stores {
+		s, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stores[i] = s
+	}
+
+	var wg sync.WaitGroup
+	for i, s := range stores {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				if err := s.Put("outbox", string(rune('a'+i))+string(rune('0'+j)), j); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := reopened.Keys("outbox"); len(keys) != 20 {
+		t.Fatalf("got %d keys, want 20: %v", len(keys), keys)
+	}
+}
+
+func TestUpdateChangesTheStoredValue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	first, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Put("counts", "runs", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	var runs int
+	err = second.Update("counts", "runs", &runs, func(found bool) (bool, error) {
+		if !found {
+			t.Error("the other store's value wasn't found")
+		}
+		runs++
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got int
+	if _, err := first.Get("counts", "runs", &got); err != nil || got != 2 {
+		t.Fatalf("got %d, err %v; want 2", got, err)
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"google.golang.org/api/pubsub/v1"
+
+	"zap/auth"
+	"zap/config"
+)
+
+const (
+	// ackDeadline is how long Pub/Sub waits for the outcome of a run
+	// before redelivering its message; runs in progress extend it every
+	// ackExtendEvery
+	ackDeadline    = 60 * time.Second
+	ackExtendEvery = 30 * time.Second
+	// pullRetry is how long to wait after a failed pull
+	pullRetry = 10 * time.Second
+)
+
+// trigger is what a Pub/Sub message asks for: a run for User, with the
+// settings of Profile if given. It is the message's JSON data, or its
+// attributes of the same names.
+type trigger struct {
+	User    string `json:"user"`
+	Profile string `json:"profile"`
+}
+
+// runSubscribe runs prioritization for the user named in each message of
+// a Pub/Sub subscription, until interrupted. A message is only acked once
+// its run succeeded; otherwise it is released to be delivered again.
+func runSubscribe(args []string) {
+	flags := flag.NewFlagSet("subscribe", flag.ExitOnError)
+	runOpts := registerRunFlags(flags)
+	subscription := flags.String("subscription", "", "Pub/Sub subscription to pull from, as projects/PROJECT/subscriptions/NAME")
+	credentials := flags.String("pubsub-credentials", "", "Service account key to pull with (default: the profile's service account, else application default credentials)")
+	healthAddr := flags.String("health", "", "Serve /healthz and /readyz on this address, e.g. :8080 in a container")
+	flags.Parse(args)
+	if !strings.HasPrefix(*subscription, "projects/") || !strings.Contains(*subscription, "/subscriptions/") {
+		log.Fatal("--subscription must be given as projects/PROJECT/subscriptions/NAME")
+	}
+
+	// Nobody is there to confirm changes; deleting tasks still takes --force
+	*runOpts.yes = true
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cfg, _, _ := loadConfig(flags, *runOpts.configPath)
+	profile, err := cfg.Profile(*runOpts.profileName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *credentials == "" && profile.Auth == config.AuthServiceAccount {
+		if _, err := os.Stat(profile.Credentials); err == nil {
+			*credentials = profile.Credentials
+		}
+	}
+	client, err := auth.CreatePubSubClient(ctx, *credentials)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var status health
+	if *healthAddr != "" {
+		go func() {
+			if err := status.serve(ctx, *healthAddr); err != nil {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	log.Printf("Waiting for messages on %s", *subscription)
+	subscriptions := client.Projects.Subscriptions
+	for {
+		// One message at a time, so that runs don't compete for lists
+		pulled, err := subscriptions.Pull(*subscription, &pubsub.PullRequest{MaxMessages: 1}).Context(ctx).Do()
+		if ctx.Err() != nil {
+			log.Println("Stopped")
+			return
+		}
+		status.set(err)
+		if err != nil {
+			log.Printf("Pulling from %s failed: %v", *subscription, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(pullRetry):
+			}
+			continue
+		}
+		for _, received := range pulled.ReceivedMessages {
+			handleTrigger(ctx, subscriptions, *subscription, received, func(t trigger) error {
+				return runTrigger(ctx, runOpts, cfg, t)
+			})
+		}
+	}
+}
+
+// handleTrigger runs a received message's trigger, keeping the message
+// from being redelivered while it runs. The message is acked when the run
+// succeeds and released otherwise. Messages that don't name a user, or
+// name a profile that doesn't exist, are acked and dropped, since no
+// redelivery can make them run.
+func handleTrigger(ctx context.Context, subscriptions *pubsub.ProjectsSubscriptionsService, subscription string, received *pubsub.ReceivedMessage, run func(trigger) error) {
+	id := received.Message.MessageId
+	t, err := parseTrigger(received.Message)
+	if err == nil {
+		done, extended := make(chan struct{}), make(chan struct{})
+		go func() {
+			extendAckDeadline(ctx, subscriptions, subscription, received.AckId, done)
+			close(extended)
+		}()
+		err = run(t)
+		// An extension still in flight would undo a release
+		close(done)
+		<-extended
+		if err != nil {
+			err = fmt.Errorf("run for %s failed: %w", t.User, err)
+		}
+	} else {
+		err = &invalidTriggerError{err}
+	}
+
+	// The outcome is reported even while shutting down
+	replyCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var invalid *invalidTriggerError
+	switch {
+	case err == nil || errors.As(err, &invalid):
+		if err != nil {
+			log.Printf("Dropping message %s: %v", id, err)
+		}
+		_, err := subscriptions.Acknowledge(subscription, &pubsub.AcknowledgeRequest{AckIds: []string{received.AckId}}).Context(replyCtx).Do()
+		if err != nil {
+			log.Printf("Unable to ack message %s, so it will be delivered again: %v", id, err)
+		} else if invalid == nil {
+			log.Printf("Ran for %s (message %s)", t.User, id)
+		}
+	default:
+		log.Printf("Releasing message %s to be delivered again: %v", id, err)
+		release := &pubsub.ModifyAckDeadlineRequest{AckIds: []string{received.AckId}, AckDeadlineSeconds: 0, ForceSendFields: []string{"AckDeadlineSeconds"}}
+		if _, err := subscriptions.ModifyAckDeadline(subscription, release).Context(replyCtx).Do(); err != nil {
+			log.Printf("Unable to release message %s, it will be delivered again once its deadline passes: %v", id, err)
+		}
+	}
+}
+
+// invalidTriggerError is a message that doesn't say what to run
+type invalidTriggerError struct {
+	err error
+}
+
+func (e *invalidTriggerError) Error() string {
+	return e.err.Error()
+}
+
+// parseTrigger reads the trigger from a message's JSON data, filling in
+// what it lacks from the message's attributes
+func parseTrigger(message *pubsub.PubsubMessage) (trigger, error) {
+	var t trigger
+	if message.Data != "" {
+		data, err := base64.StdEncoding.DecodeString(message.Data)
+		if err != nil {
+			return t, fmt.Errorf("unable to decode data: %v", err)
+		}
+		if err := json.Unmarshal(data, &t); err != nil {
+			return t, fmt.Errorf("data isn't a JSON object with user and profile: %v", err)
+		}
+	}
+	if t.User == "" {
+		t.User = message.Attributes["user"]
+	}
+	if t.Profile == "" {
+		t.Profile = message.Attributes["profile"]
+	}
+	if t.User == "" {
+		return t, errors.New("no user named in the data or the attributes")
+	}
+	return t, nil
+}
+
+// extendAckDeadline keeps a message from being redelivered until done is
+// closed
+func extendAckDeadline(ctx context.Context, subscriptions *pubsub.ProjectsSubscriptionsService, subscription, ackID string, done <-chan struct{}) {
+	ticker := time.NewTicker(ackExtendEvery)
+	defer ticker.Stop()
+	extend := &pubsub.ModifyAckDeadlineRequest{AckIds: []string{ackID}, AckDeadlineSeconds: int64(ackDeadline / time.Second)}
+	for {
+		// The subscription's own deadline may be shorter than the first tick
+		if _, err := subscriptions.ModifyAckDeadline(subscription, extend).Context(ctx).Do(); err != nil && ctx.Err() == nil {
+			log.Printf("Unable to extend the deadline of a message: %v", err)
+		}
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runTrigger runs prioritization for a trigger's user with its profile,
+// or the one selected by --profile. Only a run without errors succeeds.
+func runTrigger(ctx context.Context, runOpts *runFlags, cfg *config.Config, t trigger) error {
+	name := t.Profile
+	if name == "" {
+		name = *runOpts.profileName
+	}
+	profile, err := cfg.Profile(name)
+	if err != nil {
+		return &invalidTriggerError{err}
+	}
+	opts := *runOpts
+	opts.userEmail = &t.User
+	app, err := opts.profileApp(ctx, profile)
+	if err != nil {
+		return err
+	}
+	defer app.Close()
+	if err := app.run(ctx); err != nil {
+		return err
+	}
+	if len(app.result.Errors) > 0 {
+		return errors.New(strings.Join(app.result.Errors, "; "))
+	}
+	return nil
+}
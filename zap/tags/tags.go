@@ -0,0 +1,114 @@
+package tags
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"zap/todo"
+)
+
+// Google Tasks has no labels, so zap uses hashtags such as #deep-work in a
+// task's title or notes. Tags are case-insensitive and stored lowercase.
+
+// Waiting marks tasks blocked on someone else; prioritization ranks them low
+const Waiting = "waiting"
+
+// tagPattern matches a hashtag at the start of the text or after whitespace
+var tagPattern = regexp.MustCompile(`(^|\s)#([A-Za-z][A-Za-z0-9_-]*)`)
+
+// Normalize lowercases a tag and strips a leading '#'
+func Normalize(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+}
+
+// Parse returns the distinct tags in text, sorted
+func Parse(text string) []string {
+	seen := make(map[string]bool)
+	var found []string
+	for _, match := range tagPattern.FindAllStringSubmatch(text, -1) {
+		tag := Normalize(match[2])
+		if !seen[tag] {
+			seen[tag] = true
+			found = append(found, tag)
+		}
+	}
+	sort.Strings(found)
+	return found
+}
+
+// Of returns the tags in a task's title and notes, sorted
+func Of(task *todo.Task) []string {
+	return Parse(task.Title + "\n" + task.Notes)
+}
+
+// Has reports whether a task carries tag
+func Has(task *todo.Task, tag string) bool {
+	tag = Normalize(tag)
+	for _, t := range Of(task) {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAll reports whether a task carries every tag in want
+func HasAll(task *todo.Task, want []string) bool {
+	for _, tag := range want {
+		if !Has(task, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// Add appends tag to the task's notes unless the task already has it. It
+// reports whether the task changed.
+func Add(task *todo.Task, tag string) bool {
+	tag = Normalize(tag)
+	if tag == "" || Has(task, tag) {
+		return false
+	}
+	if task.Notes == "" {
+		task.Notes = "#" + tag
+	} else {
+		task.Notes = strings.TrimRight(task.Notes, "\n") + "\n#" + tag
+	}
+	return true
+}
+
+// Remove deletes every occurrence of tag from the task's title and notes.
+// It reports whether the task changed.
+func Remove(task *todo.Task, tag string) bool {
+	tag = Normalize(tag)
+	if !Has(task, tag) {
+		return false
+	}
+	task.Title = strip(task.Title, tag)
+	task.Notes = strip(task.Notes, tag)
+	return true
+}
+
+// strip removes tag from text. Lines left empty by the removal are dropped.
+func strip(text, tag string) string {
+	lines := strings.Split(text, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		stripped := tagPattern.ReplaceAllStringFunc(line, func(match string) string {
+			sub := tagPattern.FindStringSubmatch(match)
+			if Normalize(sub[2]) == tag {
+				return sub[1]
+			}
+			return match
+		})
+		if stripped != line {
+			stripped = strings.Join(strings.Fields(stripped), " ")
+			if stripped == "" {
+				continue
+			}
+		}
+		kept = append(kept, stripped)
+	}
+	return strings.Join(kept, "\n")
+}
@@ -0,0 +1,81 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"google.golang.org/api/googleapi"
+
+	"zap/auth"
+)
+
+// AccessProblem is a list a run couldn't read, and how to fix it. Runs
+// leave such lists out and carry on with the rest.
+type AccessProblem struct {
+	List    string `json:"list"`
+	Problem string `json:"problem"`
+	Fix     string `json:"fix"`
+}
+
+// CheckAccess reads a list the way a run does and returns the problem when
+// the user may not. Errors that say nothing about access, such as a network
+// failure, or a token missing the Tasks scopes, are returned as they are.
+func (s *Service) CheckAccess(title string) (*AccessProblem, error) {
+	taskList, err := s.GetTaskListByTitle(title)
+	if errors.Is(err, ErrListNotFound) {
+		return &AccessProblem{
+			List:    title,
+			Problem: err.Error(),
+			Fix:     "create the list in Google Tasks as the user, or fix target_lists in the profile",
+		}, nil
+	}
+	if err == nil {
+		_, err = s.service.Tasks.List(taskList.ID).MaxResults(1).Do()
+		if err != nil {
+			err = fmt.Errorf("unable to retrieve tasks: %w", err)
+		}
+	}
+	if err == nil || !isDenied(err) {
+		return nil, err
+	}
+
+	problem := &AccessProblem{List: title, Problem: err.Error()}
+	switch {
+	case taskList == nil && hasReason(err, "accessNotConfigured"):
+		problem.Fix = "enable the Google Tasks API for the credentials' project in the Google Cloud console"
+	case taskList == nil:
+		// None of the user's lists could be read, which is how the API
+		// answers for users without Google Tasks
+		problem.Fix = "turn Google Tasks on for the user's organizational unit in the Admin console (Apps > Google Workspace > Tasks); changes can take a few minutes to apply"
+	case IsNotFound(err):
+		problem.Fix = "the list was deleted while the run started; run again, or fix target_lists in the profile"
+	default:
+		problem.Fix = "check that the user can still open the list in Google Tasks, or drop it from target_lists in the profile"
+	}
+	return problem, nil
+}
+
+// isDenied reports whether err is the API refusing the user, rather than
+// failing: a 403 for anything but missing scopes, or a 404
+func isDenied(err error) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || auth.IsInsufficientScope(err) {
+		return false
+	}
+	return apiErr.Code == http.StatusForbidden || apiErr.Code == http.StatusNotFound
+}
+
+// hasReason reports whether err is an API error giving reason
+func hasReason(err error, reason string) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	for _, item := range apiErr.Errors {
+		if item.Reason == reason {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"zap/todo"
+	"zap/todo/googletasks"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// defaultBatchConcurrency is the number of inserts in flight at once
+	defaultBatchConcurrency = 4
+	// defaultBatchRate is the sustained number of inserts per second
+	defaultBatchRate = 5
+)
+
+// BatchResult is the outcome of inserting one task in a batch. Index refers
+// to the position of the task in the slice passed to BatchCreateTasks.
+type BatchResult struct {
+	Index int
+	Task  *todo.Task
+	Err   error
+}
+
+// WithBatchLimits sets how many inserts BatchCreateTasks runs concurrently
+// and how many it starts per second
+func WithBatchLimits(concurrency int, perSecond float64) ServiceOption {
+	return func(s *Service) {
+		if concurrency > 0 {
+			s.batchConcurrency = concurrency
+		}
+		if perSecond > 0 {
+			s.batchLimiter = rate.NewLimiter(rate.Limit(perSecond), s.batchConcurrency)
+		}
+	}
+}
+
+// BatchCreateTasks inserts tasks using a bounded worker pool with rate
+// limiting. A task's Parent field is honored. Tasks sharing a parent are
+// inserted one after another using Previous, so they appear under the parent
+// in input order; different parents are filled concurrently. Every task gets
+// a result, in input order, so callers can report partial failures.
+func (s *Service) BatchCreateTasks(ctx context.Context, taskListID string, tasks []*todo.Task) []BatchResult {
+	results := make([]BatchResult, len(tasks))
+	if err := s.checkWritable("unable to create tasks"); err != nil {
+		for i := range tasks {
+			results[i] = BatchResult{Index: i, Err: err}
+		}
+		return results
+	}
+
+	chains := insertChains(tasks)
+	jobs := make(chan []int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(s.batchConcurrency, len(chains)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chain := range jobs {
+				var previous string
+				for _, i := range chain {
+					created, err := s.insertTask(ctx, taskListID, tasks[i], previous)
+					results[i] = BatchResult{Index: i, Task: created, Err: err}
+					if err == nil {
+						previous = created.ID
+					}
+				}
+			}
+		}()
+	}
+
+	for _, chain := range chains {
+		jobs <- chain
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// insertChains groups task indexes by parent, keeping input order within each
+// group and ordering groups by first appearance
+func insertChains(tasks []*todo.Task) [][]int {
+	var chains [][]int
+	byParent := make(map[string]int)
+	for i, task := range tasks {
+		c, ok := byParent[task.Parent]
+		if !ok {
+			c = len(chains)
+			byParent[task.Parent] = c
+			chains = append(chains, nil)
+		}
+		chains[c] = append(chains[c], i)
+	}
+	return chains
+}
+
+// CreateTasks inserts tasks in a batch and returns the ones that were
+// created along with a combined error for the ones that weren't
+func (s *Service) CreateTasks(ctx context.Context, taskListID string, tasks []*todo.Task) ([]*todo.Task, error) {
+	var created []*todo.Task
+	var errs []error
+	for _, result := range s.BatchCreateTasks(ctx, taskListID, tasks) {
+		if result.Err != nil {
+			errs = append(errs, fmt.Errorf("'%s': %v", tasks[result.Index].Title, result.Err))
+			continue
+		}
+		created = append(created, result.Task)
+	}
+	return created, errors.Join(errs...)
+}
+
+// insertTask waits for the rate limiter and inserts a single task after
+// previous, or first among its siblings when previous is empty
+func (s *Service) insertTask(ctx context.Context, taskListID string, task *todo.Task, previous string) (*todo.Task, error) {
+	if err := s.batchLimiter.Wait(ctx); err != nil {
+		return nil, fmt.Errorf("unable to create task: %v", err)
+	}
+
+	insertCall := s.service.Tasks.Insert(taskListID, googletasks.APITask(task))
+	if task.Parent != "" {
+		insertCall = insertCall.Parent(task.Parent)
+	}
+	if previous != "" {
+		insertCall = insertCall.Previous(previous)
+	}
+	created, err := insertCall.Context(ctx).Do()
+	if err != nil {
+		return nil, writeError("unable to create task", err)
+	}
+	return googletasks.Task(created), nil
+}
@@ -0,0 +1,80 @@
+package tasks
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"zap/todo"
+)
+
+// childTitles returns the titles of a parent's subtasks in the backend's
+// sibling order, or of the top-level tasks when parent is empty
+func childTitles(tasks []*todo.Task, parent string) []string {
+	var titles []string
+	for _, task := range NewTaskTree(tasks).Flatten() {
+		if task.Parent == parent {
+			titles = append(titles, task.Title)
+		}
+	}
+	return titles
+}
+
+func TestBatchCreateTasksKeepsSubtasksInOrder(t *testing.T) {
+	backend, service := newTestService(t, WithBatchLimits(4, 1000))
+	listID := backend.AddList("Work")
+	report := backend.AddTask(listID, &todo.Task{Title: "Write report"})
+	launch := backend.AddTask(listID, &todo.Task{Title: "Plan launch"})
+	backend.AddTask(listID, &todo.Task{Title: "Existing step", Parent: report})
+
+	// Two parents' chains are interleaved so they're filled in parallel
+	batch := []*todo.Task{
+		{Title: "Outline", Parent: report},
+		{Title: "Pick a date", Parent: launch},
+		{Title: "Draft", Parent: report},
+		{Title: "Book a venue", Parent: launch},
+		{Title: "Edit", Parent: report},
+		{Title: "Send invites", Parent: launch},
+		{Title: "Publish", Parent: report},
+	}
+	results := service.BatchCreateTasks(context.Background(), listID, batch)
+	for i, result := range results {
+		if result.Index != i {
+			t.Errorf("result %d has index %d", i, result.Index)
+		}
+		if result.Err != nil {
+			t.Fatalf("inserting %q: %v", batch[i].Title, result.Err)
+		}
+		if result.Task.Title != batch[i].Title || result.Task.Parent != batch[i].Parent {
+			t.Errorf("result %d is %q under %q, want %q under %q", i, result.Task.Title, result.Task.Parent, batch[i].Title, batch[i].Parent)
+		}
+	}
+
+	tasks := backend.Tasks(listID)
+	// New subtasks go first among their siblings, in input order
+	if got, want := childTitles(tasks, report), []string{"Outline", "Draft", "Edit", "Publish", "Existing step"}; !slices.Equal(got, want) {
+		t.Errorf("subtasks of Write report = %q, want %q", got, want)
+	}
+	if got, want := childTitles(tasks, launch), []string{"Pick a date", "Book a venue", "Send invites"}; !slices.Equal(got, want) {
+		t.Errorf("subtasks of Plan launch = %q, want %q", got, want)
+	}
+	if got, want := childTitles(tasks, ""), []string{"Write report", "Plan launch"}; !slices.Equal(got, want) {
+		t.Errorf("top-level tasks = %q, want %q", got, want)
+	}
+}
+
+func TestInsertChainsGroupsByParent(t *testing.T) {
+	tasks := []*todo.Task{
+		{Title: "a1", Parent: "a"},
+		{Title: "top"},
+		{Title: "b1", Parent: "b"},
+		{Title: "a2", Parent: "a"},
+		{Title: "b2", Parent: "b"},
+		{Title: "a3", Parent: "a"},
+	}
+	got := insertChains(tasks)
+	want := [][]int{{0, 3, 5}, {1}, {2, 4}}
+	if !slices.EqualFunc(got, want, slices.Equal[[]int]) {
+		t.Errorf("insertChains() = %v, want %v", got, want)
+	}
+}
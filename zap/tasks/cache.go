@@ -0,0 +1,196 @@
+package tasks
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	tasksapi "google.golang.org/api/tasks/v1"
+
+	"zap/store"
+	"zap/todo"
+	"zap/todo/googletasks"
+)
+
+// cacheBucket holds the user's task lists and tasks as earlier runs read
+// them, so later runs only fetch what changed since
+const cacheBucket = "tasks-cache"
+
+// listsKey is the cache key of the user's task lists; the tasks of a list
+// are kept under its ID
+const listsKey = "lists"
+
+// fullSyncAge is how long a list's cached tasks are brought up to date from
+// their changes before the list is read in full again, so a change the
+// Tasks API didn't report can't linger
+const fullSyncAge = 7 * 24 * time.Hour
+
+// syncOverlap is how far before the last read changes are asked for again,
+// so tasks changed while it ran, or with the server's clock a little
+// behind, aren't missed
+const syncOverlap = time.Minute
+
+// cachedLists is the user's task lists with the ETag they were read with
+type cachedLists struct {
+	ETag  string           `json:"etag"`
+	Lists []*todo.TaskList `json:"lists"`
+}
+
+// cachedTasks is every task of a list, including completed and hidden ones
+type cachedTasks struct {
+	// Full is when the list was last read in full
+	Full time.Time `json:"full"`
+	// Synced is when the tasks were last brought up to date
+	Synced time.Time    `json:"synced"`
+	Tasks  []*todo.Task `json:"tasks"`
+}
+
+// WithCache keeps the user's task lists and tasks in st between runs. The
+// lists are read again, every page of them, only when the ETag of their
+// first page changed, and tasks only when they were updated since the last
+// read, which keeps runs for many users within the Tasks API's quota. Only
+// for Google Tasks, whose list calls take updatedMin.
+func WithCache(st *store.Store) ServiceOption {
+	return func(s *Service) {
+		s.cache = st
+	}
+}
+
+// fetchTaskLists reads the user's task lists across all pages, from the
+// cache when they didn't change since it was filled
+func (s *Service) fetchTaskLists() ([]*todo.TaskList, error) {
+	if s.cache == nil {
+		var lists []*todo.TaskList
+		err := s.service.Tasklists.List().
+			MaxResults(100).
+			Pages(context.Background(), func(page *tasksapi.TaskLists) error {
+				lists = append(lists, googletasks.TaskLists(page.Items)...)
+				return nil
+			})
+		if err != nil {
+			return nil, err
+		}
+		return lists, nil
+	}
+
+	var cached cachedLists
+	if _, err := s.cache.Get(cacheBucket, listsKey, &cached); err != nil {
+		log.Printf("Reading the task lists again: %v", err)
+		cached = cachedLists{}
+	}
+	call := s.service.Tasklists.List().MaxResults(100)
+	if cached.ETag != "" {
+		call = call.IfNoneMatch(cached.ETag)
+	}
+	tasklists, err := call.Do()
+	if googleapi.IsNotModified(err) {
+		return cached.Lists, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The first page's ETag stands for all of them: the following pages
+	// are only read again when it changed
+	lists := googletasks.TaskLists(tasklists.Items)
+	etag := tasklists.Etag
+	for token := tasklists.NextPageToken; token != ""; token = tasklists.NextPageToken {
+		tasklists, err = s.service.Tasklists.List().MaxResults(100).PageToken(token).Do()
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, googletasks.TaskLists(tasklists.Items)...)
+	}
+	if err := s.cache.Put(cacheBucket, listsKey, cachedLists{ETag: etag, Lists: lists}); err != nil {
+		log.Printf("Unable to cache the task lists: %v", err)
+	}
+	return lists, nil
+}
+
+// syncTasks returns every task of a list, including completed and hidden
+// ones. With a cache, only the tasks updated since the last read are
+// fetched and merged into the cached ones.
+func (s *Service) syncTasks(ctx context.Context, taskListID string) ([]*todo.Task, error) {
+	var cached cachedTasks
+	found, err := s.cache.Get(cacheBucket, taskListID, &cached)
+	if err != nil {
+		log.Printf("Reading all tasks of list %s again: %v", taskListID, err)
+		found = false
+	}
+
+	started := time.Now()
+	full := !found || started.Sub(cached.Full) > fullSyncAge
+	call := s.service.Tasks.List(taskListID).
+		ShowCompleted(true).
+		ShowHidden(true).
+		MaxResults(100)
+	if !full {
+		// Deleted tasks are asked for to drop them from the cache
+		call = call.
+			ShowDeleted(true).
+			UpdatedMin(cached.Synced.Add(-syncOverlap).UTC().Format(time.RFC3339))
+	}
+	var changed []*todo.Task
+	err = call.Pages(ctx, func(page *tasksapi.Tasks) error {
+		changed = append(changed, googletasks.Tasks(page.Items)...)
+		return nil
+	})
+	if err != nil {
+		if found && IsNotFound(err) {
+			s.dropCachedTasks(taskListID)
+		}
+		return nil, err
+	}
+
+	if full {
+		cached = cachedTasks{Full: started, Tasks: changed}
+	} else {
+		cached.Tasks = mergeTasks(cached.Tasks, changed)
+	}
+	cached.Synced = started
+	if err := s.cache.Put(cacheBucket, taskListID, cached); err != nil {
+		log.Printf("Unable to cache the tasks of list %s: %v", taskListID, err)
+	}
+	return cached.Tasks, nil
+}
+
+// dropCachedTasks makes the next read of a list a full one. Moves change
+// where other tasks stand without updating them, so zap's own moves drop
+// the list's cache.
+func (s *Service) dropCachedTasks(taskListIDs ...string) {
+	if s.cache == nil {
+		return
+	}
+	for _, taskListID := range taskListIDs {
+		if err := s.cache.Delete(cacheBucket, taskListID); err != nil {
+			log.Printf("Unable to drop the cached tasks of list %s: %v", taskListID, err)
+		}
+	}
+}
+
+// mergeTasks applies changed tasks to cached ones: deleted tasks are
+// dropped, changed ones replaced where they were, and new ones added
+func mergeTasks(cached, changed []*todo.Task) []*todo.Task {
+	updates := make(map[string]*todo.Task, len(changed))
+	for _, task := range changed {
+		updates[task.ID] = task
+	}
+
+	merged := make([]*todo.Task, 0, len(cached)+len(changed))
+	for _, task := range cached {
+		if update, ok := updates[task.ID]; ok {
+			delete(updates, task.ID)
+			task = update
+		}
+		if !task.Deleted {
+			merged = append(merged, task)
+		}
+	}
+	for _, task := range changed {
+		if _, ok := updates[task.ID]; ok && !task.Deleted {
+			merged = append(merged, task)
+		}
+	}
+	return merged
+}
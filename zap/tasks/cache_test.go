@@ -0,0 +1,190 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"zap/store"
+	"zap/todo"
+	"zap/zaptest"
+)
+
+// newCachedService returns a service with a cache talking to a fresh
+// in-memory backend, and the cache's store
+func newCachedService(t *testing.T) (*zaptest.Backend, *Service, *store.Store) {
+	t.Helper()
+	st, err := store.Open(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend, service := newTestService(t, WithCache(st))
+	return backend, service, st
+}
+
+// lastRead returns the most recent list call the backend answered
+func lastRead(t *testing.T, backend *zaptest.Backend) string {
+	t.Helper()
+	reads := backend.Reads()
+	if len(reads) == 0 {
+		t.Fatal("no reads")
+	}
+	return reads[len(reads)-1]
+}
+
+func TestListTasksSyncsChangesIntoTheCache(t *testing.T) {
+	tests := []struct {
+		name string
+		// change is made between the two reads; ids are those of One, Two
+		// and Three
+		change func(t *testing.T, backend *zaptest.Backend, service *Service, st *store.Store, listID string, ids []string)
+		want   []string
+		full   bool
+	}{
+		{
+			name: "update keeps its slot",
+			change: func(t *testing.T, backend *zaptest.Backend, service *Service, st *store.Store, listID string, ids []string) {
+				backend.EditTask(listID, ids[1], func(task *todo.Task) { task.Title = "Two, edited" })
+			},
+			want: []string{"One", "Two, edited", "Three"},
+		},
+		{
+			name: "delete drops the task",
+			change: func(t *testing.T, backend *zaptest.Backend, service *Service, st *store.Store, listID string, ids []string) {
+				backend.RemoveTask(listID, ids[0])
+			},
+			want: []string{"Two", "Three"},
+		},
+		{
+			name: "insert is added",
+			change: func(t *testing.T, backend *zaptest.Backend, service *Service, st *store.Store, listID string, ids []string) {
+				backend.AddTask(listID, &todo.Task{Title: "Four"})
+			},
+			want: []string{"One", "Two", "Three", "Four"},
+		},
+		{
+			name: "update, delete and insert",
+			change: func(t *testing.T, backend *zaptest.Backend, service *Service, st *store.Store, listID string, ids []string) {
+				backend.EditTask(listID, ids[2], func(task *todo.Task) { task.Title = "Three, edited" })
+				backend.RemoveTask(listID, ids[1])
+				backend.AddTask(listID, &todo.Task{Title: "Four"})
+			},
+			want: []string{"One", "Three, edited", "Four"},
+		},
+		{
+			name: "old cache is read in full",
+			change: func(t *testing.T, backend *zaptest.Backend, service *Service, st *store.Store, listID string, ids []string) {
+				var cached cachedTasks
+				if _, err := st.Get(cacheBucket, listID, &cached); err != nil {
+					t.Fatal(err)
+				}
+				cached.Full = time.Now().Add(-fullSyncAge - time.Hour)
+				if err := st.Put(cacheBucket, listID, cached); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: []string{"One", "Two", "Three"},
+			full: true,
+		},
+		{
+			name: "move by zap reads in full",
+			change: func(t *testing.T, backend *zaptest.Backend, service *Service, st *store.Store, listID string, ids []string) {
+				if _, err := service.MoveTask(listID, ids[2], ""); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: []string{"Three", "One", "Two"},
+			full: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			backend, service, st := newCachedService(t)
+			listID := backend.AddList("Work")
+			var ids []string
+			for _, title := range []string{"One", "Two", "Three"} {
+				ids = append(ids, backend.AddTask(listID, &todo.Task{Title: title}))
+			}
+			if _, err := service.ListTasks(listID); err != nil {
+				t.Fatal(err)
+			}
+			if read := lastRead(t, backend); strings.Contains(read, "updatedMin") {
+				t.Fatalf("first read %s asked for changes only", read)
+			}
+
+			test.change(t, backend, service, st, listID, ids)
+			tasks, err := service.ListTasks(listID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := titles(tasks); !slices.Equal(got, test.want) {
+				t.Errorf("second read = %q, want %q", got, test.want)
+			}
+			read := lastRead(t, backend)
+			if full := !strings.Contains(read, "updatedMin"); full != test.full {
+				t.Errorf("second read %s is full: %v, want %v", read, full, test.full)
+			}
+			if !test.full && !strings.Contains(read, "showDeleted=true") {
+				t.Errorf("second read %s doesn't ask for deleted tasks", read)
+			}
+		})
+	}
+}
+
+func TestListTasksDropsTheCacheOfADeletedList(t *testing.T) {
+	backend, service, st := newCachedService(t)
+	listID := backend.AddList("Work")
+	backend.AddTask(listID, &todo.Task{Title: "One"})
+	if _, err := service.ListTasks(listID); err != nil {
+		t.Fatal(err)
+	}
+
+	api, err := backend.Service(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := api.Tasklists.Delete(listID).Do(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.ListTasks(listID); !IsNotFound(err) {
+		t.Fatalf("reading a deleted list = %v, want not found", err)
+	}
+	if found, err := st.Get(cacheBucket, listID, &cachedTasks{}); err != nil || found {
+		t.Errorf("cached tasks of the deleted list are still there (%v)", err)
+	}
+}
+
+func TestListTaskListsRereadsOnlyWhenTheFirstPageChanged(t *testing.T) {
+	backend, service, _ := newCachedService(t)
+	for i := 1; i <= 130; i++ {
+		backend.AddList(fmt.Sprintf("List %d", i))
+	}
+
+	read := func(want int) int {
+		t.Helper()
+		backend.ResetReads()
+		service.ResetCache()
+		lists, err := service.ListTaskLists()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(lists) != want {
+			t.Fatalf("got %d lists, want %d", len(lists), want)
+		}
+		return len(backend.Reads())
+	}
+	if calls := read(130); calls != 2 {
+		t.Errorf("first read took %d calls, want 2 pages", calls)
+	}
+	if calls := read(130); calls != 1 {
+		t.Errorf("unchanged lists took %d calls, want 1", calls)
+	}
+	backend.AddList("List 131")
+	if calls := read(131); calls != 2 {
+		t.Errorf("changed lists took %d calls, want 2 pages", calls)
+	}
+}
@@ -0,0 +1,145 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"zap/auth"
+	"zap/datetime"
+	"zap/store"
+)
+
+// checkpointBucket holds the mutations interrupted runs left to apply,
+// keyed by when each batch of mutations started
+const checkpointBucket = "checkpoints"
+
+// Checkpoint is what an interrupted batch of mutations still had to apply.
+// Applied counts the mutations it got through.
+type Checkpoint struct {
+	ID      string     `json:"id"`
+	Started time.Time  `json:"started"`
+	Applied int        `json:"applied"`
+	Pending []Mutation `json:"pending"`
+}
+
+// Checkpointer wraps a Writer and keeps the mutations not yet applied in
+// the store while it works through them. A run that is cancelled, loses
+// its token or crashes halfway through reordering a list leaves a
+// checkpoint behind, so the rest can be applied later instead of the list
+// staying half-sorted.
+type Checkpointer struct {
+	writer Writer
+	store  *store.Store
+	clock  *datetime.Clock
+
+	mu  sync.Mutex
+	seq int
+}
+
+// NewCheckpointer creates a checkpointer that forwards mutations to writer
+func NewCheckpointer(writer Writer, st *store.Store, clock *datetime.Clock) *Checkpointer {
+	return &Checkpointer{writer: writer, store: st, clock: clock}
+}
+
+// Apply forwards mutations one write at a time, runs of inserts into the
+// same list counting as one, and checkpoints the rest before each. It
+// stops at the first write that fails because the context was cancelled
+// or the credentials stopped working, and keeps the checkpoint; the
+// mutations it didn't get to fail with the cause. A batch that runs to the
+// end drops its checkpoint, whatever else failed.
+func (c *Checkpointer) Apply(ctx context.Context, mutations []Mutation) []BatchResult {
+	results := make([]BatchResult, len(mutations))
+	// Nothing was written yet, e.g. the run was interrupted while ranking
+	if err := ctx.Err(); err != nil {
+		return notApplied(results, 0, err)
+	}
+
+	checkpoint := Checkpoint{ID: c.nextID(), Started: c.clock.Now()}
+	for i := 0; i < len(mutations); {
+		j := i + 1
+		if mutations[i].Kind == MutationInsert {
+			for j < len(mutations) && mutations[j].Kind == MutationInsert && mutations[j].TaskListID == mutations[i].TaskListID {
+				j++
+			}
+		}
+		checkpoint.Pending = mutations[i:]
+		c.save(checkpoint)
+
+		var interrupted []Mutation
+		var cause error
+		for _, result := range c.writer.Apply(ctx, mutations[i:j]) {
+			result.Index += i
+			results[result.Index] = result
+			if result.Err == nil {
+				checkpoint.Applied++
+				continue
+			}
+			if ctx.Err() != nil || auth.IsAuthError(result.Err) {
+				interrupted = append(interrupted, mutations[result.Index])
+				cause = result.Err
+			}
+		}
+		if cause != nil {
+			if ctx.Err() != nil {
+				cause = ctx.Err()
+			}
+			checkpoint.Pending = append(interrupted, mutations[j:]...)
+			c.save(checkpoint)
+			return notApplied(results, j, cause)
+		}
+		i = j
+	}
+	if err := c.store.Delete(checkpointBucket, checkpoint.ID); err != nil {
+		log.Printf("Error dropping checkpoint: %v", err)
+	}
+	return results
+}
+
+// nextID names a new checkpoint; batches can start at the same instant
+func (c *Checkpointer) nextID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	return fmt.Sprintf("%s-%d", c.clock.Now().UTC().Format(time.RFC3339Nano), c.seq)
+}
+
+// save keeps checkpoint. A failure is only logged: the writes themselves
+// are still worth making.
+func (c *Checkpointer) save(checkpoint Checkpoint) {
+	if err := c.store.Put(checkpointBucket, checkpoint.ID, checkpoint); err != nil {
+		log.Printf("Error saving checkpoint: %v", err)
+	}
+}
+
+// notApplied fails the results from i on, which were never attempted
+func notApplied(results []BatchResult, i int, cause error) []BatchResult {
+	for ; i < len(results); i++ {
+		results[i] = BatchResult{Index: i, Err: fmt.Errorf("not applied, run interrupted: %w", cause)}
+	}
+	return results
+}
+
+// Checkpoints returns what interrupted runs left to apply, oldest first
+func Checkpoints(st *store.Store) ([]Checkpoint, error) {
+	var checkpoints []Checkpoint
+	for _, key := range st.Keys(checkpointBucket) {
+		var checkpoint Checkpoint
+		if _, err := st.Get(checkpointBucket, key, &checkpoint); err != nil {
+			return nil, err
+		}
+		checkpoints = append(checkpoints, checkpoint)
+	}
+	sort.SliceStable(checkpoints, func(i, j int) bool {
+		return checkpoints[i].Started.Before(checkpoints[j].Started)
+	})
+	return checkpoints, nil
+}
+
+// DropCheckpoint forgets a checkpoint, once it is resumed or discarded
+func DropCheckpoint(st *store.Store, checkpoint Checkpoint) error {
+	return st.Delete(checkpointBucket, checkpoint.ID)
+}
@@ -0,0 +1,79 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"zap/todo"
+
+	"google.golang.org/api/googleapi"
+)
+
+// maxConflictRetries is how often an update is re-read and retried when the
+// task keeps changing under it
+const maxConflictRetries = 3
+
+// ErrConflict matches every ConflictError
+var ErrConflict = errors.New("task was changed elsewhere")
+
+// ConflictError is returned for an update to a task that was changed
+// elsewhere since zap read it, e.g. in the phone app. Fields are the ones
+// both changed; the other change is kept and zap's is dropped.
+type ConflictError struct {
+	TaskID string
+	Title  string
+	Fields []string
+}
+
+func (e *ConflictError) Error() string {
+	if len(e.Fields) == 0 {
+		return fmt.Sprintf("'%s' was changed elsewhere while zap updated it; kept the other change", e.Title)
+	}
+	return fmt.Sprintf("'%s' was changed elsewhere while zap updated it (%s); kept the other change", e.Title, strings.Join(e.Fields, ", "))
+}
+
+// Is makes errors.Is(err, ErrConflict) match
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// isPreconditionFailed reports whether a write was refused because the
+// task's ETag no longer matched
+func isPreconditionFailed(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed
+}
+
+// ifMatch makes a write conditional on the task still having etag; an
+// empty etag writes unconditionally
+func ifMatch(header http.Header, etag string) {
+	if etag != "" {
+		header.Set("If-Match", etag)
+	}
+}
+
+// rebase applies the fields update changed from before onto current, the
+// task as it is now, so fields changed elsewhere since before are kept.
+// It returns the fields both changed to different values, in which case
+// the update must not be applied.
+func rebase(update, before, current *todo.Task) (*todo.Task, []string) {
+	rebased := *current
+	var conflicts []string
+	field := func(name string, ours, base, theirs string, set func(string)) {
+		if ours == base {
+			return
+		}
+		if theirs != base && theirs != ours {
+			conflicts = append(conflicts, name)
+			return
+		}
+		set(ours)
+	}
+	field("title", update.Title, before.Title, current.Title, func(v string) { rebased.Title = v })
+	field("notes", update.Notes, before.Notes, current.Notes, func(v string) { rebased.Notes = v })
+	field("due", update.Due, before.Due, current.Due, func(v string) { rebased.Due = v })
+	field("status", update.Status, before.Status, current.Status, func(v string) { rebased.Status = v })
+	return &rebased, conflicts
+}
@@ -0,0 +1,129 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"zap/datetime"
+	"zap/gemini"
+	"zap/todo"
+)
+
+// DefaultOverdueMarker is prefixed to the titles of escalated tasks
+const DefaultOverdueMarker = "[OVERDUE]"
+
+// EscalationPolicy moves tasks overdue by more than OverdueDays to the top of
+// their list and marks their titles. It is applied after ranking, so it holds
+// whether Gemini or the heuristic produced the order.
+type EscalationPolicy struct {
+	OverdueDays int
+	Marker      string
+	// OnEscalate is called for every escalated task, e.g. to notify the user
+	OnEscalate func(ctx context.Context, listTitle string, task *todo.Task, daysOverdue int)
+}
+
+// escalatedTask is a task past the policy's threshold
+type escalatedTask struct {
+	task        *todo.Task
+	daysOverdue int
+}
+
+// overdue returns the tasks past the threshold, most overdue first
+func (e *EscalationPolicy) overdue(tasks []*todo.Task, clock *datetime.Clock) []escalatedTask {
+	var escalated []escalatedTask
+	for _, task := range tasks {
+		days, ok := clock.DaysUntil(task.Due)
+		if ok && -days > e.OverdueDays {
+			escalated = append(escalated, escalatedTask{task: task, daysOverdue: -days})
+		}
+	}
+	sort.SliceStable(escalated, func(i, j int) bool {
+		return escalated[i].daysOverdue > escalated[j].daysOverdue
+	})
+	return escalated
+}
+
+// boost moves the escalated tasks to the top band of priorities
+func boost(priorities []gemini.TaskPriority, escalated []escalatedTask) []gemini.TaskPriority {
+	if len(escalated) == 0 {
+		return priorities
+	}
+
+	byID := make(map[string]gemini.TaskPriority, len(priorities))
+	for _, priority := range priorities {
+		byID[priority.TaskID] = priority
+	}
+
+	boosted := make([]gemini.TaskPriority, 0, len(priorities))
+	seen := make(map[string]bool)
+	for _, e := range escalated {
+		priority, ok := byID[e.task.ID]
+		if !ok {
+			priority = gemini.TaskPriority{TaskID: e.task.ID}
+		}
+		priority.Priority = 100
+		priority.Explanation = fmt.Sprintf("escalated: overdue by %d days", e.daysOverdue)
+		boosted = append(boosted, priority)
+		seen[e.task.ID] = true
+	}
+	for _, priority := range priorities {
+		if !seen[priority.TaskID] {
+			boosted = append(boosted, priority)
+		}
+	}
+	for i := range boosted {
+		boosted[i].NewPosition = fmt.Sprintf("%05d", i+1)
+	}
+	return boosted
+}
+
+// markerMutations adds the marker to escalated tasks and removes it from
+// tasks that are no longer past the threshold
+func (e *EscalationPolicy) markerMutations(taskListID string, tasks []*todo.Task, escalated []escalatedTask) []Mutation {
+	marker := e.Marker
+	if marker == "" {
+		marker = DefaultOverdueMarker
+	}
+	isEscalated := make(map[string]bool, len(escalated))
+	for _, e := range escalated {
+		isEscalated[e.task.ID] = true
+	}
+
+	var mutations []Mutation
+	for _, task := range tasks {
+		hasMarker := strings.Contains(strings.ToUpper(task.Title), strings.ToUpper(marker))
+		var title, summary string
+		switch {
+		case isEscalated[task.ID] && !hasMarker:
+			title = marker + " " + task.Title
+			summary = fmt.Sprintf("mark '%s' as %s", task.Title, marker)
+		case !isEscalated[task.ID] && hasMarker:
+			title = removeMarker(task.Title, marker)
+			summary = fmt.Sprintf("remove %s from '%s'", marker, task.Title)
+		default:
+			continue
+		}
+
+		updated := *task
+		updated.Title = title
+		mutations = append(mutations, Mutation{
+			Kind:       MutationUpdate,
+			TaskListID: taskListID,
+			Task:       &updated,
+			Before:     task,
+			Summary:    summary,
+		})
+	}
+	return mutations
+}
+
+// removeMarker drops marker from title, ignoring case
+func removeMarker(title, marker string) string {
+	i := strings.Index(strings.ToUpper(title), strings.ToUpper(marker))
+	if i < 0 {
+		return title
+	}
+	return strings.Join(strings.Fields(title[:i]+title[i+len(marker):]), " ")
+}
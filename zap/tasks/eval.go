@@ -0,0 +1,246 @@
+package tasks
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"zap/datetime"
+)
+
+// minEvalRuns is how many scored runs a configuration needs to be named
+// the best
+const minEvalRuns = 3
+
+// evalTop is how many of the first ranked tasks count as a hit when the
+// first task completed after a run is among them
+const evalTop = 3
+
+// Evaluation compares the orders zap ranked lists in against the order
+// their tasks were completed in afterwards
+type Evaluation struct {
+	// Days is the window after each run in which completions count
+	Days int `json:"days"`
+	// Runs counts the runs that could be scored: at least two tasks ranked
+	// and one of them completed within the window
+	Runs    int           `json:"runs"`
+	Configs []ConfigScore `json:"configs"`
+	Weeks   []WeekScore   `json:"weeks"`
+	// Best is the configuration with the highest correlation over at least
+	// minEvalRuns runs
+	Best string `json:"best,omitempty"`
+}
+
+// Score is the agreement of a set of runs with what was completed.
+// Tau is the mean Kendall rank correlation between the ranked order and
+// the completion order, from -1 (reversed) to 1 (the same); HitRate is the
+// share of runs whose first completed task was ranked in the top three.
+type Score struct {
+	Runs    int      `json:"runs"`
+	Tau     *float64 `json:"tau,omitempty"`
+	HitRate *float64 `json:"hitRate,omitempty"`
+}
+
+// ConfigScore scores the runs of one provider and ranking prompt
+type ConfigScore struct {
+	Config string `json:"config"`
+	Source string `json:"source"`
+	Prompt string `json:"prompt,omitempty"`
+	Score
+}
+
+// WeekScore scores the runs of one week
+type WeekScore struct {
+	Week  string `json:"week"`
+	Start string `json:"start"`
+	Score
+}
+
+// scoreSum accumulates the scores of runs
+type scoreSum struct {
+	runs int
+	tau  float64
+	hits int
+}
+
+func (s *scoreSum) add(tau float64, hit bool) {
+	s.runs++
+	s.tau += tau
+	if hit {
+		s.hits++
+	}
+}
+
+func (s scoreSum) score() Score {
+	score := Score{Runs: s.runs}
+	if s.runs > 0 {
+		tau := math.Round(s.tau/float64(s.runs)*100) / 100
+		hitRate := math.Round(float64(s.hits)/float64(s.runs)*100) / 100
+		score.Tau = &tau
+		score.HitRate = &hitRate
+	}
+	return score
+}
+
+// Evaluate scores runs against when their tasks were completed, keyed by
+// task ID. Completions more than days after a run don't count for it, and
+// tasks not completed within the window tie behind those that were. Runs
+// whose window hasn't ended yet are scored on what was completed so far.
+func Evaluate(runs []RunSnapshot, completed map[string]time.Time, clock *datetime.Clock, days, weeks int) Evaluation {
+	eval := Evaluation{Days: days}
+
+	today := clock.Today()
+	thisWeek := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+	starts := make([]time.Time, weeks)
+	for i := range starts {
+		starts[i] = thisWeek.AddDate(0, 0, -7*(weeks-1-i))
+	}
+	weekSums := make([]scoreSum, weeks)
+
+	configSums := make(map[string]*scoreSum)
+	var configs []ConfigScore
+	window := time.Duration(days) * 24 * time.Hour
+	for _, run := range runs {
+		tau, hit, ok := scoreRun(run, completed, window)
+		if !ok {
+			continue
+		}
+		eval.Runs++
+
+		config := run.Source
+		if run.Prompt != "" {
+			config = fmt.Sprintf("%s/%s", run.Source, run.Prompt)
+		}
+		sum, found := configSums[config]
+		if !found {
+			sum = &scoreSum{}
+			configSums[config] = sum
+			configs = append(configs, ConfigScore{Config: config, Source: run.Source, Prompt: run.Prompt})
+		}
+		sum.add(tau, hit)
+
+		ranAt := run.Time.In(clock.Location())
+		for i := len(starts) - 1; i >= 0; i-- {
+			if !ranAt.Before(starts[i]) {
+				if ranAt.Before(starts[i].AddDate(0, 0, 7)) {
+					weekSums[i].add(tau, hit)
+				}
+				break
+			}
+		}
+	}
+
+	for i := range configs {
+		configs[i].Score = configSums[configs[i].Config].score()
+	}
+	sort.SliceStable(configs, func(i, j int) bool {
+		return tauOf(configs[i].Score) > tauOf(configs[j].Score)
+	})
+	for _, config := range configs {
+		if config.Runs >= minEvalRuns {
+			eval.Best = config.Config
+			break
+		}
+	}
+	eval.Configs = configs
+
+	for i, start := range starts {
+		year, week := start.ISOWeek()
+		eval.Weeks = append(eval.Weeks, WeekScore{Week: fmt.Sprintf("%d-W%02d", year, week), Start: start.Format("2006-01-02"), Score: weekSums[i].score()})
+	}
+	return eval
+}
+
+// tauOf returns a score's correlation, ranking scores without one last
+func tauOf(score Score) float64 {
+	if score.Tau == nil {
+		return math.Inf(-1)
+	}
+	return *score.Tau
+}
+
+// scoreRun returns the Kendall tau-b between a run's order and the order
+// its tasks were completed in within window after it, and whether the
+// first of them was ranked in the top evalTop. Runs with fewer than two
+// tasks or none completed can't be scored.
+func scoreRun(run RunSnapshot, completed map[string]time.Time, window time.Duration) (float64, bool, bool) {
+	if len(run.Order) < 2 {
+		return 0, false, false
+	}
+	// Completion ranks: earlier is lower, tasks not completed in time are
+	// all ranked after every completed task
+	var done []string
+	for _, id := range run.Order {
+		at, ok := completed[id]
+		if ok && at.After(run.Time) && at.Sub(run.Time) <= window {
+			done = append(done, id)
+		}
+	}
+	if len(done) == 0 {
+		return 0, false, false
+	}
+	sort.SliceStable(done, func(i, j int) bool {
+		return completed[done[i]].Before(completed[done[j]])
+	})
+	actual := make([]int, len(run.Order))
+	rankOf := make(map[string]int, len(done))
+	for i, id := range done {
+		rankOf[id] = i
+	}
+	for i, id := range run.Order {
+		if rank, ok := rankOf[id]; ok {
+			actual[i] = rank
+		} else {
+			actual[i] = len(done)
+		}
+	}
+
+	predicted := make([]int, len(run.Order))
+	for i := range predicted {
+		predicted[i] = i
+	}
+	tau, ok := KendallTau(predicted, actual)
+	if !ok {
+		return 0, false, false
+	}
+
+	first := done[0]
+	hit := false
+	for _, id := range run.Order[:min(evalTop, len(run.Order))] {
+		if id == first {
+			hit = true
+		}
+	}
+	return tau, hit, true
+}
+
+// KendallTau returns the Kendall tau-b rank correlation of two rankings of
+// the same items, given as each item's rank in both; ranks may tie. It
+// reports false when either ranking ties every item.
+func KendallTau(x, y []int) (float64, bool) {
+	var concordant, discordant, tiedX, tiedY int
+	for i := range x {
+		for j := i + 1; j < len(x); j++ {
+			dx, dy := x[i]-x[j], y[i]-y[j]
+			switch {
+			case dx == 0 && dy == 0:
+				tiedX++
+				tiedY++
+			case dx == 0:
+				tiedX++
+			case dy == 0:
+				tiedY++
+			case (dx < 0) == (dy < 0):
+				concordant++
+			default:
+				discordant++
+			}
+		}
+	}
+	pairs := len(x) * (len(x) - 1) / 2
+	if pairs == tiedX || pairs == tiedY {
+		return 0, false
+	}
+	return float64(concordant-discordant) / math.Sqrt(float64(pairs-tiedX)*float64(pairs-tiedY)), true
+}
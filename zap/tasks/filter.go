@@ -0,0 +1,184 @@
+package tasks
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"zap/datetime"
+	"zap/tags"
+	"zap/todo"
+)
+
+// Rule matches tasks by title, tag or due date. Every field that is set
+// must match; a rule with none set matches nothing.
+type Rule struct {
+	// Title is a glob matched against the whole title, ignoring case: *
+	// matches any text, ? any character and everything else itself
+	Title string
+	// Pattern is a regular expression matched anywhere in the title
+	Pattern string
+	// Tag matches tasks carrying the hashtag in their title or notes
+	Tag string
+	// DueWithin matches tasks due within that many days, overdue included
+	DueWithin *int
+	// DueAfter matches tasks due more than that many days from today
+	DueAfter *int
+}
+
+// rule is a Rule with its patterns compiled
+type rule struct {
+	title     *regexp.Regexp
+	pattern   *regexp.Regexp
+	tag       string
+	dueWithin *int
+	dueAfter  *int
+}
+
+// Filter keeps tasks away from zap: tasks matching a Skip rule, or no
+// Include rule when there are any, are never sent to the model or changed.
+// They keep their positions when lists are reordered, like pinned tasks.
+// A nil Filter excludes nothing.
+type Filter struct {
+	skip    []rule
+	include []rule
+	clock   *datetime.Clock
+}
+
+// NewFilter compiles skip and include rules. Due windows are counted from
+// today on clock.
+func NewFilter(skip, include []Rule, clock *datetime.Clock) (*Filter, error) {
+	f := &Filter{clock: clock}
+	for _, r := range skip {
+		compiled, err := compileRule(r)
+		if err != nil {
+			return nil, fmt.Errorf("skip rule: %v", err)
+		}
+		f.skip = append(f.skip, compiled)
+	}
+	for _, r := range include {
+		compiled, err := compileRule(r)
+		if err != nil {
+			return nil, fmt.Errorf("include rule: %v", err)
+		}
+		f.include = append(f.include, compiled)
+	}
+	return f, nil
+}
+
+func compileRule(r Rule) (rule, error) {
+	compiled := rule{tag: tags.Normalize(r.Tag), dueWithin: r.DueWithin, dueAfter: r.DueAfter}
+	if r.Title != "" {
+		compiled.title = globPattern(r.Title)
+	}
+	if r.Pattern != "" {
+		pattern, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return rule{}, fmt.Errorf("invalid pattern %q: %v", r.Pattern, err)
+		}
+		compiled.pattern = pattern
+	}
+	return compiled, nil
+}
+
+// globPattern turns a title glob into a case-insensitive regular
+// expression for the whole title. Brackets are literal, so "*[personal]*"
+// matches titles with that marker.
+func globPattern(glob string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("(?is)^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// Excludes reports whether zap must leave a task alone
+func (f *Filter) Excludes(task *todo.Task) bool {
+	if f == nil {
+		return false
+	}
+	for _, r := range f.skip {
+		if r.matches(task, f.clock) {
+			return true
+		}
+	}
+	if len(f.include) == 0 {
+		return false
+	}
+	for _, r := range f.include {
+		if r.matches(task, f.clock) {
+			return false
+		}
+	}
+	return true
+}
+
+// Excluded returns the IDs of the tasks zap must leave alone
+func (f *Filter) Excluded(tasks []*todo.Task) map[string]bool {
+	excluded := make(map[string]bool)
+	for _, task := range tasks {
+		if f.Excludes(task) {
+			excluded[task.ID] = true
+		}
+	}
+	return excluded
+}
+
+// Keep drops the excluded top-level tasks of a list and their subtasks.
+// Excluded subtasks of other tasks are kept, since their parents aren't
+// childless without them.
+func (f *Filter) Keep(tasks []*todo.Task) []*todo.Task {
+	if f == nil {
+		return tasks
+	}
+	excluded := make(map[string]bool)
+	for _, task := range tasks {
+		if task.Parent == "" && f.Excludes(task) {
+			excluded[task.ID] = true
+		}
+	}
+	var kept []*todo.Task
+	for _, task := range tasks {
+		if !excluded[task.ID] && !excluded[task.Parent] {
+			kept = append(kept, task)
+		}
+	}
+	return kept
+}
+
+func (r rule) matches(task *todo.Task, clock *datetime.Clock) bool {
+	if r.title == nil && r.pattern == nil && r.tag == "" && r.dueWithin == nil && r.dueAfter == nil {
+		return false
+	}
+	if r.title != nil && !r.title.MatchString(strings.TrimSpace(task.Title)) {
+		return false
+	}
+	if r.pattern != nil && !r.pattern.MatchString(task.Title) {
+		return false
+	}
+	if r.tag != "" && !tags.Has(task, r.tag) {
+		return false
+	}
+	if r.dueWithin != nil || r.dueAfter != nil {
+		days, ok := clock.DaysUntil(task.Due)
+		if !ok {
+			return false
+		}
+		if r.dueWithin != nil && days > *r.dueWithin {
+			return false
+		}
+		if r.dueAfter != nil && days <= *r.dueAfter {
+			return false
+		}
+	}
+	return true
+}
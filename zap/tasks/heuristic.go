@@ -0,0 +1,105 @@
+package tasks
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"zap/datetime"
+	"zap/gemini"
+	"zap/tags"
+	"zap/todo"
+)
+
+// markerScores adjusts the heuristic score for priority markers in titles
+var markerScores = map[string]float64{
+	"[URGENT]": 20,
+	"[HIGH]":   15,
+	"[P1]":     15,
+	"[P2]":     5,
+	"[LOW]":    -10,
+	"[P3]":     -10,
+}
+
+// HeuristicSource names the heuristic in reports and history
+const HeuristicSource = "heuristic"
+
+// starvationBoost is added per consecutive run a task spent in the bottom
+// quartile, up to maxStarvationBoost
+const (
+	starvationBoost    = 3
+	maxStarvationBoost = 30
+)
+
+// HeuristicPriorities ranks tasks without an LLM, from due-date urgency,
+// priority markers, the #waiting tag and how long a task has been buried.
+// Ties keep the current order. The result has the same shape as Gemini's so
+// either can drive the reorder.
+func HeuristicPriorities(tasks []*todo.Task, signals gemini.RankSignals) []gemini.TaskPriority {
+	priorities := make([]gemini.TaskPriority, len(tasks))
+	for i, task := range tasks {
+		score, reasons := heuristicScore(task, signals.Clock)
+		if runs := signals.BottomRuns[task.ID]; runs > 0 {
+			score = min(100, score+float64(min(runs*starvationBoost, maxStarvationBoost)))
+			reasons = append(reasons, fmt.Sprintf("near the bottom for %d runs", runs))
+		}
+		priorities[i] = gemini.TaskPriority{
+			TaskID:      task.ID,
+			Priority:    score,
+			Explanation: strings.Join(reasons, "; "),
+		}
+	}
+
+	sort.SliceStable(priorities, func(i, j int) bool {
+		return priorities[i].Priority > priorities[j].Priority
+	})
+	for i := range priorities {
+		priorities[i].NewPosition = fmt.Sprintf("%05d", i+1)
+	}
+	return priorities
+}
+
+// heuristicScore returns a 0-100 score and the reasons behind it
+func heuristicScore(task *todo.Task, clock *datetime.Clock) (float64, []string) {
+	var score float64
+	var reasons []string
+
+	days, _ := clock.DaysUntil(task.Due)
+	switch urgency := clock.Urgency(task.Due); urgency {
+	case datetime.UrgencyOverdue:
+		score = 90 + float64(min(-days, 10))
+		reasons = append(reasons, fmt.Sprintf("overdue by %d days", -days))
+	case datetime.UrgencyToday:
+		score = 85
+		reasons = append(reasons, "due today")
+	case datetime.UrgencyTomorrow:
+		score = 75
+		reasons = append(reasons, "due tomorrow")
+	case datetime.UrgencyThisWeek:
+		score = 72 - float64(days)
+		reasons = append(reasons, fmt.Sprintf("due in %d days", days))
+	case datetime.UrgencyLater:
+		score = 50
+		reasons = append(reasons, fmt.Sprintf("due in %d days", days))
+	default:
+		score = 40
+		reasons = append(reasons, "no due date")
+	}
+
+	title := strings.ToUpper(task.Title)
+	for marker, adjustment := range markerScores {
+		if strings.Contains(title, marker) {
+			score += adjustment
+			reasons = append(reasons, marker+" marker")
+		}
+	}
+
+	if tags.Has(task, tags.Waiting) {
+		score -= 30
+		reasons = append(reasons, "waiting on someone else")
+	}
+
+	score = max(0, min(100, score))
+	sort.Strings(reasons[1:])
+	return score, reasons
+}
@@ -0,0 +1,218 @@
+package tasks
+
+import (
+	"slices"
+	"sort"
+	"time"
+
+	"zap/gemini"
+	"zap/store"
+)
+
+// historyBucket is the store bucket holding per-task ranking history
+const historyBucket = "rank-history"
+
+// runsBucket holds the order of every ranked list, keyed by list ID and
+// time, for evaluating rankings against what was completed after them
+const runsBucket = "rank-runs"
+
+// maxRunAge is how long ranked orders are kept
+const maxRunAge = 180 * 24 * time.Hour
+
+// RankRecord is the outcome of the latest run for one task
+type RankRecord struct {
+	ListID      string    `json:"listId"`
+	Rank        int       `json:"rank"`
+	Of          int       `json:"of"`
+	Priority    float64   `json:"priority"`
+	Explanation string    `json:"explanation"`
+	BottomRuns  int       `json:"bottomRuns"`
+	Source      string    `json:"source"`
+	Updated     time.Time `json:"updated"`
+	// FirstSeen is when zap first ranked the task. The Tasks API doesn't
+	// expose creation times, so this stands in for the task's age.
+	FirstSeen time.Time `json:"firstSeen"`
+	// Reprioritized counts the runs that changed the task's rank
+	Reprioritized int `json:"reprioritized"`
+}
+
+// RunSnapshot is the order one run ranked a list in
+type RunSnapshot struct {
+	ListID string    `json:"listId"`
+	Time   time.Time `json:"time"`
+	Source string    `json:"source"`
+	// Prompt identifies the ranking prompt; empty for the heuristic
+	Prompt string   `json:"prompt,omitempty"`
+	Order  []string `json:"order"`
+}
+
+// History remembers how tasks ranked in previous runs, so tasks that are
+// always ranked low can be lifted before they are buried forever
+type History struct {
+	store    *store.Store
+	readOnly bool
+	now      func() time.Time
+}
+
+// NewHistory creates a history backed by st. A read-only history provides
+// signals but doesn't record runs, so dry runs don't change it.
+func NewHistory(st *store.Store, readOnly bool) *History {
+	return &History{store: st, readOnly: readOnly, now: time.Now}
+}
+
+// Get returns the latest record for a task
+func (h *History) Get(taskID string) (RankRecord, bool, error) {
+	var record RankRecord
+	found, err := h.store.Get(historyBucket, taskID, &record)
+	return record, found, err
+}
+
+// Records returns the latest record of every task, keyed by task ID
+func (h *History) Records() (map[string]RankRecord, error) {
+	records := make(map[string]RankRecord)
+	for _, id := range h.store.Keys(historyBucket) {
+		record, _, err := h.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		records[id] = record
+	}
+	return records, nil
+}
+
+// BottomRuns returns the consecutive bottom-quartile runs of each task
+func (h *History) BottomRuns(taskIDs []string) (map[string]int, error) {
+	runs := make(map[string]int)
+	for _, id := range taskIDs {
+		record, found, err := h.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		if found && record.BottomRuns > 0 {
+			runs[id] = record.BottomRuns
+		}
+	}
+	return runs, nil
+}
+
+// FirstSeen returns when each task was first ranked, for tasks that have
+// been ranked before
+func (h *History) FirstSeen(taskIDs []string) (map[string]time.Time, error) {
+	seen := make(map[string]time.Time)
+	for _, id := range taskIDs {
+		record, found, err := h.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		if found && !record.FirstSeen.IsZero() {
+			seen[id] = record.FirstSeen
+		}
+	}
+	return seen, nil
+}
+
+// Priorities returns the score each task was last ranked with, for tasks
+// that have been ranked before
+func (h *History) Priorities(taskIDs []string) (map[string]float64, error) {
+	priorities := make(map[string]float64)
+	for _, id := range taskIDs {
+		record, found, err := h.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			priorities[id] = record.Priority
+		}
+	}
+	return priorities, nil
+}
+
+// Record stores the final ranking of a list and the provider that produced
+// it. Priorities must be in their new order. Tasks in the bottom quartile
+// extend their streak; the rest reset it. Lists shorter than four tasks have
+// no bottom quartile.
+func (h *History) Record(taskListID string, priorities []gemini.TaskPriority, source string) error {
+	if h.readOnly {
+		return nil
+	}
+
+	n := len(priorities)
+	for i, priority := range priorities {
+		record, found, err := h.Get(priority.TaskID)
+		if err != nil {
+			return err
+		}
+		if found && record.Rank != i+1 {
+			record.Reprioritized++
+		}
+
+		if n >= 4 && i >= n-n/4 {
+			record.BottomRuns++
+		} else {
+			record.BottomRuns = 0
+		}
+		record.ListID = taskListID
+		record.Rank = i + 1
+		record.Of = n
+		record.Priority = priority.Priority
+		record.Explanation = priority.Explanation
+		record.Source = source
+		record.Updated = h.now()
+		if record.FirstSeen.IsZero() {
+			record.FirstSeen = record.Updated
+		}
+
+		if err := h.store.Put(historyBucket, priority.TaskID, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecordRun keeps the order a list was ranked in, dropping orders older than
+// maxRunAge. Replayed rankings aren't kept, since they were already counted.
+func (h *History) RecordRun(taskListID string, priorities []gemini.TaskPriority, source, prompt string) error {
+	if h.readOnly || source == ReplaySource {
+		return nil
+	}
+	now := h.now()
+	run := RunSnapshot{ListID: taskListID, Time: now, Source: source, Prompt: prompt, Order: make([]string, len(priorities))}
+	for i, priority := range priorities {
+		run.Order[i] = priority.TaskID
+	}
+	if err := h.store.Put(runsBucket, taskListID+"@"+now.UTC().Format(time.RFC3339Nano), run); err != nil {
+		return err
+	}
+
+	for _, key := range h.store.Keys(runsBucket) {
+		var old RunSnapshot
+		if _, err := h.store.Get(runsBucket, key, &old); err != nil {
+			return err
+		}
+		if now.Sub(old.Time) > maxRunAge {
+			if err := h.store.Delete(runsBucket, key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Runs returns the kept orders of the lists with the given IDs, or of
+// every list when none are given, oldest first
+func (h *History) Runs(taskListIDs ...string) ([]RunSnapshot, error) {
+	var runs []RunSnapshot
+	for _, key := range h.store.Keys(runsBucket) {
+		var run RunSnapshot
+		if _, err := h.store.Get(runsBucket, key, &run); err != nil {
+			return nil, err
+		}
+		if len(taskListIDs) == 0 || slices.Contains(taskListIDs, run.ListID) {
+			runs = append(runs, run)
+		}
+	}
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].Time.Before(runs[j].Time)
+	})
+	return runs, nil
+}
@@ -0,0 +1,169 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"zap/todo"
+)
+
+// ErrListNotFound is matched by errors.Is for every ListNotFoundError
+var ErrListNotFound = errors.New("task list not found")
+
+// maxSuggestionDistance is the largest edit distance offered as a suggestion
+const maxSuggestionDistance = 3
+
+// ListNotFoundError is returned when no task list matches a title. Suggestions
+// holds the closest list titles, best first.
+type ListNotFoundError struct {
+	Title       string
+	Suggestions []string
+}
+
+func (e *ListNotFoundError) Error() string {
+	if len(e.Suggestions) == 0 {
+		return fmt.Sprintf("task list with title '%s' not found", e.Title)
+	}
+	return fmt.Sprintf("task list with title '%s' not found; did you mean %s?", e.Title, quoteJoin(e.Suggestions))
+}
+
+// Is makes errors.Is(err, ErrListNotFound) hold
+func (e *ListNotFoundError) Is(target error) bool {
+	return target == ErrListNotFound
+}
+
+// GetTaskListByTitle finds a task list by its title. An exact match wins,
+// then a case-insensitive one, then one that matches after ignoring emoji and
+// punctuation ("backlog" matches "📥 Backlog"), then a unique list whose
+// normalized title contains the query.
+func (s *Service) GetTaskListByTitle(title string) (*todo.TaskList, error) {
+	taskLists, err := s.ListTaskLists()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list task lists: %w", err)
+	}
+
+	return matchTaskList(title, taskLists)
+}
+
+// matchTaskList applies the GetTaskListByTitle matching rules
+func matchTaskList(title string, taskLists []*todo.TaskList) (*todo.TaskList, error) {
+	for _, list := range taskLists {
+		if list.Title == title {
+			return list, nil
+		}
+	}
+	for _, list := range taskLists {
+		if strings.EqualFold(list.Title, title) {
+			return list, nil
+		}
+	}
+
+	query := normalizeTitle(title)
+	if query == "" {
+		return nil, &ListNotFoundError{Title: title}
+	}
+	for _, list := range taskLists {
+		if normalizeTitle(list.Title) == query {
+			return list, nil
+		}
+	}
+
+	var contains []*todo.TaskList
+	for _, list := range taskLists {
+		if strings.Contains(normalizeTitle(list.Title), query) {
+			contains = append(contains, list)
+		}
+	}
+	if len(contains) == 1 {
+		return contains[0], nil
+	}
+
+	return nil, &ListNotFoundError{Title: title, Suggestions: suggestTitles(query, taskLists)}
+}
+
+// suggestTitles returns list titles close to the normalized query
+func suggestTitles(query string, taskLists []*todo.TaskList) []string {
+	type candidate struct {
+		title    string
+		distance int
+	}
+
+	var candidates []candidate
+	for _, list := range taskLists {
+		normalized := normalizeTitle(list.Title)
+		distance := levenshtein(query, normalized)
+		if strings.Contains(normalized, query) || strings.Contains(query, normalized) {
+			distance = 0
+		}
+		if distance <= maxSuggestionDistance {
+			candidates = append(candidates, candidate{title: list.Title, distance: distance})
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].distance < candidates[j].distance
+	})
+
+	suggestions := make([]string, len(candidates))
+	for i, c := range candidates {
+		suggestions[i] = c.title
+	}
+	return suggestions
+}
+
+// normalizeTitle lowercases a title and keeps only letters, digits and
+// single spaces
+func normalizeTitle(title string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(title) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if space && b.Len() > 0 {
+				b.WriteRune(' ')
+			}
+			space = false
+			b.WriteRune(r)
+		default:
+			space = true
+		}
+	}
+	return b.String()
+}
+
+// levenshtein returns the edit distance between two strings
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// quoteJoin formats titles as 'a', 'b' or 'c'
+func quoteJoin(titles []string) string {
+	quoted := make([]string, len(titles))
+	for i, title := range titles {
+		quoted[i] = "'" + title + "'"
+	}
+	if len(quoted) == 1 {
+		return quoted[0]
+	}
+	return strings.Join(quoted[:len(quoted)-1], ", ") + " or " + quoted[len(quoted)-1]
+}
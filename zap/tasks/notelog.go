@@ -0,0 +1,90 @@
+package tasks
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"zap/gemini"
+	"zap/notes"
+	"zap/todo"
+)
+
+// SetNoteLog makes the prioritizer log the given kinds of events in the
+// notes of the tasks they happen to
+func (p *Prioritizer) SetNoteLog(kinds []notes.Kind) {
+	p.noteLog = make(map[notes.Kind]bool, len(kinds))
+	for _, kind := range kinds {
+		p.noteLog[kind] = true
+	}
+}
+
+// noteMutations plans the updates that log rank changes and new
+// escalations. Tasks are the list's top-level tasks with the run's other
+// updates applied and original are the same tasks as fetched. Rank changes
+// are relative to the last recorded run in the same list, so they are only
+// logged with a history.
+func (p *Prioritizer) noteMutations(taskListID string, tasks, original []*todo.Task, priorities []gemini.TaskPriority, escalated []escalatedTask) []Mutation {
+	if len(p.noteLog) == 0 {
+		return nil
+	}
+	byID := make(map[string]*todo.Task, len(tasks))
+	for _, task := range tasks {
+		byID[task.ID] = task
+	}
+	wasMarked := make(map[string]bool, len(original))
+	if p.escalation != nil {
+		marker := p.escalation.Marker
+		if marker == "" {
+			marker = DefaultOverdueMarker
+		}
+		for _, task := range original {
+			wasMarked[task.ID] = strings.Contains(strings.ToUpper(task.Title), strings.ToUpper(marker))
+		}
+	}
+	overdue := make(map[string]int, len(escalated))
+	for _, e := range escalated {
+		overdue[e.task.ID] = e.daysOverdue
+	}
+
+	now := p.clock.Now()
+	var mutations []Mutation
+	for i, priority := range priorities {
+		task, ok := byID[priority.TaskID]
+		if !ok {
+			continue
+		}
+		var entries []notes.Entry
+		if days, ok := overdue[task.ID]; ok && p.noteLog[notes.Escalation] && !wasMarked[task.ID] {
+			entries = append(entries, notes.Entry{Time: now, Kind: notes.Escalation, Text: fmt.Sprintf("overdue by %d days, moved to the top", days)})
+		}
+		if p.noteLog[notes.Priority] && p.history != nil {
+			record, found, err := p.history.Get(task.ID)
+			if err != nil {
+				log.Printf("Error reading ranking history for '%s': %v", task.Title, err)
+			} else if found && record.ListID == taskListID && record.Rank != i+1 {
+				text := fmt.Sprintf("#%d of %d, was #%d (%.0f)", i+1, len(priorities), record.Rank, priority.Priority)
+				if priority.Explanation != "" {
+					text += " - " + priority.Explanation
+				}
+				entries = append(entries, notes.Entry{Time: now, Kind: notes.Priority, Text: text})
+			}
+		}
+		if len(entries) == 0 {
+			continue
+		}
+
+		updated := *task
+		for _, entry := range entries {
+			updated.Notes = p.namespace.Append(updated.Notes, entry)
+		}
+		mutations = append(mutations, Mutation{
+			Kind:       MutationUpdate,
+			TaskListID: taskListID,
+			Task:       &updated,
+			Before:     task,
+			Summary:    fmt.Sprintf("note %s in '%s'", entries[len(entries)-1].Kind, task.Title),
+		})
+	}
+	return mutations
+}
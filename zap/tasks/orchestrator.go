@@ -0,0 +1,612 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+
+	"zap/gemini"
+	"zap/todo"
+	"zap/todo/googletasks"
+
+	tasksapi "google.golang.org/api/tasks/v1"
+)
+
+// MutationKind identifies the write a Mutation performs
+type MutationKind string
+
+const (
+	// MutationMove moves Task after Previous (or to the top) under Parent,
+	// into Destination when it is set
+	MutationMove MutationKind = "move"
+	// MutationInsert creates Task under Parent
+	MutationInsert MutationKind = "insert"
+	// MutationDelete deletes Task
+	MutationDelete MutationKind = "delete"
+	// MutationUpdate changes Task's title, notes, due date and status to
+	// Task's, writing only those that differ from Before
+	MutationUpdate MutationKind = "update"
+	// MutationPriority sets Task's priority field or label to Priority, for
+	// backends that record rankings that way instead of by order
+	MutationPriority MutationKind = "priority"
+)
+
+// Mutation is a single planned write. All writes zap makes are expressed as
+// mutations and go through a Writer, so they can be previewed, journaled for
+// undo or sent to another backend.
+type Mutation struct {
+	Kind       MutationKind
+	TaskListID string
+	Task       *todo.Task
+	Parent     string
+	Previous   string
+	// PreviousBefore is the sibling a moved task followed before the move
+	PreviousBefore string
+	// Destination is the list a move takes Task to; empty keeps it in
+	// TaskListID
+	Destination string
+	// Before is the task as it was before an update
+	Before *todo.Task
+	// Priority is the priority a priority mutation sets, and
+	// PriorityBefore the one Task had
+	Priority       string
+	PriorityBefore string
+	// Summary describes the mutation for people, e.g. "move 'A' to position 1"
+	Summary string
+}
+
+// Writer applies mutations in order, returning one result per mutation
+type Writer interface {
+	Apply(ctx context.Context, mutations []Mutation) []BatchResult
+}
+
+// Apply performs mutations against the Tasks API. Moves run in order since
+// each depends on the previous one; runs of consecutive inserts into the same
+// list go out as a batch.
+func (s *Service) Apply(ctx context.Context, mutations []Mutation) []BatchResult {
+	results := make([]BatchResult, len(mutations))
+	for i := 0; i < len(mutations); {
+		m := mutations[i]
+		switch m.Kind {
+		case MutationInsert:
+			j := i
+			var batch []*todo.Task
+			for j < len(mutations) && mutations[j].Kind == MutationInsert && mutations[j].TaskListID == m.TaskListID {
+				task := *mutations[j].Task
+				task.Parent = mutations[j].Parent
+				batch = append(batch, &task)
+				j++
+			}
+			for _, result := range s.BatchCreateTasks(ctx, m.TaskListID, batch) {
+				results[i+result.Index] = BatchResult{Index: i + result.Index, Task: result.Task, Err: result.Err}
+			}
+			i = j
+			continue
+		case MutationMove:
+			task, err := s.moveTask(ctx, m.TaskListID, m.Task.ID, m.Parent, m.Previous, m.Destination)
+			results[i] = BatchResult{Index: i, Task: task, Err: err}
+		case MutationDelete:
+			err := s.DeleteTask(ctx, m.TaskListID, m.Task.ID)
+			results[i] = BatchResult{Index: i, Task: m.Task, Err: err}
+		case MutationUpdate:
+			task, err := s.updateTask(ctx, m.TaskListID, m.Task, m.Before)
+			results[i] = BatchResult{Index: i, Task: task, Err: err}
+		case MutationPriority:
+			err := s.setPriority(ctx, m.TaskListID, m.Task.ID, m.Priority)
+			results[i] = BatchResult{Index: i, Task: m.Task, Err: err}
+		default:
+			results[i] = BatchResult{Index: i, Err: fmt.Errorf("unknown mutation kind %q", m.Kind)}
+		}
+		i++
+	}
+	return results
+}
+
+// moveTask moves a task under parent after previous, either of which may be
+// empty, and to another list when destination is set
+func (s *Service) moveTask(ctx context.Context, taskListID, taskID, parent, previous, destination string) (*todo.Task, error) {
+	if err := s.checkWritable("unable to move task"); err != nil {
+		return nil, err
+	}
+	moveCall := s.service.Tasks.Move(taskListID, taskID).Context(ctx)
+	if parent != "" {
+		moveCall = moveCall.Parent(parent)
+	}
+	if previous != "" {
+		moveCall = moveCall.Previous(previous)
+	}
+	if destination != "" && destination != taskListID {
+		moveCall = moveCall.DestinationTasklist(destination)
+	}
+	movedTask, err := moveCall.Do()
+	if err != nil {
+		return nil, writeError("unable to move task", err)
+	}
+	s.dropCachedTasks(taskListID, destination)
+	return googletasks.Task(movedTask), nil
+}
+
+// updateTask writes the title, notes, due date and status in which task
+// differs from before, all four when before is unknown. The write only
+// goes through while the task is as zap read it; when it was changed
+// elsewhere in between, the update is re-read and rebased onto the changed
+// task, and fails with a ConflictError when both changed the same field.
+func (s *Service) updateTask(ctx context.Context, taskListID string, task, before *todo.Task) (*todo.Task, error) {
+	if err := s.checkWritable("unable to update task"); err != nil {
+		return nil, err
+	}
+	etag := task.ETag
+	if before != nil {
+		etag = before.ETag
+	}
+	for attempt := 0; ; attempt++ {
+		patch, changed := patchFields(task, before)
+		if !changed {
+			return before, nil
+		}
+		call := s.service.Tasks.Patch(taskListID, task.ID, patch).Context(ctx)
+		ifMatch(call.Header(), etag)
+		updated, err := call.Do()
+		if err == nil {
+			return googletasks.Task(updated), nil
+		}
+		if !isPreconditionFailed(err) {
+			return nil, writeError("unable to update task", err)
+		}
+		if before == nil || attempt == maxConflictRetries {
+			return nil, &ConflictError{TaskID: task.ID, Title: task.Title}
+		}
+
+		current, err := s.GetTask(ctx, taskListID, task.ID)
+		if err != nil {
+			return nil, err
+		}
+		rebased, conflicts := rebase(task, before, current)
+		if len(conflicts) > 0 {
+			return nil, &ConflictError{TaskID: task.ID, Title: current.Title, Fields: conflicts}
+		}
+		task, before, etag = rebased, current, current.ETag
+	}
+}
+
+// patchFields returns the patch that turns before into task, sending only
+// the title, notes, due date and status that changed, so fields changed
+// elsewhere in the meantime aren't written back. Without before all four
+// are sent. It reports false when nothing changed.
+func patchFields(task, before *todo.Task) (*tasksapi.Task, bool) {
+	patch := &tasksapi.Task{}
+	changed := false
+	if before == nil || task.Title != before.Title {
+		patch.Title = task.Title
+		changed = true
+	}
+	if before == nil || task.Notes != before.Notes {
+		// Cleared notes must be sent as empty
+		patch.Notes = task.Notes
+		patch.ForceSendFields = append(patch.ForceSendFields, "Notes")
+		changed = true
+	}
+	if before == nil || task.Due != before.Due {
+		patch.Due = task.Due
+		if task.Due == "" {
+			patch.NullFields = append(patch.NullFields, "Due")
+		}
+		changed = true
+	}
+	if before == nil || task.Status != before.Status {
+		patch.Status = task.Status
+		if task.Status == "needsAction" {
+			patch.NullFields = append(patch.NullFields, "Completed")
+		}
+		changed = true
+	}
+	return patch, changed
+}
+
+// DryRunWriter prints mutations instead of applying them
+type DryRunWriter struct {
+	out io.Writer
+}
+
+// NewDryRunWriter creates a Writer that describes every mutation on out
+func NewDryRunWriter(out io.Writer) *DryRunWriter {
+	return &DryRunWriter{out: out}
+}
+
+// Apply prints each mutation and reports it as successful
+func (w *DryRunWriter) Apply(ctx context.Context, mutations []Mutation) []BatchResult {
+	results := make([]BatchResult, len(mutations))
+	for i, m := range mutations {
+		fmt.Fprintf(w.out, "  would %s\n", m.Summary)
+		results[i] = BatchResult{Index: i, Task: m.Task}
+	}
+	return results
+}
+
+// PlanWriter collects mutations without applying or printing them
+type PlanWriter struct {
+	mu      sync.Mutex
+	planned []Mutation
+}
+
+// NewPlanWriter creates an empty PlanWriter
+func NewPlanWriter() *PlanWriter {
+	return &PlanWriter{}
+}
+
+// Apply records each mutation and reports it as successful
+func (w *PlanWriter) Apply(ctx context.Context, mutations []Mutation) []BatchResult {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	results := make([]BatchResult, len(mutations))
+	for i, m := range mutations {
+		w.planned = append(w.planned, m)
+		results[i] = BatchResult{Index: i, Task: m.Task}
+	}
+	return results
+}
+
+// Planned returns the mutations collected so far
+func (w *PlanWriter) Planned() []Mutation {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]Mutation(nil), w.planned...)
+}
+
+// ErrNotConfirmed fails the mutations of a batch that wasn't confirmed
+var ErrNotConfirmed = errors.New("not confirmed")
+
+// ConfirmFunc is asked before a batch of mutations is applied and reports
+// whether to go ahead
+type ConfirmFunc func(mutations []Mutation) bool
+
+// Gate wraps a Writer and only forwards the batches confirm agrees to
+type Gate struct {
+	writer  Writer
+	confirm ConfirmFunc
+}
+
+// NewGate creates a gate that asks confirm before writing through writer
+func NewGate(writer Writer, confirm ConfirmFunc) *Gate {
+	return &Gate{writer: writer, confirm: confirm}
+}
+
+// Apply forwards mutations once they are confirmed; otherwise each fails
+// with ErrNotConfirmed
+func (g *Gate) Apply(ctx context.Context, mutations []Mutation) []BatchResult {
+	if len(mutations) == 0 || g.confirm(mutations) {
+		return g.writer.Apply(ctx, mutations)
+	}
+	results := make([]BatchResult, len(mutations))
+	for i := range mutations {
+		results[i] = BatchResult{Index: i, Err: ErrNotConfirmed}
+	}
+	return results
+}
+
+// Journal wraps a Writer and records successful mutations so they can be undone
+type Journal struct {
+	writer  Writer
+	mu      sync.Mutex
+	applied []Mutation
+}
+
+// NewJournal creates a journal that forwards mutations to writer
+func NewJournal(writer Writer) *Journal {
+	return &Journal{writer: writer}
+}
+
+// Apply forwards mutations and records the ones that succeeded. Inserts are
+// recorded with the created task so that undo can delete it, and updates
+// with the updated one, whose ETag undo must match.
+func (j *Journal) Apply(ctx context.Context, mutations []Mutation) []BatchResult {
+	results := j.writer.Apply(ctx, mutations)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, result := range results {
+		if result.Err != nil {
+			continue
+		}
+		m := mutations[result.Index]
+		if (m.Kind == MutationInsert || m.Kind == MutationUpdate) && result.Task != nil {
+			m.Task = result.Task
+		}
+		j.applied = append(j.applied, m)
+	}
+	return results
+}
+
+// Applied returns the mutations recorded so far
+func (j *Journal) Applied() []Mutation {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return append([]Mutation(nil), j.applied...)
+}
+
+// UndoMutations returns the mutations that revert everything recorded, in
+// reverse order: inserted tasks are deleted and moved tasks go back after
+// their previous sibling, and updated tasks get their old fields back, as
+// do priorities that were set before. Deletes can't be undone and are
+// skipped.
+func (j *Journal) UndoMutations() []Mutation {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var undo []Mutation
+	for i := len(j.applied) - 1; i >= 0; i-- {
+		m := j.applied[i]
+		switch m.Kind {
+		case MutationInsert:
+			undo = append(undo, Mutation{
+				Kind:       MutationDelete,
+				TaskListID: m.TaskListID,
+				Task:       m.Task,
+				Summary:    fmt.Sprintf("delete '%s'", m.Task.Title),
+			})
+		case MutationMove:
+			back := Mutation{
+				Kind:       MutationMove,
+				TaskListID: m.TaskListID,
+				Task:       m.Task,
+				Parent:     m.Task.Parent,
+				Previous:   m.PreviousBefore,
+				Summary:    fmt.Sprintf("move '%s' back", m.Task.Title),
+			}
+			if m.Destination != "" {
+				back.TaskListID, back.Destination = m.Destination, m.TaskListID
+			}
+			undo = append(undo, back)
+		case MutationUpdate:
+			if m.Before == nil {
+				continue
+			}
+			undo = append(undo, Mutation{
+				Kind:       MutationUpdate,
+				TaskListID: m.TaskListID,
+				Task:       m.Before,
+				Before:     m.Task,
+				Summary:    fmt.Sprintf("restore '%s'", m.Before.Title),
+			})
+		case MutationPriority:
+			if m.PriorityBefore == "" {
+				continue
+			}
+			undo = append(undo, Mutation{
+				Kind:           MutationPriority,
+				TaskListID:     m.TaskListID,
+				Task:           m.Task,
+				Priority:       m.PriorityBefore,
+				PriorityBefore: m.Priority,
+				Summary:        fmt.Sprintf("set priority of '%s' back to %s", m.Task.Title, m.PriorityBefore),
+			})
+		}
+	}
+	return undo
+}
+
+// Orchestrator applies the suggestions produced by the LLM. It is the single
+// place zap writes through, via its Writer.
+type Orchestrator struct {
+	writer Writer
+
+	mu        sync.Mutex
+	conflicts []*ConflictError
+	queued    int
+}
+
+// NewOrchestrator creates an orchestrator that writes through writer
+func NewOrchestrator(writer Writer) *Orchestrator {
+	return &Orchestrator{writer: writer}
+}
+
+// Apply runs mutations through the writer, returning the per-mutation
+// results and any failures joined into one error. Updates to tasks changed
+// elsewhere in the meantime aren't failures: the other change wins, and the
+// conflict is kept for Conflicts. Nor are writes an Outbox queued while
+// offline; Queued counts them. In dry runs the results carry the planned
+// tasks, which have no IDs.
+func (o *Orchestrator) Apply(ctx context.Context, mutations []Mutation) ([]BatchResult, error) {
+	results := o.writer.Apply(ctx, mutations)
+	var errs []error
+	var declined int
+	for _, result := range results {
+		var conflict *ConflictError
+		switch {
+		case errors.As(result.Err, &conflict):
+			o.mu.Lock()
+			o.conflicts = append(o.conflicts, conflict)
+			o.mu.Unlock()
+		case errors.Is(result.Err, ErrNotConfirmed):
+			declined++
+		case errors.Is(result.Err, ErrQueued):
+			o.mu.Lock()
+			o.queued++
+			o.mu.Unlock()
+		case result.Err != nil:
+			errs = append(errs, fmt.Errorf("%s: %v", mutations[result.Index].Summary, result.Err))
+		}
+	}
+	if declined > 0 {
+		errs = append(errs, fmt.Errorf("%d changes %w", declined, ErrNotConfirmed))
+	}
+	return results, errors.Join(errs...)
+}
+
+// Conflicts returns the updates dropped since the last call because their
+// tasks were changed elsewhere, and forgets them
+func (o *Orchestrator) Conflicts() []*ConflictError {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	conflicts := o.conflicts
+	o.conflicts = nil
+	return conflicts
+}
+
+// Queued returns how many writes were queued for want of a connection
+// since the last call, and forgets them
+func (o *Orchestrator) Queued() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	queued := o.queued
+	o.queued = 0
+	return queued
+}
+
+// OrderMutations plans the moves that put siblings into the given order.
+// Tasks are all children of parent (empty for top-level), in their current
+// order. Tasks already in place aren't moved, so a list that is in order
+// needs no moves. IDs in order that aren't among tasks are ignored.
+func OrderMutations(taskListID, parent string, tasks []*todo.Task, order []string) []Mutation {
+	byID := make(map[string]*todo.Task, len(tasks))
+	current := make([]string, len(tasks))
+	for i, task := range tasks {
+		byID[task.ID] = task
+		current[i] = task.ID
+	}
+
+	var mutations []Mutation
+	var previous, previousTitle string
+	position := 0
+	placed := make(map[string]bool, len(tasks))
+	for _, taskID := range order {
+		task, ok := byID[taskID]
+		if !ok || placed[taskID] {
+			continue
+		}
+		placed[taskID] = true
+
+		if current[position] != taskID {
+			// Everything before position is final, so the task is further down
+			from := position + 1
+			for current[from] != taskID {
+				from++
+			}
+			previousBefore := current[from-1]
+			copy(current[position+1:from+1], current[position:from])
+			current[position] = taskID
+
+			summary := fmt.Sprintf("move '%s' to the top", task.Title)
+			if previous != "" {
+				summary = fmt.Sprintf("move '%s' to position %d, after '%s'", task.Title, position+1, previousTitle)
+			}
+			mutations = append(mutations, Mutation{
+				Kind:           MutationMove,
+				TaskListID:     taskListID,
+				Task:           task,
+				Parent:         parent,
+				Previous:       previous,
+				PreviousBefore: previousBefore,
+				Summary:        summary,
+			})
+		}
+		position++
+		previous, previousTitle = task.ID, task.Title
+	}
+	return mutations
+}
+
+// priorityLabels is the number of P1 to P4 labels a ranking is split into
+const priorityLabels = 4
+
+// PriorityMutations plans the writes that record order on a list that
+// keeps rankings in a priority field or labels instead of its order. The
+// field gets each task's rank, starting at 1; with labels the ranking is
+// split into P1 to P4 in equal parts. Only tasks in current, the
+// priorities the backend has for the list, are written, and only those
+// whose priority changes.
+func PriorityMutations(taskListID string, tasks []*todo.Task, order []string, current map[string]string, labels bool) []Mutation {
+	byID := make(map[string]*todo.Task, len(tasks))
+	for _, task := range tasks {
+		byID[task.ID] = task
+	}
+	var ranked []*todo.Task
+	for _, taskID := range order {
+		if task, ok := byID[taskID]; ok {
+			ranked = append(ranked, task)
+			delete(byID, taskID)
+		}
+	}
+
+	var mutations []Mutation
+	for i, task := range ranked {
+		before, ok := current[task.ID]
+		if !ok {
+			continue
+		}
+		priority := strconv.Itoa(i + 1)
+		if labels {
+			priority = fmt.Sprintf("P%d", 1+i*priorityLabels/len(ranked))
+		}
+		if priority == before {
+			continue
+		}
+		mutations = append(mutations, Mutation{
+			Kind:           MutationPriority,
+			TaskListID:     taskListID,
+			Task:           task,
+			Priority:       priority,
+			PriorityBefore: before,
+			Summary:        fmt.Sprintf("set priority of '%s' to %s", task.Title, priority),
+		})
+	}
+	return mutations
+}
+
+// SubtaskMutations plans the inserts for Gemini's subtask suggestions.
+// Subtasks inherit their parent's due date. Suggestions for tasks that
+// aren't in tasks or already have subtasks are skipped, so a repeated run
+// never adds a second set.
+func SubtaskMutations(taskListID string, tasks []*todo.Task, suggestions []gemini.SubtaskSuggestion) []Mutation {
+	byID := make(map[string]*todo.Task, len(tasks))
+	hasChildren := make(map[string]bool)
+	for _, task := range tasks {
+		byID[task.ID] = task
+		if task.Parent != "" {
+			hasChildren[task.Parent] = true
+		}
+	}
+
+	var mutations []Mutation
+	for _, suggestion := range suggestions {
+		parentTask, ok := byID[suggestion.ParentTaskID]
+		if !ok || hasChildren[parentTask.ID] {
+			continue
+		}
+
+		for _, subtaskTitle := range suggestion.Subtasks {
+			subtask := &todo.Task{
+				Title:  subtaskTitle,
+				Status: "needsAction",
+				Notes:  fmt.Sprintf("Auto-generated subtask\nRationale: %s", suggestion.Rationale),
+			}
+
+			// If parent has a due date, inherit it for the subtask
+			if parentTask.Due != "" {
+				subtask.Due = parentTask.Due
+			}
+
+			mutations = append(mutations, Mutation{
+				Kind:       MutationInsert,
+				TaskListID: taskListID,
+				Task:       subtask,
+				Parent:     parentTask.ID,
+				Summary:    fmt.Sprintf("create subtask '%s' under '%s'", subtaskTitle, parentTask.Title),
+			})
+		}
+	}
+	return mutations
+}
+
+// CreateSubtasks applies Gemini's subtask suggestions for a list
+func (o *Orchestrator) CreateSubtasks(ctx context.Context, taskListID string, tasks []*todo.Task, suggestions []gemini.SubtaskSuggestion) error {
+	mutations := SubtaskMutations(taskListID, tasks, suggestions)
+	if len(mutations) == 0 {
+		return nil
+	}
+	_, err := o.Apply(ctx, mutations)
+	return err
+}
@@ -0,0 +1,258 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"zap/datetime"
+	"zap/store"
+)
+
+// outboxBucket holds the mutations that couldn't be sent for want of a
+// connection, keyed by when they were queued
+const outboxBucket = "outbox"
+
+// ErrQueued fails the results of mutations an Outbox kept for later
+var ErrQueued = errors.New("queued until the connection is back")
+
+// ErrStale fails queued mutations whose tasks changed or went away since
+// they were planned; they are dropped instead of applied
+var ErrStale = errors.New("task changed since the change was queued")
+
+// QueuedMutation is a write that is waiting for the connection to come back
+type QueuedMutation struct {
+	ID       string    `json:"id"`
+	Queued   time.Time `json:"queued"`
+	Mutation Mutation  `json:"mutation"`
+	// Error is why the write couldn't be sent
+	Error string `json:"error"`
+}
+
+// Outbox wraps a Writer and keeps the mutations that fail because the
+// network is down in the store, instead of failing the run. Once one
+// fails, the rest of the run's mutations are queued behind it without
+// being tried, so that they are applied in order later. Flush replays them.
+type Outbox struct {
+	writer  Writer
+	service *Service
+	store   *store.Store
+	clock   *datetime.Clock
+
+	mu      sync.Mutex
+	seq     int
+	offline bool
+}
+
+// NewOutbox creates an outbox that forwards mutations to writer, checking
+// queued ones against service before replaying them
+func NewOutbox(writer Writer, service *Service, st *store.Store, clock *datetime.Clock) *Outbox {
+	return &Outbox{writer: writer, service: service, store: st, clock: clock}
+}
+
+// Apply forwards mutations until one fails for want of a connection. That
+// one and every one after it are queued and fail with ErrQueued.
+func (o *Outbox) Apply(ctx context.Context, mutations []Mutation) []BatchResult {
+	if o.isOffline() {
+		return o.queue(mutations, errors.New("the connection dropped earlier in the run"))
+	}
+
+	results := o.writer.Apply(ctx, mutations)
+	for i, result := range results {
+		if result.Err == nil || ctx.Err() != nil || !IsOffline(result.Err) {
+			continue
+		}
+		o.mu.Lock()
+		o.offline = true
+		o.mu.Unlock()
+		// Writes after the first that failed may have gone through, e.g.
+		// inserts running in parallel; only the failed ones are queued
+		var failed []Mutation
+		var indexes []int
+		for _, later := range results[i:] {
+			if later.Err != nil {
+				failed = append(failed, mutations[later.Index])
+				indexes = append(indexes, later.Index)
+			}
+		}
+		for j, queued := range o.queue(failed, result.Err) {
+			results[indexes[j]] = BatchResult{Index: indexes[j], Err: queued.Err}
+		}
+		break
+	}
+	return results
+}
+
+// isOffline reports whether a write already failed for want of a connection
+func (o *Outbox) isOffline() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.offline
+}
+
+// queue keeps mutations and fails them with ErrQueued. A mutation that
+// can't be kept fails with the error it would have had.
+func (o *Outbox) queue(mutations []Mutation, cause error) []BatchResult {
+	results := make([]BatchResult, 0, len(mutations))
+	for i := range mutations {
+		queued := QueuedMutation{ID: o.nextID(), Queued: o.clock.Now(), Mutation: mutations[i], Error: cause.Error()}
+		if err := o.store.Put(outboxBucket, queued.ID, queued); err != nil {
+			log.Printf("Error queueing %s: %v", mutations[i].Summary, err)
+			results = append(results, BatchResult{Index: i, Err: cause})
+			continue
+		}
+		results = append(results, BatchResult{Index: i, Err: fmt.Errorf("%w: %v", ErrQueued, cause)})
+	}
+	return results
+}
+
+// nextID names a queued mutation; the fixed width makes keys sort in the
+// order the mutations were queued
+func (o *Outbox) nextID() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.seq++
+	return fmt.Sprintf("%s-%06d", o.clock.Now().UTC().Format("20060102T150405.000000000Z"), o.seq)
+}
+
+// FlushResult is what replaying the queue did with one mutation. Err is
+// nil for one that was applied; a mutation still queued because the
+// connection is still down fails with ErrQueued.
+type FlushResult struct {
+	Queued QueuedMutation
+	Err    error
+}
+
+// Flush replays the queued mutations in order. Each is first checked
+// against its task as it is now; one whose task changed or went away is
+// dropped with ErrStale, and updates keep changes made elsewhere like any
+// other. Replaying stops while the connection is still down, keeping the
+// rest queued.
+func (o *Outbox) Flush(ctx context.Context) ([]FlushResult, error) {
+	queue, err := Queued(o.store)
+	if err != nil {
+		return nil, err
+	}
+	o.mu.Lock()
+	o.offline = false
+	o.mu.Unlock()
+
+	var results []FlushResult
+	kept := func(rest []QueuedMutation, cause error) []FlushResult {
+		for _, queued := range rest {
+			results = append(results, FlushResult{Queued: queued, Err: fmt.Errorf("%w: %v", ErrQueued, cause)})
+		}
+		return results
+	}
+	// Tasks the queue itself wrote to have changed since for that reason
+	written := make(map[string]bool)
+	for i, queued := range queue {
+		if err := ctx.Err(); err != nil {
+			return kept(queue[i:], err), nil
+		}
+		m := queued.Mutation
+		err := o.service.checkQueued(ctx, m, m.Task != nil && written[m.Task.ID])
+		if err == nil {
+			err = o.writer.Apply(ctx, []Mutation{m})[0].Err
+		}
+		if err == nil && m.Task != nil {
+			written[m.Task.ID] = true
+		}
+		if IsOffline(err) {
+			return kept(queue[i:], err), nil
+		}
+		if err := o.store.Delete(outboxBucket, queued.ID); err != nil {
+			return results, err
+		}
+		results = append(results, FlushResult{Queued: queued, Err: err})
+	}
+	return results, nil
+}
+
+// checkQueued returns ErrStale when a queued mutation no longer fits its
+// task: the task was changed by someone else or deleted since it was read,
+// a subtask's parent is gone, or a task to insert is there already because
+// the write went through before the connection dropped. Updates are left
+// to updateTask, which rebases them onto what changed. rewritten is set for
+// a task an earlier queued mutation wrote to, whose changes are expected.
+func (s *Service) checkQueued(ctx context.Context, m Mutation, rewritten bool) error {
+	switch m.Kind {
+	case MutationMove, MutationDelete:
+		current, err := s.GetTask(ctx, m.TaskListID, m.Task.ID)
+		if IsNotFound(err) {
+			return fmt.Errorf("%w: '%s' was deleted", ErrStale, m.Task.Title)
+		}
+		if err != nil {
+			return err
+		}
+		if !rewritten && m.Task.Updated != "" && current.Updated != m.Task.Updated {
+			return fmt.Errorf("%w: '%s' was changed elsewhere", ErrStale, m.Task.Title)
+		}
+	case MutationInsert:
+		siblings, err := s.ListAllTasks(ctx, m.TaskListID)
+		if err != nil {
+			return err
+		}
+		parentFound := m.Parent == ""
+		for _, task := range siblings {
+			if task.ID == m.Parent {
+				parentFound = !task.Deleted
+			}
+			if task.Parent == m.Parent && task.Title == m.Task.Title {
+				return fmt.Errorf("%w: '%s' is there already", ErrStale, m.Task.Title)
+			}
+		}
+		if !parentFound {
+			return fmt.Errorf("%w: the task to add '%s' under was deleted", ErrStale, m.Task.Title)
+		}
+	}
+	return nil
+}
+
+// Queued returns the mutations waiting for the connection, oldest first
+func Queued(st *store.Store) ([]QueuedMutation, error) {
+	var queue []QueuedMutation
+	// Keys come sorted, which is the order the mutations were queued in
+	for _, key := range st.Keys(outboxBucket) {
+		var queued QueuedMutation
+		if _, err := st.Get(outboxBucket, key, &queued); err != nil {
+			return nil, err
+		}
+		queue = append(queue, queued)
+	}
+	return queue, nil
+}
+
+// DropQueued forgets the queued mutations without applying them
+func DropQueued(st *store.Store) error {
+	for _, key := range st.Keys(outboxBucket) {
+		if err := st.Delete(outboxBucket, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsOffline reports whether err means the API couldn't be reached, rather
+// than that it refused the request: a failed lookup or connection, a
+// timeout or a connection that dropped mid-request
+func IsOffline(err error) bool {
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return false
+	case errors.As(err, &dnsErr), errors.As(err, &opErr):
+		return true
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return true
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED)
+}
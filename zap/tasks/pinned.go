@@ -0,0 +1,73 @@
+package tasks
+
+import (
+	"strings"
+
+	"zap/todo"
+)
+
+// PinMarker in a task title keeps the task where it is when lists are reordered
+const PinMarker = "[pinned]"
+
+// IsPinned reports whether a task carries the pin marker or is listed in pinnedIDs
+func IsPinned(task *todo.Task, pinnedIDs map[string]bool) bool {
+	return pinnedIDs[task.ID] || strings.Contains(strings.ToLower(task.Title), PinMarker)
+}
+
+// heldIDs combines pinned task IDs with the IDs of tasks the filters
+// exclude, which applyPins both keeps in place
+func heldIDs(pinnedIDs, excluded map[string]bool) map[string]bool {
+	held := make(map[string]bool, len(pinnedIDs)+len(excluded))
+	for id := range pinnedIDs {
+		held[id] = true
+	}
+	for id := range excluded {
+		held[id] = true
+	}
+	return held
+}
+
+// applyPins merges a new order with the current one so that pinned tasks
+// keep their current positions and every other task fills the remaining
+// positions in the new order. Tasks missing from order keep their relative
+// order after the ranked ones.
+func applyPins(current []*todo.Task, order []string, pinnedIDs map[string]bool) []string {
+	pinnedAt := make(map[int]string)
+	pinned := make(map[string]bool)
+	for i, task := range current {
+		if IsPinned(task, pinnedIDs) {
+			pinnedAt[i] = task.ID
+			pinned[task.ID] = true
+		}
+	}
+	if len(pinned) == 0 {
+		return order
+	}
+
+	var unpinned []string
+	seen := make(map[string]bool)
+	for _, id := range order {
+		if !pinned[id] && !seen[id] {
+			unpinned = append(unpinned, id)
+			seen[id] = true
+		}
+	}
+	for _, task := range current {
+		if !pinned[task.ID] && !seen[task.ID] {
+			unpinned = append(unpinned, task.ID)
+		}
+	}
+
+	merged := make([]string, 0, len(current))
+	for i := 0; i < len(current); i++ {
+		if id, ok := pinnedAt[i]; ok {
+			merged = append(merged, id)
+			continue
+		}
+		if len(unpinned) > 0 {
+			merged = append(merged, unpinned[0])
+			unpinned = unpinned[1:]
+		}
+	}
+	return merged
+}
@@ -3,86 +3,606 @@ package tasks
 import (
 	"context"
 	"fmt"
-	"sort"
+	"log"
 	"strings"
+	"time"
 
+	"zap/backend"
+	"zap/datetime"
 	"zap/gemini"
-
-	tasksapi "google.golang.org/api/tasks/v1"
+	"zap/notes"
+	"zap/progress"
+	"zap/timelog"
+	"zap/todo"
 )
 
+// ReplaySource is reported as the ranking source when earlier priorities
+// are reused
+const ReplaySource = "replay"
+
 type Prioritizer struct {
-	service *Service
-	gemini  *gemini.GeminiClient
+	service      *Service
+	gemini       *gemini.GeminiClient
+	orchestrator *Orchestrator
+	clock        *datetime.Clock
+	escalation   *EscalationPolicy
+	wip          *WIPPolicy
+	stability    *StabilityPolicy
+	history      *History
+	timeLog      *timelog.Log
+	pinned       map[string]bool
+	filter       *Filter
+	review       ReviewFunc
+	shadow       ShadowFunc
+	diff         bool
+	suggestOnly  Annotation
+	subtaskOrder SubtaskOrder
+	noteLog      map[notes.Kind]bool
+	namespace    notes.Namespace
+	// ranked holds the priorities each list was ranked with, by list ID,
+	// and those of each parent's subtasks, by parent task ID; replay, when
+	// set, is reused instead of ranking again
+	ranked map[string][]gemini.TaskPriority
+	replay map[string][]gemini.TaskPriority
+
+	progress *progress.Reporter
+	results  []ListResult
+}
+
+// ListResult is what ReorderTasksByPriority did to one list
+type ListResult struct {
+	ListID   string `json:"listId"`
+	Title    string `json:"title"`
+	Tasks    int    `json:"tasks"`
+	RankedBy string `json:"rankedBy,omitempty"`
+	Moves    int    `json:"moves"`
+	// SubtaskMoves counts the moves that ordered subtasks beneath their parents
+	SubtaskMoves int `json:"subtaskMoves,omitempty"`
+	Updates      int `json:"updates"`
+	// Excluded counts the tasks the filters kept from being ranked
+	Excluded int `json:"excluded,omitempty"`
+	// Rejected is set when the user rejected the ranking and the list was
+	// left as it was
+	Rejected bool `json:"rejected,omitempty"`
+	// Demoted counts the tasks moved out of the list over its WIP limit
+	Demoted int `json:"demoted,omitempty"`
+	// Settled counts the tasks left in place because the ranking moved
+	// them too little to be worth it
+	Settled int `json:"settled,omitempty"`
+	// Steadied counts the tasks that kept their last score because the
+	// new one was within the stability margin
+	Steadied int `json:"steadied,omitempty"`
+	// LLMError is set when the model failed and the heuristic ranked the list
+	LLMError string `json:"llmError,omitempty"`
+	// Corrections describes what was repaired in the model's ranking
+	// before it was used, such as unknown tasks dropped and explanations
+	// that got due dates wrong
+	Corrections []string `json:"corrections,omitempty"`
+	// Truncated names the tasks whose title or notes were cut to fit the
+	// limits on what is sent to the model
+	Truncated []string `json:"truncated,omitempty"`
+	// Chunks is how many prompts the list was ranked in when it was too
+	// long for the model's context window
+	Chunks int `json:"chunks,omitempty"`
+	// Report is every top-level task's old and new position, for exports
+	Report []ReportRow `json:"-"`
+	// Diff is the list's current and proposed order side by side, when
+	// asked for with SetDiff
+	Diff []DiffRow `json:"diff,omitempty"`
 }
 
-func NewPrioritizer(service *Service, geminiClient *gemini.GeminiClient) *Prioritizer {
+// ReviewFunc shows the user a list's proposed ranking, highest priority
+// first. It returns accept to apply the ranking, or the feedback to revise
+// it with; neither rejects it.
+type ReviewFunc func(listTitle string, tasks []*todo.Task, priorities []gemini.TaskPriority) (accept bool, feedback string)
+
+// ShadowFunc ranks a list another way next to the ranking that is applied,
+// given the tasks and signals that ranking was made from and the provider
+// and prompt that made it. It must not change the list.
+type ShadowFunc func(ctx context.Context, listID, listTitle string, tasks []*todo.Task, signals gemini.RankSignals, priorities []gemini.TaskPriority, source, prompt string)
+
+// NewPrioritizer creates a prioritizer. With a nil Gemini client tasks are
+// ranked by HeuristicPriorities.
+func NewPrioritizer(service *Service, geminiClient *gemini.GeminiClient, orchestrator *Orchestrator, clock *datetime.Clock) *Prioritizer {
 	return &Prioritizer{
-		service: service,
-		gemini:  geminiClient,
+		service:      service,
+		gemini:       geminiClient,
+		orchestrator: orchestrator,
+		clock:        clock,
+	}
+}
+
+// SetEscalation enables the overdue escalation policy
+func (p *Prioritizer) SetEscalation(policy *EscalationPolicy) {
+	p.escalation = policy
+}
+
+// SetWIP enables work-in-progress limits
+func (p *Prioritizer) SetWIP(policy *WIPPolicy) {
+	p.wip = policy
+}
+
+// SetStability leaves tasks in place that would move too little
+func (p *Prioritizer) SetStability(policy *StabilityPolicy) {
+	p.stability = policy
+}
+
+// SetHistory enables starvation prevention: how long tasks have ranked in
+// the bottom quartile is fed into ranking, and every run is recorded
+func (p *Prioritizer) SetHistory(history *History) {
+	p.history = history
+}
+
+// SetTimeLog feeds estimates, corrected by tracked time, and the time
+// already worked on tasks into ranking
+func (p *Prioritizer) SetTimeLog(log *timelog.Log) {
+	p.timeLog = log
+}
+
+// SetPinned keeps the given task IDs, in addition to tasks whose titles
+// carry PinMarker, at their current positions
+func (p *Prioritizer) SetPinned(taskIDs []string) {
+	p.pinned = make(map[string]bool, len(taskIDs))
+	for _, id := range taskIDs {
+		p.pinned[id] = true
 	}
 }
 
+// SetFilter keeps the tasks filter excludes out of prompts and mutations
+func (p *Prioritizer) SetFilter(filter *Filter) {
+	p.filter = filter
+}
+
+// SetReview has the user review every ranking the model proposes before it
+// is applied. Feedback is sent back to the model in the same conversation
+// until the user accepts or rejects the ranking.
+func (p *Prioritizer) SetReview(review ReviewFunc) {
+	p.review = review
+}
+
+// SetDiff prints each list's current and proposed order side by side
+// before the list is reordered, and keeps them in its result
+func (p *Prioritizer) SetDiff(diff bool) {
+	p.diff = diff
+}
+
+// SetShadow has every list the model or heuristic ranks ranked again by
+// shadow, for comparison. Replayed rankings aren't shadowed.
+func (p *Prioritizer) SetShadow(shadow ShadowFunc) {
+	p.shadow = shadow
+}
+
+// SetSuggestOnly stops the prioritizer from moving tasks. Priorities are
+// surfaced through the given annotation instead.
+func (p *Prioritizer) SetSuggestOnly(annotation Annotation) {
+	p.suggestOnly = annotation
+}
+
+// SetNamespace sets the namespace of the block and markers the prioritizer
+// writes in tasks
+func (p *Prioritizer) SetNamespace(ns notes.Namespace) {
+	p.namespace = ns
+}
+
+// SetProgress reports each list's fetch, analyze and reorder phases to
+// reporter and prints through it
+func (p *Prioritizer) SetProgress(reporter *progress.Reporter) {
+	p.progress = reporter
+}
+
+// Results returns the outcome of each list in the last
+// ReorderTasksByPriority, in the order the lists were processed
+func (p *Prioritizer) Results() []ListResult {
+	return p.results
+}
+
+// Ranked returns the priorities each list was ranked with in the last
+// ReorderTasksByPriority, keyed by task list ID, and those of ordered
+// subtasks, keyed by parent task ID
+func (p *Prioritizer) Ranked() map[string][]gemini.TaskPriority {
+	return p.ranked
+}
+
+// SetReplay makes the prioritizer reuse earlier priorities instead of
+// ranking again, for lists whose tasks were all ranked before. Repeating a
+// run with the same answers shows whether it is idempotent.
+func (p *Prioritizer) SetReplay(ranked map[string][]gemini.TaskPriority) {
+	p.replay = ranked
+}
+
 // taskWithPriority combines a task with its priority for sorting
 type taskWithPriority struct {
-	task     *tasksapi.Task
+	task     *todo.Task
 	priority float64
 }
 
 // ReorderTasksByPriority reorders tasks in the specified lists based on AI analysis
 func (p *Prioritizer) ReorderTasksByPriority(ctx context.Context, targetLists []string) error {
+	for _, phase := range []string{progress.Fetch, progress.Analyze, progress.Reorder} {
+		p.progress.Expect(phase, len(targetLists))
+	}
+	p.results = nil
+
 	for _, listTitle := range targetLists {
+		done := p.progress.Begin(progress.Fetch, listTitle)
 		taskList, err := p.service.GetTaskListByTitle(listTitle)
 		if err != nil {
-			return fmt.Errorf("error finding task list %s: %v", listTitle, err)
+			done()
+			return fmt.Errorf("error finding task list %s: %w", listTitle, err)
 		}
 
-		tasks, err := p.service.ListTasks(taskList.Id)
+		tasks, err := p.service.ListTasks(taskList.ID)
+		done()
 		if err != nil {
-			return fmt.Errorf("error fetching tasks for list %s: %v", listTitle, err)
+			return fmt.Errorf("error fetching tasks for list %s: %w", listTitle, err)
 		}
 
-		// Filter out subtasks - only process top-level tasks
-		var topLevelTasks []*tasksapi.Task
-		for _, task := range tasks {
+		// Filter out subtasks - only process top-level tasks. Orphaned
+		// subtasks (parent hidden or completed) keep their parent.
+		tree := NewTaskTree(tasks)
+		var topLevelTasks []*todo.Task
+		for _, task := range tree.TopLevel() {
 			if task.Parent == "" {
 				topLevelTasks = append(topLevelTasks, task)
 			}
 		}
 
+		// Excluded tasks are neither ranked nor changed, and hold their
+		// positions like pinned tasks
+		excluded := p.filter.Excluded(topLevelTasks)
+		rankable := withoutExcluded(topLevelTasks, excluded)
+		held := heldIDs(p.pinned, excluded)
+
+		p.results = append(p.results, ListResult{ListID: taskList.ID, Title: taskList.Title, Tasks: len(rankable), Excluded: len(excluded)})
+		result := &p.results[len(p.results)-1]
+
 		// Skip if no top-level tasks in the list
 		if len(topLevelTasks) == 0 {
-			fmt.Printf("No top-level tasks found in list: %s\n", listTitle)
+			p.progress.Printf("No top-level tasks found in list: %s\n", listTitle)
+			continue
+		}
+		if len(rankable) == 0 {
+			p.progress.Printf("All %d tasks in list %s are excluded by filters\n", len(excluded), listTitle)
 			continue
 		}
 
-		// Get priorities from Gemini
-		priorities, err := p.gemini.AnalyzeAndPrioritizeTasks(ctx, topLevelTasks)
+		done = p.progress.Begin(progress.Analyze, listTitle)
+		signals := p.signals(listTitle, rankable)
+		priorities, source, session, llmErr := p.priorities(ctx, taskList.ID, listTitle, rankable, signals)
+		done()
+		result.RankedBy = source
+		if llmErr != nil {
+			result.LLMError = llmErr.Error()
+		}
+		if p.review != nil && session != nil {
+			var accepted bool
+			priorities, accepted = p.reviewRanking(ctx, session, listTitle, rankable, priorities)
+			if !accepted {
+				result.Rejected = true
+				p.progress.Printf("Kept the current order of list %s\n", listTitle)
+				continue
+			}
+		}
+		prompt := ""
+		if session != nil {
+			prompt = p.gemini.RankPromptID()
+			result.Corrections = p.gemini.LastCorrections()
+			result.Truncated = p.gemini.LastTruncated()
+			if chunks := p.gemini.LastChunks(); chunks > 1 {
+				result.Chunks = chunks
+				p.progress.Printf("Ranked list %s in %d parts to fit the model's context window\n", listTitle, chunks)
+			}
+			if len(result.Truncated) > 0 {
+				p.progress.Printf("Cut the titles or notes of %d tasks in list %s to fit the prompt: %s\n", len(result.Truncated), listTitle, strings.Join(result.Truncated, ", "))
+			}
+			if len(result.Corrections) > 0 {
+				p.progress.Printf("Corrected the ranking of list %s:\n  %s\n", listTitle, strings.Join(result.Corrections, "\n  "))
+			}
+		}
+		if p.shadow != nil && source != ReplaySource {
+			p.shadow(ctx, taskList.ID, listTitle, rankable, signals, priorities, source, prompt)
+		}
+		if p.ranked == nil {
+			p.ranked = make(map[string][]gemini.TaskPriority)
+		}
+		p.ranked[taskList.ID] = append([]gemini.TaskPriority(nil), priorities...)
+
+		// Parents rank higher the more of their subtasks are done. Subtasks
+		// completed in the Google Tasks apps are hidden, so they are fetched
+		// separately.
+		allTasks, err := p.service.ListAllTasks(ctx, taskList.ID)
 		if err != nil {
-			return fmt.Errorf("error analyzing tasks for list %s: %v", listTitle, err)
+			log.Printf("Error fetching completed subtasks for list %s: %v", listTitle, err)
+		} else {
+			rollup(priorities, SubtaskProgress(NewTaskTree(allTasks)))
 		}
 
-		// Sort priorities by position
-		sort.Slice(priorities, func(i, j int) bool {
-			return priorities[i].NewPosition < priorities[j].NewPosition
-		})
+		// The scores of the last run damp this run's: a score only changes
+		// by more than the margin, and a task only moves far enough or into
+		// another band, so rankings that wobble between runs don't reorder
+		// the list every time
+		var previous map[string]float64
+		if p.stability != nil && p.history != nil {
+			previous, err = p.history.Priorities(taskIDs(rankable))
+			if err != nil {
+				log.Printf("Error reading ranking history for list %s: %v", listTitle, err)
+				previous = nil
+			}
+		}
+		if previous != nil {
+			result.Steadied = p.stability.steady(priorities, previous)
+		}
 
-		// Apply the new order
-		var previousTaskID string
-		for _, priority := range priorities {
-			_, err := p.service.MoveTask(taskList.Id, priority.TaskID, previousTaskID)
+		// Sort priorities, breaking ties deterministically
+		var firstSeen map[string]time.Time
+		if p.history != nil {
+			firstSeen, err = p.history.FirstSeen(taskIDs(rankable))
 			if err != nil {
-				return fmt.Errorf("error moving task %s: %v", priority.TaskID, err)
+				log.Printf("Error reading ranking history for list %s: %v", listTitle, err)
 			}
-			previousTaskID = priority.TaskID
+		}
+		rankPriorities(priorities, rankable, firstSeen)
+
+		// Overdue tasks go to the top regardless of how they were ranked
+		var escalated []escalatedTask
+		if p.escalation != nil {
+			escalated = p.escalation.overdue(rankable, p.clock)
+			priorities = boost(priorities, escalated)
 		}
 
-		fmt.Printf("Successfully prioritized %d tasks in list: %s\n", len(priorities), listTitle)
+		// Apply the new order around pinned tasks
+		order := make([]string, len(priorities))
+		for i, priority := range priorities {
+			order[i] = priority.TaskID
+		}
+		order = applyPins(topLevelTasks, order, held)
+		if previous != nil {
+			order, result.Settled = p.stability.settle(topLevelTasks, order, priorities, previous, held)
+		}
+		priorities = sortPriorities(priorities, order)
+
+		// The lowest-ranked tasks over a WIP limit leave the list, or are
+		// flagged when suggesting
+		var demoted []*todo.Task
+		if p.wip != nil {
+			demoted = p.wip.overflow(listTitle, topLevelTasks, order, held)
+		}
+		var demotions []Mutation
+		if len(demoted) > 0 && p.suggestOnly == "" {
+			overflowList, err := p.service.GetTaskListByTitle(p.wip.Overflow)
+			if err != nil {
+				return fmt.Errorf("error finding WIP overflow list %s: %w", p.wip.Overflow, err)
+			}
+			demotions = demoteMutations(taskList.ID, overflowList.ID, overflowList.Title, demoted)
+			order = withoutTasks(order, demoted)
+			priorities = sortPriorities(priorities, order)
+		} else if len(demoted) > 0 {
+			p.wip.flagOverflow(listTitle, priorities, demoted)
+		}
+
+		// The ranking is recorded the way the backend's list can: by order,
+		// or in a priority field or label
+		var mutations []Mutation
+		caps := p.service.Capabilities(taskList.ID)
+		if p.suggestOnly == "" {
+			mutations, err = p.rankMutations(ctx, taskList.ID, topLevelTasks, order, caps)
+			if err != nil {
+				return fmt.Errorf("error reading priorities of list %s: %w", listTitle, err)
+			}
+		}
+		result.Moves = len(mutations)
+		if p.suggestOnly == "" && caps.Subtasks {
+			subtaskMoves := p.subtaskMutations(ctx, taskList.ID, listTitle, tree)
+			result.SubtaskMoves = len(subtaskMoves)
+			mutations = append(mutations, subtaskMoves...)
+		}
+		var updates []Mutation
+		if p.escalation != nil {
+			updates = p.escalation.markerMutations(taskList.ID, rankable, escalated)
+		}
+		result.Report = reportRows(topLevelTasks, priorities)
+		if p.suggestOnly != "" {
+			updates = mergeUpdates(updates, annotationMutations(taskList.ID, applyUpdates(rankable, updates), priorities, p.suggestOnly, p.namespace))
+			if p.suggestOnly == AnnotateReport {
+				writeReport(p.progress.Out(), listTitle, result.Report)
+			}
+		} else if !caps.Ordering && !caps.PriorityField && !caps.Labels {
+			p.progress.Printf("List %s can't record a ranking, so it is only reported\n", listTitle)
+			writeReport(p.progress.Out(), listTitle, result.Report)
+		}
+		if p.diff && p.suggestOnly == "" && (caps.Ordering || caps.PriorityField || caps.Labels) {
+			result.Diff = diffRows(topLevelTasks, order, priorities)
+			writeDiff(p.progress.Out(), listTitle, result.Diff)
+		}
+		updates = mergeUpdates(updates, p.noteMutations(taskList.ID, applyUpdates(rankable, updates), rankable, priorities, escalated))
+		result.Updates = len(updates)
+		mutations = append(mutations, updates...)
+		result.Demoted = len(demotions)
+		mutations = append(mutations, demotions...)
+		done = p.progress.Begin(progress.Reorder, listTitle)
+		_, err = p.orchestrator.Apply(ctx, mutations)
+		done()
+		if err != nil {
+			return fmt.Errorf("error reordering list %s: %v", listTitle, err)
+		}
+
+		if p.history != nil {
+			if err := p.history.Record(taskList.ID, priorities, source); err != nil {
+				log.Printf("Error recording ranking history for list %s: %v", listTitle, err)
+			}
+			if err := p.history.RecordRun(taskList.ID, priorities, source, prompt); err != nil {
+				log.Printf("Error recording ranking history for list %s: %v", listTitle, err)
+			}
+		}
+
+		if p.escalation != nil && p.escalation.OnEscalate != nil {
+			for _, e := range escalated {
+				p.escalation.OnEscalate(ctx, listTitle, e.task, e.daysOverdue)
+			}
+		}
+
+		if len(demoted) > 0 {
+			limit, _ := p.wip.limit(listTitle)
+			if p.suggestOnly != "" {
+				p.progress.Printf("%d tasks in list %s are over its WIP limit of %d\n", len(demoted), listTitle, limit)
+			} else {
+				p.progress.Printf("Moved %d tasks over the WIP limit of %d from %s to %s\n", len(demoted), limit, listTitle, p.wip.Overflow)
+			}
+		}
+
+		if result.Settled > 0 {
+			p.progress.Printf("Left %d tasks in list %s in place that would have moved %d places or fewer\n", result.Settled, listTitle, p.stability.MinMove)
+		}
+
+		if p.suggestOnly != "" {
+			p.progress.Printf("Suggested priorities for %d tasks in list: %s (order unchanged, ranked by %s)\n", len(priorities), listTitle, source)
+			continue
+		}
+		p.progress.Printf("Successfully prioritized %d tasks in list: %s (ranked by %s)\n", len(priorities), listTitle, source)
 	}
 
 	return nil
 }
 
+// rankMutations plans the writes that record order on a list: moves on
+// lists that keep their order, priority writes on lists that keep ranks in
+// a field or labels, and none on lists that can do neither
+func (p *Prioritizer) rankMutations(ctx context.Context, taskListID string, tasks []*todo.Task, order []string, caps backend.Capabilities) ([]Mutation, error) {
+	switch {
+	case caps.Ordering:
+		return OrderMutations(taskListID, "", tasks, order), nil
+	case caps.PriorityField || caps.Labels:
+		current, err := p.service.Priorities(ctx, taskListID)
+		if err != nil {
+			return nil, err
+		}
+		return PriorityMutations(taskListID, tasks, order, current, !caps.PriorityField), nil
+	}
+	return nil, nil
+}
+
+// priorities asks Gemini for priorities, falling back to the heuristic when
+// there is no Gemini client or the request fails, unless priorities are
+// being replayed. It also returns the name of the provider that produced
+// them, the conversation when the model ranked them, and the model's error
+// when the heuristic stood in.
+func (p *Prioritizer) priorities(ctx context.Context, taskListID, listTitle string, tasks []*todo.Task, signals gemini.RankSignals) ([]gemini.TaskPriority, string, *gemini.RankSession, error) {
+	if replayed, ok := replayPriorities(p.replay[taskListID], tasks); ok {
+		return replayed, ReplaySource, nil, nil
+	}
+
+	if p.gemini == nil {
+		return HeuristicPriorities(tasks, signals), HeuristicSource, nil, nil
+	}
+	session, priorities, err := p.gemini.StartRanking(ctx, tasks, signals)
+	if err != nil {
+		log.Printf("Error analyzing tasks for list %s, using heuristic priorities: %v", listTitle, err)
+		return HeuristicPriorities(tasks, signals), HeuristicSource, nil, err
+	}
+	return priorities, p.gemini.LastProvider(), session, nil
+}
+
+// signals gathers what ranking weighs besides the tasks themselves: how
+// long they have ranked near the bottom and how much work they take
+func (p *Prioritizer) signals(listTitle string, tasks []*todo.Task) gemini.RankSignals {
+	signals := gemini.RankSignals{Clock: p.clock}
+	if p.history != nil {
+		runs, err := p.history.BottomRuns(taskIDs(tasks))
+		if err != nil {
+			log.Printf("Error reading ranking history for list %s: %v", listTitle, err)
+		}
+		signals.BottomRuns = runs
+	}
+	if p.timeLog != nil {
+		efforts, err := p.timeLog.Efforts(tasks)
+		if err != nil {
+			log.Printf("Error reading tracked time for list %s: %v", listTitle, err)
+		}
+		signals.Effort = efforts
+	}
+	return signals
+}
+
+// reviewRanking shows the model's ranking to the user and revises it with
+// their feedback until they accept or reject it. It reports whether they
+// accepted it. A failed revision keeps the ranking before it.
+func (p *Prioritizer) reviewRanking(ctx context.Context, session *gemini.RankSession, listTitle string, tasks []*todo.Task, priorities []gemini.TaskPriority) ([]gemini.TaskPriority, bool) {
+	for {
+		shown := append([]gemini.TaskPriority(nil), priorities...)
+		rankPriorities(shown, tasks, nil)
+		accept, feedback := p.review(listTitle, tasks, shown)
+		if accept {
+			return priorities, true
+		}
+		if feedback == "" {
+			return nil, false
+		}
+		revised, err := session.Refine(ctx, feedback)
+		if err != nil {
+			log.Printf("Error revising the ranking of list %s: %v", listTitle, err)
+			continue
+		}
+		priorities = revised
+	}
+}
+
+// replayPriorities returns a copy of earlier priorities when they cover
+// every task
+func replayPriorities(earlier []gemini.TaskPriority, tasks []*todo.Task) ([]gemini.TaskPriority, bool) {
+	if earlier == nil {
+		return nil, false
+	}
+	byID := make(map[string]bool, len(earlier))
+	for _, priority := range earlier {
+		byID[priority.TaskID] = true
+	}
+	for _, task := range tasks {
+		if !byID[task.ID] {
+			return nil, false
+		}
+	}
+	return append([]gemini.TaskPriority(nil), earlier...), true
+}
+
+// taskIDs returns the IDs of tasks in order
+func taskIDs(tasks []*todo.Task) []string {
+	ids := make([]string, len(tasks))
+	for i, task := range tasks {
+		ids[i] = task.ID
+	}
+	return ids
+}
+
+// withoutExcluded drops the tasks in excluded
+func withoutExcluded(tasks []*todo.Task, excluded map[string]bool) []*todo.Task {
+	if len(excluded) == 0 {
+		return tasks
+	}
+	var kept []*todo.Task
+	for _, task := range tasks {
+		if !excluded[task.ID] {
+			kept = append(kept, task)
+		}
+	}
+	return kept
+}
+
+// sortPriorities puts priorities in the given order of task IDs, dropping
+// IDs without a priority
+func sortPriorities(priorities []gemini.TaskPriority, order []string) []gemini.TaskPriority {
+	byID := make(map[string]gemini.TaskPriority, len(priorities))
+	for _, priority := range priorities {
+		byID[priority.TaskID] = priority
+	}
+	sorted := make([]gemini.TaskPriority, 0, len(order))
+	for _, id := range order {
+		if priority, ok := byID[id]; ok {
+			sorted = append(sorted, priority)
+		}
+	}
+	return sorted
+}
+
 // getPriorityForTask returns the priority value for a given task ID
 func getPriorityForTask(taskID string, priorities []gemini.TaskPriority) float64 {
 	for _, p := range priorities {
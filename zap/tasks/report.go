@@ -0,0 +1,147 @@
+package tasks
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"zap/gemini"
+	"zap/todo"
+)
+
+// ReportRow is where one task was and where it was ranked in a run.
+// Positions count from 1.
+type ReportRow struct {
+	TaskID      string
+	Title       string
+	OldPosition int
+	NewPosition int
+	Priority    float64
+	Explanation string
+}
+
+// reportRows lists tasks in their ranked order next to their current
+// positions
+func reportRows(tasks []*todo.Task, priorities []gemini.TaskPriority) []ReportRow {
+	current := make(map[string]int, len(tasks))
+	byID := make(map[string]*todo.Task, len(tasks))
+	for i, task := range tasks {
+		current[task.ID] = i + 1
+		byID[task.ID] = task
+	}
+
+	var rows []ReportRow
+	for _, priority := range priorities {
+		task, ok := byID[priority.TaskID]
+		if !ok {
+			continue
+		}
+		rows = append(rows, ReportRow{
+			TaskID:      task.ID,
+			Title:       task.Title,
+			OldPosition: current[task.ID],
+			NewPosition: len(rows) + 1,
+			Priority:    priority.Priority,
+			Explanation: priority.Explanation,
+		})
+	}
+	return rows
+}
+
+// DiffRow is one position of a list before and after a reorder, side by
+// side. Positions count from 1.
+type DiffRow struct {
+	Position   int    `json:"position"`
+	CurrentID  string `json:"currentId,omitempty"`
+	Current    string `json:"current,omitempty"`
+	ProposedID string `json:"proposedId,omitempty"`
+	Proposed   string `json:"proposed,omitempty"`
+	// Priority is the proposed task's score; Held tasks, pinned or kept
+	// out by filters, have none and stay where they are
+	Priority float64 `json:"priority,omitempty"`
+	Held     bool    `json:"held,omitempty"`
+	// Moved is how many places the proposed task rises, negative when it
+	// falls
+	Moved int `json:"moved"`
+}
+
+// diffRows sets the current order of tasks next to the proposed order.
+// Tasks missing from order leave the list, and only appear as current.
+func diffRows(tasks []*todo.Task, order []string, priorities []gemini.TaskPriority) []DiffRow {
+	current := make(map[string]int, len(tasks))
+	byID := make(map[string]*todo.Task, len(tasks))
+	for i, task := range tasks {
+		current[task.ID] = i + 1
+		byID[task.ID] = task
+	}
+	scores := make(map[string]float64, len(priorities))
+	for _, priority := range priorities {
+		scores[priority.TaskID] = priority.Priority
+	}
+
+	var proposed []*todo.Task
+	for _, id := range order {
+		if task, ok := byID[id]; ok {
+			proposed = append(proposed, task)
+		}
+	}
+	rows := make([]DiffRow, max(len(tasks), len(proposed)))
+	for i := range rows {
+		rows[i].Position = i + 1
+		if i < len(tasks) {
+			rows[i].CurrentID = tasks[i].ID
+			rows[i].Current = tasks[i].Title
+		}
+		if i < len(proposed) {
+			task := proposed[i]
+			score, ranked := scores[task.ID]
+			rows[i].ProposedID = task.ID
+			rows[i].Proposed = task.Title
+			rows[i].Priority = score
+			rows[i].Held = !ranked
+			rows[i].Moved = current[task.ID] - (i + 1)
+		}
+	}
+	return rows
+}
+
+// writeDiff prints the current and proposed order side by side, with how
+// far each task moves
+func writeDiff(out io.Writer, listTitle string, rows []DiffRow) {
+	moved := false
+	for _, row := range rows {
+		moved = moved || row.CurrentID != row.ProposedID
+	}
+	if !moved {
+		fmt.Fprintf(out, "Order of %s unchanged\n", listTitle)
+		return
+	}
+
+	fmt.Fprintf(out, "Changes to the order of %s:\n", listTitle)
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  #\tCURRENT\tPROPOSED\tSCORE\tMOVE")
+	for _, row := range rows {
+		score, move := "", ""
+		switch {
+		case row.ProposedID == "":
+		case row.Held:
+			score, move = "-", "held"
+		default:
+			score = fmt.Sprintf("%.0f", row.Priority)
+			move = movement(row.Moved)
+		}
+		fmt.Fprintf(w, "  %d.\t%s\t%s\t%s\t%s\n", row.Position, row.Current, row.Proposed, score, move)
+	}
+	w.Flush()
+}
+
+// movement draws how many places a task moves: up, down or not at all
+func movement(moved int) string {
+	switch {
+	case moved > 0:
+		return fmt.Sprintf("↑%d", moved)
+	case moved < 0:
+		return fmt.Sprintf("↓%d", -moved)
+	}
+	return "="
+}
@@ -0,0 +1,63 @@
+package tasks
+
+import (
+	"fmt"
+
+	"zap/gemini"
+)
+
+// rollupBoost is added to a parent's priority when all of its subtasks are
+// done, and in proportion when some are
+const rollupBoost = 10
+
+// Progress counts a task's subtasks and how many of them are done
+type Progress struct {
+	Done  int
+	Total int
+}
+
+// SubtaskProgress counts the subtasks of every task in tree that has any.
+// The tree should include completed and hidden tasks, since tasks completed
+// in the Google Tasks apps are hidden.
+func SubtaskProgress(tree *TaskTree) map[string]Progress {
+	progress := make(map[string]Progress)
+	tree.Walk(func(node *TaskNode) bool {
+		if len(node.Children) == 0 {
+			return true
+		}
+		var p Progress
+		for _, child := range node.Children {
+			if child.Task.Deleted {
+				continue
+			}
+			p.Total++
+			if child.Task.Status == "completed" {
+				p.Done++
+			}
+		}
+		if p.Total > 0 {
+			progress[node.Task.ID] = p
+		}
+		return true
+	})
+	return progress
+}
+
+// rollup raises each parent's priority by the share of its subtasks that
+// are done, so that of two equally urgent tasks the one closer to finished
+// ranks first. Priorities stay within 0-100.
+func rollup(priorities []gemini.TaskPriority, progress map[string]Progress) {
+	for i, priority := range priorities {
+		p, ok := progress[priority.TaskID]
+		if !ok || p.Done == 0 {
+			continue
+		}
+		priorities[i].Priority = min(100, priority.Priority+rollupBoost*float64(p.Done)/float64(p.Total))
+		note := fmt.Sprintf("%d/%d subtasks done", p.Done, p.Total)
+		if priority.Explanation == "" {
+			priorities[i].Explanation = note
+		} else {
+			priorities[i].Explanation = priority.Explanation + "; " + note
+		}
+	}
+}
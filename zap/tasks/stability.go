@@ -0,0 +1,101 @@
+package tasks
+
+import (
+	"math"
+
+	"zap/gemini"
+	"zap/todo"
+)
+
+// bandWidth splits the 0-100 priority scale into the four bands P1 to P4
+const bandWidth = 25
+
+// StabilityPolicy keeps tasks where they are unless a run moves them far
+// enough to matter. Moving a task a place or two every run, as rankings
+// wobble, reorders the list in the Tasks apps for nothing.
+type StabilityPolicy struct {
+	// MinMove is how many places a task must move by more than to be
+	// moved, unless its priority band changes
+	MinMove int
+	// Margin is how far a score must move from the task's last one to
+	// count; closer scores keep the last one
+	Margin float64
+}
+
+// band returns the priority band of a score: 1 for P1, the highest, to 4
+func band(priority float64) int {
+	b := 4 - int(priority)/bandWidth
+	return min(max(b, 1), 4)
+}
+
+// steady gives the tasks whose new score is within Margin of the one they
+// had in the last run that one back, and returns how many there were.
+// Previous holds the last scores; tasks without one keep their new score.
+func (s *StabilityPolicy) steady(priorities []gemini.TaskPriority, previous map[string]float64) int {
+	if s.Margin <= 0 {
+		return 0
+	}
+	steadied := 0
+	for i, priority := range priorities {
+		before, ok := previous[priority.TaskID]
+		if !ok || priority.Priority == before || math.Abs(priority.Priority-before) > s.Margin {
+			continue
+		}
+		priorities[i].Priority = before
+		steadied++
+	}
+	return steadied
+}
+
+// settle returns order with the tasks that would move MinMove places or
+// fewer, and stay in their priority band, kept in their current order. The
+// other tasks, held ones included, take their places in order, and the
+// kept ones fill the rest. Previous holds the tasks' scores in the last
+// run; tasks without one, such as new ones, always take their places. It
+// also returns how many tasks were kept back.
+func (s *StabilityPolicy) settle(current []*todo.Task, order []string, priorities []gemini.TaskPriority, previous map[string]float64, held map[string]bool) ([]string, int) {
+	if s.MinMove <= 0 {
+		return order, 0
+	}
+	from := make(map[string]int, len(current))
+	for i, task := range current {
+		from[task.ID] = i
+	}
+	scores := make(map[string]float64, len(priorities))
+	for _, priority := range priorities {
+		scores[priority.TaskID] = priority.Priority
+	}
+
+	settled := make([]string, len(order))
+	placed := make(map[string]bool, len(order))
+	for to, id := range order {
+		i, known := from[id]
+		score, ranked := scores[id]
+		before, seen := previous[id]
+		moved := to - i
+		if !known || !ranked || !seen || held[id] || max(moved, -moved) > s.MinMove || band(score) != band(before) {
+			settled[to] = id
+			placed[id] = true
+		}
+	}
+
+	inOrder := make(map[string]bool, len(order))
+	for _, id := range order {
+		inOrder[id] = true
+	}
+	kept := 0
+	next := 0
+	for _, task := range current {
+		if !inOrder[task.ID] || placed[task.ID] {
+			continue
+		}
+		for settled[next] != "" {
+			next++
+		}
+		settled[next] = task.ID
+		if order[next] != task.ID {
+			kept++
+		}
+	}
+	return settled, kept
+}
@@ -0,0 +1,131 @@
+package tasks
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"zap/datetime"
+	"zap/todo"
+)
+
+// ListTasks is a list's title with every one of its tasks, including
+// completed and hidden ones
+type ListTasks struct {
+	Title string
+	Tasks []*todo.Task
+}
+
+// Stats summarizes how top-level tasks move through lists. Subtasks are
+// steps of their parents and aren't counted.
+type Stats struct {
+	Weeks []WeekStats `json:"weeks"`
+	Lists []ListStats `json:"lists"`
+	// Reprioritized holds the tasks whose rank changed in more than
+	// MinReprioritized runs, most changed first
+	MinReprioritized int                 `json:"minReprioritized"`
+	Reprioritized    []ReprioritizedTask `json:"reprioritized"`
+}
+
+// WeekStats is the number of tasks completed in a week starting on Monday
+type WeekStats struct {
+	Week      string `json:"week"`
+	Start     string `json:"start"`
+	Completed int    `json:"completed"`
+}
+
+// ListStats is one list's open and completed tasks and how long completed
+// tasks took. Creation times aren't available from the Tasks API, so a
+// task's age counts from the run that first ranked it; Measured is the
+// number of completed tasks that zap ranked before.
+type ListStats struct {
+	List       string   `json:"list"`
+	Open       int      `json:"open"`
+	Completed  int      `json:"completed"`
+	Measured   int      `json:"measured"`
+	MedianDays *float64 `json:"medianDays"`
+}
+
+// ReprioritizedTask is a task that kept changing rank
+type ReprioritizedTask struct {
+	List  string `json:"list"`
+	Title string `json:"title"`
+	Times int    `json:"times"`
+}
+
+// ComputeStats reports the last weeks of throughput, the median time to
+// completion per list and the tasks reprioritized more than
+// minReprioritized times, from the lists' tasks and the ranking history
+func ComputeStats(lists []ListTasks, records map[string]RankRecord, clock *datetime.Clock, weeks, minReprioritized int) Stats {
+	stats := Stats{MinReprioritized: minReprioritized, Reprioritized: []ReprioritizedTask{}}
+
+	// Weeks start on Monday in the user's time zone, oldest first
+	today := clock.Today()
+	thisWeek := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+	starts := make([]time.Time, weeks)
+	for i := range starts {
+		starts[i] = thisWeek.AddDate(0, 0, -7*(weeks-1-i))
+		year, week := starts[i].ISOWeek()
+		stats.Weeks = append(stats.Weeks, WeekStats{Week: fmt.Sprintf("%d-W%02d", year, week), Start: starts[i].Format("2006-01-02")})
+	}
+
+	for _, list := range lists {
+		listStats := ListStats{List: list.Title}
+		var days []float64
+		for _, task := range list.Tasks {
+			if task.Parent != "" || task.Deleted {
+				continue
+			}
+			if record, ok := records[task.ID]; ok && record.Reprioritized > minReprioritized {
+				stats.Reprioritized = append(stats.Reprioritized, ReprioritizedTask{List: list.Title, Title: task.Title, Times: record.Reprioritized})
+			}
+			if task.Status != "completed" {
+				listStats.Open++
+				continue
+			}
+			listStats.Completed++
+
+			if task.Completed == "" {
+				continue
+			}
+			completed, err := time.Parse(time.RFC3339, task.Completed)
+			if err != nil {
+				continue
+			}
+			completed = completed.In(clock.Location())
+			for i := len(starts) - 1; i >= 0; i-- {
+				if !completed.Before(starts[i]) {
+					if completed.Before(starts[i].AddDate(0, 0, 7)) {
+						stats.Weeks[i].Completed++
+					}
+					break
+				}
+			}
+			if record, ok := records[task.ID]; ok && !record.FirstSeen.IsZero() && completed.After(record.FirstSeen) {
+				days = append(days, completed.Sub(record.FirstSeen).Hours()/24)
+			}
+		}
+		listStats.Measured = len(days)
+		if len(days) > 0 {
+			median := math.Round(medianOf(days)*10) / 10
+			listStats.MedianDays = &median
+		}
+		stats.Lists = append(stats.Lists, listStats)
+	}
+
+	sort.SliceStable(stats.Reprioritized, func(i, j int) bool {
+		return stats.Reprioritized[i].Times > stats.Reprioritized[j].Times
+	})
+	return stats
+}
+
+// medianOf returns the median of values, which it sorts
+func medianOf(values []float64) float64 {
+	sort.Float64s(values)
+	mid := len(values) / 2
+	if len(values)%2 == 0 {
+		return (values[mid-1] + values[mid]) / 2
+	}
+	return values[mid]
+}
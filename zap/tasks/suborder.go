@@ -0,0 +1,121 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+
+	"zap/gemini"
+	"zap/todo"
+)
+
+// SubtaskOrder is how the prioritizer orders subtasks beneath their parents
+type SubtaskOrder string
+
+const (
+	// SubtaskOrderOff leaves subtasks in the order they were written
+	SubtaskOrderOff SubtaskOrder = "off"
+	// SubtaskOrderHeuristic ranks each parent's subtasks with HeuristicPriorities
+	SubtaskOrderHeuristic SubtaskOrder = "heuristic"
+	// SubtaskOrderGemini asks the model to rank each parent's subtasks,
+	// falling back to the heuristic
+	SubtaskOrderGemini SubtaskOrder = "gemini"
+)
+
+// ParseSubtaskOrder validates a subtask order name
+func ParseSubtaskOrder(name string) (SubtaskOrder, error) {
+	switch o := SubtaskOrder(name); o {
+	case SubtaskOrderOff, SubtaskOrderHeuristic, SubtaskOrderGemini:
+		return o, nil
+	}
+	return "", fmt.Errorf("unknown subtask order %q (want %s, %s or %s)", name, SubtaskOrderOff, SubtaskOrderHeuristic, SubtaskOrderGemini)
+}
+
+// SetSubtaskOrder makes the prioritizer also order the open subtasks
+// beneath each top-level task
+func (p *Prioritizer) SetSubtaskOrder(order SubtaskOrder) {
+	p.subtaskOrder = order
+}
+
+// subtaskMutations plans the moves that order each parent's open subtasks.
+// Parents with fewer than two open subtasks are left alone. Ties keep the
+// current order, since subtasks are often steps written in sequence.
+func (p *Prioritizer) subtaskMutations(ctx context.Context, taskListID, listTitle string, tree *TaskTree) []Mutation {
+	if p.subtaskOrder == "" || p.subtaskOrder == SubtaskOrderOff {
+		return nil
+	}
+
+	var mutations []Mutation
+	for _, root := range tree.Roots {
+		parent := root.Task
+		if parent.Parent != "" || p.filter.Excludes(parent) {
+			continue
+		}
+		var open []*todo.Task
+		for _, child := range tree.Children(parent.ID) {
+			if child.Status != "completed" {
+				open = append(open, child)
+			}
+		}
+		// Excluded subtasks hold their positions like pinned ones
+		excluded := p.filter.Excluded(open)
+		rankable := withoutExcluded(open, excluded)
+		if len(rankable) < 2 {
+			continue
+		}
+		held := heldIDs(p.pinned, excluded)
+
+		priorities := p.subtaskPriorities(ctx, parent, rankable, listTitle)
+		if p.ranked == nil {
+			p.ranked = make(map[string][]gemini.TaskPriority)
+		}
+		p.ranked[parent.ID] = append([]gemini.TaskPriority(nil), priorities...)
+		sortKeepingTies(priorities, rankable)
+
+		order := make([]string, len(priorities))
+		for i, priority := range priorities {
+			order[i] = priority.TaskID
+		}
+		order = applyPins(open, order, held)
+		mutations = append(mutations, OrderMutations(taskListID, parent.ID, open, order)...)
+	}
+	return mutations
+}
+
+// subtaskPriorities ranks one parent's subtasks, reusing replayed
+// priorities when there are any
+func (p *Prioritizer) subtaskPriorities(ctx context.Context, parent *todo.Task, subtasks []*todo.Task, listTitle string) []gemini.TaskPriority {
+	if replayed, ok := replayPriorities(p.replay[parent.ID], subtasks); ok {
+		return replayed
+	}
+	signals := gemini.RankSignals{Clock: p.clock}
+	if p.subtaskOrder != SubtaskOrderGemini || p.gemini == nil {
+		return HeuristicPriorities(subtasks, signals)
+	}
+	priorities, err := p.gemini.OrderSubtasks(ctx, parent, subtasks, signals)
+	if err != nil {
+		log.Printf("Error ordering subtasks of '%s' in list %s, using heuristic priorities: %v", parent.Title, listTitle, err)
+		return HeuristicPriorities(subtasks, signals)
+	}
+	return priorities
+}
+
+// sortKeepingTies sorts priorities from highest to lowest, keeping tasks
+// with equal priorities in their current order
+func sortKeepingTies(priorities []gemini.TaskPriority, current []*todo.Task) {
+	index := make(map[string]int, len(current))
+	for i, task := range current {
+		index[task.ID] = i
+	}
+	sort.SliceStable(priorities, func(i, j int) bool {
+		a, b := priorities[i], priorities[j]
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		return index[a.TaskID] < index[b.TaskID]
+	})
+	for i := range priorities {
+		priorities[i].NewPosition = fmt.Sprintf("%05d", i+1)
+	}
+}
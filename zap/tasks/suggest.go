@@ -0,0 +1,159 @@
+package tasks
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"zap/gemini"
+	"zap/notes"
+	"zap/todo"
+)
+
+// Annotation is how suggest-only mode surfaces priorities without moving tasks
+type Annotation string
+
+const (
+	// AnnotateReport only prints the suggested order
+	AnnotateReport Annotation = "report"
+	// AnnotateTitle prefixes titles with the suggested rank, e.g. "[zap:#2] "
+	AnnotateTitle Annotation = "title"
+	// AnnotateNotes writes the rank and reason to a line in the notes
+	AnnotateNotes Annotation = "notes"
+)
+
+// ParseAnnotation validates an annotation name
+func ParseAnnotation(name string) (Annotation, error) {
+	switch a := Annotation(name); a {
+	case AnnotateReport, AnnotateTitle, AnnotateNotes:
+		return a, nil
+	}
+	return "", fmt.Errorf("unknown annotation %q (want %s, %s or %s)", name, AnnotateReport, AnnotateTitle, AnnotateNotes)
+}
+
+// rankPrefixPattern matches the rank prefix AnnotateTitle writes in any
+// namespace, or without one as earlier versions wrote it. Other tools'
+// markers may have been put in front of it.
+var rankPrefixPattern = regexp.MustCompile(`\[(?:[a-z0-9][a-z0-9_-]*:)?#\d+\]\s*`)
+
+// rankPrefix matches the rank prefix AnnotateTitle writes in ns, wherever
+// it ended up in the title. The default namespace also owns the [#2]
+// earlier versions wrote.
+func rankPrefix(ns notes.Namespace) *regexp.Regexp {
+	optional := ""
+	if ns.String() == notes.DefaultNamespace.String() {
+		optional = "?"
+	}
+	return regexp.MustCompile(`\[(?:` + regexp.QuoteMeta(ns.String()) + `:)` + optional + `#\d+\]\s*`)
+}
+
+// notesMarker names the line written by AnnotateNotes, e.g.
+// "[zap:priority] #2 (87) ..."
+const notesMarker = "priority"
+
+// legacyNotesPrefix started the line AnnotateNotes wrote before namespaces
+const legacyNotesPrefix = "zap priority:"
+
+// annotationMutations plans the updates that record the suggested ranks.
+// Tasks whose annotation is already current are skipped.
+func annotationMutations(taskListID string, tasks []*todo.Task, priorities []gemini.TaskPriority, style Annotation, ns notes.Namespace) []Mutation {
+	prefix := rankPrefix(ns)
+	byID := make(map[string]*todo.Task, len(tasks))
+	for _, task := range tasks {
+		byID[task.ID] = task
+	}
+
+	var mutations []Mutation
+	for i, priority := range priorities {
+		task, ok := byID[priority.TaskID]
+		if !ok {
+			continue
+		}
+		updated := *task
+		switch style {
+		case AnnotateTitle:
+			updated.Title = fmt.Sprintf("%s %s", ns.Marker(fmt.Sprintf("#%d", i+1)), prefix.ReplaceAllString(task.Title, ""))
+		case AnnotateNotes:
+			updated.Notes = setNotesLine(task.Notes, fmt.Sprintf("%s #%d (%.0f) %s", ns.Marker(notesMarker), i+1, priority.Priority, priority.Explanation), ns)
+		default:
+			continue
+		}
+		if updated.Title == task.Title && updated.Notes == task.Notes {
+			continue
+		}
+		mutations = append(mutations, Mutation{
+			Kind:       MutationUpdate,
+			TaskListID: taskListID,
+			Task:       &updated,
+			Before:     task,
+			Summary:    fmt.Sprintf("annotate '%s' with suggested rank %d", task.Title, i+1),
+		})
+	}
+	return mutations
+}
+
+// setNotesLine replaces the priority line of the namespace in text, or
+// appends it
+func setNotesLine(text, line string, ns notes.Namespace) string {
+	lines := strings.Split(text, "\n")
+	for i, l := range lines {
+		legacy := ns.String() == notes.DefaultNamespace.String() && strings.HasPrefix(l, legacyNotesPrefix)
+		if strings.HasPrefix(l, ns.Marker(notesMarker)) || legacy {
+			lines[i] = line
+			return strings.Join(lines, "\n")
+		}
+	}
+	if text == "" {
+		return line
+	}
+	return strings.TrimRight(text, "\n") + "\n" + line
+}
+
+// writeReport prints the suggested order next to the current one
+func writeReport(out io.Writer, listTitle string, rows []ReportRow) {
+	fmt.Fprintf(out, "Suggested order for %s:\n", listTitle)
+	for _, row := range rows {
+		fmt.Fprintf(out, "  %2d. (now %2d, %3.0f) %s", row.NewPosition, row.OldPosition, row.Priority, row.Title)
+		if row.Explanation != "" {
+			fmt.Fprintf(out, " - %s", row.Explanation)
+		}
+		fmt.Fprintln(out)
+	}
+}
+
+// applyUpdates returns tasks with the planned updates applied
+func applyUpdates(tasks []*todo.Task, updates []Mutation) []*todo.Task {
+	updated := make(map[string]*todo.Task, len(updates))
+	for _, m := range updates {
+		updated[m.Task.ID] = m.Task
+	}
+	out := make([]*todo.Task, len(tasks))
+	for i, task := range tasks {
+		if u, ok := updated[task.ID]; ok {
+			task = u
+		}
+		out[i] = task
+	}
+	return out
+}
+
+// mergeUpdates combines two sets of updates, where later was planned on top
+// of earlier, into one update per task that keeps the original Before
+func mergeUpdates(earlier, later []Mutation) []Mutation {
+	index := make(map[string]int, len(earlier))
+	merged := append([]Mutation(nil), earlier...)
+	for i, m := range merged {
+		index[m.Task.ID] = i
+	}
+	for _, m := range later {
+		if i, ok := index[m.Task.ID]; ok {
+			m.Before = merged[i].Before
+			m.Summary = merged[i].Summary + " and " + m.Summary
+			merged[i] = m
+			continue
+		}
+		merged = append(merged, m)
+	}
+	return merged
+}
@@ -2,73 +2,317 @@ package tasks
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
 
+	"zap/auth"
+	"zap/backend"
+	"zap/store"
+	"zap/todo"
+	"zap/todo/googletasks"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/api/googleapi"
 	tasksapi "google.golang.org/api/tasks/v1"
 )
 
+// ErrReadOnly is returned when a mutating call is made on a read-only service
+var ErrReadOnly = errors.New("tasks service is read-only")
+
 // Service handles Google Tasks operations
 type Service struct {
-	service *tasksapi.Service
+	service  *tasksapi.Service
+	readOnly bool
+	// provider is the backend served as service, nil for Google Tasks
+	provider backend.Provider
+
+	listsMu sync.Mutex
+	lists   []*todo.TaskList
+	// cache keeps lists and tasks between runs, nil unless WithCache
+	cache *store.Store
+
+	batchConcurrency int
+	batchLimiter     *rate.Limiter
+}
+
+// ServiceOption configures optional Service behaviour
+type ServiceOption func(*Service)
+
+// WithReadOnly makes every mutating method fail with ErrReadOnly without
+// calling the API
+func WithReadOnly() ServiceOption {
+	return func(s *Service) {
+		s.readOnly = true
+	}
+}
+
+// WithBackend tells the service that it talks to provider, served as the
+// Tasks API, so rankings can be written the way its lists record them
+func WithBackend(provider backend.Provider) ServiceOption {
+	return func(s *Service) {
+		s.provider = provider
+	}
 }
 
 // NewService creates a new Tasks service with the provided service client
-func NewService(ctx context.Context, service *tasksapi.Service) (*Service, error) {
+func NewService(ctx context.Context, service *tasksapi.Service, opts ...ServiceOption) (*Service, error) {
 	if service == nil {
 		return nil, fmt.Errorf("service cannot be nil")
 	}
-	return &Service{service: service}, nil
+	s := &Service{
+		service:          service,
+		batchConcurrency: defaultBatchConcurrency,
+		batchLimiter:     rate.NewLimiter(defaultBatchRate, defaultBatchConcurrency),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, nil
+}
+
+// ReadOnly reports whether the service refuses mutating calls
+func (s *Service) ReadOnly() bool {
+	return s.readOnly
 }
 
-// ListTaskLists retrieves all task lists for the authenticated user
-func (s *Service) ListTaskLists() ([]*tasksapi.TaskList, error) {
-	tasklists, err := s.service.Tasklists.List().Do()
+// Capabilities returns what a task list can record of a ranking
+func (s *Service) Capabilities(taskListID string) backend.Capabilities {
+	return backend.CapabilitiesOf(s.provider, taskListID)
+}
+
+// Priorities returns the priority of each task of a list that can have
+// one, or nil when its backend doesn't record priorities
+func (s *Service) Priorities(ctx context.Context, taskListID string) (map[string]string, error) {
+	ranker, ok := s.provider.(backend.Ranker)
+	if !ok {
+		return nil, nil
+	}
+	priorities, err := ranker.Priorities(ctx, taskListID)
 	if err != nil {
-		return nil, fmt.Errorf("unable to retrieve task lists: %v", err)
+		return nil, fmt.Errorf("unable to retrieve priorities: %w", err)
 	}
+	return priorities, nil
+}
 
-	return tasklists.Items, nil
+// setPriority writes a task's priority to its backend's field or label
+func (s *Service) setPriority(ctx context.Context, taskListID, taskID, priority string) error {
+	if err := s.checkWritable("unable to set priority"); err != nil {
+		return err
+	}
+	ranker, ok := s.provider.(backend.Ranker)
+	if !ok {
+		return fmt.Errorf("unable to set priority: %w", backend.ErrUnsupported)
+	}
+	if err := ranker.SetPriority(ctx, taskListID, taskID, priority); err != nil {
+		return writeError("unable to set priority", err)
+	}
+	return nil
+}
+
+// checkWritable guards every mutating method
+func (s *Service) checkWritable(op string) error {
+	if s.readOnly {
+		return fmt.Errorf("%s: %w", op, ErrReadOnly)
+	}
+	return nil
+}
+
+// writeError wraps a failed mutation, calling out missing scopes explicitly
+func writeError(op string, err error) error {
+	if auth.IsInsufficientScope(err) {
+		return fmt.Errorf("%s: %w (re-run with the %s scope or use --read-only)", op, auth.ErrInsufficientScope, auth.ScopeTasks)
+	}
+	return fmt.Errorf("%s: %w", op, err)
+}
+
+// ListTaskLists retrieves all task lists for the authenticated user. The
+// result is cached for the lifetime of the service.
+func (s *Service) ListTaskLists() ([]*todo.TaskList, error) {
+	s.listsMu.Lock()
+	defer s.listsMu.Unlock()
+
+	if s.lists != nil {
+		return s.lists, nil
+	}
+
+	lists, err := s.fetchTaskLists()
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve task lists: %w", err)
+	}
+
+	s.lists = lists
+	return s.lists, nil
+}
+
+// ResetCache drops cached task lists so the next lookup refetches them.
+// Long-running processes call it at the start of each run.
+func (s *Service) ResetCache() {
+	s.invalidateLists()
+}
+
+// invalidateLists drops the cached task lists after a list is changed
+func (s *Service) invalidateLists() {
+	s.listsMu.Lock()
+	s.lists = nil
+	s.listsMu.Unlock()
 }
 
 // GetTaskList retrieves a specific task list by ID
-func (s *Service) GetTaskList(taskListID string) (*tasksapi.TaskList, error) {
+func (s *Service) GetTaskList(taskListID string) (*todo.TaskList, error) {
 	taskList, err := s.service.Tasklists.Get(taskListID).Do()
 	if err != nil {
 		return nil, fmt.Errorf("unable to retrieve task list: %v", err)
 	}
 
-	return taskList, nil
+	return googletasks.TaskList(taskList), nil
 }
 
-// ListTasks retrieves all tasks in a specific task list
-func (s *Service) ListTasks(taskListID string) ([]*tasksapi.Task, error) {
-	tasks, err := s.service.Tasks.List(taskListID).Do()
+// ListTasks retrieves all tasks in a specific task list across all pages
+func (s *Service) ListTasks(taskListID string) ([]*todo.Task, error) {
+	if s.cache != nil {
+		all, err := s.syncTasks(context.Background(), taskListID)
+		if err != nil {
+			return nil, fmt.Errorf("unable to retrieve tasks: %w", err)
+		}
+		var tasks []*todo.Task
+		for _, task := range all {
+			if !task.Hidden {
+				tasks = append(tasks, task)
+			}
+		}
+		return tasks, nil
+	}
+
+	var tasks []*todo.Task
+	err := s.service.Tasks.List(taskListID).
+		MaxResults(100).
+		Pages(context.Background(), func(page *tasksapi.Tasks) error {
+			tasks = append(tasks, googletasks.Tasks(page.Items)...)
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve tasks: %w", err)
+	}
+	return tasks, nil
+}
+
+// ListAllTasks retrieves every task in a list across all pages, including
+// completed tasks and tasks hidden after being completed in the Tasks apps
+func (s *Service) ListAllTasks(ctx context.Context, taskListID string) ([]*todo.Task, error) {
+	if s.cache != nil {
+		all, err := s.syncTasks(ctx, taskListID)
+		if err != nil {
+			return nil, fmt.Errorf("unable to retrieve tasks: %v", err)
+		}
+		return all, nil
+	}
+
+	var all []*todo.Task
+	err := s.service.Tasks.List(taskListID).
+		ShowCompleted(true).
+		ShowHidden(true).
+		MaxResults(100).
+		Pages(ctx, func(page *tasksapi.Tasks) error {
+			all = append(all, googletasks.Tasks(page.Items)...)
+			return nil
+		})
 	if err != nil {
 		return nil, fmt.Errorf("unable to retrieve tasks: %v", err)
 	}
+	return all, nil
+}
+
+// ListCompletedSince retrieves the tasks in a list completed at or after
+// since, including those hidden in the Tasks apps
+func (s *Service) ListCompletedSince(ctx context.Context, taskListID string, since time.Time) ([]*todo.Task, error) {
+	var completed []*todo.Task
+	err := s.service.Tasks.List(taskListID).
+		ShowCompleted(true).
+		ShowHidden(true).
+		CompletedMin(since.UTC().Format(time.RFC3339)).
+		MaxResults(100).
+		Pages(ctx, func(page *tasksapi.Tasks) error {
+			for _, task := range page.Items {
+				if task.Status == "completed" {
+					completed = append(completed, googletasks.Task(task))
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve completed tasks: %v", err)
+	}
+	return completed, nil
+}
 
-	return tasks.Items, nil
+// GetTask retrieves a single task. Use IsNotFound to detect deleted tasks.
+func (s *Service) GetTask(ctx context.Context, taskListID string, taskID string) (*todo.Task, error) {
+	task, err := s.service.Tasks.Get(taskListID, taskID).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get task: %w", err)
+	}
+	return googletasks.Task(task), nil
+}
+
+// FindTask finds an open task in a list by ID or title. Titles match
+// case-insensitively; a title shared by several tasks is an error.
+func (s *Service) FindTask(taskListID string, query string) (*todo.Task, error) {
+	listTasks, err := s.ListTasks(taskListID)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []*todo.Task
+	for _, task := range listTasks {
+		if task.ID == query || task.Title == query {
+			return task, nil
+		}
+		if strings.EqualFold(task.Title, query) {
+			matches = append(matches, task)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("task '%s' not found", query)
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, fmt.Errorf("'%s' matches %d tasks; use the task ID", query, len(matches))
+	}
+}
+
+// IsNotFound reports whether err is the API's 404 for a missing task or list
+func IsNotFound(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
 }
 
 // NewTask creates a new task struct with common fields
-func NewTask(title string) *tasksapi.Task {
-	return &tasksapi.Task{
+func NewTask(title string) *todo.Task {
+	return &todo.Task{
 		Title:  title,
 		Status: "needsAction",
 	}
 }
 
-// UpdateTask updates an existing task in a specific task list
-func (s *Service) UpdateTask(taskListID string, taskID string, task *tasksapi.Task) (*tasksapi.Task, error) {
-	updatedTask, err := s.service.Tasks.Update(taskListID, taskID, task).Do()
-	if err != nil {
-		return nil, fmt.Errorf("unable to update task: %v", err)
-	}
-	return updatedTask, nil
+// UpdateTask writes a task's title, notes, due date and status; its other
+// fields are left as they are. When task carries an ETag, the update fails
+// with a ConflictError if the task was changed elsewhere since it was read.
+func (s *Service) UpdateTask(taskListID string, taskID string, task *todo.Task) (*todo.Task, error) {
+	update := *task
+	update.ID = taskID
+	return s.updateTask(context.Background(), taskListID, &update, nil)
 }
 
 // MoveTask moves a task to a new position in the list
-func (s *Service) MoveTask(taskListID string, taskID string, previousTaskID string) (*tasksapi.Task, error) {
+func (s *Service) MoveTask(taskListID string, taskID string, previousTaskID string) (*todo.Task, error) {
+	if err := s.checkWritable("unable to move task"); err != nil {
+		return nil, err
+	}
 	moveCall := s.service.Tasks.Move(taskListID, taskID)
 	if previousTaskID != "" {
 		moveCall = moveCall.Previous(previousTaskID)
@@ -76,45 +320,100 @@ func (s *Service) MoveTask(taskListID string, taskID string, previousTaskID stri
 
 	movedTask, err := moveCall.Do()
 	if err != nil {
-		return nil, fmt.Errorf("unable to move task: %v", err)
+		return nil, writeError("unable to move task", err)
 	}
-	return movedTask, nil
+	s.dropCachedTasks(taskListID)
+	return googletasks.Task(movedTask), nil
 }
 
 // MarkTaskComplete marks a task as completed
-func (s *Service) MarkTaskComplete(taskListID string, taskID string) (*tasksapi.Task, error) {
-	task, err := s.service.Tasks.Get(taskListID, taskID).Do()
-	if err != nil {
-		return nil, fmt.Errorf("unable to get task: %v", err)
+func (s *Service) MarkTaskComplete(taskListID string, taskID string) (*todo.Task, error) {
+	if err := s.checkWritable("unable to complete task"); err != nil {
+		return nil, err
 	}
-
-	task.Status = "completed"
-	return s.UpdateTask(taskListID, taskID, task)
+	return s.setStatus(taskListID, taskID, "completed")
 }
 
 // MarkTaskIncomplete marks a task as not completed
-func (s *Service) MarkTaskIncomplete(taskListID string, taskID string) (*tasksapi.Task, error) {
-	task, err := s.service.Tasks.Get(taskListID, taskID).Do()
+func (s *Service) MarkTaskIncomplete(taskListID string, taskID string) (*todo.Task, error) {
+	if err := s.checkWritable("unable to reopen task"); err != nil {
+		return nil, err
+	}
+	return s.setStatus(taskListID, taskID, "needsAction")
+}
+
+// setStatus changes only a task's status, so nothing else about it can be
+// overwritten
+func (s *Service) setStatus(taskListID, taskID, status string) (*todo.Task, error) {
+	patch := &tasksapi.Task{Status: status}
+	if status == "needsAction" {
+		patch.NullFields = []string{"Completed"}
+	}
+	updated, err := s.service.Tasks.Patch(taskListID, taskID, patch).Do()
 	if err != nil {
-		return nil, fmt.Errorf("unable to get task: %v", err)
+		return nil, writeError("unable to update task", err)
 	}
+	return googletasks.Task(updated), nil
+}
 
-	task.Status = "needsAction"
-	return s.UpdateTask(taskListID, taskID, task)
+// DeleteTask permanently deletes a task from a task list
+func (s *Service) DeleteTask(ctx context.Context, taskListID string, taskID string) error {
+	if err := s.checkWritable("unable to delete task"); err != nil {
+		return err
+	}
+	if err := s.service.Tasks.Delete(taskListID, taskID).Context(ctx).Do(); err != nil {
+		return writeError("unable to delete task", err)
+	}
+	return nil
 }
 
-// GetTaskListByTitle finds a task list by its title
-func (s *Service) GetTaskListByTitle(title string) (*tasksapi.TaskList, error) {
-	taskLists, err := s.ListTaskLists()
+// ClearCompleted hides all completed tasks in a task list
+func (s *Service) ClearCompleted(ctx context.Context, taskListID string) error {
+	if err := s.checkWritable("unable to clear completed tasks"); err != nil {
+		return err
+	}
+	if err := s.service.Tasks.Clear(taskListID).Context(ctx).Do(); err != nil {
+		return writeError("unable to clear completed tasks", err)
+	}
+	s.dropCachedTasks(taskListID)
+	return nil
+}
+
+// CreateTaskList creates a new task list with the given title
+func (s *Service) CreateTaskList(ctx context.Context, title string) (*todo.TaskList, error) {
+	if err := s.checkWritable("unable to create task list"); err != nil {
+		return nil, err
+	}
+	taskList, err := s.service.Tasklists.Insert(&tasksapi.TaskList{Title: title}).Context(ctx).Do()
 	if err != nil {
-		return nil, fmt.Errorf("unable to list task lists: %v", err)
+		return nil, writeError("unable to create task list", err)
 	}
+	s.invalidateLists()
+	return googletasks.TaskList(taskList), nil
+}
 
-	for _, list := range taskLists {
-		if list.Title == title {
-			return list, nil
-		}
+// RenameTaskList changes the title of a task list
+func (s *Service) RenameTaskList(ctx context.Context, taskListID string, title string) (*todo.TaskList, error) {
+	if err := s.checkWritable("unable to rename task list"); err != nil {
+		return nil, err
 	}
+	taskList, err := s.service.Tasklists.Patch(taskListID, &tasksapi.TaskList{Title: title}).Context(ctx).Do()
+	if err != nil {
+		return nil, writeError("unable to rename task list", err)
+	}
+	s.invalidateLists()
+	return googletasks.TaskList(taskList), nil
+}
 
-	return nil, fmt.Errorf("task list with title '%s' not found", title)
+// DeleteTaskList permanently deletes a task list and all of its tasks
+func (s *Service) DeleteTaskList(ctx context.Context, taskListID string) error {
+	if err := s.checkWritable("unable to delete task list"); err != nil {
+		return err
+	}
+	if err := s.service.Tasklists.Delete(taskListID).Context(ctx).Do(); err != nil {
+		return writeError("unable to delete task list", err)
+	}
+	s.invalidateLists()
+	s.dropCachedTasks(taskListID)
+	return nil
 }
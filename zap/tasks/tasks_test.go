@@ -0,0 +1,71 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"zap/store"
+	"zap/todo"
+	"zap/zaptest"
+)
+
+// newTestService returns a service talking to a fresh in-memory backend
+func newTestService(t *testing.T, opts ...ServiceOption) (*zaptest.Backend, *Service) {
+	t.Helper()
+	backend := zaptest.NewBackend()
+	t.Cleanup(backend.Close)
+	api, err := backend.Service(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	service, err := NewService(context.Background(), api, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return backend, service
+}
+
+func TestListTaskListsReadsEveryPage(t *testing.T) {
+	st, err := store.Open(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, opts := range map[string][]ServiceOption{"uncached": nil, "cached": {WithCache(st)}} {
+		t.Run(name, func(t *testing.T) {
+			backend, service := newTestService(t, opts...)
+			for i := 1; i <= 130; i++ {
+				backend.AddList(fmt.Sprintf("List %d", i))
+			}
+			lists, err := service.ListTaskLists()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(lists) != 130 {
+				t.Fatalf("got %d lists, want 130", len(lists))
+			}
+			if _, err := service.GetTaskListByTitle("List 125"); err != nil {
+				t.Errorf("list on the second page wasn't found: %v", err)
+			}
+		})
+	}
+}
+
+func TestListTasksReadsEveryPage(t *testing.T) {
+	backend, service := newTestService(t)
+	listID := backend.AddList("Work")
+	for i := 1; i <= 130; i++ {
+		backend.AddTask(listID, &todo.Task{Title: fmt.Sprintf("Task %d", i)})
+	}
+	tasks, err := service.ListTasks(listID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 130 {
+		t.Fatalf("got %d tasks, want 130", len(tasks))
+	}
+	if tasks[129].Title != "Task 130" {
+		t.Errorf("last task is %q, want %q", tasks[129].Title, "Task 130")
+	}
+}
@@ -0,0 +1,117 @@
+package tasks
+
+import (
+	"slices"
+	"sort"
+
+	"zap/datetime"
+	"zap/gemini"
+	"zap/todo"
+)
+
+// UserTasks is one user's tasks in one of their lists, in list order
+type UserTasks struct {
+	User  string
+	List  string
+	Tasks []*todo.Task
+}
+
+// TeamTask is one task in the combined view of a team's backlogs
+type TeamTask struct {
+	User        string  `json:"user"`
+	List        string  `json:"list"`
+	Title       string  `json:"title"`
+	Due         string  `json:"due,omitempty"`
+	Position    int     `json:"position"`
+	Priority    float64 `json:"priority"`
+	Explanation string  `json:"explanation,omitempty"`
+	// Collision is set when another user has a task with the same title
+	Collision bool `json:"collision,omitempty"`
+}
+
+// Collision is a task title that more than one user has
+type Collision struct {
+	Title string   `json:"title"`
+	Users []string `json:"users"`
+}
+
+// TeamView is every user's open top-level tasks ranked together
+type TeamView struct {
+	Tasks      []TeamTask  `json:"tasks"`
+	Collisions []Collision `json:"collisions"`
+}
+
+// TeamBacklog ranks the open top-level tasks of every user's lists in one
+// view. Tasks zap has ranked keep their latest recorded priority; the rest
+// are ranked by HeuristicPriorities. Titles are compared ignoring case,
+// punctuation and rank annotations to find work that more than one user
+// has picked up.
+func TeamBacklog(lists []UserTasks, records map[string]RankRecord, clock *datetime.Clock) TeamView {
+	view := TeamView{Collisions: []Collision{}}
+	// Titles by their compared form, in the order they were first seen,
+	// with the users who have them
+	var titles []string
+	firstTitle := make(map[string]string)
+	usersByTitle := make(map[string][]string)
+
+	for _, list := range lists {
+		tree := NewTaskTree(list.Tasks)
+		var open []*todo.Task
+		for _, task := range tree.TopLevel() {
+			if task.Parent == "" && task.Status != "completed" && !task.Deleted {
+				open = append(open, task)
+			}
+		}
+
+		heuristic := make(map[string]gemini.TaskPriority, len(open))
+		for _, priority := range HeuristicPriorities(open, gemini.RankSignals{Clock: clock}) {
+			heuristic[priority.TaskID] = priority
+		}
+		for i, task := range open {
+			priority := heuristic[task.ID]
+			if record, ok := records[task.ID]; ok {
+				priority.Priority, priority.Explanation = record.Priority, record.Explanation
+			}
+			teamTask := TeamTask{
+				User:        list.User,
+				List:        list.List,
+				Title:       task.Title,
+				Position:    i + 1,
+				Priority:    priority.Priority,
+				Explanation: priority.Explanation,
+			}
+			if day, ok := clock.ParseDue(task.Due); ok {
+				teamTask.Due = day.Format("2006-01-02")
+			}
+			view.Tasks = append(view.Tasks, teamTask)
+
+			title := teamTitle(task.Title)
+			if _, seen := firstTitle[title]; !seen {
+				titles = append(titles, title)
+				firstTitle[title] = task.Title
+			}
+			if !slices.Contains(usersByTitle[title], list.User) {
+				usersByTitle[title] = append(usersByTitle[title], list.User)
+			}
+		}
+	}
+
+	for _, title := range titles {
+		if users := usersByTitle[title]; len(users) > 1 {
+			view.Collisions = append(view.Collisions, Collision{Title: firstTitle[title], Users: users})
+		}
+	}
+	for i, task := range view.Tasks {
+		view.Tasks[i].Collision = len(usersByTitle[teamTitle(task.Title)]) > 1
+	}
+
+	sort.SliceStable(view.Tasks, func(i, j int) bool {
+		return view.Tasks[i].Priority > view.Tasks[j].Priority
+	})
+	return view
+}
+
+// teamTitle is the form of a title that is compared across users
+func teamTitle(title string) string {
+	return normalizeTitle(rankPrefixPattern.ReplaceAllString(title, ""))
+}
@@ -0,0 +1,54 @@
+package tasks
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"zap/gemini"
+	"zap/todo"
+)
+
+// rankPriorities sorts priorities from highest to lowest and renumbers
+// their positions. Equal priorities are ordered by due date (sooner first,
+// undated last), then by when zap first saw the task (older first, unknown
+// last), then by ID, so the same input always produces the same order.
+func rankPriorities(priorities []gemini.TaskPriority, tasks []*todo.Task, firstSeen map[string]time.Time) {
+	due := make(map[string]time.Time, len(tasks))
+	for _, task := range tasks {
+		if day, err := time.Parse(time.RFC3339, task.Due); err == nil {
+			due[task.ID] = day
+		}
+	}
+
+	sort.SliceStable(priorities, func(i, j int) bool {
+		a, b := priorities[i], priorities[j]
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		if less, decided := earlier(due[a.TaskID], due[b.TaskID]); decided {
+			return less
+		}
+		if less, decided := earlier(firstSeen[a.TaskID], firstSeen[b.TaskID]); decided {
+			return less
+		}
+		return a.TaskID < b.TaskID
+	})
+	for i := range priorities {
+		priorities[i].NewPosition = fmt.Sprintf("%05d", i+1)
+	}
+}
+
+// earlier compares two optional times, ordering missing ones last. decided
+// is false when they are equal.
+func earlier(a, b time.Time) (less bool, decided bool) {
+	switch {
+	case a.Equal(b):
+		return false, false
+	case a.IsZero():
+		return false, true
+	case b.IsZero():
+		return true, true
+	}
+	return a.Before(b), true
+}
@@ -0,0 +1,138 @@
+package tasks
+
+import (
+	"sort"
+
+	"zap/todo"
+)
+
+// TaskNode is a task together with its ordered children
+type TaskNode struct {
+	Task     *todo.Task
+	Parent   *TaskNode
+	Children []*TaskNode
+}
+
+// Depth returns 0 for top-level tasks, 1 for their subtasks and so on
+func (n *TaskNode) Depth() int {
+	depth := 0
+	for p := n.Parent; p != nil; p = p.Parent {
+		depth++
+	}
+	return depth
+}
+
+// Path returns the titles from the root down to this node
+func (n *TaskNode) Path() []string {
+	var path []string
+	for node := n; node != nil; node = node.Parent {
+		path = append([]string{node.Task.Title}, path...)
+	}
+	return path
+}
+
+// TaskTree is a parent/child view of a flat task slice. Siblings are ordered
+// by Position, the same order the Tasks UI shows them in.
+type TaskTree struct {
+	Roots []*TaskNode
+	nodes map[string]*TaskNode
+}
+
+// NewTaskTree builds a tree from the flat slice returned by ListTasks. Tasks
+// whose parent isn't in the slice are treated as top-level.
+func NewTaskTree(tasks []*todo.Task) *TaskTree {
+	tree := &TaskTree{nodes: make(map[string]*TaskNode, len(tasks))}
+	for _, task := range tasks {
+		tree.nodes[task.ID] = &TaskNode{Task: task}
+	}
+
+	for _, task := range tasks {
+		node := tree.nodes[task.ID]
+		parent, ok := tree.nodes[task.Parent]
+		if task.Parent == "" || !ok {
+			tree.Roots = append(tree.Roots, node)
+			continue
+		}
+		node.Parent = parent
+		parent.Children = append(parent.Children, node)
+	}
+
+	sortByPosition(tree.Roots)
+	for _, node := range tree.nodes {
+		sortByPosition(node.Children)
+	}
+	return tree
+}
+
+// sortByPosition orders siblings by their Position string, falling back to ID
+func sortByPosition(nodes []*TaskNode) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		if nodes[i].Task.Position != nodes[j].Task.Position {
+			return nodes[i].Task.Position < nodes[j].Task.Position
+		}
+		return nodes[i].Task.ID < nodes[j].Task.ID
+	})
+}
+
+// Node returns the node for a task ID
+func (t *TaskTree) Node(taskID string) (*TaskNode, bool) {
+	node, ok := t.nodes[taskID]
+	return node, ok
+}
+
+// Len returns the number of tasks in the tree
+func (t *TaskTree) Len() int {
+	return len(t.nodes)
+}
+
+// TopLevel returns the top-level tasks in position order
+func (t *TaskTree) TopLevel() []*todo.Task {
+	tasks := make([]*todo.Task, len(t.Roots))
+	for i, node := range t.Roots {
+		tasks[i] = node.Task
+	}
+	return tasks
+}
+
+// Children returns the direct subtasks of a task in position order
+func (t *TaskTree) Children(taskID string) []*todo.Task {
+	node, ok := t.nodes[taskID]
+	if !ok {
+		return nil
+	}
+	tasks := make([]*todo.Task, len(node.Children))
+	for i, child := range node.Children {
+		tasks[i] = child.Task
+	}
+	return tasks
+}
+
+// HasChildren reports whether a task has any subtasks
+func (t *TaskTree) HasChildren(taskID string) bool {
+	node, ok := t.nodes[taskID]
+	return ok && len(node.Children) > 0
+}
+
+// Walk visits every node depth-first in display order. Returning false from
+// fn skips the node's children.
+func (t *TaskTree) Walk(fn func(node *TaskNode) bool) {
+	var walk func(nodes []*TaskNode)
+	walk = func(nodes []*TaskNode) {
+		for _, node := range nodes {
+			if fn(node) {
+				walk(node.Children)
+			}
+		}
+	}
+	walk(t.Roots)
+}
+
+// Flatten returns every task depth-first in display order
+func (t *TaskTree) Flatten() []*todo.Task {
+	tasks := make([]*todo.Task, 0, len(t.nodes))
+	t.Walk(func(node *TaskNode) bool {
+		tasks = append(tasks, node.Task)
+		return true
+	})
+	return tasks
+}
@@ -0,0 +1,111 @@
+package tasks
+
+import (
+	"slices"
+	"testing"
+
+	"zap/todo"
+)
+
+// treeTasks is a list as ListTasks returns it: not in display order, with
+// an orphaned subtask whose parent was deleted
+func treeTasks() []*todo.Task {
+	return []*todo.Task{
+		{ID: "c", Title: "Chores", Position: "00000000000000000002"},
+		{ID: "w2", Title: "Send report", Parent: "w", Position: "00000000000000000001"},
+		{ID: "w", Title: "Work", Position: "00000000000000000001"},
+		{ID: "w1", Title: "Draft report", Parent: "w", Position: "00000000000000000000"},
+		{ID: "w1a", Title: "Collect numbers", Parent: "w1", Position: "00000000000000000000"},
+		{ID: "o", Title: "Orphan", Parent: "deleted", Position: "00000000000000000000"},
+		{ID: "c2", Title: "Laundry", Parent: "c", Position: "00000000000000000005"},
+		{ID: "c1", Title: "Dishes", Parent: "c", Position: "00000000000000000005"},
+	}
+}
+
+func titles(tasks []*todo.Task) []string {
+	var titles []string
+	for _, task := range tasks {
+		titles = append(titles, task.Title)
+	}
+	return titles
+}
+
+func TestTaskTreeOrdersSiblingsByPosition(t *testing.T) {
+	tree := NewTaskTree(treeTasks())
+
+	if got, want := titles(tree.TopLevel()), []string{"Orphan", "Work", "Chores"}; !slices.Equal(got, want) {
+		t.Errorf("TopLevel() = %q, want %q", got, want)
+	}
+	if got, want := titles(tree.Children("w")), []string{"Draft report", "Send report"}; !slices.Equal(got, want) {
+		t.Errorf("Children(w) = %q, want %q", got, want)
+	}
+	// Equal positions fall back to the ID
+	if got, want := titles(tree.Children("c")), []string{"Dishes", "Laundry"}; !slices.Equal(got, want) {
+		t.Errorf("Children(c) = %q, want %q", got, want)
+	}
+	if tree.Len() != 8 {
+		t.Errorf("Len() = %d, want 8", tree.Len())
+	}
+}
+
+func TestTaskTreeTreatsOrphansAsTopLevel(t *testing.T) {
+	tree := NewTaskTree(treeTasks())
+
+	node, ok := tree.Node("o")
+	if !ok {
+		t.Fatal("orphaned subtask isn't in the tree")
+	}
+	if node.Parent != nil || node.Depth() != 0 {
+		t.Errorf("orphan has parent %v and depth %d, want none and 0", node.Parent, node.Depth())
+	}
+	if tree.HasChildren("deleted") || tree.Children("deleted") != nil {
+		t.Error("the missing parent has children")
+	}
+}
+
+func TestTaskNodeDepthAndPath(t *testing.T) {
+	tree := NewTaskTree(treeTasks())
+
+	tests := []struct {
+		id    string
+		depth int
+		path  []string
+	}{
+		{"w", 0, []string{"Work"}},
+		{"w1", 1, []string{"Work", "Draft report"}},
+		{"w1a", 2, []string{"Work", "Draft report", "Collect numbers"}},
+		{"o", 0, []string{"Orphan"}},
+	}
+	for _, test := range tests {
+		node, ok := tree.Node(test.id)
+		if !ok {
+			t.Fatalf("Node(%s) not found", test.id)
+		}
+		if node.Depth() != test.depth {
+			t.Errorf("Node(%s).Depth() = %d, want %d", test.id, node.Depth(), test.depth)
+		}
+		if got := node.Path(); !slices.Equal(got, test.path) {
+			t.Errorf("Node(%s).Path() = %q, want %q", test.id, got, test.path)
+		}
+	}
+}
+
+func TestTaskTreeWalksDepthFirstInDisplayOrder(t *testing.T) {
+	tree := NewTaskTree(treeTasks())
+
+	want := []string{"Orphan", "Work", "Draft report", "Collect numbers", "Send report", "Chores", "Dishes", "Laundry"}
+	if got := titles(tree.Flatten()); !slices.Equal(got, want) {
+		t.Errorf("Flatten() = %q, want %q", got, want)
+	}
+
+	// Returning false skips a node's children but not its siblings
+	var visited []string
+	tree.Walk(func(node *TaskNode) bool {
+		visited = append(visited, node.Task.Title)
+		return node.Task.ID != "w"
+	})
+	want = []string{"Orphan", "Work", "Chores", "Dishes", "Laundry"}
+	if !slices.Equal(visited, want) {
+		t.Errorf("Walk skipping Work's subtasks visited %q, want %q", visited, want)
+	}
+}
@@ -0,0 +1,103 @@
+package tasks
+
+import (
+	"fmt"
+	"strings"
+
+	"zap/gemini"
+	"zap/todo"
+)
+
+// WIPPolicy caps how many open top-level tasks a list may hold. The
+// lowest-ranked tasks over a list's limit are moved to the Overflow list,
+// or only flagged when the prioritizer suggests without moving. Pinned
+// tasks are never demoted.
+type WIPPolicy struct {
+	// Limits holds the cap of each limited list, by title
+	Limits   map[string]int
+	Overflow string
+}
+
+// limit returns the cap of a list, matching its title without case
+func (w *WIPPolicy) limit(listTitle string) (int, bool) {
+	for title, limit := range w.Limits {
+		if strings.EqualFold(title, listTitle) {
+			return limit, true
+		}
+	}
+	return 0, false
+}
+
+// overflow returns the tasks over the list's limit, lowest-ranked first.
+// Order holds the task IDs in their ranked order.
+func (w *WIPPolicy) overflow(listTitle string, tasks []*todo.Task, order []string, pinnedIDs map[string]bool) []*todo.Task {
+	limit, ok := w.limit(listTitle)
+	if !ok || len(order) <= limit {
+		return nil
+	}
+	byID := make(map[string]*todo.Task, len(tasks))
+	for _, task := range tasks {
+		byID[task.ID] = task
+	}
+
+	var demoted []*todo.Task
+	for i := len(order) - 1; i >= 0 && len(order)-len(demoted) > limit; i-- {
+		task, ok := byID[order[i]]
+		if !ok || IsPinned(task, pinnedIDs) {
+			continue
+		}
+		demoted = append(demoted, task)
+	}
+	return demoted
+}
+
+// flagOverflow notes in the explanations of demoted tasks that they are
+// over the limit
+func (w *WIPPolicy) flagOverflow(listTitle string, priorities []gemini.TaskPriority, demoted []*todo.Task) {
+	limit, _ := w.limit(listTitle)
+	isDemoted := make(map[string]bool, len(demoted))
+	for _, task := range demoted {
+		isDemoted[task.ID] = true
+	}
+	for i := range priorities {
+		if !isDemoted[priorities[i].TaskID] {
+			continue
+		}
+		flag := fmt.Sprintf("over the WIP limit of %d, belongs in %s", limit, w.Overflow)
+		if priorities[i].Explanation != "" {
+			flag += "; " + priorities[i].Explanation
+		}
+		priorities[i].Explanation = flag
+	}
+}
+
+// demoteMutations plans the moves that take demoted tasks, with their
+// subtasks, to the top of the overflow list
+func demoteMutations(taskListID, overflowID, overflowTitle string, demoted []*todo.Task) []Mutation {
+	mutations := make([]Mutation, len(demoted))
+	for i, task := range demoted {
+		mutations[i] = Mutation{
+			Kind:        MutationMove,
+			TaskListID:  taskListID,
+			Task:        task,
+			Destination: overflowID,
+			Summary:     fmt.Sprintf("move '%s' over the WIP limit to %s", task.Title, overflowTitle),
+		}
+	}
+	return mutations
+}
+
+// withoutTasks returns order without the IDs of tasks
+func withoutTasks(order []string, tasks []*todo.Task) []string {
+	drop := make(map[string]bool, len(tasks))
+	for _, task := range tasks {
+		drop[task.ID] = true
+	}
+	var kept []string
+	for _, id := range order {
+		if !drop[id] {
+			kept = append(kept, id)
+		}
+	}
+	return kept
+}
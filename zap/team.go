@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"zap/auth"
+	"zap/config"
+	"zap/tasks"
+)
+
+const (
+	formatMarkdown = "markdown"
+	formatHTML     = "html"
+)
+
+// runTeam prints a read-only, combined ranking of several users' target
+// lists for standups, flagging tasks that more than one user has
+func runTeam(args []string) {
+	flags := flag.NewFlagSet("team", flag.ExitOnError)
+	runOpts := registerRunFlags(flags)
+	users := flags.String("users", "", "Comma-separated emails of the users to include (default: the profile's user and team)")
+	format := flags.String("format", formatMarkdown, "Output format: markdown or html")
+	outPath := flags.String("out", "-", "File to write the view to (-: stdout)")
+	flags.Parse(args)
+	if *format != formatMarkdown && *format != formatHTML {
+		log.Fatalf("unknown format %q (want %s or %s)", *format, formatMarkdown, formatHTML)
+	}
+	// The view never changes anything, and stdout is kept for it
+	*runOpts.readOnly = true
+	runOpts.out = os.Stderr
+
+	ctx := context.Background()
+	app, err := runOpts.newApp(ctx, flags)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer app.Close()
+
+	emails := app.teamEmails(*users)
+	if len(emails) == 0 {
+		log.Fatal("no users to include; pass --users or list teammates under team in the profile")
+	}
+	view, err := app.teamView(ctx, emails)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var rendered bytes.Buffer
+	title := fmt.Sprintf("Team backlog, %s", app.clock.Today().Format("Monday 2006-01-02"))
+	if *format == formatHTML {
+		err = writeTeamHTML(&rendered, title, view)
+	} else {
+		writeTeamMarkdown(&rendered, title, view)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *outPath == "-" {
+		os.Stdout.Write(rendered.Bytes())
+		return
+	}
+	if err := os.WriteFile(*outPath, rendered.Bytes(), 0600); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s\n", *outPath)
+}
+
+// teamEmails parses --users, defaulting to the profile's user followed by
+// its teammates
+func (a *app) teamEmails(users string) []string {
+	if users != "" {
+		var emails []string
+		for _, email := range strings.Split(users, ",") {
+			if email = strings.TrimSpace(email); email != "" {
+				emails = append(emails, email)
+			}
+		}
+		return emails
+	}
+	var emails []string
+	if a.userEmail != "" {
+		emails = append(emails, a.userEmail)
+	}
+	for _, teammate := range a.profile.Team {
+		emails = append(emails, teammate.Email)
+	}
+	return emails
+}
+
+// teamView reads every user's target lists with the read-only scope and
+// ranks them together. Users are shown by their teammate name when the
+// profile has one.
+func (a *app) teamView(ctx context.Context, emails []string) (tasks.TeamView, error) {
+	if a.profile.Auth != config.AuthServiceAccount {
+		return tasks.TeamView{}, fmt.Errorf("the team view needs service-account auth, to read each user's tasks")
+	}
+	names := make(map[string]string, len(a.profile.Team))
+	for _, teammate := range a.profile.Team {
+		names[teammate.Email] = teammate.Name
+	}
+
+	var lists []tasks.UserTasks
+	for _, email := range emails {
+		client, err := createTasksClient(ctx, a.profile, []string{auth.ScopeTasksReadonly}, email, true)
+		if err != nil {
+			return tasks.TeamView{}, fmt.Errorf("unable to read %s's tasks: %w", email, err)
+		}
+		service, err := tasks.NewService(ctx, client, tasks.WithReadOnly())
+		if err != nil {
+			return tasks.TeamView{}, err
+		}
+		user := email
+		if name, ok := names[email]; ok {
+			user = name
+		}
+		for _, listTitle := range a.profile.TargetLists {
+			taskList, err := service.GetTaskListByTitle(listTitle)
+			if err != nil {
+				// Not everyone keeps the same lists
+				log.Printf("Skipping %s for %s: %v", listTitle, email, err)
+				continue
+			}
+			listTasks, err := service.ListAllTasks(ctx, taskList.ID)
+			if err != nil {
+				return tasks.TeamView{}, fmt.Errorf("error fetching tasks for list %s of %s: %w", listTitle, email, err)
+			}
+			lists = append(lists, tasks.UserTasks{User: user, List: taskList.Title, Tasks: listTasks})
+		}
+	}
+
+	records, err := tasks.NewHistory(a.store, true).Records()
+	if err != nil {
+		return tasks.TeamView{}, err
+	}
+	return tasks.TeamBacklog(lists, records, a.clock), nil
+}
+
+// writeTeamMarkdown renders the view as a Markdown table followed by the
+// collisions
+func writeTeamMarkdown(w io.Writer, title string, view tasks.TeamView) {
+	cell := strings.NewReplacer("|", `\|`, "\n", " ").Replace
+	fmt.Fprintf(w, "# %s\n\n", title)
+	fmt.Fprintln(w, "| # | Priority | Owner | List | Task | Due |")
+	fmt.Fprintln(w, "|---|---------:|-------|------|------|-----|")
+	for i, task := range view.Tasks {
+		name := cell(task.Title)
+		if task.Collision {
+			name = "⚠️ " + name
+		}
+		fmt.Fprintf(w, "| %d | %.0f | %s | %s | %s | %s |\n", i+1, task.Priority, cell(task.User), cell(task.List), name, task.Due)
+	}
+	if len(view.Collisions) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\n## Collisions\n\n")
+	for _, collision := range view.Collisions {
+		fmt.Fprintf(w, "- **%s**: %s\n", cell(collision.Title), strings.Join(collision.Users, ", "))
+	}
+}
+
+// teamHTML is the page writeTeamHTML renders
+var teamHTML = template.Must(template.New("team").Funcs(template.FuncMap{
+	"inc":  func(i int) int { return i + 1 },
+	"join": strings.Join,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border-bottom: 1px solid #ddd; padding: 0.3em 0.8em; text-align: left; }
+td.priority { text-align: right; }
+tr.collision { background: #fff3cd; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<table>
+<tr><th>#</th><th>Priority</th><th>Owner</th><th>List</th><th>Task</th><th>Due</th></tr>
+{{- range $i, $task := .View.Tasks}}
+<tr{{if $task.Collision}} class="collision"{{end}}><td>{{inc $i}}</td><td class="priority">{{printf "%.0f" $task.Priority}}</td><td>{{$task.User}}</td><td>{{$task.List}}</td><td title="{{$task.Explanation}}">{{$task.Title}}</td><td>{{$task.Due}}</td></tr>
+{{- end}}
+</table>
+{{- if .View.Collisions}}
+<h2>Collisions</h2>
+<ul>
+{{- range .View.Collisions}}
+<li><strong>{{.Title}}</strong>: {{join .Users ", "}}</li>
+{{- end}}
+</ul>
+{{- end}}
+</body>
+</html>
+`))
+
+// writeTeamHTML renders the view as a standalone page; rows of colliding
+// tasks are highlighted
+func writeTeamHTML(w io.Writer, title string, view tasks.TeamView) error {
+	return teamHTML.Execute(w, struct {
+		Title string
+		View  tasks.TeamView
+	}{title, view})
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"zap/tasks"
+	"zap/templates"
+	"zap/todo"
+)
+
+// runTemplate lists templates or instantiates one into a task list
+func runTemplate(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: zap template list | zap template apply <name> --list <list> [--var name=value]")
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "list":
+		runTemplateList(args[1:])
+	case "apply":
+		runTemplateApply(args[1:])
+	default:
+		log.Fatalf("unknown template command %q (want list or apply)", args[0])
+	}
+}
+
+// runTemplateList prints the built-in and configured templates
+func runTemplateList(args []string) {
+	flags := flag.NewFlagSet("template list", flag.ExitOnError)
+	configPath := flags.String("config", "", configFlagUsage)
+	profileName := flags.String("profile", "", "Config profile to use")
+	flags.Parse(args)
+
+	profile := loadProfile(flags, *configPath, *profileName)
+	library, err := templates.Load(profile.TemplateDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, t := range library.List() {
+		fmt.Printf("%s - %s\n", t.Name, t.Description)
+		if len(t.Variables) > 0 {
+			fmt.Printf("  variables: %s\n", strings.Join(t.Variables, ", "))
+		}
+		fmt.Printf("  source: %s\n", t.Source)
+	}
+}
+
+// runTemplateApply creates a template's tasks and subtasks in a list
+func runTemplateApply(args []string) {
+	flags := flag.NewFlagSet("template apply", flag.ExitOnError)
+	runOpts := registerRunFlags(flags)
+	listTitle := flags.String("list", "", "Task list to create the tasks in")
+	parentTitle := flags.String("parent", "", "Existing task to create the template's tasks under")
+	tailor := flags.Bool("tailor", false, "Ask Gemini to adapt the template to the --parent task")
+	vars := make(varFlag)
+	flags.Var(vars, "var", "Template variable as name=value (repeatable)")
+
+	positional := parseInterspersed(flags, args)
+	if len(positional) != 1 {
+		log.Fatal("usage: zap template apply <name> --list <list> [--var name=value] [--parent <task>] [--tailor]")
+	}
+	if *listTitle == "" {
+		log.Fatal("--list is required")
+	}
+	if *tailor && *parentTitle == "" {
+		log.Fatal("--tailor needs --parent")
+	}
+
+	ctx := context.Background()
+	app, err := runOpts.newApp(ctx, flags)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer app.Close()
+
+	library, err := templates.Load(app.profile.TemplateDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	template, err := library.Get(positional[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+	planned, err := template.Instantiate(vars, time.Now())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := app.applyTemplate(ctx, template.Name, planned, *listTitle, *parentTitle, *tailor); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// applyTemplate creates the planned tasks. Without a parent, the template's
+// tasks go to the top of the list in order with their subtasks under them.
+// With a parent, they become its subtasks and any nested subtasks are listed
+// in their notes, since Google Tasks only supports one level.
+func (a *app) applyTemplate(ctx context.Context, name string, planned []templates.TaskTemplate, listTitle, parentTitle string, tailor bool) error {
+	taskList, err := a.service.GetTaskListByTitle(listTitle)
+	if err != nil {
+		return err
+	}
+	listLock, err := a.lockList(ctx, taskList)
+	if err != nil {
+		return err
+	}
+	defer listLock.Release()
+
+	if parentTitle == "" {
+		return a.insertTemplateTasks(ctx, taskList.ID, planned)
+	}
+
+	parent, err := a.service.FindTask(taskList.ID, parentTitle)
+	if err != nil {
+		return fmt.Errorf("%v in list '%s'", err, listTitle)
+	}
+
+	if tailor {
+		if err := a.requireGemini(); err != nil {
+			return err
+		}
+		tailored, err := a.gemini.TailorTemplate(ctx, parent, templates.ToGemini(planned))
+		if err != nil {
+			return fmt.Errorf("unable to tailor template '%s': %v", name, err)
+		}
+		planned = templates.FromGemini(tailored, planned)
+	}
+
+	var mutations []tasks.Mutation
+	for _, item := range planned {
+		task := templateTask(item)
+		if task.Due == "" {
+			task.Due = parent.Due
+		}
+		for _, subtask := range item.Subtasks {
+			task.Notes = strings.TrimSpace(task.Notes + "\n- [ ] " + subtask.Title)
+		}
+		mutations = append(mutations, tasks.Mutation{
+			Kind:       tasks.MutationInsert,
+			TaskListID: taskList.ID,
+			Task:       task,
+			Parent:     parent.ID,
+			Summary:    fmt.Sprintf("create subtask '%s' under '%s'", task.Title, parent.Title),
+		})
+	}
+	if _, err := a.orchestrator.Apply(ctx, mutations); err != nil {
+		return err
+	}
+	fmt.Printf("Applied template '%s' under '%s'\n", name, parent.Title)
+	return nil
+}
+
+// insertTemplateTasks creates the top-level tasks first, then their subtasks
+// under the created tasks
+func (a *app) insertTemplateTasks(ctx context.Context, taskListID string, planned []templates.TaskTemplate) error {
+	var mutations []tasks.Mutation
+	for _, item := range planned {
+		task := templateTask(item)
+		mutations = append(mutations, tasks.Mutation{
+			Kind:       tasks.MutationInsert,
+			TaskListID: taskListID,
+			Task:       task,
+			Summary:    fmt.Sprintf("create task '%s'", task.Title),
+		})
+	}
+	results, err := a.orchestrator.Apply(ctx, mutations)
+	if err != nil {
+		return err
+	}
+
+	var subtaskMutations []tasks.Mutation
+	for i, item := range planned {
+		parent := results[i].Task
+		for _, subtask := range item.Subtasks {
+			task := templateTask(subtask)
+			if task.Due == "" {
+				task.Due = parent.Due
+			}
+			subtaskMutations = append(subtaskMutations, tasks.Mutation{
+				Kind:       tasks.MutationInsert,
+				TaskListID: taskListID,
+				Task:       task,
+				Parent:     parent.ID,
+				Summary:    fmt.Sprintf("create subtask '%s' under '%s'", task.Title, parent.Title),
+			})
+		}
+	}
+	if len(subtaskMutations) > 0 {
+		if _, err := a.orchestrator.Apply(ctx, subtaskMutations); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Created %d tasks and %d subtasks\n", len(mutations), len(subtaskMutations))
+	return nil
+}
+
+// templateTask converts an instantiated template task to an API task
+func templateTask(planned templates.TaskTemplate) *todo.Task {
+	return &todo.Task{
+		Title:  planned.Title,
+		Notes:  planned.Notes,
+		Due:    planned.Due,
+		Status: "needsAction",
+	}
+}
@@ -0,0 +1,274 @@
+package templates
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"zap/gemini"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed builtin/*.yaml
+var builtin embed.FS
+
+// variablePattern matches {{name}} placeholders
+var variablePattern = regexp.MustCompile(`\{\{\s*([a-zA-Z0-9_]+)\s*\}\}`)
+
+// relativeDuePattern matches due offsets such as "+3d" or "+2w"
+var relativeDuePattern = regexp.MustCompile(`^\+(\d+)([dw])$`)
+
+// Template is a reusable set of tasks and subtasks
+type Template struct {
+	Name        string         `yaml:"name"`
+	Description string         `yaml:"description"`
+	Variables   []string       `yaml:"variables"`
+	Tasks       []TaskTemplate `yaml:"tasks"`
+
+	// Source is the file the template was loaded from
+	Source string `yaml:"-"`
+}
+
+// TaskTemplate is one task in a template. Due is either a date
+// (2006-01-02) or an offset from today ("+3d", "+1w").
+type TaskTemplate struct {
+	Title    string         `yaml:"title"`
+	Notes    string         `yaml:"notes"`
+	Due      string         `yaml:"due"`
+	Subtasks []TaskTemplate `yaml:"subtasks"`
+}
+
+// Library holds the built-in templates and those found in a directory.
+// Templates in the directory replace built-ins with the same name.
+type Library struct {
+	templates map[string]*Template
+}
+
+// Load reads the built-in templates and every *.yaml/*.yml file in dir. A
+// missing dir is not an error.
+func Load(dir string) (*Library, error) {
+	lib := &Library{templates: make(map[string]*Template)}
+
+	if err := lib.loadFS(builtin, "builtin", "builtin:"); err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		if _, err := os.Stat(dir); err == nil {
+			if err := lib.loadFS(os.DirFS(dir), ".", dir+string(filepath.Separator)); err != nil {
+				return nil, err
+			}
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("unable to read template directory: %v", err)
+		}
+	}
+	return lib, nil
+}
+
+func (l *Library) loadFS(fsys fs.FS, dir, sourcePrefix string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return fmt.Errorf("unable to read templates: %v", err)
+	}
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, filepath.ToSlash(filepath.Join(dir, entry.Name())))
+		if err != nil {
+			return fmt.Errorf("unable to read template %s: %v", entry.Name(), err)
+		}
+
+		var t Template
+		if err := yaml.Unmarshal(data, &t); err != nil {
+			return fmt.Errorf("unable to parse template %s: %v", entry.Name(), err)
+		}
+		t.Source = sourcePrefix + entry.Name()
+		if err := t.validate(); err != nil {
+			return fmt.Errorf("template %s: %v", t.Source, err)
+		}
+		l.templates[strings.ToLower(t.Name)] = &t
+	}
+	return nil
+}
+
+// validate checks names and the one level of nesting Google Tasks supports
+func (t *Template) validate() error {
+	if t.Name == "" {
+		return fmt.Errorf("missing name")
+	}
+	if len(t.Tasks) == 0 {
+		return fmt.Errorf("no tasks")
+	}
+	for _, task := range t.Tasks {
+		if task.Title == "" {
+			return fmt.Errorf("task without a title")
+		}
+		for _, subtask := range task.Subtasks {
+			if subtask.Title == "" {
+				return fmt.Errorf("subtask of '%s' without a title", task.Title)
+			}
+			if len(subtask.Subtasks) > 0 {
+				return fmt.Errorf("subtask '%s' has subtasks; Google Tasks supports one level", subtask.Title)
+			}
+		}
+	}
+	return nil
+}
+
+// Get finds a template by name, ignoring case
+func (l *Library) Get(name string) (*Template, error) {
+	t, ok := l.templates[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("template '%s' not found; available: %s", name, strings.Join(l.Names(), ", "))
+	}
+	return t, nil
+}
+
+// List returns all templates sorted by name
+func (l *Library) List() []*Template {
+	list := make([]*Template, 0, len(l.templates))
+	for _, t := range l.templates {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// Names returns the template names sorted alphabetically
+func (l *Library) Names() []string {
+	var names []string
+	for _, t := range l.List() {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+// Instantiate substitutes variables and resolves due dates. The variable
+// "date" defaults to today. Every variable the template declares or uses
+// must have a value.
+func (t *Template) Instantiate(vars map[string]string, today time.Time) ([]TaskTemplate, error) {
+	values := map[string]string{"date": today.Format("2006-01-02")}
+	for k, v := range vars {
+		values[k] = v
+	}
+
+	var missing []string
+	seen := make(map[string]bool)
+	check := func(name string) {
+		if _, ok := values[name]; !ok && !seen[name] {
+			seen[name] = true
+			missing = append(missing, name)
+		}
+	}
+	for _, name := range t.Variables {
+		check(name)
+	}
+
+	var expand func(tasks []TaskTemplate) ([]TaskTemplate, error)
+	expand = func(tasks []TaskTemplate) ([]TaskTemplate, error) {
+		out := make([]TaskTemplate, len(tasks))
+		for i, task := range tasks {
+			for _, text := range []string{task.Title, task.Notes} {
+				for _, match := range variablePattern.FindAllStringSubmatch(text, -1) {
+					check(match[1])
+				}
+			}
+			due, err := resolveDue(task.Due, today)
+			if err != nil {
+				return nil, fmt.Errorf("task '%s': %v", task.Title, err)
+			}
+			subtasks, err := expand(task.Subtasks)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = TaskTemplate{
+				Title:    substitute(task.Title, values),
+				Notes:    substitute(task.Notes, values),
+				Due:      due,
+				Subtasks: subtasks,
+			}
+		}
+		return out, nil
+	}
+
+	tasks, err := expand(t.Tasks)
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("template '%s' needs values for: %s (use --var name=value)", t.Name, strings.Join(missing, ", "))
+	}
+	return tasks, nil
+}
+
+// substitute replaces {{name}} placeholders with their values
+func substitute(text string, values map[string]string) string {
+	return variablePattern.ReplaceAllStringFunc(text, func(match string) string {
+		name := variablePattern.FindStringSubmatch(match)[1]
+		if value, ok := values[name]; ok {
+			return value
+		}
+		return match
+	})
+}
+
+// resolveDue turns a template due value into an RFC 3339 date for the API
+func resolveDue(due string, today time.Time) (string, error) {
+	if due == "" {
+		return "", nil
+	}
+	if match := relativeDuePattern.FindStringSubmatch(due); match != nil {
+		n, _ := strconv.Atoi(match[1])
+		if match[2] == "w" {
+			n *= 7
+		}
+		return today.AddDate(0, 0, n).Format("2006-01-02") + "T00:00:00.000Z", nil
+	}
+	date, err := time.Parse("2006-01-02", due)
+	if err != nil {
+		return "", fmt.Errorf("invalid due %q: use YYYY-MM-DD or +Nd/+Nw", due)
+	}
+	return date.Format("2006-01-02") + "T00:00:00.000Z", nil
+}
+
+// ToGemini converts instantiated tasks for TailorTemplate
+func ToGemini(tasks []TaskTemplate) []gemini.TemplateTask {
+	out := make([]gemini.TemplateTask, len(tasks))
+	for i, task := range tasks {
+		out[i] = gemini.TemplateTask{Title: task.Title, Notes: task.Notes, Subtasks: ToGemini(task.Subtasks)}
+	}
+	return out
+}
+
+// FromGemini converts tailored tasks back, keeping due dates of tasks whose
+// position in the original is unchanged
+func FromGemini(tailored []gemini.TemplateTask, original []TaskTemplate) []TaskTemplate {
+	out := make([]TaskTemplate, len(tailored))
+	for i, task := range tailored {
+		var due string
+		var originalSubtasks []TaskTemplate
+		if i < len(original) {
+			due = original[i].Due
+			originalSubtasks = original[i].Subtasks
+		}
+		out[i] = TaskTemplate{
+			Title:    task.Title,
+			Notes:    task.Notes,
+			Due:      due,
+			Subtasks: FromGemini(task.Subtasks, originalSubtasks),
+		}
+	}
+	return out
+}
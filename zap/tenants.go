@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"zap/config"
+	"zap/jobs"
+)
+
+// tenant is a team zap serve serves: a Workspace domain whose service
+// account acts for its users, or, without tenants in the config, the
+// profile's user alone. Each user requests act for gets a session of their
+// own, so caches, state and history are never shared between users, let
+// alone between tenants.
+type tenant struct {
+	name string
+	// domain is empty for the tenant of a server without tenants, whose
+	// requests all act for its one user
+	domain string
+	tokens []config.APIToken
+	// user is whom requests act for unless they name someone
+	user string
+
+	// profile, credentials and stateDir set up the apps of new sessions
+	profile     *config.Profile
+	credentials string
+	stateDir    string
+	opts        *runFlags
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+// session is the app acting for one user of a tenant. Requests that use it
+// take turns, since runs and the state file aren't safe to share.
+type session struct {
+	tenant string
+	user   string
+
+	mu  sync.Mutex
+	app *app
+
+	// running is set while a run started through the API or the dashboard
+	// is in progress
+	running sync.Mutex
+	// jobs queues the runs started through the server, whose worker runs
+	// them one at a time
+	jobs *jobs.Queue
+	// status follows whether runs work, for a server without tenants; it is
+	// nil for tenants' sessions
+	status *health
+
+	// reports holds the runs started through the server since it started,
+	// newest first
+	reportsMu sync.Mutex
+	reports   []*runReport
+}
+
+// newSession sets up the session acting for user with app and starts the
+// worker of its job queue, which runs jobs left over from the last server
+// first
+func newSession(ctx context.Context, tenant, user string, app *app, status *health) (*session, error) {
+	sess := &session{tenant: tenant, user: user, app: app, status: status}
+	sess.jobs = jobs.New(app.store, sess.runJob)
+	sess.jobs.Finished = sess.finish
+	if err := sess.jobs.Start(ctx); err != nil {
+		return nil, fmt.Errorf("unable to start the job queue of %s: %v", sess, err)
+	}
+	return sess, nil
+}
+
+// String names the session in logs
+func (sess *session) String() string {
+	if sess.tenant == "" {
+		return sess.user
+	}
+	return sess.tenant + "/" + sess.user
+}
+
+// singleTenant serves the user of app to the holders of token, who may
+// do anything. The user's runs set status.
+func singleTenant(ctx context.Context, app *app, token string, status *health) (*tenant, error) {
+	sess, err := newSession(ctx, "", app.userEmail, app, status)
+	if err != nil {
+		return nil, err
+	}
+	return &tenant{
+		tokens:   []config.APIToken{{Name: "--token", Token: token, Scope: config.ScopeAdmin}},
+		user:     app.userEmail,
+		sessions: map[string]*session{app.userEmail: sess},
+	}, nil
+}
+
+// configTenants returns the tenants of the config, in name order. Their
+// sessions are set up on first use.
+func configTenants(cfg *config.Config, opts *runFlags) ([]*tenant, error) {
+	var tenants []*tenant
+	for name, settings := range cfg.Tenants {
+		profile, err := cfg.Profile(settings.Profile)
+		if err != nil {
+			return nil, fmt.Errorf("tenant %s: %v", name, err)
+		}
+		t := &tenant{
+			name:        name,
+			domain:      strings.ToLower(settings.Domain),
+			tokens:      settings.Tokens,
+			user:        strings.ToLower(settings.User),
+			profile:     profile,
+			credentials: settings.Credentials,
+			stateDir:    settings.StateDir,
+			opts:        opts,
+			sessions:    make(map[string]*session),
+		}
+		// The profile's user is only a default for the tenant of their domain
+		if t.user == "" && t.inDomain(strings.ToLower(profile.User)) {
+			t.user = strings.ToLower(profile.User)
+		}
+		tenants = append(tenants, t)
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].name < tenants[j].name })
+	return tenants, nil
+}
+
+// authorize finds the tenant and token a secret belongs to
+func authorize(tenants []*tenant, secret string) (*tenant, config.APIToken, bool) {
+	for _, t := range tenants {
+		for _, token := range t.tokens {
+			if subtle.ConstantTimeCompare([]byte(secret), []byte(token.Token)) == 1 {
+				return t, token, true
+			}
+		}
+	}
+	return nil, config.APIToken{}, false
+}
+
+// actAs returns whom a request with token acts for when it asks for
+// requested. Only admin tokens may name a user other than their own, and
+// only one of the tenant's domain.
+func (t *tenant) actAs(token config.APIToken, requested string) (string, error) {
+	user := t.user
+	if token.User != "" {
+		user = strings.ToLower(token.User)
+	}
+	requested = strings.ToLower(requested)
+	switch {
+	case requested == "" || requested == user:
+	case t.domain == "":
+		return "", fmt.Errorf("this server only acts for its profile's user")
+	case !token.Allows(config.ScopeAdmin):
+		return "", fmt.Errorf("the token may only act for %s", user)
+	case strings.ContainsAny(requested, `/\`) || !t.inDomain(requested):
+		return "", fmt.Errorf("%s is not a user of %s", requested, t.domain)
+	default:
+		user = requested
+	}
+	if user == "" && t.domain != "" {
+		return "", fmt.Errorf("name the user to act for with ?user=")
+	}
+	return user, nil
+}
+
+// inDomain reports whether user is an address of the tenant's domain
+func (t *tenant) inDomain(user string) bool {
+	_, domain, ok := strings.Cut(user, "@")
+	return ok && t.domain != "" && domain == t.domain
+}
+
+// session returns the session acting for user, setting up its app the
+// first time: the tenant's service account impersonates the user, whose
+// state is kept in a file of their own in the tenant's state directory
+func (t *tenant) session(ctx context.Context, user string) (*session, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if sess, ok := t.sessions[user]; ok {
+		return sess, nil
+	}
+
+	if err := os.MkdirAll(t.stateDir, 0o700); err != nil {
+		return nil, err
+	}
+	profile := *t.profile
+	profile.Auth = config.AuthServiceAccount
+	profile.Credentials = t.credentials
+	profile.User = user
+	profile.StateFile = filepath.Join(t.stateDir, user+".json")
+	if profile.Audit != nil {
+		audit := *profile.Audit
+		audit.Path = filepath.Join(t.stateDir, user+"-audit.jsonl")
+		profile.Audit = &audit
+	}
+	opts := *t.opts
+	opts.userEmail = &user
+	// Runs for a whole domain would use up the Tasks API's quota reading
+	// every list in full each time
+	opts.cacheTasks = true
+	app, err := opts.profileApp(ctx, &profile)
+	if err != nil {
+		return nil, err
+	}
+	// One user's failing runs don't take a server that serves tenants out of
+	// rotation for the others
+	sess, err := newSession(ctx, t.name, user, app, nil)
+	if err != nil {
+		app.Close()
+		return nil, err
+	}
+	t.sessions[user] = sess
+	return sess, nil
+}
+
+// each calls fn with every session set up so far
+func (t *tenant) each(fn func(sess *session)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, sess := range t.sessions {
+		fn(sess)
+	}
+}
@@ -0,0 +1,235 @@
+// Package throttle paces requests to rate-limited APIs. Every request sent
+// through a Limiter waits its turn; when any of them is refused for going
+// too fast, the Limiter slows down for all of them, then speeds back up
+// slowly while requests go through.
+package throttle
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// DefaultRate is the requests per second a Limiter starts at and ramps
+	// back up to
+	DefaultRate = 10
+	// minRate is the slowest a Limiter backs off to, in requests per second
+	minRate = 0.2
+	// backoffInterval keeps the refusals of requests that were already in
+	// flight from backing off again
+	backoffInterval = time.Second
+	// rampInterval is how often a Limiter speeds up while requests go
+	// through
+	rampInterval = 10 * time.Second
+	// rampStep is the share of the full rate a Limiter speeds up by
+	rampStep = 0.1
+	// maxPause caps how long a Retry-After header holds requests back
+	maxPause = 5 * time.Minute
+)
+
+// rateLimitReasons are the reasons Google APIs give for a 403 that means
+// going too fast rather than lacking access
+var rateLimitReasons = []string{"rateLimitExceeded", "userRateLimitExceeded"}
+
+// Limiter paces the requests of everything that shares it
+type Limiter struct {
+	full    rate.Limit
+	limiter *rate.Limiter
+
+	mu sync.Mutex
+	// paused holds requests back until then, as asked by Retry-After
+	paused time.Time
+	// changed is when the rate last backed off or ramped up
+	changed  time.Time
+	requests int64
+	limited  int64
+	waited   time.Duration
+}
+
+// Stats is what a Limiter did so far
+type Stats struct {
+	// Rate is the requests per second currently allowed, and FullRate what
+	// it ramps back up to
+	Rate     float64
+	FullRate float64
+	// Requests counts the requests sent, and Limited those refused for
+	// going too fast
+	Requests int64
+	Limited  int64
+	// Waited totals the time requests waited for their turn
+	Waited time.Duration
+	// Paused is when requests may start again after a Retry-After, zero
+	// when they aren't held back
+	Paused time.Time
+}
+
+// New creates a Limiter allowing perSecond requests per second at most
+func New(perSecond float64) *Limiter {
+	return &Limiter{full: rate.Limit(perSecond), limiter: rate.NewLimiter(rate.Limit(perSecond), burst(rate.Limit(perSecond)))}
+}
+
+// burst lets a second's worth of requests start at once
+func burst(limit rate.Limit) int {
+	return max(int(limit), 1)
+}
+
+// setRate changes the rate, and the burst with it so that requests saved up
+// at the old rate don't all start at once; l.mu is held
+func (l *Limiter) setRate(now time.Time, limit rate.Limit) {
+	l.changed = now
+	l.limiter.SetLimitAt(now, limit)
+	l.limiter.SetBurstAt(now, burst(limit))
+}
+
+// Transport returns a transport that sends requests through base at the
+// Limiter's pace, and adapts it to the responses
+func (l *Limiter) Transport(base http.RoundTripper) http.RoundTripper {
+	return &transport{limiter: l, base: base}
+}
+
+// Stats returns what the Limiter did so far
+func (l *Limiter) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stats := Stats{
+		Rate:     float64(l.limiter.Limit()),
+		FullRate: float64(l.full),
+		Requests: l.requests,
+		Limited:  l.limited,
+		Waited:   l.waited,
+	}
+	if time.Now().Before(l.paused) {
+		stats.Paused = l.paused
+	}
+	return stats
+}
+
+// wait blocks until a request may start
+func (l *Limiter) wait(ctx context.Context) error {
+	started := time.Now()
+	defer func() {
+		l.mu.Lock()
+		l.requests++
+		l.waited += time.Since(started)
+		l.mu.Unlock()
+	}()
+
+	l.mu.Lock()
+	pause := time.Until(l.paused)
+	l.mu.Unlock()
+	if pause > 0 {
+		timer := time.NewTimer(pause)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return l.limiter.Wait(ctx)
+}
+
+// backOff halves the rate after a request to host was refused, and holds
+// every request back for retryAfter when the API asked for it
+func (l *Limiter) backOff(host string, retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limited++
+	now := time.Now()
+	if retryAfter > 0 {
+		if paused := now.Add(min(retryAfter, maxPause)); paused.After(l.paused) {
+			l.paused = paused
+		}
+	}
+	if now.Sub(l.changed) < backoffInterval {
+		return
+	}
+	slower := max(l.limiter.Limit()/2, minRate)
+	l.setRate(now, slower)
+	log.Printf("Rate limited by %s; slowing down to %.1f requests per second", host, float64(slower))
+}
+
+// rampUp speeds back up a step after a request went through, at most once
+// per rampInterval
+func (l *Limiter) rampUp() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	current := l.limiter.Limit()
+	now := time.Now()
+	if current >= l.full || now.Sub(l.changed) < rampInterval {
+		return
+	}
+	l.setRate(now, min(current+l.full*rampStep, l.full))
+}
+
+// transport paces requests through a Limiter
+type transport struct {
+	limiter *Limiter
+	base    http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.wait(req.Context()); err != nil {
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	switch limited, retryAfter := rateLimited(resp); {
+	case limited:
+		t.limiter.backOff(req.URL.Host, retryAfter)
+	case resp.StatusCode < http.StatusBadRequest:
+		t.limiter.rampUp()
+	}
+	return resp, nil
+}
+
+// rateLimited reports whether resp refuses a request for going too fast:
+// a 429, or a 403 giving one of Google's rate limit reasons. It returns
+// how long Retry-After asks to wait, if at all.
+func rateLimited(resp *http.Response) (bool, time.Duration) {
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true, retryAfter(resp.Header.Get("Retry-After"))
+	case http.StatusForbidden:
+		// The body is read to find the reason and put back for the caller
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		if err != nil {
+			return false, 0
+		}
+		for _, reason := range rateLimitReasons {
+			if strings.Contains(string(body), `"`+reason+`"`) {
+				return true, retryAfter(resp.Header.Get("Retry-After"))
+			}
+		}
+	}
+	return false, 0
+}
+
+// retryAfter parses a Retry-After header given in seconds or as a date
+func retryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
@@ -0,0 +1,229 @@
+package timelog
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"zap/datetime"
+	"zap/gemini"
+	"zap/notes"
+	"zap/store"
+	"zap/todo"
+)
+
+const (
+	// bucket holds every tracked task's sessions, keyed by task ID
+	bucket = "timelog"
+	// timerBucket holds the running session under timerKey
+	timerBucket = "timer"
+	timerKey    = "running"
+)
+
+// minSamples is how many finished tasks with estimates it takes before
+// estimates are corrected by how long tasks actually took
+const minSamples = 3
+
+// estimatePattern matches effort estimates such as ~45m, ~2h or ~1h30m at
+// the start of the text or after whitespace
+var estimatePattern = regexp.MustCompile(`(^|\s)~(?:(\d+)h)?(?:(\d+)m)?(\s|$)`)
+
+// Estimate reads the effort estimate from a task's title, then from the
+// user's part of its notes, leaving out the block in ns
+func Estimate(task *todo.Task, ns notes.Namespace) (time.Duration, bool) {
+	for _, text := range []string{task.Title, ns.User(task.Notes)} {
+		for _, match := range estimatePattern.FindAllStringSubmatch(text, -1) {
+			if match[2] == "" && match[3] == "" {
+				continue
+			}
+			hours, _ := strconv.Atoi(match[2])
+			minutes, _ := strconv.Atoi(match[3])
+			if estimate := time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute; estimate > 0 {
+				return estimate, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// Format writes a duration in hours and minutes, e.g. 1h40m or 25m
+func Format(d time.Duration) string {
+	d = d.Round(time.Minute)
+	hours, minutes := int(d.Hours()), int(d.Minutes())%60
+	switch {
+	case hours == 0:
+		return fmt.Sprintf("%dm", minutes)
+	case minutes == 0:
+		return fmt.Sprintf("%dh", hours)
+	}
+	return fmt.Sprintf("%dh%dm", hours, minutes)
+}
+
+// Session is one stretch of work on a task
+type Session struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Record is the work tracked against a task
+type Record struct {
+	TaskID string `json:"taskId"`
+	Title  string `json:"title"`
+	ListID string `json:"listId"`
+	// Estimate is the task's estimate when work last stopped, if it had one
+	Estimate time.Duration `json:"estimate,omitempty"`
+	Sessions []Session     `json:"sessions"`
+	// Done is set when the task was completed as work stopped
+	Done bool `json:"done,omitempty"`
+}
+
+// Spent returns the total time worked on the task
+func (r Record) Spent() time.Duration {
+	var total time.Duration
+	for _, session := range r.Sessions {
+		total += session.End.Sub(session.Start)
+	}
+	return total
+}
+
+// Timer is the session running now
+type Timer struct {
+	TaskID    string    `json:"taskId"`
+	Title     string    `json:"title"`
+	ListID    string    `json:"listId"`
+	ListTitle string    `json:"listTitle"`
+	Start     time.Time `json:"start"`
+}
+
+// Log records work sessions in the store. One task is timed at a time.
+type Log struct {
+	store *store.Store
+	clock *datetime.Clock
+	// readOnly logs report what would be recorded without recording it
+	readOnly bool
+	// namespace is the block of zap's own notes, where estimates aren't
+	// looked for
+	namespace notes.Namespace
+}
+
+// New creates a log kept in st. A read-only log doesn't change the store.
+func New(st *store.Store, clock *datetime.Clock, readOnly bool) *Log {
+	return &Log{store: st, clock: clock, readOnly: readOnly}
+}
+
+// SetNamespace sets the namespace of zap's block in notes
+func (l *Log) SetNamespace(ns notes.Namespace) {
+	l.namespace = ns
+}
+
+// Running returns the session running now, if any
+func (l *Log) Running() (Timer, bool, error) {
+	var timer Timer
+	found, err := l.store.Get(timerBucket, timerKey, &timer)
+	return timer, found, err
+}
+
+// Start begins timing a task. Only one task is timed at a time, so a
+// running session must be stopped first.
+func (l *Log) Start(taskList *todo.TaskList, task *todo.Task) (Timer, error) {
+	running, found, err := l.Running()
+	if err != nil {
+		return Timer{}, err
+	}
+	if found {
+		return Timer{}, fmt.Errorf("already working on '%s' since %s; run 'zap stop' first", running.Title, running.Start.In(l.clock.Location()).Format("15:04"))
+	}
+	timer := Timer{
+		TaskID:    task.ID,
+		Title:     task.Title,
+		ListID:    taskList.ID,
+		ListTitle: taskList.Title,
+		Start:     l.clock.Now(),
+	}
+	if l.readOnly {
+		return timer, nil
+	}
+	return timer, l.store.Put(timerBucket, timerKey, timer)
+}
+
+// Stop ends the running session and adds it to the task's record, with
+// the task's current estimate. done marks the task as finished, so it
+// counts towards correcting estimates.
+func (l *Log) Stop(task *todo.Task, done bool) (Record, error) {
+	running, found, err := l.Running()
+	if err != nil {
+		return Record{}, err
+	}
+	if !found {
+		return Record{}, fmt.Errorf("no task is being timed; run 'zap start <task>' first")
+	}
+
+	var record Record
+	if _, err := l.store.Get(bucket, running.TaskID, &record); err != nil {
+		return Record{}, err
+	}
+	record.TaskID = running.TaskID
+	record.ListID = running.ListID
+	record.Title = task.Title
+	record.Estimate, _ = Estimate(task, l.namespace)
+	record.Sessions = append(record.Sessions, Session{Start: running.Start, End: l.clock.Now()})
+	record.Done = record.Done || done
+	if l.readOnly {
+		return record, nil
+	}
+	if err := l.store.Put(bucket, record.TaskID, record); err != nil {
+		return Record{}, err
+	}
+	return record, l.store.Delete(timerBucket, timerKey)
+}
+
+// Bias returns how long finished tasks took relative to their estimates,
+// e.g. 1.5 when they took half again as long. It is 1 until enough tasks
+// with estimates were finished.
+func (l *Log) Bias() (float64, error) {
+	var spent, estimated time.Duration
+	samples := 0
+	for _, key := range l.store.Keys(bucket) {
+		var record Record
+		if _, err := l.store.Get(bucket, key, &record); err != nil {
+			return 1, err
+		}
+		if !record.Done || record.Estimate <= 0 {
+			continue
+		}
+		spent += record.Spent()
+		estimated += record.Estimate
+		samples++
+	}
+	if samples < minSamples || spent <= 0 {
+		return 1, nil
+	}
+	return float64(spent) / float64(estimated), nil
+}
+
+// Efforts returns the effort of the tasks that have an estimate or tracked
+// time, keyed by task ID. Estimates are scaled by Bias, so future estimates
+// learn from how long earlier tasks took.
+func (l *Log) Efforts(tasks []*todo.Task) (map[string]gemini.Effort, error) {
+	bias, err := l.Bias()
+	if err != nil {
+		return nil, err
+	}
+	efforts := make(map[string]gemini.Effort)
+	for _, task := range tasks {
+		var effort gemini.Effort
+		if estimate, ok := Estimate(task, l.namespace); ok {
+			effort.Estimate = time.Duration(float64(estimate) * bias).Round(time.Minute)
+		}
+		var record Record
+		if _, err := l.store.Get(bucket, task.ID, &record); err != nil {
+			return nil, err
+		}
+		effort.Spent = record.Spent()
+		if effort.Estimate > 0 || effort.Spent > 0 {
+			efforts[task.ID] = effort
+		}
+	}
+	return efforts, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"zap/tags"
+	"zap/tasks"
+	"zap/todo"
+)
+
+// titlesBucket records, by task ID, the title each task was last given by
+// the cleanup pass, so titles are only sent once until the user edits them
+const titlesBucket = "titles"
+
+// maxTitleLength is the longest title the cleanup pass writes
+const maxTitleLength = 60
+
+// markerPattern matches bracketed markers such as [HIGH], [pinned] or [zap:#2]
+var markerPattern = regexp.MustCompile(`\[[^\]]+\]`)
+
+// cleanTitles rewrites the open tasks' titles in the target lists in a
+// consistent style, printing each change as a diff first. Rewrites that
+// drop a marker or tag, or run too long, are skipped. It returns how many
+// titles were rewritten.
+func (a *app) cleanTitles(ctx context.Context, targetLists []string) (int, error) {
+	rewritten := 0
+	for _, listTitle := range targetLists {
+		taskList, err := a.service.GetTaskListByTitle(listTitle)
+		if err != nil {
+			return rewritten, fmt.Errorf("error finding task list %s: %w", listTitle, err)
+		}
+		listTasks, err := a.service.ListTasks(taskList.ID)
+		if err != nil {
+			return rewritten, fmt.Errorf("error fetching tasks for list %s: %w", listTitle, err)
+		}
+
+		var pending []*todo.Task
+		byID := make(map[string]*todo.Task)
+		for _, task := range listTasks {
+			if task.Status == "completed" || task.Title == "" || a.filter.Excludes(task) {
+				continue
+			}
+			var cleaned string
+			if _, err := a.store.Get(titlesBucket, task.ID, &cleaned); err != nil {
+				return rewritten, err
+			}
+			// Markers come and go with escalation and rank annotations
+			if withoutMarkers(cleaned) == withoutMarkers(task.Title) {
+				continue
+			}
+			pending = append(pending, task)
+			byID[task.ID] = task
+		}
+		if len(pending) == 0 {
+			continue
+		}
+
+		edits, err := a.gemini.NormalizeTitles(ctx, pending)
+		if err != nil {
+			return rewritten, &exitError{code: exitLLM, err: fmt.Errorf("error cleaning up titles in list %s: %v", listTitle, err)}
+		}
+		var mutations []tasks.Mutation
+		for _, edit := range edits {
+			task := byID[edit.TaskID]
+			title := strings.TrimSpace(edit.Title)
+			if !keepsMarkers(task.Title, title) || utf8.RuneCountInString(title) > maxTitleLength {
+				log.Printf("Keeping '%s': the rewrite '%s' drops a marker or tag or is too long", task.Title, title)
+				continue
+			}
+			a.progress.Printf("- %s\n+ %s\n", task.Title, title)
+			updated := *task
+			updated.Title = title
+			mutations = append(mutations, tasks.Mutation{
+				Kind:       tasks.MutationUpdate,
+				TaskListID: taskList.ID,
+				Task:       &updated,
+				Before:     task,
+				Summary:    fmt.Sprintf("rename '%s' to '%s'", task.Title, title),
+			})
+		}
+		if _, err := a.orchestrator.Apply(ctx, mutations); err != nil {
+			return rewritten, fmt.Errorf("error cleaning up titles in list %s: %v", listTitle, err)
+		}
+		rewritten += len(mutations)
+		if a.dryRun {
+			continue
+		}
+
+		// Titles the model left alone are clean too
+		renamed := make(map[string]string, len(mutations))
+		for _, m := range mutations {
+			renamed[m.Task.ID] = m.Task.Title
+		}
+		for _, task := range pending {
+			title, ok := renamed[task.ID]
+			if !ok {
+				title = task.Title
+			}
+			if err := a.store.Put(titlesBucket, task.ID, title); err != nil {
+				return rewritten, err
+			}
+		}
+	}
+	return rewritten, nil
+}
+
+// keepsMarkers reports whether title still has every bracketed marker and
+// tag of original
+func keepsMarkers(original, title string) bool {
+	lower := strings.ToLower(title)
+	for _, marker := range markerPattern.FindAllString(original, -1) {
+		if !strings.Contains(lower, strings.ToLower(marker)) {
+			return false
+		}
+	}
+	kept := tags.Parse(title)
+	for _, tag := range tags.Parse(original) {
+		if !slices.Contains(kept, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// withoutMarkers drops the bracketed markers from a title
+func withoutMarkers(title string) string {
+	return strings.Join(strings.Fields(markerPattern.ReplaceAllString(title, "")), " ")
+}
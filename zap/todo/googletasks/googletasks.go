@@ -0,0 +1,104 @@
+// Package googletasks converts between zap's tasks and those of the Google
+// Tasks API
+package googletasks
+
+import (
+	"zap/todo"
+
+	tasksapi "google.golang.org/api/tasks/v1"
+)
+
+// Task converts an API task, which may be nil
+func Task(task *tasksapi.Task) *todo.Task {
+	if task == nil {
+		return nil
+	}
+	converted := &todo.Task{
+		ID:          task.Id,
+		Title:       task.Title,
+		Notes:       task.Notes,
+		Due:         task.Due,
+		Status:      task.Status,
+		Parent:      task.Parent,
+		Position:    task.Position,
+		Updated:     task.Updated,
+		Deleted:     task.Deleted,
+		Hidden:      task.Hidden,
+		ETag:        task.Etag,
+		WebViewLink: task.WebViewLink,
+	}
+	if task.Completed != nil {
+		converted.Completed = *task.Completed
+	}
+	return converted
+}
+
+// Tasks converts API tasks
+func Tasks(tasks []*tasksapi.Task) []*todo.Task {
+	converted := make([]*todo.Task, len(tasks))
+	for i, task := range tasks {
+		converted[i] = Task(task)
+	}
+	return converted
+}
+
+// APITask converts a task to the API's, which may be nil
+func APITask(task *todo.Task) *tasksapi.Task {
+	if task == nil {
+		return nil
+	}
+	converted := &tasksapi.Task{
+		Kind:        "tasks#task",
+		Id:          task.ID,
+		Title:       task.Title,
+		Notes:       task.Notes,
+		Due:         task.Due,
+		Status:      task.Status,
+		Parent:      task.Parent,
+		Position:    task.Position,
+		Updated:     task.Updated,
+		Deleted:     task.Deleted,
+		Hidden:      task.Hidden,
+		Etag:        task.ETag,
+		WebViewLink: task.WebViewLink,
+	}
+	if task.Completed != "" {
+		completed := task.Completed
+		converted.Completed = &completed
+	}
+	return converted
+}
+
+// APITasks converts tasks to the API's
+func APITasks(tasks []*todo.Task) []*tasksapi.Task {
+	converted := make([]*tasksapi.Task, len(tasks))
+	for i, task := range tasks {
+		converted[i] = APITask(task)
+	}
+	return converted
+}
+
+// TaskList converts an API task list, which may be nil
+func TaskList(list *tasksapi.TaskList) *todo.TaskList {
+	if list == nil {
+		return nil
+	}
+	return &todo.TaskList{ID: list.Id, Title: list.Title, Updated: list.Updated}
+}
+
+// TaskLists converts API task lists
+func TaskLists(lists []*tasksapi.TaskList) []*todo.TaskList {
+	converted := make([]*todo.TaskList, len(lists))
+	for i, list := range lists {
+		converted[i] = TaskList(list)
+	}
+	return converted
+}
+
+// APITaskList converts a task list to the API's, which may be nil
+func APITaskList(list *todo.TaskList) *tasksapi.TaskList {
+	if list == nil {
+		return nil
+	}
+	return &tasksapi.TaskList{Kind: "tasks#taskList", Id: list.ID, Title: list.Title, Updated: list.Updated}
+}
@@ -0,0 +1,44 @@
+// Package todo holds zap's own task and task list types. Every package
+// works with these whatever service the tasks come from; each backend
+// converts its service's types to them at its edge. The JSON names are
+// those of the Google Tasks API, so tasks saved before keep reading back.
+package todo
+
+// Task is a task or subtask
+type Task struct {
+	ID    string `json:"id,omitempty"`
+	Title string `json:"title,omitempty"`
+	Notes string `json:"notes,omitempty"`
+	// Due is an RFC 3339 timestamp of which only the date counts
+	Due string `json:"due,omitempty"`
+	// Status is "needsAction" or "completed"
+	Status string `json:"status,omitempty"`
+	// Completed is when the task was completed, as an RFC 3339 timestamp,
+	// empty while it is open
+	Completed string `json:"completed,omitempty"`
+	// Parent is the ID of the task a subtask is under, empty for top-level
+	// tasks
+	Parent string `json:"parent,omitempty"`
+	// Position orders a task among its siblings; positions compare as
+	// strings
+	Position string `json:"position,omitempty"`
+	// Updated is when the task last changed, as an RFC 3339 timestamp
+	Updated string `json:"updated,omitempty"`
+	// Deleted tasks are only returned when asked for
+	Deleted bool `json:"deleted,omitempty"`
+	// Hidden tasks were completed and then cleared from the list
+	Hidden bool `json:"hidden,omitempty"`
+	// ETag identifies the version of the task that was read, so a write
+	// can be refused when it changed since
+	ETag string `json:"etag,omitempty"`
+	// WebViewLink opens the task in its service
+	WebViewLink string `json:"webViewLink,omitempty"`
+}
+
+// TaskList is a list of tasks
+type TaskList struct {
+	ID    string `json:"id,omitempty"`
+	Title string `json:"title,omitempty"`
+	// Updated is when the list last changed, as an RFC 3339 timestamp
+	Updated string `json:"updated,omitempty"`
+}
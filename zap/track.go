@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"zap/notes"
+	"zap/tasks"
+	"zap/timelog"
+	"zap/todo"
+)
+
+// runStart starts timing work on a task
+func runStart(args []string) {
+	flags := flag.NewFlagSet("start", flag.ExitOnError)
+	runOpts := registerRunFlags(flags)
+	listTitle := flags.String("list", "", "Task list the task is in (default: search the profile's target lists)")
+
+	positional := parseInterspersed(flags, args)
+	if len(positional) != 1 {
+		log.Fatal("usage: zap start <task> [--list <list>]")
+	}
+
+	ctx := context.Background()
+	app, err := runOpts.newApp(ctx, flags)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer app.Close()
+
+	taskList, task, err := app.findTask(positional[0], *listTitle)
+	if err != nil {
+		log.Fatal(err)
+	}
+	timer, err := timelog.New(app.store, app.clock, app.dryRun).Start(taskList, task)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Working on '%s' since %s\n", timer.Title, timer.Start.In(app.clock.Location()).Format("15:04"))
+}
+
+// runStop stops timing the running task and notes the time worked on it
+func runStop(args []string) {
+	flags := flag.NewFlagSet("stop", flag.ExitOnError)
+	runOpts := registerRunFlags(flags)
+	done := flags.Bool("done", false, "Also complete the task")
+	flags.Parse(args)
+
+	ctx := context.Background()
+	app, err := runOpts.newApp(ctx, flags)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer app.Close()
+
+	if err := app.stop(ctx, *done); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// stop ends the running session and appends the time worked, in total and
+// against the estimate, to the task's notes. A task deleted meanwhile only
+// has its time recorded.
+func (a *app) stop(ctx context.Context, done bool) error {
+	timeLog := a.timeLog(a.dryRun)
+	timer, found, err := timeLog.Running()
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("no task is being timed; run 'zap start <task>' first")
+	}
+
+	task, err := a.service.GetTask(ctx, timer.ListID, timer.TaskID)
+	deleted := tasks.IsNotFound(err)
+	switch {
+	case deleted:
+		task = &todo.Task{ID: timer.TaskID, Title: timer.Title}
+	case err != nil:
+		return err
+	}
+	record, err := timeLog.Stop(task, done)
+	if err != nil {
+		return err
+	}
+	session := record.Sessions[len(record.Sessions)-1]
+	worked := session.End.Sub(session.Start)
+	fmt.Printf("Worked %s on '%s', %s in total\n", timelog.Format(worked), task.Title, timelog.Format(record.Spent()))
+	if deleted {
+		log.Printf("'%s' no longer exists; only the time was recorded", timer.Title)
+		return nil
+	}
+
+	text := fmt.Sprintf("worked %s, %s in total", timelog.Format(worked), timelog.Format(record.Spent()))
+	if record.Estimate > 0 {
+		text += fmt.Sprintf(" of ~%s estimated", timelog.Format(record.Estimate))
+	}
+	updated := *task
+	updated.Notes = a.namespace.Append(task.Notes, notes.Entry{Time: a.clock.Now(), Kind: notes.Time, Text: text})
+	summary := fmt.Sprintf("note time worked in '%s'", task.Title)
+	if done {
+		updated.Status = "completed"
+		summary = fmt.Sprintf("complete '%s' and note the time worked", task.Title)
+	}
+
+	taskList := &todo.TaskList{ID: timer.ListID, Title: timer.ListTitle}
+	listLock, err := a.lockList(ctx, taskList)
+	if err != nil {
+		return err
+	}
+	defer listLock.Release()
+	_, err = a.orchestrator.Apply(ctx, []tasks.Mutation{{
+		Kind:       tasks.MutationUpdate,
+		TaskListID: timer.ListID,
+		Task:       &updated,
+		Before:     task,
+		Summary:    summary,
+	}})
+	return err
+}
+
+// timeLog returns the time log, which reads estimates outside zap's block
+// in notes. A read-only log doesn't change the store.
+func (a *app) timeLog(readOnly bool) *timelog.Log {
+	timeLog := timelog.New(a.store, a.clock, readOnly)
+	timeLog.SetNamespace(a.namespace)
+	return timeLog
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"zap/datetime"
+	"zap/gemini"
+	"zap/tasks"
+	"zap/todo"
+)
+
+// runTriage turns the captured tasks in the inbox list into actionable
+// tasks and files them into the target lists
+func runTriage(args []string) {
+	flags := flag.NewFlagSet("triage", flag.ExitOnError)
+	runOpts := registerRunFlags(flags)
+	inbox := flags.String("inbox", "", "List to triage (default: the profile's inbox)")
+	flags.Parse(args)
+
+	ctx := context.Background()
+	app, err := runOpts.newApp(ctx, flags)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer app.Close()
+	if err := app.requireGemini(); err != nil {
+		log.Fatal(err)
+	}
+	if *inbox == "" {
+		*inbox = app.profile.Inbox
+	}
+
+	if err := app.triage(ctx, *inbox); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// triage asks the model to rewrite, file and date every open top-level
+// task in the inbox, then updates each task and moves it, with its
+// subtasks, to the top of its list. Due dates already set are kept.
+func (a *app) triage(ctx context.Context, inboxTitle string) error {
+	inbox, err := a.service.GetTaskListByTitle(inboxTitle)
+	if err != nil {
+		return fmt.Errorf("error finding inbox %s: %w", inboxTitle, err)
+	}
+	destinations := make(map[string]*todo.TaskList)
+	var listTitles []string
+	for _, title := range a.profile.TargetLists {
+		if strings.EqualFold(title, inbox.Title) {
+			continue
+		}
+		taskList, err := a.service.GetTaskListByTitle(title)
+		if err != nil {
+			return fmt.Errorf("error finding task list %s: %w", title, err)
+		}
+		destinations[title] = taskList
+		listTitles = append(listTitles, title)
+	}
+	if len(listTitles) == 0 {
+		return fmt.Errorf("no target lists besides the inbox %s to file tasks into", inbox.Title)
+	}
+
+	listLock, err := a.lockList(ctx, inbox)
+	if err != nil {
+		return err
+	}
+	defer listLock.Release()
+
+	listTasks, err := a.service.ListTasks(inbox.ID)
+	if err != nil {
+		return fmt.Errorf("error fetching tasks for list %s: %w", inbox.Title, err)
+	}
+	var open []*todo.Task
+	for _, task := range tasks.NewTaskTree(listTasks).TopLevel() {
+		if task.Parent == "" && task.Status != "completed" && !a.filter.Excludes(task) {
+			open = append(open, task)
+		}
+	}
+	if len(open) == 0 {
+		fmt.Printf("Inbox %s is empty\n", inbox.Title)
+		return nil
+	}
+
+	triaged, err := a.gemini.TriageTasks(ctx, open, listTitles, a.clock)
+	if err != nil {
+		return &exitError{code: exitLLM, err: fmt.Errorf("error triaging %s: %v", inbox.Title, err)}
+	}
+	byID := make(map[string]*todo.Task, len(open))
+	for _, task := range open {
+		byID[task.ID] = task
+	}
+
+	filed := 0
+	for _, t := range triaged {
+		task := byID[t.TaskID]
+		destination := destinations[t.List]
+		mutations := triageMutations(inbox, destination, task, t)
+		if _, err := a.orchestrator.Apply(ctx, mutations); err != nil {
+			return fmt.Errorf("error filing '%s': %v", task.Title, err)
+		}
+		filed++
+
+		line := fmt.Sprintf("'%s' -> %s", task.Title, destination.Title)
+		if t.Title != task.Title {
+			line = fmt.Sprintf("'%s' -> '%s' in %s", task.Title, t.Title, destination.Title)
+		}
+		if task.Due == "" && t.Due != "" {
+			line += ", due " + t.Due
+		}
+		if t.Reason != "" {
+			line += ": " + t.Reason
+		}
+		fmt.Println(line)
+	}
+	if skipped := len(open) - filed; skipped > 0 {
+		fmt.Printf("Left %d tasks in %s that the model didn't place\n", skipped, inbox.Title)
+	}
+	if !a.dryRun {
+		fmt.Printf("Filed %d tasks from %s\n", filed, inbox.Title)
+	}
+	return nil
+}
+
+// triageMutations plans the update that gives a task its new title and due
+// date, if it had none, and the move to its list
+func triageMutations(inbox, destination *todo.TaskList, task *todo.Task, t gemini.Triage) []tasks.Mutation {
+	var mutations []tasks.Mutation
+	updated := *task
+	updated.Title = t.Title
+	if task.Due == "" && t.Due != "" {
+		day, _ := time.Parse("2006-01-02", t.Due)
+		updated.Due = datetime.FormatDue(day)
+	}
+	if updated.Title != task.Title || updated.Due != task.Due {
+		mutations = append(mutations, tasks.Mutation{
+			Kind:       tasks.MutationUpdate,
+			TaskListID: inbox.ID,
+			Task:       &updated,
+			Before:     task,
+			Summary:    fmt.Sprintf("rewrite '%s' as '%s'", task.Title, updated.Title),
+		})
+	}
+	return append(mutations, tasks.Mutation{
+		Kind:        tasks.MutationMove,
+		TaskListID:  inbox.ID,
+		Task:        &updated,
+		Destination: destination.ID,
+		Summary:     fmt.Sprintf("move '%s' from %s to %s", updated.Title, inbox.Title, destination.Title),
+	})
+}
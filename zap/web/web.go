@@ -0,0 +1,104 @@
+// Package web renders the dashboard zap serve shows in a browser, for
+// teammates who don't use the command line.
+package web
+
+import (
+	"embed"
+	"html/template"
+	"io"
+	"time"
+)
+
+//go:embed pages/*.html
+var files embed.FS
+
+// pages holds the dashboard and sign-in pages, which share the layout
+var pages = template.Must(template.New("").Funcs(template.FuncMap{
+	"when": func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return t.Local().Format("Mon 2006-01-02 15:04")
+	},
+	"inc": func(i int) int {
+		return i + 1
+	},
+	"took": func(d time.Duration) string {
+		return d.Round(time.Second).String()
+	},
+}).ParseFS(files, "pages/*.html"))
+
+// Dashboard is what the dashboard shows
+type Dashboard struct {
+	// Tenant and User are whose tasks are shown
+	Tenant string
+	User   string
+	DryRun bool
+	// CanRun is set when the token may start runs, and CanActAs when it
+	// may show other users' tasks
+	CanRun   bool
+	CanActAs bool
+	// Busy is set when a run holds the lists, so they can't be shown
+	Busy bool
+	// Running is set while a run started through the server is queued or in
+	// progress, and Events is where its progress streams from
+	Running bool
+	Events  string
+	// Subtasks is set when lists can be broken down, which takes the model
+	Subtasks bool
+	Lists    []List
+	Runs     []Run
+	// Error is shown above the lists, e.g. when they couldn't be fetched
+	Error string
+}
+
+// List is a target list with its open top-level tasks in order
+type List struct {
+	Title string
+	Open  int
+	Tasks []Task
+	// Ranked is when the list was last ranked, and by what
+	Ranked   time.Time
+	RankedBy string
+	// More counts the open tasks that aren't shown
+	More int
+}
+
+// Task is an open task with its latest zap ranking, if any
+type Task struct {
+	Title       string
+	Due         string
+	Subtasks    int
+	Ranked      bool
+	Priority    float64
+	Explanation string
+}
+
+// Run is a run started through the server and what it did
+type Run struct {
+	ID      string
+	Trigger string
+	Started time.Time
+	Took    time.Duration
+	// State is the run's job's: queued, running, succeeded or failed
+	State    string
+	Finished bool
+	// Retry is set for runs that failed for good, which can be queued again
+	Retry bool
+	// Lines sum up what changed, one line each
+	Lines  []string
+	Errors []string
+	// Warnings are the lists left out, each with how to fix it
+	Warnings []string
+}
+
+// WriteDashboard renders the dashboard
+func WriteDashboard(w io.Writer, d Dashboard) error {
+	return pages.ExecuteTemplate(w, "dashboard.html", d)
+}
+
+// WriteSignIn renders the page asking for the API token; failed says the
+// last token given was wrong
+func WriteSignIn(w io.Writer, failed bool) error {
+	return pages.ExecuteTemplate(w, "signin.html", failed)
+}
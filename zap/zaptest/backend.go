@@ -0,0 +1,559 @@
+package zaptest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+
+	"zap/todo"
+	"zap/todo/googletasks"
+
+	"google.golang.org/api/option"
+	tasksapi "google.golang.org/api/tasks/v1"
+)
+
+// Backend is an in-memory Google Tasks API served over HTTP. It implements
+// the calls zap makes, keeps sibling order like the real API and records
+// every write so callers can check what a run changed. Like the real API
+// it pages its answers, tags the task lists with an ETag and keeps deleted
+// tasks for listing with showDeleted.
+type Backend struct {
+	server *httptest.Server
+	// Now stamps the Updated field of written tasks
+	Now func() time.Time
+
+	mu      sync.Mutex
+	lists   []*tasksapi.TaskList
+	tasks   map[string][]*tasksapi.Task
+	deleted map[string][]*tasksapi.Task
+	nextID  int
+	etags   int
+	// version changes with the task lists, for their ETag
+	version int
+	writes  []string
+	reads   []string
+}
+
+// NewBackend starts an empty backend; Close stops it
+func NewBackend() *Backend {
+	b := &Backend{
+		Now:     time.Now,
+		tasks:   make(map[string][]*tasksapi.Task),
+		deleted: make(map[string][]*tasksapi.Task),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /tasks/v1/users/@me/lists", b.listTaskLists)
+	mux.HandleFunc("POST /tasks/v1/users/@me/lists", b.insertTaskList)
+	mux.HandleFunc("GET /tasks/v1/users/@me/lists/{list}", b.getTaskList)
+	mux.HandleFunc("PATCH /tasks/v1/users/@me/lists/{list}", b.patchTaskList)
+	mux.HandleFunc("DELETE /tasks/v1/users/@me/lists/{list}", b.deleteTaskList)
+	mux.HandleFunc("GET /tasks/v1/lists/{list}/tasks", b.listTasks)
+	mux.HandleFunc("POST /tasks/v1/lists/{list}/tasks", b.insertTask)
+	mux.HandleFunc("POST /tasks/v1/lists/{list}/clear", b.clear)
+	mux.HandleFunc("GET /tasks/v1/lists/{list}/tasks/{task}", b.getTask)
+	mux.HandleFunc("PATCH /tasks/v1/lists/{list}/tasks/{task}", b.patchTask)
+	mux.HandleFunc("PUT /tasks/v1/lists/{list}/tasks/{task}", b.patchTask)
+	mux.HandleFunc("DELETE /tasks/v1/lists/{list}/tasks/{task}", b.deleteTask)
+	mux.HandleFunc("POST /tasks/v1/lists/{list}/tasks/{task}/move", b.moveTask)
+
+	b.server = httptest.NewServer(mux)
+	return b
+}
+
+// Close shuts the server down
+func (b *Backend) Close() {
+	b.server.Close()
+}
+
+// Service returns a Tasks API client talking to the backend
+func (b *Backend) Service(ctx context.Context) (*tasksapi.Service, error) {
+	return tasksapi.NewService(ctx,
+		option.WithEndpoint(b.server.URL+"/"),
+		option.WithHTTPClient(b.server.Client()),
+	)
+}
+
+// AddList creates a task list and returns its ID
+func (b *Backend) AddList(title string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	list := &tasksapi.TaskList{Id: b.newID("list"), Title: title, Kind: "tasks#taskList"}
+	b.lists = append(b.lists, list)
+	b.version++
+	b.tasks[list.Id] = nil
+	return list.Id
+}
+
+// AddTask appends a task to the end of its siblings and returns its ID.
+// The task's Parent, if set, must already be in the list.
+func (b *Backend) AddTask(listID string, task *todo.Task) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	added := googletasks.APITask(task)
+	if added.Id == "" {
+		added.Id = b.newID("task")
+	}
+	if added.Status == "" {
+		added.Status = "needsAction"
+	}
+	b.stamp(added)
+	b.tasks[listID] = append(b.tasks[listID], added)
+	return added.Id
+}
+
+// RemoveTask deletes a task and its subtasks the way another client would,
+// without recording a write
+func (b *Backend) RemoveTask(listID, taskID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.remove(listID, func(task *tasksapi.Task) bool {
+		return task.Id == taskID
+	})
+}
+
+// EditTask changes a task the way another client such as the phone app
+// would, without recording a write; the task gets a new ETag
+func (b *Backend) EditTask(listID, taskID string, edit func(*todo.Task)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if i := b.findTask(listID, taskID); i >= 0 {
+		task := googletasks.Task(b.tasks[listID][i])
+		edit(task)
+		b.tasks[listID][i] = googletasks.APITask(task)
+		b.stamp(b.tasks[listID][i])
+	}
+}
+
+// Tasks returns a list's tasks with positions; siblings are in order
+func (b *Backend) Tasks(listID string) []*todo.Task {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return googletasks.Tasks(b.snapshot(listID))
+}
+
+// Writes returns the writes made through the API so far, such as
+// "POST /tasks/v1/lists/list-1/tasks/task-2/move?previous=task-3"
+func (b *Backend) Writes() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.writes...)
+}
+
+// ResetWrites forgets the recorded writes
+func (b *Backend) ResetWrites() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.writes = nil
+}
+
+// Reads returns the list calls made so far, recorded like Writes, such as
+// "GET /tasks/v1/lists/list-1/tasks?maxResults=100&showDeleted=true&..."
+func (b *Backend) Reads() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.reads...)
+}
+
+// ResetReads forgets the recorded reads
+func (b *Backend) ResetReads() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.reads = nil
+}
+
+// newID returns the next ID with a prefix; callers hold mu
+func (b *Backend) newID(prefix string) string {
+	b.nextID++
+	return fmt.Sprintf("%s-%d", prefix, b.nextID)
+}
+
+// snapshot copies a list's tasks and fills in positions; callers hold mu
+func (b *Backend) snapshot(listID string) []*tasksapi.Task {
+	counts := make(map[string]int)
+	out := make([]*tasksapi.Task, 0, len(b.tasks[listID]))
+	for _, task := range b.tasks[listID] {
+		copied := *task
+		copied.Position = fmt.Sprintf("%020d", counts[task.Parent])
+		counts[task.Parent]++
+		out = append(out, &copied)
+	}
+	return out
+}
+
+// findList returns a task list; callers hold mu
+func (b *Backend) findList(id string) (int, *tasksapi.TaskList) {
+	for i, list := range b.lists {
+		if list.Id == id {
+			return i, list
+		}
+	}
+	return -1, nil
+}
+
+// findTask returns a task's index in its list; callers hold mu
+func (b *Backend) findTask(listID, taskID string) int {
+	for i, task := range b.tasks[listID] {
+		if task.Id == taskID {
+			return i
+		}
+	}
+	return -1
+}
+
+// place inserts task after previous, or first among its siblings when
+// previous is empty; callers hold mu
+func (b *Backend) place(listID string, task *tasksapi.Task, previous string) {
+	tasks := b.tasks[listID]
+	at := len(tasks)
+	if previous != "" {
+		if i := b.findTask(listID, previous); i >= 0 {
+			at = i + 1
+		}
+	} else {
+		for i, sibling := range tasks {
+			if sibling.Parent == task.Parent {
+				at = i
+				break
+			}
+		}
+	}
+	tasks = append(tasks, nil)
+	copy(tasks[at+1:], tasks[at:])
+	tasks[at] = task
+	b.tasks[listID] = tasks
+}
+
+// remove deletes a task and its descendants, keeping them as deleted
+// tasks; callers hold mu
+func (b *Backend) remove(listID string, match func(*tasksapi.Task) bool) {
+	removed := make(map[string]bool)
+	var kept []*tasksapi.Task
+	for _, task := range b.tasks[listID] {
+		if match(task) || removed[task.Parent] {
+			removed[task.Id] = true
+			task.Deleted = true
+			b.stamp(task)
+			b.deleted[listID] = append(b.deleted[listID], task)
+			continue
+		}
+		kept = append(kept, task)
+	}
+	b.tasks[listID] = kept
+}
+
+// record notes a write; callers hold mu
+func (b *Backend) record(r *http.Request) {
+	b.writes = append(b.writes, call(r))
+}
+
+// call describes a request by its method, path and query
+func call(r *http.Request) string {
+	call := r.Method + " " + r.URL.Path
+	query := r.URL.Query()
+	query.Del("alt")
+	query.Del("prettyPrint")
+	if encoded := query.Encode(); encoded != "" {
+		call += "?" + encoded
+	}
+	return call
+}
+
+// stamp sets the Updated time and a new ETag of a written task; callers
+// hold mu
+func (b *Backend) stamp(task *tasksapi.Task) {
+	task.Updated = b.Now().UTC().Format(time.RFC3339)
+	b.etags++
+	task.Etag = fmt.Sprintf("\"%d\"", b.etags)
+}
+
+func (b *Backend) listTaskLists(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.reads = append(b.reads, call(r))
+	etag := fmt.Sprintf("\"lists-%d\"", b.version)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	start, end, next := page(r, len(b.lists), 1000)
+	writeJSON(w, &tasksapi.TaskLists{Kind: "tasks#taskLists", Etag: etag, Items: b.lists[start:end], NextPageToken: next})
+}
+
+func (b *Backend) insertTaskList(w http.ResponseWriter, r *http.Request) {
+	var list tasksapi.TaskList
+	if !readJSON(w, r, &list) {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.record(r)
+	list.Id = b.newID("list")
+	list.Kind = "tasks#taskList"
+	b.lists = append(b.lists, &list)
+	b.version++
+	b.tasks[list.Id] = nil
+	writeJSON(w, &list)
+}
+
+func (b *Backend) getTaskList(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, list := b.findList(r.PathValue("list"))
+	if list == nil {
+		writeError(w, http.StatusNotFound, "task list not found")
+		return
+	}
+	writeJSON(w, list)
+}
+
+func (b *Backend) patchTaskList(w http.ResponseWriter, r *http.Request) {
+	var patch tasksapi.TaskList
+	if !readJSON(w, r, &patch) {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, list := b.findList(r.PathValue("list"))
+	if list == nil {
+		writeError(w, http.StatusNotFound, "task list not found")
+		return
+	}
+	b.record(r)
+	if patch.Title != "" {
+		list.Title = patch.Title
+		b.version++
+	}
+	writeJSON(w, list)
+}
+
+func (b *Backend) deleteTaskList(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	i, list := b.findList(r.PathValue("list"))
+	if list == nil {
+		writeError(w, http.StatusNotFound, "task list not found")
+		return
+	}
+	b.record(r)
+	b.lists = append(b.lists[:i], b.lists[i+1:]...)
+	delete(b.tasks, list.Id)
+	delete(b.deleted, list.Id)
+	b.version++
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (b *Backend) listTasks(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	listID := r.PathValue("list")
+	if _, list := b.findList(listID); list == nil {
+		writeError(w, http.StatusNotFound, "task list not found")
+		return
+	}
+	b.reads = append(b.reads, call(r))
+	tasks := b.listed(r, listID)
+	start, end, next := page(r, len(tasks), 100)
+	writeJSON(w, &tasksapi.Tasks{Kind: "tasks#tasks", Items: tasks[start:end], NextPageToken: next})
+}
+
+// listed returns the tasks of a list that r asks for: those updated since
+// updatedMin, if given, followed by the deleted ones when showDeleted is
+// set; callers hold mu
+func (b *Backend) listed(r *http.Request, listID string) []*tasksapi.Task {
+	query := r.URL.Query()
+	tasks := b.snapshot(listID)
+	if query.Get("showDeleted") == "true" {
+		for _, task := range b.deleted[listID] {
+			copied := *task
+			tasks = append(tasks, &copied)
+		}
+	}
+	since, err := time.Parse(time.RFC3339, query.Get("updatedMin"))
+	if err != nil {
+		return tasks
+	}
+	var updated []*tasksapi.Task
+	for _, task := range tasks {
+		if at, err := time.Parse(time.RFC3339, task.Updated); err == nil && !at.Before(since) {
+			updated = append(updated, task)
+		}
+	}
+	return updated
+}
+
+func (b *Backend) insertTask(w http.ResponseWriter, r *http.Request) {
+	var task tasksapi.Task
+	if !readJSON(w, r, &task) {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	listID := r.PathValue("list")
+	if _, list := b.findList(listID); list == nil {
+		writeError(w, http.StatusNotFound, "task list not found")
+		return
+	}
+	b.record(r)
+	task.Id = b.newID("task")
+	task.Kind = "tasks#task"
+	task.Parent = r.URL.Query().Get("parent")
+	if task.Status == "" {
+		task.Status = "needsAction"
+	}
+	b.stamp(&task)
+	b.place(listID, &task, r.URL.Query().Get("previous"))
+	b.respondTask(w, listID, task.Id)
+}
+
+func (b *Backend) clear(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.record(r)
+	b.remove(r.PathValue("list"), func(task *tasksapi.Task) bool {
+		return task.Status == "completed"
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (b *Backend) getTask(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.respondTask(w, r.PathValue("list"), r.PathValue("task"))
+}
+
+// patchTask merges the fields sent by the client into the stored task,
+// unless If-Match names another ETag than the task's
+func (b *Backend) patchTask(w http.ResponseWriter, r *http.Request) {
+	var patch map[string]json.RawMessage
+	if !readJSON(w, r, &patch) {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	listID, taskID := r.PathValue("list"), r.PathValue("task")
+	i := b.findTask(listID, taskID)
+	if i < 0 {
+		writeError(w, http.StatusNotFound, "task not found")
+		return
+	}
+	task := b.tasks[listID][i]
+	if match := r.Header.Get("If-Match"); match != "" && match != task.Etag {
+		writeError(w, http.StatusPreconditionFailed, "task was modified")
+		return
+	}
+	b.record(r)
+
+	var fields map[string]json.RawMessage
+	current, _ := json.Marshal(task)
+	json.Unmarshal(current, &fields)
+	for key, value := range patch {
+		switch key {
+		case "id", "parent", "position", "kind", "selfLink":
+			continue
+		}
+		fields[key] = value
+	}
+	merged, _ := json.Marshal(fields)
+	var updated tasksapi.Task
+	if err := json.Unmarshal(merged, &updated); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	b.stamp(&updated)
+	b.tasks[listID][i] = &updated
+	b.respondTask(w, listID, taskID)
+}
+
+func (b *Backend) deleteTask(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	listID, taskID := r.PathValue("list"), r.PathValue("task")
+	if b.findTask(listID, taskID) < 0 {
+		writeError(w, http.StatusNotFound, "task not found")
+		return
+	}
+	b.record(r)
+	b.remove(listID, func(task *tasksapi.Task) bool {
+		return task.Id == taskID
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (b *Backend) moveTask(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	listID, taskID := r.PathValue("list"), r.PathValue("task")
+	i := b.findTask(listID, taskID)
+	if i < 0 {
+		writeError(w, http.StatusNotFound, "task not found")
+		return
+	}
+	b.record(r)
+
+	task := b.tasks[listID][i]
+	b.tasks[listID] = append(b.tasks[listID][:i], b.tasks[listID][i+1:]...)
+	if destination := r.URL.Query().Get("destinationTasklist"); destination != "" {
+		listID = destination
+	}
+	task.Parent = r.URL.Query().Get("parent")
+	b.stamp(task)
+	b.place(listID, task, r.URL.Query().Get("previous"))
+	b.respondTask(w, listID, taskID)
+}
+
+// respondTask writes a task with its current position; callers hold mu
+func (b *Backend) respondTask(w http.ResponseWriter, listID, taskID string) {
+	for _, task := range b.snapshot(listID) {
+		if task.Id == taskID {
+			writeJSON(w, task)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "task not found")
+}
+
+// page bounds the items of total that r asks for and returns the token of
+// the next page. Like the real API it returns 20 items unless maxResults,
+// at most limit, asks for more.
+func page(r *http.Request, total, limit int) (start, end int, next string) {
+	size := 20
+	if n, err := strconv.Atoi(r.URL.Query().Get("maxResults")); err == nil && n > 0 {
+		size = min(n, limit)
+	}
+	start, _ = strconv.Atoi(r.URL.Query().Get("pageToken"))
+	start = min(max(start, 0), total)
+	end = min(start+size, total)
+	if end < total {
+		next = strconv.Itoa(end)
+	}
+	return start, end, next
+}
+
+// readJSON decodes a request body, answering 400 when it is invalid
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError answers in the API's error format so googleapi.Error is filled
+func writeError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{"code": code, "message": message},
+	})
+}
@@ -0,0 +1,59 @@
+package zaptest
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+
+	"zap/llm"
+)
+
+// UpdateEnv is the environment variable that makes Golden rewrite golden
+// files instead of comparing against them
+const UpdateEnv = "ZAP_UPDATE_GOLDEN"
+
+// TB is the part of testing.TB the helpers need
+type TB interface {
+	Helper()
+	Fatalf(format string, args ...interface{})
+}
+
+// Golden compares got with the contents of path. With ZAP_UPDATE_GOLDEN=1
+// it writes got to path instead.
+func Golden(t TB, path string, got []byte) {
+	t.Helper()
+	if os.Getenv(UpdateEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("unable to create golden directory: %v", err)
+		}
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatalf("unable to write golden file: %v", err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unable to read golden file (run with %s=1 to create it): %v", UpdateEnv, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("%s differs from the output (run with %s=1 to update):\n--- want\n%s\n--- got\n%s", path, UpdateEnv, want, got)
+	}
+}
+
+// Prompts concatenates the prompts a fake provider received, each after its
+// system instruction, separated by a marker line, for comparing with a
+// golden file
+func Prompts(requests []llm.Request) []byte {
+	var buf bytes.Buffer
+	for i, req := range requests {
+		if i > 0 {
+			buf.WriteString("\n----\n")
+		}
+		if req.System != "" {
+			buf.WriteString(req.System)
+			buf.WriteString("\n\n")
+		}
+		buf.WriteString(req.Prompt)
+	}
+	return buf.Bytes()
+}
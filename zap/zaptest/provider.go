@@ -0,0 +1,206 @@
+// Package zaptest provides fakes for exercising zap without Google or a
+// model: an LLM provider that replays recorded answers, an in-memory Tasks
+// API server and golden-file helpers.
+package zaptest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"zap/llm"
+)
+
+// ProviderName is what fake providers report as their name
+const ProviderName = "fixture"
+
+// Fixture is a recorded request and the model's answer to it
+type Fixture struct {
+	System       string `json:"system,omitempty"`
+	Prompt       string `json:"prompt"`
+	JSON         bool   `json:"json"`
+	Response     string `json:"response"`
+	Error        string `json:"error,omitempty"`
+	InputTokens  int    `json:"inputTokens,omitempty"`
+	OutputTokens int    `json:"outputTokens,omitempty"`
+}
+
+// FixtureKey names the fixture for a prompt and its system instruction.
+// Prompts contain today's date, so fixtures only match when the clock is
+// pinned with datetime.NewFixedClock.
+func FixtureKey(system, prompt string) string {
+	sum := sha256.Sum256([]byte(system + "\x00" + prompt))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// response turns a fixture back into what a provider returns
+func (f Fixture) response() (llm.Response, error) {
+	resp := llm.Response{
+		Text:     f.Response,
+		Usage:    llm.Usage{InputTokens: f.InputTokens, OutputTokens: f.OutputTokens},
+		Provider: ProviderName,
+	}
+	if f.Error != "" {
+		return resp, errors.New(f.Error)
+	}
+	return resp, nil
+}
+
+// Replay answers requests from fixtures recorded in a directory, one
+// <key>.json file per prompt
+type Replay struct {
+	fixtures map[string]Fixture
+
+	mu       sync.Mutex
+	requests []llm.Request
+}
+
+// NewReplay loads every fixture in dir
+func NewReplay(dir string) (*Replay, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	r := &Replay{fixtures: make(map[string]Fixture, len(paths))}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read fixture: %v", err)
+		}
+		var fixture Fixture
+		if err := json.Unmarshal(data, &fixture); err != nil {
+			return nil, fmt.Errorf("invalid fixture %s: %v", path, err)
+		}
+		r.fixtures[FixtureKey(fixture.System, fixture.Prompt)] = fixture
+	}
+	return r, nil
+}
+
+// Name returns ProviderName
+func (r *Replay) Name() string {
+	return ProviderName
+}
+
+// Generate returns the recorded answer for the prompt. Unknown prompts are
+// an error rather than a guess, so a changed prompt shows up as a failure.
+func (r *Replay) Generate(ctx context.Context, req llm.Request) (llm.Response, error) {
+	r.mu.Lock()
+	r.requests = append(r.requests, req)
+	r.mu.Unlock()
+
+	key := FixtureKey(req.System, req.Prompt)
+	fixture, ok := r.fixtures[key]
+	if !ok {
+		return llm.Response{}, fmt.Errorf("no fixture %s.json for prompt; record it with zaptest.NewRecorder", key)
+	}
+	return fixture.response()
+}
+
+// CountTokens returns llm.ErrNoTokenCount
+func (r *Replay) CountTokens(ctx context.Context, req llm.Request) (llm.TokenCount, error) {
+	return llm.TokenCount{}, llm.ErrNoTokenCount
+}
+
+// Requests returns the requests received so far
+func (r *Replay) Requests() []llm.Request {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]llm.Request(nil), r.requests...)
+}
+
+// Close is a no-op
+func (r *Replay) Close() error {
+	return nil
+}
+
+// Recorder forwards requests to a real provider and saves each exchange as
+// a fixture that Replay can serve later
+type Recorder struct {
+	llm.Provider
+	dir string
+}
+
+// NewRecorder records provider's answers into dir
+func NewRecorder(provider llm.Provider, dir string) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("unable to create fixture directory: %v", err)
+	}
+	return &Recorder{Provider: provider, dir: dir}, nil
+}
+
+// Generate forwards the request and writes the fixture
+func (r *Recorder) Generate(ctx context.Context, req llm.Request) (llm.Response, error) {
+	resp, err := r.Provider.Generate(ctx, req)
+	fixture := Fixture{
+		System:       req.System,
+		Prompt:       req.Prompt,
+		JSON:         req.JSON,
+		Response:     resp.Text,
+		InputTokens:  resp.Usage.InputTokens,
+		OutputTokens: resp.Usage.OutputTokens,
+	}
+	if err != nil {
+		fixture.Error = err.Error()
+	}
+	data, marshalErr := json.MarshalIndent(fixture, "", "  ")
+	if marshalErr != nil {
+		return resp, fmt.Errorf("unable to encode fixture: %v", marshalErr)
+	}
+	path := filepath.Join(r.dir, FixtureKey(req.System, req.Prompt)+".json")
+	if writeErr := os.WriteFile(path, append(data, '\n'), 0644); writeErr != nil {
+		return resp, fmt.Errorf("unable to write fixture: %v", writeErr)
+	}
+	return resp, err
+}
+
+// Scripted answers requests with fixed responses in order, for parser
+// tests that don't care about the prompt
+type Scripted struct {
+	mu        sync.Mutex
+	responses []string
+	requests  []llm.Request
+}
+
+// NewScripted creates a provider that returns responses one by one
+func NewScripted(responses ...string) *Scripted {
+	return &Scripted{responses: responses}
+}
+
+// Name returns ProviderName
+func (s *Scripted) Name() string {
+	return ProviderName
+}
+
+// Generate returns the next response, or an error once they run out
+func (s *Scripted) Generate(ctx context.Context, req llm.Request) (llm.Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, req)
+	if len(s.requests) > len(s.responses) {
+		return llm.Response{}, fmt.Errorf("unexpected request %d; only %d responses scripted", len(s.requests), len(s.responses))
+	}
+	return llm.Response{Text: s.responses[len(s.requests)-1], Provider: ProviderName}, nil
+}
+
+// CountTokens returns llm.ErrNoTokenCount
+func (s *Scripted) CountTokens(ctx context.Context, req llm.Request) (llm.TokenCount, error) {
+	return llm.TokenCount{}, llm.ErrNoTokenCount
+}
+
+// Requests returns the requests received so far
+func (s *Scripted) Requests() []llm.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]llm.Request(nil), s.requests...)
+}
+
+// Close is a no-op
+func (s *Scripted) Close() error {
+	return nil
+}